@@ -0,0 +1,180 @@
+package lifecycled
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuditRecord is written to the audit log for every termination notice that is handled.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	InstanceID string    `json:"instanceId"`
+	RunID      string    `json:"runId,omitempty"`
+	Notice     string    `json:"notice"`
+	Transition string    `json:"transition,omitempty"`
+	ReceivedAt time.Time `json:"receivedAt,omitempty"`
+
+	// Message is the notice as it was received, e.g. the SNS envelope for autoscaling
+	// notices, with the lifecycle action token masked.
+	Message string `json:"message,omitempty"`
+
+	// Handler that was executed, which is empty for notices that were coalesced with another.
+	Handler   string `json:"handler,omitempty"`
+	Coalesced bool   `json:"coalesced,omitempty"`
+
+	// ExitCode of the handler, which is -1 if the handler failed without an exit code.
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+
+	HandlerDuration    float64 `json:"handlerDurationSeconds"`
+	TotalDuration      float64 `json:"totalDurationSeconds"`
+	HeartbeatsSent     int     `json:"heartbeatsSent"`
+	HeartbeatsFailed   int     `json:"heartbeatsFailed"`
+	CompletionResult   string  `json:"completionResult,omitempty"`
+	CompletionError    string  `json:"completionError,omitempty"`
+	CompletionDuration float64 `json:"completionDurationSeconds,omitempty"`
+	CompletionRetries  int     `json:"completionRetries,omitempty"`
+
+	Timeline []TimelineEvent `json:"timeline,omitempty"`
+}
+
+// NewAuditLog returns an audit log which appends records to the file at path. When the file would
+// exceed maxSize bytes it is rotated, keeping the given number of previous files (path.1 being the newest).
+func NewAuditLog(path string, maxSize int64, keep int) *AuditLog {
+	return &AuditLog{path: path, maxSize: maxSize, keep: keep}
+}
+
+// AuditLog is an append-only file with a JSON line for each notice that was handled.
+type AuditLog struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+}
+
+// Write the record to the audit log, and sync it to disk.
+func (a *AuditLog) Write(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.rotate(int64(len(line))); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %s", err)
+	}
+
+	// Action tokens are masked, but the messages may still be sensitive
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotate the file if writing n bytes would exceed the maximum size.
+func (a *AuditLog) rotate(n int64) error {
+	if a.maxSize <= 0 {
+		return nil
+	}
+	info, err := os.Stat(a.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Size() == 0 || info.Size()+n <= a.maxSize {
+		return nil
+	}
+
+	if a.keep < 1 {
+		return os.Remove(a.path)
+	}
+	if err := os.Remove(fmt.Sprintf("%s.%d", a.path, a.keep)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := a.keep - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", a.path, i), fmt.Sprintf("%s.%d", a.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(a.path, a.path+".1")
+}
+
+// SetAuditLog configures the daemon to write a record to the audit log for each notice it handles.
+func (d *Daemon) SetAuditLog(a *AuditLog) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.auditLog = a
+}
+
+// audit records how the notice was handled. Failing to write the record is
+// logged, but doesn't change the outcome of handling the notice.
+func (d *Daemon) audit(notice TerminationNotice, runID string, handler Handler, summary *Summary, log *logrus.Entry) {
+	d.mu.Lock()
+	auditLog := d.auditLog
+	d.mu.Unlock()
+	if auditLog == nil {
+		return
+	}
+
+	record := &AuditRecord{
+		Time:               time.Now(),
+		InstanceID:         d.instanceID,
+		RunID:              runID,
+		Notice:             summary.Notice,
+		Transition:         summary.Transition,
+		ExitCode:           exitCode(summary.HandlerError),
+		HandlerDuration:    summary.HandlerDuration.Seconds(),
+		TotalDuration:      summary.TotalDuration.Seconds(),
+		HeartbeatsSent:     summary.HeartbeatsSent,
+		HeartbeatsFailed:   summary.HeartbeatsFailed,
+		CompletionResult:   summary.CompletionResult,
+		CompletionDuration: summary.CompletionDuration.Seconds(),
+		CompletionRetries:  summary.CompletionRetries,
+		Timeline:           summary.Timeline,
+	}
+	if n, ok := notice.(DetailedNotice); ok {
+		record.ReceivedAt = n.ReceivedAt()
+		record.Message = string(redactedRaw(n))
+	}
+	if _, ok := handler.(*coalescedHandler); ok {
+		record.Coalesced = true
+	} else {
+		record.Handler = handlerName(handler)
+	}
+	if summary.HandlerError != nil {
+		record.Error = summary.HandlerError.Error()
+	}
+	if summary.CompletionError != nil {
+		record.CompletionError = summary.CompletionError.Error()
+	}
+
+	if err := auditLog.Write(record); err != nil {
+		log.WithError(err).Error("Failed to write audit log")
+	}
+}
+
+// handlerName describes the handler, using its String method if it has one.
+func handlerName(handler Handler) string {
+	if s, ok := handler.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", handler)
+}
@@ -0,0 +1,112 @@
+package lifecycled_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+func readAuditRecords(t *testing.T, path string) []lifecycled.AuditRecord {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %s", err)
+	}
+	defer f.Close()
+
+	var records []lifecycled.AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r lifecycled.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("failed to parse audit record: %s", err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestDaemonAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID: "i-000000000000",
+		AuditFile:  path,
+	}, nil, nil, nil, nil, logger)
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, failingHandler{}); err == nil {
+		t.Fatal("expected handler to fail")
+	}
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, lifecycled.ChainHandler{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	records := readAuditRecords(t, path)
+	if got, want := len(records), 2; got != want {
+		t.Fatalf("expected %d audit records and got %d", want, got)
+	}
+	if got, want := records[0].Error, "failed"; got != want {
+		t.Errorf("expected error '%s' and got '%s'", want, got)
+	}
+	if got, want := records[0].ExitCode, -1; got != want {
+		t.Errorf("expected exit code %d and got %d", want, got)
+	}
+	if got, want := records[0].Handler, "lifecycled_test.failingHandler"; got != want {
+		t.Errorf("expected handler '%s' and got '%s'", want, got)
+	}
+	if got, want := records[1].Notice, "fake"; got != want {
+		t.Errorf("expected notice '%s' and got '%s'", want, got)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Mode().Perm(), os.FileMode(0600); got != want {
+		t.Errorf("expected audit log mode %s and got %s", want, got)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each record is larger than half the maximum size, so every write rotates
+	path := filepath.Join(dir, "audit.log")
+	audit := lifecycled.NewAuditLog(path, 300, 2)
+	for _, notice := range []string{"first", "second", "third", "fourth"} {
+		if err := audit.Write(&lifecycled.AuditRecord{Notice: notice, Message: strings.Repeat("x", 100)}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	for path, notice := range map[string]string{
+		path:        "fourth",
+		path + ".1": "third",
+		path + ".2": "second",
+	} {
+		records := readAuditRecords(t, path)
+		if len(records) != 1 || records[0].Notice != notice {
+			t.Errorf("expected %s to contain the %s record and got %v", path, notice, records)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected only 2 rotated files to be kept")
+	}
+}
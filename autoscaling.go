@@ -3,18 +3,35 @@ package lifecycled
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/autoscaling"
-	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	autoscalingtypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// AutoscalingClient for testing purposes
+// AutoscalingClient is the subset of the autoscaling API that lifecycled uses, which
+// *autoscaling.Client implements.
 //
 //go:generate mockgen -destination=mocks/mock_autoscaling_client.go -package=mocks github.com/triarius/lifecycled AutoscalingClient
-type AutoscalingClient autoscalingiface.AutoScalingAPI
+type AutoscalingClient interface {
+	RecordLifecycleActionHeartbeat(context.Context, *autoscaling.RecordLifecycleActionHeartbeatInput, ...func(*autoscaling.Options)) (*autoscaling.RecordLifecycleActionHeartbeatOutput, error)
+	CompleteLifecycleAction(context.Context, *autoscaling.CompleteLifecycleActionInput, ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error)
+	DescribeAutoScalingInstances(context.Context, *autoscaling.DescribeAutoScalingInstancesInput, ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingInstancesOutput, error)
+	DescribeLifecycleHooks(context.Context, *autoscaling.DescribeLifecycleHooksInput, ...func(*autoscaling.Options)) (*autoscaling.DescribeLifecycleHooksOutput, error)
+}
 
 // Envelope ...
 type Envelope struct {
@@ -22,6 +39,16 @@ type Envelope struct {
 	Subject string    `json:"Subject"`
 	Time    time.Time `json:"Time"`
 	Message string    `json:"Message"`
+
+	// The fields of the signature of SNS (see SignatureVerifier).
+	MessageID        string `json:"MessageId,omitempty"`
+	TopicArn         string `json:"TopicArn,omitempty"`
+	Timestamp        string `json:"Timestamp,omitempty"`
+	SignatureVersion string `json:"SignatureVersion,omitempty"`
+	Signature        string `json:"Signature,omitempty"`
+	SigningCertURL   string `json:"SigningCertURL,omitempty"`
+	SubscribeURL     string `json:"SubscribeURL,omitempty"`
+	Token            string `json:"Token,omitempty"`
 }
 
 // Message ...
@@ -32,26 +59,382 @@ type Message struct {
 	ActionToken string    `json:"LifecycleActionToken"`
 	Transition  string    `json:"LifecycleTransition"`
 	HookName    string    `json:"LifecycleHookName"`
+
+	// NotificationMetadata of the lifecycle hook, which may have a correlation id for the run id.
+	NotificationMetadata string `json:"NotificationMetadata,omitempty"`
+
+	// Event is TestNotificationEvent for the test notifications of autoscaling, and Test marks the
+	// test terminations of NewTestMessage. Test messages are identified by their RequestID.
+	Event     string `json:"Event,omitempty"`
+	RequestID string `json:"RequestId,omitempty"`
+	Test      bool   `json:"Test,omitempty"`
+}
+
+// IsTest returns true if the message is a test message, which is never handled.
+func (m *Message) IsTest() bool {
+	return m.Test || m.Event == TestNotificationEvent
+}
+
+// Lifecycle action results.
+const (
+	ResultContinue = "CONTINUE"
+	ResultAbandon  = "ABANDON"
+)
+
+// Lifecycle action completion policies.
+const (
+	// CompleteAlways completes the lifecycle action whatever the outcome of the handler.
+	CompleteAlways = "always"
+
+	// CompleteOnSuccess only completes the lifecycle action if the handler succeeds.
+	CompleteOnSuccess = "on-success"
+
+	// CompleteNever leaves the lifecycle action to be completed by another system, or to time out.
+	CompleteNever = "never"
+)
+
+// AutoscalingOptions controls how autoscaling termination notices are handled.
+type AutoscalingOptions struct {
+	// HeartbeatInterval is the interval between lifecycle action heartbeats. If it is not set, it is
+	// derived from the heartbeat timeout of the lifecycle hook when a notice is received.
+	HeartbeatInterval time.Duration
+
+	// HeartbeatJitter sends each heartbeat up to this much earlier than scheduled, to
+	// spread the heartbeats of many instances and avoid autoscaling API throttling.
+	HeartbeatJitter time.Duration
+
+	// PanicResult is the lifecycle action result sent when handling panics (defaults to CONTINUE).
+	PanicResult string
+
+	// VerifyTermination confirms that the instance is in a terminating lifecycle
+	// state before executing the handler. Requires autoscaling:DescribeAutoScalingInstances.
+	VerifyTermination bool
+
+	// MaxHeartbeatDuration caps the total time that heartbeats are sent for a notice (defaults to
+	// just under the 48 hour limit of the autoscaling API). When it is reached, the handler is
+	// cancelled and the lifecycle action is completed with the TimeoutResult.
+	MaxHeartbeatDuration time.Duration
+
+	// TimeoutResult is the lifecycle action result sent when MaxHeartbeatDuration is reached (defaults to CONTINUE).
+	TimeoutResult string
+
+	// CancelOnLostAction cancels the handler if the lifecycle action is completed by
+	// another actor or times out, since the handler can no longer influence the outcome.
+	CancelOnLostAction bool
+
+	// Complete is the lifecycle action completion policy (defaults to CompleteAlways).
+	Complete string
+
+	// CompletionDelay holds the lifecycle action open for this long after the handler
+	// has returned, e.g. to let in-flight requests finish after connection draining starts.
+	CompletionDelay time.Duration
+
+	// CheckpointDir is a directory where a checkpoint is kept while a notice is being handled,
+	// so that the lifecycle action can be recovered after a crash (disabled if empty).
+	CheckpointDir string
+
+	// RecoverHandler is RecoverRerun (the default) to execute the handler again for a notice
+	// that is recovered from a checkpoint, or RecoverSkip to only complete the lifecycle action.
+	RecoverHandler string
+
+	// BeforeHeartbeat is called before each heartbeat, and can stop heartbeats (optional).
+	BeforeHeartbeat HeartbeatHook
+
+	// Rules classify lifecycle hook messages as termination or checkpoint notices (see NoticeRule).
+	Rules []NoticeRule
+
+	// ShutdownPolicy is how the lifecycle action is completed if the daemon shuts down while the
+	// notice is being handled: ShutdownContinue (the default), ShutdownAbandon or ShutdownLeave.
+	ShutdownPolicy string
+
+	// ShutdownTimeout bounds the time spent completing the lifecycle action and deleting
+	// the queue, which happens even if the daemon is shutting down (defaults to 10s).
+	ShutdownTimeout time.Duration
+
+	// AWSCallTimeout bounds each attempt of the AWS API calls of the listener, and
+	// AWSHeartbeatTimeout those of the heartbeats, so that an attempt that hangs is retried
+	// rather than blocking the heartbeats or the completion (see Config.AWSCallTimeout). Zero
+	// disables a timeout.
+	AWSCallTimeout      time.Duration
+	AWSHeartbeatTimeout time.Duration
+
+	// NoCleanup retains the queue and subscription in Cleanup, which are reattached to by the
+	// next listener with the same queue name and topic (the queue can be pruned with PruneQueues).
+	NoCleanup bool
+
+	// PollSummaryInterval is the interval between log lines that summarize the polls of the
+	// queue (defaults to 5m), because logging each poll would be too noisy.
+	PollSummaryInterval time.Duration
+
+	// PollMaxIdleGap enables adaptive polling of the queue: once no messages have been received
+	// for PollIdleAfter since the listener started or the last message, the gap between polls is
+	// stretched from 5s, doubling on each poll that receives nothing, up to PollMaxIdleGap. It
+	// polls at full speed again as soon as a message arrives or the daemon receives a notice
+	// from another listener. It is disabled if PollMaxIdleGap is zero.
+	PollIdleAfter  time.Duration
+	PollMaxIdleGap time.Duration
+
+	// IAMPropagationTimeout is how long after the listener first starts that subscribing the
+	// queue and polling it are retried when they are denied, since the role of the instance or
+	// the policy of the queue may not have propagated yet when the instance boots. The listener
+	// fails if they are still denied after it (disabled if zero).
+	IAMPropagationTimeout time.Duration
+
+	// ClockSkewTolerance is the skew between the clocks of AWS and the instance that is expected.
+	// Latencies that are negative because of skew are reported as zero, with a warning if the
+	// skew is more than the tolerance, which is also added to StaleMessageAge.
+	ClockSkewTolerance time.Duration
+
+	// StaleMessageAge discards the messages whose lifecycle hook fired longer ago than it, rather
+	// than handling them, e.g. the messages of a lifecycle action that timed out left in a queue
+	// that was retained with --no-cleanup and reattached to (disabled if zero).
+	StaleMessageAge time.Duration
+
+	// SelfCheck checks the permissions that the listener needs once it has first subscribed the
+	// queue, with calls that have no side effects, and logs the result of each (see SelfCheck).
+	SelfCheck bool
+
+	// DeliveryCheck publishes a test notification for the instance to the topic once the listener
+	// has first subscribed the queue, and checks that it is delivered to the queue within
+	// deliveryCheckTimeout, e.g. that the key of an encrypted topic allows it. The result is
+	// recorded with those of the self-check.
+	DeliveryCheck bool
+
+	// QuarantineDir is a directory where messages that fail to parse are written, keeping the
+	// newest QuarantineKeep of them (all if zero), for inspection (disabled if empty).
+	QuarantineDir  string
+	QuarantineKeep int
+
+	// SignatureVerifier verifies the SNS signatures of the messages before they are trusted, and
+	// the messages that fail are rejected and quarantined (disabled if nil).
+	SignatureVerifier *SignatureVerifier
+
+	// TracerProvider traces the heartbeats and the completion of the lifecycle action, as children
+	// of the span in the context that the notice is handled with (optional).
+	TracerProvider trace.TracerProvider
+
+	// metrics of the daemon that the listener belongs to, if any
+	metrics *Metrics
+
+	// logs of the daemon that the listener belongs to, if any
+	logs *componentLoggers
+
+	// credentials of the daemon that the listener belongs to, if any
+	credentials *credentialHealth
+
+	// selfCheck records the results of the self-check for the daemon that the listener belongs
+	// to, if any
+	selfCheck *selfCheckResults
+
+	// kms checks the key of an encrypted topic in the self-check, if any
+	kms KMSClient
+
+	// tokens are shared by the listeners of the topics of the daemon, if there are several
+	tokens *actionTokens
 }
 
+const (
+	verifyTerminationAttempts = 3
+	verifyTerminationInterval = time.Second
+
+	// The autoscaling API limits a lifecycle action to 48 hours, including heartbeats
+	defaultMaxHeartbeatDuration = 48*time.Hour - 10*time.Minute
+
+	defaultPollSummaryInterval = 5 * time.Minute
+)
+
+// HeartbeatTimeoutError is returned when the handler is cancelled because heartbeats
+// have been sent for the maximum heartbeat duration.
+type HeartbeatTimeoutError struct {
+	Duration time.Duration
+	Err      error
+}
+
+func (e *HeartbeatTimeoutError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("heartbeats stopped after the maximum duration of %s: %s", e.Duration, e.Err)
+	}
+	return fmt.Sprintf("heartbeats stopped after the maximum duration of %s", e.Duration)
+}
+
+// Unwrap returns the error returned by the handler.
+func (e *HeartbeatTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Code returns CodeHeartbeatTimeout.
+func (e *HeartbeatTimeoutError) Code() string {
+	return CodeHeartbeatTimeout
+}
+
+// ErrLifecycleActionLost is returned when the handler is cancelled because the lifecycle
+// action was completed by another actor or timed out (see CancelOnLostAction).
+var ErrLifecycleActionLost = newSentinel(CodeHeartbeatLost, "lifecycle action is no longer active")
+
+// ErrHeartbeatLost is ErrLifecycleActionLost, which is returned once a heartbeat has found
+// that the lifecycle action is no longer active.
+var ErrHeartbeatLost = ErrLifecycleActionLost
+
+// Heartbeat intervals that are derived from the lifecycle hook are clamped to this range, and the
+// default is used if the hook can't be described.
+const (
+	defaultHeartbeatInterval = 10 * time.Second
+	minHeartbeatInterval     = 10 * time.Second
+	maxHeartbeatInterval     = 5 * time.Minute
+)
+
+// Heartbeat describes a lifecycle action heartbeat that is about to be sent.
+type Heartbeat struct {
+	Message *Message
+
+	// Number of the heartbeat, starting at 1, which includes heartbeats that failed.
+	Number int
+
+	// Elapsed is the time since heartbeats started.
+	Elapsed time.Duration
+}
+
+// HeartbeatHook is called before each lifecycle action heartbeat. Returning ErrStopHeartbeats
+// stops heartbeats without sending this one, and any other error also stops them and is logged.
+// The context is cancelled when heartbeats are stopped for another reason.
+type HeartbeatHook func(ctx context.Context, heartbeat *Heartbeat) error
+
+// ErrStopHeartbeats is returned by a HeartbeatHook to stop sending heartbeats, e.g. when
+// something else has taken over extending the lifecycle action.
+var ErrStopHeartbeats = errors.New("stop heartbeats")
+
+// ErrNotTerminating is returned when termination verification is enabled and the
+// instance is not in a terminating lifecycle state.
+var ErrNotTerminating = newSentinel(CodeNotTerminating, "instance is not terminating")
+
 // NewAutoscalingListener ...
-func NewAutoscalingListener(instanceID string, queue *Queue, autoscaling AutoscalingClient, heartbeatInterval time.Duration) *AutoscalingListener {
+func NewAutoscalingListener(instanceID string, queue *Queue, autoscaling AutoscalingClient, options AutoscalingOptions) *AutoscalingListener {
 	return &AutoscalingListener{
-		listenerType:      "autoscaling",
-		instanceID:        instanceID,
-		queue:             queue,
-		autoscaling:       autoscaling,
-		heartbeatInterval: heartbeatInterval,
+		listenerType: "autoscaling",
+		instanceID:   instanceID,
+		queue:        queue,
+		autoscaling:  autoscaling,
+		options:      options.withDefaults(),
+		woken:        make(chan struct{}, 1),
 	}
 }
 
+// timeouts returns the timeouts of the attempts of the AWS API calls.
+func (options AutoscalingOptions) timeouts() callTimeouts {
+	return callTimeouts{call: options.AWSCallTimeout, heartbeat: options.AWSHeartbeatTimeout}
+}
+
+// clock compares the timestamps of AWS with the clock of the instance.
+func (options AutoscalingOptions) clock() clock {
+	return clock{tolerance: options.ClockSkewTolerance}
+}
+
+// withDefaults returns the options with defaults for the settings that are not set.
+func (options AutoscalingOptions) withDefaults() AutoscalingOptions {
+	if options.PanicResult == "" {
+		options.PanicResult = ResultContinue
+	}
+	if options.MaxHeartbeatDuration <= 0 {
+		options.MaxHeartbeatDuration = defaultMaxHeartbeatDuration
+	}
+	if options.TimeoutResult == "" {
+		options.TimeoutResult = ResultContinue
+	}
+	if options.Complete == "" {
+		options.Complete = CompleteAlways
+	}
+	if options.TracerProvider == nil {
+		options.TracerProvider = trace.NewNoopTracerProvider()
+	}
+	if options.ShutdownTimeout <= 0 {
+		options.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if options.ShutdownPolicy == "" {
+		options.ShutdownPolicy = ShutdownContinue
+	}
+	if options.RecoverHandler == "" {
+		options.RecoverHandler = RecoverRerun
+	}
+	if options.PollSummaryInterval <= 0 {
+		options.PollSummaryInterval = defaultPollSummaryInterval
+	}
+	return options
+}
+
 // AutoscalingListener ...
 type AutoscalingListener struct {
-	listenerType      string
-	instanceID        string
-	queue             *Queue
-	autoscaling       AutoscalingClient
-	heartbeatInterval time.Duration
+	listenerType string
+	instanceID   string
+	queue        *Queue
+	autoscaling  AutoscalingClient
+	options      AutoscalingOptions
+	status       *listenerStatus
+	recovered    bool
+
+	// startedAt is when the listener first started, and polled is set once it has polled the
+	// queue successfully, see IAMPropagationTimeout
+	startedAt time.Time
+	polled    bool
+
+	// checked is set once the permissions of the listener have been checked, see SelfCheck
+	checked bool
+
+	// delivery is the marker of the delivery check, once it has been published, see DeliveryCheck
+	delivery *deliveryMarker
+
+	// woken to poll at full speed, see PollMaxIdleGap
+	woken chan struct{}
+}
+
+// iamPropagationRetry is the backoff of the calls that are denied while IAM propagates.
+var iamPropagationRetry = retryPolicy{backoff: 2 * time.Second, maxBackoff: 10 * time.Second}
+
+// propagating returns true if the call was denied within the IAM propagation timeout of the
+// listener first starting, when it is likely to be allowed once IAM has propagated.
+func (l *AutoscalingListener) propagating(err error) bool {
+	return isAuthorizationError(err) && time.Since(l.startedAt) < l.options.IAMPropagationTimeout
+}
+
+func (l *AutoscalingListener) setStatus(s *listenerStatus) {
+	l.status = s
+}
+
+// Cleanup deletes the sns subscription and sqs queue, if they exist and NoCleanup isn't set. Cleanup
+// is bounded by the shutdown timeout rather than a context, as it runs when the daemon is stopping.
+func (l *AutoscalingListener) Cleanup(log *logrus.Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.options.ShutdownTimeout)
+	defer cancel()
+
+	log = l.options.logs.entry(LogComponentQueue, log)
+	if l.options.NoCleanup {
+		if l.queue.url != "" {
+			log.WithFields(logrus.Fields{
+				"queueURL": l.queue.url,
+				"arn":      l.queue.subscriptionArn,
+			}).Warn("Retaining sqs queue and sns subscription, cleanup is disabled")
+		}
+		return
+	}
+	if l.queue.subscriptionArn != "" {
+		log.WithField("arn", l.queue.subscriptionArn).Debug("Deleting sns subscription")
+		if err := l.queue.Unsubscribe(ctx); err != nil {
+			log.WithError(err).Error("Failed to unsubscribe from sns topic")
+		}
+	}
+	if l.queue.url != "" {
+		log.WithField("queue", l.queue.name).Debug("Deleting sqs queue")
+		if err := l.queue.Delete(ctx); err != nil {
+			log.WithError(err).Error("Failed to delete queue")
+		}
+	}
+}
+
+// wake the listener to poll at full speed, if it is idle.
+func (l *AutoscalingListener) wake() {
+	select {
+	case l.woken <- struct{}{}:
+	default:
+	}
 }
 
 // Type returns a string describing the listener type.
@@ -59,51 +442,137 @@ func (l *AutoscalingListener) Type() string {
 	return l.listenerType
 }
 
-// Start the autoscaling lifecycle hook listener.
+// Start the autoscaling lifecycle hook listener. The queue and subscription are retained when
+// Start returns, so that it can be restarted and lifecycle actions can be completed while
+// shutting down, and Cleanup must be called to delete them (the Daemon does so once it has stopped).
 func (l *AutoscalingListener) Start(ctx context.Context, notices chan<- TerminationNotice, log *logrus.Entry) error {
-	log.WithField("queue", l.queue.name).Debug("Creating sqs queue")
-	if err := l.queue.Create(); err != nil {
-		return err
+	qlog := l.options.logs.entry(LogComponentQueue, log)
+	l.queue.log = qlog
+	l.queue.SetCallTimeout(l.options.AWSCallTimeout)
+	if l.startedAt.IsZero() {
+		l.startedAt = time.Now()
 	}
-	defer func() {
-		log.WithField("queue", l.queue.name).Debug("Deleting sqs queue")
-		if err := l.queue.Delete(); err != nil {
-			log.WithError(err).Error("Failed to delete queue")
+	l.status.setTopic(l.queue.topicArn)
+	if l.queue.url == "" {
+		qlog.WithField("queue", l.queue.name).Debug("Creating sqs queue")
+		if err := l.queue.Create(ctx); err != nil {
+			return err
 		}
-	}()
+	} else {
+		qlog.WithField("queueURL", l.queue.url).Info("Reattaching to existing sqs queue")
+	}
 
-	log.WithField("topic", l.queue.topicArn).Debug("Subscribing queue to sns topic")
-	if err := l.queue.Subscribe(); err != nil {
-		return err
+	if l.queue.subscriptionArn == "" {
+		qlog.WithField("topic", l.queue.topicArn).Debug("Subscribing queue to sns topic")
+		for attempt := 1; ; attempt++ {
+			err := l.queue.Subscribe(ctx)
+			if err == nil {
+				break
+			}
+			if !l.propagating(err) {
+				return err
+			}
+			qlog.WithError(err).WithField("attempt", attempt).Info("Subscribing the queue was denied, waiting for IAM propagation")
+			if !iamPropagationRetry.sleep(ctx, attempt, err) {
+				return nil
+			}
+		}
+	} else {
+		qlog.WithField("arn", l.queue.subscriptionArn).Info("Reattaching to existing sns subscription")
 	}
-	defer func() {
-		log.WithField("arn", l.queue.subscriptionArn).Debug("Deleting sns subscription")
-		if err := l.queue.Unsubscribe(); err != nil {
-			log.WithError(err).Error("Failed to unsubscribe from sns topic")
+	l.status.setQueueURL(l.queue.url)
+	l.status.setState(ListenerRunning)
+
+	if !l.checked && l.options.SelfCheck {
+		l.checked = true
+		l.options.selfCheck.set(log.WithField("check", "self-check"), l.queue.topicArn, SelfCheck(ctx, l.queue, l.autoscaling, l.options.kms, l.instanceID))
+	}
+	if l.delivery == nil && l.options.DeliveryCheck {
+		l.delivery = l.publishDeliveryMarker(ctx, log)
+	}
+
+	if !l.recovered && l.options.CheckpointDir != "" {
+		l.recovered = true
+		if !l.recover(ctx, notices, log) {
+			return nil
 		}
-	}()
+	}
 
+	qlog.WithField("queueURL", l.queue.url).Info("Polling sqs for messages")
+	polls := &pollSummary{interval: l.options.PollSummaryInterval, since: time.Now()}
+	samples := newLogSampler()
+	defer samples.flush()
+	failures := 0
+	idle := newIdlePoller(l.options.PollIdleAfter, l.options.PollMaxIdleGap, l.woken)
+	var buf []byte
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		default:
-			log.WithField("queueURL", l.queue.url).Debug("Polling sqs for messages")
 			messages, err := l.queue.GetMessages(ctx)
+			// Polls that are denied before the first successful poll are waiting for IAM to
+			// propagate, until the timeout
+			denied := err != nil && !l.polled && isAuthorizationError(err)
+			switch {
+			case denied && l.propagating(err):
+				qlog.WithError(err).Info("Polling the queue was denied, waiting for IAM propagation")
+			case denied && l.options.IAMPropagationTimeout > 0:
+				return fmt.Errorf("%w, still denied %s after starting", err, l.options.IAMPropagationTimeout)
+			case err != nil:
+				samples.warn(qlog, err, "Failed to get messages from SQS")
+			default:
+				l.polled = true
+				samples.recovered(qlog, "Recovered from failing to get messages from SQS")
+			}
+			l.status.polled(err)
+			l.options.credentials.observe(qlog, err)
+			polls.record(len(messages), err, qlog)
 			if err != nil {
-				log.WithError(err).Warn("Failed to get messages from SQS")
+				// Back off from an API that is failing or throttling the polls
+				failures++
+				if !retryPolicies["ReceiveMessage"].sleep(ctx, failures, err) {
+					return nil
+				}
+				continue
 			}
+			failures = 0
+			receivedAt := time.Now()
 			for _, m := range messages {
+				// unmarshal outer layer, from a buffer that is reused for each message
 				var env Envelope
-				var msg Message
+				buf = append(buf[:0], aws.ToString(m.Body)...)
+				envErr := json.Unmarshal(buf, &env)
 
-				if err := l.queue.DeleteMessage(ctx, aws.StringValue(m.ReceiptHandle)); err != nil {
-					log.WithError(err).Warn("Failed to delete message")
+				// A message is left in the queue to be verified again when it is redelivered if
+				// its signing certificate can't be fetched, so that an outage doesn't drop it
+				var sigErr error
+				if l.options.SignatureVerifier != nil && envErr == nil {
+					sigErr = l.options.SignatureVerifier.Verify(ctx, &env, l.queue.topicArn)
+					if errors.Is(sigErr, errCertUnavailable) {
+						qlog.WithError(sigErr).Warn("Failed to verify message, it is left in the queue to retry")
+						continue
+					}
 				}
 
-				// unmarshal outer layer
-				if err := json.Unmarshal([]byte(*m.Body), &env); err != nil {
-					log.WithError(err).Error("Failed to unmarshal envelope")
+				if err := l.queue.DeleteMessage(ctx, aws.ToString(m.ReceiptHandle)); err != nil {
+					qlog.WithError(err).Warn("Failed to delete message")
+				}
+
+				if envErr != nil {
+					l.parseFailed(ParseFailureEnvelope, "Failed to unmarshal envelope", []byte(aws.ToString(m.Body)), envErr, polls, log)
+					continue
+				}
+				if sigErr != nil {
+					l.parseFailed(ParseFailureSignature, "Rejected message with an invalid signature", []byte(aws.ToString(m.Body)), sigErr, polls, log)
+					continue
+				}
+
+				// The messages of the other instances of a shared topic, of which there can be
+				// thousands in a scale-in, are skipped without parsing them
+				buf = append(buf[:0], env.Message...)
+				if !mayConcern(buf, l.instanceID) {
+					log.Debug("Skipping autoscaling message, it doesn't mention the instance id")
 					continue
 				}
 
@@ -112,9 +581,24 @@ func (l *AutoscalingListener) Start(ctx context.Context, notices chan<- Terminat
 					"subject": env.Subject,
 				}).Debug("Received an SQS message")
 
-				// unmarshal inner layer
-				if err := json.Unmarshal([]byte(env.Message), &msg); err != nil {
-					log.WithError(err).Error("Failed to unmarshal autoscaling message")
+				// unmarshal inner layer, which is a lifecycle hook message or an EventBridge event
+				msg, err := parseLifecycleMessage(buf)
+				if err != nil {
+					l.parseFailed(ParseFailureMessage, "Failed to unmarshal autoscaling message", []byte(env.Message), err, polls, log)
+					continue
+				}
+
+				// Test messages are only recorded, and never reach the autoscaling API. Test
+				// notifications of autoscaling are for the group rather than an instance
+				if msg.IsTest() {
+					if msg.InstanceID == "" || msg.InstanceID == l.instanceID {
+						log.WithFields(logrus.Fields{
+							"id":    msg.RequestID,
+							"group": msg.GroupName,
+						}).Info("Received test message, it is not handled")
+						l.status.testReceived(msg.RequestID, receivedAt)
+						l.deliveryReceived(msg.RequestID, receivedAt, log)
+					}
 					continue
 				}
 
@@ -123,69 +607,935 @@ func (l *AutoscalingListener) Start(ctx context.Context, notices chan<- Terminat
 					continue
 				}
 
-				if msg.Transition != "autoscaling:EC2_INSTANCE_TERMINATING" {
-					log.WithField("transition", msg.Transition).Debug("Skipping autoscaling event, not a termination notice")
+				class := classify(l.options.Rules, msg)
+				if class == NoticeIgnore {
+					log.WithFields(logrus.Fields{
+						"transition":    msg.Transition,
+						"lifecycleHook": msg.HookName,
+					}).Debug("Skipping autoscaling event, not a termination or checkpoint notice")
 					continue
 				}
 
-				notices <- &autoscalingTerminationNotice{
-					noticeType:        l.Type(),
-					message:           &msg,
-					autoscaling:       l.autoscaling,
-					heartbeatInterval: l.heartbeatInterval,
+				noticeType := l.Type()
+				if class == NoticeCheckpoint {
+					noticeType = CheckpointNoticeType
 				}
-				return nil
+				notice := &autoscalingTerminationNotice{
+					noticeType:  noticeType,
+					class:       class,
+					message:     msg,
+					autoscaling: l.autoscaling,
+					options:     l.options,
+					receivedAt:  receivedAt,
+					publishedAt: env.Time,
+					sentAt:      sentTimestamp(m),
+					raw:         []byte(aws.ToString(m.Body)),
+				}
+
+				// A retained queue can hold the messages of lifecycle actions from before the
+				// daemon started, e.g. that timed out, which are discarded rather than handled
+				if firedAt := notice.hookFiredAt(); l.options.clock().stale(firedAt, receivedAt, l.options.StaleMessageAge) {
+					log.WithFields(logrus.Fields{
+						"hookFiredAt": firedAt.UTC().Format(time.RFC3339),
+						"maxAge":      l.options.StaleMessageAge.String(),
+						"tolerance":   l.options.ClockSkewTolerance.String(),
+					}).Warn("Discarding stale autoscaling message")
+					continue
+				}
+
+				// The messages of a lifecycle action are mirrored to each topic, and handled once
+				if !l.options.tokens.first(msg.ActionToken) {
+					log.WithField("topic", l.queue.topicArn).Debug("Skipping autoscaling message, it was received from another topic")
+					continue
+				}
+				select {
+				case notices <- notice:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+
+			l.deliveryTimedOut(time.Now(), log)
+
+			// Stretch the gap before the next poll while the queue is idle
+			if l.options.PollMaxIdleGap > 0 {
+				if gap := idle.next(time.Now(), len(messages) > 0); gap > 0 {
+					l.status.setPollMode(PollModeIdle, time.Now().Add(gap))
+					if !idle.wait(ctx, gap) {
+						return nil
+					}
+				}
+				l.status.setPollMode(PollModeFast, time.Time{})
 			}
 		}
 	}
 }
 
+// pollSummary counts the polls of the queue, which are logged as a periodic summary rather
+// than individually.
+type pollSummary struct {
+	interval time.Duration
+	since    time.Time
+	polls    int
+	messages int
+	errors   int
+
+	// parseFailures are the messages that could not be parsed
+	parseFailures int
+}
+
+// record a poll, and log the summary once the interval has passed since the last one.
+func (s *pollSummary) record(messages int, err error, log *logrus.Entry) {
+	s.polls++
+	s.messages += messages
+	if err != nil {
+		s.errors++
+	}
+	if time.Since(s.since) < s.interval {
+		return
+	}
+	log.WithFields(logrus.Fields{
+		"polls":         s.polls,
+		"messages":      s.messages,
+		"errors":        s.errors,
+		"parseFailures": s.parseFailures,
+		"interval":      s.interval.String(),
+	}).Info("Polled sqs for messages")
+	s.since, s.polls, s.messages, s.errors, s.parseFailures = time.Now(), 0, 0, 0, 0
+}
+
+// recover sends notices for the lifecycle actions that have a checkpoint, which were being handled
+// when the daemon crashed. It returns false if the context was cancelled while sending notices.
+func (l *AutoscalingListener) recover(ctx context.Context, notices chan<- TerminationNotice, log *logrus.Entry) bool {
+	checkpoints, err := readCheckpoints(l.options.CheckpointDir, l.instanceID, log)
+	if err != nil {
+		log.WithError(err).Error("Failed to read checkpoints")
+		return true
+	}
+	for path, c := range checkpoints {
+		log := log.WithFields(logrus.Fields{
+			"lifecycleHook": c.HookName,
+			"actionToken":   maskToken(c.ActionToken),
+			"startedAt":     c.StartedAt.Format(time.RFC3339),
+		})
+
+		// Check that the action is still active before resuming it
+		_, err := l.autoscaling.RecordLifecycleActionHeartbeat(ctx, &autoscaling.RecordLifecycleActionHeartbeatInput{
+			AutoScalingGroupName: aws.String(c.GroupName),
+			LifecycleHookName:    aws.String(c.HookName),
+			InstanceId:           aws.String(c.InstanceID),
+			LifecycleActionToken: aws.String(c.ActionToken),
+		}, autoscalingRetryer(newRetryer("RecordLifecycleActionHeartbeat", log, l.options.metrics, l.options.timeouts())))
+		if isActionLost(err) {
+			log.WithError(err).Info("Removing checkpoint, the lifecycle action is no longer active")
+			if err := os.Remove(path); err != nil {
+				log.WithError(err).Warn("Failed to remove checkpoint")
+			}
+			continue
+		} else if err != nil {
+			log.WithError(err).Warn("Failed to send heartbeat for recovered lifecycle action")
+		}
+
+		log.WithField("handlerAttempt", c.HandlerAttempt).Warn("Recovering lifecycle action that was in progress when lifecycled stopped")
+		message := c.Message
+		raw, _ := json.Marshal(&message)
+		notice := &autoscalingTerminationNotice{
+			noticeType:     l.Type(),
+			class:          NoticeTermination,
+			message:        &message,
+			autoscaling:    l.autoscaling,
+			options:        l.options,
+			receivedAt:     time.Now(),
+			raw:            raw,
+			checkpoint:     c,
+			checkpointPath: path,
+		}
+		select {
+		case notices <- notice:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
 type autoscalingTerminationNotice struct {
-	noticeType        string
-	message           *Message
-	autoscaling       AutoscalingClient
-	heartbeatInterval time.Duration
+	// Heartbeat counters are first to be 64-bit aligned for atomic access
+	heartbeatsSent   int64
+	heartbeatsFailed int64
+	actionLost       int32
+	timedOut         int32
+	completedEarly   int32
+
+	// tokenless is set once the action token has been rejected, and the action is identified
+	// by the instance, group and hook alone
+	tokenless int32
+
+	noticeType  string
+	class       string
+	message     *Message
+	autoscaling AutoscalingClient
+	options     AutoscalingOptions
+	receivedAt  time.Time
+	publishedAt time.Time
+	sentAt      time.Time
+	raw         []byte
+
+	// skipHeartbeats is set for notices that are replayed without heartbeats
+	skipHeartbeats bool
+
+	// checkpoint is set for notices that are recovered from the checkpoint at checkpointPath
+	checkpoint     *Checkpoint
+	checkpointPath string
+
+	// dispatchedAt is when handling the notice began
+	mu           sync.Mutex
+	dispatchedAt time.Time
+
+	// handlerDuration is how long the handler ran, which is set once it returns
+	handlerDuration time.Duration
+
+	// completion guards CompleteLifecycleAction, so that it is attempted exactly once
+	completion         sync.Once
+	completed          string
+	completeErr        error
+	completionDuration time.Duration
+	completionRetries  int
+
+	// spanContext is the span of the notice, for the spans of heartbeats and completion
+	spanContext trace.SpanContext
+
+	// timeline of the notice, which heartbeats and completion add events to
+	timeline *timeline
 }
 
 func (n *autoscalingTerminationNotice) Type() string {
 	return n.noticeType
 }
 
-func (n *autoscalingTerminationNotice) Handle(ctx context.Context, handler Handler, log *logrus.Entry) error {
+func (n *autoscalingTerminationNotice) InstanceID() string {
+	return n.message.InstanceID
+}
+
+func (n *autoscalingTerminationNotice) Transition() string {
+	return n.message.Transition
+}
+
+// CorrelationID returns the correlationId of the notification metadata of the lifecycle hook.
+func (n *autoscalingTerminationNotice) CorrelationID() string {
+	return parseCorrelationID(n.message.NotificationMetadata)
+}
+
+func (n *autoscalingTerminationNotice) groupName() string {
+	return n.message.GroupName
+}
+
+func (n *autoscalingTerminationNotice) ReceivedAt() time.Time {
+	return n.receivedAt
+}
+
+func (n *autoscalingTerminationNotice) Raw() []byte {
+	return n.raw
+}
+
+// Terminating returns false for checkpoint notices, which don't mean that the instance is going away.
+func (n *autoscalingTerminationNotice) Terminating() bool {
+	return n.class != NoticeCheckpoint
+}
+
+// ActionLost returns true if heartbeats found that the lifecycle action is no longer
+// active, i.e. it was completed by another actor or timed out.
+func (n *autoscalingTerminationNotice) ActionLost() bool {
+	return atomic.LoadInt32(&n.actionLost) == 1
+}
+
+// Heartbeats returns the number of lifecycle action heartbeats that have been sent and have failed.
+func (n *autoscalingTerminationNotice) Heartbeats() (sent, failed int) {
+	return int(atomic.LoadInt64(&n.heartbeatsSent)), int(atomic.LoadInt64(&n.heartbeatsFailed))
+}
+
+// Result of handling the notice, which is complete once Handle has returned.
+func (n *autoscalingTerminationNotice) Result() Result {
+	sent, failed := n.Heartbeats()
+	n.mu.Lock()
+	handlerDuration := n.handlerDuration
+	n.mu.Unlock()
+	return Result{
+		Notice:             n.noticeType,
+		HandlerDuration:    handlerDuration,
+		HeartbeatsSent:     sent,
+		HeartbeatsFailed:   failed,
+		CompletionResult:   n.completed,
+		CompletionError:    n.completeErr,
+		CompletionDuration: n.completionDuration,
+		CompletionRetries:  n.completionRetries,
+	}
+}
+
+func (n *autoscalingTerminationNotice) Handle(ctx context.Context, handler Handler, log *logrus.Entry) (err error) {
+	log = log.WithFields(logrus.Fields{
+		"autoscalingGroup": n.message.GroupName,
+		"lifecycleHook":    n.message.HookName,
+		"actionToken":      maskToken(n.message.ActionToken),
+	})
+
+	n.mu.Lock()
+	if n.dispatchedAt.IsZero() {
+		n.dispatchedAt = time.Now()
+
+		// Heartbeats and completion outlive the context of the handler, so they use the span context
+		n.spanContext = trace.SpanContextFromContext(ctx)
+		n.timeline = timelineFrom(ctx)
+		n.timeline.add(n.publishedAt, TimelinePublished, "")
+		n.timeline.add(n.sentAt, TimelineQueued, "")
+	}
+	n.mu.Unlock()
+
+	latency := n.Latency()
+	if latency.ClockSkew > 0 {
+		n.options.metrics.clockSkewCorrected("delivery")
+		skewLog := log.WithFields(logrus.Fields{
+			"clockSkew": latency.ClockSkew.String(),
+			"tolerance": n.options.ClockSkewTolerance.String(),
+		})
+		if n.options.clock().skewed(latency.ClockSkew) {
+			skewLog.Warn("Negative latency reported as zero, the clock of the instance is behind AWS by more than the tolerance")
+		} else {
+			skewLog.Debug("Negative latency reported as zero, the clock is skewed")
+		}
+	}
+	log.WithFields(logrus.Fields{
+		"publishToReceive":  latency.PublishToReceive.String(),
+		"sentToReceive":     latency.SentToReceive.String(),
+		"receiveToDispatch": latency.ReceiveToDispatch.String(),
+	}).Info("Handling autoscaling notice")
+
+	if n.options.VerifyTermination && n.Terminating() {
+		if err := n.verifyTerminating(ctx, log); err != nil {
+			log.WithError(err).Error("Failed to verify that the instance is terminating, skipping handler and lifecycle action completion")
+			return err
+		}
+	}
+
+	// The lifecycle action is left if the daemon shuts down with the leave policy, and
+	// then the checkpoint is kept so that the action can be resumed if lifecycled restarts
+	var left bool
+	if n.options.CheckpointDir != "" && n.Terminating() {
+		remove := n.writeCheckpoint(log)
+		defer func() {
+			if !left {
+				remove()
+			}
+		}()
+	}
+
+	handlerCtx, cancelHandler := context.WithCancel(ctx)
+	defer cancelHandler()
+
 	defer func() {
-		_, err := n.autoscaling.CompleteLifecycleAction(&autoscaling.CompleteLifecycleActionInput{
+		result := ResultContinue
+		if r := recover(); r != nil {
+			perr := newPanicError(r)
+			log.WithField("stack", string(perr.Stack)).WithError(perr).Error("Recovered from panic while handling notice")
+			result, err = n.options.PanicResult, perr
+		}
+
+		if atomic.LoadInt32(&n.completedEarly) == 1 {
+			// Waits for the early completion if it is still in progress
+			n.complete(ResultContinue, log)
+
+			log := log.WithField("result", n.completed)
+			if n.completeErr != nil {
+				log = log.WithField("completeError", n.completeErr.Error())
+			}
+			if err != nil {
+				log.WithError(err).Warn("Handler failed after the lifecycle action was completed early")
+			} else {
+				log.Info("Handler exited after the lifecycle action was completed early")
+			}
+			return
+		}
+
+		if atomic.LoadInt32(&n.timedOut) == 1 {
+			err = &HeartbeatTimeoutError{Duration: n.options.MaxHeartbeatDuration, Err: err}
+			log.WithError(err).Error("Reached the maximum heartbeat duration")
+			if n.options.Complete == CompleteNever {
+				log.WithField("complete", n.options.Complete).Info("Skipping lifecycle action completion")
+				return
+			}
+			n.complete(n.options.TimeoutResult, log)
+			return
+		}
+
+		if n.ActionLost() {
+			if err != nil && handlerCtx.Err() != nil && ctx.Err() == nil {
+				err = fmt.Errorf("%w: %s", ErrLifecycleActionLost, err)
+			}
+			log.Warn("Lifecycle action was completed or expired externally, skipping completion")
+			return
+		}
+
+		if ctx.Err() != nil && n.options.Complete != CompleteNever {
+			log := log.WithFields(logrus.Fields{
+				"shutdownPolicy": n.options.ShutdownPolicy,
+				"shutdownReason": shutdownReason(ctx),
+			})
+			switch n.options.ShutdownPolicy {
+			case ShutdownLeave:
+				left = true
+				log.Warn("Shutting down while handling notice, leaving the lifecycle action for the hook timeout")
+			case ShutdownAbandon:
+				log.Warn("Shutting down while handling notice, abandoning the lifecycle action")
+				n.complete(ResultAbandon, log)
+			default:
+				log.Warn("Shutting down while handling notice, continuing the lifecycle action")
+				n.complete(ResultContinue, log)
+			}
+			return
+		}
+
+		if !n.shouldComplete(err) {
+			if err != nil {
+				log.WithField("complete", n.options.Complete).Warn("Skipping lifecycle action completion, the handler failed")
+			} else {
+				log.WithField("complete", n.options.Complete).Info("Skipping lifecycle action completion")
+			}
+			return
+		}
+
+		n.complete(result, log)
+	}()
+
+	// Heartbeats are started separately from the handler, so that the lifecycle action
+	// is kept alive while the notice waits for its turn to execute the handler.
+	stopHeartbeat := func() {}
+	if n.skipHeartbeats {
+		log.Info("Heartbeats are disabled for this notice")
+	} else {
+		interval, jitter := n.heartbeatInterval(ctx, log)
+		stopHeartbeat = n.startHeartbeat(interval, jitter, log, func() {
+			if n.options.CancelOnLostAction {
+				log.Warn("Cancelling handler, the lifecycle action is no longer active")
+				cancelHandler()
+			}
+		}, func() {
+			log.Warn("Cancelling handler, heartbeats have reached the maximum duration")
+			cancelHandler()
+		})
+	}
+	defer stopHeartbeat()
+
+	if n.checkpoint != nil && n.options.RecoverHandler == RecoverSkip {
+		log.WithField("recover", n.options.RecoverHandler).Info("Skipping handler for recovered lifecycle action")
+		return nil
+	}
+
+	handlerStart := time.Now()
+	err = executeHandler(handlerCtx, handler, &Notice{
+		Type:        n.noticeType,
+		Transition:  n.message.Transition,
+		InstanceID:  n.message.InstanceID,
+		Args:        []string{n.message.Transition, n.message.InstanceID},
+		Autoscaling: n.message,
+		Log:         log,
+		Complete: func() {
+			n.completeEarly(stopHeartbeat, log)
+		},
+	})
+	n.mu.Lock()
+	n.handlerDuration = time.Since(handlerStart)
+	n.mu.Unlock()
+	if n.options.CompletionDelay > 0 && n.shouldComplete(err) && !n.ActionLost() && atomic.LoadInt32(&n.completedEarly) == 0 {
+		n.delayCompletion(handlerCtx, log)
+	}
+	return err
+}
+
+// completeEarly completes the lifecycle action with CONTINUE at the handler's request, and
+// stops heartbeats since the action is no longer active, while the handler keeps running.
+func (n *autoscalingTerminationNotice) completeEarly(stopHeartbeat func(), log *logrus.Entry) {
+	if n.options.Complete == CompleteNever {
+		log.WithField("complete", n.options.Complete).Warn("Ignoring handler request to complete the lifecycle action early")
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&n.completedEarly, 0, 1) {
+		return
+	}
+	log.Info("Completing lifecycle action early at the handler's request")
+	stopHeartbeat()
+	n.complete(ResultContinue, log)
+}
+
+// complete the lifecycle action with the result. Only the first call attempts to complete
+// the action, and later calls log the outcome that was already recorded.
+func (n *autoscalingTerminationNotice) complete(result string, log *logrus.Entry) {
+	// The instance is not going away after a checkpoint, so it always continues
+	if !n.Terminating() {
+		result = ResultContinue
+	}
+
+	attempted := false
+	n.completion.Do(func() {
+		attempted = true
+
+		// Once the action is completed the instance may be terminated, so the logs are shipped first
+		flushLogs(log.Logger)
+
+		// The handler context is likely cancelled if the daemon is shutting down, but the
+		// lifecycle action should still be completed so that the termination can proceed.
+		ctx, cancel := context.WithTimeout(context.Background(), n.options.ShutdownTimeout)
+		defer cancel()
+		ctx, span := n.startSpan(ctx, "autoscaling.CompleteLifecycleAction")
+		span.SetAttributes(attribute.String("lifecycled.result", result))
+
+		// The SDK retries throttling and transient errors before returning
+		retryer := newRetryer("CompleteLifecycleAction", log, n.options.metrics, n.options.timeouts())
+		start := time.Now()
+		n.events().add(start, TimelineCompletionStarted, result)
+		_, n.completeErr = n.autoscaling.CompleteLifecycleAction(ctx, &autoscaling.CompleteLifecycleActionInput{
 			AutoScalingGroupName:  aws.String(n.message.GroupName),
 			LifecycleHookName:     aws.String(n.message.HookName),
 			InstanceId:            aws.String(n.message.InstanceID),
-			LifecycleActionToken:  aws.String(n.message.ActionToken),
-			LifecycleActionResult: aws.String("CONTINUE"),
+			LifecycleActionToken:  n.actionToken(),
+			LifecycleActionResult: aws.String(result),
+		}, autoscalingRetryer(retryer))
+		n.completionRetries = retryer.retries
+		n.options.credentials.observe(log, n.completeErr)
+		n.completeErr = wrapError(ErrCompleteLifecycle, n.completeErr)
+		n.completionDuration = time.Since(start)
+		n.completed = result
+		endSpan(span, n.completeErr)
+		detail := result
+		if n.completeErr != nil {
+			detail += ", failed"
+		}
+		n.events().add(start.Add(n.completionDuration), TimelineCompletionFinished, detail)
+	})
+
+	if !attempted {
+		log := log.WithField("result", n.completed)
+		if n.completeErr != nil {
+			log = log.WithError(n.completeErr)
+		}
+		log.Info("Lifecycle action completion was already attempted")
+		return
+	}
+	sent, failed := n.Heartbeats()
+	log = log.WithFields(logrus.Fields{
+		"heartbeatsSent":     sent,
+		"heartbeatsFailed":   failed,
+		"completionDuration": n.completionDuration.String(),
+		"completionRetries":  n.completionRetries,
+	})
+	if n.completeErr != nil {
+		log.WithError(n.completeErr).Error("Failed to complete lifecycle action")
+	} else {
+		log.WithField("result", result).Info("Lifecycle action completed successfully")
+	}
+}
+
+// NoticeLatency describes the delays between an autoscaling notice being published and handled.
+type NoticeLatency struct {
+	// PublishToReceive is the time from the SNS notification to the listener receiving it.
+	PublishToReceive time.Duration
+
+	// SentToReceive is the time from the message being sent to SQS to the listener receiving it.
+	SentToReceive time.Duration
+
+	// ReceiveToDispatch is the time from the listener receiving the notice to handling it.
+	ReceiveToDispatch time.Duration
+
+	// ClockSkew is how far the timestamps of AWS were ahead of the clock of the instance, whose
+	// latencies were corrected to zero (zero if none were).
+	ClockSkew time.Duration
+}
+
+// Latency of the notice. Negative latencies, caused by clock skew between AWS and the
+// instance, are reported as zero (see ClockSkew), as are latencies where the timestamps are
+// unknown. ReceiveToDispatch is zero until the notice is handled.
+func (n *autoscalingTerminationNotice) Latency() NoticeLatency {
+	n.mu.Lock()
+	dispatchedAt := n.dispatchedAt
+	n.mu.Unlock()
+
+	clock := n.options.clock()
+	publishToReceive, publishSkew := clock.since(n.publishedAt, n.receivedAt)
+	sentToReceive, sentSkew := clock.since(n.sentAt, n.receivedAt)
+	latency := NoticeLatency{
+		PublishToReceive: publishToReceive,
+		SentToReceive:    sentToReceive,
+		ClockSkew:        publishSkew,
+	}
+	if sentSkew > latency.ClockSkew {
+		latency.ClockSkew = sentSkew
+	}
+	if !n.receivedAt.IsZero() && !dispatchedAt.IsZero() && dispatchedAt.After(n.receivedAt) {
+		latency.ReceiveToDispatch = dispatchedAt.Sub(n.receivedAt)
+	}
+	return latency
+}
+
+// hookFiredAt returns the time that the lifecycle hook fired, which is the time of the message,
+// or failing that when it was sent to SQS or published to SNS.
+func (n *autoscalingTerminationNotice) hookFiredAt() time.Time {
+	for _, t := range []time.Time{n.message.Time, n.sentAt, n.publishedAt} {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// sentTimestamp returns the time that the message was sent to SQS, if it is known.
+func sentTimestamp(m types.Message) time.Time {
+	ms, err := strconv.ParseInt(m.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// writeCheckpoint for the notice, and return a function that removes it once the notice
+// has been handled. Failing to checkpoint is logged, but doesn't stop the notice being handled.
+func (n *autoscalingTerminationNotice) writeCheckpoint(log *logrus.Entry) (remove func()) {
+	c := &Checkpoint{Message: *n.message, StartedAt: time.Now()}
+	if n.checkpoint != nil {
+		c.StartedAt = n.checkpoint.StartedAt
+		c.HandlerAttempt = n.checkpoint.HandlerAttempt
+	}
+	if n.checkpoint == nil || n.options.RecoverHandler == RecoverRerun {
+		c.HandlerAttempt++
+	}
+
+	path := n.checkpointPath
+	if path == "" {
+		path = checkpointPath(n.options.CheckpointDir, n.message)
+	}
+	log = log.WithField("path", path)
+	if err := writeCheckpoint(path, c); err != nil {
+		log.WithError(err).Warn("Failed to write checkpoint")
+	}
+	return func() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.WithError(err).Warn("Failed to remove checkpoint")
+		}
+	}
+}
+
+// completionOutcome returns the result that completing the lifecycle action was attempted with,
+// and the error if it failed. The result is empty if completion was not attempted.
+func (n *autoscalingTerminationNotice) completionOutcome() (result string, err error) {
+	return n.completed, n.completeErr
+}
+
+// shouldComplete returns true if the completion policy allows completing the
+// lifecycle action after the handler returned err.
+func (n *autoscalingTerminationNotice) shouldComplete(err error) bool {
+	switch n.options.Complete {
+	case CompleteNever:
+		return false
+	case CompleteOnSuccess:
+		return err == nil
+	}
+	return true
+}
+
+// delayCompletion holds the lifecycle action open for the completion delay, while heartbeats
+// are still being sent, or until the context is cancelled.
+func (n *autoscalingTerminationNotice) delayCompletion(ctx context.Context, log *logrus.Entry) {
+	log = log.WithField("delay", n.options.CompletionDelay.String())
+	log.Info("Delaying lifecycle action completion")
+
+	timer := time.NewTimer(n.options.CompletionDelay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		log.Info("Finished delaying lifecycle action completion")
+	case <-ctx.Done():
+		log.WithError(ctx.Err()).Warn("Interrupted delaying lifecycle action completion")
+	}
+}
+
+// verifyTerminating checks that the autoscaling group has the instance in a terminating lifecycle
+// state, retrying briefly since autoscaling is eventually consistent.
+func (n *autoscalingTerminationNotice) verifyTerminating(ctx context.Context, log *logrus.Entry) error {
+	var state string
+	for attempt := 1; attempt <= verifyTerminationAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(verifyTerminationInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		state = ""
+		out, err := n.autoscaling.DescribeAutoScalingInstances(ctx, &autoscaling.DescribeAutoScalingInstancesInput{
+			InstanceIds: []string{n.message.InstanceID},
 		})
 		if err != nil {
-			log.WithError(err).Error("Failed to complete lifecycle action")
-		} else {
-			log.Info("Lifecycle action completed successfully")
+			log.WithError(err).WithField("attempt", attempt).Warn("Failed to describe autoscaling instance")
+			continue
 		}
-	}()
+		for _, i := range out.AutoScalingInstances {
+			if aws.ToString(i.InstanceId) == n.message.InstanceID {
+				state = aws.ToString(i.LifecycleState)
+			}
+		}
+		switch autoscalingtypes.LifecycleState(state) {
+		case autoscalingtypes.LifecycleStateTerminating, autoscalingtypes.LifecycleStateTerminatingWait:
+			log.WithField("state", state).Debug("Verified that the instance is terminating")
+			return nil
+		}
+		log.WithFields(logrus.Fields{"attempt": attempt, "state": state}).Debug("Instance is not terminating yet")
+	}
+	if state == "" {
+		return fmt.Errorf("%w: lifecycle state is unknown", ErrNotTerminating)
+	}
+	return fmt.Errorf("%w: lifecycle state is %s", ErrNotTerminating, state)
+}
+
+// heartbeatInterval returns the configured heartbeat interval and jitter. If the interval is not
+// configured, it is half of the heartbeat timeout of the lifecycle hook, and the jitter is
+// reduced if it would be more than half of the interval.
+func (n *autoscalingTerminationNotice) heartbeatInterval(ctx context.Context, log *logrus.Entry) (interval, jitter time.Duration) {
+	if n.options.HeartbeatInterval > 0 {
+		return n.options.HeartbeatInterval, n.options.HeartbeatJitter
+	}
 
-	ticker := time.NewTicker(n.heartbeatInterval)
-	defer ticker.Stop()
+	interval, jitter = defaultHeartbeatInterval, n.options.HeartbeatJitter
+	out, err := n.autoscaling.DescribeLifecycleHooks(ctx, &autoscaling.DescribeLifecycleHooksInput{
+		AutoScalingGroupName: aws.String(n.message.GroupName),
+		LifecycleHookNames:   []string{n.message.HookName},
+	})
+	switch {
+	case err != nil:
+		log.WithError(err).WithField("interval", interval.String()).Warn("Failed to describe lifecycle hook, using the default heartbeat interval")
+	case len(out.LifecycleHooks) == 0 || out.LifecycleHooks[0].HeartbeatTimeout == nil:
+		log.WithField("interval", interval.String()).Warn("Lifecycle hook has no heartbeat timeout, using the default heartbeat interval")
+	default:
+		timeout := time.Duration(aws.ToInt32(out.LifecycleHooks[0].HeartbeatTimeout)) * time.Second
+		interval = timeout / 2
+		if interval < minHeartbeatInterval {
+			interval = minHeartbeatInterval
+		} else if interval > maxHeartbeatInterval {
+			interval = maxHeartbeatInterval
+		}
+		log.WithFields(logrus.Fields{
+			"heartbeatTimeout": timeout.String(),
+			"interval":         interval.String(),
+		}).Info("Derived heartbeat interval from the lifecycle hook")
+	}
+
+	if jitter > interval/2 {
+		jitter = interval / 2
+	}
+	return interval, jitter
+}
+
+// startHeartbeat sends lifecycle action heartbeats until the returned function is called.
+// Heartbeats are scheduled at absolute intervals from the start, so that slow API calls
+// don't delay the following heartbeats, and jitter only ever makes them earlier. A heartbeat
+// that waited for the autoscaling rate limit has the next one started that much earlier (up to
+// half the interval), and a warning if the wait made it late. If the lifecycle action is no
+// longer active, heartbeats stop and lost is called, and expired is called if heartbeats have
+// been sent for the maximum heartbeat duration.
+func (n *autoscalingTerminationNotice) startHeartbeat(interval, jitter time.Duration, log *logrus.Entry, lost, expired func()) (stop func()) {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	done, exited := make(chan struct{}), make(chan struct{})
+	// The hook and the heartbeats are cancelled when heartbeats are stopped, rather than with the
+	// handler, so that the lifecycle action is kept alive while shutting down
+	hookCtx, cancelHook := context.WithCancel(context.Background())
 
 	go func() {
-		for range ticker.C {
+		defer close(exited)
+		defer cancelHook()
+		samples := newLogSampler()
+		defer samples.flush()
+		start := time.Now()
+		deadline := start.Add(n.options.MaxHeartbeatDuration)
+		next := start.Add(interval)
+
+		// limited is how long the last heartbeat waited for the rate limit
+		var limited time.Duration
+		for {
+			wait := time.Until(next) - limited
+			if jitter > 0 {
+				wait -= time.Duration(rnd.Int63n(int64(jitter)))
+			}
+			if next.After(deadline) {
+				wait = time.Until(deadline)
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if !time.Now().Before(deadline) {
+				atomic.StoreInt32(&n.timedOut, 1)
+				log.WithField("duration", n.options.MaxHeartbeatDuration.String()).Warn("Stopping heartbeats, reached the maximum heartbeat duration")
+				expired()
+				return
+			}
+
+			if hook := n.options.BeforeHeartbeat; hook != nil {
+				sent, failed := n.Heartbeats()
+				err := hook(hookCtx, &Heartbeat{Message: n.message, Number: sent + failed + 1, Elapsed: time.Since(start)})
+				if errors.Is(err, ErrStopHeartbeats) {
+					log.Info("Stopping heartbeats at the request of the heartbeat hook")
+					return
+				} else if err != nil {
+					log.WithError(err).Warn("Stopping heartbeats, the heartbeat hook failed")
+					return
+				}
+			}
+
 			log.Debug("Sending heartbeat")
-			_, err := n.autoscaling.RecordLifecycleActionHeartbeat(
-				&autoscaling.RecordLifecycleActionHeartbeatInput{
-					AutoScalingGroupName: aws.String(n.message.GroupName),
-					LifecycleHookName:    aws.String(n.message.HookName),
-					InstanceId:           aws.String(n.message.InstanceID),
-					LifecycleActionToken: aws.String(n.message.ActionToken),
-				},
-			)
-			if err != nil {
-				log.WithError(err).Warn("Failed to send heartbeat")
+			var waited time.Duration
+			fired := time.Now()
+			ctx, span := n.startSpan(withRateLimitWait(hookCtx, &waited), "lifecycled.heartbeat")
+			err := n.recordHeartbeat(ctx, log)
+			if isTokenRejected(err) && atomic.CompareAndSwapInt32(&n.tokenless, 0, 1) {
+				log.WithError(err).Warn("Lifecycle action token was rejected, retrying the heartbeat without it")
+				if retryErr := n.recordHeartbeat(ctx, log); retryErr != nil {
+					atomic.StoreInt32(&n.tokenless, 0)
+					log.WithError(retryErr).Warn("Failed to send heartbeat without the lifecycle action token")
+				} else {
+					log.Warn("Switched to identifying the lifecycle action without its token for heartbeats and completion")
+					err = nil
+				}
+			}
+			endSpan(span, err)
+			if isCanceled(err) && hookCtx.Err() != nil {
+				// Heartbeats were stopped while the call was in progress
+				return
+			}
+			limited = n.rateLimited(waited, fired.Add(waited).Sub(next), interval, log)
+			n.recordHeartbeatEvent(err)
+			n.options.credentials.observe(log, err)
+			if isActionLost(err) {
+				atomic.AddInt64(&n.heartbeatsFailed, 1)
+				n.options.metrics.heartbeatFailed()
+				atomic.StoreInt32(&n.actionLost, 1)
+				log.WithError(err).Warn("Lifecycle action is no longer active, stopping heartbeats")
+				lost()
+				return
+			} else if err != nil {
+				atomic.AddInt64(&n.heartbeatsFailed, 1)
+				n.options.metrics.heartbeatFailed()
+				samples.warn(log, err, "Failed to send heartbeat")
+			} else {
+				samples.recovered(log, "Recovered from failing to send heartbeats")
+				atomic.AddInt64(&n.heartbeatsSent, 1)
+				n.options.metrics.heartbeatSent()
+			}
+
+			// Skip any heartbeats that were missed while the call was in progress
+			next = next.Add(interval)
+			for !next.After(time.Now()) {
+				next = next.Add(interval)
 			}
 		}
 	}()
 
-	return handler.Execute(ctx, n.message.Transition, n.message.InstanceID)
+	// Cancel a heartbeat in progress and wait for it to return, so that the counters are final when
+	// the action is completed
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			cancelHook()
+		})
+		<-exited
+	}
+}
+
+// rateLimited logs the wait of a heartbeat for the autoscaling rate limit, as a warning if the
+// heartbeat was sent late by it, and returns how much earlier the next heartbeat is started.
+func (n *autoscalingTerminationNotice) rateLimited(waited, late, interval time.Duration, log *logrus.Entry) time.Duration {
+	if waited <= 0 {
+		return 0
+	}
+	log = log.WithFields(logrus.Fields{
+		"wait":     waited.Round(time.Millisecond).String(),
+		"interval": interval.String(),
+	})
+	if late > 0 {
+		log.WithField("late", late.Round(time.Millisecond).String()).Warn("Heartbeat was sent late, it waited for the autoscaling rate limit")
+	} else {
+		log.Debug("Heartbeat waited for the autoscaling rate limit")
+	}
+	if waited > interval/2 {
+		return interval / 2
+	}
+	return waited
+}
+
+// events returns the timeline of the notice, which is nil until it is handled.
+func (n *autoscalingTerminationNotice) events() *timeline {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.timeline
+}
+
+// recordHeartbeatEvent adds the outcome of a heartbeat to the timeline of the notice.
+func (n *autoscalingTerminationNotice) recordHeartbeatEvent(err error) {
+	sent, failed := n.Heartbeats()
+	event := TimelineHeartbeat
+	if err != nil {
+		event = TimelineHeartbeatFailed
+	}
+	n.events().heartbeat(time.Now(), event, fmt.Sprintf("#%d", sent+failed+1))
+}
+
+// startSpan starts a child span of the notice.
+func (n *autoscalingTerminationNotice) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	n.mu.Lock()
+	parent := n.spanContext
+	n.mu.Unlock()
+	return n.options.TracerProvider.Tracer(tracerName).Start(trace.ContextWithSpanContext(ctx, parent), name)
+}
+
+// recordHeartbeat sends a lifecycle action heartbeat, logging its retries to the log.
+func (n *autoscalingTerminationNotice) recordHeartbeat(ctx context.Context, log *logrus.Entry) error {
+	_, err := n.autoscaling.RecordLifecycleActionHeartbeat(ctx,
+		&autoscaling.RecordLifecycleActionHeartbeatInput{
+			AutoScalingGroupName: aws.String(n.message.GroupName),
+			LifecycleHookName:    aws.String(n.message.HookName),
+			InstanceId:           aws.String(n.message.InstanceID),
+			LifecycleActionToken: n.actionToken(),
+		},
+		autoscalingRetryer(newRetryer("RecordLifecycleActionHeartbeat", log, n.options.metrics, n.options.timeouts())),
+	)
+	return err
+}
+
+// actionToken identifies the lifecycle action in heartbeats and completion, which is nil once
+// the token has been rejected and heartbeats succeeded without it.
+func (n *autoscalingTerminationNotice) actionToken() *string {
+	if atomic.LoadInt32(&n.tokenless) == 1 {
+		return nil
+	}
+	return aws.String(n.message.ActionToken)
+}
+
+// isTokenRejected returns true if the error is a validation error for the lifecycle action token,
+// which can happen if the token is re-issued while the lifecycle action is still active.
+func isTokenRejected(err error) bool {
+	if e, ok := apiError(err); ok && e.ErrorCode() == "ValidationError" {
+		return strings.Contains(strings.ToLower(e.ErrorMessage()), "token")
+	}
+	return false
+}
+
+// isActionLost returns true if the error means that there is no active lifecycle action,
+// because it was completed by another actor or it timed out.
+func isActionLost(err error) bool {
+	if e, ok := apiError(err); ok && e.ErrorCode() == "ValidationError" {
+		return strings.Contains(strings.ToLower(e.ErrorMessage()), "no active lifecycle action")
+	}
+	return false
 }
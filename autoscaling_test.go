@@ -0,0 +1,1877 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	autoscalingtypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// expectQueue sets up the SQS and SNS calls made by an autoscaling listener which receives a
+// single termination notice for the instance.
+func expectQueue(sq *mocks.MockSQSClient, sn *mocks.MockSNSClient, instanceID string) {
+	expectQueueMessage(sq, sn, newSQSMessage(instanceID))
+}
+
+// expectQueueMessage is like expectQueue, but receives the given message.
+func expectQueueMessage(sq *mocks.MockSQSClient, sn *mocks.MockSNSClient, message sqstypes.Message) {
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(&sqs.ReceiveMessageOutput{
+		Messages: []sqstypes.Message{message},
+	}, nil)
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+	sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+	sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+}
+
+// startAutoscalingDaemon starts a daemon with only the autoscaling listener and returns the first notice.
+func startAutoscalingDaemon(t *testing.T, ctrl *gomock.Controller, as *mocks.MockAutoscalingClient, config *lifecycled.Config) (*lifecycled.Daemon, lifecycled.TerminationNotice) {
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueue(sq, sn, config.InstanceID)
+
+	if config.SNSTopic == "" {
+		config.SNSTopic = "topic"
+	}
+	if config.AutoscalingHeartbeatInterval == 0 {
+		config.AutoscalingHeartbeatInterval = time.Minute
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(config, sq, sn, as, nil, logger)
+	notice, err := daemon.Start(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting daemon: %s", err)
+	}
+	if notice == nil {
+		t.Fatal("expected a notice to be returned")
+	}
+	return daemon, notice
+}
+
+type panicHandler struct{}
+
+func (panicHandler) Execute(context.Context, ...string) error {
+	panic("boom")
+}
+
+func TestAutoscalingNoticePanic(t *testing.T) {
+	tests := []struct {
+		description    string
+		panicResult    string
+		expectedResult string
+	}{
+		{
+			description:    "continues by default",
+			expectedResult: "CONTINUE",
+		},
+		{
+			description:    "abandons when configured",
+			panicResult:    "ABANDON",
+			expectedResult: "ABANDON",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var result string
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+				func(_ context.Context, input *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+					result = aws.ToString(input.LifecycleActionResult)
+					return &autoscaling.CompleteLifecycleActionOutput{}, nil
+				},
+			)
+
+			daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+				InstanceID:  "i-000000000000",
+				PanicResult: tc.panicResult,
+			})
+
+			err := daemon.Handle(context.TODO(), notice, panicHandler{})
+
+			var perr *lifecycled.PanicError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected a panic error and got: %v", err)
+			}
+			if got, want := result, tc.expectedResult; got != want {
+				t.Errorf("expected lifecycle action result '%s' and got '%s'", want, got)
+			}
+		})
+	}
+}
+
+func TestAutoscalingNoticeVerifyTermination(t *testing.T) {
+	tests := []struct {
+		description     string
+		state           string
+		expectExecution bool
+	}{
+		{
+			description:     "executes handler when terminating",
+			state:           "Terminating:Wait",
+			expectExecution: true,
+		},
+		{
+			description: "skips handler and completion when in service",
+			state:       "InService",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			instanceID := "i-000000000000"
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			as.EXPECT().DescribeAutoScalingInstances(gomock.Any(), gomock.Any()).MinTimes(1).Return(&autoscaling.DescribeAutoScalingInstancesOutput{
+				AutoScalingInstances: []autoscalingtypes.AutoScalingInstanceDetails{
+					{InstanceId: aws.String(instanceID), LifecycleState: aws.String(tc.state)},
+				},
+			}, nil)
+			if tc.expectExecution {
+				as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+			}
+
+			daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+				InstanceID:        instanceID,
+				VerifyTermination: true,
+			})
+
+			handler := &countingHandler{}
+			err := daemon.Handle(context.TODO(), notice, handler)
+
+			if tc.expectExecution {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				if handler.count != 1 {
+					t.Error("expected handler to be executed")
+				}
+			} else {
+				if !errors.Is(err, lifecycled.ErrNotTerminating) {
+					t.Errorf("expected ErrNotTerminating and got: %v", err)
+				}
+				if handler.count != 0 {
+					t.Error("expected handler not to be executed")
+				}
+			}
+		})
+	}
+}
+
+func TestAutoscalingListenerReattachesAfterRestart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	// The queue must only be created once, and the subscription retried
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(&sqs.ReceiveMessageOutput{
+		Messages: []sqstypes.Message{newSQSMessage(instanceID)},
+	}, nil)
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+	sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	gomock.InOrder(
+		sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, errors.New("not yet")),
+		sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+			SubscriptionArn: aws.String("arn"),
+		}, nil),
+	)
+	sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	logger, _ := logrus.NewNullLogger()
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:             instanceID,
+		SNSTopic:               "topic",
+		ListenerRestarts:       1,
+		ListenerRestartBackoff: time.Millisecond,
+	}, sq, sn, as, nil, logger)
+
+	notice, err := daemon.Start(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if notice == nil {
+		t.Error("expected a notice to be returned")
+	}
+}
+
+func TestAutoscalingNoCleanup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	// Creating the queue and subscribing it again returns the ones that were retained, and
+	// neither is deleted (which would be an unexpected call)
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(2).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(2).Return(&sqs.ReceiveMessageOutput{
+		Messages: []sqstypes.Message{newSQSMessage(instanceID)},
+	}, nil)
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(2).Return(nil, nil)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+
+	for i := 0; i < 2; i++ {
+		logger, hook := logrus.NewNullLogger()
+		ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+		daemon := lifecycled.NewDaemon(&lifecycled.Config{
+			InstanceID: instanceID,
+			SNSTopic:   "topic",
+			NoCleanup:  true,
+		}, sq, sn, as, nil, logger)
+
+		notice, err := daemon.Start(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if notice == nil {
+			t.Fatal("expected a notice to be returned")
+		}
+
+		var retained bool
+		for _, e := range hook.AllEntries() {
+			if e.Message == "Retaining sqs queue and sns subscription, cleanup is disabled" {
+				retained = true
+			}
+		}
+		if !retained {
+			t.Errorf("expected a warning that the queue was retained")
+		}
+	}
+}
+
+// blockingHandler blocks until its context is cancelled.
+type blockingHandler struct {
+	started chan struct{}
+}
+
+func (h *blockingHandler) Execute(ctx context.Context, _ ...string) error {
+	close(h.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestAutoscalingCompletesAfterRunCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.ReceiveMessageOutput{
+		Messages: []sqstypes.Message{newSQSMessage(instanceID)},
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+		func(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+				return &sqs.ReceiveMessageOutput{}, nil
+			}
+		},
+	)
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+
+	// The lifecycle action must be completed with a live context, before the queue is deleted
+	gomock.InOrder(
+		as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+			func(ctx context.Context, _ *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+				if err := ctx.Err(); err != nil {
+					t.Errorf("expected completion context to be live and got: %s", err)
+				}
+				return &autoscaling.CompleteLifecycleActionOutput{}, nil
+			},
+		),
+		sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil),
+		sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil),
+	)
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: time.Minute,
+	}, sq, sn, as, nil, logger)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	handler := &blockingHandler{started: make(chan struct{})}
+	go func() {
+		<-handler.started
+		cancel()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- daemon.Run(ctx, handler)
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the handler to be cancelled and got: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the daemon to stop")
+	}
+}
+
+func TestAutoscalingNoticeHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID: "i-000000000000",
+	})
+
+	var handled *lifecycled.Notice
+	err := daemon.Handle(context.TODO(), notice, lifecycled.NoticeHandlerFunc(func(_ context.Context, n *lifecycled.Notice) error {
+		handled = n
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if handled == nil {
+		t.Fatal("expected the notice handler to be called")
+	}
+	if got, want := handled.Transition, "autoscaling:EC2_INSTANCE_TERMINATING"; got != want {
+		t.Errorf("expected transition '%s' and got '%s'", want, got)
+	}
+	if got, want := handled.InstanceID, "i-000000000000"; got != want {
+		t.Errorf("expected instance id '%s' and got '%s'", want, got)
+	}
+	if handled.Autoscaling == nil || handled.Autoscaling.HookName != "hook" {
+		t.Errorf("expected the lifecycle hook message and got: %+v", handled.Autoscaling)
+	}
+}
+
+func TestAutoscalingNoticeDetails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	before := time.Now()
+	_, notice := startAutoscalingDaemon(t, ctrl, mocks.NewMockAutoscalingClient(ctrl), &lifecycled.Config{
+		InstanceID: instanceID,
+	})
+
+	n, ok := notice.(lifecycled.DetailedNotice)
+	if !ok {
+		t.Fatalf("expected a detailed notice and got %T", notice)
+	}
+	if got, want := n.InstanceID(), instanceID; got != want {
+		t.Errorf("expected instance id '%s' and got '%s'", want, got)
+	}
+	if got, want := n.Transition(), "autoscaling:EC2_INSTANCE_TERMINATING"; got != want {
+		t.Errorf("expected transition '%s' and got '%s'", want, got)
+	}
+	if n.ReceivedAt().Before(before) {
+		t.Errorf("expected notice to be received after %s and got %s", before, n.ReceivedAt())
+	}
+
+	var env lifecycled.Envelope
+	if err := json.Unmarshal(n.Raw(), &env); err != nil {
+		t.Fatalf("expected the raw message to be the sqs message body: %s", err)
+	}
+	var msg lifecycled.Message
+	if err := json.Unmarshal([]byte(env.Message), &msg); err != nil {
+		t.Fatalf("failed to parse the lifecycle hook message: %s", err)
+	}
+	if got, want := msg.ActionToken, "token"; got != want {
+		t.Errorf("expected action token '%s' and got '%s'", want, got)
+	}
+}
+
+// sleepyHandler sleeps long enough for heartbeats to be sent, and returns err.
+type sleepyHandler struct {
+	err error
+}
+
+func (h sleepyHandler) Execute(context.Context, ...string) error {
+	time.Sleep(50 * time.Millisecond)
+	return h.err
+}
+
+func TestAutoscalingNoticeCompletePolicy(t *testing.T) {
+	tests := []struct {
+		description    string
+		complete       string
+		handlerErr     error
+		expectComplete bool
+	}{
+		{
+			description:    "always completes by default",
+			handlerErr:     errors.New("failed"),
+			expectComplete: true,
+		},
+		{
+			description: "never completes",
+			complete:    lifecycled.CompleteNever,
+		},
+		{
+			description:    "completes on success",
+			complete:       lifecycled.CompleteOnSuccess,
+			expectComplete: true,
+		},
+		{
+			description: "skips completion on failure",
+			complete:    lifecycled.CompleteOnSuccess,
+			handlerErr:  errors.New("failed"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+			if tc.expectComplete {
+				as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+			}
+
+			daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+				InstanceID:                   "i-000000000000",
+				AutoscalingHeartbeatInterval: 5 * time.Millisecond,
+				Complete:                     tc.complete,
+			})
+
+			err := daemon.Handle(context.TODO(), notice, sleepyHandler{err: tc.handlerErr})
+			if !errors.Is(err, tc.handlerErr) {
+				t.Errorf("expected error %v and got: %v", tc.handlerErr, err)
+			}
+		})
+	}
+}
+
+func TestAutoscalingNoticeCompletionDelay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	delay := 50 * time.Millisecond
+
+	var completedAt time.Time
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(context.Context, *autoscaling.CompleteLifecycleActionInput, ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+			completedAt = time.Now()
+			return &autoscaling.CompleteLifecycleActionOutput{}, nil
+		},
+	)
+
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		AutoscalingHeartbeatInterval: 5 * time.Millisecond,
+		CompletionDelay:              delay,
+	})
+
+	handler := &countingHandler{}
+	start := time.Now()
+	if err := daemon.Handle(context.TODO(), notice, handler); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := completedAt.Sub(start); got < delay {
+		t.Errorf("expected completion to be delayed by at least %s and got %s", delay, got)
+	}
+}
+
+func TestAutoscalingNoticeHeartbeats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	gomock.InOrder(
+		as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, errors.New("throttled")),
+		as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil),
+	)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		AutoscalingHeartbeatInterval: 10 * time.Millisecond,
+		AutoscalingHeartbeatJitter:   2 * time.Millisecond,
+	})
+
+	if err := daemon.Handle(context.TODO(), notice, sleepyHandler{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	n, ok := notice.(interface{ Heartbeats() (int, int) })
+	if !ok {
+		t.Fatalf("expected notice to count heartbeats")
+	}
+	sent, failed := n.Heartbeats()
+	if sent < 1 {
+		t.Errorf("expected at least one heartbeat to be sent and got %d", sent)
+	}
+	if failed != 1 {
+		t.Errorf("expected one failed heartbeat and got %d", failed)
+	}
+}
+
+func TestAutoscalingNoticeActionLost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Heartbeats stop after the first, and the lifecycle action is not completed
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, &smithy.GenericAPIError{Code: "ValidationError", Message: "No active Lifecycle Action found with instance ID i-000000000000"})
+
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		AutoscalingHeartbeatInterval: 5 * time.Millisecond,
+		CancelOnLostAction:           true,
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	handler := &blockingHandler{started: make(chan struct{})}
+	err := daemon.Handle(ctx, notice, handler)
+	if !errors.Is(err, lifecycled.ErrLifecycleActionLost) {
+		t.Errorf("expected ErrLifecycleActionLost and got: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("expected the handler to be cancelled before the test timed out")
+	}
+}
+
+func TestAutoscalingNoticeTokenRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The token is rejected once, and then the action is identified without it
+	var mu sync.Mutex
+	var tokens []*string
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(2).DoAndReturn(
+		func(_ context.Context, input *autoscaling.RecordLifecycleActionHeartbeatInput, _ ...func(*autoscaling.Options)) (*autoscaling.RecordLifecycleActionHeartbeatOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			tokens = append(tokens, input.LifecycleActionToken)
+			if input.LifecycleActionToken != nil {
+				return nil, &smithy.GenericAPIError{Code: "ValidationError", Message: "No active Lifecycle Action found with token token"}
+			}
+			return &autoscaling.RecordLifecycleActionHeartbeatOutput{}, nil
+		},
+	)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, input *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+			if input.LifecycleActionToken != nil {
+				t.Errorf("expected the lifecycle action to be completed without the token")
+			}
+			return &autoscaling.CompleteLifecycleActionOutput{}, nil
+		},
+	)
+
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		AutoscalingHeartbeatInterval: 10 * time.Millisecond,
+	})
+
+	if err := daemon.Handle(context.TODO(), notice, sleepyHandler{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if aws.ToString(tokens[0]) != "token" {
+		t.Error("expected the first heartbeat to use the token")
+	}
+	for i, token := range tokens[1:] {
+		if token != nil {
+			t.Errorf("expected heartbeat %d to be sent without the token", i+2)
+		}
+	}
+	if sent, failed := notice.(interface{ Heartbeats() (int, int) }).Heartbeats(); failed != 0 || sent < 1 {
+		t.Errorf("expected the retried heartbeats to succeed and got %d sent and %d failed", sent, failed)
+	}
+}
+
+func TestAutoscalingNoticeCompletesOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:         "i-000000000000",
+		HandlerConcurrency: 2,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := daemon.Handle(context.TODO(), notice, &countingHandler{}); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAutoscalingNoticeLatency(t *testing.T) {
+	tests := []struct {
+		description      string
+		published        time.Duration
+		sent             time.Duration
+		expectPublishMin time.Duration
+		expectSentMin    time.Duration
+		expectSkew       time.Duration
+	}{
+		{
+			description:      "measures delivery latency",
+			published:        -2 * time.Second,
+			sent:             -time.Second,
+			expectPublishMin: 2 * time.Second,
+			expectSentMin:    time.Second,
+		},
+		{
+			description: "floors negative latency from clock skew",
+			published:   time.Hour,
+			sent:        time.Hour,
+			expectSkew:  time.Hour,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			instanceID := "i-000000000000"
+			now := time.Now()
+
+			var env lifecycled.Envelope
+			message := newSQSMessage(instanceID)
+			if err := json.Unmarshal([]byte(aws.ToString(message.Body)), &env); err != nil {
+				t.Fatal(err)
+			}
+			env.Time = now.Add(tc.published)
+			body, err := json.Marshal(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message.Body = aws.String(string(body))
+			message.Attributes = map[string]string{
+				"SentTimestamp": strconv.FormatInt(now.Add(tc.sent).UnixNano()/int64(time.Millisecond), 10),
+			}
+
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			expectQueueMessage(sq, sn, message)
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+			logger, _ := logrus.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				InstanceID:                   instanceID,
+				SNSTopic:                     "topic",
+				AutoscalingHeartbeatInterval: time.Minute,
+			}, sq, sn, as, nil, logger)
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+			defer cancel()
+
+			notice, err := daemon.Start(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := daemon.Handle(ctx, notice, &countingHandler{}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			n, ok := notice.(interface {
+				Latency() lifecycled.NoticeLatency
+			})
+			if !ok {
+				t.Fatal("expected notice to report latency")
+			}
+			latency := n.Latency()
+			if latency.PublishToReceive < tc.expectPublishMin || latency.PublishToReceive > tc.expectPublishMin+time.Second {
+				t.Errorf("expected publish to receive latency of about %s and got %s", tc.expectPublishMin, latency.PublishToReceive)
+			}
+			if latency.SentToReceive < tc.expectSentMin || latency.SentToReceive > tc.expectSentMin+time.Second {
+				t.Errorf("expected sent to receive latency of about %s and got %s", tc.expectSentMin, latency.SentToReceive)
+			}
+			if latency.ReceiveToDispatch <= 0 {
+				t.Errorf("expected a receive to dispatch latency and got %s", latency.ReceiveToDispatch)
+			}
+			if latency.ClockSkew < tc.expectSkew-time.Second || latency.ClockSkew > tc.expectSkew {
+				t.Errorf("expected a clock skew of about %s and got %s", tc.expectSkew, latency.ClockSkew)
+			}
+		})
+	}
+}
+
+func TestAutoscalingNoticeMaxHeartbeatDuration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var result string
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, input *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+			result = aws.ToString(input.LifecycleActionResult)
+			return &autoscaling.CompleteLifecycleActionOutput{}, nil
+		},
+	)
+
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		AutoscalingHeartbeatInterval: 10 * time.Millisecond,
+		MaxHeartbeatDuration:         50 * time.Millisecond,
+		TimeoutResult:                lifecycled.ResultAbandon,
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	err := daemon.Handle(ctx, notice, &blockingHandler{started: make(chan struct{})})
+
+	var terr *lifecycled.HeartbeatTimeoutError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected a heartbeat timeout error and got: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("expected the handler to be cancelled before the test timed out")
+	}
+	if got, want := result, lifecycled.ResultAbandon; got != want {
+		t.Errorf("expected lifecycle action result '%s' and got '%s'", want, got)
+	}
+}
+
+func TestAutoscalingNoticeLogContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	token := "c2f6a4d3-0000-4000-8000-1234567890ab"
+
+	var env lifecycled.Envelope
+	message := newSQSMessage(instanceID)
+	if err := json.Unmarshal([]byte(aws.ToString(message.Body)), &env); err != nil {
+		t.Fatal(err)
+	}
+	env.Message = strings.Replace(env.Message, `"token"`, `"`+token+`"`, 1)
+	body, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message.Body = aws.String(string(body))
+
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessage(sq, sn, message)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	auditFile := filepath.Join(dir, "audit.log")
+
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: time.Minute,
+		AuditFile:                    auditFile,
+	}, sq, sn, as, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	notice, err := daemon.Start(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	hook.Reset()
+
+	serialized, err := json.Marshal(notice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]string{"json": string(serialized), "string": fmt.Sprint(notice)} {
+		if strings.Contains(s, token) {
+			t.Errorf("expected the action token to be masked in the %s of the notice: %s", name, s)
+		}
+		if !strings.Contains(s, "...7890ab") {
+			t.Errorf("expected the masked action token in the %s of the notice: %s", name, s)
+		}
+	}
+
+	var handled *lifecycled.Notice
+	err = daemon.Handle(ctx, notice, lifecycled.NoticeHandlerFunc(func(_ context.Context, n *lifecycled.Notice) error {
+		handled = n
+		n.Log.Info("Draining")
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) == 0 {
+		t.Fatal("expected log entries")
+	}
+	runID := entries[0].Data["runId"]
+	if runID == nil || runID == "" {
+		t.Fatal("expected a run id")
+	}
+	for _, e := range entries {
+		if e.Data["runId"] != runID {
+			t.Errorf("expected run id %v on '%s' and got %v", runID, e.Message, e.Data["runId"])
+		}
+		for k, v := range e.Data {
+			if s, ok := v.(string); ok && strings.Contains(s, token) {
+				t.Errorf("expected the action token to be masked in field '%s' of '%s'", k, e.Message)
+			}
+		}
+	}
+	if got, want := handled.Log.Data["actionToken"], "...7890ab"; got != want {
+		t.Errorf("expected masked action token '%s' and got '%v'", want, got)
+	}
+	if got, want := handled.Log.Data["autoscalingGroup"], "group"; got != want {
+		t.Errorf("expected autoscaling group '%s' and got '%v'", want, got)
+	}
+
+	audit, err := ioutil.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(audit), token) {
+		t.Error("expected the action token to be masked in the audit log")
+	}
+}
+
+func TestAutoscalingNoticeCheckpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:    "i-000000000000",
+		CheckpointDir: dir,
+	})
+
+	// The checkpoint exists while the handler executes, and is removed once the action is completed
+	var (
+		checkpoints []string
+		checkpoint  lifecycled.Checkpoint
+	)
+	err = daemon.Handle(context.TODO(), notice, lifecycled.HandlerFunc(func(context.Context, ...string) error {
+		checkpoints, _ = filepath.Glob(filepath.Join(dir, "lifecycled-*.json"))
+		if len(checkpoints) == 1 {
+			data, err := ioutil.ReadFile(checkpoints[0])
+			if err != nil {
+				return err
+			}
+			return json.Unmarshal(data, &checkpoint)
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error handling notice: %s", err)
+	}
+	if len(checkpoints) != 1 {
+		t.Fatalf("expected a checkpoint while handling the notice and got %d", len(checkpoints))
+	}
+	if got, want := checkpoint.ActionToken, "token"; got != want {
+		t.Errorf("expected action token '%s' and got '%s'", want, got)
+	}
+	if got, want := checkpoint.HandlerAttempt, 1; got != want {
+		t.Errorf("expected handler attempt %d and got %d", want, got)
+	}
+	if _, err := os.Stat(checkpoints[0]); !os.IsNotExist(err) {
+		t.Error("expected the checkpoint to be removed after handling the notice")
+	}
+}
+
+// writeTestCheckpoint writes a checkpoint for a lifecycle action that was in progress.
+func writeTestCheckpoint(t *testing.T, dir, instanceID string) string {
+	data, err := json.Marshal(&lifecycled.Checkpoint{
+		Message: lifecycled.Message{
+			GroupName:   "group",
+			InstanceID:  instanceID,
+			ActionToken: "recovered-token",
+			Transition:  "autoscaling:EC2_INSTANCE_TERMINATING",
+			HookName:    "hook",
+		},
+		StartedAt:      time.Now().Add(-time.Minute),
+		HandlerAttempt: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "lifecycled-recovered.json")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAutoscalingListenerRecoversCheckpoint(t *testing.T) {
+	tests := []struct {
+		description     string
+		recoverHandler  string
+		expectExecution bool
+	}{
+		{
+			description:     "reruns the handler by default",
+			expectExecution: true,
+		},
+		{
+			description:    "skips the handler when configured",
+			recoverHandler: "skip",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dir, err := ioutil.TempDir("", "lifecycled")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			instanceID := "i-000000000000"
+			path := writeTestCheckpoint(t, dir, instanceID)
+
+			var token string
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+			as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+				func(_ context.Context, input *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+					token = aws.ToString(input.LifecycleActionToken)
+					return &autoscaling.CompleteLifecycleActionOutput{}, nil
+				},
+			)
+
+			daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+				InstanceID:     instanceID,
+				CheckpointDir:  dir,
+				RecoverHandler: tc.recoverHandler,
+			})
+
+			var executed bool
+			err = daemon.Handle(context.TODO(), notice, lifecycled.HandlerFunc(func(context.Context, ...string) error {
+				executed = true
+				return nil
+			}))
+			if err != nil {
+				t.Fatalf("unexpected error handling notice: %s", err)
+			}
+			if got, want := token, "recovered-token"; got != want {
+				t.Errorf("expected the recovered action '%s' to be completed and got '%s'", want, got)
+			}
+			if got, want := executed, tc.expectExecution; got != want {
+				t.Errorf("expected handler execution to be %t and got %t", want, got)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Error("expected the checkpoint to be removed after completing the action")
+			}
+		})
+	}
+}
+
+func TestAutoscalingListenerRemovesStaleCheckpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	instanceID := "i-000000000000"
+	path := writeTestCheckpoint(t, dir, instanceID)
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, &smithy.GenericAPIError{Code: "ValidationError", Message: "No active Lifecycle Action found with instance ID i-000000000000"})
+
+	// The action is no longer active, so the first notice is the one from the queue
+	_, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:    instanceID,
+		CheckpointDir: dir,
+	})
+	if got, want := notice.(lifecycled.DetailedNotice).Transition(), "autoscaling:EC2_INSTANCE_TERMINATING"; got != want {
+		t.Errorf("expected transition '%s' and got '%s'", want, got)
+	}
+	if strings.Contains(string(notice.(lifecycled.DetailedNotice).Raw()), "recovered-token") {
+		t.Error("expected the notice from the queue")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected the stale checkpoint to be removed")
+	}
+}
+
+func TestAutoscalingNoticeCompleteEarly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		mu        sync.Mutex
+		completed bool
+		result    string
+	)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, input *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			completed, result = true, aws.ToString(input.LifecycleActionResult)
+			return &autoscaling.CompleteLifecycleActionOutput{}, nil
+		},
+	)
+
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		AutoscalingHeartbeatInterval: 5 * time.Millisecond,
+	})
+
+	// The action is completed while the handler is running, and not again when it fails
+	var completedEarly bool
+	err := daemon.Handle(context.TODO(), notice, lifecycled.NoticeHandlerFunc(func(_ context.Context, n *lifecycled.Notice) error {
+		n.Complete()
+		n.Complete()
+		mu.Lock()
+		completedEarly = completed
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		return errors.New("cleanup failed")
+	}))
+	if err == nil {
+		t.Error("expected the handler error to be returned")
+	}
+	if !completedEarly {
+		t.Error("expected the lifecycle action to be completed before the handler exited")
+	}
+	if got, want := result, "CONTINUE"; got != want {
+		t.Errorf("expected lifecycle action result '%s' and got '%s'", want, got)
+	}
+}
+
+func TestAutoscalingNoticeShutdownPolicy(t *testing.T) {
+	tests := []struct {
+		description    string
+		policy         string
+		expectedResult string
+	}{
+		{
+			description:    "continues by default",
+			expectedResult: "CONTINUE",
+		},
+		{
+			description:    "abandons when configured",
+			policy:         "abandon",
+			expectedResult: "ABANDON",
+		},
+		{
+			description: "leaves the lifecycle action when configured",
+			policy:      "leave",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var result string
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).MaxTimes(1).DoAndReturn(
+				func(_ context.Context, input *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+					result = aws.ToString(input.LifecycleActionResult)
+					return &autoscaling.CompleteLifecycleActionOutput{}, nil
+				},
+			)
+
+			daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+				InstanceID:     "i-000000000000",
+				ShutdownPolicy: tc.policy,
+			})
+
+			ctx, shutdown := lifecycled.WithShutdown(context.TODO())
+			handler := &blockingHandler{started: make(chan struct{})}
+			go func() {
+				<-handler.started
+				shutdown("received interrupt")
+			}()
+
+			if err := daemon.Handle(ctx, notice, handler); !errors.Is(err, context.Canceled) {
+				t.Errorf("expected the handler to be cancelled and got: %v", err)
+			}
+			if got, want := result, tc.expectedResult; got != want {
+				t.Errorf("expected lifecycle action result '%s' and got '%s'", want, got)
+			}
+		})
+	}
+}
+
+func TestAutoscalingNoticeBeforeHeartbeat(t *testing.T) {
+	tests := []struct {
+		description string
+		stopErr     error
+	}{
+		{
+			description: "hook stops heartbeats",
+			stopErr:     lifecycled.ErrStopHeartbeats,
+		},
+		{
+			description: "hook fails",
+			stopErr:     errors.New("drain controller unavailable"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// The third heartbeat is vetoed, and the action is still completed after the handler
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).Return(nil, nil)
+			as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+			var (
+				mu      sync.Mutex
+				numbers []int
+			)
+			daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+				InstanceID:                   "i-000000000000",
+				AutoscalingHeartbeatInterval: 5 * time.Millisecond,
+				BeforeHeartbeat: func(_ context.Context, h *lifecycled.Heartbeat) error {
+					mu.Lock()
+					defer mu.Unlock()
+					numbers = append(numbers, h.Number)
+					if h.Number == 3 {
+						return tc.stopErr
+					}
+					return nil
+				},
+			})
+
+			if err := daemon.Handle(context.TODO(), notice, sleepyHandler{}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(numbers) != 3 || numbers[0] != 1 || numbers[1] != 2 || numbers[2] != 3 {
+				t.Errorf("expected the hook to be called once for heartbeats 1 to 3 and got %v", numbers)
+			}
+			if sent, _ := notice.(interface{ Heartbeats() (int, int) }).Heartbeats(); sent != 2 {
+				t.Errorf("expected 2 heartbeats to be sent and got %d", sent)
+			}
+		})
+	}
+}
+
+func TestAutoscalingNoticeHeartbeatInterval(t *testing.T) {
+	tests := []struct {
+		description      string
+		interval         time.Duration
+		heartbeatTimeout int32
+		describeErr      error
+		expectDescribe   bool
+		expectedInterval string
+	}{
+		{
+			description:      "explicit interval is used",
+			interval:         time.Minute,
+			expectedInterval: "",
+		},
+		{
+			description:      "half of the heartbeat timeout",
+			heartbeatTimeout: 120,
+			expectDescribe:   true,
+			expectedInterval: "1m0s",
+		},
+		{
+			description:      "clamped to the maximum interval",
+			heartbeatTimeout: 7200,
+			expectDescribe:   true,
+			expectedInterval: "5m0s",
+		},
+		{
+			description:      "default when the hook can't be described",
+			describeErr:      errors.New("throttled"),
+			expectDescribe:   true,
+			expectedInterval: "10s",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			if tc.expectDescribe {
+				as.EXPECT().DescribeLifecycleHooks(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+					func(_ context.Context, input *autoscaling.DescribeLifecycleHooksInput, _ ...func(*autoscaling.Options)) (*autoscaling.DescribeLifecycleHooksOutput, error) {
+						if got, want := input.LifecycleHookNames[0], "hook"; got != want {
+							t.Errorf("expected hook '%s' to be described and got '%s'", want, got)
+						}
+						if tc.describeErr != nil {
+							return nil, tc.describeErr
+						}
+						return &autoscaling.DescribeLifecycleHooksOutput{
+							LifecycleHooks: []autoscalingtypes.LifecycleHook{{HeartbeatTimeout: aws.Int32(tc.heartbeatTimeout)}},
+						}, nil
+					},
+				)
+			}
+
+			logger, hook := logrus.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				AutoscalingHeartbeatInterval: tc.interval,
+			}, nil, nil, as, nil, logger)
+
+			_, err := daemon.Replay(context.TODO(), []byte(replayMessage), lifecycled.HandlerFunc(func(context.Context, ...string) error {
+				return nil
+			}), lifecycled.ReplayOptions{SkipCompletion: true})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var interval string
+			for _, e := range hook.AllEntries() {
+				if v, ok := e.Data["interval"]; ok {
+					interval = v.(string)
+				}
+			}
+			if got, want := interval, tc.expectedInterval; got != want {
+				t.Errorf("expected derived interval '%s' and got '%s'", want, got)
+			}
+		})
+	}
+}
+
+func TestAutoscalingPollSummary(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("subscription"),
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).DoAndReturn(
+		func(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+			time.Sleep(5 * time.Millisecond)
+			return &sqs.ReceiveMessageOutput{}, nil
+		},
+	)
+
+	queue := lifecycled.NewQueue("queue", "topic", sq, sn)
+	listener := lifecycled.NewAutoscalingListener("i-000000000000", queue, nil, lifecycled.AutoscalingOptions{
+		PollSummaryInterval: 30 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 200*time.Millisecond)
+	defer cancel()
+
+	logger, hook := logrus.NewNullLogger()
+	if err := listener.Start(ctx, make(chan lifecycled.TerminationNotice), logger.WithField("listener", "autoscaling")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var started, summaries, polls int
+	for _, e := range hook.AllEntries() {
+		switch e.Message {
+		case "Polling sqs for messages":
+			started++
+		case "Polled sqs for messages":
+			summaries++
+			polls += e.Data["polls"].(int)
+			if e.Data["messages"] != 0 || e.Data["errors"] != 0 {
+				t.Errorf("expected no messages or errors and got %v", e.Data)
+			}
+		}
+	}
+	if started != 1 {
+		t.Errorf("expected polling to be logged once and got %d", started)
+	}
+	if summaries < 2 || polls < summaries {
+		t.Errorf("expected summaries of the polls and got %d summaries of %d polls", summaries, polls)
+	}
+}
+
+func TestAutoscalingDiagnostics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessages(sq, sn, nil, []byte(aws.ToString(newSQSMessage(instanceID).Body)))
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: 10 * time.Millisecond,
+	}, sq, sn, as, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	var diag *lifecycled.Diagnostics
+	err := daemon.Run(ctx, lifecycled.HandlerFunc(func(context.Context, ...string) error {
+		time.Sleep(50 * time.Millisecond)
+		diag = daemon.Diagnostics()
+		daemon.DumpDiagnostics(logger.WithField("test", true))
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(diag.Notices) != 1 {
+		t.Fatalf("expected a notice in the diagnostics and got %+v", diag.Notices)
+	}
+	n := diag.Notices[0]
+	if n.HeartbeatsSent < 1 {
+		t.Errorf("expected heartbeats to be counted and got %+v", n)
+	}
+	if !strings.Contains(n.Details, "autoscaling:EC2_INSTANCE_TERMINATING") || !strings.Contains(n.Details, "token ...)") {
+		t.Errorf("expected the details of the notice with the token masked and got '%s'", n.Details)
+	}
+	if len(diag.Listeners) != 1 || diag.Listeners[0].QueueURL != "url" {
+		t.Errorf("expected the queue url in the listener status and got %+v", diag.Listeners)
+	}
+
+	var dumped bool
+	for _, e := range hook.AllEntries() {
+		if e.Message == "Diagnostic dump" {
+			dumped = strings.Contains(e.Data["state"].(string), `"queueUrl":"url"`)
+		}
+	}
+	if !dumped {
+		t.Error("expected the diagnostic dump to be logged")
+	}
+}
+
+func TestAutoscalingNoticeTimeline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(12).Return(nil, nil)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	daemon, notice := startAutoscalingDaemon(t, ctrl, as, &lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		AuditFile:                    path,
+		AutoscalingHeartbeatInterval: 2 * time.Millisecond,
+	})
+	if err := daemon.Handle(context.TODO(), notice, sleepyHandler{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	records := readAuditRecords(t, path)
+	if len(records) != 1 {
+		t.Fatalf("expected one audit record and got %d", len(records))
+	}
+	events := records[0].Timeline
+	counts := make(map[string]int)
+	for i, e := range events {
+		counts[e.Event]++
+		if i > 0 && e.Time.Before(events[i-1].Time) {
+			t.Errorf("expected event '%s' to be after '%s'", e.Event, events[i-1].Event)
+		}
+	}
+	for _, event := range []string{
+		lifecycled.TimelineReceived,
+		lifecycled.TimelineHandlerStarted,
+		lifecycled.TimelineHandlerFinished,
+		lifecycled.TimelineHeartbeatsOmitted,
+		lifecycled.TimelineCompletionStarted,
+		lifecycled.TimelineCompletionFinished,
+	} {
+		if counts[event] != 1 {
+			t.Errorf("expected one '%s' event and got %d", event, counts[event])
+		}
+	}
+	if got, want := counts[lifecycled.TimelineHeartbeat], 10; got != want {
+		t.Errorf("expected %d heartbeat events and got %d", want, got)
+	}
+	if last := events[len(events)-1]; last.Event != lifecycled.TimelineCompletionFinished || last.Detail != lifecycled.ResultContinue {
+		t.Errorf("expected the timeline to end with completion and got '%s (%s)'", last.Event, last.Detail)
+	}
+}
+
+func TestAutoscalingNoticeCorrelationID(t *testing.T) {
+	tests := []struct {
+		description string
+		metadata    string
+		expected    string
+	}{
+		{description: "correlation id", metadata: `{"correlationId":"deploy-1234"}`, expected: "deploy-1234"},
+		{description: "invalid correlation id", metadata: `{"correlationId":"deploy 1234"}`},
+		{description: "metadata without a correlation id", metadata: "drain"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			message, err := json.Marshal(&lifecycled.Message{
+				GroupName:            "group",
+				InstanceID:           "i-000000000000",
+				ActionToken:          "token",
+				Transition:           "autoscaling:EC2_INSTANCE_TERMINATING",
+				HookName:             "hook",
+				NotificationMetadata: tc.metadata,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			envelope, err := json.Marshal(&lifecycled.Envelope{Type: "type", Subject: "subject", Time: time.Now(), Message: string(message)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			expectQueueMessage(sq, sn, sqstypes.Message{Body: aws.String(string(envelope)), ReceiptHandle: aws.String("handle")})
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+			defer cancel()
+
+			logger, _ := logrus.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				InstanceID:                   "i-000000000000",
+				SNSTopic:                     "topic",
+				AutoscalingHeartbeatInterval: time.Minute,
+			}, sq, sn, as, nil, logger)
+			notice, err := daemon.Start(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error starting daemon: %s", err)
+			}
+
+			var runID string
+			handler := lifecycled.NoticeHandlerFunc(func(_ context.Context, n *lifecycled.Notice) error {
+				runID = n.RunID
+				return nil
+			})
+			if err := daemon.Handle(context.TODO(), notice, handler); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tc.expected != "" && runID != tc.expected {
+				t.Errorf("expected run id '%s' and got '%s'", tc.expected, runID)
+			}
+			if tc.expected == "" && len(runID) != 8 {
+				t.Errorf("expected a random run id and got '%s'", runID)
+			}
+		})
+	}
+}
+
+func TestAutoscalingNoticeHandlerStartLatency(t *testing.T) {
+	tests := []struct {
+		description string
+		threshold   time.Duration
+		expectLevel string
+	}{
+		{
+			description: "logs the latency",
+			threshold:   time.Hour,
+			expectLevel: "info",
+		},
+		{
+			description: "warns when the latency exceeds the threshold",
+			threshold:   15 * time.Second,
+			expectLevel: "warning",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			instanceID := "i-000000000000"
+
+			// The lifecycle hook fired 20s before the message is received
+			var env lifecycled.Envelope
+			message := newSQSMessage(instanceID)
+			if err := json.Unmarshal([]byte(aws.ToString(message.Body)), &env); err != nil {
+				t.Fatal(err)
+			}
+			var msg lifecycled.Message
+			if err := json.Unmarshal([]byte(env.Message), &msg); err != nil {
+				t.Fatal(err)
+			}
+			msg.Time = time.Now().Add(-20 * time.Second)
+			m, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env.Message = string(m)
+			body, err := json.Marshal(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message.Body = aws.String(string(body))
+
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			expectQueueMessage(sq, sn, message)
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+			logger, hook := logrus.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				InstanceID:                   instanceID,
+				SNSTopic:                     "topic",
+				AutoscalingHeartbeatInterval: time.Minute,
+				HandlerStartThreshold:        tc.threshold,
+			}, sq, sn, as, nil, logger)
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+			defer cancel()
+
+			notice, err := daemon.Start(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := daemon.Handle(ctx, notice, &countingHandler{}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var found bool
+			for _, e := range hook.AllEntries() {
+				latency, ok := e.Data["hookToHandlerStart"]
+				if !ok {
+					continue
+				}
+				found = true
+				if got := e.Level.String(); got != tc.expectLevel {
+					t.Errorf("expected the latency to be logged at %s and got %s", tc.expectLevel, got)
+				}
+				d, err := time.ParseDuration(latency.(string))
+				if err != nil || d < 20*time.Second || d > 25*time.Second {
+					t.Errorf("expected a latency of about 20s and got %v", latency)
+				}
+			}
+			if !found {
+				t.Error("expected the latency from the hook firing to the handler starting to be logged")
+			}
+		})
+	}
+}
+
+func TestAutoscalingListenerIAMPropagation(t *testing.T) {
+	instanceID := "i-000000000000"
+	denied := &smithy.GenericAPIError{Code: "AuthorizationError", Message: "not authorized to perform sns:Subscribe"}
+	accessDenied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "access to the resource is denied"}
+
+	tests := []struct {
+		description string
+		timeout     time.Duration
+		subscribe   []error
+		receive     []error
+		expectError string
+	}{
+		{
+			description: "denied while propagating",
+			timeout:     time.Minute,
+			subscribe:   []error{denied},
+			receive:     []error{accessDenied},
+		},
+		{
+			description: "subscribe denied after the timeout",
+			timeout:     time.Nanosecond,
+			subscribe:   []error{denied},
+			expectError: "AuthorizationError",
+		},
+		{
+			description: "receive denied after the timeout",
+			timeout:     time.Nanosecond,
+			receive:     []error{accessDenied},
+			expectError: "still denied",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+				QueueUrl: aws.String("url"),
+			}, nil)
+			sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).AnyTimes().Return(&sqs.GetQueueAttributesOutput{
+				Attributes: map[string]string{"QueueArn": "arn"},
+			}, nil)
+			sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
+
+			// The calls are denied, and then allowed once IAM has propagated
+			subscribes := tc.subscribe
+			sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).DoAndReturn(
+				func(context.Context, *sns.SubscribeInput, ...func(*sns.Options)) (*sns.SubscribeOutput, error) {
+					if len(subscribes) > 0 {
+						err := subscribes[0]
+						subscribes = subscribes[1:]
+						return nil, err
+					}
+					return &sns.SubscribeOutput{SubscriptionArn: aws.String("arn")}, nil
+				},
+			)
+			receives := tc.receive
+			sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+				func(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+					if len(receives) > 0 {
+						err := receives[0]
+						receives = receives[1:]
+						return nil, err
+					}
+					return &sqs.ReceiveMessageOutput{Messages: []sqstypes.Message{newSQSMessage(instanceID)}}, nil
+				},
+			)
+
+			queue := lifecycled.NewQueue("queue", "topic", sq, sn)
+			listener := lifecycled.NewAutoscalingListener(instanceID, queue, nil, lifecycled.AutoscalingOptions{
+				IAMPropagationTimeout: tc.timeout,
+			})
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+			defer cancel()
+
+			logger, hook := logrus.NewNullLogger()
+			notices := make(chan lifecycled.TerminationNotice, 1)
+			done := make(chan error, 1)
+			go func() {
+				done <- listener.Start(ctx, notices, logger.WithField("listener", "autoscaling"))
+			}()
+
+			if tc.expectError != "" {
+				err := <-done
+				if err == nil || !strings.Contains(err.Error(), tc.expectError) {
+					t.Fatalf("expected an error containing '%s' and got: %v", tc.expectError, err)
+				}
+				return
+			}
+			select {
+			case <-notices:
+			case err := <-done:
+				t.Fatalf("expected a notice once IAM propagated and got: %v", err)
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for a notice")
+			}
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var waiting int
+			for _, e := range hook.AllEntries() {
+				if strings.Contains(e.Message, "waiting for IAM propagation") {
+					waiting++
+				}
+			}
+			if waiting != 2 {
+				t.Errorf("expected the subscribe and the poll to wait for IAM propagation and got %d", waiting)
+			}
+		})
+	}
+}
+
+// benchmarkQueue is a queue that delivers a number of copies of a message, in batches of 10 like
+// SQS, and then cancels the listener. The other calls of the autoscaling listener succeed.
+type benchmarkQueue struct {
+	lifecycled.SQSClient
+	lifecycled.SNSClient
+	batch     []sqstypes.Message
+	remaining int
+	cancel    context.CancelFunc
+}
+
+func (q *benchmarkQueue) CreateQueue(context.Context, *sqs.CreateQueueInput, ...func(*sqs.Options)) (*sqs.CreateQueueOutput, error) {
+	return &sqs.CreateQueueOutput{QueueUrl: aws.String("url")}, nil
+}
+
+func (q *benchmarkQueue) GetQueueAttributes(context.Context, *sqs.GetQueueAttributesInput, ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	return &sqs.GetQueueAttributesOutput{Attributes: map[string]string{"QueueArn": "arn"}}, nil
+}
+
+func (q *benchmarkQueue) Subscribe(context.Context, *sns.SubscribeInput, ...func(*sns.Options)) (*sns.SubscribeOutput, error) {
+	return &sns.SubscribeOutput{SubscriptionArn: aws.String("arn")}, nil
+}
+
+func (q *benchmarkQueue) ReceiveMessage(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	if q.remaining <= 0 {
+		q.cancel()
+		return nil, ctx.Err()
+	}
+	n := len(q.batch)
+	if q.remaining < n {
+		n = q.remaining
+	}
+	q.remaining -= n
+	return &sqs.ReceiveMessageOutput{Messages: q.batch[:n]}, nil
+}
+
+func (q *benchmarkQueue) DeleteMessage(context.Context, *sqs.DeleteMessageInput, ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// BenchmarkAutoscalingMessages measures the processing of each message that the autoscaling
+// listener receives, from a shared topic where most of them are for other instances.
+func BenchmarkAutoscalingMessages(b *testing.B) {
+	for _, bc := range []struct {
+		description string
+		instanceID  string
+	}{
+		{description: "other instance", instanceID: "i-111111111111"},
+		{description: "instance", instanceID: "i-000000000000"},
+	} {
+		b.Run(bc.description, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+
+			q := &benchmarkQueue{remaining: b.N, cancel: cancel}
+			for i := 0; i < 10; i++ {
+				q.batch = append(q.batch, newSQSMessage(bc.instanceID))
+			}
+			queue := lifecycled.NewQueue("queue", "topic", q, q)
+			listener := lifecycled.NewAutoscalingListener("i-000000000000", queue, nil, lifecycled.AutoscalingOptions{})
+
+			notices := make(chan lifecycled.TerminationNotice)
+			go func() {
+				for range notices {
+				}
+			}()
+			defer close(notices)
+
+			logger, _ := logrus.NewNullLogger()
+			b.ReportAllocs()
+			b.ResetTimer()
+			if err := listener.Start(ctx, notices, logger.WithField("listener", "autoscaling")); err != nil {
+				b.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
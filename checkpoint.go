@@ -0,0 +1,81 @@
+package lifecycled
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Handler policies for notices that are recovered from a checkpoint.
+const (
+	// RecoverRerun executes the handler again for a recovered notice.
+	RecoverRerun = "rerun"
+
+	// RecoverSkip only sends heartbeats and completes the lifecycle action for a recovered notice.
+	RecoverSkip = "skip"
+)
+
+// Checkpoint is persisted while an autoscaling notice is being handled, so that the
+// lifecycle action can be recovered if the daemon crashes before completing it.
+type Checkpoint struct {
+	Message
+	StartedAt      time.Time `json:"startedAt"`
+	HandlerAttempt int       `json:"handlerAttempt"`
+}
+
+// checkpointPath returns the path of the checkpoint for a lifecycle action. The token
+// is hashed since it is not guaranteed to be a valid file name.
+func checkpointPath(dir string, message *Message) string {
+	sum := sha256.Sum256([]byte(message.ActionToken))
+	return filepath.Join(dir, "lifecycled-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// writeCheckpoint atomically, and readable only by the owner since it contains the action token.
+func writeCheckpoint(path string, c *Checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// readCheckpoints returns the checkpoints in the directory for the instance, by path.
+// Checkpoints that can't be read are logged and skipped.
+func readCheckpoints(dir, instanceID string, log *logrus.Entry) (map[string]*Checkpoint, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	checkpoints := make(map[string]*Checkpoint)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), "lifecycled-") || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.WithError(err).WithField("path", path).Warn("Failed to read checkpoint")
+			continue
+		}
+		var c Checkpoint
+		if err := json.Unmarshal(data, &c); err != nil {
+			log.WithError(err).WithField("path", path).Warn("Failed to parse checkpoint")
+			continue
+		}
+		if c.InstanceID == instanceID {
+			checkpoints[path] = &c
+		}
+	}
+	return checkpoints, nil
+}
@@ -0,0 +1,74 @@
+package lifecycled
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// Clients are the AWS clients of the daemon. NewClients creates all of them from one AWS
+// configuration, so that they share its region, endpoints, credentials and HTTP client. Library
+// consumers can pass their own Clients to NewWithClients, or replace some of them, e.g. with a
+// fake, or a client with other options.
+type Clients struct {
+	SQS            SQSClient
+	SNS            SNSClient
+	Autoscaling    AutoscalingClient
+	EC2            EC2Client
+	CloudWatch     CloudWatchClient
+	CloudWatchLogs CloudWatchLogsClient
+	Metadata       *imds.Client
+
+	// KMS checks the key of an encrypted topic in the self-check (optional).
+	KMS KMSClient
+
+	// Regions are the clients of the queues of the secondary topics, by the region of the topic
+	// (see Config.SecondarySNSTopics).
+	Regions map[string]RegionClients
+}
+
+// RegionClients are the clients of the queue of a secondary topic, in the region of the topic.
+// The lifecycle actions are still recorded and completed in the region of the instance.
+type RegionClients struct {
+	SQS SQSClient
+	SNS SNSClient
+	KMS KMSClient
+}
+
+// NewClients returns the clients of the AWS configuration (see NewAWSConfig), with the
+// metadata client of the config (see NewIMDSClient), and the clients of the regions of the
+// secondary topics with the same configuration in their region.
+func NewClients(cfg aws.Config, c *Config) *Clients {
+	clients := &Clients{
+		SQS:            sqs.NewFromConfig(cfg),
+		SNS:            sns.NewFromConfig(cfg),
+		Autoscaling:    autoscaling.NewFromConfig(cfg),
+		EC2:            ec2.NewFromConfig(cfg),
+		CloudWatch:     cloudwatch.NewFromConfig(cfg),
+		CloudWatchLogs: cloudwatchlogs.NewFromConfig(cfg),
+		Metadata:       NewIMDSClient(cfg, c),
+		KMS:            NewKMSClient(cfg, c),
+	}
+	for _, topic := range c.SecondarySNSTopics {
+		region := topicRegion(topic)
+		if region == "" {
+			continue
+		}
+		if clients.Regions == nil {
+			clients.Regions = make(map[string]RegionClients)
+		}
+		regional := cfg.Copy()
+		regional.Region = region
+		clients.Regions[region] = RegionClients{
+			SQS: sqs.NewFromConfig(regional),
+			SNS: sns.NewFromConfig(regional),
+			KMS: NewKMSClient(regional, c),
+		}
+	}
+	return clients
+}
@@ -0,0 +1,77 @@
+package lifecycled_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestNewClients(t *testing.T) {
+	config := lifecycled.DefaultConfig()
+	cfg, err := lifecycled.NewAWSConfig(context.TODO(), config, "eu-west-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	client := &hostClient{}
+	cfg.HTTPClient = client
+	cfg.Credentials = aws.AnonymousCredentials{}
+	cfg.Retryer = func() aws.Retryer { return aws.NopRetryer{} }
+
+	// The clients share the region and the HTTP client of the configuration
+	clients := lifecycled.NewClients(cfg, config)
+	_, _ = clients.SQS.GetQueueUrl(context.TODO(), &sqs.GetQueueUrlInput{QueueName: aws.String("lifecycled")})
+	_, _ = clients.SNS.Subscribe(context.TODO(), &sns.SubscribeInput{TopicArn: aws.String("arn:aws:sns:eu-west-1:123456789012:lifecycled"), Protocol: aws.String("sqs")})
+	_, _ = clients.Autoscaling.DescribeAutoScalingInstances(context.TODO(), &autoscaling.DescribeAutoScalingInstancesInput{})
+	_, _ = clients.EC2.DescribeTags(context.TODO(), &ec2.DescribeTagsInput{})
+
+	expected := []string{"sqs.eu-west-1.amazonaws.com", "sns.eu-west-1.amazonaws.com", "autoscaling.eu-west-1.amazonaws.com", "ec2.eu-west-1.amazonaws.com"}
+	if len(client.hosts) != len(expected) {
+		t.Fatalf("expected the requests to be sent to %v and got %v", expected, client.hosts)
+	}
+	for i, host := range expected {
+		if client.hosts[i] != host {
+			t.Errorf("expected request %d to be sent to %s and got %s", i, host, client.hosts[i])
+		}
+	}
+}
+
+func TestNewWithClients(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The instance tags are described with the injected client
+	ec := mocks.NewMockEC2Client(ctrl)
+	ec.EXPECT().DescribeTags(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, input *ec2.DescribeTagsInput, _ ...func(*ec2.Options)) (*ec2.DescribeTagsOutput, error) {
+			if got := input.Filters[0].Values[0]; got != "i-000000000000" {
+				t.Errorf("expected the tags of i-000000000000 and got %s", got)
+			}
+			return &ec2.DescribeTagsOutput{}, nil
+		},
+	)
+
+	config := lifecycled.DefaultConfig()
+	config.InstanceID = "i-000000000000"
+	config.InstanceTags = []string{"Name"}
+	config.SpotListener = false
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewWithClients(config, &lifecycled.Clients{
+		SQS:         mocks.NewMockSQSClient(ctrl),
+		SNS:         mocks.NewMockSNSClient(ctrl),
+		Autoscaling: mocks.NewMockAutoscalingClient(ctrl),
+		EC2:         ec,
+	}, logger)
+	if daemon == nil {
+		t.Fatal("expected a daemon")
+	}
+}
@@ -0,0 +1,43 @@
+package lifecycled
+
+import "time"
+
+// clock compares the timestamps of AWS, such as when a notification was published or a lifecycle
+// hook fired, with the clock of the instance, which can be a few seconds apart from the clocks of
+// AWS. Durations between local times, such as from receiving a notice to handling it, aren't
+// skewed: time.Time.Sub uses the monotonic clock when both times have a reading, as the times
+// from time.Now do, so the comparisons with AWS are kept to the legs that need them.
+type clock struct {
+	// tolerance is the skew that is expected between the clocks, within which a timestamp that
+	// is ahead of the instance is corrected quietly and a message isn't considered stale
+	tolerance time.Duration
+}
+
+// since returns the time from the timestamp of AWS to the local time, which is zero if either is
+// unknown. A timestamp after the local time, because the clock of the instance is behind AWS, is
+// corrected to zero, and skew is how far ahead it was (zero if it wasn't corrected).
+func (c clock) since(remote, local time.Time) (elapsed, skew time.Duration) {
+	if remote.IsZero() || local.IsZero() {
+		return 0, 0
+	}
+	if d := local.Sub(remote); d >= 0 {
+		return d, 0
+	}
+	return 0, remote.Sub(local)
+}
+
+// skewed returns true if the skew is more than is tolerated, which is worth a warning: the clock
+// of the instance is likely not synchronised.
+func (c clock) skewed(skew time.Duration) bool {
+	return skew > c.tolerance
+}
+
+// stale returns true if the timestamp of AWS is older than the age at the local time. The
+// tolerance is added to the age, so that a message from a clock that is behind the instance
+// isn't discarded before it is as old as the age.
+func (c clock) stale(remote, local time.Time, age time.Duration) bool {
+	if age <= 0 || remote.IsZero() {
+		return false
+	}
+	return local.Sub(remote) > age+c.tolerance
+}
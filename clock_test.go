@@ -0,0 +1,80 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// hookMessage returns the body of a termination message of the hook that fired at the time.
+func hookMessage(t *testing.T, hook string, firedAt time.Time) []byte {
+	body, err := json.Marshal(&lifecycled.Envelope{
+		Type: "Notification",
+		Time: firedAt,
+		Message: fmt.Sprintf(`{"Time":%q,"AutoScalingGroupName":"group","EC2InstanceId":"i-000000000000","LifecycleActionToken":"token","LifecycleTransition":"autoscaling:EC2_INSTANCE_TERMINATING","LifecycleHookName":%q}`,
+			firedAt.UTC().Format(time.RFC3339Nano), hook),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestAutoscalingStaleMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The message that is older than the age by less than the tolerance of the skew is handled
+	now := time.Now()
+	handled := make(chan struct{})
+	close(handled)
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessages(sq, sn, handled,
+		hookMessage(t, "stale", now.Add(-2*time.Hour)),
+		hookMessage(t, "skewed", now.Add(-time.Hour-time.Minute)),
+	)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: time.Minute,
+		StaleMessageAge:              time.Hour,
+		ClockSkewTolerance:           5 * time.Minute,
+	}, sq, sn, as, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	notice, err := daemon.Start(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	n, ok := notice.(lifecycled.DetailedNotice)
+	if !ok {
+		t.Fatal("expected a detailed notice")
+	}
+	if !strings.Contains(string(n.Raw()), `\"LifecycleHookName\":\"skewed\"`) {
+		t.Errorf("expected the notice of the skewed message and got %s", n.Raw())
+	}
+
+	var discarded int
+	for _, e := range hook.AllEntries() {
+		if e.Message == "Discarding stale autoscaling message" {
+			discarded++
+		}
+	}
+	if discarded != 1 {
+		t.Errorf("expected the stale message to be discarded and got %d discarded", discarded)
+	}
+}
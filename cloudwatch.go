@@ -0,0 +1,280 @@
+package lifecycled
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/sirupsen/logrus"
+)
+
+// CloudWatchLogsClient is the subset of the CloudWatch Logs API that lifecycled uses, which
+// *cloudwatchlogs.Client implements.
+//
+//go:generate mockgen -destination=mocks/mock_cloudwatchlogs_client.go -package=mocks github.com/triarius/lifecycled CloudWatchLogsClient
+type CloudWatchLogsClient interface {
+	CreateLogGroup(context.Context, *cloudwatchlogs.CreateLogGroupInput, ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error)
+	CreateLogStream(context.Context, *cloudwatchlogs.CreateLogStreamInput, ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error)
+	DescribeLogStreams(context.Context, *cloudwatchlogs.DescribeLogStreamsInput, ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogStreamsOutput, error)
+	PutLogEvents(context.Context, *cloudwatchlogs.PutLogEventsInput, ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error)
+}
+
+// Limits of a PutLogEvents batch, where each event counts 26 bytes on top of its message.
+const (
+	maxLogBatchEvents   = 10000
+	maxLogBatchSize     = 1048576
+	logEventOverhead    = 26
+	defaultLogBatchWait = 5 * time.Second
+)
+
+// NewCloudWatchLogsHook returns a logrus hook which sends log entries to the CloudWatch Logs stream,
+// creating the group with the tags (if any) and the stream if they don't exist. Entries are sent in
+// batches at the interval (defaults to 5s), and Close must be called to send the last batch.
+func NewCloudWatchLogsHook(client CloudWatchLogsClient, group, stream string, tags map[string]string, interval time.Duration) (*CloudWatchLogsHook, error) {
+	if interval <= 0 {
+		interval = defaultLogBatchWait
+	}
+	h := &CloudWatchLogsHook{
+		client: client,
+		group:  group,
+		stream: stream,
+		full:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	if err := h.createStream(tags); err != nil {
+		return nil, err
+	}
+	go h.run(interval)
+	return h, nil
+}
+
+// CloudWatchLogsHook is a logrus hook which sends log entries to a CloudWatch Logs stream.
+type CloudWatchLogsHook struct {
+	client CloudWatchLogsClient
+	group  string
+	stream string
+
+	mu     sync.Mutex
+	events []types.InputLogEvent
+	size   int
+
+	// send serializes PutLogEvents, since each call needs the sequence token of the previous one
+	send          sync.Mutex
+	sequenceToken *string
+
+	full      chan struct{}
+	done      chan struct{}
+	exited    chan struct{}
+	closeOnce sync.Once
+}
+
+// createStream creates the log group and stream if they don't exist, and finds the sequence token.
+func (h *CloudWatchLogsHook) createStream(tags map[string]string) error {
+	input := &cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String(h.group)}
+	if len(tags) > 0 {
+		input.Tags = tags
+	}
+	_, err := h.client.CreateLogGroup(context.Background(), input)
+	if err != nil && !isAlreadyExists(err) {
+		return err
+	}
+	_, err = h.client.CreateLogStream(context.Background(), &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(h.group),
+		LogStreamName: aws.String(h.stream),
+	})
+	if err == nil {
+		// A new stream doesn't need a sequence token
+		return nil
+	} else if !isAlreadyExists(err) {
+		return err
+	}
+
+	out, err := h.client.DescribeLogStreams(context.Background(), &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(h.group),
+		LogStreamNamePrefix: aws.String(h.stream),
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range out.LogStreams {
+		if aws.ToString(s.LogStreamName) == h.stream {
+			h.sequenceToken = s.UploadSequenceToken
+		}
+	}
+	return nil
+}
+
+func isAlreadyExists(err error) bool {
+	var exists *types.ResourceAlreadyExistsException
+	return errors.As(err, &exists)
+}
+
+// Levels returns all levels, since the level of the logger decides what is logged.
+func (h *CloudWatchLogsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire adds the entry, formatted by the logger's formatter, to the next batch.
+func (h *CloudWatchLogsHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+	h.add(entry.Time, line)
+	return nil
+}
+
+// Write sends each line of the data as a log event, e.g. for the output of handlers. Lines are
+// not buffered across writes, so that writers that share the hook can't interleave them.
+func (h *CloudWatchLogsHook) Write(p []byte) (int, error) {
+	now := time.Now()
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		h.add(now, string(line))
+	}
+	return len(p), nil
+}
+
+// add an event to the batch, and start sending the batch if it is full.
+func (h *CloudWatchLogsHook) add(t time.Time, message string) {
+	if message == "" {
+		return
+	}
+	h.mu.Lock()
+	h.events = append(h.events, types.InputLogEvent{
+		Message:   aws.String(message),
+		Timestamp: aws.Int64(t.UnixNano() / int64(time.Millisecond)),
+	})
+	h.size += len(message) + logEventOverhead
+	full := len(h.events) >= maxLogBatchEvents || h.size >= maxLogBatchSize
+	h.mu.Unlock()
+
+	if full {
+		select {
+		case h.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *CloudWatchLogsHook) run(interval time.Duration) {
+	defer close(h.exited)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		case <-h.full:
+		}
+		// Errors can't be logged without logging to the hook, so the batch is retried next time
+		_ = h.Flush()
+	}
+}
+
+// Flush sends the events that have been logged so far, and returns once they have been sent.
+func (h *CloudWatchLogsHook) Flush() error {
+	h.send.Lock()
+	defer h.send.Unlock()
+
+	h.mu.Lock()
+	events := h.events
+	h.events, h.size = nil, 0
+	h.mu.Unlock()
+
+	// Events must be in chronological order, and are sent in batches within the limits
+	sort.SliceStable(events, func(i, j int) bool {
+		return aws.ToInt64(events[i].Timestamp) < aws.ToInt64(events[j].Timestamp)
+	})
+	for len(events) > 0 {
+		n, size := 0, 0
+		for n < len(events) && n < maxLogBatchEvents {
+			size += len(aws.ToString(events[n].Message)) + logEventOverhead
+			if size > maxLogBatchSize && n > 0 {
+				break
+			}
+			n++
+		}
+		if err := h.put(events[:n]); err != nil {
+			// Keep the most recent batch of the events that were not sent for the next flush
+			if len(events) > maxLogBatchEvents {
+				events = events[len(events)-maxLogBatchEvents:]
+			}
+			h.mu.Lock()
+			h.events = append(events, h.events...)
+			for _, e := range events {
+				h.size += len(aws.ToString(e.Message)) + logEventOverhead
+			}
+			h.mu.Unlock()
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+// put a batch of events, retrying once with the expected sequence token if it was out of date.
+func (h *CloudWatchLogsHook) put(events []types.InputLogEvent) error {
+	for attempt := 0; ; attempt++ {
+		out, err := h.client.PutLogEvents(context.Background(), &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(h.group),
+			LogStreamName: aws.String(h.stream),
+			LogEvents:     events,
+			SequenceToken: h.sequenceToken,
+		})
+		if err == nil {
+			h.sequenceToken = out.NextSequenceToken
+			return nil
+		}
+
+		var invalid *types.InvalidSequenceTokenException
+		var accepted *types.DataAlreadyAcceptedException
+		switch {
+		case errors.As(err, &accepted):
+			h.sequenceToken = accepted.ExpectedSequenceToken
+			return nil
+		case errors.As(err, &invalid) && attempt == 0:
+			h.sequenceToken = invalid.ExpectedSequenceToken
+		default:
+			return err
+		}
+	}
+}
+
+// Close sends the remaining events and stops sending batches.
+func (h *CloudWatchLogsHook) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.done)
+		<-h.exited
+	})
+	return h.Flush()
+}
+
+// flusher is implemented by log hooks that buffer entries, such as CloudWatchLogsHook.
+type flusher interface {
+	Flush() error
+}
+
+// flushLogs flushes the hooks of the logger that buffer entries, so that the logs are shipped
+// before something that may stop the instance, such as completing the lifecycle action.
+func flushLogs(logger *logrus.Logger) {
+	if logger == nil {
+		return
+	}
+	flushed := make(map[flusher]bool)
+	for _, hooks := range logger.Hooks {
+		for _, hook := range hooks {
+			if f, ok := hook.(flusher); ok && !flushed[f] {
+				flushed[f] = true
+				_ = f.Flush()
+			}
+		}
+	}
+}
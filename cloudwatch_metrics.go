@@ -0,0 +1,187 @@
+package lifecycled
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/sirupsen/logrus"
+)
+
+// CloudWatchClient is the subset of the CloudWatch API that lifecycled uses, which
+// *cloudwatch.Client implements.
+//
+//go:generate mockgen -destination=mocks/mock_cloudwatch_client.go -package=mocks github.com/triarius/lifecycled CloudWatchClient
+type CloudWatchClient interface {
+	PutMetricData(context.Context, *cloudwatch.PutMetricDataInput, ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+const (
+	// cloudWatchMetricsTimeout bounds the time spent publishing the metrics of a notice
+	cloudWatchMetricsTimeout = 2 * time.Second
+
+	// cloudWatchMetricsInterval is the minimum time between publishing metrics, so that a
+	// burst of notices doesn't exceed the PutMetricData quota
+	cloudWatchMetricsInterval = time.Second
+)
+
+// errMetricsRateLimited is returned when metrics are published again within the interval.
+var errMetricsRateLimited = errors.New("rate limited")
+
+// NoticeMetrics are the metrics that are published to CloudWatch for each notice that is handled.
+type NoticeMetrics struct {
+	Notice string
+
+	// GroupName is the autoscaling group, which for notices that are not autoscaling notices is
+	// the group of the instance (see Daemon.SetGroupName), or empty if it is not known.
+	GroupName string
+
+	HandlerDuration   time.Duration
+	HandlerFailed     bool
+	HeartbeatFailures int
+
+	// TimeToFirstNotice is the time from the daemon starting to receiving the notice, which
+	// is only set for the first notice that the daemon handles.
+	TimeToFirstNotice time.Duration
+
+	// HookToHandlerStart is the time from the lifecycle hook firing to the handler starting,
+	// which is only set for autoscaling notices.
+	HookToHandlerStart time.Duration
+}
+
+// NewCloudWatchMetrics returns a publisher which sends the metrics of each notice to CloudWatch,
+// in the namespace.
+func NewCloudWatchMetrics(client CloudWatchClient, namespace string) *CloudWatchMetrics {
+	return &CloudWatchMetrics{client: client, namespace: namespace, interval: cloudWatchMetricsInterval}
+}
+
+// CloudWatchMetrics publishes the metrics of notices with PutMetricData. The metrics have the
+// notice type (and the autoscaling group, if any) as dimensions.
+type CloudWatchMetrics struct {
+	client    CloudWatchClient
+	namespace string
+	interval  time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Publish the metrics, unless metrics were published less than a second ago.
+func (p *CloudWatchMetrics) Publish(ctx context.Context, m *NoticeMetrics) error {
+	p.mu.Lock()
+	if !p.last.IsZero() && time.Since(p.last) < p.interval {
+		p.mu.Unlock()
+		return errMetricsRateLimited
+	}
+	p.last = time.Now()
+	p.mu.Unlock()
+
+	dimensions := []types.Dimension{{Name: aws.String("Notice"), Value: aws.String(m.Notice)}}
+	if m.GroupName != "" {
+		dimensions = append(dimensions, types.Dimension{Name: aws.String("AutoScalingGroupName"), Value: aws.String(m.GroupName)})
+	}
+	datum := func(name string, value float64, unit types.StandardUnit) types.MetricDatum {
+		return types.MetricDatum{
+			MetricName: aws.String(name),
+			Dimensions: dimensions,
+			Value:      aws.Float64(value),
+			Unit:       unit,
+		}
+	}
+
+	// HandlerResult is 1 when the handler succeeded, so that alarms can use the minimum
+	result := 1.0
+	if m.HandlerFailed {
+		result = 0
+	}
+	data := []types.MetricDatum{
+		datum("HandlerDuration", m.HandlerDuration.Seconds(), types.StandardUnitSeconds),
+		datum("HandlerResult", result, types.StandardUnitNone),
+		datum("HeartbeatFailures", float64(m.HeartbeatFailures), types.StandardUnitCount),
+	}
+	if m.TimeToFirstNotice > 0 {
+		data = append(data, datum("TimeToFirstNotice", m.TimeToFirstNotice.Seconds(), types.StandardUnitSeconds))
+	}
+	if m.HookToHandlerStart > 0 {
+		data = append(data, datum("HookToHandlerStart", m.HookToHandlerStart.Seconds(), types.StandardUnitSeconds))
+	}
+	// HandlerFailed is only published on failure, so that a Sum >= 1 alarm fires for any instance
+	if m.HandlerFailed {
+		data = append(data, datum("HandlerFailed", 1, types.StandardUnitCount))
+	}
+
+	_, err := p.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace:  aws.String(p.namespace),
+		MetricData: data,
+	})
+	return err
+}
+
+// SetCloudWatchMetrics configures the daemon to publish the metrics of each notice to CloudWatch.
+func (d *Daemon) SetCloudWatchMetrics(p *CloudWatchMetrics) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cloudwatchMetrics = p
+}
+
+// groupNamer is implemented by notices for an autoscaling group.
+type groupNamer interface {
+	groupName() string
+}
+
+// SetGroupName sets the autoscaling group of the instance, which is the group in the metrics of
+// notices that are not autoscaling notices (e.g. spot).
+func (d *Daemon) SetGroupName(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.groupName = name
+}
+
+// groupOf returns the autoscaling group of the notice, or of the instance if the notice is not
+// an autoscaling notice.
+func (d *Daemon) groupOf(notice TerminationNotice) string {
+	if n, ok := notice.(groupNamer); ok {
+		return n.groupName()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.groupName
+}
+
+// publishMetrics publishes the metrics of the notice to CloudWatch, if configured. Publishing is
+// best effort, and failures are logged without changing the outcome of handling the notice.
+func (d *Daemon) publishMetrics(notice TerminationNotice, result Result, handlerErr error, sinceStart, hookToStart time.Duration, log *logrus.Entry) {
+	d.mu.Lock()
+	publisher := d.cloudwatchMetrics
+	d.mu.Unlock()
+	if publisher == nil {
+		return
+	}
+
+	m := &NoticeMetrics{
+		Notice:            notice.Type(),
+		HandlerDuration:   result.HandlerDuration,
+		HandlerFailed:     handlerErr != nil,
+		HeartbeatFailures: result.HeartbeatsFailed,
+		TimeToFirstNotice: sinceStart,
+
+		HookToHandlerStart: hookToStart,
+	}
+	m.GroupName = d.groupOf(notice)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cloudWatchMetricsTimeout)
+	defer cancel()
+
+	switch err := publisher.Publish(ctx, m); {
+	case errors.Is(err, errMetricsRateLimited):
+		log.Debug("Skipped publishing CloudWatch metrics, which were published less than a second ago")
+	case err != nil:
+		log.WithError(err).Warn("Failed to publish CloudWatch metrics")
+	default:
+		log.Debug("Published CloudWatch metrics")
+	}
+}
@@ -0,0 +1,137 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestCloudWatchMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var input *cloudwatch.PutMetricDataInput
+	cw := mocks.NewMockCloudWatchClient(ctrl)
+	cw.EXPECT().PutMetricData(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, in *cloudwatch.PutMetricDataInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+			input = in
+			return &cloudwatch.PutMetricDataOutput{}, nil
+		},
+	)
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+	daemon.SetCloudWatchMetrics(lifecycled.NewCloudWatchMetrics(cw, "Lifecycled"))
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, failingHandler{}); err == nil {
+		t.Fatal("expected the handler to fail")
+	}
+	// Metrics for a second notice within a second are skipped
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, &countingHandler{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if input == nil {
+		t.Fatal("expected metrics to be published")
+	}
+	if got, want := aws.ToString(input.Namespace), "Lifecycled"; got != want {
+		t.Errorf("expected namespace '%s' and got '%s'", want, got)
+	}
+	values := make(map[string]float64)
+	for _, m := range input.MetricData {
+		values[aws.ToString(m.MetricName)] = aws.ToFloat64(m.Value)
+		if len(m.Dimensions) != 1 || aws.ToString(m.Dimensions[0].Value) != "fake" {
+			t.Errorf("expected the notice type as the only dimension and got %v", m.Dimensions)
+		}
+	}
+	for _, name := range []string{"HandlerDuration", "HandlerResult", "HeartbeatFailures", "TimeToFirstNotice"} {
+		if _, ok := values[name]; !ok {
+			t.Errorf("expected %s to be published", name)
+		}
+	}
+	if got := values["HandlerResult"]; got != 0 {
+		t.Errorf("expected the handler result of a failed handler to be 0 and got %v", got)
+	}
+}
+
+func TestCloudWatchMetricsFailureDoesNotChangeOutcome(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cw := mocks.NewMockCloudWatchClient(ctrl)
+	cw.EXPECT().PutMetricData(gomock.Any(), gomock.Any()).Times(1).Return(nil, errors.New("throttled"))
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+	daemon.SetCloudWatchMetrics(lifecycled.NewCloudWatchMetrics(cw, "Lifecycled"))
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, &countingHandler{}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestCloudWatchMetricsHandlerFailed(t *testing.T) {
+	tests := []struct {
+		description string
+		handler     lifecycled.Handler
+		expected    bool
+	}{
+		{description: "failed", handler: failingHandler{}, expected: true},
+		{description: "succeeded", handler: &countingHandler{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var input *cloudwatch.PutMetricDataInput
+			cw := mocks.NewMockCloudWatchClient(ctrl)
+			cw.EXPECT().PutMetricData(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+				func(_ context.Context, in *cloudwatch.PutMetricDataInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+					input = in
+					return &cloudwatch.PutMetricDataOutput{}, nil
+				},
+			)
+
+			logger, _ := logrus.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+			daemon.SetCloudWatchMetrics(lifecycled.NewCloudWatchMetrics(cw, "Lifecycled"))
+			daemon.SetGroupName("group")
+			daemon.Handle(context.TODO(), fakeNotice{}, tc.handler)
+
+			var failed *cloudwatchtypes.MetricDatum
+			for i, m := range input.MetricData {
+				if aws.ToString(m.MetricName) == "HandlerFailed" {
+					failed = &input.MetricData[i]
+				}
+			}
+			if !tc.expected {
+				if failed != nil {
+					t.Error("expected HandlerFailed to only be published when the handler fails")
+				}
+				return
+			}
+			if failed == nil {
+				t.Fatal("expected HandlerFailed to be published")
+			}
+			if got := aws.ToFloat64(failed.Value); got != 1 {
+				t.Errorf("expected HandlerFailed to be 1 and got %v", got)
+			}
+			dimensions := make(map[string]string)
+			for _, d := range failed.Dimensions {
+				dimensions[aws.ToString(d.Name)] = aws.ToString(d.Value)
+			}
+			if len(dimensions) != 2 || dimensions["Notice"] != "fake" || dimensions["AutoScalingGroupName"] != "group" {
+				t.Errorf("expected the notice type and the group of the instance as dimensions and got %v", dimensions)
+			}
+		})
+	}
+}
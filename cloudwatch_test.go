@@ -0,0 +1,163 @@
+package lifecycled_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logstypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// logMessages returns the messages of the events in a PutLogEvents call.
+func logMessages(input *cloudwatchlogs.PutLogEventsInput) []string {
+	var messages []string
+	for _, e := range input.LogEvents {
+		messages = append(messages, aws.ToString(e.Message))
+	}
+	return messages
+}
+
+func TestCloudWatchLogsHookBatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cw := mocks.NewMockCloudWatchLogsClient(ctrl)
+	cw.EXPECT().CreateLogGroup(gomock.Any(), gomock.Any()).Times(1).Return(&cloudwatchlogs.CreateLogGroupOutput{}, nil)
+	cw.EXPECT().CreateLogStream(gomock.Any(), gomock.Any()).Times(1).Return(&cloudwatchlogs.CreateLogStreamOutput{}, nil)
+
+	var batches [][]string
+	var tokens []string
+	cw.EXPECT().PutLogEvents(gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(_ context.Context, input *cloudwatchlogs.PutLogEventsInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+			batches = append(batches, logMessages(input))
+			tokens = append(tokens, aws.ToString(input.SequenceToken))
+			return &cloudwatchlogs.PutLogEventsOutput{NextSequenceToken: aws.String("next")}, nil
+		},
+	)
+
+	hook, err := lifecycled.NewCloudWatchLogsHook(cw, "group", "i-000000000000", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableColors: true})
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	logger.Info("first")
+	logger.Info("second")
+	if _, err := hook.Write([]byte("handler output\nsecond line\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := hook.Flush(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	logger.Info("third")
+	if err := hook.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got, want := len(batches), 2; got != want {
+		t.Fatalf("expected %d batches and got %d", want, got)
+	}
+	if got, want := len(batches[0]), 4; got != want {
+		t.Errorf("expected %d events in the first batch and got %d: %q", want, got, batches[0])
+	}
+	if got, want := batches[1], []string{"level=info msg=third\n"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("expected the second batch to be %q and got %q", want, got)
+	}
+	if tokens[0] != "" || tokens[1] != "next" {
+		t.Errorf("expected the sequence token of the previous batch and got %q", tokens)
+	}
+}
+
+func TestCloudWatchLogsHookSequenceToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	exists := &logstypes.ResourceAlreadyExistsException{Message: aws.String("already exists")}
+	cw := mocks.NewMockCloudWatchLogsClient(ctrl)
+	cw.EXPECT().CreateLogGroup(gomock.Any(), gomock.Any()).Times(1).Return(nil, exists)
+	cw.EXPECT().CreateLogStream(gomock.Any(), gomock.Any()).Times(1).Return(nil, exists)
+	cw.EXPECT().DescribeLogStreams(gomock.Any(), gomock.Any()).Times(1).Return(&cloudwatchlogs.DescribeLogStreamsOutput{
+		LogStreams: []logstypes.LogStream{
+			{LogStreamName: aws.String("i-000000000000"), UploadSequenceToken: aws.String("stale")},
+		},
+	}, nil)
+
+	var tokens []string
+	cw.EXPECT().PutLogEvents(gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(_ context.Context, input *cloudwatchlogs.PutLogEventsInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+			tokens = append(tokens, aws.ToString(input.SequenceToken))
+			if len(tokens) == 1 {
+				// Another writer used the stream since the token was described
+				return nil, &logstypes.InvalidSequenceTokenException{ExpectedSequenceToken: aws.String("expected")}
+			}
+			return &cloudwatchlogs.PutLogEventsOutput{NextSequenceToken: aws.String("next")}, nil
+		},
+	)
+
+	hook, err := lifecycled.NewCloudWatchLogsHook(cw, "group", "i-000000000000", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := hook.Write([]byte("line\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tokens) != 2 || tokens[0] != "stale" || tokens[1] != "expected" {
+		t.Errorf("expected a retry with the expected sequence token and got %q", tokens)
+	}
+}
+
+func TestCloudWatchLogsFlushedBeforeCompletion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessages(sq, sn, nil, []byte(aws.ToString(newSQSMessage(instanceID).Body)))
+
+	cw := mocks.NewMockCloudWatchLogsClient(ctrl)
+	cw.EXPECT().CreateLogGroup(gomock.Any(), gomock.Any()).Times(1).Return(&cloudwatchlogs.CreateLogGroupOutput{}, nil)
+	cw.EXPECT().CreateLogStream(gomock.Any(), gomock.Any()).Times(1).Return(&cloudwatchlogs.CreateLogStreamOutput{}, nil)
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
+	gomock.InOrder(
+		cw.EXPECT().PutLogEvents(gomock.Any(), gomock.Any()).MinTimes(1).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil),
+		as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil),
+	)
+
+	hook, err := lifecycled.NewCloudWatchLogsHook(cw, "group", instanceID, nil, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: time.Minute,
+	}, sq, sn, as, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	if err := daemon.Run(ctx, lifecycled.HandlerFunc(func(context.Context, ...string) error { return nil })); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+
+	"github.com/alecthomas/kingpin"
+)
+
+// The completion scripts ask lifecycled for the completions of the words before the cursor with
+// --completion-bash, and filter them by the word at the cursor. Unlike the scripts of kingpin,
+// the word at the cursor is only passed on when it is a flag, since a partial command would
+// otherwise be parsed as an argument of the default run command, which completes nothing.
+const bashCompletionTemplate = `
+_{{.App.Name}}_complete() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local args=("${COMP_WORDS[@]:1:COMP_CWORD-1}")
+    if [[ $cur == -* ]]; then
+        args+=("$cur")
+    fi
+    COMPREPLY=( $(compgen -W "$("${COMP_WORDS[0]}" --completion-bash "${args[@]}")" -- "$cur") )
+}
+complete -F _{{.App.Name}}_complete {{.App.Name}}
+`
+
+const zshCompletionTemplate = `#compdef {{.App.Name}}
+autoload -U compinit && compinit
+autoload -U bashcompinit && bashcompinit
+` + bashCompletionTemplate
+
+const fishCompletionTemplate = `
+function __{{.App.Name}}_complete
+    set -l args (commandline -opc)[2..-1]
+    set -l cur (commandline -ct)
+    if string match -q -- '-*' $cur
+        set -a args $cur
+    end
+    {{.App.Name}} --completion-bash $args
+end
+complete -c {{.App.Name}} -f -a '(__{{.App.Name}}_complete)'
+`
+
+// completionTemplates are the templates of the completion scripts of each shell.
+var completionTemplates = map[string]string{
+	"bash": bashCompletionTemplate,
+	"zsh":  zshCompletionTemplate,
+	"fish": fishCompletionTemplate,
+}
+
+// completionScript prints the completion script for the shell. The scripts complete the commands,
+// flags and the values of enum flags from the definitions of the binary that is installed, so
+// they don't need to be regenerated when they change.
+func completionScript(app *kingpin.Application, c *kingpin.ParseContext, shell string) error {
+	app.Writer(os.Stdout)
+	return app.UsageForContextWithTemplate(c, 2, completionTemplates[shell])
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/triarius/lifecycled"
+)
+
+// dumpOnSignal logs a diagnostic dump of the daemon each time SIGUSR2 is received, until the
+// returned function is called. SIGQUIT is left to the Go runtime, which dumps the stacks and exits.
+func dumpOnSignal(daemon *lifecycled.Daemon, log *logrus.Entry) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR2)
+
+	go func() {
+		for sig := range sigs {
+			daemon.DumpDiagnostics(log.WithField("signal", sig.String()))
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/triarius/lifecycled"
+)
+
+// dumpOnSignal is a no-op on Windows, which has no signal for it.
+func dumpOnSignal(_ *lifecycled.Daemon, _ *logrus.Entry) (stop func()) {
+	return func() {}
+}
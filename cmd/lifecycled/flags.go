@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/triarius/lifecycled"
+)
+
+// Sources of the settings in the start-up information.
+const (
+	sourceDefault  = "default"
+	sourceFile     = "file"
+	sourcePreset   = "preset"
+	sourceEnv      = "env"
+	sourceFlag     = "flag"
+	sourceMetadata = "metadata"
+)
+
+// envPrefix is the prefix of the environment variables of the flags.
+const envPrefix = "LIFECYCLED_"
+
+// flagKeys are the keys in the configuration file of the flags that are named differently.
+var flagKeys = map[string]string{
+	"no-spot":      "spot-listener",
+	"instance-tag": "instance-tags",
+	"statsd-tag":   "statsd-tags",
+	"log-level":    "log-levels",
+	"endpoint":     "endpoints",
+	"tag":          "tags",
+}
+
+// envFlag defines a flag of the app which can also be set by an environment variable, e.g.
+// LIFECYCLED_SNS_TOPIC for --sns-topic, which is included in the help.
+func envFlag(app *kingpin.Application, name, help string) *kingpin.FlagClause {
+	envar := envarName(name)
+	return app.Flag(name, help+" ($"+envar+")").Envar(envar)
+}
+
+// envDurationFlag defines a duration flag with envFlag which defaults to d. Durations are parsed
+// with lifecycled.ParseDuration, so they must have units, and malformed durations are reported
+// with the name of the flag and examples, where kingpin would only report the error of
+// time.ParseDuration, e.g. unknown unit "x" in duration "5x".
+func envDurationFlag(app *kingpin.Application, name, help string, d *time.Duration) {
+	envFlag(app, name, help).Default(d.String()).SetValue(&durationValue{flag: name, d: d})
+}
+
+// envIntFlag defines an integer flag with envFlag which defaults to i, like envDurationFlag.
+func envIntFlag(app *kingpin.Application, name, help string, i *int) {
+	envFlag(app, name, help).Default(strconv.Itoa(*i)).SetValue(&intValue{flag: name, i: i})
+}
+
+// envInt64Flag defines an integer flag with envFlag which defaults to i, like envDurationFlag.
+func envInt64Flag(app *kingpin.Application, name, help string, i *int64) {
+	envFlag(app, name, help).Default(strconv.FormatInt(*i, 10)).SetValue(&int64Value{flag: name, i: i})
+}
+
+// envarName returns the environment variable of the flag.
+func envarName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// listValue is a repeatable flag for a list, which replaces the list from the configuration file.
+// Each value may also be a comma separated list, since environment variables can't be repeated.
+type listValue struct {
+	list *[]string
+	set  bool
+}
+
+func newListValue(list *[]string) *listValue {
+	return &listValue{list: list}
+}
+
+func (v *listValue) Set(s string) error {
+	if !v.set {
+		*v.list = nil
+		v.set = true
+	}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.list = append(*v.list, item)
+		}
+	}
+	return nil
+}
+
+func (v *listValue) String() string {
+	return strings.Join(*v.list, ",")
+}
+
+func (v *listValue) IsCumulative() bool {
+	return true
+}
+
+// mapValue is a repeatable flag of KEY=VALUE pairs, which override the same keys from the
+// configuration file. Each value may also be a comma separated list of pairs.
+type mapValue map[string]string
+
+func (v mapValue) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("expected KEY=VALUE got '%s'", pair)
+		}
+		v[parts[0]] = parts[1]
+	}
+	return nil
+}
+
+func (v mapValue) String() string {
+	pairs := make([]string, 0, len(v))
+	for key, value := range v {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v mapValue) IsCumulative() bool {
+	return true
+}
+
+type durationValue struct {
+	flag string
+	d    *time.Duration
+}
+
+func (v *durationValue) Set(s string) error {
+	d, err := lifecycled.ParseDuration(s)
+	if _, e := strconv.ParseFloat(s, 64); err != nil && e == nil {
+		return fmt.Errorf("--%s must be a duration with a unit, got %q (e.g. --%s %ss or %sm)", v.flag, s, v.flag, s, s)
+	} else if err != nil {
+		return fmt.Errorf("--%s must be a duration, got %q (e.g. --%s 30s, 5m, 1h30m or 1d)", v.flag, s, v.flag)
+	}
+	*v.d = d
+	return nil
+}
+
+func (v *durationValue) String() string {
+	return v.d.String()
+}
+
+type intValue struct {
+	flag string
+	i    *int
+}
+
+func (v *intValue) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("--%s must be a whole number, got %q (e.g. --%s %d)", v.flag, s, v.flag, *v.i)
+	}
+	*v.i = i
+	return nil
+}
+
+func (v *intValue) String() string {
+	return strconv.Itoa(*v.i)
+}
+
+type int64Value struct {
+	flag string
+	i    *int64
+}
+
+func (v *int64Value) Set(s string) error {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("--%s must be a whole number, got %q (e.g. --%s %d)", v.flag, s, v.flag, *v.i)
+	}
+	*v.i = i
+	return nil
+}
+
+func (v *int64Value) String() string {
+	return strconv.FormatInt(*v.i, 10)
+}
+
+// splitHandlerArgv splits the arguments at the first --, after which are the path and arguments
+// of the handler, which are passed to it verbatim.
+func splitHandlerArgv(args []string) (flags, handler []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// flagGiven returns true if the flag was given on the command line or by its environment variable.
+func flagGiven(c *kingpin.ParseContext, app *kingpin.Application, name string) bool {
+	for _, el := range c.Elements {
+		if f, ok := el.Clause.(*kingpin.FlagClause); ok && f.Model().Name == name {
+			return true
+		}
+	}
+	f := app.GetFlag(name)
+	return f != nil && f.Model().Envar != "" && os.Getenv(f.Model().Envar) != ""
+}
+
+// flagEnvironment returns the environment variables that set the flags that were given on the
+// command line or in the environment to their values, except for the flags of secrets (see
+// lifecycled.SecretKeys), whose environment variables are returned separately.
+func flagEnvironment(app *kingpin.Application, c *kingpin.ParseContext) (env map[string]string, secrets []string) {
+	given := make(map[string]bool)
+	for _, el := range c.Elements {
+		if f, ok := el.Clause.(*kingpin.FlagClause); ok {
+			given[f.Model().Name] = true
+		}
+	}
+	secret := make(map[string]bool)
+	for _, key := range lifecycled.SecretKeys() {
+		secret[key] = true
+	}
+	env = make(map[string]string)
+	for _, f := range app.Model().Flags {
+		switch f.Name {
+		case "help", "version", "config", "print-config":
+			continue
+		}
+		if f.Envar == "" || (!given[f.Name] && os.Getenv(f.Envar) == "") {
+			continue
+		}
+		key := f.Name
+		if k, ok := flagKeys[key]; ok {
+			key = k
+		}
+		if secret[key] {
+			secrets = append(secrets, f.Envar)
+			continue
+		}
+		env[f.Envar] = f.Value.String()
+	}
+	return env, secrets
+}
+
+// configSources returns where the setting of each flag came from, which is the command line,
+// the environment, the configuration file, the preset or the default, in that order of
+// precedence. Settings that are only in the configuration file are included if they are set.
+func configSources(app *kingpin.Application, c *kingpin.ParseContext, fileKeys, presetKeys []string) map[string]string {
+	sources := make(map[string]string)
+	for _, key := range presetKeys {
+		sources[key] = sourcePreset
+	}
+	for _, key := range fileKeys {
+		sources[key] = sourceFile
+	}
+
+	given := make(map[string]bool)
+	for _, el := range c.Elements {
+		if f, ok := el.Clause.(*kingpin.FlagClause); ok {
+			given[f.Model().Name] = true
+		}
+	}
+	for _, f := range app.Model().Flags {
+		switch f.Name {
+		case "help", "version", "config", "print-config":
+			continue
+		}
+		key := f.Name
+		if k, ok := flagKeys[key]; ok {
+			key = k
+		}
+		switch {
+		case given[f.Name]:
+			sources[key] = sourceFlag
+		case f.Envar != "" && os.Getenv(f.Envar) != "":
+			sources[key] = sourceEnv
+		case sources[key] == "":
+			sources[key] = sourceDefault
+		}
+	}
+	return sources
+}
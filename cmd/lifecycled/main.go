@@ -2,187 +2,1792 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/alecthomas/kingpin"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/ec2metadata"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/triarius/lifecycled"
 
-	cloudwatchlogs "github.com/kdar/logrus-cloudwatchlogs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"gopkg.in/yaml.v3"
 )
 
-var Version = "dev"
+// assumeRoleTimeout bounds assuming the role on start-up.
+const assumeRoleTimeout = 30 * time.Second
+
+// identityTimeout bounds verifying the instance identity document on start-up.
+const identityTimeout = 10 * time.Second
+
+// credentialsTimeout bounds retrieving the credentials on start-up, to log where they came from.
+const credentialsTimeout = 10 * time.Second
 
 func main() {
 	app := kingpin.New("lifecycled",
 		"Handle AWS autoscaling lifecycle events gracefully")
 
-	app.Version(Version)
+	app.Version(lifecycled.Build().String())
 	app.DefaultEnvars()
 
+	// The configuration file provides the defaults for the flags, so it is loaded
+	// before parsing to give flags and environment variables precedence over it.
+	cfg := lifecycled.DefaultConfig()
+	configFile := configPath(os.Args[1:])
+	var fileKeys []string
+	if configFile != "" {
+		if err := lifecycled.LoadConfig(configFile, cfg); err != nil {
+			app.Fatalf("%s", err)
+		}
+		var err error
+		if fileKeys, err = lifecycled.ConfigFileKeys(configFile); err != nil {
+			app.Fatalf("%s", err)
+		}
+	}
+
+	// The preset provides the defaults for the settings that are not in the file
+	preset := cfg.Preset
+	if p := earlyFlag(os.Args[1:], "preset"); p != "" {
+		preset = p
+	}
+	presetKeys, err := cfg.ApplyPreset(preset, fileKeys)
+	if err != nil {
+		app.Fatalf("%s", err)
+	}
+
 	var (
-		instanceID                   string
-		snsTopic                     string
-		disableSpotListener          bool
-		handler                      *os.File
-		jsonLogging                  bool
-		debugLogging                 bool
-		cloudwatchGroup              string
-		cloudwatchStream             string
-		spotListenerInterval         time.Duration
-		autoscalingHeartbeatInterval time.Duration
+		disableSpotListener = !cfg.SpotListener
+		exitCode            int
 	)
 
-	app.Flag("instance-id", "The instance id to listen for events for").
-		StringVar(&instanceID)
+	envFlag(app, "config", "Path to a YAML configuration file, flags and environment variables take precedence over it").
+		Default(configFile).
+		String()
 
-	app.Flag("sns-topic", "The SNS topic that receives events").
-		StringVar(&snsTopic)
+	envFlag(app, "preset", "Defaults for a deployment, which the configuration file, environment variables and flags override: spot, asg or full").
+		Default(cfg.Preset).
+		HintOptions(lifecycled.Presets...).
+		String()
 
-	app.Flag("no-spot", "Disable the spot termination listener").
+	envFlag(app, "instance-id", "The instance id to listen for events for").
+		Default(cfg.InstanceID).
+		StringVar(&cfg.InstanceID)
+
+	envFlag(app, "sns-topic", "The SNS topic that receives events").
+		Default(cfg.SNSTopic).
+		StringVar(&cfg.SNSTopic)
+
+	envFlag(app, "secondary-sns-topic", "An SNS topic in another region that the events are mirrored to, which a queue in its region is also subscribed to (repeatable)").
+		SetValue(newListValue(&cfg.SecondarySNSTopics))
+
+	envFlag(app, "no-spot", "Disable the spot termination listener").
+		Default(strconv.FormatBool(disableSpotListener)).
 		BoolVar(&disableSpotListener)
 
-	app.Flag("handler", "The script to invoke to handle events").
-		Required().
-		FileVar(&handler)
+	envFlag(app, "no-autoscaling", "Disable the autoscaling listener even if --sns-topic is set, so that no queue is created").
+		Default(strconv.FormatBool(cfg.NoAutoscaling)).
+		BoolVar(&cfg.NoAutoscaling)
 
-	app.Flag("json", "Enable JSON logging").
-		BoolVar(&jsonLogging)
+	envFlag(app, "handler", "The script to invoke to handle events, or a built-in handler such as builtin:k8s-drain").
+		Default(cfg.Handler).
+		StringVar(&cfg.Handler)
 
-	app.Flag("cloudwatch-group", "Write logs to a specific Cloudwatch Logs group").
-		StringVar(&cloudwatchGroup)
+	envDurationFlag(app, "handler-grace-period", "Time the handler is given to exit on shutdown before its process tree is killed", &cfg.HandlerGracePeriod)
 
-	app.Flag("cloudwatch-stream", "Write logs to a specific Cloudwatch Logs stream, defaults to instance-id").
-		StringVar(&cloudwatchStream)
+	envFlag(app, "kubeconfig", "Kubeconfig of the cluster for builtin:k8s-drain (defaults to $KUBECONFIG or ~/.kube/config, else the service account of the pod)").
+		Default(cfg.Kubeconfig).
+		StringVar(&cfg.Kubeconfig)
 
-	app.Flag("debug", "Show debugging info").
-		BoolVar(&debugLogging)
+	envDurationFlag(app, "drain-grace-period", "Termination grace period of the pods that builtin:k8s-drain evicts (their own if zero)", &cfg.DrainGracePeriod)
 
-	app.Flag("spot-listener-interval", "Interval to check for spot instance termination notices").
-		Default("5s").
-		DurationVar(&spotListenerInterval)
+	envDurationFlag(app, "drain-timeout", "Give up draining the node with builtin:k8s-drain after this long, failing the handler (until the deadline of the notice if zero)", &cfg.DrainTimeout)
 
-	app.Flag("autoscaling-heartbeat-interval", "Interval to send AWS Lifecycle Heartbeat Actions").
-		Default("10s").
-		DurationVar(&autoscalingHeartbeatInterval)
+	envFlag(app, "log-format", "Format of the logs, text or json").
+		Default(cfg.LogFormat).
+		EnumVar(&cfg.LogFormat, lifecycled.LogFormatText, lifecycled.LogFormatJSON)
 
-	app.Action(func(c *kingpin.ParseContext) error {
-		logger := logrus.New()
-		if jsonLogging {
-			logger.SetFormatter(&logrus.JSONFormatter{})
-		} else {
-			logger.SetFormatter(&logrus.TextFormatter{})
-		}
+	envFlag(app, "json", "Enable JSON logging, the same as --log-format=json").
+		Default(strconv.FormatBool(cfg.JSONLogging)).
+		BoolVar(&cfg.JSONLogging)
+
+	envFlag(app, "cloudwatch-group", "Write logs to a specific Cloudwatch Logs group").
+		Default(cfg.CloudwatchGroup).
+		StringVar(&cfg.CloudwatchGroup)
+
+	envFlag(app, "cloudwatch-stream", "Write logs to a specific Cloudwatch Logs stream, defaults to instance-id").
+		Default(cfg.CloudwatchStream).
+		StringVar(&cfg.CloudwatchStream)
+
+	envFlag(app, "journald", "Also write logs to journald with structured fields, or to syslog if journald is not running").
+		Default(strconv.FormatBool(cfg.Journald)).
+		BoolVar(&cfg.Journald)
+
+	envFlag(app, "log-file", "Also write logs to this file, which is reopened on SIGHUP, disabled by default").
+		Default(cfg.LogFile).
+		StringVar(&cfg.LogFile)
+
+	envInt64Flag(app, "log-file-max-size", "Rotate the log file when it would exceed this many bytes (0 to never rotate)", &cfg.LogFileMaxSize)
+	envIntFlag(app, "log-file-keep", "Number of rotated log files to keep", &cfg.LogFileKeep)
+
+	envFlag(app, "log-file-compress", "Compress rotated log files with gzip").
+		Default(strconv.FormatBool(cfg.LogFileCompress)).
+		BoolVar(&cfg.LogFileCompress)
+
+	envFlag(app, "debug", "Show debugging info").
+		Default(strconv.FormatBool(cfg.DebugLogging)).
+		BoolVar(&cfg.DebugLogging)
+
+	if cfg.LogLevels == nil {
+		cfg.LogLevels = make(map[string]string)
+	}
+	envFlag(app, "log-level", "Log level of a component, e.g. queue=debug, which defaults to the global level (repeatable)").
+		SetValue(mapValue(cfg.LogLevels))
+
+	envDurationFlag(app, "spot-listener-interval", "Interval to check for spot instance termination notices", &cfg.SpotListenerInterval)
+
+	envDurationFlag(app, "autoscaling-heartbeat-interval", "Interval to send AWS Lifecycle Heartbeat Actions (half the lifecycle hook's heartbeat timeout if zero)", &cfg.AutoscalingHeartbeatInterval)
+
+	envDurationFlag(app, "autoscaling-heartbeat-jitter", "Send each heartbeat up to this much earlier than scheduled, to spread heartbeats across instances", &cfg.AutoscalingHeartbeatJitter)
+
+	envIntFlag(app, "autoscaling-rate-limit", "Limit the calls to the autoscaling API, shared by all heartbeats and completions, to this many per second (unlimited if zero)", &cfg.AutoscalingRateLimit)
+
+	envIntFlag(app, "autoscaling-rate-burst", "Burst of calls to the autoscaling API that the rate limit allows (defaults to the calls of one second)", &cfg.AutoscalingRateBurst)
+
+	envDurationFlag(app, "poll-summary-interval", "Interval to log a summary of the polls of the sqs queue", &cfg.PollSummaryInterval)
+
+	envDurationFlag(app, "poll-failure-threshold", "Log an error and report unhealthy when a listener has not polled successfully for this long (disabled if zero)", &cfg.PollFailureThreshold)
+	envDurationFlag(app, "poll-idle-after", "Poll the queue at full speed for this long after starting and after any message, before stretching the gaps between polls", &cfg.PollIdleAfter)
+	envDurationFlag(app, "poll-max-idle-gap", "The longest gap between polls of the queue while it is idle (adaptive polling is disabled if zero)", &cfg.PollMaxIdleGap)
+	envDurationFlag(app, "iam-propagation-timeout", "Retry subscribing and polling the queue when they are denied for this long after starting, while the role and queue policy propagate (disabled if zero)", &cfg.IAMPropagationTimeout)
+	envDurationFlag(app, "clock-skew-tolerance", "The skew between the clocks of AWS and the instance that is expected, beyond which a warning is logged, and that is added to stale-message-age", &cfg.ClockSkewTolerance)
+	envDurationFlag(app, "stale-message-age", "Discard autoscaling messages whose lifecycle hook fired longer ago than this, e.g. that were left in a retained queue (disabled if zero)", &cfg.StaleMessageAge)
+
+	envDurationFlag(app, "handler-start-threshold", "Log a warning when the handler starts later than this after the lifecycle hook fired (disabled if zero)", &cfg.HandlerStartThreshold)
+
+	envDurationFlag(app, "dedup-window", "Keep listening this long after handling a notice, to coalesce duplicate notices (e.g. spot and autoscaling) for the same termination", &cfg.DedupWindow)
+
+	envFlag(app, "verify-termination", "Verify that the instance is terminating before executing the handler for autoscaling notices (requires autoscaling:DescribeAutoScalingInstances)").
+		Default(strconv.FormatBool(cfg.VerifyTermination)).
+		BoolVar(&cfg.VerifyTermination)
+
+	envFlag(app, "verify-signatures", "Verify the SNS signatures of the autoscaling messages, and reject the messages that fail").
+		Default(strconv.FormatBool(cfg.VerifySignatures)).
+		BoolVar(&cfg.VerifySignatures)
+
+	envFlag(app, "require-identity-signature", "Exit if the signature of the instance identity document can't be verified when the instance id is looked up, rather than logging a warning").
+		Default(strconv.FormatBool(cfg.RequireIdentitySignature)).
+		BoolVar(&cfg.RequireIdentitySignature)
+
+	envFlag(app, "identity-certificates-file", "A PEM file of the AWS certificates that verify the signature of the instance identity document, in addition to those that are bundled").
+		Default(cfg.IdentityCertificatesFile).
+		StringVar(&cfg.IdentityCertificatesFile)
+
+	envFlag(app, "self-check", "Check the AWS permissions of the autoscaling listener when it starts, with calls that have no side effects, and report unhealthy if any are denied").
+		Default(strconv.FormatBool(cfg.SelfCheck)).
+		BoolVar(&cfg.SelfCheck)
+
+	envFlag(app, "delivery-check", "Publish a test notification for the instance to the topic when the autoscaling listener starts, and report unhealthy if it isn't delivered to the queue (requires sns:Publish)").
+		Default(strconv.FormatBool(cfg.DeliveryCheck)).
+		BoolVar(&cfg.DeliveryCheck)
+
+	envIntFlag(app, "handler-concurrency", "Number of handlers that may run at once, notices wait for their turn while heartbeats are sent", &cfg.HandlerConcurrency)
+
+	envIntFlag(app, "listener-restarts", "Number of times a failed listener is restarted before the daemon exits", &cfg.ListenerRestarts)
+
+	envDurationFlag(app, "listener-restart-backoff", "Initial backoff before restarting a failed listener, doubled on each restart", &cfg.ListenerRestartBackoff)
+
+	envFlag(app, "complete", "When to complete the lifecycle action: always, on-success (of the handler) or never (another system completes it)").
+		Default(cfg.Complete).
+		EnumVar(&cfg.Complete, lifecycled.CompleteAlways, lifecycled.CompleteOnSuccess, lifecycled.CompleteNever)
+
+	envDurationFlag(app, "completion-delay", "Time to wait after the handler has returned before completing the lifecycle action, while heartbeats continue", &cfg.CompletionDelay)
+
+	envDurationFlag(app, "max-heartbeat-duration", "Stop heartbeating, cancel the handler and complete the lifecycle action with the timeout result after this long", &cfg.MaxHeartbeatDuration)
+
+	envFlag(app, "timeout-result", "Lifecycle action result to send if the maximum heartbeat duration is reached").
+		Default(cfg.TimeoutResult).
+		EnumVar(&cfg.TimeoutResult, lifecycled.ResultContinue, lifecycled.ResultAbandon)
+
+	envFlag(app, "checkpoint-dir", "Keep a checkpoint of lifecycle actions in progress in this directory, to recover them if lifecycled crashes").
+		Default(cfg.CheckpointDir).
+		StringVar(&cfg.CheckpointDir)
+
+	envFlag(app, "quarantine-dir", "Write SQS messages that fail to parse to this directory for inspection, with the action tokens masked").
+		Default(cfg.QuarantineDir).
+		StringVar(&cfg.QuarantineDir)
+
+	envIntFlag(app, "quarantine-keep", "Number of quarantined messages to keep, removing the oldest (unlimited if zero)", &cfg.QuarantineKeep)
+
+	envFlag(app, "recover-handler", "Whether to rerun or skip the handler for a lifecycle action recovered from a checkpoint").
+		Default(cfg.RecoverHandler).
+		EnumVar(&cfg.RecoverHandler, lifecycled.RecoverRerun, lifecycled.RecoverSkip)
+
+	envFlag(app, "cancel-on-lost-action", "Cancel the handler if the lifecycle action is completed by another actor or times out").
+		Default(strconv.FormatBool(cfg.CancelOnLostAction)).
+		BoolVar(&cfg.CancelOnLostAction)
+
+	envFlag(app, "completion-topic", "Publish a JSON completion event to this SNS topic after each notice has been handled").
+		Default(cfg.CompletionTopic).
+		StringVar(&cfg.CompletionTopic)
+
+	envFlag(app, "completion-webhook", "Post a JSON completion event to this HTTPS endpoint after each notice has been handled").
+		Default(cfg.CompletionWebhook).
+		StringVar(&cfg.CompletionWebhook)
+
+	// No default, so that a token from the configuration file is not shown in the usage
+	envFlag(app, "notify-webhook", "Post a notification to this HTTPS endpoint, e.g. a Slack incoming webhook, when a notice is received and handled").
+		PlaceHolder("URL").
+		StringVar(&cfg.NotifyWebhook)
+
+	envFlag(app, "notify-webhook-file", "Read --notify-webhook from this file on start-up and on SIGHUP, so that it isn't shown by ps").
+		Default(cfg.NotifyWebhookFile).
+		StringVar(&cfg.NotifyWebhookFile)
+
+	envFlag(app, "notify-format", "Format of the notifications, json or slack").
+		Default(cfg.NotifyFormat).
+		EnumVar(&cfg.NotifyFormat, lifecycled.NotifyFormatJSON, lifecycled.NotifyFormatSlack)
+
+	envFlag(app, "notify-on-received", "Send a notification when a notice is received").
+		Default(strconv.FormatBool(cfg.NotifyOnReceived)).
+		BoolVar(&cfg.NotifyOnReceived)
+
+	envFlag(app, "notify-on-failure", "Send a notification when the handler fails").
+		Default(strconv.FormatBool(cfg.NotifyOnFailure)).
+		BoolVar(&cfg.NotifyOnFailure)
+
+	envFlag(app, "notify-on-completion", "Send a notification when a notice has been handled").
+		Default(strconv.FormatBool(cfg.NotifyOnCompletion)).
+		BoolVar(&cfg.NotifyOnCompletion)
+
+	envFlag(app, "notify-on-poll-failure", "Send a notification when a listener crosses the poll failure threshold, and when it recovers").
+		Default(strconv.FormatBool(cfg.NotifyOnPollFailure)).
+		BoolVar(&cfg.NotifyOnPollFailure)
+
+	envDurationFlag(app, "notify-timeout", "Time allowed to send each notification", &cfg.NotifyTimeout)
+
+	envFlag(app, "completion-webhook-token", "Bearer token to authenticate to the completion webhook").
+		PlaceHolder("TOKEN").
+		StringVar(&cfg.CompletionWebhookToken)
+
+	envFlag(app, "completion-webhook-token-file", "Read --completion-webhook-token from this file on start-up and on SIGHUP, so that it isn't shown by ps").
+		Default(cfg.CompletionWebhookTokenFile).
+		StringVar(&cfg.CompletionWebhookTokenFile)
+
+	envFlag(app, "audit-file", "Append a JSON record of each notice that is handled to this file, disabled by default").
+		Default(cfg.AuditFile).
+		StringVar(&cfg.AuditFile)
+
+	envInt64Flag(app, "audit-file-max-size", "Rotate the audit file when it would exceed this many bytes (0 to never rotate)", &cfg.AuditFileMaxSize)
+
+	envIntFlag(app, "audit-file-keep", "Number of rotated audit files to keep", &cfg.AuditFileKeep)
+
+	envDurationFlag(app, "shutdown-timeout", "Time allowed for completing lifecycle actions and deleting the queue once shutdown has started", &cfg.ShutdownTimeout)
+
+	envFlag(app, "no-cleanup", "Retain the sqs queue and sns subscription on exit, and reattach to them on the next start").
+		Default(strconv.FormatBool(cfg.NoCleanup)).
+		BoolVar(&cfg.NoCleanup)
+
+	envFlag(app, "shutdown-policy", "Whether to continue, abandon or leave lifecycle actions that are in progress when lifecycled shuts down").
+		Default(cfg.ShutdownPolicy).
+		EnumVar(&cfg.ShutdownPolicy, lifecycled.ShutdownContinue, lifecycled.ShutdownAbandon, lifecycled.ShutdownLeave)
+
+	envFlag(app, "panic-result", "Lifecycle action result to send if handling a notice panics").
+		Default(cfg.PanicResult).
+		EnumVar(&cfg.PanicResult, lifecycled.ResultContinue, lifecycled.ResultAbandon)
+
+	envFlag(app, "health-address", "Serve /healthz and /status on this address (e.g. localhost:9090), disabled by default").
+		Default(cfg.HealthAddress).
+		StringVar(&cfg.HealthAddress)
+
+	envDurationFlag(app, "health-threshold", "Report unhealthy if a listener has not polled successfully within this duration", &cfg.HealthThreshold)
+
+	envFlag(app, "debug-vars", "Serve the internal counters as JSON on /debug/vars of the health server").
+		Default(strconv.FormatBool(cfg.DebugVars)).
+		BoolVar(&cfg.DebugVars)
+
+	envFlag(app, "pprof", "Serve the Go profiles on /debug/pprof/ of the health server").
+		Default(strconv.FormatBool(cfg.Pprof)).
+		BoolVar(&cfg.Pprof)
+
+	envFlag(app, "metrics-address", "Serve Prometheus metrics on /metrics at this address, which can be the health-address, disabled by default").
+		Default(cfg.MetricsAddress).
+		StringVar(&cfg.MetricsAddress)
+
+	envFlag(app, "statsd-address", "Send metrics to the statsd agent at this UDP address, e.g. localhost:8125").
+		Default(cfg.StatsdAddress).
+		StringVar(&cfg.StatsdAddress)
+
+	envFlag(app, "statsd-tag", "DogStatsD tag to add to the statsd metrics, e.g. env:production (repeatable)").
+		SetValue(newListValue(&cfg.StatsdTags))
+
+	envFlag(app, "statsd-tags-file", "Read more statsd tags from this file, one per line, on start-up and on SIGHUP, which are redacted like secrets, e.g. for tags with api keys").
+		Default(cfg.StatsdTagsFile).
+		StringVar(&cfg.StatsdTagsFile)
+
+	envFlag(app, "instance-tag", "Name of an EC2 tag of the instance to add to the logs and export to handlers as LIFECYCLED_TAG_<NAME> (repeatable)").
+		SetValue(newListValue(&cfg.InstanceTags))
+
+	envFlag(app, "tracing", "Export a trace of each notice with OTLP over HTTP, configured by the OTEL_EXPORTER_OTLP_* environment variables").
+		Default(strconv.FormatBool(cfg.Tracing)).
+		BoolVar(&cfg.Tracing)
+
+	envFlag(app, "cloudwatch-metrics-namespace", "Publish the metrics of each notice to CloudWatch in this namespace, disabled by default").
+		Default(cfg.CloudwatchMetricsNamespace).
+		StringVar(&cfg.CloudwatchMetricsNamespace)
+
+	envFlag(app, "assume-role", "ARN of an IAM role to assume with STS for the AWS API calls, e.g. a drain role with the autoscaling permissions").
+		Default(cfg.AssumeRole).
+		StringVar(&cfg.AssumeRole)
+
+	envFlag(app, "assume-role-external-id", "External ID to assume the role with, if its trust policy requires one").
+		Default(cfg.AssumeRoleExternalID).
+		StringVar(&cfg.AssumeRoleExternalID)
+
+	envFlag(app, "assume-role-session-name", "Session name to assume the role with (defaults to lifecycled-<instance id>)").
+		Default(cfg.AssumeRoleSessionName).
+		StringVar(&cfg.AssumeRoleSessionName)
+
+	envFlag(app, "web-identity-token-file", "File with the OIDC token of a web identity to assume web-identity-role with, e.g. of the service account of a container (defaults to AWS_WEB_IDENTITY_TOKEN_FILE)").
+		Default(cfg.WebIdentityTokenFile).
+		StringVar(&cfg.WebIdentityTokenFile)
+
+	envFlag(app, "web-identity-role", "ARN of the IAM role to assume with the web identity token (defaults to AWS_ROLE_ARN)").
+		Default(cfg.WebIdentityRole).
+		StringVar(&cfg.WebIdentityRole)
+
+	envFlag(app, "sts-regional-endpoints", "Call STS at the endpoint of the region (regional) or at the global endpoint sts.amazonaws.com (legacy)").
+		Default(cfg.STSRegionalEndpoints).
+		EnumVar(&cfg.STSRegionalEndpoints, lifecycled.STSRegional, lifecycled.STSLegacy)
+
+	envFlag(app, "region", "AWS region of the API calls, which takes precedence over AWS_REGION and the region of the instance").
+		Default(cfg.Region).
+		StringVar(&cfg.Region)
+
+	if cfg.Endpoints == nil {
+		cfg.Endpoints = make(map[string]string)
+	}
+	envFlag(app, "endpoint", "Endpoint of an AWS service, e.g. sqs=https://vpce-0123.sqs.us-east-1.vpce.amazonaws.com (repeatable)").
+		SetValue(mapValue(cfg.Endpoints))
+
+	envFlag(app, "fips", "Use the FIPS endpoints of the AWS APIs, other than the endpoints that are overridden").
+		Default(strconv.FormatBool(cfg.FIPS)).
+		BoolVar(&cfg.FIPS)
+
+	envFlag(app, "imds-proxy", "Send the requests to the instance metadata service through the proxy of HTTP_PROXY and HTTPS_PROXY, rather than directly").
+		Default(strconv.FormatBool(cfg.IMDSProxy)).
+		BoolVar(&cfg.IMDSProxy)
+
+	if cfg.Tags == nil {
+		cfg.Tags = make(map[string]string)
+	}
+	envFlag(app, "tag", "Tag to add to the AWS resources that lifecycled creates (the SQS queue and CloudWatch Logs group), e.g. Team=platform (repeatable)").
+		SetValue(mapValue(cfg.Tags))
+
+	envFlag(app, "aws-profile", "Named profile of the shared AWS configuration and credentials files to use for the AWS API calls").
+		Default(cfg.AWSProfile).
+		StringVar(&cfg.AWSProfile)
 
-		if debugLogging {
-			logger.SetLevel(logrus.DebugLevel)
+	envDurationFlag(app, "aws-connect-timeout", "Time allowed to connect to the AWS APIs, including the TLS handshake", &cfg.AWSConnectTimeout)
+	envDurationFlag(app, "aws-call-timeout", "Time allowed for each attempt of an AWS API call, on top of the wait time of the long-polls of the queue", &cfg.AWSCallTimeout)
+	envDurationFlag(app, "aws-heartbeat-timeout", "Time allowed for each attempt of a lifecycle action heartbeat", &cfg.AWSHeartbeatTimeout)
+
+	envFlag(app, "state-file", "Write the daemon status as JSON to this file on every change, disabled by default").
+		Default(cfg.StateFile).
+		StringVar(&cfg.StateFile)
+
+	envDurationFlag(app, "state-file-interval", "Interval to update the state file when nothing has changed, a stale file means lifecycled is not running", &cfg.StateFileInterval)
+
+	envFlag(app, "pretty", "Show a live status on stdout when it is a terminal, e.g. when running lifecycled by hand, while the logs are written to the other destinations").
+		Default(strconv.FormatBool(cfg.Pretty)).
+		BoolVar(&cfg.Pretty)
+
+	var printConfig bool
+	envFlag(app, "print-config", "Print the effective configuration as JSON once the instance id and region are resolved, and exit").
+		BoolVar(&printConfig)
+
+	// The handler and its own arguments can be given after --, e.g. -- /usr/local/bin/drain --fast
+	args, handlerArgv := splitHandlerArgv(os.Args[1:])
+
+	app.PreAction(func(c *kingpin.ParseContext) error {
+		cfg.SpotListener = !disableSpotListener
+		if len(handlerArgv) > 0 {
+			if flagGiven(c, app, "handler") {
+				return errors.New("--handler and a handler after -- are mutually exclusive")
+			}
+			cfg.Handler, cfg.HandlerArgs = handlerArgv[0], handlerArgv[1:]
 		}
+		return nil
+	})
 
-		region := os.Getenv("AWS_REGION")
-		if region == "" {
-			logger.Info("Looking up region from metadata service")
-			sess, err := session.NewSession()
-			if err != nil {
-				logger.WithError(err).Fatal("Failed to create new aws session")
+	app.Command("run", "Run the daemon (default)").
+		Default().
+		Action(func(c *kingpin.ParseContext) error {
+			if err := cfg.Validate(); err != nil {
+				return err
 			}
-			region, err = ec2metadata.New(sess).Region()
-			if err != nil {
-				logger.WithError(err).Fatal("Failed to look up region")
+			sources := configSources(app, c, fileKeys, presetKeys)
+			if len(handlerArgv) > 0 {
+				sources["handler"], sources["handler-args"] = sourceFlag, sourceFlag
+			}
+			exitCode = run(cfg, configFile, sources, printConfig)
+			return nil
+		})
+
+	replayCmd := app.Command("replay", "Handle a captured autoscaling termination message from a file, for debugging")
+	replayFile := replayCmd.Arg("file", "JSON file with the SNS envelope or the lifecycle hook message").Required().ExistingFile()
+	replayHeartbeats := replayCmd.Flag("heartbeats", "Send lifecycle action heartbeats while the handler executes (--no-heartbeats to disable)").Default("true").Bool()
+	replayCompletion := replayCmd.Flag("completion", "Complete the lifecycle action after the handler exits (--no-completion to disable)").Default("true").Bool()
+	replayCmd.Action(func(c *kingpin.ParseContext) error {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		exitCode = replay(cfg, *replayFile, lifecycled.ReplayOptions{
+			SkipHeartbeats: !*replayHeartbeats,
+			SkipCompletion: !*replayCompletion,
+		})
+		return nil
+	})
+
+	simulateCmd := app.Command("simulate", "Handle a synthetic autoscaling notice with the handler, without calling AWS, for testing handlers")
+	simulateFile := simulateCmd.Flag("message", "JSON file with the SNS envelope or the lifecycle hook message to start from").ExistingFile()
+	simulate := lifecycled.Message{}
+	simulateCmd.Flag("transition", "Lifecycle transition of the message").Default("autoscaling:EC2_INSTANCE_TERMINATING").StringVar(&simulate.Transition)
+	simulateCmd.Flag("group", "Autoscaling group name of the message").StringVar(&simulate.GroupName)
+	simulateCmd.Flag("hook", "Lifecycle hook name of the message").StringVar(&simulate.HookName)
+	simulateCmd.Flag("token", "Lifecycle action token of the message").StringVar(&simulate.ActionToken)
+	simulateCmd.Flag("notification-metadata", "Notification metadata of the lifecycle hook").StringVar(&simulate.NotificationMetadata)
+	simulateCmd.Action(func(c *kingpin.ParseContext) error {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		given := make(map[string]bool)
+		for _, el := range c.Elements {
+			if f, ok := el.Clause.(*kingpin.FlagClause); ok {
+				given[f.Model().Name] = true
 			}
 		}
+		exitCode = simulateNotice(cfg, *simulateFile, simulate, given)
+		return nil
+	})
+
+	sendTestCmd := app.Command("send-test", "Publish a test message to the topic, and optionally wait for a running daemon to receive it")
+	sendTestKind := sendTestCmd.Flag("kind", "Kind of test message: a termination marked as a test, or the shape of an autoscaling test notification").
+		Default(lifecycled.TestTermination).
+		Enum(lifecycled.TestTermination, lifecycled.TestNotification)
+	var sendTestWait time.Duration
+	sendTestCmd.Flag("wait", "Wait this long for the daemon to receive the message, on its status endpoint or state file (0 to not wait)").
+		Default("0s").
+		SetValue(&durationValue{flag: "wait", d: &sendTestWait})
+	sendTestStatusURL := sendTestCmd.Flag("status-url", "Status endpoint of the daemon to wait on, defaults to that of --health-address, or else the --state-file is read").String()
+	sendTestCmd.Action(func(c *kingpin.ParseContext) error {
+		exitCode = sendTest(cfg, *sendTestKind, sendTestWait, *sendTestStatusURL)
+		return nil
+	})
+
+	queues := app.Command("queues", "List and prune the lifecycled queues in the account and region")
+	queuesRate := queues.Flag("rate", "Maximum number of API requests per second").Default(strconv.Itoa(lifecycled.DefaultQueueAPIRate)).Int()
+	queuesOutput := outputFlag(queues)
+	queues.Command("list", "List the queues with their instance, instance state, age and message counts").
+		Action(func(c *kingpin.ParseContext) error {
+			exitCode = listQueues(cfg, *queuesRate, *queuesOutput)
+			return nil
+		})
+	prune := queues.Command("prune", "Delete the queues of instances that are no longer running")
+	var pruneOptions lifecycled.PruneOptions
+	prune.Flag("older-than", "Only delete queues that are older than this").Default("24h").SetValue(&durationValue{flag: "older-than", d: &pruneOptions.OlderThan})
+	prune.Flag("dry-run", "Print the queues that would be deleted without deleting them").BoolVar(&pruneOptions.DryRun)
+	prune.Flag("force", "Also delete the queues of instances that are still running").BoolVar(&pruneOptions.Force)
+	prune.Action(func(c *kingpin.ParseContext) error {
+		pruneOptions.Rate = *queuesRate
+		exitCode = pruneQueues(cfg, pruneOptions, *queuesOutput)
+		return nil
+	})
+
+	app.Command("exit-codes", "Print the exit codes of the daemon and their outcomes as JSON").
+		Action(func(c *kingpin.ParseContext) error {
+			exitCode = printJSON(lifecycled.ExitCodes)
+			return nil
+		})
 
-		sess, err := session.NewSession(&aws.Config{
-			Region: aws.String(region),
+	app.Command("iam-policy", "Print the minimal IAM policy for the configuration as JSON").
+		Action(func(c *kingpin.ParseContext) error {
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(lifecycled.IAMPolicy(cfg))
 		})
+
+	systemdUnitCmd := app.Command("systemd-unit", "Print a systemd unit for the configuration, or with --drop-in a drop-in with the settings of the flags and environment variables")
+	systemdUnitExec := systemdUnitCmd.Flag("exec", "Path of lifecycled in the unit, defaults to the path of this executable").String()
+	systemdUnitDropIn := systemdUnitCmd.Flag("drop-in", "Print the drop-in, e.g. for /etc/systemd/system/lifecycled.service.d/environment.conf, instead of the unit").Bool()
+	systemdUnitCmd.Action(func(c *kingpin.ParseContext) error {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		env, secrets := flagEnvironment(app, c)
+		if *systemdUnitDropIn {
+			for _, name := range secrets {
+				fmt.Fprintf(os.Stderr, "Omitted %s from the drop-in since it is a secret, set it in a protected EnvironmentFile\n", name)
+			}
+			fmt.Print(lifecycled.SystemdDropIn(env))
+			return nil
+		}
+		command, err := systemdCommand(*systemdUnitExec, configFile, handlerArgv)
 		if err != nil {
-			logger.WithError(err).Fatal("Failed to create new aws session")
+			return err
+		}
+		if len(env) > 0 || len(secrets) > 0 {
+			fmt.Fprintf(os.Stderr, "The unit doesn't include the settings of flags and environment variables, add them with --drop-in\n")
 		}
+		fmt.Print(lifecycled.SystemdUnit(cfg, command))
+		return nil
+	})
 
-		if instanceID == "" {
-			logger.Info("Looking up instance id from metadata service")
-			instanceID, err = ec2metadata.New(sess).GetMetadata("instance-id")
-			if err != nil {
-				logger.WithError(err).Fatal("Failed to lookup instance id")
+	validateCmd := app.Command("validate", "Check the configuration, permissions and environment before deploying, and exit non-zero if a check fails")
+	validateOutput := outputFlag(validateCmd)
+	validateCmd.Action(func(c *kingpin.ParseContext) error {
+		exitCode = validate(cfg, *validateOutput)
+		return nil
+	})
+
+	completion := app.Command("completion", "Print the shell completion script for bash, zsh or fish, e.g. source <(lifecycled completion bash)")
+	completionShell := completion.Arg("shell", "Shell to complete lifecycled in").Required().HintOptions("bash", "zsh", "fish").Enum("bash", "zsh", "fish")
+	completion.Action(func(c *kingpin.ParseContext) error {
+		return completionScript(app, c, *completionShell)
+	})
+
+	config := app.Command("config", "Inspect the configuration")
+	config.Command("validate", "Validate the configuration and print the effective configuration").
+		Action(func(c *kingpin.ParseContext) error {
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+			enc := yaml.NewEncoder(os.Stdout)
+			enc.SetIndent(2)
+			if err := enc.Encode(cfg.Redacted()); err != nil {
+				return err
 			}
+			return enc.Close()
+		})
+
+	configDiff := config.Command("diff", "Validate the configuration and print the settings that differ from those of the running daemon")
+	configDiffURL := configDiff.Flag("config-url", "Config endpoint of the running daemon, defaults to /config of --health-address, or else the --state-file is read").String()
+	configDiffOutput := outputFlag(configDiff)
+	configDiff.Action(func(c *kingpin.ParseContext) error {
+		// --state-file selects the daemon, rather than being a change
+		var ignore []string
+		if flagGiven(c, app, "state-file") {
+			ignore = append(ignore, "state-file")
 		}
+		exitCode = diffConfig(cfg, *configDiffURL, ignore, *configDiffOutput)
+		return nil
+	})
+
+	kingpin.MustParse(app.Parse(args))
+	os.Exit(exitCode)
+}
+
+// configPath finds the configuration file in the arguments or environment, since
+// it has to be loaded before the flags are parsed.
+func configPath(args []string) string {
+	return earlyFlag(args, "config")
+}
 
-		if cloudwatchStream == "" {
-			cloudwatchStream = instanceID
+// earlyFlag finds the value of the flag in the arguments or its environment variable, for the
+// flags that are needed before the flags are parsed.
+func earlyFlag(args []string, name string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
 		}
+		if arg == "--"+name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			return strings.TrimPrefix(arg, "--"+name+"=")
+		}
+	}
+	return os.Getenv(envarName(name))
+}
 
-		if cloudwatchGroup != "" {
-			hook, err := cloudwatchlogs.NewHook(cloudwatchGroup, cloudwatchStream, sess)
-			if err != nil {
-				logger.Fatal(err)
+// run the daemon until a termination notice has been handled or it is
+// interrupted, and return the exit code. The log levels are reloaded from the
+// configuration file (if any) on SIGHUP. With printConfig, it prints the start-up
+// information and exits once the instance id and region have been resolved.
+func run(cfg *lifecycled.Config, configFile string, sources map[string]string, printConfig bool) (exitCode int) {
+	logger := newLogger(cfg)
+	// Failures to start the daemon are fatal (see lifecycled.ExitCodes)
+	logger.ExitFunc = func(int) { os.Exit(lifecycled.ExitSetupFailed) }
+
+	// The status display is drawn on stdout, and the logs and the output of handlers would
+	// break it if stderr is the same terminal, so they are only written to the other destinations
+	var stderr io.Writer = os.Stderr
+	width, pretty := terminalWidth(os.Stdout)
+	pretty = pretty && cfg.Pretty && !printConfig
+	if cfg.Pretty && !pretty && !printConfig {
+		logger.Info("Not showing the status, stdout is not a terminal")
+	}
+	if _, ok := terminalWidth(os.Stderr); pretty && ok {
+		stderr = ioutil.Discard
+		logger.SetOutput(stderr)
+	}
+
+	var logFile *lifecycled.LogFile
+	if cfg.LogFile != "" && !printConfig {
+		var err error
+		if logFile, err = lifecycled.OpenLogFile(cfg.LogFile, cfg.LogFileMaxSize, cfg.LogFileKeep, cfg.LogFileCompress); err != nil {
+			logger.WithError(err).Fatal("Failed to open log file")
+		}
+		// Sync the last entries, e.g. the summary of the notice, to disk on exit, including
+		// when exiting on a fatal error
+		defer closeLogFile(logFile)
+		logrus.RegisterExitHandler(func() { closeLogFile(logFile) })
+		logger.SetOutput(io.MultiWriter(stderr, logFile))
+	}
+	// The clients share the AWS configuration, so that they have the same region and credentials
+	awsCfg, regionSource := newAWSConfig(cfg, logger)
+	clients := lifecycled.NewClients(awsCfg, cfg)
+	if regionSource != lifecycled.RegionSourceConfig {
+		sources["region"] = regionSource
+	}
+	if err := cfg.ValidateRegion(cfg.Region); err != nil {
+		logger.WithError(err).Error("Invalid configuration")
+		return lifecycled.ExitInvalidConfig
+	}
+	if err := loadSecretFiles(cfg, logger); err != nil {
+		logger.WithError(err).Error("Invalid configuration")
+		return lifecycled.ExitInvalidConfig
+	}
+	// The secrets that were read from files have the source of their -file settings
+	for _, key := range lifecycled.SecretKeys() {
+		if source := sources[key+"-file"]; source != "" && source != sourceDefault {
+			sources[key] = source
+		}
+	}
+
+	var err error
+	if cfg.InstanceID == "" {
+		logger.Info("Looking up instance id from metadata service")
+		cfg.InstanceID, err = lookupInstanceID(clients.Metadata)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to lookup instance id")
+		}
+		sources["instance-id"] = sourceMetadata
+		verifyIdentity(cfg, clients.Metadata, logger)
+	}
+
+	if cfg.CloudwatchStream == "" {
+		cfg.CloudwatchStream = cfg.InstanceID
+	}
+
+	startup, err := lifecycled.NewStartupInfo(cfg, lifecycled.Build(), cfg.Region)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to describe the configuration")
+	}
+	startup.Sources = sources
+	if printConfig {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(startup); err != nil {
+			logger.WithError(err).Fatal("Failed to print the configuration")
+		}
+		return 0
+	}
+	assumeRole(cfg, awsCfg, logger)
+	startup.Credentials = credentialSource(awsCfg, logger)
+
+	// The output of handlers is logged when the logs are JSON, and otherwise sent as is
+	var output io.Writer
+	if logFile != nil && !jsonLogging(cfg) {
+		output = io.MultiWriter(stderr, logFile)
+	}
+	if cfg.CloudwatchGroup != "" {
+		hook, err := lifecycled.NewCloudWatchLogsHook(clients.CloudWatchLogs, cfg.CloudwatchGroup, cfg.CloudwatchStream, cfg.Tags, 0)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to create CloudWatch Logs stream")
+		}
+		// Send the last batch on exit, including when exiting on a fatal error
+		defer hook.Close()
+		logrus.RegisterExitHandler(func() { _ = hook.Close() })
+
+		// Handler output is sent to the same stream as the logs, which already
+		// includes it when it is logged as JSON
+		if !jsonLogging(cfg) {
+			if output == nil {
+				output = stderr
 			}
+			output = io.MultiWriter(output, hook)
+		}
 
-			logger.WithFields(logrus.Fields{
-				"group":  cloudwatchGroup,
-				"stream": cloudwatchStream,
-			}).Info("Writing logs to CloudWatch")
+		logger.WithFields(logrus.Fields{
+			"group":  cfg.CloudwatchGroup,
+			"stream": cfg.CloudwatchStream,
+		}).Info("Writing logs to CloudWatch")
 
-			logger.AddHook(hook)
-			if !jsonLogging {
-				logger.SetFormatter(&logrus.TextFormatter{
-					DisableColors:    true,
-					DisableTimestamp: true,
-				})
+		logger.AddHook(hook)
+		if !jsonLogging(cfg) {
+			logger.SetFormatter(&logrus.TextFormatter{
+				DisableColors:    true,
+				DisableTimestamp: true,
+			})
+		}
+	}
+
+	if cfg.Journald {
+		hook, err := lifecycled.NewJournalHook("lifecycled", "", "")
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to connect to journald or syslog")
+		}
+		defer hook.Close()
+
+		// The output of handlers is logged when the logs are JSON, and otherwise sent as is
+		if !jsonLogging(cfg) {
+			if output == nil {
+				output = stderr
 			}
+			output = io.MultiWriter(output, hook)
 		}
 
-		sigs := make(chan os.Signal)
-		defer close(sigs)
+		logger.AddHook(hook)
+		log := logger.WithField("socket", hook.Socket())
+		if hook.Native() {
+			log.Info("Writing logs to journald")
+		} else {
+			log.Info("Writing logs to syslog, journald is not available")
+		}
+	}
 
-		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-		defer signal.Stop(sigs)
+	logger.WithFields(startup.Fields()).Info("Starting lifecycled")
+	if cfg.NoCleanup && cfg.SNSTopic != "" && !cfg.NoAutoscaling {
+		logger.WithField("queue", "lifecycled-"+cfg.InstanceID).Warn("Cleanup is disabled: the sqs queue and sns subscription are retained on exit, prune them with 'lifecycled queues prune'")
+	}
 
-		// Create an execution context for the daemon that can be cancelled on OS signal
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
+	// Create an execution context for the daemon that can be cancelled on OS signal
+	ctx, shutdown := lifecycled.WithShutdown(context.Background())
+	defer shutdown("lifecycled exited")
 
-		go func() {
-			for sig := range sigs {
-				logger.WithField("signal", sig.String()).Info("Received signal: shutting down...")
-				cancel()
-				break
+	defer shutdownOnSignal(shutdown, logger)()
+
+	serviceStopped := handleServiceStop(func() { shutdown("service stopped") }, logger)
+	defer serviceStopped()
+
+	notifier := lifecycled.NewSystemdNotifier()
+	notify := func(state string) {
+		if err := notifier.Notify(state); err != nil {
+			logger.WithError(err).Warn("Failed to send systemd notification")
+		}
+	}
+	defer notify("STOPPING=1")
+
+	if cfg.Tracing {
+		tp, err := newTracerProvider(cfg)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to configure tracing")
+		}
+		// Export the remaining spans on exit, which is bounded like the other calls during shutdown
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+			if err := tp.Shutdown(ctx); err != nil {
+				logger.WithError(err).Warn("Failed to export traces")
 			}
 		}()
+		cfg.TracerProvider = tp
+	}
+
+	daemon := lifecycled.NewWithClients(cfg, clients, logger)
+	if out := handlerOutput(cfg, daemon.ComponentLogger(lifecycled.LogComponentHandler)); out != nil {
+		output = out
+	}
+	var display *lifecycled.StatusDisplay
+	if pretty {
+		display = lifecycled.NewStatusDisplay(daemon, os.Stdout, width)
+		logger.AddHook(display)
+		if output == nil {
+			output = stderr
+		}
+		output = io.MultiWriter(output, display)
+	}
+	logLevels(logger.WithField("instanceId", cfg.InstanceID), daemon)
+	defer reloadOnSignal(cfg, configFile, logFile, daemon, logger.WithField("instanceId", cfg.InstanceID))()
+	handler := configureHandlers(cfg, daemon, notify, output, logger)
+	defer dumpOnSignal(daemon, logger.WithField("instanceId", cfg.InstanceID))()
 
-		handler := lifecycled.NewFileHandler(handler)
-		daemon := lifecycled.New(&lifecycled.Config{
-			InstanceID:                   instanceID,
-			SNSTopic:                     snsTopic,
-			SpotListener:                 !disableSpotListener,
-			SpotListenerInterval:         spotListenerInterval,
-			AutoscalingHeartbeatInterval: autoscalingHeartbeatInterval,
-		}, sess, logger)
+	var metrics http.Handler
+	if cfg.MetricsAddress != "" {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(daemon.Metrics())
+		metrics = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	}
+
+	if cfg.HealthAddress != "" {
+		server := lifecycled.NewHealthServer(cfg.HealthAddress, daemon, cfg.HealthThreshold)
+		server.SetStartup(startup)
+		if cfg.DebugVars {
+			server.EnableDebugVars(lifecycled.Version)
+		}
+		if cfg.Pprof {
+			server.EnablePprof()
+		}
+		if cfg.MetricsAddress == cfg.HealthAddress {
+			server.Handle("/metrics", metrics)
+		}
+		if err := server.Start(logger.WithField("instanceId", cfg.InstanceID)); err != nil {
+			logger.WithError(err).Fatal("Failed to start health server")
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := server.Stop(ctx); err != nil {
+				logger.WithError(err).Warn("Failed to stop health server")
+			}
+		}()
+	}
 
-		notice, err := daemon.Start(ctx)
+	if cfg.MetricsAddress != "" && cfg.MetricsAddress != cfg.HealthAddress {
+		stop, err := serveMetrics(cfg.MetricsAddress, metrics, logger.WithField("instanceId", cfg.InstanceID))
 		if err != nil {
-			return err
+			logger.WithError(err).Fatal("Failed to start metrics server")
+		}
+		defer stop()
+	}
+
+	if cfg.StateFile != "" {
+		// The state file outlives the run context so that it records the final status
+		stateCtx, stopState := context.WithCancel(context.Background())
+		stateDone := make(chan struct{})
+		go func() {
+			defer close(stateDone)
+			stateFile := lifecycled.NewStateFile(cfg.StateFile, daemon, cfg.StateFileInterval)
+			stateFile.SetStartup(startup)
+			stateFile.Run(stateCtx, logger.WithField("instanceId", cfg.InstanceID))
+		}()
+		defer func() {
+			stopState()
+			<-stateDone
+		}()
+	}
+
+	go func() {
+		select {
+		case <-daemon.Ready():
+			notify("READY=1\nSTATUS=Waiting for termination notices")
+		case <-ctx.Done():
+		}
+	}()
+	go notifier.Watchdog(ctx, func() error {
+		return daemon.Healthy(cfg.HealthThreshold)
+	}, logger.WithField("instanceId", cfg.InstanceID))
+
+	if display != nil {
+		// The display outlives the run context so that it shows the final status
+		displayCtx, stopDisplay := context.WithCancel(context.Background())
+		displayDone := make(chan struct{})
+		go func() {
+			defer close(displayDone)
+			display.Run(displayCtx, 0)
+		}()
+		defer func() {
+			stopDisplay()
+			<-displayDone
+		}()
+	}
+
+	summary, err := daemon.RunWithSummary(ctx, handler)
+	if summary.Outcome() == lifecycled.OutcomeListenerFailed {
+		logger.WithError(err).Error("Listener failed, shutting down")
+	}
+
+	// Handler errors are logged by the daemon, so this only summarizes the outcome
+	exitCode = summary.ExitCode()
+	logSummary(logger.WithField("instanceId", cfg.InstanceID), summary, exitCode)
+	return exitCode
+}
+
+// sendTest publishes a test message to the topic and, if wait is set, waits for the daemon to
+// receive it, and returns the exit code.
+func sendTest(cfg *lifecycled.Config, kind string, wait time.Duration, statusURL string) int {
+	logger := newLogger(cfg)
+
+	msg, err := lifecycled.NewTestMessage(kind, cfg.InstanceID)
+	if err != nil {
+		logger.WithError(err).Error("Invalid configuration")
+		return lifecycled.ExitInvalidConfig
+	}
+	var status func() (lifecycled.Status, error)
+	if wait > 0 {
+		if status = daemonStatus(cfg, statusURL); status == nil {
+			logger.Error("Invalid configuration: --wait needs --status-url, --health-address or --state-file to observe the daemon")
+			return lifecycled.ExitInvalidConfig
+		}
+	}
+	awsCfg, _ := newAWSConfig(cfg, logger)
+	assumeRole(cfg, awsCfg, logger)
+
+	ctx, shutdown := lifecycled.WithShutdown(context.Background())
+	defer shutdown("send-test finished")
+	defer shutdownOnSignal(shutdown, logger)()
+
+	log := logger.WithFields(logrus.Fields{"id": msg.ID, "kind": kind, "topic": cfg.SNSTopic, "instanceId": cfg.InstanceID})
+	if err := lifecycled.SendTestMessage(ctx, sns.NewFromConfig(awsCfg), cfg.SNSTopic, msg); err != nil {
+		log.WithError(err).Error("Failed to send test message")
+		return lifecycled.ExitCommandFailed
+	}
+	sentAt := time.Now()
+	log.Info("Sent test message")
+	if wait == 0 {
+		return lifecycled.ExitSuccess
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	// The daemon is unreachable, rather than not receiving the message, if the last poll failed
+	var statusErr error
+	receivedAt, err := lifecycled.WaitForTestMessage(ctx, func() (lifecycled.Status, error) {
+		s, err := status()
+		statusErr = err
+		return s, err
+	}, msg.ID, time.Second)
+	if err != nil {
+		log.WithError(err).Error("The daemon did not receive the test message")
+		if statusErr != nil {
+			return lifecycled.ExitDaemonUnreachable
 		}
-		if notice != nil {
-			log := logger.WithFields(
-				logrus.Fields{"instanceId": instanceID, "notice": notice.Type()},
-			)
-			log.Info("Executing handler")
+		return lifecycled.ExitCommandFailed
+	}
+	log.WithField("after", receivedAt.Sub(sentAt).Round(time.Millisecond).String()).Info("The daemon received the test message")
+	return lifecycled.ExitSuccess
+}
 
-			start, err := time.Now(), notice.Handle(ctx, handler, log)
-			log = log.WithField("duration", time.Since(start).String())
+// daemonStatus returns a function that gets the status of the daemon from the endpoint, the
+// status endpoint of the health address, or the state file, or nil if none are configured.
+func daemonStatus(cfg *lifecycled.Config, statusURL string) func() (lifecycled.Status, error) {
+	if statusURL == "" && cfg.HealthAddress != "" {
+		statusURL = healthURL(cfg.HealthAddress, "/status")
+	}
+	if statusURL != "" {
+		return func() (lifecycled.Status, error) {
+			var status lifecycled.Status
+			err := getJSON(statusURL, &status)
+			return status, err
+		}
+	}
+	if cfg.StateFile != "" {
+		return func() (lifecycled.Status, error) {
+			var state lifecycled.State
+			data, err := ioutil.ReadFile(cfg.StateFile)
 			if err != nil {
-				log.WithError(err).Error("Failed to execute handler")
+				return state.Status, err
 			}
-			log.Info("Handler finished successfully")
+			err = json.Unmarshal(data, &state)
+			return state.Status, err
+		}
+	}
+	return nil
+}
+
+// healthURL returns the url of the path on the health server at the address.
+func healthURL(address, path string) string {
+	if strings.HasPrefix(address, ":") {
+		address = "localhost" + address
+	}
+	return "http://" + address + path
+}
+
+// getJSON decodes the JSON response of a GET of the url into v.
+func getJSON(url string, v interface{}) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// diffConfig validates the configuration, prints the settings that differ from those of the
+// running daemon as a table (or JSON with --output json), except for those to ignore, and returns
+// the exit code.
+func diffConfig(cfg *lifecycled.Config, configURL string, ignore []string, output string) int {
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %s\n", err)
+		return lifecycled.ExitInvalidConfig
+	}
+	// The secrets are redacted, but whether they are set is compared
+	if _, err := cfg.LoadSecretFiles(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %s\n", err)
+		return lifecycled.ExitInvalidConfig
+	}
+
+	var running lifecycled.StartupInfo
+	if configURL == "" && cfg.HealthAddress != "" {
+		configURL = healthURL(cfg.HealthAddress, "/config")
+	}
+	switch {
+	case configURL != "":
+		if err := getJSON(configURL, &running); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get the configuration of the daemon: %s\n", err)
+			return lifecycled.ExitDaemonUnreachable
+		}
+	case cfg.StateFile != "":
+		var state lifecycled.State
+		data, err := ioutil.ReadFile(cfg.StateFile)
+		if err == nil {
+			err = json.Unmarshal(data, &state)
+		}
+		if err == nil && state.Startup == nil {
+			err = errors.New("it has no start-up information")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read the state file %s: %s\n", cfg.StateFile, err)
+			return lifecycled.ExitDaemonUnreachable
+		}
+		running = *state.Startup
+	default:
+		fmt.Fprintln(os.Stderr, "Invalid configuration: the daemon is read from --config-url, --health-address or --state-file")
+		return lifecycled.ExitInvalidConfig
+	}
+
+	// The settings that the daemon resolves on start-up are those of the running daemon, unless set
+	if cfg.InstanceID == "" {
+		cfg.InstanceID = running.InstanceID
+	}
+	if cfg.Region == "" {
+		cfg.Region = running.Region
+	}
+	if cfg.CloudwatchStream == "" {
+		cfg.CloudwatchStream = cfg.InstanceID
+	}
+	proposed, err := lifecycled.CanonicalConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to describe the configuration: %s\n", err)
+		return lifecycled.ExitCommandFailed
+	}
+	for _, key := range ignore {
+		proposed[key] = running.Config[key]
+	}
+	changes := lifecycled.DiffConfig(running.Config, proposed)
+
+	if output == outputJSON {
+		return printJSON(changes)
+	}
+	if len(changes) == 0 {
+		fmt.Println("No settings differ from the running daemon")
+		return 0
+	}
+	value := func(v interface{}) string {
+		if v == nil {
+			return "-"
+		}
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	restarts := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tRUNNING\tNEW\tRESTART")
+	for _, c := range changes {
+		restart := "no (reloaded on SIGHUP)"
+		if c.RestartRequired {
+			restart = "yes"
+			restarts++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Key, value(c.From), value(c.To), restart)
+	}
+	_ = w.Flush()
+	fmt.Printf("\n%d settings differ (%d requiring a restart)\n", len(changes), restarts)
+	return 0
+}
+
+// replay a captured autoscaling message from the file, and return the exit code.
+func replay(cfg *lifecycled.Config, path string, options lifecycled.ReplayOptions) int {
+	logger := newLogger(cfg)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to read message")
+	}
+	msg, _, err := lifecycled.ParseMessage(data)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid message")
+	}
+	if cfg.InstanceID == "" {
+		cfg.InstanceID = msg.InstanceID
+	}
+
+	// Completion events, notifications and audit records would be indistinguishable from those for a live notice
+	cfg.CompletionTopic, cfg.CompletionWebhook, cfg.NotifyWebhook, cfg.AuditFile = "", "", "", ""
+
+	var asgClient lifecycled.AutoscalingClient
+	if !options.SkipHeartbeats || !options.SkipCompletion {
+		awsCfg, _ := newAWSConfig(cfg, logger)
+		assumeRole(cfg, awsCfg, logger)
+		asgClient = autoscaling.NewFromConfig(awsCfg)
+	}
+	daemon := lifecycled.NewDaemon(cfg, nil, nil, asgClient, nil, logger)
+	handler := configureHandlers(cfg, daemon, func(string) {}, handlerOutput(cfg, logger), logger)
+
+	ctx, shutdown := lifecycled.WithShutdown(context.Background())
+	defer shutdown("replay finished")
+	defer shutdownOnSignal(shutdown, logger)()
+
+	summary, err := daemon.Replay(ctx, data, handler, options)
+	if summary == nil {
+		logger.WithError(err).Fatal("Failed to replay message")
+	}
+	exitCode := summary.ExitCode()
+	logSummary(logger.WithFields(logrus.Fields{"instanceId": cfg.InstanceID, "replay": path}), summary, exitCode)
+	return exitCode
+}
+
+// listQueues prints the lifecycled queues in the account and region as a table or JSON, and
+// returns the exit code.
+func listQueues(cfg *lifecycled.Config, rate int, output string) int {
+	logger := newLogger(cfg)
+	awsCfg, _ := newAWSConfig(cfg, logger)
+	assumeRole(cfg, awsCfg, logger)
+
+	queues, err := lifecycled.ListQueues(context.Background(), sqs.NewFromConfig(awsCfg), ec2.NewFromConfig(awsCfg), rate)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list queues")
+		return lifecycled.ExitCommandFailed
+	}
+	if output == outputJSON {
+		return printJSON(queues)
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tINSTANCE\tSTATE\tAGE\tMESSAGES\tIN FLIGHT")
+	for _, q := range queues {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\n", q.Name, q.InstanceID, q.InstanceState, q.Age(now).Round(time.Minute), q.Messages, q.MessagesInFlight)
+	}
+	_ = w.Flush()
+	return 0
+}
+
+// pruneQueues deletes the queues of instances that are no longer running, prints what was done
+// with each queue as a table or JSON, and returns a non-zero exit code if any of them failed to
+// be deleted.
+func pruneQueues(cfg *lifecycled.Config, options lifecycled.PruneOptions, output string) int {
+	logger := newLogger(cfg)
+	awsCfg, _ := newAWSConfig(cfg, logger)
+	assumeRole(cfg, awsCfg, logger)
+
+	ctx, shutdown := lifecycled.WithShutdown(context.Background())
+	defer shutdown("prune finished")
+	defer shutdownOnSignal(shutdown, logger)()
+
+	queues, err := lifecycled.ListQueues(ctx, sqs.NewFromConfig(awsCfg), ec2.NewFromConfig(awsCfg), options.Rate)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list queues")
+		return lifecycled.ExitCommandFailed
+	}
+	results, err := lifecycled.PruneQueues(ctx, sqs.NewFromConfig(awsCfg), queues, options)
+	exitCode := 0
+	if err != nil {
+		logger.WithError(err).Error("Failed to prune queues")
+		exitCode = lifecycled.ExitCommandFailed
+	}
+	for _, r := range results {
+		if r.Action == lifecycled.PruneFailed {
+			exitCode = lifecycled.ExitCommandFailed
+		}
+	}
+	if output == outputJSON {
+		if code := printJSON(results); code != 0 {
+			return code
+		}
+		return exitCode
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tINSTANCE\tSTATE\tAGE\tACTION\tREASON")
+	for _, r := range results {
+		q := r.Queue
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", q.Name, q.InstanceID, q.InstanceState, q.Age(now).Round(time.Minute), r.Action, r.Reason)
+	}
+	_ = w.Flush()
+	return exitCode
+}
+
+// systemdCommand returns the command line of a systemd unit that runs lifecycled at the path (or
+// this executable) with the configuration file and handler, since a unit needs absolute paths.
+func systemdCommand(path, configFile string, handlerArgv []string) ([]string, error) {
+	if path == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the path of lifecycled, set --exec: %w", err)
+		}
+		path = exe
+	}
+	command := []string{path}
+	if configFile != "" {
+		abs, err := filepath.Abs(configFile)
+		if err != nil {
+			return nil, err
+		}
+		command = append(command, "--config", abs)
+	}
+	if len(handlerArgv) > 0 {
+		command = append(append(command, "--"), handlerArgv...)
+	}
+	return command, nil
+}
+
+// printJSON prints the value as indented JSON, and returns the exit code.
+func printJSON(v interface{}) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print JSON: %s\n", err)
+		return lifecycled.ExitCommandFailed
+	}
+	return 0
+}
+
+// simulatedInstanceID is the instance of simulated messages, if the instance id is not configured.
+const simulatedInstanceID = "i-00000000000000000"
+
+// simulateNotice handles a synthetic message, or the message from the file, with the fields
+// of the flags that were given (and the configured instance id), and returns the exit code that the daemon would exit with.
+func simulateNotice(cfg *lifecycled.Config, path string, fields lifecycled.Message, given map[string]bool) int {
+	logger := newLogger(cfg)
+
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		instanceID = simulatedInstanceID
+	}
+	msg := lifecycled.SimulatedMessage(instanceID, fields.Transition)
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to read message")
+		}
+		if msg, _, err = lifecycled.ParseMessage(data); err != nil {
+			logger.WithError(err).Fatal("Invalid message")
+		}
+		if cfg.InstanceID != "" {
+			msg.InstanceID = cfg.InstanceID
+		}
+		if given["transition"] {
+			msg.Transition = fields.Transition
+		}
+	}
+	if given["group"] {
+		msg.GroupName = fields.GroupName
+	}
+	if given["hook"] {
+		msg.HookName = fields.HookName
+	}
+	if given["token"] {
+		msg.ActionToken = fields.ActionToken
+	}
+	if given["notification-metadata"] {
+		msg.NotificationMetadata = fields.NotificationMetadata
+	}
+	cfg.InstanceID = msg.InstanceID
+
+	// Completion events, notifications and audit records would be indistinguishable from those for a live notice
+	cfg.CompletionTopic, cfg.CompletionWebhook, cfg.NotifyWebhook, cfg.AuditFile = "", "", "", ""
+
+	daemon := lifecycled.NewDaemon(cfg, nil, nil, nil, nil, logger)
+	handler := configureHandlers(cfg, daemon, func(string) {}, handlerOutput(cfg, logger), logger)
 
+	ctx, shutdown := lifecycled.WithShutdown(context.Background())
+	defer shutdown("simulation finished")
+	defer shutdownOnSignal(shutdown, logger)()
+
+	summary, err := daemon.Simulate(ctx, msg, handler)
+	if summary == nil {
+		logger.WithError(err).Fatal("Failed to simulate message")
+	}
+	exitCode := summary.ExitCode()
+	logSummary(logger.WithFields(logrus.Fields{"instanceId": cfg.InstanceID, "simulated": true}), summary, exitCode)
+	return exitCode
+}
+
+// validate runs the preflight checks, prints the results as a table (or JSON with --output json)
+// and returns a non-zero exit code if any of them failed. Unlike the daemon, failing to
+// look up the region is reported as a failed check rather than being fatal.
+func validate(cfg *lifecycled.Config, output string) int {
+	results := []lifecycled.CheckResult{{Name: "config", Status: lifecycled.CheckPass}}
+	if err := cfg.Validate(); err != nil {
+		results[0] = lifecycled.CheckResult{Name: "config", Status: lifecycled.CheckFail, Detail: err.Error()}
+	}
+
+	region, source, err := lifecycled.ResolveRegion(cfg, func() (string, error) {
+		return lookupRegion(cfg)
+	})
+	if err != nil {
+		results = append(results, lifecycled.CheckResult{Name: "region", Status: lifecycled.CheckFail, Detail: err.Error()})
+	} else {
+		results = append(results, lifecycled.CheckResult{Name: "region", Status: lifecycled.CheckPass, Detail: fmt.Sprintf("%s (from %s)", region, source)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	awsCfg, err := lifecycled.NewAWSConfig(ctx, cfg, region)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load the aws configuration: %s\n", err)
+		return lifecycled.ExitSetupFailed
+	}
+	if cfg.AssumeRole != "" {
+		if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
+			results = append(results, lifecycled.CheckResult{Name: "assume-role", Status: lifecycled.CheckFail, Detail: err.Error()})
+		} else {
+			results = append(results, lifecycled.CheckResult{Name: "assume-role", Status: lifecycled.CheckPass, Detail: cfg.AssumeRole})
 		}
+	}
+	clients := lifecycled.NewClients(awsCfg, cfg)
+	results = append(results, lifecycled.Preflight(ctx, cfg, clients.SQS, clients.SNS, clients.Autoscaling, clients.KMS, clients.Metadata)...)
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(results)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Status, r.Detail)
+		}
+		_ = w.Flush()
+	}
+	if lifecycled.CheckFailed(results) {
+		return lifecycled.ExitCommandFailed
+	}
+	return 0
+}
+
+// newLogger returns a logger with the configured format and level.
+func newLogger(cfg *lifecycled.Config) *logrus.Logger {
+	logger := logrus.New()
+	if jsonLogging(cfg) {
+		logger.SetFormatter(lifecycled.NewJSONFormatter())
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{})
+	}
+
+	if cfg.DebugLogging {
+		logger.SetLevel(logrus.DebugLevel)
+	}
+	return logger
+}
+
+// newTracerProvider returns a tracer provider which exports spans in batches with OTLP over HTTP.
+func newTracerProvider(cfg *lifecycled.Config) (*sdktrace.TracerProvider, error) {
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The resource attributes from the environment take precedence
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String("lifecycled"),
+			semconv.ServiceVersionKey.String(lifecycled.Version),
+			semconv.HostIDKey.String(cfg.InstanceID),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+}
+
+// closeLogFile syncs the log file to disk and closes it, which can be called more than once.
+func closeLogFile(f *lifecycled.LogFile) {
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to close log file: %s\n", err)
+	}
+}
+
+// Formats of the results that validate, queues and config diff print on stdout, which are
+// independent of the format of the logs.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// outputFlag adds the --output flag of the format of the results to the command.
+func outputFlag(cmd *kingpin.CmdClause) *string {
+	return cmd.Flag("output", "Format of the results printed on stdout: table or json").Default(outputTable).Enum(outputTable, outputJSON)
+}
+
+// jsonLogging is true if the logs are JSON, for which --json is a shorthand.
+func jsonLogging(cfg *lifecycled.Config) bool {
+	return cfg.JSONLogging || cfg.LogFormat == lifecycled.LogFormatJSON
+}
+
+// handlerOutput returns the writer for the output of handlers, which logs each line
+// when the logs are JSON, or nil to write the output to stderr.
+func handlerOutput(cfg *lifecycled.Config, logger *logrus.Logger) io.Writer {
+	if !jsonLogging(cfg) {
 		return nil
+	}
+	return lifecycled.NewLogWriter(logger.WithFields(logrus.Fields{"instanceId": cfg.InstanceID, "output": "handler"}))
+}
+
+// newAWSConfig returns the AWS configuration with the configured profile, role and endpoints in
+// the region of the configuration, the AWS SDK or the instance (see lifecycled.ResolveRegion),
+// which it sets as the region of the configuration, and returns where the region came from.
+func newAWSConfig(cfg *lifecycled.Config, logger *logrus.Logger) (aws.Config, string) {
+	region, source, err := lifecycled.ResolveRegion(cfg, func() (string, error) {
+		logger.Info("Looking up region from metadata service")
+		return lookupRegion(cfg)
 	})
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to resolve region")
+	}
+	cfg.Region = region
+
+	log := logger.WithFields(logrus.Fields{"region": region, "source": source})
+	if len(cfg.Endpoints) > 0 {
+		log = log.WithField("endpoints", cfg.Endpoints)
+	}
+	log.Info("Resolved region")
+
+	awsCfg, err := lifecycled.NewAWSConfig(context.Background(), cfg, region)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load the aws configuration")
+	}
+	return awsCfg, source
+}
+
+// lookupRegion returns the region of the instance from the metadata service.
+func lookupRegion(cfg *lifecycled.Config) (string, error) {
+	out, err := lifecycled.NewIMDSClient(aws.Config{}, cfg).GetRegion(context.Background(), &imds.GetRegionInput{})
+	if err != nil {
+		return "", err
+	}
+	return out.Region, nil
+}
+
+// lookupInstanceID returns the id of the instance from the metadata service.
+func lookupInstanceID(metadata *imds.Client) (string, error) {
+	out, err := metadata.GetMetadata(context.Background(), &imds.GetMetadataInput{Path: "instance-id"})
+	if err != nil {
+		return "", err
+	}
+	defer out.Content.Close()
+	id, err := ioutil.ReadAll(out.Content)
+	return string(id), err
+}
+
+// verifyIdentity verifies the signature of the instance identity document, so that a metadata
+// service that is spoofed (e.g. by a proxy) can't point the daemon at another instance. A
+// failure is fatal if the signature is required, and otherwise a warning.
+func verifyIdentity(cfg *lifecycled.Config, metadata *imds.Client, logger *logrus.Logger) {
+	log := logger.WithField("instanceId", cfg.InstanceID)
+	fail := log.Warn
+	if cfg.RequireIdentitySignature {
+		fail = log.Fatal
+	}
+	certs, err := lifecycled.IdentityCertificates(cfg.Region, cfg.IdentityCertificatesFile)
+	if err != nil {
+		fail(fmt.Sprintf("Failed to verify the instance identity document: %s", err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), identityTimeout)
+	defer cancel()
+	doc, err := lifecycled.VerifyInstanceIdentity(ctx, metadata, cfg.InstanceID, certs)
+	if err != nil {
+		fail(fmt.Sprintf("Failed to verify the instance identity document: %s", err))
+		return
+	}
+	log.WithFields(logrus.Fields{
+		"account": doc.AccountID,
+		"region":  doc.Region,
+	}).Info("Verified the signature of the instance identity document")
+}
+
+// assumeRole assumes the configured role, if any, so that a role that can't be assumed is fatal
+// on start-up rather than failing the first API calls. Once the credentials have been retrieved
+// they are refreshed in the background of the calls, where failures fail the calls.
+func assumeRole(cfg *lifecycled.Config, awsCfg aws.Config, logger *logrus.Logger) {
+	if cfg.AssumeRole == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), assumeRoleTimeout)
+	defer cancel()
+	if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
+		logger.WithError(err).WithField("role", cfg.AssumeRole).Fatal("Failed to assume role, check that the role exists and that its trust policy allows the instance profile (and external id) to assume it")
+	}
+	logger.WithField("role", cfg.AssumeRole).Info("Assumed role for the AWS API calls")
+}
+
+// credentialSource returns where the credentials of the AWS clients came from, for the start-up
+// log entry, or an empty string with a warning if they can't be retrieved, since the API calls
+// are retried until they are available.
+func credentialSource(awsCfg aws.Config, logger *logrus.Logger) string {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialsTimeout)
+	defer cancel()
+	source, err := lifecycled.CredentialSource(ctx, awsCfg)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to retrieve aws credentials, the AWS API calls fail until they are available")
+		return ""
+	}
+	return source
+}
+
+// shutdownOnSignal shuts down when SIGINT or SIGTERM is received, until the returned function is called.
+func shutdownOnSignal(shutdown func(reason string), logger *logrus.Logger) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		for sig := range sigs {
+			logger.WithField("signal", sig.String()).Info("Received signal: shutting down...")
+			shutdown("received " + sig.String())
+			break
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
+
+// logLevels logs the effective log level of each component.
+func logLevels(log *logrus.Entry, daemon *lifecycled.Daemon) {
+	fields := logrus.Fields{}
+	for component, level := range daemon.LogLevels() {
+		fields[component] = level
+	}
+	log.WithFields(fields).Info("Log levels")
+}
+
+// reloadOnSignal reopens the log file (if any), reads the secret files again and reloads the log
+// levels from the configuration file when SIGHUP is received, until the returned function is
+// called. Levels that were set with flags are replaced.
+func reloadOnSignal(cfg *lifecycled.Config, configFile string, logFile *lifecycled.LogFile, daemon *lifecycled.Daemon, log *logrus.Entry) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		for sig := range sigs {
+			log := log.WithField("signal", sig.String())
+			if logFile != nil {
+				if err := logFile.Reopen(); err != nil {
+					log.WithError(err).Error("Failed to reopen log file")
+				} else {
+					log.Info("Reopened log file")
+				}
+			}
+			if secrets := cfg.SecretFiles(); len(secrets) > 0 {
+				// Read into a copy, so that the secrets are replaced together or not at all
+				reloaded := *cfg
+				if err := loadSecretFiles(&reloaded, log); err != nil {
+					log.WithError(err).Error("Failed to reload secrets")
+				} else {
+					daemon.ReloadSecrets(&reloaded)
+					log.WithField("files", secrets).Info("Reloaded secrets")
+				}
+			}
+			if configFile == "" {
+				if logFile == nil && len(cfg.SecretFiles()) == 0 {
+					log.Warn("Received signal: there is no configuration file to reload")
+				}
+				continue
+			}
+			cfg := lifecycled.DefaultConfig()
+			if err := lifecycled.LoadConfig(configFile, cfg); err != nil {
+				log.WithError(err).Error("Failed to reload configuration")
+				continue
+			}
+			if err := daemon.SetLogLevels(cfg.LogLevels); err != nil {
+				log.WithError(err).Error("Failed to reload log levels")
+				continue
+			}
+			logLevels(log, daemon)
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
+
+// loadSecretFiles reads the secrets of the -file settings, and warns about the files that other
+// users can read.
+func loadSecretFiles(cfg *lifecycled.Config, log logrus.FieldLogger) error {
+	readable, err := cfg.LoadSecretFiles()
+	if err != nil {
+		return err
+	}
+	for _, path := range readable {
+		log.WithField("file", path).Warn("Secret file is readable by other users, restrict it with chmod o-r")
+	}
+	return nil
+}
+
+// configureHandlers sets the handlers for specific notice types on the daemon, and returns the default handler.
+// The output of the handlers is copied to output if it is not nil.
+func configureHandlers(cfg *lifecycled.Config, daemon *lifecycled.Daemon, notify func(string), output io.Writer, logger *logrus.Logger) lifecycled.Handler {
+	// Without a default handler, every notice type has a handler chain (see Config.Validate)
+	var handler lifecycled.Handler = lifecycled.ChainHandler{}
+	if cfg.Handler != "" {
+		var err error
+		handler, err = newHandler(cfg, []string{cfg.Handler}, cfg.HandlerArgs, notify, output)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid handler")
+		}
+	}
+	for noticeType, paths := range cfg.Handlers {
+		h, err := newHandler(cfg, paths, nil, notify, output)
+		if err != nil {
+			logger.WithError(err).WithField("notice", noticeType).Fatal("Invalid handler")
+		}
+		daemon.SetHandler(noticeType, h)
+	}
+	return handler
+}
+
+// serveMetrics serves the metrics handler on /metrics at addr in the background, until stop is called.
+func serveMetrics(addr string, metrics http.Handler, log *logrus.Entry) (stop func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	server := &http.Server{Handler: mux, ReadTimeout: 5 * time.Second, WriteTimeout: 5 * time.Second}
+
+	log.WithField("address", ln.Addr().String()).Info("Starting metrics server")
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("Metrics server failed")
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.WithError(err).Warn("Failed to stop metrics server")
+		}
+	}, nil
+}
+
+// logSummary logs a single line with the outcome of running the daemon.
+func logSummary(log *logrus.Entry, s *lifecycled.Summary, exitCode int) {
+	fields := logrus.Fields{
+		"outcome":  s.Outcome(),
+		"exitCode": exitCode,
+	}
+	if s.Notice != "" {
+		fields["notice"] = s.Notice
+		fields["handlerDuration"] = s.HandlerDuration.String()
+		fields["totalDuration"] = s.TotalDuration.String()
+		fields["handlerResult"] = "success"
+		if s.HandlerError != nil {
+			fields["handlerResult"] = "failed"
+			fields["handlerError"] = s.HandlerError.Error()
+		}
+		fields["completionResult"] = s.CompletionResult
+		if s.CompletionError != nil {
+			fields["completionError"] = s.CompletionError.Error()
+		}
+
+		// Heartbeats and completion are totalled across the notices, including duplicates
+		total := s.Total()
+		fields["notices"] = len(s.Results)
+		fields["heartbeatsSent"] = total.HeartbeatsSent
+		fields["heartbeatsFailed"] = total.HeartbeatsFailed
+		fields["completionDuration"] = total.CompletionDuration.String()
+		fields["completionRetries"] = total.CompletionRetries
+	}
+	if s.Transition != "" {
+		fields["transition"] = s.Transition
+	}
+	log.WithFields(fields).Info("Summary")
+}
+
+// newHandler opens and validates the handler scripts, or creates the built-in handlers, and chains
+// them if there are several.
+func newHandler(cfg *lifecycled.Config, paths, args []string, notify func(string), output io.Writer) (lifecycled.Handler, error) {
+	var chain lifecycled.ChainHandler
+	for _, path := range paths {
+		if lifecycled.IsBuiltinHandler(path) {
+			handler, err := lifecycled.NewBuiltinHandler(path, cfg)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, handler)
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		handler := lifecycled.NewFileHandlerWithGracePeriod(file, cfg.HandlerGracePeriod)
+		handler.SetArgs(args)
+		if output != nil {
+			handler.SetOutput(output)
+		}
+		if err := handler.Validate(); err != nil {
+			return nil, err
+		}
+		chain = append(chain, handler)
+	}
+	var handler lifecycled.Handler = chain
+	if len(chain) == 1 {
+		handler = chain[0]
+	}
+	return &statusHandler{Handler: handler, notify: notify}, nil
+}
+
+// statusHandler reports handler execution in the systemd service status.
+type statusHandler struct {
+	lifecycled.Handler
+	notify func(string)
+}
+
+func (h *statusHandler) Execute(ctx context.Context, args ...string) error {
+	h.notify(fmt.Sprintf("STATUS=Handling termination notice: %s", strings.Join(args, " ")))
+	defer h.notify("STATUS=Finished handling termination notice")
+	return h.Handler.Execute(ctx, args...)
+}
+
+// String describes the handler that is wrapped.
+func (h *statusHandler) String() string {
+	return fmt.Sprint(h.Handler)
+}
 
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+// HandleNotice passes the notice on, so that file handlers can complete the action early.
+func (h *statusHandler) HandleNotice(ctx context.Context, notice *lifecycled.Notice) error {
+	next, ok := h.Handler.(lifecycled.NoticeHandler)
+	if !ok {
+		return h.Execute(ctx, notice.Args...)
+	}
+	h.notify(fmt.Sprintf("STATUS=Handling termination notice: %s", strings.Join(notice.Args, " ")))
+	defer h.notify("STATUS=Finished handling termination notice")
+	return next.HandleNotice(ctx, notice)
 }
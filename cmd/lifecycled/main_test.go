@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/triarius/lifecycled"
+)
+
+// fakeSNS accepts or denies the Publish calls of send-test, and records the request id of the
+// published test message.
+type fakeSNS struct {
+	mu     sync.Mutex
+	deny   bool
+	lastID string
+}
+
+func (f *fakeSNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("Action") != "Publish" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	if f.deny {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>AuthorizationError</Code><Message>denied</Message></Error><RequestId>1</RequestId></ErrorResponse>`)
+		return
+	}
+	var msg struct {
+		RequestID string `json:"RequestId"`
+	}
+	_ = json.Unmarshal([]byte(r.PostForm.Get("Message")), &msg)
+	f.mu.Lock()
+	f.lastID = msg.RequestID
+	f.mu.Unlock()
+	fmt.Fprint(w, `<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></PublishResponse>`)
+}
+
+// setenv sets the environment variables for the test, and returns a function that restores them.
+func setenv(t *testing.T, env map[string]string) func() {
+	previous := make(map[string]*string)
+	for k, v := range env {
+		if old, ok := os.LookupEnv(k); ok {
+			previous[k] = &old
+		} else {
+			previous[k] = nil
+		}
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for k, v := range previous {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func TestSendTestExitCodes(t *testing.T) {
+	defer setenv(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":           "AKIDEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY":       "secret",
+		"AWS_EC2_METADATA_DISABLED":   "true",
+		"AWS_CONFIG_FILE":             os.DevNull,
+		"AWS_SHARED_CREDENTIALS_FILE": os.DevNull,
+	})()
+
+	tests := []struct {
+		description string
+		deny        bool
+		wait        time.Duration
+		status      string
+		expected    int
+	}{
+		{
+			description: "sent without waiting",
+			expected:    lifecycled.ExitSuccess,
+		},
+		{
+			description: "received by the daemon",
+			wait:        5 * time.Second,
+			status:      "received",
+			expected:    lifecycled.ExitSuccess,
+		},
+		{
+			description: "publishing is denied",
+			deny:        true,
+			expected:    lifecycled.ExitCommandFailed,
+		},
+		{
+			description: "not received in time",
+			wait:        1500 * time.Millisecond,
+			status:      "idle",
+			expected:    lifecycled.ExitCommandFailed,
+		},
+		{
+			description: "daemon unreachable",
+			wait:        1500 * time.Millisecond,
+			status:      "unavailable",
+			expected:    lifecycled.ExitDaemonUnreachable,
+		},
+		{
+			description: "nothing to wait on",
+			wait:        time.Second,
+			expected:    lifecycled.ExitInvalidConfig,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			api := &fakeSNS{deny: tc.deny}
+			server := httptest.NewServer(api)
+			defer server.Close()
+
+			daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := lifecycled.Status{Listeners: []lifecycled.ListenerStatus{{Type: "autoscaling"}}}
+				switch tc.status {
+				case "unavailable":
+					http.Error(w, "starting", http.StatusServiceUnavailable)
+					return
+				case "received":
+					api.mu.Lock()
+					if api.lastID != "" {
+						status.Listeners[0].LastTest = &lifecycled.TestReceipt{ID: api.lastID, ReceivedAt: time.Now()}
+					}
+					api.mu.Unlock()
+				}
+				_ = json.NewEncoder(w).Encode(status)
+			}))
+			defer daemon.Close()
+
+			var statusURL string
+			if tc.status != "" {
+				statusURL = daemon.URL + "/status"
+			}
+			cfg := &lifecycled.Config{
+				InstanceID: "i-000000000000",
+				Region:     "us-east-1",
+				SNSTopic:   "arn:aws:sns:us-east-1:123456789012:lifecycled",
+				Endpoints:  map[string]string{"sns": server.URL},
+			}
+			if got := sendTest(cfg, lifecycled.TestTermination, tc.wait, statusURL); got != tc.expected {
+				t.Errorf("expected exit code %d and got %d", tc.expected, got)
+			}
+		})
+	}
+}
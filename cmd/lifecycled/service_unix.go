@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// handleServiceStop is a no-op outside of Windows, where the daemon is stopped with signals.
+func handleServiceStop(_ context.CancelFunc, _ *logrus.Logger) (done func()) {
+	return func() {}
+}
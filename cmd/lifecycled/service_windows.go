@@ -0,0 +1,86 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+)
+
+const serviceName = "lifecycled"
+
+// handleServiceStop cancels the daemon when the service control manager asks the service to
+// stop, and reports the service as stopped once the returned function is called.
+func handleServiceStop(cancel context.CancelFunc, logger *logrus.Logger) (done func()) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		logger.WithError(err).Warn("Failed to determine if running as a Windows service")
+	}
+	if !isService {
+		return func() {}
+	}
+
+	h := &serviceHandler{cancel: cancel, logger: logger, done: make(chan struct{})}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := svc.Run(serviceName, h); err != nil {
+			logger.WithError(err).Error("Failed to run as a Windows service")
+		}
+	}()
+
+	return func() {
+		close(h.done)
+		<-stopped
+	}
+}
+
+type serviceHandler struct {
+	cancel context.CancelFunc
+	logger *logrus.Logger
+	done   chan struct{}
+}
+
+// Execute is called by the service control manager and returns when the daemon has stopped.
+func (h *serviceHandler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.Running, Accepts: accepts}
+
+	for {
+		select {
+		case <-h.done:
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				h.logger.Info("Received service stop request: shutting down...")
+				h.cancel()
+				return h.waitForStop(status)
+			}
+		}
+	}
+}
+
+// waitForStop reports that the service is stopping until the daemon has exited.
+func (h *serviceHandler) waitForStop(status chan<- svc.Status) (bool, uint32) {
+	const waitHint = 10 * time.Second
+
+	ticker := time.NewTicker(waitHint / 2)
+	defer ticker.Stop()
+
+	for checkpoint := uint32(1); ; checkpoint++ {
+		status <- svc.Status{State: svc.StopPending, CheckPoint: checkpoint, WaitHint: uint32(waitHint / time.Millisecond)}
+		select {
+		case <-h.done:
+			return false, 0
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,825 @@
+package lifecycled
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// Config for the Lifecycled Daemon. It is also the schema of the configuration file,
+// where the keys match the names of the command line flags.
+type Config struct {
+	InstanceID                   string        `yaml:"instance-id,omitempty"`
+	SNSTopic                     string        `yaml:"sns-topic,omitempty"`
+	SpotListener                 bool          `yaml:"spot-listener"`
+	SpotListenerInterval         time.Duration `yaml:"spot-listener-interval"`
+	AutoscalingHeartbeatInterval time.Duration `yaml:"autoscaling-heartbeat-interval"`
+	AutoscalingHeartbeatJitter   time.Duration `yaml:"autoscaling-heartbeat-jitter"`
+	PollSummaryInterval          time.Duration `yaml:"poll-summary-interval"`
+	PollFailureThreshold         time.Duration `yaml:"poll-failure-threshold"`
+	PollIdleAfter                time.Duration `yaml:"poll-idle-after"`
+	PollMaxIdleGap               time.Duration `yaml:"poll-max-idle-gap"`
+	IAMPropagationTimeout        time.Duration `yaml:"iam-propagation-timeout"`
+	ClockSkewTolerance           time.Duration `yaml:"clock-skew-tolerance"`
+	StaleMessageAge              time.Duration `yaml:"stale-message-age"`
+	HandlerStartThreshold        time.Duration `yaml:"handler-start-threshold"`
+	PanicResult                  string        `yaml:"panic-result"`
+	Complete                     string        `yaml:"complete"`
+	CompletionDelay              time.Duration `yaml:"completion-delay"`
+	CancelOnLostAction           bool          `yaml:"cancel-on-lost-action"`
+	MaxHeartbeatDuration         time.Duration `yaml:"max-heartbeat-duration"`
+	TimeoutResult                string        `yaml:"timeout-result"`
+	CheckpointDir                string        `yaml:"checkpoint-dir,omitempty"`
+	QuarantineDir                string        `yaml:"quarantine-dir,omitempty"`
+	QuarantineKeep               int           `yaml:"quarantine-keep"`
+	RecoverHandler               string        `yaml:"recover-handler"`
+	VerifyTermination            bool          `yaml:"verify-termination"`
+	VerifySignatures             bool          `yaml:"verify-signatures"`
+	SelfCheck                    bool          `yaml:"self-check"`
+	DeliveryCheck                bool          `yaml:"delivery-check"`
+	DedupWindow                  time.Duration `yaml:"dedup-window"`
+
+	// AutoscalingRules classify lifecycle hook messages as termination or checkpoint notices,
+	// e.g. for instance refresh checkpoints, which are configured in the file (see NoticeRule).
+	AutoscalingRules []NoticeRule `yaml:"autoscaling-rules,omitempty"`
+
+	// HandlerConcurrency is the number of handlers that may run at once. The
+	// default of 1 serializes handler execution.
+	HandlerConcurrency int `yaml:"handler-concurrency"`
+
+	// ListenerRestarts is the number of times a failed listener is restarted
+	// before the daemon gives up, with a backoff starting at ListenerRestartBackoff.
+	ListenerRestarts       int           `yaml:"listener-restarts"`
+	ListenerRestartBackoff time.Duration `yaml:"listener-restart-backoff"`
+
+	// AutoscalingRateLimit limits the calls to the autoscaling API that the daemon makes, which
+	// all its listeners and notices share, to this many per second on average with bursts of up
+	// to AutoscalingRateBurst (defaults to the calls of one second). Zero disables the limit.
+	AutoscalingRateLimit int `yaml:"autoscaling-rate-limit"`
+	AutoscalingRateBurst int `yaml:"autoscaling-rate-burst"`
+
+	// ShutdownTimeout bounds the calls that are made while shutting down, such as completing
+	// the lifecycle action and deleting the queue, after the daemon context is cancelled.
+	ShutdownTimeout time.Duration `yaml:"shutdown-timeout"`
+
+	// NoCleanup retains the queue and its subscription when the daemon exits, so that the next
+	// daemon on the instance reattaches to them, e.g. to inspect the messages while debugging.
+	NoCleanup bool `yaml:"no-cleanup"`
+
+	// NoAutoscaling disables the autoscaling listener even if the SNSTopic is set, so that no
+	// queue is created or subscribed to the topic (see Listeners).
+	NoAutoscaling bool `yaml:"no-autoscaling"`
+
+	// SecondarySNSTopics are topics in other regions that the lifecycle hook messages are
+	// mirrored to, which the autoscaling listener also subscribes a queue in their region to, so
+	// that an incident of SNS in one region doesn't stop the notices. The messages of a lifecycle
+	// action that arrive from several topics are handled once.
+	SecondarySNSTopics []string `yaml:"secondary-sns-topics,omitempty"`
+
+	// RequireIdentitySignature makes a failure to verify the signature of the instance identity
+	// document fatal, rather than a warning, when the instance id is looked up from the metadata
+	// service. IdentityCertificatesFile is a PEM file of the certificates of AWS that verify it,
+	// in addition to those that are bundled (see IdentityCertificates).
+	RequireIdentitySignature bool   `yaml:"require-identity-signature"`
+	IdentityCertificatesFile string `yaml:"identity-certificates-file,omitempty"`
+
+	// ShutdownPolicy is continue, abandon or leave, for lifecycle actions that
+	// are in progress when the daemon shuts down.
+	ShutdownPolicy string `yaml:"shutdown-policy"`
+
+	// BeforeHeartbeat is called before each lifecycle action heartbeat, when embedding lifecycled.
+	BeforeHeartbeat HeartbeatHook `yaml:"-"`
+
+	// TracerProvider traces the handling of each notice (see AutoscalingOptions.TracerProvider),
+	// which is disabled if it is nil.
+	TracerProvider trace.TracerProvider `yaml:"-"`
+
+	// CompletionTopic is an SNS topic, or CompletionWebhook an HTTPS endpoint, which receives
+	// a JSON CompletionEvent after each notice has been handled.
+	CompletionTopic        string `yaml:"completion-topic,omitempty"`
+	CompletionWebhook      string `yaml:"completion-webhook,omitempty"`
+	CompletionWebhookToken string `yaml:"completion-webhook-token,omitempty" secret:"true"`
+
+	// NotifyWebhook receives a Notification (formatted as NotifyFormat) when a notice is received,
+	// when the handler fails and when the notice has been handled, as enabled by NotifyOn*, and
+	// when a listener crosses the poll failure threshold and recovers if NotifyOnPollFailure is
+	// set. Each notification is sent within NotifyTimeout.
+	NotifyWebhook       string        `yaml:"notify-webhook,omitempty" secret:"true"`
+	NotifyFormat        string        `yaml:"notify-format"`
+	NotifyOnReceived    bool          `yaml:"notify-on-received"`
+	NotifyOnFailure     bool          `yaml:"notify-on-failure"`
+	NotifyOnCompletion  bool          `yaml:"notify-on-completion"`
+	NotifyOnPollFailure bool          `yaml:"notify-on-poll-failure"`
+	NotifyTimeout       time.Duration `yaml:"notify-timeout"`
+
+	// AuditFile receives a JSON AuditRecord for each notice that is handled. It is rotated
+	// when it would exceed AuditFileMaxSize bytes, keeping AuditFileKeep previous files.
+	AuditFile        string `yaml:"audit-file,omitempty"`
+	AuditFileMaxSize int64  `yaml:"audit-file-max-size"`
+	AuditFileKeep    int    `yaml:"audit-file-keep"`
+
+	// StatsdAddress is the UDP address of a statsd agent (e.g. localhost:8125) that receives the
+	// same metrics as Prometheus, with the StatsdTags (e.g. env:production) in DogStatsD format.
+	StatsdAddress string   `yaml:"statsd-address,omitempty"`
+	StatsdTags    []string `yaml:"statsd-tags,omitempty"`
+
+	// InstanceTags are the names of the EC2 tags of the instance that are added to the log entries
+	// and exported to handlers as LIFECYCLED_TAG_<NAME>. Requires ec2:DescribeTags if set.
+	InstanceTags []string `yaml:"instance-tags,omitempty"`
+
+	// CloudwatchMetricsNamespace is the CloudWatch namespace that New publishes the metrics of
+	// each notice to (see NoticeMetrics). NewDaemon ignores it, use Daemon.SetCloudWatchMetrics.
+	CloudwatchMetricsNamespace string `yaml:"cloudwatch-metrics-namespace,omitempty"`
+
+	// AssumeRole is the ARN of an IAM role that the AWS clients of NewAWSConfig assume with STS,
+	// with the AssumeRoleExternalID if the trust policy requires one, and AssumeRoleSessionName
+	// (lifecycled-<instance id> by default), e.g. a drain role with the autoscaling permissions.
+	AssumeRole            string `yaml:"assume-role,omitempty"`
+	AssumeRoleExternalID  string `yaml:"assume-role-external-id,omitempty"`
+	AssumeRoleSessionName string `yaml:"assume-role-session-name,omitempty"`
+
+	// WebIdentityTokenFile is a file with the OIDC token of a web identity, e.g. of the service
+	// account of a container, that the credentials of WebIdentityRole are assumed with (see
+	// WebIdentityCredentials). They default to AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN.
+	WebIdentityTokenFile string `yaml:"web-identity-token-file,omitempty"`
+	WebIdentityRole      string `yaml:"web-identity-role,omitempty"`
+
+	// STSRegionalEndpoints is regional to call STS at the endpoint of the region of the AWS
+	// clients, or legacy for the global endpoint of the aws partition (sts.amazonaws.com).
+	STSRegionalEndpoints string `yaml:"sts-regional-endpoints,omitempty"`
+
+	// AWSProfile is a named profile of the shared configuration and credentials files that
+	// NewAWSConfig uses instead of the default credentials, e.g. of the instance profile.
+	AWSProfile string `yaml:"aws-profile,omitempty"`
+
+	// Region of the AWS clients, which takes precedence over the region of the AWS SDK and of
+	// the instance (see ResolveRegion).
+	Region string `yaml:"region,omitempty"`
+
+	// Endpoints override the endpoints of the AWS clients by service (see EndpointServices),
+	// e.g. for VPC endpoints or a local emulator of the AWS APIs.
+	Endpoints map[string]string `yaml:"endpoints,omitempty"`
+
+	// FIPS uses the FIPS endpoints of the AWS APIs (e.g. in GovCloud), other than the Endpoints
+	// that are overridden.
+	FIPS bool `yaml:"fips,omitempty"`
+
+	// IMDSProxy sends the requests to the instance metadata service through the proxy of the
+	// environment (e.g. HTTP_PROXY) like the AWS APIs, rather than directly.
+	IMDSProxy bool `yaml:"imds-proxy,omitempty"`
+
+	// AWSConnectTimeout bounds connecting to the AWS APIs including the TLS handshake, and
+	// AWSCallTimeout each attempt of an AWS API call, with the wait time of the long-polls of the
+	// queue on top, except for the heartbeats of lifecycle actions, which AWSHeartbeatTimeout
+	// bounds so that a heartbeat that stalls is retried before the action times out. Zero
+	// disables a timeout.
+	AWSConnectTimeout   time.Duration `yaml:"aws-connect-timeout"`
+	AWSCallTimeout      time.Duration `yaml:"aws-call-timeout"`
+	AWSHeartbeatTimeout time.Duration `yaml:"aws-heartbeat-timeout"`
+
+	// Tags are added to the AWS resources that the daemon creates, which are the SQS queue of
+	// the autoscaling listener and the CloudWatch Logs group (see ValidateResourceTags).
+	Tags map[string]string `yaml:"tags,omitempty"`
+
+	// The -file settings are files that LoadSecretFiles reads the secrets from, so that they
+	// aren't passed on the command line where they show in ps, and StatsdSecretTags are the
+	// statsd tags of StatsdTagsFile (e.g. with an api key), which are redacted unlike StatsdTags.
+	CompletionWebhookTokenFile string   `yaml:"completion-webhook-token-file,omitempty" file:"CompletionWebhookToken"`
+	NotifyWebhookFile          string   `yaml:"notify-webhook-file,omitempty" file:"NotifyWebhook"`
+	StatsdTagsFile             string   `yaml:"statsd-tags-file,omitempty" file:"StatsdSecretTags"`
+	StatsdSecretTags           []string `yaml:"-" secret:"true"`
+
+	// Settings used by the lifecycled command, which are ignored by NewDaemon.
+
+	// Preset is the name of the preset (see ApplyPreset) that provided the defaults, if any.
+	Preset string `yaml:"preset,omitempty"`
+
+	// Handler is the path to the default handler, which is executed with the HandlerArgs
+	// before the arguments of the notice, and Handlers overrides it for specific notice
+	// types with a chain of handlers that are executed in order.
+	Handler            string              `yaml:"handler,omitempty"`
+	HandlerArgs        []string            `yaml:"handler-args,omitempty"`
+	Handlers           map[string][]string `yaml:"handlers,omitempty"`
+	HandlerGracePeriod time.Duration       `yaml:"handler-grace-period"`
+	LogFormat          string              `yaml:"log-format"`
+	LogLevels          map[string]string   `yaml:"log-levels,omitempty"`
+	JSONLogging        bool                `yaml:"json"`
+	DebugLogging       bool                `yaml:"debug"`
+	CloudwatchGroup    string              `yaml:"cloudwatch-group,omitempty"`
+	CloudwatchStream   string              `yaml:"cloudwatch-stream,omitempty"`
+	Journald           bool                `yaml:"journald"`
+	LogFile            string              `yaml:"log-file,omitempty"`
+	LogFileMaxSize     int64               `yaml:"log-file-max-size"`
+	LogFileKeep        int                 `yaml:"log-file-keep"`
+	LogFileCompress    bool                `yaml:"log-file-compress"`
+	HealthAddress      string              `yaml:"health-address,omitempty"`
+	HealthThreshold    time.Duration       `yaml:"health-threshold"`
+	DebugVars          bool                `yaml:"debug-vars"`
+	Pprof              bool                `yaml:"pprof"`
+	MetricsAddress     string              `yaml:"metrics-address,omitempty"`
+	Tracing            bool                `yaml:"tracing"`
+	StateFile          string              `yaml:"state-file,omitempty"`
+	StateFileInterval  time.Duration       `yaml:"state-file-interval"`
+
+	// Pretty shows a live status of the daemon on stdout when it is a terminal (see StatusDisplay).
+	Pretty bool `yaml:"pretty"`
+
+	// Kubeconfig, DrainGracePeriod and DrainTimeout configure the builtin:k8s-drain handler
+	// (see KubernetesDrainOptions).
+	Kubeconfig       string        `yaml:"kubeconfig,omitempty"`
+	DrainGracePeriod time.Duration `yaml:"drain-grace-period"`
+	DrainTimeout     time.Duration `yaml:"drain-timeout"`
+}
+
+// NoticeTypes are the types of the termination notices produced by the built-in listeners.
+var NoticeTypes = []string{"autoscaling", "spot"}
+
+// DefaultConfig returns the configuration used by the lifecycled command
+// for any setting that is not configured.
+func DefaultConfig() *Config {
+	return &Config{
+		SpotListener:               true,
+		SpotListenerInterval:       5 * time.Second,
+		AutoscalingHeartbeatJitter: time.Second,
+		PollSummaryInterval:        5 * time.Minute,
+		PollFailureThreshold:       10 * time.Minute,
+		PollIdleAfter:              10 * time.Minute,
+		IAMPropagationTimeout:      time.Minute,
+		ClockSkewTolerance:         5 * time.Second,
+		PanicResult:                ResultContinue,
+		Complete:                   CompleteAlways,
+		MaxHeartbeatDuration:       48*time.Hour - 10*time.Minute,
+		TimeoutResult:              ResultContinue,
+		RecoverHandler:             RecoverRerun,
+		HandlerConcurrency:         1,
+		ListenerRestarts:           5,
+		ListenerRestartBackoff:     time.Second,
+		ShutdownTimeout:            10 * time.Second,
+		ShutdownPolicy:             ShutdownContinue,
+		STSRegionalEndpoints:       STSRegional,
+		LogFormat:                  LogFormatText,
+		NotifyFormat:               NotifyFormatJSON,
+		NotifyOnReceived:           true,
+		NotifyOnFailure:            true,
+		NotifyOnCompletion:         true,
+		NotifyTimeout:              5 * time.Second,
+		AuditFileMaxSize:           10 << 20,
+		AuditFileKeep:              2,
+		LogFileMaxSize:             100 << 20,
+		LogFileKeep:                5,
+		QuarantineKeep:             100,
+		HandlerGracePeriod:         DefaultHandlerGracePeriod,
+		HealthThreshold:            time.Minute,
+		StateFileInterval:          30 * time.Second,
+		AWSConnectTimeout:          5 * time.Second,
+		AWSCallTimeout:             30 * time.Second,
+		AWSHeartbeatTimeout:        10 * time.Second,
+	}
+}
+
+// LoadConfig reads the YAML configuration file at path into the config, overwriting any
+// setting that is present in the file. Unknown keys are an error to catch typos, and durations
+// are parsed with ParseDuration so that they must have units.
+func LoadConfig(path string, config *Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if data, err = parseConfigDurations(data); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(config); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// durationKeys are the keys of the settings in the configuration file that are durations.
+var durationKeys = func() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.Type == reflect.TypeOf(time.Duration(0)) {
+			keys[strings.Split(field.Tag.Get("yaml"), ",")[0]] = true
+		}
+	}
+	return keys
+}()
+
+// parseConfigDurations checks the durations of the configuration file with ParseDuration, which
+// yaml would reject with an unhelpful error if they have no unit, and rewrites those that only
+// ParseDuration accepts (e.g. 1d) in place for yaml, so that the lines in the errors of decoding
+// the file are still those of the file.
+func parseConfigDurations(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return data, nil
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	settings := doc.Content[0].Content
+	for i := 0; i+1 < len(settings); i += 2 {
+		key, value := settings[i], settings[i+1]
+		if !durationKeys[key.Value] || value.Kind != yaml.ScalarNode {
+			continue
+		}
+		d, err := ParseDuration(value.Value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %s", value.Line, key.Value, err)
+		}
+		if _, err := time.ParseDuration(value.Value); err == nil && value.Tag == "!!str" {
+			continue
+		}
+		// The scalar is on a single line, as it has no spaces, and is written as is or quoted
+		raw := value.Value
+		switch value.Style {
+		case yaml.DoubleQuotedStyle:
+			raw = `"` + raw + `"`
+		case yaml.SingleQuotedStyle:
+			raw = `'` + raw + `'`
+		}
+		line := lines[value.Line-1]
+		start := value.Column - 1
+		if start < 0 || start > len(line) || !bytes.HasPrefix(line[start:], []byte(raw)) {
+			return nil, fmt.Errorf("line %d: %s: invalid duration %q", value.Line, key.Value, value.Value)
+		}
+		rest := line[start+len(raw):]
+		lines[value.Line-1] = append(append(append([]byte{}, line[:start]...), d.String()...), rest...)
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+// ConfigFileKeys returns the settings that are present in the YAML configuration file at path.
+func ConfigFileKeys(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// sessionNamePattern matches valid role session names of STS.
+var sessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// instanceIDPattern matches the ids of EC2 instances, which have 8 or 17 hexadecimal digits.
+var instanceIDPattern = regexp.MustCompile(`^i-[0-9a-f]{8,17}$`)
+
+// maxConfiguredHeartbeatInterval bounds the autoscaling heartbeat interval, since the heartbeat
+// timeout of a hook is at most 2h and the interval that is derived from it at most half of that.
+// It is at least minHeartbeatInterval, unless it is zero.
+const maxConfiguredHeartbeatInterval = time.Hour
+
+// The spot listener interval is bounded by the two minutes of warning of an interruption.
+const (
+	minSpotListenerInterval = time.Second
+	maxSpotListenerInterval = time.Minute
+)
+
+// invalid returns the error of an invalid setting, which names its flag (and key of the
+// configuration file) and shows an example of a valid value.
+func invalid(flag, example, format string, args ...interface{}) error {
+	return fmt.Errorf("--%s %s (e.g. --%s %s)", flag, fmt.Sprintf(format, args...), flag, example)
+}
+
+// validateBuiltinHandler checks that the handler of the flag names a built-in handler, if it
+// selects one.
+func validateBuiltinHandler(flag, handler string) error {
+	name, ok := builtinHandlerName(handler)
+	if !ok || contains(BuiltinHandlers, name) {
+		return nil
+	}
+	return invalid(flag, BuiltinHandlerPrefix+KubernetesDrainHandlerName, "unknown built-in handler %q (expected one of %s)", handler, BuiltinHandlerPrefix+strings.Join(BuiltinHandlers, ", "+BuiltinHandlerPrefix))
+}
+
+// Validate the configuration of the lifecycled command. It checks the formats and ranges of the
+// settings and the combinations of settings that are exclusive or required together, without
+// making any calls, so that mistakes are reported before any AWS resources are touched.
+func (c *Config) Validate() error {
+	if c.Handler == "" && len(c.Handlers) == 0 {
+		return invalid("handler", "/usr/local/bin/drain", "is required")
+	}
+	if c.Handler == "" && len(c.HandlerArgs) > 0 {
+		return invalid("handler", "/usr/local/bin/drain", "is required with handler-args")
+	}
+	if IsBuiltinHandler(c.Handler) && len(c.HandlerArgs) > 0 {
+		return invalid("handler", "/usr/local/bin/drain", "can't be a built-in handler with handler-args, got %s", c.Handler)
+	}
+	if err := validateBuiltinHandler("handler", c.Handler); err != nil {
+		return err
+	}
+	for noticeType, chain := range c.Handlers {
+		for _, handler := range chain {
+			if err := validateBuiltinHandler("handlers", handler); err != nil {
+				return err
+			}
+		}
+		if !contains(NoticeTypes, noticeType) && noticeType != CheckpointNoticeType {
+			return fmt.Errorf("handlers: unknown notice type %q (expected one of %s)", noticeType, strings.Join(NoticeTypes, ", ")+", "+CheckpointNoticeType)
+		}
+		if len(chain) == 0 {
+			return fmt.Errorf("handlers: no handlers configured for %s notices", noticeType)
+		}
+	}
+	for i, rule := range c.AutoscalingRules {
+		if err := rule.validate(i); err != nil {
+			return err
+		}
+	}
+	if c.Handler == "" {
+		noticeTypes := NoticeTypes
+		if c.hasCheckpointRules() {
+			noticeTypes = append([]string{CheckpointNoticeType}, NoticeTypes...)
+		}
+		var missing []string
+		for _, noticeType := range noticeTypes {
+			if !contains(c.Listeners(), noticeType) && noticeType != CheckpointNoticeType {
+				continue
+			}
+			if _, ok := c.Handlers[noticeType]; !ok {
+				missing = append(missing, noticeType)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return invalid("handler", "/usr/local/bin/drain", "is required for %s notices, or handlers for each of them", strings.Join(missing, ", "))
+		}
+	}
+	switch c.Preset {
+	case "", PresetSpot:
+		if c.Preset == PresetSpot && c.SNSTopic != "" {
+			return invalid("preset", PresetFull, "%s doesn't listen for autoscaling notices, use %s with sns-topic", PresetSpot, PresetFull)
+		}
+	case PresetAutoscaling, PresetFull:
+		if c.SNSTopic == "" {
+			return invalid("sns-topic", "arn:aws:sns:us-east-1:123456789012:lifecycled", "is required with preset %s", c.Preset)
+		}
+		if c.NoAutoscaling {
+			return invalid("preset", PresetSpot, "%s listens for autoscaling notices, which no-autoscaling disables", c.Preset)
+		}
+	default:
+		return invalid("preset", PresetAutoscaling, "must be %s, %s or %s, got %q", PresetSpot, PresetAutoscaling, PresetFull, c.Preset)
+	}
+	if len(c.Listeners()) == 0 {
+		if c.NoAutoscaling {
+			return errors.New("no listeners are enabled, enable the spot listener or the autoscaling listener (see no-spot and no-autoscaling)")
+		}
+		return invalid("sns-topic", "arn:aws:sns:us-east-1:123456789012:lifecycled", "is required with no-spot, since no listeners are enabled")
+	}
+	if c.InstanceID != "" && !instanceIDPattern.MatchString(c.InstanceID) {
+		return invalid("instance-id", "i-0123456789abcdef0", "must be an ec2 instance id, got %q", c.InstanceID)
+	}
+	if c.SNSTopic != "" && !isTopicARN(c.SNSTopic) {
+		return invalid("sns-topic", "arn:aws:sns:us-east-1:123456789012:lifecycled", "must be the arn of an sns topic, got %q", c.SNSTopic)
+	}
+	if err := validatePartition("sns-topic", c.SNSTopic); err != nil {
+		return err
+	}
+	if err := c.validateSecondaryTopics(); err != nil {
+		return err
+	}
+	if c.PanicResult != ResultContinue && c.PanicResult != ResultAbandon {
+		return invalid("panic-result", ResultAbandon, "must be %s or %s, got %q", ResultContinue, ResultAbandon, c.PanicResult)
+	}
+	if c.TimeoutResult != ResultContinue && c.TimeoutResult != ResultAbandon {
+		return invalid("timeout-result", ResultAbandon, "must be %s or %s, got %q", ResultContinue, ResultAbandon, c.TimeoutResult)
+	}
+	if c.MaxHeartbeatDuration <= 0 || c.MaxHeartbeatDuration > 48*time.Hour {
+		return invalid("max-heartbeat-duration", "47h50m", "must be greater than zero and at most the 48h limit of the autoscaling API, got %s", c.MaxHeartbeatDuration)
+	}
+	if !contains([]string{ShutdownContinue, ShutdownAbandon, ShutdownLeave}, c.ShutdownPolicy) {
+		return invalid("shutdown-policy", ShutdownLeave, "must be %s, %s or %s, got %q", ShutdownContinue, ShutdownAbandon, ShutdownLeave, c.ShutdownPolicy)
+	}
+	if c.RecoverHandler != RecoverRerun && c.RecoverHandler != RecoverSkip {
+		return invalid("recover-handler", RecoverSkip, "must be %s or %s, got %q", RecoverRerun, RecoverSkip, c.RecoverHandler)
+	}
+	if _, err := parseLogLevels(c.LogLevels); err != nil {
+		return invalid("log-level", "queue=debug", "%s", err)
+	}
+	if c.LogFormat != LogFormatText && c.LogFormat != LogFormatJSON {
+		return invalid("log-format", LogFormatJSON, "must be %s or %s, got %q", LogFormatText, LogFormatJSON, c.LogFormat)
+	}
+	if c.NotifyFormat != NotifyFormatJSON && c.NotifyFormat != NotifyFormatSlack {
+		return invalid("notify-format", NotifyFormatSlack, "must be %s or %s, got %q", NotifyFormatJSON, NotifyFormatSlack, c.NotifyFormat)
+	}
+	if c.StatsdAddress != "" {
+		if _, _, err := net.SplitHostPort(c.StatsdAddress); err != nil {
+			return invalid("statsd-address", "localhost:8125", "must be a host and port: %s", err)
+		}
+	}
+	if (len(c.StatsdTags) > 0 || c.StatsdTagsFile != "") && c.StatsdAddress == "" {
+		return invalid("statsd-address", "localhost:8125", "is required with statsd-tag and statsd-tags-file")
+	}
+	switch c.Complete {
+	case CompleteAlways, CompleteOnSuccess, CompleteNever:
+	default:
+		return invalid("complete", CompleteOnSuccess, "must be %s, %s or %s, got %q", CompleteAlways, CompleteOnSuccess, CompleteNever, c.Complete)
+	}
+	if c.SpotListener && (c.SpotListenerInterval < minSpotListenerInterval || c.SpotListenerInterval > maxSpotListenerInterval) {
+		return invalid("spot-listener-interval", "5s", "must be between %s and %s, got %s", minSpotListenerInterval, maxSpotListenerInterval, c.SpotListenerInterval)
+	}
+	if c.AutoscalingHeartbeatInterval != 0 && (c.AutoscalingHeartbeatInterval < minHeartbeatInterval || c.AutoscalingHeartbeatInterval > maxConfiguredHeartbeatInterval) {
+		return invalid("autoscaling-heartbeat-interval", "5m", "must be zero (half the heartbeat timeout of the hook) or between %s and %s, got %s", minHeartbeatInterval, maxConfiguredHeartbeatInterval, c.AutoscalingHeartbeatInterval)
+	}
+	if c.AutoscalingHeartbeatJitter < 0 || (c.AutoscalingHeartbeatInterval > 0 && c.AutoscalingHeartbeatJitter >= c.AutoscalingHeartbeatInterval) {
+		return invalid("autoscaling-heartbeat-jitter", "1s", "must not be negative and must be less than autoscaling-heartbeat-interval, got %s", c.AutoscalingHeartbeatJitter)
+	}
+	// A slice rather than a map, so that the same one of several invalid durations is reported
+	for _, d := range []struct {
+		flag  string
+		value time.Duration
+	}{
+		{"poll-summary-interval", c.PollSummaryInterval},
+		{"poll-failure-threshold", c.PollFailureThreshold},
+		{"poll-idle-after", c.PollIdleAfter},
+		{"poll-max-idle-gap", c.PollMaxIdleGap},
+		{"iam-propagation-timeout", c.IAMPropagationTimeout},
+		{"clock-skew-tolerance", c.ClockSkewTolerance},
+		{"stale-message-age", c.StaleMessageAge},
+		{"handler-start-threshold", c.HandlerStartThreshold},
+		{"handler-grace-period", c.HandlerGracePeriod},
+		{"drain-grace-period", c.DrainGracePeriod},
+		{"drain-timeout", c.DrainTimeout},
+		{"dedup-window", c.DedupWindow},
+		{"completion-delay", c.CompletionDelay},
+		{"listener-restart-backoff", c.ListenerRestartBackoff},
+		{"shutdown-timeout", c.ShutdownTimeout},
+		{"notify-timeout", c.NotifyTimeout},
+		{"health-threshold", c.HealthThreshold},
+		{"aws-connect-timeout", c.AWSConnectTimeout},
+		{"aws-call-timeout", c.AWSCallTimeout},
+		{"aws-heartbeat-timeout", c.AWSHeartbeatTimeout},
+	} {
+		if d.value < 0 {
+			return invalid(d.flag, "30s", "must not be negative, got %s", d.value)
+		}
+	}
+	if c.HandlerConcurrency < 1 {
+		return invalid("handler-concurrency", "1", "must be at least 1, got %d", c.HandlerConcurrency)
+	}
+	if c.ListenerRestarts < 0 {
+		return invalid("listener-restarts", "5", "must not be negative, got %d", c.ListenerRestarts)
+	}
+	if c.AutoscalingRateLimit < 0 {
+		return invalid("autoscaling-rate-limit", "5", "must not be negative, got %d", c.AutoscalingRateLimit)
+	}
+	if c.AutoscalingRateBurst < 0 {
+		return invalid("autoscaling-rate-burst", "10", "must not be negative, got %d", c.AutoscalingRateBurst)
+	}
+	if c.QuarantineDir != "" && c.QuarantineKeep < 0 {
+		return invalid("quarantine-keep", "100", "must not be negative, got %d", c.QuarantineKeep)
+	}
+	if c.AuditFile != "" && c.AuditFileMaxSize < 0 {
+		return invalid("audit-file-max-size", "10485760", "must not be negative, got %d", c.AuditFileMaxSize)
+	}
+	if c.AuditFile != "" && c.AuditFileKeep < 0 {
+		return invalid("audit-file-keep", "2", "must not be negative, got %d", c.AuditFileKeep)
+	}
+	if c.LogFile != "" && c.LogFileMaxSize < 0 {
+		return invalid("log-file-max-size", "104857600", "must not be negative, got %d", c.LogFileMaxSize)
+	}
+	if c.LogFile != "" && c.LogFileKeep < 0 {
+		return invalid("log-file-keep", "5", "must not be negative, got %d", c.LogFileKeep)
+	}
+	if c.LogFileCompress && c.LogFile == "" {
+		return invalid("log-file", "/var/log/lifecycled.log", "is required with log-file-compress")
+	}
+	if c.CompletionTopic != "" && c.CompletionWebhook != "" {
+		return invalid("completion-topic", "arn:aws:sns:us-east-1:123456789012:drained", "and completion-webhook are mutually exclusive")
+	}
+	if c.CompletionTopic != "" && !isTopicARN(c.CompletionTopic) {
+		return invalid("completion-topic", "arn:aws:sns:us-east-1:123456789012:drained", "must be the arn of an sns topic, got %q", c.CompletionTopic)
+	}
+	if err := validatePartition("completion-topic", c.CompletionTopic); err != nil {
+		return err
+	}
+	if c.CompletionWebhook != "" && !strings.HasPrefix(c.CompletionWebhook, "https://") {
+		return invalid("completion-webhook", "https://example.com/drained", "must be an https:// url, got %q", c.CompletionWebhook)
+	}
+	if (c.CompletionWebhookToken != "" || c.CompletionWebhookTokenFile != "") && c.CompletionWebhook == "" {
+		return invalid("completion-webhook", "https://example.com/drained", "is required with completion-webhook-token and completion-webhook-token-file")
+	}
+	if err := c.validateSecretFiles(); err != nil {
+		return err
+	}
+	if c.CloudwatchStream != "" && c.CloudwatchGroup == "" {
+		return invalid("cloudwatch-group", "/lifecycled", "is required with cloudwatch-stream")
+	}
+	if c.StateFile != "" && c.StateFileInterval <= 0 {
+		return invalid("state-file-interval", "30s", "must be greater than zero, got %s", c.StateFileInterval)
+	}
+	if c.AssumeRole != "" {
+		if a, err := arn.Parse(c.AssumeRole); err != nil || a.Service != "iam" || !strings.HasPrefix(a.Resource, "role/") || !isPartition(a.Partition) {
+			return invalid("assume-role", "arn:aws:iam::123456789012:role/drain", "must be the arn of an iam role, got %q", c.AssumeRole)
+		}
+	}
+	if c.Region != "" && !regionPattern.MatchString(c.Region) {
+		return invalid("region", "us-east-1", "must be the name of an aws region, got %q", c.Region)
+	}
+	if err := c.ValidateRegion(c.Region); err != nil {
+		return err
+	}
+	services := make([]string, 0, len(c.Endpoints))
+	for service := range c.Endpoints {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		if !contains(EndpointServices, service) {
+			return invalid("endpoint", "sqs=https://sqs.us-east-1.amazonaws.com", "service must be one of %s, got %q", strings.Join(EndpointServices, ", "), service)
+		}
+		if u, err := url.Parse(c.Endpoints[service]); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalid("endpoint", service+"=https://"+service+".us-east-1.amazonaws.com", "must be the http or https url of the endpoint, got %q", c.Endpoints[service])
+		}
+	}
+	if err := ValidateResourceTags(c.Tags); err != nil {
+		return err
+	}
+	if c.WebIdentityRole != "" {
+		if a, err := arn.Parse(c.WebIdentityRole); err != nil || a.Service != "iam" || !strings.HasPrefix(a.Resource, "role/") || !isPartition(a.Partition) {
+			return invalid("web-identity-role", "arn:aws:iam::123456789012:role/lifecycled", "must be the arn of an iam role, got %q", c.WebIdentityRole)
+		}
+		if c.WebIdentityTokenFile == "" {
+			return invalid("web-identity-token-file", "/var/run/secrets/eks.amazonaws.com/serviceaccount/token", "is required with web-identity-role")
+		}
+	}
+	if c.STSRegionalEndpoints != "" && c.STSRegionalEndpoints != STSRegional && c.STSRegionalEndpoints != STSLegacy {
+		return invalid("sts-regional-endpoints", STSRegional, "must be %s or %s, got %q", STSRegional, STSLegacy, c.STSRegionalEndpoints)
+	}
+	if c.AssumeRole == "" && (c.AssumeRoleExternalID != "" || c.AssumeRoleSessionName != "") {
+		return invalid("assume-role", "arn:aws:iam::123456789012:role/drain", "is required with assume-role-external-id and assume-role-session-name")
+	}
+	if c.AssumeRoleSessionName != "" && !sessionNamePattern.MatchString(c.AssumeRoleSessionName) {
+		return invalid("assume-role-session-name", "lifecycled-drain", "must be 2 to 64 letters, digits or any of +=,.@_-, got %q", c.AssumeRoleSessionName)
+	}
+	if (c.DebugVars || c.Pprof) && c.HealthAddress == "" {
+		return invalid("health-address", "localhost:8080", "is required with debug-vars and pprof")
+	}
+	return nil
+}
+
+// ValidateRegion checks that the topics are in the region of the AWS clients, since the queue is
+// created in the region and the topic can't be subscribed to from another, so that the mistake is
+// reported on start-up rather than as a failure to subscribe. The role to assume must be in the
+// partition of the region.
+func (c *Config) ValidateRegion(region string) error {
+	if region == "" {
+		return nil
+	}
+	for _, t := range []struct{ flag, topic string }{{"sns-topic", c.SNSTopic}, {"completion-topic", c.CompletionTopic}} {
+		if t.topic == "" {
+			continue
+		}
+		if a, err := arn.Parse(t.topic); err == nil && a.Region != region {
+			expected := a
+			expected.Partition, expected.Region = regionPartition(region), region
+			return invalid(t.flag, expected.String(), "must be in the region of the aws clients (%s), got a topic in %s", region, a.Region)
+		}
+	}
+	if a, err := arn.Parse(c.AssumeRole); err == nil && a.Partition != regionPartition(region) {
+		expected := a
+		expected.Partition = regionPartition(region)
+		return invalid("assume-role", expected.String(), "must be in the partition of the region of the aws clients (%s), got a role in %s", expected.Partition, a.Partition)
+	}
+	if a, err := arn.Parse(c.WebIdentityRole); err == nil && a.Partition != regionPartition(region) {
+		expected := a
+		expected.Partition = regionPartition(region)
+		return invalid("web-identity-role", expected.String(), "must be in the partition of the region of the aws clients (%s), got a role in %s", expected.Partition, a.Partition)
+	}
+	return nil
+}
+
+// validateSecondaryTopics checks that the secondary topics are topics of other regions than the
+// topic and each other, since the queue of each region is named after the instance.
+func (c *Config) validateSecondaryTopics() error {
+	if len(c.SecondarySNSTopics) == 0 {
+		return nil
+	}
+	const example = "arn:aws:sns:us-west-2:123456789012:lifecycled"
+	if c.SNSTopic == "" {
+		return invalid("sns-topic", "arn:aws:sns:us-east-1:123456789012:lifecycled", "is required with secondary-sns-topic")
+	}
+	regions := map[string]string{topicRegion(c.SNSTopic): c.SNSTopic}
+	for _, topic := range c.SecondarySNSTopics {
+		if !isTopicARN(topic) {
+			return invalid("secondary-sns-topic", example, "must be the arn of an sns topic, got %q", topic)
+		}
+		if err := validatePartition("secondary-sns-topic", topic); err != nil {
+			return err
+		}
+		region := topicRegion(topic)
+		if other, ok := regions[region]; ok {
+			return invalid("secondary-sns-topic", example, "must be in another region than %s, got a topic in %s", other, region)
+		}
+		regions[region] = topic
+	}
+	return nil
+}
+
+// topicRegion returns the region of the ARN of the topic, or "" if it isn't an ARN.
+func topicRegion(topic string) string {
+	a, err := arn.Parse(topic)
+	if err != nil {
+		return ""
+	}
+	return a.Region
+}
+
+// isTopicARN returns true if s is the ARN of an SNS topic, rather than e.g. of a subscription.
+func isTopicARN(s string) bool {
+	a, err := arn.Parse(s)
+	return err == nil && a.Service == "sns" && isPartition(a.Partition) && a.Region != "" && a.AccountID != "" && a.Resource != "" && !strings.Contains(a.Resource, ":")
+}
+
+// validatePartition checks that the ARN is in the partition of its region, e.g. aws-us-gov for
+// a topic in us-gov-west-1, which AWS would reject as a topic that doesn't exist.
+func validatePartition(flag, s string) error {
+	a, err := arn.Parse(s)
+	if err != nil || a.Region == "" || a.Partition == regionPartition(a.Region) {
+		return nil
+	}
+	expected := a
+	expected.Partition = regionPartition(a.Region)
+	return invalid(flag, expected.String(), "must be in the partition of its region (%s), got %s", expected.Partition, a.Partition)
+}
+
+// Redacted returns a copy of the config where settings tagged with `secret:"true"` are redacted.
+func (c Config) Redacted() Config {
+	v := reflect.ValueOf(&c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Tag.Get("secret") != "true" {
+			continue
+		}
+		switch f := v.Field(i); {
+		case field.Type.Kind() == reflect.String && f.String() != "":
+			f.SetString("REDACTED")
+		case field.Type == reflect.TypeOf([]string{}) && f.Len() > 0:
+			// A new slice, since the copy shares the array of the config
+			redacted := make([]string, f.Len())
+			for j := range redacted {
+				redacted[j] = "REDACTED"
+			}
+			f.Set(reflect.ValueOf(redacted))
+		}
+	}
+	return c
+}
+
+// SecretKeys returns the settings that Redacted redacts, e.g. notify-webhook.
+func SecretKeys() []string {
+	keys := []string{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if key := strings.Split(field.Tag.Get("yaml"), ",")[0]; field.Tag.Get("secret") == "true" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// hasCheckpointRules returns true if any autoscaling notices are classified as checkpoints.
+func (c *Config) hasCheckpointRules() bool {
+	for _, rule := range c.AutoscalingRules {
+		if rule.Notice == NoticeCheckpoint {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
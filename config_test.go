@@ -0,0 +1,827 @@
+package lifecycled_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/triarius/lifecycled"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "lifecycled-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+sns-topic: arn:aws:sns:us-east-1:000000000000:lifecycled
+handler: /usr/local/bin/handler
+spot-listener: false
+dedup-window: 30s
+max-heartbeat-duration: "1d12h"
+shutdown-timeout: 0
+handlers:
+  spot:
+    - /usr/local/bin/drain
+    - /usr/local/bin/handler
+`)
+	defer os.Remove(path)
+
+	config := lifecycled.DefaultConfig()
+	if err := lifecycled.LoadConfig(path, config); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %s", err)
+	}
+
+	if config.SpotListener {
+		t.Error("expected spot listener to be disabled")
+	}
+	if got, want := config.DedupWindow, 30*time.Second; got != want {
+		t.Errorf("expected dedup window %s and got %s", want, got)
+	}
+	if got, want := config.MaxHeartbeatDuration, 36*time.Hour; got != want {
+		t.Errorf("expected max heartbeat duration %s and got %s", want, got)
+	}
+	if got, want := config.ShutdownTimeout, time.Duration(0); got != want {
+		t.Errorf("expected shutdown timeout %s and got %s", want, got)
+	}
+	if got, want := config.AutoscalingHeartbeatJitter, time.Second; got != want {
+		t.Errorf("expected default heartbeat jitter %s to be retained and got %s", want, got)
+	}
+	if got, want := len(config.Handlers["spot"]), 2; got != want {
+		t.Errorf("expected %d spot handlers and got %d", want, got)
+	}
+}
+
+func TestConfigFileKeys(t *testing.T) {
+	path := writeConfig(t, `
+sns-topic: arn:aws:sns:us-east-1:000000000000:lifecycled
+spot-listener: false
+handlers:
+  spot:
+    - /usr/local/bin/drain
+`)
+	defer os.Remove(path)
+
+	keys, err := lifecycled.ConfigFileKeys(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := strings.Join(keys, ","), "handlers,sns-topic,spot-listener"; got != want {
+		t.Errorf("expected keys %s and got %s", want, got)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		description string
+		content     string
+		expected    string
+	}{
+		{
+			description: "unknown key",
+			content:     "handlr: /usr/local/bin/handler\n",
+			expected:    "field handlr not found",
+		},
+		{
+			description: "invalid duration",
+			content:     "handler: /usr/local/bin/handler\ndedup-window: soon\n",
+			expected:    "soon",
+		},
+		{
+			description: "duration without a unit",
+			content:     "handler: /usr/local/bin/handler\n\nshutdown-timeout: 600\n",
+			expected:    "line 3: shutdown-timeout: duration \"600\" has no unit",
+		},
+		{
+			description: "unknown key after a rewritten duration",
+			content:     "handler: /usr/local/bin/handler\ndedup-window: 1d\n\nhandlr: /usr/local/bin/handler\n",
+			expected:    "line 4: field handlr not found",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			path := writeConfig(t, tc.content)
+			defer os.Remove(path)
+
+			err := lifecycled.LoadConfig(path, lifecycled.DefaultConfig())
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected an error containing '%s' and got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		description string
+		modify      func(*lifecycled.Config)
+		expectError bool
+	}{
+		{
+			description: "valid",
+			modify:      func(c *lifecycled.Config) { c.Handler = "/usr/local/bin/handler" },
+		},
+		{
+			description: "missing handler",
+			modify:      func(c *lifecycled.Config) {},
+			expectError: true,
+		},
+		{
+			description: "unknown notice type",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Handlers = map[string][]string{"reboot": {"/usr/local/bin/handler"}}
+			},
+			expectError: true,
+		},
+		{
+			description: "handlers for every notice type",
+			modify: func(c *lifecycled.Config) {
+				c.Handlers = map[string][]string{
+					"autoscaling": {"/usr/local/bin/handler"},
+					"spot":        {"/usr/local/bin/handler"},
+				}
+			},
+		},
+		{
+			description: "invalid autoscaling rule",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AutoscalingRules = []lifecycled.NoticeRule{{Hook: "refresh-*", Notice: "pause"}}
+			},
+			expectError: true,
+		},
+		{
+			description: "checkpoint rules without a checkpoint handler",
+			modify: func(c *lifecycled.Config) {
+				c.Handlers = map[string][]string{
+					"autoscaling": {"/usr/local/bin/handler"},
+					"spot":        {"/usr/local/bin/handler"},
+				}
+				c.AutoscalingRules = []lifecycled.NoticeRule{{Hook: "refresh-*", Notice: lifecycled.NoticeCheckpoint}}
+			},
+			expectError: true,
+		},
+		{
+			description: "checkpoint rules with a checkpoint handler",
+			modify: func(c *lifecycled.Config) {
+				c.Handlers = map[string][]string{
+					"autoscaling":            {"/usr/local/bin/handler"},
+					"autoscaling-checkpoint": {"/usr/local/bin/checkpoint"},
+					"spot":                   {"/usr/local/bin/handler"},
+				}
+				c.AutoscalingRules = []lifecycled.NoticeRule{{Hook: "refresh-*", Notice: lifecycled.NoticeCheckpoint}}
+			},
+		},
+		{
+			description: "invalid panic result",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.PanicResult = "IGNORE"
+			},
+			expectError: true,
+		},
+		{
+			description: "invalid shutdown policy",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.ShutdownPolicy = "ignore"
+			},
+			expectError: true,
+		},
+		{
+			description: "invalid log format",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.LogFormat = "logfmt"
+			},
+			expectError: true,
+		},
+		{
+			description: "invalid log level",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.LogLevels = map[string]string{"queue": "loud"}
+			},
+			expectError: true,
+		},
+		{
+			description: "handler args without a handler",
+			modify: func(c *lifecycled.Config) {
+				c.Handlers = map[string][]string{"spot": {"/usr/local/bin/handler"}, "autoscaling": {"/usr/local/bin/handler"}}
+				c.HandlerArgs = []string{"--fast"}
+			},
+			expectError: true,
+		},
+		{
+			description: "builtin handler",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "builtin:k8s-drain"
+				c.DrainTimeout = 10 * time.Minute
+			},
+		},
+		{
+			description: "unknown builtin handler",
+			modify: func(c *lifecycled.Config) {
+				c.Handlers = map[string][]string{"spot": {"builtin:kubectl"}, "autoscaling": {"/usr/local/bin/handler"}}
+			},
+			expectError: true,
+		},
+		{
+			description: "builtin handler with handler args",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "builtin:k8s-drain"
+				c.HandlerArgs = []string{"--fast"}
+			},
+			expectError: true,
+		},
+		{
+			description: "assume role",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AssumeRole = "arn:aws:iam::123456789012:role/drain"
+				c.AssumeRoleSessionName = "drain@i-000000000000"
+			},
+		},
+		{
+			description: "assume role that is not a role arn",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AssumeRole = "arn:aws:sns:us-east-1:123456789012:drain"
+			},
+			expectError: true,
+		},
+		{
+			description: "invalid assume role session name",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AssumeRole = "arn:aws:iam::123456789012:role/drain"
+				c.AssumeRoleSessionName = "lifecycled i-000000000000"
+			},
+			expectError: true,
+		},
+		{
+			description: "instance id",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.InstanceID = "i-0123456789abcdef0"
+			},
+		},
+		{
+			description: "malformed instance id",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.InstanceID = "0123456789abcdef0"
+			},
+			expectError: true,
+		},
+		{
+			description: "sns topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+			},
+		},
+		{
+			description: "sns topic that is not an arn",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SNSTopic = "lifecycled"
+			},
+			expectError: true,
+		},
+		{
+			description: "sns subscription instead of a topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled:0b73e50c-26b8-4a5c-bd1f-7ac1e1e6c1d5"
+			},
+			expectError: true,
+		},
+		{
+			description: "sqs queue instead of a topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SNSTopic = "arn:aws:sqs:us-east-1:123456789012:lifecycled"
+			},
+			expectError: true,
+		},
+		{
+			description: "secondary topic in another region",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+				c.SecondarySNSTopics = []string{"arn:aws:sns:us-west-2:123456789012:lifecycled"}
+			},
+		},
+		{
+			description: "secondary topic without an sns topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SecondarySNSTopics = []string{"arn:aws:sns:us-west-2:123456789012:lifecycled"}
+			},
+			expectError: true,
+		},
+		{
+			description: "secondary topic in the region of the sns topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+				c.SecondarySNSTopics = []string{"arn:aws:sns:us-east-1:123456789012:lifecycled-mirror"}
+			},
+			expectError: true,
+		},
+		{
+			description: "heartbeat interval below the minimum",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AutoscalingHeartbeatInterval = time.Second
+			},
+			expectError: true,
+		},
+		{
+			description: "heartbeat interval above the maximum",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AutoscalingHeartbeatInterval = 3 * time.Hour
+			},
+			expectError: true,
+		},
+		{
+			description: "heartbeat interval within the bounds",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AutoscalingHeartbeatInterval = 5 * time.Minute
+			},
+		},
+		{
+			description: "heartbeat interval at the maximum",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AutoscalingHeartbeatInterval = time.Hour
+			},
+		},
+		{
+			description: "heartbeat interval just above the maximum",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AutoscalingHeartbeatInterval = time.Hour + time.Second
+			},
+			expectError: true,
+		},
+		{
+			description: "spot listener interval below the minimum",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SpotListenerInterval = 500 * time.Millisecond
+			},
+			expectError: true,
+		},
+		{
+			description: "spot listener interval above the maximum",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SpotListenerInterval = 2 * time.Minute
+			},
+			expectError: true,
+		},
+		{
+			description: "spot listener interval of a disabled listener",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SpotListener = false
+				c.SNSTopic = "arn:aws:sns:us-east-1:000000000000:lifecycled"
+				c.SpotListenerInterval = 2 * time.Minute
+			},
+		},
+		{
+			description: "invalid region",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Region = "us-east"
+			},
+			expectError: true,
+		},
+		{
+			description: "topic in another region",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Region = "eu-west-1"
+				c.SNSTopic = "arn:aws:sns:us-east-1:000000000000:lifecycled"
+			},
+			expectError: true,
+		},
+		{
+			description: "topic in the region",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Region = "us-gov-west-1"
+				c.SNSTopic = "arn:aws-us-gov:sns:us-gov-west-1:000000000000:lifecycled"
+			},
+		},
+		{
+			description: "endpoint of a service",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Endpoints = map[string]string{"sqs": "https://vpce-0123.sqs.us-east-1.vpce.amazonaws.com"}
+			},
+		},
+		{
+			description: "endpoint of an unknown service",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Endpoints = map[string]string{"s3": "https://s3.us-east-1.amazonaws.com"}
+			},
+			expectError: true,
+		},
+		{
+			description: "endpoint without a scheme",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Endpoints = map[string]string{"sqs": "localhost:4566"}
+			},
+			expectError: true,
+		},
+		{
+			description: "tags",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Tags = map[string]string{"Team": "platform", "cost-centre": "", "app:name": "web server"}
+			},
+		},
+		{
+			description: "tag with a reserved key",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Tags = map[string]string{"aws:team": "platform"}
+			},
+			expectError: true,
+		},
+		{
+			description: "no max heartbeat duration",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.MaxHeartbeatDuration = 0
+			},
+			expectError: true,
+		},
+		{
+			description: "negative duration",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.ShutdownTimeout = -time.Second
+			},
+			expectError: true,
+		},
+		{
+			description: "no handler concurrency",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.HandlerConcurrency = 0
+			},
+			expectError: true,
+		},
+		{
+			description: "completion topic and webhook",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.CompletionTopic = "arn:aws:sns:us-east-1:123456789012:drained"
+				c.CompletionWebhook = "https://example.com/drained"
+			},
+			expectError: true,
+		},
+		{
+			description: "completion webhook token without a webhook",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.CompletionWebhookToken = "secret"
+			},
+			expectError: true,
+		},
+		{
+			description: "notify webhook and notify webhook file",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.NotifyWebhook = "https://hooks.slack.com/services/secret"
+				c.NotifyWebhookFile = "/etc/lifecycled/notify-webhook"
+			},
+			expectError: true,
+		},
+		{
+			description: "notify webhook file",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.NotifyWebhookFile = "/etc/lifecycled/notify-webhook"
+			},
+		},
+		{
+			description: "completion webhook token file without a webhook",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.CompletionWebhookTokenFile = "/etc/lifecycled/token"
+			},
+			expectError: true,
+		},
+		{
+			description: "statsd tags file without an address",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.StatsdTagsFile = "/etc/lifecycled/statsd-tags"
+			},
+			expectError: true,
+		},
+		{
+			description: "cloudwatch stream without a group",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.CloudwatchStream = "drain"
+			},
+			expectError: true,
+		},
+		{
+			description: "statsd tags without an address",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.StatsdTags = []string{"env:production"}
+			},
+			expectError: true,
+		},
+		{
+			description: "assume role external id without a role",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AssumeRoleExternalID = "lifecycled"
+			},
+			expectError: true,
+		},
+		{
+			description: "asg preset with a topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Preset = lifecycled.PresetAutoscaling
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+			},
+		},
+		{
+			description: "asg preset without a topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Preset = lifecycled.PresetAutoscaling
+			},
+			expectError: true,
+		},
+		{
+			description: "asg preset with the autoscaling listener disabled",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Preset = lifecycled.PresetAutoscaling
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+				c.NoAutoscaling = true
+			},
+			expectError: true,
+		},
+		{
+			description: "spot listener disabled without a topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SpotListener = false
+			},
+			expectError: true,
+		},
+		{
+			description: "every listener disabled",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.SpotListener = false
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+				c.NoAutoscaling = true
+			},
+			expectError: true,
+		},
+		{
+			description: "autoscaling listener disabled with a topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handlers = map[string][]string{"spot": {"/usr/local/bin/handler"}}
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+				c.NoAutoscaling = true
+			},
+		},
+		{
+			description: "handlers for the enabled listeners",
+			modify: func(c *lifecycled.Config) {
+				c.Handlers = map[string][]string{"autoscaling": {"/usr/local/bin/handler"}}
+				c.SpotListener = false
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+			},
+		},
+		{
+			description: "web identity",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.WebIdentityTokenFile = "/var/run/secrets/eks.amazonaws.com/serviceaccount/token"
+				c.WebIdentityRole = "arn:aws:iam::123456789012:role/lifecycled"
+			},
+		},
+		{
+			description: "web identity role that is not a role",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.WebIdentityTokenFile = "/var/run/secrets/eks.amazonaws.com/serviceaccount/token"
+				c.WebIdentityRole = "arn:aws:iam::123456789012:user/lifecycled"
+			},
+			expectError: true,
+		},
+		{
+			description: "web identity role without a token file",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.WebIdentityRole = "arn:aws:iam::123456789012:role/lifecycled"
+			},
+			expectError: true,
+		},
+		{
+			description: "legacy sts endpoints",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.STSRegionalEndpoints = lifecycled.STSLegacy
+			},
+		},
+		{
+			description: "unknown sts endpoints",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.STSRegionalEndpoints = "global"
+			},
+			expectError: true,
+		},
+		{
+			description: "negative autoscaling rate limit",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AutoscalingRateLimit = -1
+			},
+			expectError: true,
+		},
+		{
+			description: "autoscaling rate limit",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.AutoscalingRateLimit = 5
+			},
+		},
+		{
+			description: "spot preset with a topic",
+			modify: func(c *lifecycled.Config) {
+				c.Handler = "/usr/local/bin/handler"
+				c.Preset = lifecycled.PresetSpot
+				c.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			config := lifecycled.DefaultConfig()
+			tc.modify(config)
+
+			err := config.Validate()
+			if tc.expectError && err == nil {
+				t.Error("expected an error")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestConfigValidateInvalidDurations(t *testing.T) {
+	config := lifecycled.DefaultConfig()
+	config.Handler = "/usr/local/bin/handler"
+	config.PollSummaryInterval = -time.Second
+	config.ShutdownTimeout = -time.Second
+	config.HealthThreshold = -time.Second
+
+	// The same duration is reported each time, rather than whichever of them a map yields first
+	for i := 0; i < 20; i++ {
+		err := config.Validate()
+		if err == nil || !strings.HasPrefix(err.Error(), "--poll-summary-interval ") {
+			t.Fatalf("expected the error to be of --poll-summary-interval and got: %v", err)
+		}
+	}
+}
+
+func TestConfigValidateRegion(t *testing.T) {
+	config := lifecycled.DefaultConfig()
+	config.SNSTopic = "arn:aws:sns:us-east-1:123456789012:lifecycled"
+
+	if err := config.ValidateRegion("us-east-1"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	err := config.ValidateRegion("eu-west-1")
+	if err == nil {
+		t.Fatal("expected an error for a topic in another region")
+	}
+	if !strings.Contains(err.Error(), "--sns-topic") || !strings.Contains(err.Error(), "arn:aws:sns:eu-west-1:123456789012:lifecycled") {
+		t.Errorf("expected the error to name the flag and show a valid topic: %s", err)
+	}
+}
+
+func TestConfigValidatePartitions(t *testing.T) {
+	tests := []struct {
+		description string
+		modify      func(*lifecycled.Config)
+		region      string
+		expectError string
+	}{
+		{
+			description: "govcloud topic",
+			modify:      func(c *lifecycled.Config) { c.SNSTopic = "arn:aws-us-gov:sns:us-gov-west-1:123456789012:lifecycled" },
+			region:      "us-gov-west-1",
+		},
+		{
+			description: "china topic",
+			modify:      func(c *lifecycled.Config) { c.SNSTopic = "arn:aws-cn:sns:cn-northwest-1:123456789012:lifecycled" },
+			region:      "cn-northwest-1",
+		},
+		{
+			description: "govcloud topic in the aws partition",
+			modify:      func(c *lifecycled.Config) { c.SNSTopic = "arn:aws:sns:us-gov-west-1:123456789012:lifecycled" },
+			expectError: "arn:aws-us-gov:sns:us-gov-west-1:123456789012:lifecycled",
+		},
+		{
+			description: "china completion topic in the aws partition",
+			modify: func(c *lifecycled.Config) {
+				c.SNSTopic = "arn:aws-cn:sns:cn-north-1:123456789012:lifecycled"
+				c.CompletionTopic = "arn:aws:sns:cn-north-1:123456789012:drained"
+			},
+			expectError: "arn:aws-cn:sns:cn-north-1:123456789012:drained",
+		},
+		{
+			description: "unknown partition",
+			modify:      func(c *lifecycled.Config) { c.SNSTopic = "arn:azure:sns:us-east-1:123456789012:lifecycled" },
+			expectError: "--sns-topic",
+		},
+		{
+			description: "govcloud topic in a commercial region",
+			modify:      func(c *lifecycled.Config) { c.SNSTopic = "arn:aws-us-gov:sns:us-gov-west-1:123456789012:lifecycled" },
+			region:      "us-east-1",
+			expectError: "arn:aws:sns:us-east-1:123456789012:lifecycled",
+		},
+		{
+			description: "govcloud role",
+			modify: func(c *lifecycled.Config) {
+				c.SNSTopic = "arn:aws-us-gov:sns:us-gov-east-1:123456789012:lifecycled"
+				c.AssumeRole = "arn:aws-us-gov:iam::123456789012:role/drain"
+			},
+			region: "us-gov-east-1",
+		},
+		{
+			description: "role in another partition",
+			modify: func(c *lifecycled.Config) {
+				c.SNSTopic = "arn:aws-us-gov:sns:us-gov-east-1:123456789012:lifecycled"
+				c.AssumeRole = "arn:aws:iam::123456789012:role/drain"
+			},
+			region:      "us-gov-east-1",
+			expectError: "arn:aws-us-gov:iam::123456789012:role/drain",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			config := lifecycled.DefaultConfig()
+			config.Handler = "/usr/local/bin/handler"
+			config.Region = tc.region
+			tc.modify(config)
+
+			err := config.Validate()
+			if tc.expectError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tc.expectError) {
+				t.Errorf("expected the error to contain %s and got: %s", tc.expectError, err)
+			}
+		})
+	}
+}
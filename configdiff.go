@@ -0,0 +1,81 @@
+package lifecycled
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReloadableSettings are the settings that a running daemon reloads from its configuration file on
+// SIGHUP. Changing any other setting needs the daemon to be restarted.
+var ReloadableSettings = []string{"log-levels"}
+
+// CanonicalConfig returns the effective configuration keyed by the names in the configuration file,
+// with secrets redacted and the settings that are not configured omitted. The values are those of
+// JSON, with durations as strings (e.g. 1m30s) and numbers as json.Number, so that a configuration
+// compares equal to the same configuration that was read back from JSON, e.g. from a state file.
+func CanonicalConfig(c *Config) (map[string]interface{}, error) {
+	// The configuration is round tripped through YAML so that the keys and durations are the
+	// same as in the configuration file, rather than the names and nanoseconds of the fields
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(settings); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var canonical map[string]interface{}
+	if err := dec.Decode(&canonical); err != nil {
+		return nil, err
+	}
+	return canonical, nil
+}
+
+// ConfigChange is a setting that differs between two configurations, where From or To is nil
+// if the setting is not configured in that configuration.
+type ConfigChange struct {
+	Key  string      `json:"key"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+
+	// RestartRequired is false for the ReloadableSettings.
+	RestartRequired bool `json:"restartRequired"`
+}
+
+// DiffConfig returns the settings that differ between the configurations (see CanonicalConfig),
+// ordered by key. Values are compared by their JSON, so numbers and maps that are decoded
+// differently are still equal.
+func DiffConfig(from, to map[string]interface{}) []ConfigChange {
+	keys := make(map[string]bool)
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+
+	changes := []ConfigChange{}
+	for key := range keys {
+		a, _ := json.Marshal(from[key])
+		b, _ := json.Marshal(to[key])
+		if bytes.Equal(a, b) {
+			continue
+		}
+		changes = append(changes, ConfigChange{
+			Key:             key,
+			From:            from[key],
+			To:              to[key],
+			RestartRequired: !contains(ReloadableSettings, key),
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
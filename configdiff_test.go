@@ -0,0 +1,74 @@
+package lifecycled_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/triarius/lifecycled"
+)
+
+func TestCanonicalConfigRoundTrip(t *testing.T) {
+	cfg := lifecycled.DefaultConfig()
+	cfg.Handler = "/usr/local/bin/handler"
+	cfg.LogLevels = map[string]string{"queue": "debug", "daemon": "warn"}
+	cfg.InstanceTags = []string{"Team", "Service"}
+	cfg.LogFileMaxSize = 100 << 20
+
+	canonical, err := lifecycled.CanonicalConfig(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The configuration of a running daemon is read back from JSON, e.g. from the state file
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if changes := lifecycled.DiffConfig(decoded, canonical); len(changes) != 0 {
+		t.Errorf("expected no changes after a round trip and got %+v", changes)
+	}
+
+	// And serializing it again is stable
+	again, err := json.Marshal(canonical)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("expected the serialization to be stable and got:\n%s\n%s", data, again)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	running := lifecycled.DefaultConfig()
+	running.Handler = "/usr/local/bin/handler"
+	running.CheckpointDir = "/var/lib/lifecycled"
+
+	proposed := lifecycled.DefaultConfig()
+	proposed.Handler = "/usr/local/bin/handler"
+	proposed.ShutdownTimeout = 30 * time.Second
+	proposed.LogLevels = map[string]string{"queue": "debug"}
+
+	from, err := lifecycled.CanonicalConfig(running)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	to, err := lifecycled.CanonicalConfig(proposed)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []lifecycled.ConfigChange{
+		{Key: "checkpoint-dir", From: "/var/lib/lifecycled", RestartRequired: true},
+		{Key: "log-levels", To: map[string]interface{}{"queue": "debug"}},
+		{Key: "shutdown-timeout", From: "10s", To: "30s", RestartRequired: true},
+	}
+	if got := lifecycled.DiffConfig(from, to); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected changes %+v and got %+v", expected, got)
+	}
+}
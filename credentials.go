@@ -0,0 +1,265 @@
+package lifecycled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/sirupsen/logrus"
+)
+
+// assumeRoleExpiryWindow is how long before they expire the credentials of the assumed role
+// are refreshed, so that calls in flight don't fail with expired credentials.
+const assumeRoleExpiryWindow = 5 * time.Minute
+
+// NewAWSConfig returns the configuration of the AWS clients in the region (see ResolveRegion),
+// with the named profile of the shared configuration if AWSProfile is set, the Endpoints, an
+// HTTP client with the timeouts of the config, the credentials of the web identity if there is
+// one (see WebIdentityCredentials) and those of AssumeRole if it is set, which is assumed with
+// them. The roles are assumed when the credentials are first needed, and again before they
+// expire.
+func NewAWSConfig(ctx context.Context, c *Config, region string) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, c.loadOptions(region)...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	cfg.HTTPClient = newHTTPClient(c)
+	if file, role := c.webIdentity(); file != "" {
+		if role == "" {
+			return aws.Config{}, invalid("web-identity-role", "arn:aws:iam::123456789012:role/lifecycled", "or AWS_ROLE_ARN is required with the web identity token file %s", file)
+		}
+		cfg.Credentials = WebIdentityCredentials(sts.NewFromConfig(cfg), c)
+	}
+	if c.AssumeRole != "" {
+		cfg.Credentials = AssumeRoleCredentials(sts.NewFromConfig(cfg), c)
+	}
+	AddUserAgent(&cfg)
+	return cfg, nil
+}
+
+// AssumeRoleCredentials returns the credentials of the AssumeRole of the configuration, which are
+// refreshed before they expire. Failures to assume the role wrap ErrCredentials, including those
+// of the AWS API calls that need the credentials.
+func AssumeRoleCredentials(client stscreds.AssumeRoleAPIClient, c *Config) aws.CredentialsProvider {
+	return aws.NewCredentialsCache(&assumeRoleProvider{client: client, config: c}, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = assumeRoleExpiryWindow
+	})
+}
+
+// assumeRoleProvider wraps the errors of the provider, and names the session when the role is
+// assumed, since the instance id may only be looked up once the configuration has been created.
+type assumeRoleProvider struct {
+	client stscreds.AssumeRoleAPIClient
+	config *Config
+}
+
+func (p *assumeRoleProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	provider := stscreds.NewAssumeRoleProvider(p.client, p.config.AssumeRole, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = p.config.assumeRoleSessionName()
+		if p.config.AssumeRoleExternalID != "" {
+			o.ExternalID = aws.String(p.config.AssumeRoleExternalID)
+		}
+	})
+	v, err := provider.Retrieve(ctx)
+	if err != nil {
+		return v, wrapError(ErrCredentials, err)
+	}
+	return v, nil
+}
+
+// WebIdentityCredentials returns the credentials of the role of the web identity of the
+// configuration (see Config.WebIdentityTokenFile), which are refreshed before they expire. The
+// token file is read each time, since it is rotated. Failures to assume the role wrap
+// ErrCredentials.
+func WebIdentityCredentials(client stscreds.AssumeRoleWithWebIdentityAPIClient, c *Config) aws.CredentialsProvider {
+	return aws.NewCredentialsCache(&webIdentityProvider{client: client, config: c}, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = assumeRoleExpiryWindow
+	})
+}
+
+// webIdentityProvider names the session of the role of the web identity when it is assumed,
+// like assumeRoleProvider.
+type webIdentityProvider struct {
+	client stscreds.AssumeRoleWithWebIdentityAPIClient
+	config *Config
+}
+
+func (p *webIdentityProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	file, role := p.config.webIdentity()
+	provider := stscreds.NewWebIdentityRoleProvider(p.client, role, stscreds.IdentityTokenFile(file), func(o *stscreds.WebIdentityRoleOptions) {
+		o.RoleSessionName = os.Getenv("AWS_ROLE_SESSION_NAME")
+		if o.RoleSessionName == "" {
+			o.RoleSessionName = p.config.assumeRoleSessionName()
+		}
+	})
+	v, err := provider.Retrieve(ctx)
+	if err != nil {
+		return v, wrapError(ErrCredentials, err)
+	}
+	return v, nil
+}
+
+// webIdentity returns the token file and role of the web identity: WebIdentityTokenFile and
+// WebIdentityRole, or AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN when the AWS SDK would use
+// them, without a profile or the keys of AWS_ACCESS_KEY_ID. The file is empty without one.
+func (c *Config) webIdentity() (file, role string) {
+	if c.WebIdentityTokenFile != "" {
+		role = c.WebIdentityRole
+		if role == "" {
+			role = os.Getenv("AWS_ROLE_ARN")
+		}
+		return c.WebIdentityTokenFile, role
+	}
+	if c.AWSProfile != "" || os.Getenv("AWS_PROFILE") != "" || os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		return "", ""
+	}
+	return os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+}
+
+// Credential sources of CredentialSource.
+const (
+	CredentialSourceEnvironment     = "environment"
+	CredentialSourceSharedConfig    = "shared-config"
+	CredentialSourceWebIdentity     = "web-identity"
+	CredentialSourceAssumeRole      = "assume-role"
+	CredentialSourceInstanceProfile = "instance-profile"
+	CredentialSourceContainer       = "container"
+	CredentialSourceSSO             = "sso"
+	CredentialSourceProcess         = "process"
+	CredentialSourceStatic          = "static"
+)
+
+// credentialSources are the credential sources by the names of the providers of the AWS SDK,
+// which they set as the Source of the credentials.
+var credentialSources = map[string]string{
+	"EnvConfigCredentials":        CredentialSourceEnvironment,
+	"SharedConfigCredentials":     CredentialSourceSharedConfig,
+	"WebIdentityCredentials":      CredentialSourceWebIdentity,
+	"AssumeRoleProvider":          CredentialSourceAssumeRole,
+	"EC2RoleProvider":             CredentialSourceInstanceProfile,
+	"CredentialsEndpointProvider": CredentialSourceContainer,
+	"SSOProvider":                 CredentialSourceSSO,
+	"ProcessProvider":             CredentialSourceProcess,
+	"StaticCredentials":           CredentialSourceStatic,
+}
+
+// CredentialSource retrieves the credentials of the AWS configuration, and returns where they
+// came from, e.g. web-identity or instance-profile, or the Source of the credentials if it isn't
+// one of the credential sources. Since the credentials are cached, the AWS API calls reuse them.
+func CredentialSource(ctx context.Context, cfg aws.Config) (string, error) {
+	if cfg.Credentials == nil {
+		return "", wrapError(ErrCredentials, errors.New("no credentials are configured"))
+	}
+	v, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+	// The credentials of the shared files are named after the file, e.g.
+	// "SharedConfigCredentials: /root/.aws/credentials"
+	name := strings.SplitN(v.Source, ":", 2)[0]
+	if source, ok := credentialSources[name]; ok {
+		return source, nil
+	}
+	return v.Source, nil
+}
+
+// assumeRoleSessionName returns the configured session name, or lifecycled-<instance id>.
+func (c *Config) assumeRoleSessionName() string {
+	if c.AssumeRoleSessionName != "" {
+		return c.AssumeRoleSessionName
+	}
+	if c.InstanceID == "" {
+		return "lifecycled"
+	}
+	return "lifecycled-" + c.InstanceID
+}
+
+// credentialErrorCodes are the error codes of the AWS APIs that reject the credentials of a
+// call, e.g. once the session of an assumed role has expired.
+var credentialErrorCodes = map[string]bool{
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"InvalidClientTokenId":        true,
+	"InvalidToken":                true,
+	"TokenRefreshRequired":        true,
+	"UnrecognizedClientException": true,
+}
+
+// isCredentialRejected returns true if the AWS API rejected the credentials of the call, which
+// may succeed with refreshed credentials.
+func isCredentialRejected(err error) bool {
+	e, ok := apiError(err)
+	return ok && credentialErrorCodes[e.ErrorCode()]
+}
+
+// isCredentialError returns true if the AWS API call failed for its credentials: they were
+// rejected, or couldn't be retrieved (see ErrCredentials).
+func isCredentialError(err error) bool {
+	return isCredentialRejected(err) || errors.Is(err, ErrCredentials)
+}
+
+// maxCredentialFailures is the number of consecutive AWS API calls that fail for their
+// credentials before the daemon is unhealthy.
+const maxCredentialFailures = 3
+
+// credentialHealth tracks the consecutive AWS API calls that failed for their credentials, so
+// that credentials that keep failing are logged as an error and fail the health check, rather
+// than heartbeats failing with warnings until the lifecycle action times out. A nil
+// credentialHealth discards the calls.
+type credentialHealth struct {
+	mu        sync.Mutex
+	failures  int
+	since     time.Time
+	lastError string
+}
+
+// observe records the outcome of an AWS API call, other than a failure for another reason.
+func (h *credentialHealth) observe(log *logrus.Entry, err error) {
+	if h == nil || (err != nil && !isCredentialError(err)) {
+		return
+	}
+	h.mu.Lock()
+	failing := h.failures >= maxCredentialFailures
+	if err == nil {
+		h.failures, h.since, h.lastError = 0, time.Time{}, ""
+	} else {
+		if h.failures == 0 {
+			h.since = time.Now()
+		}
+		h.failures++
+		h.lastError = err.Error()
+	}
+	failures, since := h.failures, h.since
+	h.mu.Unlock()
+
+	switch {
+	case err != nil && failures == maxCredentialFailures:
+		log.WithError(err).WithFields(logrus.Fields{
+			"failures": failures,
+			"since":    since.Format(time.RFC3339),
+		}).Error("AWS API calls keep failing for their credentials, check the role and the duration of its sessions")
+	case err == nil && failing:
+		log.Info("Recovered from failing aws credentials")
+	}
+}
+
+// err returns an error once the AWS API calls have failed repeatedly for their credentials.
+func (h *credentialHealth) err() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failures < maxCredentialFailures {
+		return nil
+	}
+	return fmt.Errorf("aws credentials have failed %d consecutive calls since %s: %s", h.failures, h.since.Format(time.RFC3339), h.lastError)
+}
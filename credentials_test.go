@@ -0,0 +1,330 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/aws/smithy-go"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// fakeSTS assumes roles with the output and error, and records the inputs.
+type fakeSTS struct {
+	inputs []*sts.AssumeRoleInput
+	err    error
+}
+
+func (s *fakeSTS) AssumeRole(_ context.Context, input *sts.AssumeRoleInput, _ ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	s.inputs = append(s.inputs, input)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &sts.AssumeRoleOutput{Credentials: &ststypes.Credentials{
+		AccessKeyId:     aws.String("AKID"),
+		SecretAccessKey: aws.String("SECRET"),
+		SessionToken:    aws.String("TOKEN"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+func TestAssumeRoleCredentials(t *testing.T) {
+	client := &fakeSTS{}
+	cfg := &lifecycled.Config{
+		AssumeRole:           "arn:aws:iam::123456789012:role/drain",
+		AssumeRoleExternalID: "external",
+	}
+	creds := lifecycled.AssumeRoleCredentials(client, cfg)
+
+	// The session is named after the instance id, which may be looked up after the credentials are created
+	cfg.InstanceID = "i-000000000000"
+	v, err := creds.Retrieve(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if v.AccessKeyID != "AKID" {
+		t.Errorf("expected the credentials of the role and got '%s'", v.AccessKeyID)
+	}
+	if _, err := creds.Retrieve(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := len(client.inputs), 1; got != want {
+		t.Fatalf("expected the role to be assumed %d times and got %d", want, got)
+	}
+	input := client.inputs[0]
+	if got, want := aws.ToString(input.RoleArn), cfg.AssumeRole; got != want {
+		t.Errorf("expected role '%s' and got '%s'", want, got)
+	}
+	if got, want := aws.ToString(input.RoleSessionName), "lifecycled-i-000000000000"; got != want {
+		t.Errorf("expected session name '%s' and got '%s'", want, got)
+	}
+	if got, want := aws.ToString(input.ExternalId), "external"; got != want {
+		t.Errorf("expected external id '%s' and got '%s'", want, got)
+	}
+}
+
+// fakeWebIdentitySTS assumes roles with web identities, and records the inputs.
+type fakeWebIdentitySTS struct {
+	inputs []*sts.AssumeRoleWithWebIdentityInput
+}
+
+func (s *fakeWebIdentitySTS) AssumeRoleWithWebIdentity(_ context.Context, input *sts.AssumeRoleWithWebIdentityInput, _ ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	s.inputs = append(s.inputs, input)
+	if aws.ToString(input.WebIdentityToken) != "token" {
+		return nil, &smithy.GenericAPIError{Code: "InvalidIdentityToken", Message: "invalid token"}
+	}
+	return &sts.AssumeRoleWithWebIdentityOutput{Credentials: &ststypes.Credentials{
+		AccessKeyId:     aws.String("AKID"),
+		SecretAccessKey: aws.String("SECRET"),
+		SessionToken:    aws.String("TOKEN"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+func TestWebIdentityCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(file, []byte("token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeWebIdentitySTS{}
+	cfg := &lifecycled.Config{
+		WebIdentityTokenFile: file,
+		WebIdentityRole:      "arn:aws:iam::123456789012:role/lifecycled",
+		InstanceID:           "i-000000000000",
+	}
+	creds := lifecycled.WebIdentityCredentials(client, cfg)
+	source, err := lifecycled.CredentialSource(context.TODO(), aws.Config{Credentials: creds})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if source != lifecycled.CredentialSourceWebIdentity {
+		t.Errorf("expected credentials from %s and got %s", lifecycled.CredentialSourceWebIdentity, source)
+	}
+	if got, want := len(client.inputs), 1; got != want {
+		t.Fatalf("expected the role to be assumed %d times and got %d", want, got)
+	}
+	input := client.inputs[0]
+	if got, want := aws.ToString(input.RoleArn), cfg.WebIdentityRole; got != want {
+		t.Errorf("expected role '%s' and got '%s'", want, got)
+	}
+	if got, want := aws.ToString(input.RoleSessionName), "lifecycled-i-000000000000"; got != want {
+		t.Errorf("expected session name '%s' and got '%s'", want, got)
+	}
+
+	// A token that is rejected is a credentials error
+	if err := ioutil.WriteFile(file, []byte("rotated"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lifecycled.WebIdentityCredentials(client, cfg).Retrieve(context.TODO()); !errors.Is(err, lifecycled.ErrCredentials) {
+		t.Errorf("expected a credentials error and got: %v", err)
+	}
+}
+
+func TestCredentialSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{source: "EnvConfigCredentials", expected: lifecycled.CredentialSourceEnvironment},
+		{source: "SharedConfigCredentials: /root/.aws/credentials", expected: lifecycled.CredentialSourceSharedConfig},
+		{source: "EC2RoleProvider", expected: lifecycled.CredentialSourceInstanceProfile},
+		{source: "CredentialsEndpointProvider", expected: lifecycled.CredentialSourceContainer},
+		{source: "CustomProvider", expected: "CustomProvider"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.source, func(t *testing.T) {
+			provider := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+				return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", Source: tc.source}, nil
+			})
+			source, err := lifecycled.CredentialSource(context.TODO(), aws.Config{Credentials: provider})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if source != tc.expected {
+				t.Errorf("expected %s and got %s", tc.expected, source)
+			}
+		})
+	}
+}
+
+func TestAssumeRoleCredentialsError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	client := &fakeSTS{err: errors.New("AccessDenied: not authorized to perform sts:AssumeRole")}
+	sq := sqs.New(sqs.Options{
+		Region:           "us-east-1",
+		EndpointResolver: sqs.EndpointResolverFromURL(server.URL),
+		Retryer:          aws.NopRetryer{},
+		Credentials:      lifecycled.AssumeRoleCredentials(client, &lifecycled.Config{AssumeRole: "arn:aws:iam::123456789012:role/drain"}),
+	})
+
+	// The API calls fail with the error, so that it is reported by the listeners
+	_, err := sq.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{QueueUrl: aws.String(server.URL)})
+	if !errors.Is(err, lifecycled.ErrCredentials) {
+		t.Fatalf("expected an error that wraps ErrCredentials and got: %v", err)
+	}
+	if got, want := lifecycled.ErrorCode(err), lifecycled.CodeCredentials; got != want {
+		t.Errorf("expected error code '%s' and got '%s'", want, got)
+	}
+	if requests != 0 {
+		t.Errorf("expected no requests without credentials and got %d", requests)
+	}
+}
+
+// rotatingProvider returns new credentials each time they are retrieved, which don't expire.
+type rotatingProvider struct {
+	retrieved int32
+}
+
+func (p *rotatingProvider) Retrieve(context.Context) (aws.Credentials, error) {
+	n := atomic.AddInt32(&p.retrieved, 1)
+	return aws.Credentials{AccessKeyID: fmt.Sprintf("AKID%d", n), SecretAccessKey: "SECRET"}, nil
+}
+
+func TestRejectedCredentialsRefreshed(t *testing.T) {
+	// The server rejects the first credentials once they have expired
+	var expired int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&expired) == 1 && strings.Contains(r.Header.Get("Authorization"), "Credential=AKID1/") {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "<ErrorResponse><Error><Type>Sender</Type><Code>ExpiredToken</Code><Message>The security token included in the request is expired</Message></Error><RequestId>id</RequestId></ErrorResponse>")
+			return
+		}
+		fmt.Fprint(w, "<DeleteMessageResponse><DeleteMessageResult></DeleteMessageResult></DeleteMessageResponse>")
+	}))
+	defer server.Close()
+
+	provider := &rotatingProvider{}
+	sq := sqs.New(sqs.Options{
+		Region:           "us-east-1",
+		EndpointResolver: sqs.EndpointResolverFromURL(server.URL),
+		Credentials:      aws.NewCredentialsCache(provider),
+	})
+	queue := lifecycled.NewQueue("queue", "topic", sq, nil)
+
+	if err := queue.DeleteMessage(context.TODO(), "handle"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The credentials expire mid-run, and are refreshed rather than failing the call
+	atomic.StoreInt32(&expired, 1)
+	if err := queue.DeleteMessage(context.TODO(), "handle"); err != nil {
+		t.Fatalf("expected the call to succeed with refreshed credentials and got: %s", err)
+	}
+	if got := atomic.LoadInt32(&provider.retrieved); got != 2 {
+		t.Errorf("expected the credentials to be retrieved twice and got %d", got)
+	}
+}
+
+func TestCredentialsHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
+	sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
+	sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
+
+	// The polls fail for their credentials, until they are renewed once the daemon is unhealthy
+	expired := &smithy.GenericAPIError{Code: "ExpiredToken", Message: "The security token included in the request is expired"}
+	renewed := make(chan struct{})
+	var polls int32
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(4).DoAndReturn(
+		func(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+			if atomic.AddInt32(&polls, 1) <= 3 {
+				return nil, expired
+			}
+			select {
+			case <-renewed:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return &sqs.ReceiveMessageOutput{Messages: []sqstypes.Message{newSQSMessage(instanceID)}}, nil
+		},
+	)
+
+	logger, hook := logrustest.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID: instanceID,
+		SNSTopic:   "topic",
+	}, sq, sn, as, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := daemon.Start(ctx)
+		done <- err
+	}()
+
+	for daemon.Status().CredentialsError == "" {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the credentials to fail")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if err := daemon.Healthy(time.Hour); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("expected the daemon to be unhealthy for its credentials and got: %v", err)
+	}
+
+	close(renewed)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := daemon.Status().CredentialsError; got != "" {
+		t.Errorf("expected the credentials to recover and got: %s", got)
+	}
+
+	var escalated, recovered bool
+	for _, e := range hook.AllEntries() {
+		escalated = escalated || (e.Level == logrus.ErrorLevel && strings.Contains(e.Message, "credentials"))
+		recovered = recovered || e.Message == "Recovered from failing aws credentials"
+	}
+	if !escalated || !recovered {
+		t.Errorf("expected the failures to be logged as an error (%v) and the recovery (%v)", escalated, recovered)
+	}
+}
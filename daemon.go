@@ -4,29 +4,64 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
-	"os/exec"
+	"net/http"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws/ec2metadata"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/autoscaling"
-	"github.com/aws/aws-sdk-go/service/sns"
-	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// New creates a new lifecycle Daemon.
-func New(config *Config, sess *session.Session, logger *logrus.Logger) *Daemon {
-	return NewDaemon(
+// New creates a new lifecycle Daemon with the clients of the AWS configuration (see NewAWSConfig).
+func New(config *Config, cfg aws.Config, logger *logrus.Logger) *Daemon {
+	return NewWithClients(config, NewClients(cfg, config), logger)
+}
+
+// NewWithClients creates a new lifecycle Daemon with the AWS clients (see NewClients).
+func NewWithClients(config *Config, clients *Clients, logger *logrus.Logger) *Daemon {
+	metadata := clients.Metadata
+	daemon := newDaemon(
 		config,
-		sqs.New(sess),
-		sns.New(sess),
-		autoscaling.New(sess),
-		ec2metadata.New(sess),
+		clients.SQS,
+		clients.SNS,
+		clients.Autoscaling,
+		clients.KMS,
+		metadata,
 		logger,
 	)
+	if config.autoscalingListener() {
+		daemon.addSecondaryTopics(config, clients.Regions)
+	}
+	if config.CloudwatchMetricsNamespace != "" {
+		daemon.SetCloudWatchMetrics(NewCloudWatchMetrics(clients.CloudWatch, config.CloudwatchMetricsNamespace))
+	}
+	if len(config.InstanceTags) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), describeTagsTimeout)
+		defer cancel()
+		tags, err := DescribeInstanceTags(ctx, clients.EC2, config.InstanceID, config.InstanceTags)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to describe instance tags, continuing without them")
+		} else {
+			daemon.SetInstanceTags(tags)
+		}
+	}
+	// The group of the instance is only needed for the metrics of spot notices
+	metrics := config.CloudwatchMetricsNamespace != "" || config.StatsdAddress != "" || config.MetricsAddress != ""
+	if config.SpotListener && metrics {
+		ctx, cancel := context.WithTimeout(context.Background(), describeTagsTimeout)
+		defer cancel()
+		group, err := LookupGroupName(ctx, clients.EC2, metadata, config.InstanceID)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to look up the autoscaling group of the instance, the metrics of spot notices won't have it")
+		} else {
+			daemon.SetGroupName(group)
+		}
+	}
+	return daemon
 }
 
 // NewDaemon creates a new Daemon.
@@ -35,101 +70,863 @@ func NewDaemon(
 	sqsClient SQSClient,
 	snsClient SNSClient,
 	asgClient AutoscalingClient,
-	metadata *ec2metadata.EC2Metadata,
+	metadata *imds.Client,
+	logger *logrus.Logger,
+) *Daemon {
+	return newDaemon(config, sqsClient, snsClient, asgClient, nil, metadata, logger)
+}
+
+// newDaemon creates a new Daemon, whose autoscaling listener checks the key of the topic with the
+// KMS client, if any.
+func newDaemon(
+	config *Config,
+	sqsClient SQSClient,
+	snsClient SNSClient,
+	asgClient AutoscalingClient,
+	kmsClient KMSClient,
+	metadata *imds.Client,
 	logger *logrus.Logger,
 ) *Daemon {
+	concurrency := config.HandlerConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
 	daemon := &Daemon{
-		instanceID: config.InstanceID,
-		logger:     logger,
+		instanceID:     config.InstanceID,
+		logger:         logger,
+		dedupWindow:    config.DedupWindow,
+		slots:          make(chan struct{}, concurrency),
+		maxRestarts:    config.ListenerRestarts,
+		restartBackoff: config.ListenerRestartBackoff,
+		pollFailures:   config.PollFailureThreshold,
+		startThreshold: config.HandlerStartThreshold,
+		startedAt:      time.Now(),
+		changed:        make(chan struct{}, 1),
+
+		shutdownTimeout: config.ShutdownTimeout,
+
+		autoscaling:        asgClient,
+		autoscalingOptions: autoscalingOptions(config),
+		tracer:             tracerFor(config.TracerProvider),
+	}
+	daemon.metrics = newMetrics(daemon)
+	if config.StatsdAddress != "" {
+		sink, err := NewStatsdSink(config.StatsdAddress, config.statsdTags())
+		if err != nil {
+			logger.WithError(err).WithField("address", config.StatsdAddress).Warn("Failed to configure statsd, metrics will not be sent to it")
+		} else {
+			daemon.metrics.statsd = sink
+		}
+	}
+	daemon.autoscalingOptions.metrics = daemon.metrics
+	daemon.logs = newComponentLoggers(logger)
+	if err := daemon.SetLogLevels(config.LogLevels); err != nil {
+		logger.WithError(err).Warn("Invalid log levels, using the default level")
+	}
+	daemon.autoscalingOptions.logs = daemon.logs
+	if config.AutoscalingRateLimit > 0 && asgClient != nil {
+		daemon.autoscaling = newRateLimitedClient(asgClient, config.AutoscalingRateLimit, config.AutoscalingRateBurst, daemon.metrics, daemon.logs, logger)
+	}
+	daemon.credentials = &credentialHealth{}
+	daemon.autoscalingOptions.credentials = daemon.credentials
+	daemon.selfCheck = &selfCheckResults{}
+	daemon.autoscalingOptions.selfCheck = daemon.selfCheck
+	if daemon.shutdownTimeout <= 0 {
+		daemon.shutdownTimeout = defaultShutdownTimeout
+	}
+	switch {
+	case config.CompletionTopic != "":
+		daemon.publisher = NewSNSPublisher(snsClient, config.CompletionTopic)
+	case config.CompletionWebhook != "":
+		daemon.publisher = NewWebhookPublisher(config.CompletionWebhook, config.CompletionWebhookToken, nil)
+	}
+	if config.NotifyWebhook != "" {
+		var events []string
+		for event, enabled := range map[string]bool{
+			NotifyReceived:      config.NotifyOnReceived,
+			NotifyHandlerFailed: config.NotifyOnFailure,
+			NotifyCompleted:     config.NotifyOnCompletion,
+			NotifyPollFailing:   config.NotifyOnPollFailure,
+			NotifyPollRecovered: config.NotifyOnPollFailure,
+		} {
+			if enabled {
+				events = append(events, event)
+			}
+		}
+		if len(events) > 0 {
+			daemon.SetNotifier(NewWebhookNotifier(config.NotifyWebhook, config.NotifyFormat, nil), config.NotifyTimeout, events...)
+		}
+	}
+	if config.AuditFile != "" {
+		daemon.auditLog = NewAuditLog(config.AuditFile, config.AuditFileMaxSize, config.AuditFileKeep)
 	}
 	if config.SpotListener {
 		daemon.AddListener(NewSpotListener(config.InstanceID, metadata, config.SpotListenerInterval))
 	}
-	if config.SNSTopic != "" {
-		queue := NewQueue(
-			fmt.Sprintf("lifecycled-%s", config.InstanceID),
-			config.SNSTopic,
-			sqsClient,
-			snsClient,
-		)
-		daemon.AddListener(NewAutoscalingListener(config.InstanceID, queue, asgClient, config.AutoscalingHeartbeatInterval))
+	daemon.disabledListeners = config.DisabledListeners()
+	if config.autoscalingListener() {
+		daemon.addAutoscalingListener(config, config.SNSTopic, sqsClient, snsClient, kmsClient)
 	}
 	return daemon
 }
 
-// Config for the Lifecycled Daemon.
-type Config struct {
-	InstanceID                   string
-	SNSTopic                     string
-	SpotListener                 bool
-	SpotListenerInterval         time.Duration
-	AutoscalingHeartbeatInterval time.Duration
+// addAutoscalingListener adds the autoscaling listener of the topic, whose queue is created with
+// the clients, and whose self-check checks the key of the topic with the KMS client, if any.
+func (d *Daemon) addAutoscalingListener(config *Config, topic string, sqsClient SQSClient, snsClient SNSClient, kmsClient KMSClient) {
+	queue := NewQueue(
+		fmt.Sprintf("lifecycled-%s", config.InstanceID),
+		topic,
+		sqsClient,
+		snsClient,
+	)
+	queue.metrics = d.metrics
+	queue.SetTags(config.Tags)
+	options := d.autoscalingOptions
+	options.kms = kmsClient
+	d.AddListener(NewAutoscalingListener(config.InstanceID, queue, d.autoscaling, options))
+}
+
+// autoscalingOptions returns the options for handling autoscaling notices.
+func autoscalingOptions(config *Config) AutoscalingOptions {
+	return AutoscalingOptions{
+		HeartbeatInterval:     config.AutoscalingHeartbeatInterval,
+		HeartbeatJitter:       config.AutoscalingHeartbeatJitter,
+		PollSummaryInterval:   config.PollSummaryInterval,
+		PanicResult:           config.PanicResult,
+		VerifyTermination:     config.VerifyTermination,
+		ShutdownTimeout:       config.ShutdownTimeout,
+		AWSCallTimeout:        config.AWSCallTimeout,
+		AWSHeartbeatTimeout:   config.AWSHeartbeatTimeout,
+		NoCleanup:             config.NoCleanup,
+		Complete:              config.Complete,
+		CompletionDelay:       config.CompletionDelay,
+		CancelOnLostAction:    config.CancelOnLostAction,
+		MaxHeartbeatDuration:  config.MaxHeartbeatDuration,
+		TimeoutResult:         config.TimeoutResult,
+		CheckpointDir:         config.CheckpointDir,
+		QuarantineDir:         config.QuarantineDir,
+		QuarantineKeep:        config.QuarantineKeep,
+		SignatureVerifier:     signatureVerifier(config),
+		RecoverHandler:        config.RecoverHandler,
+		ShutdownPolicy:        config.ShutdownPolicy,
+		BeforeHeartbeat:       config.BeforeHeartbeat,
+		Rules:                 config.AutoscalingRules,
+		TracerProvider:        config.TracerProvider,
+		PollIdleAfter:         config.PollIdleAfter,
+		PollMaxIdleGap:        config.PollMaxIdleGap,
+		IAMPropagationTimeout: config.IAMPropagationTimeout,
+		SelfCheck:             config.SelfCheck,
+		DeliveryCheck:         config.DeliveryCheck,
+		ClockSkewTolerance:    config.ClockSkewTolerance,
+		StaleMessageAge:       config.StaleMessageAge,
+	}
+}
+
+// signatureVerifier returns the verifier of the signatures of the messages if they are verified,
+// whose certificates are fetched from SNS through the proxy like the AWS APIs.
+func signatureVerifier(config *Config) *SignatureVerifier {
+	if !config.VerifySignatures {
+		return nil
+	}
+	return NewSignatureVerifier(&http.Client{
+		Timeout:   config.AWSCallTimeout,
+		Transport: &http.Transport{Proxy: proxyFromEnvironment(), TLSHandshakeTimeout: config.AWSConnectTimeout},
+	})
 }
 
+const (
+	defaultListenerBackoff = time.Second
+	maxListenerBackoff     = time.Minute
+	defaultShutdownTimeout = 10 * time.Second
+	describeTagsTimeout    = 10 * time.Second
+)
+
 // Daemon is what orchestrates the listening and execution of the handler on a termination notice.
 type Daemon struct {
 	instanceID string
 	listeners  []Listener
+	statuses   []*listenerStatus
 	logger     *logrus.Logger
+
+	// disabledListeners are the types of the listeners that the configuration disables
+	disabledListeners []string
+
+	mu             sync.Mutex
+	noticesHandled int
+	handling       []*HandlerActivity
+	ready          chan struct{}
+	dedupWindow    time.Duration
+	slots          chan struct{}
+	maxRestarts    int
+	restartBackoff time.Duration
+	handlers       map[string]Handler
+	startedAt      time.Time
+	lastError      string
+	changed        chan struct{}
+
+	// pollFailures is how long a listener can fail to poll before it is reported
+	pollFailures time.Duration
+
+	// startThreshold is the latency from the lifecycle hook firing to the handler starting
+	// that is logged as a warning
+	startThreshold time.Duration
+
+	// groupName is the autoscaling group of the instance, for the metrics of spot notices
+	groupName string
+
+	// firstNotice is set once the daemon starts handling a notice, for TimeToFirstNotice
+	firstNotice bool
+
+	// results of the notices handled by Run
+	results []Result
+
+	// credentials are the calls that failed for their AWS credentials, see Healthy
+	credentials *credentialHealth
+
+	// selfCheck are the results of the self-check of the autoscaling listener, see Healthy
+	selfCheck *selfCheckResults
+
+	publisher         EventPublisher
+	notifier          Notifier
+	notifyTimeout     time.Duration
+	notifyEvents      map[string]bool
+	cloudwatchMetrics *CloudWatchMetrics
+	auditLog          *AuditLog
+	metrics           *Metrics
+	logs              *componentLoggers
+	tracer            trace.Tracer
+	shutdownTimeout   time.Duration
+
+	// tags of the instance, as log fields and handler environment variables
+	tagFields logrus.Fields
+	tagEnv    []string
+
+	// autoscaling is used to replay autoscaling notices
+	autoscaling        AutoscalingClient
+	autoscalingOptions AutoscalingOptions
 }
 
-// Start the Daemon.
-func (d *Daemon) Start(ctx context.Context) (notice TerminationNotice, err error) {
-	log := d.logger.WithField("instanceId", d.instanceID)
+// Start the Daemon and return the first termination notice that is received. Checkpoint
+// notices are not handled by Start, and are skipped.
+func (d *Daemon) Start(ctx context.Context) (TerminationNotice, error) {
+	log := d.baseLog()
 
 	// Use a buffered channel to avoid deadlocking a goroutine when we stop listening
 	notices := make(chan TerminationNotice, len(d.listeners))
-	defer close(notices)
 
 	// Always wait for all listeners to exit before returning from this function
-	var wg sync.WaitGroup
-	defer wg.Wait()
+	listeners := d.listen(ctx, notices, log)
+	defer listeners.stop()
 
-	// Add a child context to stop all listeners when one has returned
-	listenerCtx, stopListening := context.WithCancel(ctx)
-	defer stopListening()
+	log.Info("Waiting for termination notices")
+
+	for {
+		select {
+		case <-listeners.ctx.Done():
+			return nil, listeners.failed(ctx)
+		case n := <-notices:
+			d.metrics.noticeReceived(n.Type())
+			d.wakeListeners()
+			if !isTerminating(n) {
+				log.WithField("notice", n.Type()).Warn("Skipping checkpoint notice, it is not handled by Start")
+				continue
+			}
+			log.WithField("notice", n.Type()).Info("Received termination notice")
+			return n, nil
+		}
+	}
+}
+
+// terminatingNotice is implemented by notices that don't always mean that the instance is
+// going away, such as autoscaling checkpoint notices.
+type terminatingNotice interface {
+	Terminating() bool
+}
+
+// isTerminating returns true unless the notice is a checkpoint notice.
+func isTerminating(notice TerminationNotice) bool {
+	n, ok := notice.(terminatingNotice)
+	return !ok || n.Terminating()
+}
+
+// Run the Daemon and handle termination notices with the given handler. Run returns the result
+// of handling the first notice once it has been handled and no duplicate notice has arrived within
+// the dedup window, or when the context is cancelled. Notices that arrive while a termination is
+// already being handled are coalesced: they are handled (e.g. heartbeats and completion for
+// autoscaling notices) without running the handler again, and share the result of the first notice.
+// Checkpoint notices are handled as they arrive, and the daemon keeps running.
+func (d *Daemon) Run(ctx context.Context, handler Handler) error {
+	_, err := d.RunWithSummary(ctx, handler)
+	return err
+}
+
+func (d *Daemon) run(ctx context.Context, handler Handler) (*Summary, error) {
+	log := d.baseLog()
+
+	d.mu.Lock()
+	d.results = nil
+	d.mu.Unlock()
+
+	notices := make(chan TerminationNotice, len(d.listeners))
+
+	// Deferred in this order so that notices are handled before the listeners
+	// are stopped (e.g. lifecycle actions are completed before deleting the queue)
+	listeners := d.listen(ctx, notices, log)
+	defer listeners.stop()
+
+	var inflight sync.WaitGroup
+	defer inflight.Wait()
+
+	var (
+		primary     *inflightNotice
+		primaryDone <-chan struct{}
+		window      <-chan time.Time
+	)
+
+	log.Info("Waiting for termination notices")
+
+	for {
+		select {
+		case <-listeners.ctx.Done():
+			if primary != nil {
+				inflight.Wait()
+				return primary.summary, primary.err
+			}
+			return nil, listeners.failed(ctx)
+		case n := <-notices:
+			d.metrics.noticeReceived(n.Type())
+			d.wakeListeners()
+			l := log.WithField("notice", n.Type())
+
+			// Checkpoint notices are handled while the daemon keeps waiting for a termination
+			if !isTerminating(n) {
+				l.Info("Received checkpoint notice")
+				inflight.Add(1)
+				go func() {
+					defer inflight.Done()
+					_ = d.Handle(ctx, n, handler)
+				}()
+				continue
+			}
+			l.Info("Received termination notice")
+
+			if primary == nil {
+				primary = &inflightNotice{notice: n, done: make(chan struct{})}
+				primaryDone = primary.done
+				inflight.Add(1)
+				go func() {
+					defer inflight.Done()
+					defer close(primary.done)
+					primary.summary, primary.err = d.handle(ctx, n, handler)
+				}()
+				continue
+			}
+
+			l.WithField("coalescedWith", primary.notice.Type()).Info("Coalescing duplicate termination notice, the handler will not be run again")
+			inflight.Add(1)
+			go func() {
+				defer inflight.Done()
+				// The outcome is that of the primary notice, which has already been logged
+				_ = d.Handle(ctx, n, &coalescedHandler{primary: primary})
+			}()
+		case <-primaryDone:
+			primaryDone = nil
+			if d.dedupWindow > 0 {
+				log.WithField("window", d.dedupWindow.String()).Info("Waiting for duplicate termination notices")
+			}
+			window = time.After(d.dedupWindow)
+		case <-window:
+			inflight.Wait()
+			return primary.summary, primary.err
+		}
+	}
+}
+
+// inflightNotice is the first termination notice received by the daemon.
+type inflightNotice struct {
+	notice  TerminationNotice
+	done    chan struct{}
+	summary *Summary
+	err     error
+}
+
+// coalescedHandler stands in for the handler of a duplicate notice. It waits for
+// the primary notice to be handled and returns its result.
+type coalescedHandler struct {
+	primary *inflightNotice
+}
+
+// Execute the coalesced handler.
+func (h *coalescedHandler) Execute(ctx context.Context, _ ...string) error {
+	select {
+	case <-h.primary.done:
+		return h.primary.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// boundedHandler limits the number of handlers that can execute at once.
+type boundedHandler struct {
+	Handler
+	slots chan struct{}
+	log   *logrus.Entry
+}
+
+// Execute the handler once a slot is available.
+func (h *boundedHandler) Execute(ctx context.Context, args ...string) error {
+	if err := h.acquire(ctx); err != nil {
+		return err
+	}
+	defer h.release()
+
+	return h.Handler.Execute(ctx, args...)
+}
+
+// HandleNotice passes the notice to the handler once a slot is available.
+func (h *boundedHandler) HandleNotice(ctx context.Context, notice *Notice) error {
+	if err := h.acquire(ctx); err != nil {
+		return err
+	}
+	defer h.release()
+
+	return executeHandler(ctx, h.Handler, notice)
+}
+
+func (h *boundedHandler) acquire(ctx context.Context) error {
+	select {
+	case h.slots <- struct{}{}:
+		return nil
+	default:
+		h.log.Info("Waiting for another handler to finish")
+	}
+	select {
+	case h.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *boundedHandler) release() {
+	<-h.slots
+}
+
+// listenerGroup is a set of running listeners which are all stopped when one of them fails.
+type listenerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+
+	// redundant is the number of the autoscaling listeners of several topics that haven't failed,
+	// which are redundant: the daemon keeps running while any of them is
+	redundant int32
+
+	// cleanups release the resources retained by listeners, after they have stopped
+	cleanups []func()
+}
+
+// listen starts all listeners, which send the notices they receive on the given channel.
+func (d *Daemon) listen(ctx context.Context, notices chan<- TerminationNotice, log *logrus.Entry) *listenerGroup {
+	g := &listenerGroup{}
+	g.ctx, g.cancel = context.WithCancel(ctx)
 
 	for _, listener := range d.listeners {
-		wg.Add(1)
+		if _, ok := listener.(*AutoscalingListener); ok {
+			g.redundant++
+		}
+	}
+	topics := g.redundant > 1
+
+	for i, listener := range d.listeners {
+		g.wg.Add(1)
 
-		l := log.WithField("listener", listener.Type())
+		l := d.logs.entry(listener.Type()+"-listener", log).WithField("listener", listener.Type())
+		status := d.statuses[i]
+		_, redundant := listener.(*AutoscalingListener)
+		redundant = redundant && topics
 
 		go func(listener Listener) {
-			defer wg.Done()
+			defer g.wg.Done()
 
-			if err := listener.Start(listenerCtx, notices, l); err != nil {
+			for {
+				err := d.supervise(g.ctx, listener, status, notices, l)
+				if err == nil {
+					l.Info("Stopped listener")
+					status.setState(ListenerStopped)
+					return
+				}
+				// The listener of one of several topics is restarted in the background, unless
+				// the listeners of all of the topics have failed
+				if redundant && g.ctx.Err() == nil && atomic.AddInt32(&g.redundant, -1) > 0 {
+					l.WithError(err).WithField("backoff", maxListenerBackoff.String()).Error("Listener failed, continuing with the listeners of the other topics")
+					d.recordError(err)
+					status.setState(ListenerFailed)
+					status.setDegraded()
+					select {
+					case <-time.After(maxListenerBackoff):
+					case <-g.ctx.Done():
+						status.setState(ListenerStopped)
+						return
+					}
+					atomic.AddInt32(&g.redundant, 1)
+					continue
+				}
 				l.WithError(err).Error("Failed to start listener")
-				stopListening()
-			} else {
-				l.Info("Stopped listener")
+				d.recordError(err)
+				status.setState(ListenerFailed)
+				g.once.Do(func() { g.err = err })
+				g.cancel()
+				return
 			}
 		}(listener)
+		if c, ok := listener.(cleaner); ok {
+			g.cleanups = append(g.cleanups, func() { c.Cleanup(l) })
+		}
 		l.Info("Starting listener")
 	}
+	return g
+}
 
-	log.Info("Waiting for termination notices")
+// supervise starts the listener and restarts it with exponential backoff when it fails,
+// until the restart budget is exhausted and a *ListenerError is returned.
+func (d *Daemon) supervise(ctx context.Context, listener Listener, status *listenerStatus, notices chan<- TerminationNotice, log *logrus.Entry) error {
+	backoff := d.restartBackoff
+	if backoff <= 0 {
+		backoff = defaultListenerBackoff
+	}
+
+	for restarts := 0; ; restarts++ {
+		status.setState(ListenerStarting)
+		if _, ok := listener.(statusReporter); !ok {
+			status.setState(ListenerRunning)
+		}
+
+		err := startListener(ctx, listener, notices, log)
+		if err == nil {
+			return nil
+		}
+		if restarts >= d.maxRestarts || ctx.Err() != nil {
+			return &ListenerError{Type: listener.Type(), Restarts: restarts, Err: err}
+		}
+
+		d.recordError(err)
+		log.WithError(err).WithFields(logrus.Fields{
+			"attempt": restarts + 1,
+			"backoff": backoff.String(),
+		}).Warn("Listener failed, restarting")
+		status.setState(ListenerStarting)
 
-Listener:
-	for {
 		select {
-		case <-listenerCtx.Done():
-			// Make sure the underlying context was not cancelled
-			if ctx.Err() != context.Canceled {
-				err = errors.New("an error occurred")
-			}
-			break Listener
-		case n := <-notices:
-			log.WithField("notice", n.Type()).Info("Received termination notice")
-			notice = n
-			break Listener
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		}
+		if backoff *= 2; backoff > maxListenerBackoff {
+			backoff = maxListenerBackoff
 		}
 	}
-	return notice, err
+}
+
+// cleaner is implemented by listeners that retain resources across restarts
+// (e.g. the SQS queue), which are released once the listener has stopped for good.
+type cleaner interface {
+	Cleanup(*logrus.Entry)
+}
+
+// stop all listeners, wait for them to exit and release their resources.
+func (g *listenerGroup) stop() {
+	g.cancel()
+	g.wg.Wait()
+	for _, cleanup := range g.cleanups {
+		cleanup()
+	}
+}
+
+// failed returns the error that caused the listeners to stop, or nil if the parent context was cancelled.
+func (g *listenerGroup) failed(parent context.Context) error {
+	// Make sure the underlying context was not cancelled
+	if parent.Err() == context.Canceled {
+		return nil
+	}
+	g.wg.Wait()
+	if g.err != nil {
+		return g.err
+	}
+	return errors.New("an error occurred")
+}
+
+// startListener recovers from a panic in the listener and returns it as an error.
+func startListener(ctx context.Context, listener Listener, notices chan<- TerminationNotice, log *logrus.Entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			perr := newPanicError(r)
+			log.WithField("stack", string(perr.Stack)).Error("Recovered from panic in listener")
+			err = perr
+		}
+	}()
+	return listener.Start(ctx, notices, log)
 }
 
 // AddListener to the Daemon.
 func (d *Daemon) AddListener(l Listener) {
+	status := newListenerStatus(l.Type())
+	status.onChange = d.listenerStateChanged
+	status.failureThreshold = d.pollFailures
+	status.onPollFailure = d.pollFailureChanged
+	if r, ok := l.(statusReporter); ok {
+		r.setStatus(status)
+	}
 	d.listeners = append(d.listeners, l)
+	d.statuses = append(d.statuses, status)
+}
+
+// SetHandler overrides the handler passed to Run for notices of the given type.
+func (d *Daemon) SetHandler(noticeType string, handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.handlers == nil {
+		d.handlers = make(map[string]Handler)
+	}
+	d.handlers[noticeType] = handler
+}
+
+// Handle a termination notice using the given handler, unless SetHandler has
+// configured a handler for the notice type. A panic while handling
+// the notice is recovered and returned as a *PanicError.
+func (d *Daemon) Handle(ctx context.Context, notice TerminationNotice, handler Handler) error {
+	_, err := d.handle(ctx, notice, handler)
+	return err
+}
+
+func (d *Daemon) handle(ctx context.Context, notice TerminationNotice, handler Handler) (summary *Summary, err error) {
+	runID := runIDFor(notice)
+	log := d.baseLog().WithFields(logrus.Fields{"notice": notice.Type(), "runId": runID})
+	ctx = withRunID(ctx, runID)
+
+	// The span of the notice starts when it was received, to include any wait to be handled
+	spanStart := time.Now()
+	if n, ok := notice.(DetailedNotice); ok && !n.ReceivedAt().IsZero() {
+		spanStart = n.ReceivedAt()
+	}
+	ctx, span := d.tracer.Start(ctx, "lifecycled.notice", trace.WithTimestamp(spanStart), trace.WithAttributes(noticeAttributes(notice)...))
+	defer func() { endSpan(span, err) }()
+
+	activity := &HandlerActivity{Notice: notice.Type(), StartedAt: time.Now(), notice: notice}
+	d.mu.Lock()
+	d.handling = append(d.handling, activity)
+	d.mu.Unlock()
+	d.notifyChanged()
+
+	d.mu.Lock()
+	env := append(append([]string(nil), d.tagEnv...), runIDEnv+"="+runID)
+	d.mu.Unlock()
+	ctx = withHandlerEnv(ctx, env)
+	tl := newTimeline()
+	if n, ok := notice.(DetailedNotice); ok {
+		tl.add(n.ReceivedAt(), TimelineReceived, "")
+	}
+	ctx = withTimeline(ctx, tl)
+	ctx = withProcessTracker(ctx, func(pid int) {
+		d.mu.Lock()
+		activity.PID, activity.processStartedAt = pid, time.Now()
+		d.mu.Unlock()
+	})
+
+	defer func() {
+		d.mu.Lock()
+		for i, a := range d.handling {
+			if a == activity {
+				d.handling = append(d.handling[:i], d.handling[i+1:]...)
+				break
+			}
+		}
+		d.noticesHandled++
+		d.mu.Unlock()
+		if err != nil {
+			d.recordError(err)
+		}
+		d.notifyChanged()
+	}()
+
+	// Coalesced notices don't run the handler, so they don't need to wait for a slot
+	// or publish a completion event
+	var timed *timedHandler
+	var sinceStart time.Duration
+	audited := handler
+	if _, ok := handler.(*coalescedHandler); !ok {
+		d.mu.Lock()
+		if h, ok := d.handlers[notice.Type()]; ok {
+			handler = h
+		}
+		if !d.firstNotice {
+			d.firstNotice = true
+			receivedAt := activity.StartedAt
+			if n, ok := notice.(DetailedNotice); ok {
+				receivedAt = n.ReceivedAt()
+			}
+			sinceStart = receivedAt.Sub(d.startedAt)
+		}
+		d.mu.Unlock()
+		audited = handler
+		timed = &timedHandler{Handler: &loggedHandler{Handler: handler, logs: d.logs}}
+		timed.started = d.handlerStarted(notice, log)
+		handler = &tracedHandler{Handler: timed, tracer: d.tracer}
+		if d.slots != nil {
+			handler = &boundedHandler{Handler: handler, slots: d.slots, log: log}
+		}
+	}
+
+	log.Info("Executing handler")
+	start := time.Now()
+	defer func() {
+		var handlerDuration time.Duration
+		if timed != nil {
+			handlerDuration = timed.duration
+		}
+		summary = summarize(notice, handlerDuration, time.Since(start), err)
+		summary.Timeline = tl.Events()
+		if len(summary.Timeline) > 0 {
+			log.WithField("timeline", formatTimeline(summary.Timeline)).Info("Notice timeline")
+		}
+		d.audit(notice, runID, audited, summary, log)
+
+		result := resultOf(notice, handlerDuration)
+		d.mu.Lock()
+		d.results = append(d.results, result)
+		d.mu.Unlock()
+	}()
+	if timed != nil {
+		// The notification of the notice being received doesn't delay the handler, but is
+		// sent before the notification of its outcome
+		received := make(chan struct{})
+		go func(log *logrus.Entry) {
+			defer close(received)
+			d.notify(NotifyReceived, notice, runID, 0, nil, log)
+		}(log)
+		defer func() {
+			d.metrics.handled(notice.Type(), d.groupOf(notice), timed.duration, err)
+			d.publish(notice, runID, timed.duration, time.Since(start), err, log)
+			d.publishMetrics(notice, resultOf(notice, timed.duration), err, sinceStart, timed.startLatency, log)
+
+			<-received
+			event := NotifyCompleted
+			if err != nil {
+				event = NotifyHandlerFailed
+			}
+			d.notify(event, notice, runID, timed.duration, err, log)
+		}()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			perr := newPanicError(r)
+			log.WithField("stack", string(perr.Stack)).WithError(perr).Error("Recovered from panic while handling notice")
+			err = perr
+		}
+	}()
+	err = notice.Handle(ctx, handler, d.logs.entry(noticeComponent(notice), log))
+	log = log.WithField("duration", time.Since(start).String())
+	if err != nil {
+		log.WithError(err).WithField("errorCode", ErrorCode(err)).Error("Failed to execute handler")
+		return nil, err
+	}
+	log.Info("Handler finished successfully")
+	return nil, nil
+}
+
+// hookFiredNotice is implemented by notices of a lifecycle hook.
+type hookFiredNotice interface {
+	hookFiredAt() time.Time
+	ReceivedAt() time.Time
+}
+
+// handlerStarted returns the function that records the latency from the lifecycle hook of the
+// notice firing to the handler starting, which is logged as a warning if it exceeds the
+// threshold. The latency is zero for notices that don't have a lifecycle hook. Only the time
+// until the notice was received is compared with the clock of AWS, and the rest is measured
+// with the monotonic clock of the instance.
+func (d *Daemon) handlerStarted(notice TerminationNotice, log *logrus.Entry) func(time.Time) time.Duration {
+	return func(at time.Time) time.Duration {
+		n, ok := notice.(hookFiredNotice)
+		if !ok || n.hookFiredAt().IsZero() {
+			return 0
+		}
+		clock := d.autoscalingOptions.clock()
+		receivedAt := n.ReceivedAt()
+		if receivedAt.IsZero() || receivedAt.After(at) {
+			receivedAt = at
+		}
+		latency, skew := clock.since(n.hookFiredAt(), receivedAt)
+		latency += at.Sub(receivedAt)
+		d.metrics.handlerStarted(notice.Type(), latency, skew > 0)
+
+		log = log.WithField("hookToHandlerStart", latency.String())
+		if clock.skewed(skew) {
+			log = log.WithField("clockSkew", skew.String())
+		}
+		if d.startThreshold > 0 && latency > d.startThreshold {
+			log.WithField("threshold", d.startThreshold.String()).Warn("Handler started later than the threshold after the lifecycle hook fired")
+		} else {
+			log.Info("Handler started after the lifecycle hook fired")
+		}
+		return latency
+	}
+}
+
+// ListenerError is returned by the daemon when a listener fails and has
+// exhausted its restart budget.
+type ListenerError struct {
+	Type     string
+	Restarts int
+	Err      error
+}
+
+func (e *ListenerError) Error() string {
+	if e.Restarts > 0 {
+		return fmt.Sprintf("%s listener failed after %d restarts: %s", e.Type, e.Restarts, e.Err)
+	}
+	return fmt.Sprintf("%s listener failed: %s", e.Type, e.Err)
+}
+
+// Unwrap returns the error returned by the listener.
+func (e *ListenerError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if target is ErrListenerFailed.
+func (e *ListenerError) Is(target error) bool {
+	return target == ErrListenerFailed
+}
+
+// Code returns CodeListenerFailed.
+func (e *ListenerError) Code() string {
+	return CodeListenerFailed
+}
+
+// PanicError is returned when a listener or notice handler panics.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func newPanicError(v interface{}) *PanicError {
+	return &PanicError{Value: v, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Is returns true if target is ErrPanic.
+func (e *PanicError) Is(target error) bool {
+	return target == ErrPanic
+}
+
+// Code returns CodePanic.
+func (e *PanicError) Code() string {
+	return CodePanic
 }
 
 // Listener ...
@@ -144,26 +941,21 @@ type TerminationNotice interface {
 	Handle(context.Context, Handler, *logrus.Entry) error
 }
 
-// Handler ...
-type Handler interface {
-	Execute(ctx context.Context, args ...string) error
-}
+// DetailedNotice is implemented by the termination notices of the built-in listeners,
+// to describe the notice without handling it. Use a type assertion to check for it.
+type DetailedNotice interface {
+	TerminationNotice
 
-// NewFileHandler ...
-func NewFileHandler(file *os.File) *FileHandler {
-	return &FileHandler{file: file}
-}
+	// InstanceID of the instance that is terminating.
+	InstanceID() string
 
-// FileHandler ...
-type FileHandler struct {
-	file *os.File
-}
+	// Transition, e.g. autoscaling:EC2_INSTANCE_TERMINATING or ec2:SPOT_INSTANCE_TERMINATION.
+	Transition() string
+
+	// ReceivedAt is the time that the listener received the notice.
+	ReceivedAt() time.Time
 
-// Execute the file handler.
-func (h *FileHandler) Execute(ctx context.Context, args ...string) error {
-	cmd := exec.CommandContext(ctx, h.file.Name(), args...)
-	cmd.Env = os.Environ()
-	cmd.Stdout = os.Stderr
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	// Raw returns the original message, i.e. the SQS message body for autoscaling
+	// notices and the instance metadata response for spot notices.
+	Raw() []byte
 }
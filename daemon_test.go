@@ -8,18 +8,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/ec2metadata"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sns"
-	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/triarius/lifecycled"
 	"github.com/triarius/lifecycled/mocks"
 	"github.com/golang/mock/gomock"
-	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
 )
 
 func newMetadataStub(instanceID, terminationTime string) *httptest.Server {
@@ -45,7 +47,7 @@ func newMetadataStub(instanceID, terminationTime string) *httptest.Server {
 	return httptest.NewServer(handler)
 }
 
-func newSQSMessage(instanceID string) *sqs.Message {
+func newSQSMessage(instanceID string) sqstypes.Message {
 	m := fmt.Sprintf(`
 {
 	"Time": "2016-02-26T21:09:59.517Z",
@@ -68,7 +70,7 @@ func newSQSMessage(instanceID string) *sqs.Message {
 		panic(err)
 	}
 
-	return &sqs.Message{
+	return sqstypes.Message{
 		Body:          aws.String(string(e)),
 		ReceiptHandle: aws.String("handle"),
 	}
@@ -118,30 +120,30 @@ func TestDaemon(t *testing.T) {
 
 			// Expected SQS calls
 			if tc.snsTopic != "" {
-				sq.EXPECT().CreateQueue(gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+				sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
 					QueueUrl: aws.String("url"),
 				}, nil)
-				sq.EXPECT().GetQueueAttributes(gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
-					Attributes: map[string]*string{"QueueArn": aws.String("arn")},
+				sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+					Attributes: map[string]string{"QueueArn": "arn"},
 				}, nil)
-				sq.EXPECT().DeleteQueue(gomock.Any()).Times(1).Return(nil, nil)
+				sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
 
 				if tc.subscribeError == nil {
-					sq.EXPECT().ReceiveMessageWithContext(gomock.Any(), gomock.Any()).MinTimes(1).Return(&sqs.ReceiveMessageOutput{
-						Messages: []*sqs.Message{newSQSMessage(instanceID)},
+					sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(&sqs.ReceiveMessageOutput{
+						Messages: []sqstypes.Message{newSQSMessage(instanceID)},
 					}, nil)
-					sq.EXPECT().DeleteMessageWithContext(gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+					sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
 				}
 			}
 
 			// Expected SNS calls
 			if tc.snsTopic != "" {
-				sn.EXPECT().Subscribe(gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+				sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
 					SubscriptionArn: aws.String("arn"),
 				}, tc.subscribeError)
 
 				if tc.subscribeError == nil {
-					sn.EXPECT().Unsubscribe(gomock.Any()).Times(1).Return(nil, nil)
+					sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
 				}
 			}
 
@@ -149,13 +151,12 @@ func TestDaemon(t *testing.T) {
 			server := newMetadataStub(instanceID, spotTerminationTime)
 			defer server.Close()
 
-			metadata := ec2metadata.New(session.Must(session.NewSession()), &aws.Config{
-				Endpoint:   aws.String(server.URL + "/latest"),
-				DisableSSL: aws.Bool(true),
+			metadata := imds.New(imds.Options{
+				Endpoint: server.URL,
 			})
 
 			// Create and start the daemon
-			logger, hook := logrus.NewNullLogger()
+			logger, hook := logrustest.NewNullLogger()
 			ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
 			defer cancel()
 
@@ -205,3 +206,354 @@ func TestDaemon(t *testing.T) {
 	}
 
 }
+
+type countingHandler struct {
+	mu    sync.Mutex
+	count int
+	delay time.Duration
+}
+
+func (h *countingHandler) Execute(ctx context.Context, _ ...string) error {
+	h.mu.Lock()
+	h.count++
+	h.mu.Unlock()
+
+	select {
+	case <-time.After(h.delay):
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func TestDaemonRunCoalescesDuplicateNotices(t *testing.T) {
+	instanceID := "i-000000000000"
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.ReceiveMessageOutput{
+		Messages: []sqstypes.Message{newSQSMessage(instanceID)},
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+		func(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+			time.Sleep(10 * time.Millisecond)
+			return &sqs.ReceiveMessageOutput{}, nil
+		},
+	)
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+	sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+	sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	server := newMetadataStub(instanceID, "2006-01-02T15:04:05+02:00")
+	defer server.Close()
+
+	metadata := imds.New(imds.Options{
+		Endpoint: server.URL,
+	})
+
+	logger, _ := logrustest.NewNullLogger()
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "topic",
+		SpotListener:                 true,
+		SpotListenerInterval:         1 * time.Millisecond,
+		AutoscalingHeartbeatInterval: time.Minute,
+	}, sq, sn, as, metadata, logger)
+
+	handler := &countingHandler{delay: 500 * time.Millisecond}
+	if err := daemon.Run(ctx, handler); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected daemon to return before the context timed out")
+	}
+	if got, want := handler.count, 1; got != want {
+		t.Errorf("expected handler to be executed %d times and got %d", want, got)
+	}
+	if got, want := daemon.Status().NoticesHandled, 2; got != want {
+		t.Errorf("expected %d notices to be handled and got %d", want, got)
+	}
+}
+
+type fakeNotice struct{}
+
+func (fakeNotice) Type() string { return "fake" }
+
+func (fakeNotice) Handle(ctx context.Context, handler lifecycled.Handler, _ *logrus.Entry) error {
+	return handler.Execute(ctx, "fake:TRANSITION", "i-000000000000")
+}
+
+type concurrencyHandler struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (h *concurrencyHandler) Execute(context.Context, ...string) error {
+	h.mu.Lock()
+	h.running++
+	if h.running > h.max {
+		h.max = h.running
+	}
+	h.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	h.mu.Lock()
+	h.running--
+	h.mu.Unlock()
+	return nil
+}
+
+func TestDaemonHandlerConcurrency(t *testing.T) {
+	tests := []struct {
+		description string
+		concurrency int
+		expectedMax int
+	}{
+		{
+			description: "serializes handlers by default",
+			expectedMax: 1,
+		},
+		{
+			description: "bounds concurrent handlers",
+			concurrency: 2,
+			expectedMax: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			logger, _ := logrustest.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				InstanceID:         "i-000000000000",
+				HandlerConcurrency: tc.concurrency,
+			}, nil, nil, nil, nil, logger)
+
+			handler := &concurrencyHandler{}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := daemon.Handle(context.TODO(), fakeNotice{}, handler); err != nil {
+						t.Errorf("unexpected error: %s", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got, want := handler.max, tc.expectedMax; got != want {
+				t.Errorf("expected at most %d concurrent handlers and got %d", want, got)
+			}
+		})
+	}
+}
+
+type flakyListener struct {
+	failures int
+	starts   int
+}
+
+func (l *flakyListener) Type() string { return "flaky" }
+
+func (l *flakyListener) Start(ctx context.Context, notices chan<- lifecycled.TerminationNotice, _ *logrus.Entry) error {
+	l.starts++
+	if l.starts <= l.failures {
+		return fmt.Errorf("failure %d", l.starts)
+	}
+	notices <- fakeNotice{}
+	<-ctx.Done()
+	return nil
+}
+
+func TestDaemonRestartsFailedListener(t *testing.T) {
+	tests := []struct {
+		description      string
+		failures         int
+		restarts         int
+		expectedStarts   int
+		expectDaemonFail bool
+	}{
+		{
+			description:    "restarts listener within budget",
+			failures:       2,
+			restarts:       3,
+			expectedStarts: 3,
+		},
+		{
+			description:      "fails when budget is exhausted",
+			failures:         5,
+			restarts:         2,
+			expectedStarts:   3,
+			expectDaemonFail: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			logger, _ := logrustest.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				InstanceID:             "i-000000000000",
+				ListenerRestarts:       tc.restarts,
+				ListenerRestartBackoff: time.Millisecond,
+			}, nil, nil, nil, nil, logger)
+
+			listener := &flakyListener{failures: tc.failures}
+			daemon.AddListener(listener)
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+			defer cancel()
+
+			notice, err := daemon.Start(ctx)
+			if tc.expectDaemonFail {
+				var lerr *lifecycled.ListenerError
+				if !errors.As(err, &lerr) {
+					t.Fatalf("expected a listener error and got: %v", err)
+				}
+				if got, want := lerr.Restarts, tc.restarts; got != want {
+					t.Errorf("expected %d restarts and got %d", want, got)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if notice == nil {
+					t.Error("expected a notice to be returned")
+				}
+			}
+			if got, want := listener.starts, tc.expectedStarts; got != want {
+				t.Errorf("expected %d starts and got %d", want, got)
+			}
+		})
+	}
+}
+
+type failingHandler struct{}
+
+func (failingHandler) Execute(context.Context, ...string) error {
+	return errors.New("failed")
+}
+
+func TestChainHandler(t *testing.T) {
+	first, last := &countingHandler{}, &countingHandler{}
+
+	chain := lifecycled.ChainHandler{first, failingHandler{}, last}
+	if err := chain.Execute(context.TODO(), "event"); err == nil {
+		t.Error("expected the chain to return the error")
+	}
+	if first.count != 1 {
+		t.Error("expected the first handler to be executed")
+	}
+	if last.count != 0 {
+		t.Error("expected the chain to stop at the failed handler")
+	}
+}
+
+func TestListenerFootprint(t *testing.T) {
+	tests := []struct {
+		description       string
+		noSpot            bool
+		noAutoscaling     bool
+		expectedListeners []string
+		expectedDisabled  []string
+	}{
+		{
+			description:       "spot listener only",
+			noAutoscaling:     true,
+			expectedListeners: []string{"spot"},
+			expectedDisabled:  []string{"autoscaling"},
+		},
+		{
+			description:       "autoscaling listener only",
+			noSpot:            true,
+			expectedListeners: []string{"autoscaling"},
+			expectedDisabled:  []string{"spot"},
+		},
+		{
+			description:       "both listeners",
+			expectedListeners: []string{"spot", "autoscaling"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// Any call that is not expected fails the test, so the spot listener alone
+			// must not create a queue or subscribe to the topic
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			if !tc.noAutoscaling {
+				sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+					QueueUrl: aws.String("https://sqs.us-east-1.amazonaws.com/123456789012/queue"),
+				}, nil)
+				sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+					Attributes: map[string]string{"QueueArn": "arn"},
+				}, nil)
+				sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(&sqs.ReceiveMessageOutput{}, nil)
+				sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+				sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+					SubscriptionArn: aws.String("arn"),
+				}, nil)
+				sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+			}
+
+			server := newMetadataStub("i-000000000000", "")
+			defer server.Close()
+			metadata := imds.New(imds.Options{
+				Endpoint: server.URL,
+				Retryer:  aws.NopRetryer{},
+			})
+
+			config := &lifecycled.Config{
+				InstanceID:           "i-000000000000",
+				SNSTopic:             "topic",
+				SpotListener:         !tc.noSpot,
+				SpotListenerInterval: 10 * time.Millisecond,
+				NoAutoscaling:        tc.noAutoscaling,
+			}
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			time.AfterFunc(200*time.Millisecond, cancel)
+
+			logger, _ := logrustest.NewNullLogger()
+			daemon := lifecycled.NewDaemon(config, sq, sn, as, metadata, logger)
+			if _, err := daemon.Start(ctx); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			status := daemon.Status()
+			var listeners []string
+			for _, l := range status.Listeners {
+				listeners = append(listeners, l.Type)
+			}
+			if got, want := strings.Join(listeners, ","), strings.Join(tc.expectedListeners, ","); got != want {
+				t.Errorf("expected listeners %q, got %q", want, got)
+			}
+			if got, want := strings.Join(status.DisabledListeners, ","), strings.Join(tc.expectedDisabled, ","); got != want {
+				t.Errorf("expected disabled listeners %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package lifecycled
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// debugCounters are the counters of the metrics that are also served as debug variables.
+type debugCounters struct {
+	noticesReceived   int64
+	handlerFailures   int64
+	polls             int64
+	pollErrors        int64
+	parseFailures     int64
+	heartbeatsSent    int64
+	heartbeatFailures int64
+}
+
+// DebugVars are the counters of a daemon, for debugging without a metrics system.
+type DebugVars struct {
+	Version    string    `json:"version"`
+	StartedAt  time.Time `json:"startedAt"`
+	Goroutines int       `json:"goroutines"`
+
+	NoticesReceived   int64 `json:"noticesReceived"`
+	NoticesHandled    int   `json:"noticesHandled"`
+	HandlerFailures   int64 `json:"handlerFailures"`
+	Polls             int64 `json:"polls"`
+	PollErrors        int64 `json:"pollErrors"`
+	ParseFailures     int64 `json:"parseFailures"`
+	HeartbeatsSent    int64 `json:"heartbeatsSent"`
+	HeartbeatFailures int64 `json:"heartbeatFailures"`
+}
+
+// DebugVars returns the counters of the daemon, with the version of the program.
+func (d *Daemon) DebugVars(version string) DebugVars {
+	status := d.Status()
+	c := &d.metrics.counters
+	return DebugVars{
+		Version:           version,
+		StartedAt:         status.StartedAt,
+		Goroutines:        runtime.NumGoroutine(),
+		NoticesReceived:   atomic.LoadInt64(&c.noticesReceived),
+		NoticesHandled:    status.NoticesHandled,
+		HandlerFailures:   atomic.LoadInt64(&c.handlerFailures),
+		Polls:             atomic.LoadInt64(&c.polls),
+		PollErrors:        atomic.LoadInt64(&c.pollErrors),
+		ParseFailures:     atomic.LoadInt64(&c.parseFailures),
+		HeartbeatsSent:    atomic.LoadInt64(&c.heartbeatsSent),
+		HeartbeatFailures: atomic.LoadInt64(&c.heartbeatFailures),
+	}
+}
+
+// EnableDebugVars serves the counters of the daemon on /debug/vars, in the format of expvar
+// with the counters under "lifecycled" alongside the command line and memory statistics. The
+// endpoint is only on this server, as the counters are not published with expvar itself.
+func (s *HealthServer) EnableDebugVars(version string) {
+	s.mux.HandleFunc("/debug/vars", func(w http.ResponseWriter, _ *http.Request) {
+		var memstats runtime.MemStats
+		runtime.ReadMemStats(&memstats)
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"cmdline":    os.Args,
+			"memstats":   memstats,
+			"lifecycled": s.daemon.DebugVars(version),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// pprofWriteTimeout allows for CPU profiles and traces, which take 30s by default.
+const pprofWriteTimeout = 2 * time.Minute
+
+// EnablePprof serves the profiles of net/http/pprof on /debug/pprof/. It must be called before
+// Start, as it extends the write timeout of the server for profiles that take a while.
+func (s *HealthServer) EnablePprof() {
+	s.server.WriteTimeout = pprofWriteTimeout
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
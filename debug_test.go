@@ -0,0 +1,62 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+func TestDebugVars(t *testing.T) {
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, failingHandler{}); err == nil {
+		t.Fatal("expected the handler to fail")
+	}
+
+	server := lifecycled.NewHealthServer("127.0.0.1:0", daemon, time.Minute)
+	server.EnableDebugVars("1.2.3")
+	if err := server.Start(logger.WithField("test", true)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer server.Stop(context.TODO())
+	addr := hook.LastEntry().Data["address"].(string)
+
+	resp, err := http.Get("http://" + addr + "/debug/vars")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var vars struct {
+		Cmdline    []string             `json:"cmdline"`
+		Lifecycled lifecycled.DebugVars `json:"lifecycled"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	v := vars.Lifecycled
+	if v.Version != "1.2.3" || v.StartedAt.IsZero() || v.Goroutines == 0 {
+		t.Errorf("unexpected version, start time or goroutines: %+v", v)
+	}
+	if v.NoticesHandled != 1 || v.HandlerFailures != 1 {
+		t.Errorf("expected a notice that failed to be handled and got %+v", v)
+	}
+	if len(vars.Cmdline) == 0 {
+		t.Error("expected the command line")
+	}
+
+	// pprof is opt-in
+	resp, err = http.Get("http://" + addr + "/debug/pprof/")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected pprof not to be served and got status %d", resp.StatusCode)
+	}
+}
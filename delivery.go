@@ -0,0 +1,75 @@
+package lifecycled
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DeliveryCheckName is the name of the result of the delivery check, see
+// AutoscalingOptions.DeliveryCheck.
+const DeliveryCheckName = "sns-delivery"
+
+// deliveryCheckTimeout is how long the marker of the delivery check has to be delivered to the
+// queue, which SNS usually does within seconds.
+const deliveryCheckTimeout = time.Minute
+
+// deliveryMarker is the test notification that the delivery check published to the topic.
+type deliveryMarker struct {
+	id          string
+	publishedAt time.Time
+
+	// done is set once the marker was received or timed out, or couldn't be published
+	done bool
+}
+
+// publishDeliveryMarker publishes the marker of the delivery check to the topic of the queue. It
+// is a test notification for the instance, which the daemons of the other instances subscribed
+// to the topic ignore. A marker that can't be published is recorded as skipped if sns:Publish is
+// denied, since the check needs it but lifecycled doesn't otherwise, and failed otherwise, e.g.
+// if the key of an encrypted topic can't be used.
+func (l *AutoscalingListener) publishDeliveryMarker(ctx context.Context, log *logrus.Entry) *deliveryMarker {
+	m, err := NewTestMessage(TestNotification, l.instanceID)
+	if err == nil {
+		err = SendTestMessage(ctx, l.queue.snsClient, l.queue.topicArn, m)
+	}
+	switch {
+	case err == nil:
+		log.WithField("id", m.ID).Info("Published a test notification to check that the topic delivers to the queue")
+		return &deliveryMarker{id: m.ID, publishedAt: time.Now()}
+	case isAuthorizationError(err):
+		l.deliveryResult(log, CheckSkip, "the delivery of notifications to the queue can't be confirmed since sns:Publish is denied: %s", err)
+	default:
+		l.deliveryResult(log, CheckFail, "failed to publish a test notification to the topic: %s", err)
+	}
+	return &deliveryMarker{done: true}
+}
+
+// deliveryReceived passes the delivery check if the test message with the id is its marker.
+func (l *AutoscalingListener) deliveryReceived(id string, at time.Time, log *logrus.Entry) {
+	if l.delivery == nil || l.delivery.done || l.delivery.id != id {
+		return
+	}
+	l.delivery.done = true
+	l.deliveryResult(log, CheckPass, "the test notification %s was delivered to the queue in %s", id, at.Sub(l.delivery.publishedAt).Round(time.Millisecond))
+}
+
+// deliveryTimedOut fails the delivery check if its marker hasn't been delivered within the
+// timeout, which is silently what SNS does if it can't encrypt the messages of an encrypted
+// topic or the queue policy doesn't allow the topic to send to the queue.
+func (l *AutoscalingListener) deliveryTimedOut(now time.Time, log *logrus.Entry) {
+	if l.delivery == nil || l.delivery.done || now.Sub(l.delivery.publishedAt) < deliveryCheckTimeout {
+		return
+	}
+	l.delivery.done = true
+	l.deliveryResult(log, CheckFail, "the test notification %s published to the topic was not delivered to the queue within %s: the policy of the queue must allow the topic to sqs:SendMessage to it, and if the topic is encrypted the policy of its key must allow publishing to it (see %s)",
+		l.delivery.id, deliveryCheckTimeout, TopicEncryptionCheck)
+}
+
+// deliveryResult records the result of the delivery check with the self-check of the listener.
+func (l *AutoscalingListener) deliveryResult(log *logrus.Entry, status, format string, args ...interface{}) {
+	result := CheckResult{Name: DeliveryCheckName, Status: status, Detail: fmt.Sprintf(format, args...)}
+	l.options.selfCheck.set(log.WithField("check", "delivery"), l.queue.topicArn, []CheckResult{result})
+}
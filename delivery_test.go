@@ -0,0 +1,121 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/golang/mock/gomock"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestDeliveryCheck(t *testing.T) {
+	tests := []struct {
+		description string
+		publishErr  error
+		expected    string
+	}{
+		{
+			description: "delivered",
+			expected:    lifecycled.CheckPass,
+		},
+		{
+			description: "publish denied",
+			publishErr:  &smithy.GenericAPIError{Code: "AuthorizationError", Message: "not authorized to perform: SNS:Publish"},
+			expected:    lifecycled.CheckSkip,
+		},
+		{
+			description: "publish failed",
+			publishErr:  &smithy.GenericAPIError{Code: "KMSAccessDenied", Message: "not authorized to perform: kms:GenerateDataKey"},
+			expected:    lifecycled.CheckFail,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			topic := "arn:aws:sns:us-east-1:123456789012:lifecycled"
+			sq, sn := mocks.NewMockSQSClient(ctrl), mocks.NewMockSNSClient(ctrl)
+
+			// The marker that is published to the topic is delivered to the queue
+			published := make(chan string, 1)
+			sn.EXPECT().Publish(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+				func(_ context.Context, input *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+					if aws.ToString(input.TopicArn) != topic {
+						t.Errorf("unexpected topic: %s", aws.ToString(input.TopicArn))
+					}
+					if tc.publishErr != nil {
+						return nil, tc.publishErr
+					}
+					published <- aws.ToString(input.Message)
+					return &sns.PublishOutput{}, nil
+				},
+			)
+			expectTopicQueue(sq, sn, func(ctx context.Context) (*sqs.ReceiveMessageOutput, error) {
+				select {
+				case m := <-published:
+					body, _ := json.Marshal(&lifecycled.Envelope{Type: "Notification", Time: time.Now(), Message: m})
+					return &sqs.ReceiveMessageOutput{Messages: []sqstypes.Message{{
+						Body:          aws.String(string(body)),
+						ReceiptHandle: aws.String("handle"),
+					}}}, nil
+				case <-time.After(10 * time.Millisecond):
+					return &sqs.ReceiveMessageOutput{}, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			})
+			sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(&sqs.DeleteMessageOutput{}, nil)
+
+			logger, _ := logrustest.NewNullLogger()
+			daemon := lifecycled.NewWithClients(&lifecycled.Config{
+				InstanceID:    "i-000000000000",
+				SNSTopic:      topic,
+				DeliveryCheck: true,
+			}, &lifecycled.Clients{SQS: sq, SNS: sn}, logger)
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				_, err := daemon.Start(ctx)
+				done <- err
+			}()
+
+			var result *lifecycled.CheckResult
+			for result == nil {
+				select {
+				case err := <-done:
+					t.Fatalf("expected the daemon to keep running and got: %v", err)
+				case <-ctx.Done():
+					t.Fatal("timed out waiting for the result of the delivery check")
+				case <-time.After(10 * time.Millisecond):
+				}
+				for _, r := range daemon.Status().SelfCheck {
+					if r.Name == lifecycled.DeliveryCheckName {
+						r := r
+						result = &r
+					}
+				}
+			}
+			if result.Status != tc.expected {
+				t.Errorf("expected %s and got %s: %s", tc.expected, result.Status, result.Detail)
+			}
+
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package lifecycled
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Diagnostics is a snapshot of the internal state of the daemon, for troubleshooting a
+// daemon that appears to be stuck.
+type Diagnostics struct {
+	Status
+	Notices []NoticeDiagnostics `json:"notices,omitempty"`
+
+	// Goroutines is the stack trace of every goroutine.
+	Goroutines string `json:"-"`
+}
+
+// NoticeDiagnostics describes a notice that is being handled.
+type NoticeDiagnostics struct {
+	Notice    string    `json:"notice"`
+	Details   string    `json:"details,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+
+	HeartbeatsSent   int `json:"heartbeatsSent"`
+	HeartbeatsFailed int `json:"heartbeatsFailed"`
+
+	// HandlerPID is the process id of the file handler that is running, if any.
+	HandlerPID    int    `json:"handlerPid,omitempty"`
+	HandlerUptime string `json:"handlerUptime,omitempty"`
+}
+
+// heartbeatCounter is implemented by notices that send heartbeats.
+type heartbeatCounter interface {
+	Heartbeats() (sent, failed int)
+}
+
+// Diagnostics returns a snapshot of the daemon state. It only holds the locks of the daemon
+// long enough to copy the state, so that it doesn't delay heartbeats or handlers.
+func (d *Daemon) Diagnostics() *Diagnostics {
+	diag := &Diagnostics{Status: d.Status(), Notices: d.noticeDiagnostics()}
+
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			diag.Goroutines = string(buf[:n])
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	return diag
+}
+
+// noticeDiagnostics returns the diagnostics of the notices that are being handled.
+func (d *Daemon) noticeDiagnostics() []NoticeDiagnostics {
+	d.mu.Lock()
+	activities := make([]HandlerActivity, 0, len(d.handling))
+	for _, a := range d.handling {
+		activities = append(activities, *a)
+	}
+	d.mu.Unlock()
+
+	var notices []NoticeDiagnostics
+	for _, a := range activities {
+		nd := NoticeDiagnostics{Notice: a.Notice, StartedAt: a.StartedAt, HandlerPID: a.PID}
+		if a.PID != 0 {
+			nd.HandlerUptime = time.Since(a.processStartedAt).Round(time.Millisecond).String()
+		}
+		// The String of the built-in notices masks the action token
+		if s, ok := a.notice.(fmt.Stringer); ok {
+			nd.Details = s.String()
+		}
+		if hc, ok := a.notice.(heartbeatCounter); ok {
+			nd.HeartbeatsSent, nd.HeartbeatsFailed = hc.Heartbeats()
+		}
+		notices = append(notices, nd)
+	}
+	return notices
+}
+
+// DumpDiagnostics logs a snapshot of the daemon state, and the goroutine stacks in a
+// separate entry. It is safe to call at any time, as often as needed.
+func (d *Daemon) DumpDiagnostics(log *logrus.Entry) {
+	diag := d.Diagnostics()
+	state, err := json.Marshal(diag)
+	if err != nil {
+		log.WithError(err).Warn("Failed to serialize diagnostics")
+		return
+	}
+	log.WithFields(logrus.Fields{
+		"state":      string(state),
+		"goroutines": runtime.NumGoroutine(),
+	}).Info("Diagnostic dump")
+	log.WithField("stacks", diag.Goroutines).Info("Diagnostic dump of goroutine stacks")
+}
+
+// processTrackerKey is the context key of the function that records the handler process.
+type processTrackerKey struct{}
+
+// withProcessTracker returns a context where file handlers record the process id of the
+// handler that is running (or 0 once it has exited) with track.
+func withProcessTracker(ctx context.Context, track func(pid int)) context.Context {
+	return context.WithValue(ctx, processTrackerKey{}, track)
+}
+
+// trackProcess records that the handler process has started, and returns a function that
+// records that it has exited.
+func trackProcess(ctx context.Context, pid int) (exited func()) {
+	track, ok := ctx.Value(processTrackerKey{}).(func(pid int))
+	if !ok {
+		return func() {}
+	}
+	track(pid)
+	return func() { track(0) }
+}
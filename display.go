@@ -0,0 +1,202 @@
+package lifecycled
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// displayOutputLines is the number of lines of handler output that StatusDisplay shows.
+	displayOutputLines = 5
+
+	// displayLogLines is the number of warnings and errors that StatusDisplay shows.
+	displayLogLines = 3
+
+	// defaultDisplayInterval is the interval that StatusDisplay is redrawn at by default.
+	defaultDisplayInterval = time.Second
+)
+
+// StatusDisplay renders a compact status of the daemon on a terminal, which is redrawn in place
+// with ANSI escapes: the state and last poll of each listener, and for each notice that is being
+// handled how long it has been handled for and the heartbeats that were sent. It is a writer for
+// the output of handlers, of which it shows the last lines, and a logrus hook that shows the
+// last warnings and errors, so that they are visible when the logs are written elsewhere.
+type StatusDisplay struct {
+	daemon *Daemon
+	out    io.Writer
+	width  int
+
+	mu      sync.Mutex
+	output  []string
+	partial string
+	logs    []string
+	lines   int
+}
+
+// NewStatusDisplay returns a display of the status of the daemon on out, with lines truncated to
+// the width of the terminal (or not truncated if it is zero).
+func NewStatusDisplay(daemon *Daemon, out io.Writer, width int) *StatusDisplay {
+	return &StatusDisplay{daemon: daemon, out: out, width: width}
+}
+
+// Write records the output of a handler.
+func (s *StatusDisplay) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := strings.Split(s.partial+string(p), "\n")
+	s.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		line = strings.Replace(strings.TrimRight(line, "\r"), "\t", "    ", -1)
+		s.output = appendTail(s.output, line, displayOutputLines)
+	}
+	return len(p), nil
+}
+
+// Levels of the log entries that are shown.
+func (s *StatusDisplay) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+// Fire records the warning or error.
+func (s *StatusDisplay) Fire(entry *logrus.Entry) error {
+	line := fmt.Sprintf("%s %-7s %s", entry.Time.Format("15:04:05"), entry.Level, entry.Message)
+	if err, ok := entry.Data[logrus.ErrorKey]; ok {
+		line += fmt.Sprintf(": %v", err)
+	}
+	s.mu.Lock()
+	s.logs = appendTail(s.logs, line, displayLogLines)
+	s.mu.Unlock()
+	return nil
+}
+
+// Run redraws the display at the interval (defaults to 1s) until the context is done, and then
+// draws it a last time.
+func (s *StatusDisplay) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultDisplayInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_ = s.Render(time.Now())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			_ = s.Render(time.Now())
+			return
+		}
+	}
+}
+
+// Render redraws the display as of now, over the previous drawing.
+func (s *StatusDisplay) Render(now time.Time) error {
+	frame := s.frame(now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	if s.lines > 0 {
+		// Move to the start of the previous drawing and clear it
+		fmt.Fprintf(&b, "\x1b[%dA\r\x1b[J", s.lines)
+	}
+	for _, line := range frame {
+		b.WriteString(s.truncate(line) + "\n")
+	}
+	s.lines = len(frame)
+	_, err := io.WriteString(s.out, b.String())
+	return err
+}
+
+// frame returns the lines of the display as of now.
+func (s *StatusDisplay) frame(now time.Time) []string {
+	status := s.daemon.Status()
+	notices := s.daemon.noticeDiagnostics()
+	since := func(t time.Time) string {
+		return now.Sub(t).Round(time.Second).String()
+	}
+
+	lines := []string{fmt.Sprintf("lifecycled %s on %s, up %s", status.Build.Version, status.InstanceID, since(status.StartedAt))}
+	for _, l := range status.Listeners {
+		line := fmt.Sprintf("  %-12s %-9s", l.Type, l.State)
+		if l.LastPoll.IsZero() {
+			line += " not polled yet"
+		} else {
+			line += " polled " + since(l.LastPoll) + " ago"
+		}
+		if l.PollMode == PollModeIdle && l.NextPoll.After(now) {
+			line += ", idle until " + l.NextPoll.Sub(now).Round(time.Second).String() + " from now"
+		}
+		if l.ConsecutiveFailures > 0 {
+			line += fmt.Sprintf(", %d polls failed: %s", l.ConsecutiveFailures, l.LastError)
+		}
+		if l.Degraded {
+			line += ", degraded (restarting) for " + l.Topic
+		}
+		lines = append(lines, line)
+	}
+	if status.CredentialsError != "" {
+		lines = append(lines, "  "+status.CredentialsError)
+	}
+	for _, r := range status.SelfCheck {
+		if r.Status == CheckFail {
+			lines = append(lines, "  self-check: "+r.Detail)
+		}
+	}
+
+	if len(notices) == 0 {
+		lines = append(lines, fmt.Sprintf("Waiting for termination notices, %d handled", status.NoticesHandled))
+	}
+	for _, n := range notices {
+		line := fmt.Sprintf("Handling %s notice for %s, %d heartbeats sent", n.Notice, since(n.StartedAt), n.HeartbeatsSent)
+		if n.HeartbeatsFailed > 0 {
+			line += fmt.Sprintf(" (%d failed)", n.HeartbeatsFailed)
+		}
+		if n.HandlerPID != 0 {
+			line += fmt.Sprintf(", handler pid %d", n.HandlerPID)
+		}
+		lines = append(lines, line)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.output) > 0 {
+		lines = append(lines, "Handler output:")
+		for _, line := range s.output {
+			lines = append(lines, "  | "+line)
+		}
+	}
+	if len(s.logs) > 0 {
+		lines = append(lines, "Warnings and errors:")
+		for _, line := range s.logs {
+			lines = append(lines, "  "+line)
+		}
+	}
+	return lines
+}
+
+// truncate the line to the width of the terminal, so that it doesn't wrap and break the redraw.
+func (s *StatusDisplay) truncate(line string) string {
+	if s.width <= len("...") || utf8.RuneCountInString(line) < s.width {
+		return line
+	}
+	runes := []rune(line)
+	return string(runes[:s.width-4]) + "..."
+}
+
+// appendTail appends the line to the lines, keeping at most the last n.
+func appendTail(lines []string, line string, n int) []string {
+	lines = append(lines, line)
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -0,0 +1,74 @@
+package lifecycled_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/triarius/lifecycled"
+)
+
+func TestStatusDisplay(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = &bytes.Buffer{}
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+
+	var out bytes.Buffer
+	display := lifecycled.NewStatusDisplay(daemon, &out, 0)
+	logger.AddHook(display)
+
+	if err := display.Render(time.Now()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := out.String(); !strings.Contains(got, "Waiting for termination notices, 0 handled\n") {
+		t.Errorf("expected the display to be waiting for notices and got:\n%s", got)
+	}
+
+	// During a drain the notice and the last lines of the handler output are shown
+	out.Reset()
+	err := daemon.Handle(context.TODO(), fakeNotice{}, lifecycled.HandlerFunc(func(context.Context, ...string) error {
+		for i := 1; i <= 7; i++ {
+			fmt.Fprintf(display, "draining %d\n", i)
+		}
+		logger.Warn("Slow drain")
+		return display.Render(time.Now())
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got := out.String()
+	if !strings.HasPrefix(got, "\x1b[2A\r\x1b[J") {
+		t.Errorf("expected the previous drawing to be cleared and got %q", got)
+	}
+	for _, line := range []string{
+		"Handling fake notice for 0s, 0 heartbeats sent\n",
+		"Handler output:\n  | draining 3\n  | draining 4\n  | draining 5\n  | draining 6\n  | draining 7\n",
+		"Warnings and errors:\n",
+		"warning Slow drain\n",
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("expected the display to contain %q and got:\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, "draining 2") {
+		t.Errorf("expected only the last lines of handler output and got:\n%s", got)
+	}
+
+	// Lines are truncated to the width of the terminal
+	out.Reset()
+	narrow := lifecycled.NewStatusDisplay(daemon, &out, 20)
+	narrow.Fire(&logrus.Entry{Level: logrus.ErrorLevel, Message: "Failed", Data: logrus.Fields{logrus.ErrorKey: errors.New("a long reason")}})
+	if err := narrow.Render(time.Now()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if len(line) >= 20 {
+			t.Errorf("expected lines narrower than the terminal and got %q", line)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package lifecycled
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// BuiltinHandlerPrefix selects a handler that is built into lifecycled by its name instead of the
+// path of a file, e.g. --handler builtin:k8s-drain.
+const BuiltinHandlerPrefix = "builtin:"
+
+// KubernetesDrainHandlerName is the name of the built-in handler that drains the Kubernetes node
+// of the instance (see KubernetesDrainHandler).
+const KubernetesDrainHandlerName = "k8s-drain"
+
+// BuiltinHandlers are the names of the built-in handlers.
+var BuiltinHandlers = []string{KubernetesDrainHandlerName}
+
+// builtinHandlerName returns the name of the built-in handler that the handler selects, and false
+// if it is the path of a file.
+func builtinHandlerName(handler string) (string, bool) {
+	if !strings.HasPrefix(handler, BuiltinHandlerPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(handler, BuiltinHandlerPrefix), true
+}
+
+// IsBuiltinHandler returns true if the handler selects a built-in handler rather than a file.
+func IsBuiltinHandler(handler string) bool {
+	_, ok := builtinHandlerName(handler)
+	return ok
+}
+
+// NewBuiltinHandler returns the built-in handler that the handler selects (e.g. builtin:k8s-drain),
+// with its settings from the configuration.
+func NewBuiltinHandler(handler string, config *Config) (Handler, error) {
+	name, _ := builtinHandlerName(handler)
+	switch name {
+	case KubernetesDrainHandlerName:
+		return NewKubernetesDrainHandler(KubernetesDrainOptions{
+			Kubeconfig:  config.Kubeconfig,
+			GracePeriod: config.DrainGracePeriod,
+			Timeout:     config.DrainTimeout,
+		})
+	}
+	return nil, fmt.Errorf("unknown built-in handler %q (expected one of %s)", handler, BuiltinHandlerPrefix+strings.Join(BuiltinHandlers, ", "+BuiltinHandlerPrefix))
+}
+
+// defaultDrainRetryInterval is the interval between evictions of the pods that are blocked, like
+// kubectl drain.
+const defaultDrainRetryInterval = 5 * time.Second
+
+// defaultPodGracePeriod is the termination grace period of the pods that don't set one.
+const defaultPodGracePeriod = 30 * time.Second
+
+// minPodGracePeriod is the shortest termination grace period of an eviction, since the API
+// deletes a pod with a grace period of zero immediately, like kubectl drain.
+const minPodGracePeriod = time.Second
+
+// drainProgressInterval is the interval between the log lines of the progress of a drain.
+const drainProgressInterval = 30 * time.Second
+
+// KubernetesDrainOptions configure a KubernetesDrainHandler.
+type KubernetesDrainOptions struct {
+	// Kubeconfig is the kubeconfig file of the cluster. If it is empty, the files in
+	// $KUBECONFIG or ~/.kube/config are used, or the service account of the pod when running in
+	// one without them.
+	Kubeconfig string
+
+	// GracePeriod is the termination grace period of the evicted pods, or zero for their own.
+	// It is shortened to the time left before the deadline of the drain.
+	GracePeriod time.Duration
+
+	// Timeout bounds the drain, which otherwise lasts until the deadline of the notice: the
+	// termination time of a spot notice, or until lifecycled cancels the handler, e.g. at the
+	// maximum heartbeat duration of an autoscaling notice (disabled if zero).
+	Timeout time.Duration
+
+	// RetryInterval is the interval between evictions of the pods that a PodDisruptionBudget
+	// blocks, and between the checks that the evicted pods are gone (defaults to 5s).
+	RetryInterval time.Duration
+}
+
+// KubernetesDrainHandler cordons the Kubernetes node of the instance, which it finds by the
+// provider id of the node, and evicts its pods with the eviction API, so that their
+// PodDisruptionBudgets are respected. The pods of DaemonSets and the mirror pods of static pods
+// are left on the node. An eviction that a PodDisruptionBudget blocks is retried until the
+// deadline of the drain, when the handler fails with a *DrainError and the lifecycle action is
+// completed as the completion policy has it for a handler that failed.
+//
+// Requires list and patch on nodes, list and get on pods and create on pods/eviction.
+type KubernetesDrainHandler struct {
+	client  *kubernetesClient
+	options KubernetesDrainOptions
+}
+
+// NewKubernetesDrainHandler returns a drain handler for the cluster of the options.
+func NewKubernetesDrainHandler(options KubernetesDrainOptions) (*KubernetesDrainHandler, error) {
+	client, err := newKubernetesClient(options.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = defaultDrainRetryInterval
+	}
+	return &KubernetesDrainHandler{client: client, options: options}, nil
+}
+
+// String returns the name of the handler.
+func (h *KubernetesDrainHandler) String() string {
+	return BuiltinHandlerPrefix + KubernetesDrainHandlerName
+}
+
+// Execute drains the node of the instance id, which is the second argument.
+func (h *KubernetesDrainHandler) Execute(ctx context.Context, args ...string) error {
+	notice := &Notice{Args: args, RunID: runIDFrom(ctx)}
+	if len(args) > 1 {
+		notice.InstanceID = args[1]
+	}
+	return h.HandleNotice(ctx, notice)
+}
+
+// HandleNotice drains the node of the instance of the notice, logging its progress to the log of
+// the notice.
+func (h *KubernetesDrainHandler) HandleNotice(ctx context.Context, notice *Notice) error {
+	log := notice.Log
+	if log == nil {
+		log = logrus.NewEntry(logrus.StandardLogger())
+	}
+	if notice.InstanceID == "" {
+		return fmt.Errorf("%s: the notice has no instance id", h)
+	}
+	if h.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.options.Timeout)
+		defer cancel()
+	}
+	if !notice.TerminationTime.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, notice.TerminationTime)
+		defer cancel()
+	}
+
+	node, err := h.client.nodeForInstance(ctx, notice.InstanceID)
+	if err != nil {
+		return err
+	}
+	log = log.WithField("node", node)
+	log.Info("Cordoning node")
+	if err := h.client.cordon(ctx, node); err != nil {
+		return err
+	}
+	return h.drain(ctx, node, log)
+}
+
+// drain evicts the pods of the node until they are all gone, retrying the evictions that are
+// blocked, or until the context is done.
+func (h *KubernetesDrainHandler) drain(ctx context.Context, node string, log *logrus.Entry) error {
+	pods, err := h.client.podsOnNode(ctx, node)
+	if err != nil {
+		return err
+	}
+	pending := make(map[string]*corev1.Pod)
+	for _, p := range pods {
+		if evictable(p) {
+			pending[podKey(p)] = p
+		}
+	}
+	log.WithFields(logrus.Fields{"pods": len(pending), "skipped": len(pods) - len(pending)}).Info("Evicting pods from node")
+
+	evicted, blocked := make(map[string]bool), make(map[string]bool)
+	progressAt := time.Now()
+	for {
+		for key, p := range pending {
+			if evicted[key] {
+				if gone, err := h.client.podGone(ctx, p); err == nil && gone {
+					log.WithField("pod", key).Debug("Evicted pod is gone")
+					delete(pending, key)
+				}
+				continue
+			}
+			err := h.client.evict(ctx, p, h.gracePeriod(ctx, p))
+			switch {
+			case err == nil:
+				log.WithField("pod", key).Info("Evicted pod")
+				evicted[key] = true
+				delete(blocked, key)
+			case apierrors.IsNotFound(err):
+				delete(pending, key)
+			case apierrors.IsTooManyRequests(err):
+				if !blocked[key] {
+					log.WithField("pod", key).WithError(err).Warn("Eviction of pod is blocked by a PodDisruptionBudget, retrying")
+				}
+				blocked[key] = true
+			case ctx.Err() != nil:
+			case isKubernetesClientError(err):
+				return fmt.Errorf("failed to evict pod %s: %w", key, err)
+			default:
+				log.WithField("pod", key).WithError(err).Warn("Failed to evict pod, retrying")
+			}
+		}
+		if len(pending) == 0 {
+			log.Info("Drained node")
+			return nil
+		}
+		if time.Since(progressAt) >= drainProgressInterval {
+			log.WithFields(logrus.Fields{"remaining": len(pending), "blocked": len(blocked)}).Info("Draining node")
+			progressAt = time.Now()
+		}
+
+		timer := time.NewTimer(h.options.RetryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return newDrainError(node, pending, blocked, ctx.Err())
+		}
+	}
+}
+
+// gracePeriod returns the termination grace period of the eviction of the pod: the configured
+// one, or -1 for that of the pod, shortened to the time left before the deadline of the drain but
+// not to less than minPodGracePeriod.
+func (h *KubernetesDrainHandler) gracePeriod(ctx context.Context, pod *corev1.Pod) time.Duration {
+	grace, configured := h.options.GracePeriod, h.options.GracePeriod > 0
+	if !configured {
+		grace = defaultPodGracePeriod
+		if s := pod.Spec.TerminationGracePeriodSeconds; s != nil {
+			grace = time.Duration(*s) * time.Second
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < grace {
+			grace, configured = left, true
+		}
+	}
+	if !configured {
+		return -1
+	}
+	if grace < minPodGracePeriod {
+		return minPodGracePeriod
+	}
+	return grace
+}
+
+// DrainError is returned by the KubernetesDrainHandler when the node was not drained before the
+// deadline, with the pods that were left on it.
+type DrainError struct {
+	Node string
+
+	// Remaining are the pods that were not gone, and Blocked those of them whose eviction a
+	// PodDisruptionBudget blocked, as namespace/name.
+	Remaining []string
+	Blocked   []string
+
+	Err error
+}
+
+func newDrainError(node string, pending map[string]*corev1.Pod, blocked map[string]bool, err error) *DrainError {
+	e := &DrainError{Node: node, Err: err}
+	for key := range pending {
+		e.Remaining = append(e.Remaining, key)
+		if blocked[key] {
+			e.Blocked = append(e.Blocked, key)
+		}
+	}
+	sort.Strings(e.Remaining)
+	sort.Strings(e.Blocked)
+	return e
+}
+
+func (e *DrainError) Error() string {
+	msg := fmt.Sprintf("node %s was not drained, %d pods remain (%s)", e.Node, len(e.Remaining), strings.Join(e.Remaining, ", "))
+	if len(e.Blocked) > 0 {
+		msg += fmt.Sprintf(", of which a PodDisruptionBudget blocks %s", strings.Join(e.Blocked, ", "))
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error of the context of the drain.
+func (e *DrainError) Unwrap() error {
+	return e.Err
+}
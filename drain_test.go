@@ -0,0 +1,292 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+// fakeKubernetes is the part of the API of a cluster that the drain handler uses, with the node
+// of the instance and its pods, which are listed in two pages.
+type fakeKubernetes struct {
+	mu        sync.Mutex
+	cordoned  bool
+	evictions []string
+	grace     []int64
+
+	// blocked is the number of evictions of default/app that a PodDisruptionBudget blocks
+	// (forever if negative)
+	blocked int
+	evicted map[string]bool
+}
+
+// writeKubernetes writes the JSON of a response of the API.
+func writeKubernetes(w http.ResponseWriter, code int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write([]byte(body))
+}
+
+// writeKubernetesStatus writes the Status of a response of the API that is not a success.
+func writeKubernetesStatus(w http.ResponseWriter, code int, reason string) {
+	writeKubernetes(w, code, fmt.Sprintf(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":%q,"code":%d}`, reason, code))
+}
+
+func (f *fakeKubernetes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		writeKubernetesStatus(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/nodes":
+		writeKubernetes(w, http.StatusOK, `{"kind":"NodeList","apiVersion":"v1","metadata":{},"items":[
+			{"metadata":{"name":"other"},"spec":{"providerID":"aws:///us-east-1a/i-111111111111"}},
+			{"metadata":{"name":"node-1"},"spec":{"providerID":"aws:///us-east-1a/i-000000000000"}}
+		]}`)
+	case r.Method == http.MethodPatch && r.URL.Path == "/api/v1/nodes/node-1":
+		body, _ := ioutil.ReadAll(r.Body)
+		f.cordoned = strings.Contains(string(body), `"unschedulable":true`)
+		writeKubernetes(w, http.StatusOK, `{"kind":"Node","apiVersion":"v1","metadata":{"name":"node-1"},"spec":{"unschedulable":true}}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/pods":
+		if r.URL.Query().Get("fieldSelector") != "spec.nodeName=node-1" {
+			writeKubernetesStatus(w, http.StatusBadRequest, "BadRequest")
+			return
+		}
+		if r.URL.Query().Get("continue") == "" {
+			writeKubernetes(w, http.StatusOK, `{"kind":"PodList","apiVersion":"v1","metadata":{"continue":"page-2"},"items":[
+				{"metadata":{"name":"app","namespace":"default","uid":"1","ownerReferences":[{"apiVersion":"apps/v1","kind":"ReplicaSet","name":"app","uid":"5","controller":true}]},"status":{"phase":"Running"}},
+				{"metadata":{"name":"agent","namespace":"kube-system","uid":"2","ownerReferences":[{"apiVersion":"apps/v1","kind":"DaemonSet","name":"agent","uid":"6","controller":true}]},"status":{"phase":"Running"}},
+				{"metadata":{"name":"static","namespace":"kube-system","uid":"3","annotations":{"kubernetes.io/config.mirror":"abc"}},"status":{"phase":"Running"}}
+			]}`)
+			return
+		}
+		writeKubernetes(w, http.StatusOK, `{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[
+			{"metadata":{"name":"job","namespace":"default","uid":"4"},"status":{"phase":"Succeeded"}},
+			{"metadata":{"name":"web","namespace":"default","uid":"7"},"status":{"phase":"Running"}}
+		]}`)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/eviction"):
+		var eviction struct {
+			DeleteOptions struct {
+				GracePeriodSeconds *int64 `json:"gracePeriodSeconds"`
+			} `json:"deleteOptions"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &eviction)
+		f.evictions = append(f.evictions, r.URL.Path)
+		if g := eviction.DeleteOptions.GracePeriodSeconds; g != nil {
+			f.grace = append(f.grace, *g)
+		}
+		if f.blocked != 0 && strings.HasSuffix(r.URL.Path, "/pods/app/eviction") {
+			f.blocked--
+			writeKubernetesStatus(w, http.StatusTooManyRequests, "TooManyRequests")
+			return
+		}
+		f.evicted[strings.TrimSuffix(r.URL.Path, "/eviction")] = true
+		writeKubernetes(w, http.StatusCreated, `{"kind":"Status","apiVersion":"v1","status":"Success","code":201}`)
+	case r.Method == http.MethodGet && f.evicted[r.URL.Path]:
+		writeKubernetesStatus(w, http.StatusNotFound, "NotFound")
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/default/pods/"):
+		name := strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/default/pods/")
+		uid := map[string]string{"app": "1", "web": "7"}[name]
+		writeKubernetes(w, http.StatusOK, fmt.Sprintf(`{"kind":"Pod","apiVersion":"v1","metadata":{"name":%q,"namespace":"default","uid":%q}}`, name, uid))
+	default:
+		writeKubernetesStatus(w, http.StatusNotFound, "NotFound")
+	}
+}
+
+// writeKubeconfig writes a kubeconfig for the TLS server with a token to the directory.
+func writeKubeconfig(t *testing.T, dir string, server *httptest.Server) string {
+	path := filepath.Join(dir, "kubeconfig")
+	ca := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	config := `apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: cluster
+  cluster:
+    server: ` + server.URL + `
+    certificate-authority-data: ` + ca + `
+contexts:
+- name: test
+  context:
+    cluster: cluster
+    user: lifecycled
+users:
+- name: lifecycled
+  user:
+    token: secret
+`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %s", err)
+	}
+	return path
+}
+
+func TestKubernetesDrainHandler(t *testing.T) {
+	tests := []struct {
+		description string
+		instanceID  string
+		blocked     int
+		timeout     time.Duration
+		expectError bool
+		expectGrace int64
+	}{
+		{
+			description: "drains the node",
+			instanceID:  "i-000000000000",
+			expectGrace: 10,
+		},
+		{
+			description: "retries the evictions that a disruption budget blocks",
+			instanceID:  "i-000000000000",
+			blocked:     2,
+			expectGrace: 10,
+		},
+		{
+			description: "shortens the grace period to the time left before the deadline",
+			instanceID:  "i-000000000000",
+			timeout:     500 * time.Millisecond,
+			expectGrace: 1,
+		},
+		{
+			description: "gives up when a disruption budget blocks until the timeout",
+			instanceID:  "i-000000000000",
+			blocked:     -1,
+			timeout:     100 * time.Millisecond,
+			expectError: true,
+		},
+		{
+			description: "no node for the instance",
+			instanceID:  "i-222222222222",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			api := &fakeKubernetes{blocked: tc.blocked, evicted: make(map[string]bool)}
+			server := httptest.NewTLSServer(api)
+			defer server.Close()
+
+			dir, err := ioutil.TempDir("", "lifecycled")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			handler, err := lifecycled.NewKubernetesDrainHandler(lifecycled.KubernetesDrainOptions{
+				Kubeconfig:    writeKubeconfig(t, dir, server),
+				GracePeriod:   10 * time.Second,
+				Timeout:       tc.timeout,
+				RetryInterval: 10 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			logger, hook := logrustest.NewNullLogger()
+			err = handler.HandleNotice(context.TODO(), &lifecycled.Notice{
+				Type:       "autoscaling",
+				InstanceID: tc.instanceID,
+				Log:        logger.WithField("runId", "run"),
+			})
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			if tc.instanceID != "i-000000000000" {
+				return
+			}
+			if !api.cordoned {
+				t.Error("expected the node to be cordoned")
+			}
+			evicted := make(map[string]bool)
+			for _, e := range api.evictions {
+				evicted[e] = true
+			}
+			if len(evicted) != 2 || !evicted["/api/v1/namespaces/default/pods/app/eviction"] || !evicted["/api/v1/namespaces/default/pods/web/eviction"] {
+				t.Errorf("expected the running pods of both pages that aren't of a daemon set or static to be evicted and got %v", api.evictions)
+			}
+			if !tc.expectError {
+				if got, want := len(api.evictions), tc.blocked+2; got != want {
+					t.Errorf("expected %d evictions and got %d", want, got)
+				}
+				if got := api.grace[len(api.grace)-1]; got != tc.expectGrace {
+					t.Errorf("expected a grace period of %ds and got %ds", tc.expectGrace, got)
+				}
+				return
+			}
+
+			var drainErr *lifecycled.DrainError
+			if !errors.As(err, &drainErr) {
+				t.Fatalf("expected a drain error and got: %s", err)
+			}
+			if got := strings.Join(drainErr.Blocked, ","); got != "default/app" {
+				t.Errorf("expected the blocked pods to be default/app and got %s", got)
+			}
+			if got := strings.Join(drainErr.Remaining, ","); got != "default/app" {
+				t.Errorf("expected the remaining pods to be default/app and got %s", got)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected the drain to have reached its deadline: %s", err)
+			}
+			for _, g := range api.grace {
+				if g != 1 {
+					t.Errorf("expected the grace period to be shortened to the time left, but not to zero, and got %ds", g)
+				}
+			}
+			var warned bool
+			for _, e := range hook.AllEntries() {
+				warned = warned || (strings.Contains(e.Message, "blocked by a PodDisruptionBudget") && e.Data["node"] == "node-1" && e.Data["runId"] == "run")
+			}
+			if !warned {
+				t.Error("expected the blocked eviction to be logged with the fields of the notice")
+			}
+		})
+	}
+}
+
+func TestNewBuiltinHandler(t *testing.T) {
+	if _, err := lifecycled.NewBuiltinHandler("builtin:kubectl", &lifecycled.Config{}); err == nil {
+		t.Error("expected an error for an unknown built-in handler")
+	}
+
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	handler, err := lifecycled.NewBuiltinHandler("builtin:k8s-drain", &lifecycled.Config{Kubeconfig: writeKubeconfig(t, dir, server)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := handler.(lifecycled.NoticeHandler); !ok {
+		t.Error("expected the drain handler to be given the notice")
+	}
+}
@@ -0,0 +1,71 @@
+package lifecycled
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationUnits are the units that ParseDuration accepts in addition to those of time.ParseDuration.
+var durationUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// ParseDuration parses a duration like time.ParseDuration, e.g. 30s or 1h30m, which also accepts
+// days (d) and weeks (w), e.g. 1d12h. Every number must have a unit, except for zero, so that a
+// bare number such as 600 is an error rather than 600 nanoseconds or seconds depending on the tool.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		if strings.Trim(s, "+-0.") == "" {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("duration %q has no unit (e.g. %ss or %sm)", s, s, s)
+	}
+
+	rest, sign := s, time.Duration(1)
+	if rest[0] == '-' || rest[0] == '+' {
+		if rest[0] == '-' {
+			sign = -1
+		}
+		rest = rest[1:]
+	}
+
+	// Split off the days and weeks, and leave the rest to time.ParseDuration
+	var d time.Duration
+	var std strings.Builder
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		j := strings.IndexFunc(rest[i:], func(r rune) bool { return (r >= '0' && r <= '9') || r == '.' })
+		if j < 0 {
+			j = len(rest) - i
+		}
+		number, unit := rest[:i], rest[i:i+j]
+		rest = rest[i+j:]
+
+		if u, ok := durationUnits[unit]; ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			d += time.Duration(n * float64(u))
+			continue
+		}
+		std.WriteString(number + unit)
+	}
+	if std.Len() > 0 {
+		parsed, err := time.ParseDuration(std.String())
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += parsed
+	}
+	return sign * d, nil
+}
@@ -0,0 +1,53 @@
+package lifecycled_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/triarius/lifecycled"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    time.Duration
+		expectError bool
+	}{
+		{input: "30s", expected: 30 * time.Second},
+		{input: "1h30m", expected: 90 * time.Minute},
+		{input: "1.5h", expected: 90 * time.Minute},
+		{input: "250ms", expected: 250 * time.Millisecond},
+		{input: "1d", expected: 24 * time.Hour},
+		{input: "1d12h", expected: 36 * time.Hour},
+		{input: "0.5d", expected: 12 * time.Hour},
+		{input: "2w", expected: 14 * 24 * time.Hour},
+		{input: "1w1d1h1m1s", expected: 8*24*time.Hour + time.Hour + time.Minute + time.Second},
+		{input: "-1m", expected: -time.Minute},
+		{input: "0", expected: 0},
+		{input: "600", expectError: true},
+		{input: "1.5", expectError: true},
+		{input: "", expectError: true},
+		{input: "d", expectError: true},
+		{input: "5x", expectError: true},
+		{input: "1d-1h", expectError: true},
+		{input: "soon", expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			d, err := lifecycled.ParseDuration(tc.input)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("expected an error and got %s", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if d != tc.expected {
+				t.Errorf("expected %s and got %s", tc.expected, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package lifecycled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+)
+
+// Error codes are stable identifiers for classes of errors, for consumers of logs and events
+// that can't use errors.Is. Library consumers should use errors.Is with the Err* sentinels.
+const (
+	CodeQueueCreate       = "queue_create"
+	CodeSubscribe         = "subscribe"
+	CodeReceive           = "receive"
+	CodeHandlerFailed     = "handler_failed"
+	CodeCompleteLifecycle = "complete_lifecycle"
+	CodeHeartbeatLost     = "heartbeat_lost"
+	CodeHeartbeatTimeout  = "heartbeat_timeout"
+	CodeNotTerminating    = "not_terminating"
+	CodeListenerFailed    = "listener_failed"
+	CodeCredentials       = "credentials"
+	CodePanic             = "panic"
+	CodeUnknown           = "unknown"
+)
+
+// Sentinel errors for each class of failure, which errors returned by the package wrap.
+var (
+	// ErrQueueCreate is wrapped by errors from creating the SQS queue.
+	ErrQueueCreate = newSentinel(CodeQueueCreate, "failed to create queue")
+
+	// ErrSubscribe is wrapped by errors from subscribing the queue to the SNS topic.
+	ErrSubscribe = newSentinel(CodeSubscribe, "failed to subscribe queue")
+
+	// ErrReceive is wrapped by errors from receiving messages from the queue.
+	ErrReceive = newSentinel(CodeReceive, "failed to receive messages")
+
+	// ErrHandlerFailed is matched by a *HandlerError, which has the exit code of the handler.
+	ErrHandlerFailed = newSentinel(CodeHandlerFailed, "handler failed")
+
+	// ErrCompleteLifecycle is wrapped by errors from completing the lifecycle action, which
+	// are the CompletionError of a Summary.
+	ErrCompleteLifecycle = newSentinel(CodeCompleteLifecycle, "failed to complete lifecycle action")
+
+	// ErrListenerFailed is matched by a *ListenerError.
+	ErrListenerFailed = newSentinel(CodeListenerFailed, "listener failed")
+
+	// ErrCredentials is wrapped by errors from assuming the role of the AWS clients.
+	ErrCredentials = newSentinel(CodeCredentials, "failed to get aws credentials")
+
+	// ErrPanic is matched by a *PanicError.
+	ErrPanic = newSentinel(CodePanic, "panic")
+)
+
+// sentinel is an error with a stable code.
+type sentinel struct {
+	code string
+	msg  string
+}
+
+func newSentinel(code, msg string) error {
+	return &sentinel{code: code, msg: msg}
+}
+
+func (e *sentinel) Error() string {
+	return e.msg
+}
+
+// Code returns the error code.
+func (e *sentinel) Code() string {
+	return e.code
+}
+
+// Error is returned when an operation fails, and matches the sentinel error for
+// the operation (e.g. ErrQueueCreate) with errors.Is.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// wrapError returns nil if err is nil.
+func wrapError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+// Unwrap returns the error that caused the operation to fail.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if target is the sentinel error for the operation.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Code returns the error code of the sentinel error for the operation.
+func (e *Error) Code() string {
+	return ErrorCode(e.Kind)
+}
+
+// HandlerError is returned when the handler fails, and matches ErrHandlerFailed with errors.Is.
+// It has the same message as the error returned by the handler.
+type HandlerError struct {
+	// ExitCode of the handler, which is -1 if the handler failed without an exit code.
+	ExitCode int
+	Err      error
+}
+
+// newHandlerError wraps the error returned by a handler, unless it is nil or already wrapped.
+func newHandlerError(err error) error {
+	var herr *HandlerError
+	if err == nil || errors.As(err, &herr) {
+		return err
+	}
+	code := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	}
+	return &HandlerError{ExitCode: code, Err: err}
+}
+
+func (e *HandlerError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error returned by the handler.
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if target is ErrHandlerFailed.
+func (e *HandlerError) Is(target error) bool {
+	return target == ErrHandlerFailed
+}
+
+// Code returns CodeHandlerFailed.
+func (e *HandlerError) Code() string {
+	return CodeHandlerFailed
+}
+
+// coder is implemented by errors that have an error code.
+type coder interface {
+	Code() string
+}
+
+// ErrorCode returns the code of the outermost error in the chain that has one, followed by the
+// code of an AWS API error (e.g. AccessDenied), CodeUnknown if none of them do, or an empty
+// string if the error is nil.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var c coder
+	if errors.As(err, &c) {
+		return c.Code()
+	}
+	if e, ok := apiError(err); ok {
+		return e.ErrorCode()
+	}
+	return CodeUnknown
+}
+
+// isCanceled returns true if an AWS API call failed because its context is done, e.g. when
+// shutting down.
+func isCanceled(err error) bool {
+	var e *aws.RequestCanceledError
+	var c *smithy.CanceledError
+	return errors.As(err, &e) || errors.As(err, &c) || errors.Is(err, context.Canceled)
+}
+
+// authorizationErrorCodes are the error codes of the AWS APIs that deny a call, e.g. because the
+// role of the instance or the policy of the queue hasn't propagated yet.
+var authorizationErrorCodes = map[string]bool{
+	"AccessDenied":                        true,
+	"AccessDeniedException":               true,
+	"AuthorizationError":                  true,
+	"AWS.SimpleQueueService.AccessDenied": true,
+}
+
+// isAuthorizationError returns true if the AWS API call was denied.
+func isAuthorizationError(err error) bool {
+	e, ok := apiError(err)
+	return ok && authorizationErrorCodes[e.ErrorCode()]
+}
+
+// isNotFound returns true if the request failed with a 404, e.g. for instance metadata that
+// doesn't exist.
+func isNotFound(err error) bool {
+	var e interface{ HTTPStatusCode() int }
+	return errors.As(err, &e) && e.HTTPStatusCode() == http.StatusNotFound
+}
+
+// apiError returns the error of the AWS API in the chain, e.g. a ValidationError, if any.
+func apiError(err error) (smithy.APIError, bool) {
+	var e smithy.APIError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
@@ -0,0 +1,148 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestQueueErrors(t *testing.T) {
+	tests := []struct {
+		description  string
+		setup        func(sq *mocks.MockSQSClient, sn *mocks.MockSNSClient, cause error)
+		call         func(q *lifecycled.Queue) error
+		expected     error
+		expectedCode string
+	}{
+		{
+			description: "create",
+			setup: func(sq *mocks.MockSQSClient, _ *mocks.MockSNSClient, cause error) {
+				sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, cause)
+			},
+			call:         func(q *lifecycled.Queue) error { return q.Create(context.TODO()) },
+			expected:     lifecycled.ErrQueueCreate,
+			expectedCode: lifecycled.CodeQueueCreate,
+		},
+		{
+			description: "subscribe",
+			setup: func(sq *mocks.MockSQSClient, sn *mocks.MockSNSClient, cause error) {
+				sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Return(&sqs.GetQueueAttributesOutput{
+					Attributes: map[string]string{"QueueArn": "arn"},
+				}, nil)
+				sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, cause)
+			},
+			call:         func(q *lifecycled.Queue) error { return q.Subscribe(context.TODO()) },
+			expected:     lifecycled.ErrSubscribe,
+			expectedCode: lifecycled.CodeSubscribe,
+		},
+		{
+			description: "receive",
+			setup: func(sq *mocks.MockSQSClient, _ *mocks.MockSNSClient, cause error) {
+				sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, cause)
+			},
+			call: func(q *lifecycled.Queue) error {
+				_, err := q.GetMessages(context.TODO())
+				return err
+			},
+			expected:     lifecycled.ErrReceive,
+			expectedCode: lifecycled.CodeReceive,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cause := &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized"}
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			tc.setup(sq, sn, cause)
+
+			err := tc.call(lifecycled.NewQueue("queue", "topic", sq, sn))
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected error to match '%s' and got '%v'", tc.expected, err)
+			}
+			var aerr smithy.APIError
+			if !errors.As(err, &aerr) || aerr.ErrorCode() != "AccessDenied" {
+				t.Errorf("expected error to wrap the aws error and got '%v'", err)
+			}
+			if got, want := lifecycled.ErrorCode(err), tc.expectedCode; got != want {
+				t.Errorf("expected error code '%s' and got '%s'", want, got)
+			}
+		})
+	}
+}
+
+func TestHandlerErrorIs(t *testing.T) {
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+
+	err := daemon.Handle(context.TODO(), fakeNotice{}, failingHandler{})
+	if !errors.Is(err, lifecycled.ErrHandlerFailed) {
+		t.Fatalf("expected error to match ErrHandlerFailed and got '%v'", err)
+	}
+	var herr *lifecycled.HandlerError
+	if !errors.As(err, &herr) {
+		t.Fatalf("expected a *HandlerError and got %T", err)
+	}
+	if got, want := herr.ExitCode, -1; got != want {
+		t.Errorf("expected exit code %d and got %d", want, got)
+	}
+	// The message is the one returned by the handler
+	if got, want := err.Error(), "failed"; got != want {
+		t.Errorf("expected error '%s' and got '%s'", want, got)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	handlerErr := &lifecycled.HandlerError{ExitCode: 1, Err: errors.New("exit status 1")}
+	tests := []struct {
+		err      error
+		is       error
+		expected string
+	}{
+		{err: nil, expected: ""},
+		{err: errors.New("unknown"), expected: lifecycled.CodeUnknown},
+		{err: handlerErr, is: lifecycled.ErrHandlerFailed, expected: lifecycled.CodeHandlerFailed},
+		{
+			err:      &lifecycled.HeartbeatTimeoutError{Duration: time.Hour, Err: handlerErr},
+			is:       lifecycled.ErrHandlerFailed,
+			expected: lifecycled.CodeHeartbeatTimeout,
+		},
+		{
+			err:      fmt.Errorf("%w: lifecycle state is InService", lifecycled.ErrNotTerminating),
+			is:       lifecycled.ErrNotTerminating,
+			expected: lifecycled.CodeNotTerminating,
+		},
+		{
+			err:      fmt.Errorf("%w: %s", lifecycled.ErrLifecycleActionLost, handlerErr),
+			is:       lifecycled.ErrHeartbeatLost,
+			expected: lifecycled.CodeHeartbeatLost,
+		},
+		{
+			err:      &lifecycled.ListenerError{Type: "spot", Err: errors.New("unavailable")},
+			is:       lifecycled.ErrListenerFailed,
+			expected: lifecycled.CodeListenerFailed,
+		},
+		{err: &lifecycled.PanicError{Value: "boom"}, is: lifecycled.ErrPanic, expected: lifecycled.CodePanic},
+	}
+
+	for _, tc := range tests {
+		if got := lifecycled.ErrorCode(tc.err); got != tc.expected {
+			t.Errorf("expected code '%s' for '%v' and got '%s'", tc.expected, tc.err, got)
+		}
+		if tc.is != nil && !errors.Is(tc.err, tc.is) {
+			t.Errorf("expected '%v' to match '%s'", tc.err, tc.is)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package lifecycled
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/sirupsen/logrus"
+)
+
+// CompletionEvent is published once a termination notice has been handled, as a
+// positive signal that the instance has finished draining.
+type CompletionEvent struct {
+	InstanceID string `json:"instanceId"`
+	Notice     string `json:"notice"`
+	Transition string `json:"transition,omitempty"`
+
+	// RunID identifies the log lines, notifications and audit record of the notice.
+	RunID string `json:"runId,omitempty"`
+
+	// Result is the lifecycle action result (CONTINUE or ABANDON), if the action was completed.
+	Result string `json:"result,omitempty"`
+
+	// ExitCode of the handler, which is -1 if the handler failed without an exit code.
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+
+	// ErrorCode classifies the error (see ErrorCode).
+	ErrorCode string `json:"errorCode,omitempty"`
+
+	HandlerDuration float64   `json:"handlerDurationSeconds"`
+	TotalDuration   float64   `json:"totalDurationSeconds"`
+	Time            time.Time `json:"time"`
+}
+
+// EventPublisher publishes completion events.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *CompletionEvent) error
+}
+
+// completionResulter is implemented by notices that complete a lifecycle action.
+type completionResulter interface {
+	completionOutcome() (result string, err error)
+}
+
+const publishRetryInterval = time.Second
+
+// NewSNSPublisher returns a publisher which sends completion events to an SNS topic.
+func NewSNSPublisher(client SNSClient, topicArn string) *SNSPublisher {
+	return &SNSPublisher{client: client, topicArn: topicArn}
+}
+
+// SNSPublisher publishes completion events to an SNS topic.
+type SNSPublisher struct {
+	client   SNSClient
+	topicArn string
+}
+
+// Publish the event as the JSON message.
+func (p *SNSPublisher) Publish(ctx context.Context, event *CompletionEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = p.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(p.topicArn),
+		Subject:  aws.String(fmt.Sprintf("lifecycled: %s handled %s notice", event.InstanceID, event.Notice)),
+		Message:  aws.String(string(body)),
+	})
+	return err
+}
+
+// NewWebhookPublisher returns a publisher which posts completion events to the URL, with the
+// token (if any) as a bearer token. A nil client uses a client with a 10 second timeout.
+func NewWebhookPublisher(url, token string, client *http.Client) *WebhookPublisher {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &WebhookPublisher{url: url, token: token, client: client}
+}
+
+// WebhookPublisher posts completion events to an HTTP endpoint.
+type WebhookPublisher struct {
+	mu     sync.Mutex
+	url    string
+	token  string
+	client *http.Client
+}
+
+// setToken replaces the bearer token, e.g. when it was rotated (see Daemon.ReloadSecrets).
+func (p *WebhookPublisher) setToken(token string) {
+	p.mu.Lock()
+	p.token = token
+	p.mu.Unlock()
+}
+
+// Publish the event as a JSON request body.
+func (p *WebhookPublisher) Publish(ctx context.Context, event *CompletionEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	p.mu.Lock()
+	token := p.token
+	p.mu.Unlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response from webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// SetPublisher configures the daemon to publish a completion event after each notice is handled.
+func (d *Daemon) SetPublisher(p EventPublisher) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.publisher = p
+}
+
+// publish a completion event for the notice, retrying once. Failing to publish is
+// logged, but never changes the outcome of handling the notice.
+func (d *Daemon) publish(notice TerminationNotice, runID string, handlerDuration, totalDuration time.Duration, handlerErr error, log *logrus.Entry) {
+	d.mu.Lock()
+	publisher := d.publisher
+	d.mu.Unlock()
+	if publisher == nil {
+		return
+	}
+
+	event := &CompletionEvent{
+		InstanceID:      d.instanceID,
+		RunID:           runID,
+		Notice:          notice.Type(),
+		HandlerDuration: handlerDuration.Seconds(),
+		TotalDuration:   totalDuration.Seconds(),
+		Time:            time.Now(),
+	}
+	if n, ok := notice.(DetailedNotice); ok {
+		event.Transition = n.Transition()
+	}
+	if n, ok := notice.(completionResulter); ok {
+		if result, err := n.completionOutcome(); err == nil {
+			event.Result = result
+		}
+	}
+	if handlerErr != nil {
+		event.Error = handlerErr.Error()
+		event.ErrorCode = ErrorCode(handlerErr)
+		event.ExitCode = exitCode(handlerErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.shutdownTimeout)
+	defer cancel()
+
+	err := publisher.Publish(ctx, event)
+	if err != nil {
+		log.WithError(err).Warn("Failed to publish completion event, retrying")
+		select {
+		case <-time.After(publishRetryInterval):
+			err = publisher.Publish(ctx, event)
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to publish completion event")
+		return
+	}
+	log.Info("Published completion event")
+}
+
+// exitCode returns the exit code of a handler that returned err, which is -1 if
+// it failed without an exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var herr *HandlerError
+	if errors.As(err, &herr) {
+		return herr.ExitCode
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// timedHandler records how long the handler took to execute.
+type timedHandler struct {
+	Handler
+	duration time.Duration
+
+	// started is called when the handler starts, if set, and returns the latency from the
+	// lifecycle hook firing
+	started      func(at time.Time) time.Duration
+	startLatency time.Duration
+}
+
+// Execute the handler.
+func (h *timedHandler) Execute(ctx context.Context, args ...string) error {
+	defer h.time(ctx)()
+	return newHandlerError(h.Handler.Execute(ctx, args...))
+}
+
+// HandleNotice passes the notice to the handler.
+func (h *timedHandler) HandleNotice(ctx context.Context, notice *Notice) error {
+	defer h.time(ctx)()
+	return executeHandler(ctx, h.Handler, notice)
+}
+
+func (h *timedHandler) time(ctx context.Context) func() {
+	tl := timelineFrom(ctx)
+	start := time.Now()
+	tl.add(start, TimelineHandlerStarted, "")
+	if h.started != nil {
+		h.startLatency = h.started(start)
+	}
+	return func() {
+		h.duration = time.Since(start)
+		tl.add(start.Add(h.duration), TimelineHandlerFinished, "")
+	}
+}
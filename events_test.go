@@ -0,0 +1,93 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+func TestWebhookPublisher(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+		event    lifecycled.CompletionEvent
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+
+		if got, want := r.Header.Get("Authorization"), "Bearer token"; got != want {
+			t.Errorf("expected authorization '%s' and got '%s'", want, got)
+		}
+		// Fail the first request, to check that it is retried
+		if requests == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("failed to decode event: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+	daemon.SetPublisher(lifecycled.NewWebhookPublisher(server.URL, "token", server.Client()))
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, failingHandler{}); err == nil {
+		t.Fatal("expected handler to fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := requests, 2; got != want {
+		t.Fatalf("expected %d requests and got %d", want, got)
+	}
+	if got, want := event.InstanceID, "i-000000000000"; got != want {
+		t.Errorf("expected instance id '%s' and got '%s'", want, got)
+	}
+	if got, want := event.Notice, "fake"; got != want {
+		t.Errorf("expected notice '%s' and got '%s'", want, got)
+	}
+	if got, want := event.Error, "failed"; got != want {
+		t.Errorf("expected error '%s' and got '%s'", want, got)
+	}
+	if got, want := event.ExitCode, -1; got != want {
+		t.Errorf("expected exit code %d and got %d", want, got)
+	}
+}
+
+type failingPublisher struct {
+	mu       sync.Mutex
+	attempts int
+}
+
+func (p *failingPublisher) Publish(context.Context, *lifecycled.CompletionEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attempts++
+	return errors.New("unavailable")
+}
+
+func TestPublishFailureDoesNotChangeOutcome(t *testing.T) {
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+
+	publisher := &failingPublisher{}
+	daemon.SetPublisher(publisher)
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, &countingHandler{}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if got, want := publisher.attempts, 2; got != want {
+		t.Errorf("expected %d attempts to publish and got %d", want, got)
+	}
+}
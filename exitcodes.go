@@ -0,0 +1,81 @@
+package lifecycled
+
+import "errors"
+
+// Outcomes that the daemon doesn't summarize, since it didn't run to completion.
+const (
+	// OutcomeInvalidConfig is when the command line or configuration is invalid.
+	OutcomeInvalidConfig = "invalid-config"
+
+	// OutcomeSetupFailed is when the daemon failed to start, e.g. to look up the instance id
+	// or region, assume the role or open the destinations of the logs.
+	OutcomeSetupFailed = "setup-failed"
+
+	// OutcomeCommandFailed is when a command other than running the daemon failed, e.g. to
+	// call AWS, or a check of validate failed.
+	OutcomeCommandFailed = "command-failed"
+
+	// OutcomeDaemonUnreachable is when a command could not get the status or configuration of
+	// the running daemon from its endpoints or state file.
+	OutcomeDaemonUnreachable = "daemon-unreachable"
+)
+
+// Exit codes of the lifecycled command for each outcome.
+const (
+	ExitSuccess           = 0
+	ExitInvalidConfig     = 1
+	ExitHandlerFailed     = 2
+	ExitCompletionFailed  = 3
+	ExitListenerFailed    = 4
+	ExitInterrupted       = 5
+	ExitSetupFailed       = 6
+	ExitCommandFailed     = 7
+	ExitDaemonUnreachable = 8
+
+	// ExitPanic is EX_SOFTWARE from sysexits.h.
+	ExitPanic = 70
+)
+
+// ExitCode is an exit code of the lifecycled command, and the outcome that it is used for.
+type ExitCode struct {
+	Code        int    `json:"code"`
+	Outcome     string `json:"outcome"`
+	Description string `json:"description"`
+}
+
+// ExitCodes of the lifecycled command, which are stable so that they can be relied on by e.g. the
+// SuccessExitStatus and RestartPreventExitStatus of a systemd unit.
+var ExitCodes = []ExitCode{
+	{ExitSuccess, OutcomeSuccess, "The termination notice was handled and the lifecycle action completed"},
+	{ExitSuccess, OutcomeStopped, "lifecycled was shut down before it received a termination notice"},
+	{ExitInvalidConfig, OutcomeInvalidConfig, "The command line or configuration is invalid"},
+	{ExitHandlerFailed, OutcomeHandlerFailed, "The handler failed"},
+	{ExitCompletionFailed, OutcomeCompletionFailed, "The lifecycle action could not be completed"},
+	{ExitListenerFailed, OutcomeListenerFailed, "A listener failed and exhausted its restarts"},
+	{ExitInterrupted, OutcomeInterrupted, "lifecycled was shut down while it was handling a termination notice"},
+	{ExitSetupFailed, OutcomeSetupFailed, "lifecycled failed to start, e.g. to look up the instance id or assume the role"},
+	{ExitCommandFailed, OutcomeCommandFailed, "A command other than running the daemon failed, e.g. to call AWS, or a check failed"},
+	{ExitDaemonUnreachable, OutcomeDaemonUnreachable, "A command could not reach the running daemon on its endpoints or state file"},
+	{ExitPanic, OutcomePanic, "A handler or listener panicked, or the daemon stopped with an unknown outcome"},
+}
+
+// ExitCodeFor returns the exit code of the outcome, which is ExitPanic for unknown outcomes, since
+// they are a bug rather than an invalid configuration.
+func ExitCodeFor(outcome string) int {
+	for _, c := range ExitCodes {
+		if c.Outcome == outcome {
+			return c.Code
+		}
+	}
+	return ExitPanic
+}
+
+// ExitCode of the lifecycled command for the outcome of running the daemon.
+func (s *Summary) ExitCode() int {
+	return ExitCodeFor(s.Outcome())
+}
+
+// panicked returns true if the daemon stopped because a handler or listener panicked.
+func (s *Summary) panicked() bool {
+	return errors.Is(s.Err, ErrPanic)
+}
@@ -0,0 +1,116 @@
+package lifecycled_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+// idleListener never receives a notice.
+type idleListener struct{}
+
+func (idleListener) Type() string { return "idle" }
+
+func (idleListener) Start(ctx context.Context, _ chan<- lifecycled.TerminationNotice, _ *logrus.Entry) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		description string
+		listener    lifecycled.Listener
+		handler     lifecycled.Handler
+		cancel      bool
+		expected    int
+	}{
+		{
+			description: "notice handled",
+			listener:    &flakyListener{},
+			handler:     lifecycled.ChainHandler{},
+			expected:    lifecycled.ExitSuccess,
+		},
+		{
+			description: "shut down before a notice",
+			listener:    idleListener{},
+			handler:     lifecycled.ChainHandler{},
+			cancel:      true,
+			expected:    lifecycled.ExitSuccess,
+		},
+		{
+			description: "handler failed",
+			listener:    &flakyListener{},
+			handler:     failingHandler{},
+			expected:    lifecycled.ExitHandlerFailed,
+		},
+		{
+			description: "listener failed",
+			listener:    &flakyListener{failures: 2},
+			handler:     lifecycled.ChainHandler{},
+			expected:    lifecycled.ExitListenerFailed,
+		},
+		{
+			description: "interrupted while handling",
+			listener:    &flakyListener{},
+			handler: lifecycled.HandlerFunc(func(ctx context.Context, _ ...string) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+			cancel:   true,
+			expected: lifecycled.ExitInterrupted,
+		},
+		{
+			description: "handler panicked",
+			listener:    &flakyListener{},
+			handler: lifecycled.HandlerFunc(func(context.Context, ...string) error {
+				panic("boom")
+			}),
+			expected: lifecycled.ExitPanic,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			logger, _ := logrustest.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				InstanceID:             "i-000000000000",
+				ListenerRestartBackoff: time.Millisecond,
+			}, nil, nil, nil, nil, logger)
+			daemon.AddListener(tc.listener)
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+			defer cancel()
+			if tc.cancel {
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+
+			summary, _ := daemon.RunWithSummary(ctx, tc.handler)
+			if got, want := summary.ExitCode(), tc.expected; got != want {
+				t.Errorf("expected exit code %d and got %d (outcome %s)", want, got, summary.Outcome())
+			}
+		})
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	outcomes := make(map[string]bool)
+	for _, c := range lifecycled.ExitCodes {
+		if outcomes[c.Outcome] {
+			t.Errorf("duplicate exit code for outcome %s", c.Outcome)
+		}
+		outcomes[c.Outcome] = true
+		if got := lifecycled.ExitCodeFor(c.Outcome); got != c.Code {
+			t.Errorf("expected exit code %d for %s and got %d", c.Code, c.Outcome, got)
+		}
+	}
+}
+
+func TestExitCodeForUnknownOutcome(t *testing.T) {
+	if got := lifecycled.ExitCodeFor("unknown"); got == lifecycled.ExitInvalidConfig || got == lifecycled.ExitSuccess {
+		t.Errorf("expected an unknown outcome not to exit as an invalid configuration or success and got %d", got)
+	}
+}
@@ -4,13 +4,30 @@ go 1.14
 
 require (
 	github.com/alecthomas/kingpin v0.0.0-20180312062423-a39589180ebd
-	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
-	github.com/alecthomas/units v0.0.0-20190924025748-f65c72e2690d // indirect
-	github.com/aws/aws-sdk-go v1.34.13
+	github.com/aws/aws-sdk-go-v2 v1.17.1
+	github.com/aws/aws-sdk-go-v2/config v1.17.10
+	github.com/aws/aws-sdk-go-v2/credentials v1.12.23
+	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.12.19
+	github.com/aws/aws-sdk-go-v2/service/autoscaling v1.23.0
+	github.com/aws/aws-sdk-go-v2/service/cloudwatch v1.21.7
+	github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs v1.15.4
+	github.com/aws/aws-sdk-go-v2/service/ec2 v1.50.0
+	github.com/aws/aws-sdk-go-v2/service/sns v1.17.11
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.19.11
+	github.com/aws/aws-sdk-go-v2/service/sts v1.17.1
+	github.com/aws/smithy-go v1.13.4
 	github.com/golang/mock v1.4.4
-	github.com/kdar/gtest v0.0.0-20171003232747-b20da4453579 // indirect
-	github.com/kdar/logrus-cloudwatchlogs v0.0.0-20200414190340-facbc54742f0
+	github.com/prometheus/client_golang v1.11.1
 	github.com/sirupsen/logrus v1.6.0
-	github.com/smartystreets/assertions v0.0.0-20180927180507-b2de0cb4f26d // indirect
-	golang.org/x/sys v0.1.0 // indirect
+	go.mozilla.org/pkcs7 v0.10.0
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+	golang.org/x/net v0.0.0-20211209124913-491a49abca63
+	golang.org/x/sys v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
+	k8s.io/api v0.22.17
+	k8s.io/apimachinery v0.22.17
+	k8s.io/client-go v0.22.17
 )
@@ -0,0 +1,288 @@
+package lifecycled
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Handler is executed with the transition and instance id of a termination notice (followed
+// by the termination time for spot notices) as arguments.
+type Handler interface {
+	Execute(ctx context.Context, args ...string) error
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as a Handler.
+type HandlerFunc func(ctx context.Context, args ...string) error
+
+// Execute calls f(ctx, args...).
+func (f HandlerFunc) Execute(ctx context.Context, args ...string) error {
+	return f(ctx, args...)
+}
+
+// Notice describes the termination notice that is being handled.
+type Notice struct {
+	// Type of the notice, e.g. autoscaling or spot.
+	Type       string
+	Transition string
+	InstanceID string
+
+	// Args are the arguments that Execute is called with.
+	Args []string
+
+	// TerminationTime is the time that a spot instance will be terminated.
+	TerminationTime time.Time
+
+	// Autoscaling is the lifecycle hook message, for autoscaling notices.
+	Autoscaling *Message
+
+	// RunID identifies the notice in the logs and the other records of handling it.
+	RunID string
+
+	// Log has fields identifying the notice, such as the run id which is on every
+	// log line about handling it.
+	Log *logrus.Entry
+
+	// Complete asks for the lifecycle action to be completed right away, while the handler
+	// keeps running. It is nil for notices without a lifecycle action, and safe to call more than once.
+	Complete func()
+}
+
+// NoticeHandler is a Handler that is given the notice itself rather than arguments, for
+// handlers implemented in Go when embedding lifecycled. When a Handler implements
+// NoticeHandler, HandleNotice is called instead of Execute.
+type NoticeHandler interface {
+	Handler
+	HandleNotice(ctx context.Context, notice *Notice) error
+}
+
+// NoticeHandlerFunc is an adapter to allow the use of ordinary functions as a NoticeHandler.
+type NoticeHandlerFunc func(ctx context.Context, notice *Notice) error
+
+// HandleNotice calls f(ctx, notice).
+func (f NoticeHandlerFunc) HandleNotice(ctx context.Context, notice *Notice) error {
+	return f(ctx, notice)
+}
+
+// Execute calls f with a notice describing the arguments.
+func (f NoticeHandlerFunc) Execute(ctx context.Context, args ...string) error {
+	notice := &Notice{Args: args, RunID: runIDFrom(ctx)}
+	if len(args) > 0 {
+		notice.Transition = args[0]
+	}
+	if len(args) > 1 {
+		notice.InstanceID = args[1]
+	}
+	return f(ctx, notice)
+}
+
+// executeHandler passes the notice to the handler, as a *Notice if it is a NoticeHandler
+// and otherwise as arguments. Termination notices use it instead of calling Execute directly.
+func executeHandler(ctx context.Context, handler Handler, notice *Notice) error {
+	if notice.RunID == "" {
+		notice.RunID = runIDFrom(ctx)
+	}
+	if h, ok := handler.(NoticeHandler); ok {
+		return newHandlerError(h.HandleNotice(ctx, notice))
+	}
+	return newHandlerError(handler.Execute(ctx, notice.Args...))
+}
+
+// String describes the handlers in the chain.
+func (c ChainHandler) String() string {
+	names := make([]string, len(c))
+	for i, h := range c {
+		names[i] = handlerName(h)
+	}
+	return strings.Join(names, ", ")
+}
+
+// ChainHandler executes a series of handlers in order, stopping at the first that fails.
+type ChainHandler []Handler
+
+// Execute the handlers in the chain.
+func (c ChainHandler) Execute(ctx context.Context, args ...string) error {
+	for _, h := range c {
+		if err := h.Execute(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleNotice passes the notice to the handlers in the chain.
+func (c ChainHandler) HandleNotice(ctx context.Context, notice *Notice) error {
+	for _, h := range c {
+		if err := executeHandler(ctx, h, notice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompleteSentinel is the line that a file handler writes to the file descriptor in
+// LIFECYCLED_CONTROL_FD to complete the lifecycle action before it exits.
+const CompleteSentinel = "LIFECYCLED:COMPLETE"
+
+// controlDrainTimeout bounds the time spent reading the control pipe after the handler exits.
+const controlDrainTimeout = 100 * time.Millisecond
+
+// DefaultHandlerGracePeriod is the time that a handler has to exit once it is asked to stop.
+const DefaultHandlerGracePeriod = 10 * time.Second
+
+// NewFileHandler returns a handler which executes the file, with the DefaultHandlerGracePeriod.
+func NewFileHandler(file *os.File) *FileHandler {
+	return NewFileHandlerWithGracePeriod(file, DefaultHandlerGracePeriod)
+}
+
+// NewFileHandlerWithGracePeriod returns a handler which executes the file. When the context is
+// cancelled, the handler is asked to stop (SIGTERM to its process group, or CTRL_BREAK on Windows)
+// and its process tree is killed if it has not exited within the grace period.
+func NewFileHandlerWithGracePeriod(file *os.File, gracePeriod time.Duration) *FileHandler {
+	return &FileHandler{file: file, gracePeriod: gracePeriod}
+}
+
+// FileHandler ...
+type FileHandler struct {
+	file        *os.File
+	args        []string
+	gracePeriod time.Duration
+	output      io.Writer
+}
+
+// SetOutput writes the output of the handler to w instead of stderr.
+func (h *FileHandler) SetOutput(w io.Writer) {
+	h.output = w
+}
+
+// SetArgs passes the arguments to the handler before the arguments of each execution,
+// e.g. its own flags.
+func (h *FileHandler) SetArgs(args []string) {
+	h.args = args
+}
+
+// String returns the path of the file.
+func (h *FileHandler) String() string {
+	return h.file.Name()
+}
+
+// Validate that the handler is a regular file which can be executed.
+func (h *FileHandler) Validate() error {
+	info, err := h.file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", h.file.Name())
+	}
+	return checkExecutable(info)
+}
+
+// Execute the file handler.
+func (h *FileHandler) Execute(ctx context.Context, args ...string) error {
+	return h.run(ctx, args, nil)
+}
+
+// HandleNotice executes the file handler with the notice arguments. If the notice can be
+// completed early, the handler can write CompleteSentinel to the control pipe to do so.
+func (h *FileHandler) HandleNotice(ctx context.Context, notice *Notice) error {
+	return h.run(ctx, notice.Args, notice.Complete)
+}
+
+func (h *FileHandler) run(ctx context.Context, args []string, complete func()) error {
+	cmd := exec.Command(h.file.Name(), append(append([]string{}, h.args...), args...)...)
+	cmd.Env = append(append(os.Environ(), traceEnv(ctx)...), handlerEnv(ctx)...)
+	cmd.Stdout = os.Stderr
+	if h.output != nil {
+		cmd.Stdout = h.output
+	}
+	if w, ok := cmd.Stdout.(*logWriter); ok && runIDFrom(ctx) != "" {
+		cmd.Stdout = &logWriter{log: w.log.WithField("runId", runIDFrom(ctx))}
+	}
+	cmd.Stderr = cmd.Stdout
+	prepareCommand(cmd)
+
+	var control, w *os.File
+	if complete != nil {
+		var err error
+		if control, w, err = attachControl(cmd); err != nil {
+			return fmt.Errorf("failed to create control pipe: %s", err)
+		}
+	}
+
+	err := cmd.Start()
+	if w != nil {
+		// The handler has its own copy, and the pipe is closed once every copy is closed
+		w.Close()
+	}
+	if err != nil {
+		if control != nil {
+			control.Close()
+		}
+		return err
+	}
+	defer trackProcess(ctx, cmd.Process.Pid)()
+	if control == nil {
+		return h.wait(ctx, cmd)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		readControl(control, complete)
+	}()
+
+	err = h.wait(ctx, cmd)
+
+	// Children of the handler may still hold the pipe open, so don't wait for them
+	control.SetReadDeadline(time.Now().Add(controlDrainTimeout))
+	<-drained
+	control.Close()
+	return err
+}
+
+// readControl calls complete when the sentinel is read from the control pipe.
+func readControl(r *os.File, complete func()) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == CompleteSentinel {
+			complete()
+		}
+	}
+}
+
+// wait for the handler to exit, and stop it if the context is cancelled.
+func (h *FileHandler) wait(ctx context.Context, cmd *exec.Cmd) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	if err := interruptProcess(cmd); err == nil {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(h.gracePeriod):
+		}
+	}
+	if err := killProcess(cmd); err != nil {
+		return fmt.Errorf("failed to kill handler: %s", err)
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+package lifecycled
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// prepareCommand runs the handler in its own process group, so that
+// signals reach any children it spawns.
+func prepareCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// interruptProcess asks the handler process group to terminate.
+func interruptProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// killProcess kills the handler process group.
+func killProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// attachControl passes the write end of a pipe to the handler as file descriptor 3,
+// which is named in LIFECYCLED_CONTROL_FD, and returns both ends.
+func attachControl(cmd *exec.Cmd) (r, w *os.File, err error) {
+	if r, w, err = os.Pipe(); err != nil {
+		return nil, nil, err
+	}
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Env = append(cmd.Env, "LIFECYCLED_CONTROL_FD=3")
+	return r, w, nil
+}
+
+// checkExecutable returns an error if the handler can't be executed.
+func checkExecutable(info os.FileInfo) error {
+	if info.Mode()&0111 == 0 {
+		return fmt.Errorf("%s is not executable (mode %s)", info.Name(), info.Mode())
+	}
+	return nil
+}
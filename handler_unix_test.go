@@ -0,0 +1,386 @@
+//go:build !windows
+// +build !windows
+
+package lifecycled_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func newHandlerScript(t *testing.T, dir, script string, mode os.FileMode) *os.File {
+	path := filepath.Join(dir, "handler.sh")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), mode); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFileHandlerValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := newHandlerScript(t, dir, "exit 0\n", 0644)
+	defer f.Close()
+
+	if err := lifecycled.NewFileHandler(f).Validate(); err == nil {
+		t.Error("expected an error for a handler that is not executable")
+	}
+	if err := os.Chmod(f.Name(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := lifecycled.NewFileHandler(f).Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestFileHandlerGracePeriod(t *testing.T) {
+	tests := []struct {
+		description string
+		script      string
+		maxDuration time.Duration
+	}{
+		{
+			description: "handler exits on SIGTERM",
+			script:      "trap 'exit 0' TERM\nwhile true; do sleep 0.1; done\n",
+			maxDuration: 2 * time.Second,
+		},
+		{
+			description: "handler is killed after the grace period",
+			script:      "trap '' TERM\nwhile true; do sleep 0.1; done\n",
+			maxDuration: 3 * time.Second,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "lifecycled")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			f := newHandlerScript(t, dir, tc.script, 0755)
+			defer f.Close()
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 200*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			done := make(chan error, 1)
+			go func() {
+				done <- lifecycled.NewFileHandlerWithGracePeriod(f, time.Second).Execute(ctx)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(tc.maxDuration):
+				t.Fatalf("expected handler to exit within %s", tc.maxDuration)
+			}
+			if time.Since(start) < 200*time.Millisecond {
+				t.Error("expected handler to run until the context was cancelled")
+			}
+		})
+	}
+}
+
+func TestFileHandlerCompleteEarly(t *testing.T) {
+	tests := []struct {
+		description string
+		script      string
+		completions int32
+	}{
+		{
+			description: "handler completes before it exits",
+			script:      "echo " + lifecycled.CompleteSentinel + " >&$LIFECYCLED_CONTROL_FD\nsleep 0.2\n",
+			completions: 1,
+		},
+		{
+			description: "handler completes as it exits",
+			script:      "echo " + lifecycled.CompleteSentinel + " >&3\n",
+			completions: 1,
+		},
+		{
+			description: "children of the handler keep the pipe open",
+			script:      "echo " + lifecycled.CompleteSentinel + " >&3\nsleep 5 &\n",
+			completions: 1,
+		},
+		{
+			description: "handler does not complete",
+			script:      "echo done >&3\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "lifecycled")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			f := newHandlerScript(t, dir, tc.script, 0755)
+			defer f.Close()
+
+			var completions int32
+			start := time.Now()
+			err = lifecycled.NewFileHandlerWithGracePeriod(f, time.Second).HandleNotice(context.TODO(), &lifecycled.Notice{
+				Complete: func() { atomic.AddInt32(&completions, 1) },
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got, want := atomic.LoadInt32(&completions), tc.completions; got != want {
+				t.Errorf("expected %d completions and got %d", want, got)
+			}
+			if time.Since(start) > 2*time.Second {
+				t.Error("expected the handler to return without waiting for its children")
+			}
+		})
+	}
+}
+
+func TestFileHandlerOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := newHandlerScript(t, dir, "echo out\necho err >&2\n", 0755)
+	defer f.Close()
+
+	var output bytes.Buffer
+	handler := lifecycled.NewFileHandlerWithGracePeriod(f, time.Second)
+	handler.SetOutput(&output)
+	if err := handler.Execute(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := output.String(), "out\nerr\n"; got != want {
+		t.Errorf("expected the output to be %q and got %q", want, got)
+	}
+}
+
+func TestFileHandlerArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := newHandlerScript(t, dir, "for arg in \"$@\"; do echo \"$arg\"; done\n", 0755)
+	defer f.Close()
+
+	var output bytes.Buffer
+	handler := lifecycled.NewFileHandlerWithGracePeriod(f, time.Second)
+	handler.SetOutput(&output)
+	handler.SetArgs([]string{"--fast", "--region", "us-east-1", "two words"})
+	if err := handler.Execute(context.TODO(), "autoscaling:EC2_INSTANCE_TERMINATING", "i-000000000000"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The arguments of the handler are passed verbatim, before those of the notice
+	expected := "--fast\n--region\nus-east-1\ntwo words\nautoscaling:EC2_INSTANCE_TERMINATING\ni-000000000000\n"
+	if got := output.String(); got != expected {
+		t.Errorf("expected the arguments %q and got %q", expected, got)
+	}
+}
+
+func TestFileHandlerTraceParent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := newHandlerScript(t, dir, "echo \"$TRACEPARENT\"\n", 0755)
+	defer f.Close()
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.TODO(), "handler")
+	defer span.End()
+
+	var output bytes.Buffer
+	handler := lifecycled.NewFileHandlerWithGracePeriod(f, time.Second)
+	handler.SetOutput(&output)
+	if err := handler.Execute(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sc := span.SpanContext()
+	if got, want := strings.TrimSpace(output.String()), "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01"; got != want {
+		t.Errorf("expected TRACEPARENT to be '%s' and got '%s'", want, got)
+	}
+}
+
+func TestDiagnosticsHandlerProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := newHandlerScript(t, dir, "sleep 1\n", 0755)
+	defer f.Close()
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+
+	done := make(chan error)
+	go func() {
+		done <- daemon.Handle(context.TODO(), fakeNotice{}, lifecycled.NewFileHandlerWithGracePeriod(f, time.Second))
+	}()
+
+	var diag *lifecycled.Diagnostics
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		diag = daemon.Diagnostics()
+		if len(diag.Notices) > 0 && diag.Notices[0].HandlerPID != 0 {
+			break
+		}
+	}
+	if len(diag.Notices) != 1 || diag.Notices[0].HandlerPID == 0 {
+		t.Fatalf("expected the handler process of the notice and got %+v", diag.Notices)
+	}
+	if got, want := diag.Notices[0].Notice, "fake"; got != want {
+		t.Errorf("expected notice '%s' and got '%s'", want, got)
+	}
+	if !strings.Contains(diag.Goroutines, "goroutine ") {
+		t.Errorf("expected goroutine stacks and got: %s", diag.Goroutines)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if notices := daemon.Diagnostics().Notices; len(notices) != 0 {
+		t.Errorf("expected no notices once handled and got %+v", notices)
+	}
+}
+
+func TestFileHandlerInstanceTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := newHandlerScript(t, dir, "echo \"$LIFECYCLED_TAG_SERVICE $LIFECYCLED_TAG_COST_CENTRE\"\n", 0755)
+	defer f.Close()
+
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+	daemon.SetInstanceTags(map[string]string{"Service": "api", "cost-centre": "1234"})
+
+	var output bytes.Buffer
+	handler := lifecycled.NewFileHandlerWithGracePeriod(f, time.Second)
+	handler.SetOutput(&output)
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, handler); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := strings.TrimSpace(output.String()), "api 1234"; got != want {
+		t.Errorf("expected the tags in the handler environment to be '%s' and got '%s'", want, got)
+	}
+	for _, e := range hook.AllEntries() {
+		if e.Data["tag.Service"] != "api" {
+			t.Errorf("expected the tag as a field of '%s' and got %v", e.Message, e.Data)
+		}
+	}
+}
+
+// recordingPublisher records the completion events that it is given.
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []*lifecycled.CompletionEvent
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event *lifecycled.CompletionEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestRunIDAcrossSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := newHandlerScript(t, dir, "echo \"$LIFECYCLED_RUN_ID\"\n", 0755)
+	defer f.Close()
+
+	server, bodies := notificationServer(t, http.StatusOK)
+	defer server.Close()
+
+	path := filepath.Join(dir, "audit.log")
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000", AuditFile: path}, nil, nil, nil, nil, logger)
+	daemon.SetNotifier(lifecycled.NewWebhookNotifier(server.URL, lifecycled.NotifyFormatJSON, server.Client()), time.Second)
+	publisher := &recordingPublisher{}
+	daemon.SetPublisher(publisher)
+
+	handler := lifecycled.NewFileHandlerWithGracePeriod(f, time.Second)
+	handler.SetOutput(lifecycled.NewLogWriter(logger.WithField("output", "handler")))
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, handler); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	entries := hook.AllEntries()
+	runID, _ := entries[0].Data["runId"].(string)
+	if runID == "" {
+		t.Fatalf("expected a run id on '%s'", entries[0].Message)
+	}
+	var output bool
+	for _, e := range entries {
+		if e.Data["runId"] != runID {
+			t.Errorf("expected run id %s on '%s' and got %v", runID, e.Message, e.Data["runId"])
+		}
+		if e.Data["output"] == "handler" {
+			output = true
+			if e.Message != runID {
+				t.Errorf("expected the handler to be given run id %s and got '%s'", runID, e.Message)
+			}
+		}
+	}
+	if !output {
+		t.Error("expected the output of the handler to be logged")
+	}
+
+	records := readAuditRecords(t, path)
+	if len(records) != 1 || records[0].RunID != runID {
+		t.Errorf("expected an audit record with run id %s and got %+v", runID, records)
+	}
+	for _, body := range bodies() {
+		var n lifecycled.Notification
+		if err := json.Unmarshal(body, &n); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n.RunID != runID {
+			t.Errorf("expected the %s notification to have run id %s and got '%s'", n.Event, runID, n.RunID)
+		}
+	}
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+	if len(publisher.events) != 1 || publisher.events[0].RunID != runID {
+		t.Errorf("expected a completion event with run id %s", runID)
+	}
+}
@@ -0,0 +1,66 @@
+//go:build windows
+// +build windows
+
+package lifecycled
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// prepareCommand runs the handler in a new process group so that it
+// can be sent CTRL_BREAK without affecting the daemon.
+func prepareCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: windows.CREATE_NEW_PROCESS_GROUP}
+}
+
+// interruptProcess sends CTRL_BREAK to the handler process group.
+func interruptProcess(cmd *exec.Cmd) error {
+	return windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(cmd.Process.Pid))
+}
+
+// attachControl does nothing, since extra file descriptors can't be passed to the
+// handler on Windows, so handlers can't complete the lifecycle action early.
+func attachControl(cmd *exec.Cmd) (r, w *os.File, err error) {
+	return nil, nil, nil
+}
+
+// killProcess terminates the handler and its process tree.
+func killProcess(cmd *exec.Cmd) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// checkExecutable returns an error if the handler does not have an executable extension (see PATHEXT).
+func checkExecutable(info os.FileInfo) error {
+	ext := strings.ToLower(filepath.Ext(info.Name()))
+	for _, e := range executableExtensions() {
+		if ext == e {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s does not have an executable extension (%s)", info.Name(), strings.Join(executableExtensions(), ", "))
+}
+
+func executableExtensions() []string {
+	pathext := os.Getenv("PATHEXT")
+	if pathext == "" {
+		pathext = ".com;.exe;.bat;.cmd"
+	}
+	var exts []string
+	for _, e := range strings.Split(strings.ToLower(pathext), ";") {
+		if e != "" {
+			exts = append(exts, e)
+		}
+	}
+	return exts
+}
@@ -0,0 +1,53 @@
+//go:build windows
+// +build windows
+
+package lifecycled_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/triarius/lifecycled"
+)
+
+func TestFileHandlerValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name        string
+		expectError bool
+	}{
+		{name: "handler.bat"},
+		{name: "handler.EXE"},
+		{name: "handler.ps1", expectError: true},
+		{name: "handler.sh", expectError: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name)
+			if err := ioutil.WriteFile(path, []byte("exit 0\r\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			err = lifecycled.NewFileHandler(f).Validate()
+			if tc.expectError && err == nil {
+				t.Error("expected an error for a handler without an executable extension")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package lifecycled
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HealthServer exposes the health and status of a Daemon over HTTP.
+type HealthServer struct {
+	daemon    *Daemon
+	threshold time.Duration
+	mux       *http.ServeMux
+	server    *http.Server
+	startup   *StartupInfo
+}
+
+// NewHealthServer returns a HealthServer for the daemon which listens on addr. The
+// daemon is reported as unhealthy if a listener has not polled successfully within the threshold.
+func NewHealthServer(addr string, daemon *Daemon, threshold time.Duration) *HealthServer {
+	s := &HealthServer{
+		daemon:    daemon,
+		threshold: threshold,
+		mux:       http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/healthz", s.healthz)
+	s.mux.HandleFunc("/status", s.status)
+	s.mux.HandleFunc("/config", s.config)
+	s.server = &http.Server{
+		Addr:         addr,
+		Handler:      s.mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// SetStartup serves the start-up information on /config, e.g. for comparing the configuration of
+// the daemon with a new one. It must be called before Start.
+func (s *HealthServer) SetStartup(info StartupInfo) {
+	s.startup = &info
+}
+
+// Handle registers an additional handler for the given pattern.
+func (s *HealthServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start listening for requests. The server runs in the background until Stop is called.
+func (s *HealthServer) Start(log *logrus.Entry) error {
+	ln, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	log.WithField("address", ln.Addr().String()).Info("Starting health server")
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("Health server failed")
+		}
+	}()
+	return nil
+}
+
+// Stop the server, waiting for active requests until the context is done.
+func (s *HealthServer) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *HealthServer) healthz(w http.ResponseWriter, _ *http.Request) {
+	if err := s.daemon.Healthy(s.threshold); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *HealthServer) status(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.daemon.Status()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *HealthServer) config(w http.ResponseWriter, r *http.Request) {
+	if s.startup == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.startup); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
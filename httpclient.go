@@ -0,0 +1,70 @@
+package lifecycled
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// newHTTPClient returns the HTTP client of the AWS clients, which bounds connecting, the TLS
+// handshake and each attempt of a call with the timeouts of the config (see AWSCallTimeout),
+// and sends the requests through the proxy of the environment (e.g. HTTPS_PROXY).
+// The default client of the AWS SDK has no overall timeout, so that a connection that is
+// blackholed would stall a heartbeat or the completion of a lifecycle action indefinitely.
+func newHTTPClient(c *Config) aws.HTTPClient {
+	client := awshttp.NewBuildableClient().
+		WithDialerOptions(func(d *net.Dialer) {
+			d.Timeout = c.AWSConnectTimeout
+		}).
+		WithTransportOptions(func(t *http.Transport) {
+			t.TLSHandshakeTimeout = c.AWSConnectTimeout
+			t.Proxy = proxyFromEnvironment()
+			// The response of a long-poll is only sent once it's done
+			t.ResponseHeaderTimeout = c.operationTimeout("ReceiveMessage")
+		})
+	return &timeoutClient{client: client, config: c}
+}
+
+// operationTimeout returns the timeout of an attempt of the AWS API call, or zero if it has none.
+func (c *Config) operationTimeout(operation string) time.Duration {
+	return callTimeouts{call: c.AWSCallTimeout, heartbeat: c.AWSHeartbeatTimeout}.attempt(operation)
+}
+
+// timeoutClient times out each request by its operation, which is in the context of the request.
+type timeoutClient struct {
+	client aws.HTTPClient
+	config *Config
+}
+
+func (c *timeoutClient) Do(req *http.Request) (*http.Response, error) {
+	timeout := c.config.operationTimeout(awsmiddleware.GetOperationName(req.Context()))
+	if timeout <= 0 {
+		return c.client.Do(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The body is read once the request returns, so the timeout ends when it is closed
+	resp.Body = &cancelCloser{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelCloser cancels the context of a request when its body is closed.
+type cancelCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,109 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/triarius/lifecycled"
+)
+
+func TestAWSCallTimeouts(t *testing.T) {
+	// The server hangs for the delay of the operation, or until the test is done
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-done:
+			return
+		}
+		action := r.Form.Get("Action")
+		fmt.Fprintf(w, "<%sResponse><%sResult></%sResult></%sResponse>", action, action, action, action)
+	}))
+	defer server.Close()
+	defer close(done)
+
+	config := lifecycled.DefaultConfig()
+	config.Endpoints = map[string]string{"autoscaling": server.URL, "sqs": server.URL}
+	config.AWSCallTimeout = 100 * time.Millisecond
+	config.AWSHeartbeatTimeout = 50 * time.Millisecond
+
+	cfg, err := lifecycled.NewAWSConfig(context.TODO(), config, "us-east-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cfg.Credentials = aws.AnonymousCredentials{}
+	cfg.Retryer = func() aws.Retryer { return aws.NopRetryer{} }
+
+	tests := []struct {
+		description string
+		call        func(ctx context.Context) error
+		expectError bool
+	}{
+		{
+			description: "heartbeat",
+			call: func(ctx context.Context) error {
+				_, err := autoscaling.NewFromConfig(cfg).RecordLifecycleActionHeartbeat(ctx, &autoscaling.RecordLifecycleActionHeartbeatInput{
+					AutoScalingGroupName: aws.String("group"),
+					LifecycleHookName:    aws.String("hook"),
+				})
+				return err
+			},
+			expectError: true,
+		},
+		{
+			description: "call",
+			call: func(ctx context.Context) error {
+				_, err := sqs.NewFromConfig(cfg).DeleteMessage(ctx, &sqs.DeleteMessageInput{
+					QueueUrl:      aws.String(server.URL),
+					ReceiptHandle: aws.String("handle"),
+				})
+				return err
+			},
+			expectError: true,
+		},
+		{
+			description: "long-poll is allowed its wait time",
+			call: func(ctx context.Context) error {
+				_, err := sqs.NewFromConfig(cfg).ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+					QueueUrl:        aws.String(server.URL),
+					WaitTimeSeconds: 20,
+				})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			start := time.Now()
+			err := tc.call(context.TODO())
+			if !tc.expectError {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected the call to time out and got: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 180*time.Millisecond {
+				t.Errorf("expected the call to time out before the response and got %s", elapsed)
+			}
+			if strings.Contains(err.Error(), "canceled") {
+				t.Errorf("expected a timeout rather than a cancellation and got: %v", err)
+			}
+		})
+	}
+}
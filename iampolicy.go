@@ -0,0 +1,146 @@
+package lifecycled
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// PolicyDocument is an IAM policy document.
+type PolicyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// PolicyStatement is a statement of an IAM policy document.
+type PolicyStatement struct {
+	Sid       string                       `json:"Sid"`
+	Effect    string                       `json:"Effect"`
+	Action    []string                     `json:"Action"`
+	Resource  []string                     `json:"Resource"`
+	Condition map[string]map[string]string `json:"Condition,omitempty"`
+}
+
+// IAMPolicy returns the minimal IAM policy for the daemon with the configuration, with a
+// statement for each feature that makes AWS API calls. Resources are scoped where the API
+// supports it, with the partition, region and account of the SNS topic (or wildcards without
+// one, in the partition of the region if it is set). The spot listener and the handlers only use the instance metadata, which needs no
+// permissions. It must be kept in sync with the calls that the features make.
+func IAMPolicy(c *Config) PolicyDocument {
+	partition, region, account := regionPartition(c.Region), "*", "*"
+	if a, err := arn.Parse(c.SNSTopic); err == nil {
+		partition, region, account = a.Partition, a.Region, a.AccountID
+	}
+	resource := func(service, name string) string {
+		return fmt.Sprintf("arn:%s:%s:%s:%s:%s", partition, service, region, account, name)
+	}
+
+	policy := PolicyDocument{Version: "2012-10-17", Statement: []PolicyStatement{}}
+	allow := func(sid string, actions []string, resources ...string) *PolicyStatement {
+		policy.Statement = append(policy.Statement, PolicyStatement{Sid: sid, Effect: "Allow", Action: actions, Resource: resources})
+		return &policy.Statement[len(policy.Statement)-1]
+	}
+
+	if c.autoscalingListener() {
+		// The queue of each instance (see Queue) is named after it
+		queue := []string{
+			"sqs:CreateQueue",
+			"sqs:GetQueueAttributes",
+			"sqs:GetQueueUrl",
+			"sqs:SetQueueAttributes",
+			"sqs:ReceiveMessage",
+			"sqs:DeleteMessage",
+			"sqs:DeleteQueue",
+		}
+		if len(c.Tags) > 0 {
+			queue = append(queue, "sqs:TagQueue")
+		}
+		// The queues of the secondary topics are in their regions
+		queues := []string{resource("sqs", "lifecycled-*")}
+		for _, topic := range c.SecondarySNSTopics {
+			if a, err := arn.Parse(topic); err == nil {
+				queues = append(queues, fmt.Sprintf("arn:%s:sqs:%s:%s:lifecycled-*", a.Partition, a.Region, a.AccountID))
+			}
+		}
+		allow("Queue", queue, queues...)
+		subscription := []string{
+			"sns:Subscribe",
+			"sns:Unsubscribe",
+		}
+		if c.SelfCheck {
+			subscription = append(subscription, "sns:GetTopicAttributes")
+		}
+		if c.DeliveryCheck {
+			subscription = append(subscription, "sns:Publish")
+		}
+		allow("Subscription", subscription, append([]string{c.SNSTopic}, c.SecondarySNSTopics...)...)
+		allow("LifecycleActions", []string{
+			"autoscaling:CompleteLifecycleAction",
+			"autoscaling:RecordLifecycleActionHeartbeat",
+		}, resource("autoscaling", "autoScalingGroup:*:autoScalingGroupName/*"))
+
+		// The describe calls don't support resource-level permissions
+		describe := []string{}
+		if c.AutoscalingHeartbeatInterval == 0 || c.SelfCheck {
+			describe = append(describe, "autoscaling:DescribeLifecycleHooks")
+		}
+		if c.VerifyTermination || c.SelfCheck {
+			describe = append(describe, "autoscaling:DescribeAutoScalingInstances")
+		}
+		if len(describe) > 0 {
+			allow("DescribeAutoscaling", describe, "*")
+		}
+
+		// The key of an encrypted topic is checked by the self-check, and used to publish the
+		// marker of the delivery check
+		keys := []string{}
+		if c.SelfCheck {
+			keys = append(keys, "kms:DescribeKey", "kms:GetKeyPolicy")
+		}
+		if c.DeliveryCheck {
+			keys = append(keys, "kms:GenerateDataKey*", "kms:Decrypt")
+		}
+		if len(keys) > 0 {
+			resources := []string{resource("kms", "key/*")}
+			for _, topic := range c.SecondarySNSTopics {
+				if a, err := arn.Parse(topic); err == nil {
+					resources = append(resources, fmt.Sprintf("arn:%s:kms:%s:%s:key/*", a.Partition, a.Region, a.AccountID))
+				}
+			}
+			allow("TopicKey", keys, resources...)
+		}
+	}
+
+	if c.CompletionTopic != "" {
+		allow("CompletionEvents", []string{"sns:Publish"}, c.CompletionTopic)
+	}
+
+	// The group of the instance is looked up from its tags for the metrics of spot notices
+	metrics := c.CloudwatchMetricsNamespace != "" || c.StatsdAddress != "" || c.MetricsAddress != ""
+	if len(c.InstanceTags) > 0 || (c.SpotListener && metrics) {
+		allow("InstanceTags", []string{"ec2:DescribeTags"}, "*")
+	}
+
+	if c.CloudwatchMetricsNamespace != "" {
+		s := allow("Metrics", []string{"cloudwatch:PutMetricData"}, "*")
+		s.Condition = map[string]map[string]string{
+			"StringEquals": {"cloudwatch:namespace": c.CloudwatchMetricsNamespace},
+		}
+	}
+
+	if c.CloudwatchGroup != "" {
+		group := resource("logs", "log-group:"+c.CloudwatchGroup)
+		logs := []string{
+			"logs:CreateLogGroup",
+			"logs:CreateLogStream",
+			"logs:DescribeLogStreams",
+			"logs:PutLogEvents",
+		}
+		if len(c.Tags) > 0 {
+			// Creating a group with tags needs logs:TagResource, or logs:TagLogGroup before it
+			logs = append(logs, "logs:TagLogGroup", "logs:TagResource")
+		}
+		allow("Logs", logs, group, group+":log-stream:*")
+	}
+	return policy
+}
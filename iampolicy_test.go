@@ -0,0 +1,190 @@
+package lifecycled_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/triarius/lifecycled"
+)
+
+func TestIAMPolicy(t *testing.T) {
+	topic := "arn:aws:sns:us-east-1:123456789012:lifecycled"
+
+	tests := []struct {
+		description string
+		config      lifecycled.Config
+		expected    []string
+	}{
+		{
+			description: "spot listener",
+			config:      lifecycled.Config{SpotListener: true},
+			expected:    []string{},
+		},
+		{
+			description: "spot listener with metrics",
+			config:      lifecycled.Config{SpotListener: true, CloudwatchMetricsNamespace: "lifecycled"},
+			expected:    []string{"InstanceTags", "Metrics"},
+		},
+		{
+			description: "autoscaling listener",
+			config:      lifecycled.Config{SNSTopic: topic},
+			expected:    []string{"Queue", "Subscription", "LifecycleActions", "DescribeAutoscaling"},
+		},
+		{
+			description: "autoscaling listener with a heartbeat interval",
+			config:      lifecycled.Config{SNSTopic: topic, AutoscalingHeartbeatInterval: time.Minute},
+			expected:    []string{"Queue", "Subscription", "LifecycleActions"},
+		},
+		{
+			description: "autoscaling listener with the self-check and delivery check",
+			config:      lifecycled.Config{SNSTopic: topic, SelfCheck: true, DeliveryCheck: true},
+			expected:    []string{"Queue", "Subscription", "LifecycleActions", "DescribeAutoscaling", "TopicKey"},
+		},
+		{
+			description: "spot listener with the autoscaling listener disabled",
+			config:      lifecycled.Config{SpotListener: true, SNSTopic: topic, NoAutoscaling: true},
+			expected:    []string{},
+		},
+		{
+			description: "autoscaling listener with tags",
+			config:      lifecycled.Config{SNSTopic: topic, AutoscalingHeartbeatInterval: time.Minute, Tags: map[string]string{"Team": "platform"}},
+			expected:    []string{"Queue", "Subscription", "LifecycleActions"},
+		},
+		{
+			description: "every feature",
+			config: lifecycled.Config{
+				SNSTopic:                   topic,
+				VerifyTermination:          true,
+				CompletionTopic:            "arn:aws:sns:us-east-1:123456789012:completed",
+				InstanceTags:               []string{"Service"},
+				CloudwatchMetricsNamespace: "lifecycled",
+				CloudwatchGroup:            "lifecycled",
+			},
+			expected: []string{"Queue", "Subscription", "LifecycleActions", "DescribeAutoscaling", "CompletionEvents", "InstanceTags", "Metrics", "Logs"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			policy := lifecycled.IAMPolicy(&tc.config)
+
+			sids := []string{}
+			statements := make(map[string]lifecycled.PolicyStatement)
+			for _, s := range policy.Statement {
+				sids = append(sids, s.Sid)
+				statements[s.Sid] = s
+			}
+			if !reflect.DeepEqual(sids, tc.expected) {
+				t.Fatalf("expected statements %v and got %v", tc.expected, sids)
+			}
+
+			// Resources are scoped to the account and region of the topic
+			if s, ok := statements["Queue"]; ok {
+				if got, want := s.Resource[0], "arn:aws:sqs:us-east-1:123456789012:lifecycled-*"; got != want {
+					t.Errorf("expected queue resource %s and got %s", want, got)
+				}
+			}
+			if s, ok := statements["Queue"]; ok {
+				tagged := false
+				for _, action := range s.Action {
+					tagged = tagged || action == "sqs:TagQueue"
+				}
+				if want := len(tc.config.Tags) > 0; tagged != want {
+					t.Errorf("expected sqs:TagQueue to be allowed to be %v and got %v", want, tagged)
+				}
+			}
+			if s, ok := statements["Logs"]; ok {
+				if got, want := s.Resource[1], "arn:aws:logs:us-east-1:123456789012:log-group:lifecycled:log-stream:*"; got != want {
+					t.Errorf("expected log stream resource %s and got %s", want, got)
+				}
+			}
+			if s, ok := statements["Metrics"]; ok {
+				if got, want := s.Condition["StringEquals"]["cloudwatch:namespace"], "lifecycled"; got != want {
+					t.Errorf("expected metrics namespace condition %s and got %s", want, got)
+				}
+			}
+			if s, ok := statements["TopicKey"]; ok {
+				if got, want := s.Resource[0], "arn:aws:kms:us-east-1:123456789012:key/*"; got != want {
+					t.Errorf("expected key resource %s and got %s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestIAMPolicyPartitions(t *testing.T) {
+	tests := []struct {
+		description string
+		config      lifecycled.Config
+		queue       string
+		actions     string
+		logs        string
+	}{
+		{
+			description: "govcloud topic",
+			config:      lifecycled.Config{SNSTopic: "arn:aws-us-gov:sns:us-gov-west-1:123456789012:lifecycled", CloudwatchGroup: "lifecycled"},
+			queue:       "arn:aws-us-gov:sqs:us-gov-west-1:123456789012:lifecycled-*",
+			actions:     "arn:aws-us-gov:autoscaling:us-gov-west-1:123456789012:autoScalingGroup:*:autoScalingGroupName/*",
+			logs:        "arn:aws-us-gov:logs:us-gov-west-1:123456789012:log-group:lifecycled",
+		},
+		{
+			description: "china topic",
+			config:      lifecycled.Config{SNSTopic: "arn:aws-cn:sns:cn-north-1:123456789012:lifecycled", CloudwatchGroup: "lifecycled"},
+			queue:       "arn:aws-cn:sqs:cn-north-1:123456789012:lifecycled-*",
+			actions:     "arn:aws-cn:autoscaling:cn-north-1:123456789012:autoScalingGroup:*:autoScalingGroupName/*",
+			logs:        "arn:aws-cn:logs:cn-north-1:123456789012:log-group:lifecycled",
+		},
+		{
+			description: "govcloud region without a topic",
+			config:      lifecycled.Config{SpotListener: true, Region: "us-gov-east-1", CloudwatchGroup: "lifecycled"},
+			logs:        "arn:aws-us-gov:logs:*:*:log-group:lifecycled",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			statements := make(map[string]lifecycled.PolicyStatement)
+			for _, s := range lifecycled.IAMPolicy(&tc.config).Statement {
+				statements[s.Sid] = s
+			}
+			for sid, want := range map[string]string{"Queue": tc.queue, "LifecycleActions": tc.actions, "Logs": tc.logs} {
+				s, ok := statements[sid]
+				if want == "" {
+					if ok {
+						t.Errorf("unexpected statement %s", sid)
+					}
+					continue
+				}
+				if !ok {
+					t.Errorf("expected statement %s", sid)
+					continue
+				}
+				if got := s.Resource[0]; got != want {
+					t.Errorf("expected %s resource %s and got %s", sid, want, got)
+				}
+			}
+			if s, ok := statements["Subscription"]; ok && s.Resource[0] != tc.config.SNSTopic {
+				t.Errorf("expected subscription resource %s and got %s", tc.config.SNSTopic, s.Resource[0])
+			}
+		})
+	}
+}
+
+func TestIAMPolicySecondaryTopics(t *testing.T) {
+	policy := lifecycled.IAMPolicy(&lifecycled.Config{
+		SNSTopic:           "arn:aws:sns:us-east-1:123456789012:lifecycled",
+		SecondarySNSTopics: []string{"arn:aws:sns:us-west-2:123456789012:lifecycled"},
+	})
+	resources := make(map[string]string)
+	for _, s := range policy.Statement {
+		resources[s.Sid] = strings.Join(s.Resource, ",")
+	}
+	if got, want := resources["Queue"], "arn:aws:sqs:us-east-1:123456789012:lifecycled-*,arn:aws:sqs:us-west-2:123456789012:lifecycled-*"; got != want {
+		t.Errorf("expected queue resources %s and got %s", want, got)
+	}
+	if got, want := resources["Subscription"], "arn:aws:sns:us-east-1:123456789012:lifecycled,arn:aws:sns:us-west-2:123456789012:lifecycled"; got != want {
+		t.Errorf("expected subscription resources %s and got %s", want, got)
+	}
+}
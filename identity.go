@@ -0,0 +1,133 @@
+package lifecycled
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"go.mozilla.org/pkcs7"
+)
+
+// IdentityDocument is the instance identity document of the metadata service, which AWS signs,
+// so that the identity of the instance can be trusted when the metadata service can't (e.g. a
+// proxy in front of it is spoofed).
+type IdentityDocument struct {
+	InstanceID       string `json:"instanceId"`
+	AccountID        string `json:"accountId"`
+	Region           string `json:"region"`
+	AvailabilityZone string `json:"availabilityZone"`
+	InstanceType     string `json:"instanceType"`
+	ImageID          string `json:"imageId"`
+}
+
+// identityCertificateBundle are the certificates that AWS publishes for the RSA-2048 signatures
+// of the instance identity documents, in PEM, by partition. The certificates of a partition can
+// also be given with Config.IdentityCertificatesFile (see IdentityCertificates).
+var identityCertificateBundle = map[string]string{
+	"aws": awsIdentityCertificates,
+}
+
+// IdentityCertificates returns the certificates that verify the identity documents of the
+// instances in the region: those that are bundled for its partition (see
+// identityCertificateBundle), and those of the PEM file, if any.
+func IdentityCertificates(region, file string) ([]*x509.Certificate, error) {
+	partition := regionPartition(region)
+	certs, err := parseCertificates([]byte(identityCertificateBundle[partition]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundled certificates of %s: %v", partition, err)
+	}
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		extra, err := parseCertificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificates in %s: %v", file, err)
+		}
+		if len(extra) == 0 {
+			return nil, fmt.Errorf("no certificates in %s", file)
+		}
+		certs = append(certs, extra...)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates of %s to verify the instance identity document with", partition)
+	}
+	return certs, nil
+}
+
+// parseCertificates returns the certificates of the PEM blocks.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// VerifyInstanceIdentity fetches the RSA-2048 signature of the instance identity document from
+// the metadata service, verifies it with the certificates and returns the document that it
+// signs, which must be the document of the instance.
+func VerifyInstanceIdentity(ctx context.Context, metadata *imds.Client, instanceID string, certs []*x509.Certificate) (*IdentityDocument, error) {
+	if metadata == nil {
+		return nil, errors.New("ec2 metadata client is not configured")
+	}
+	out, err := metadata.GetDynamicData(ctx, &imds.GetDynamicDataInput{Path: "instance-identity/rsa2048"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the signature of the instance identity document: %w", err)
+	}
+	defer out.Content.Close()
+	signature, err := ioutil.ReadAll(out.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the signature of the instance identity document: %w", err)
+	}
+	doc, err := VerifyIdentityDocument(signature, certs)
+	if err != nil {
+		return nil, err
+	}
+	if doc.InstanceID != instanceID {
+		return nil, fmt.Errorf("the instance identity document is signed for %s rather than %s", doc.InstanceID, instanceID)
+	}
+	return doc, nil
+}
+
+// VerifyIdentityDocument verifies the PKCS7 signature of an instance identity document, in
+// base64 as the metadata service returns it, with the certificates and returns the document.
+func VerifyIdentityDocument(signature []byte, certs []*x509.Certificate) (*IdentityDocument, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(signature)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature of the instance identity document: %v", err)
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature of the instance identity document: %v", err)
+	}
+	// The signer must be one of the trusted certificates rather than those of the signature
+	p7.Certificates = certs
+	if err := p7.Verify(); err != nil {
+		return nil, fmt.Errorf("invalid signature of the instance identity document: %v", err)
+	}
+	var doc IdentityDocument
+	if err := json.Unmarshal(p7.Content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the instance identity document: %v", err)
+	}
+	return &doc, nil
+}
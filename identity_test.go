@@ -0,0 +1,330 @@
+package lifecycled_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/triarius/lifecycled"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+)
+
+type testContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      testContentInfo
+	SignerInfos      []testSignerInfo `asn1:"set"`
+}
+
+type testSignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     testIssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type testIssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type testAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value []asn1.RawValue `asn1:"set"`
+}
+
+// identitySigner signs instance identity documents like AWS, with a self-signed certificate.
+type identitySigner struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newIdentitySigner(t *testing.T, serial int64) *identitySigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{Organization: []string{"Amazon Web Services LLC"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &identitySigner{key: key, cert: cert}
+}
+
+// explicit wraps the encoding in an explicit [0] tag.
+func explicit(t *testing.T, v interface{}) asn1.RawValue {
+	inner, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner}
+}
+
+// sign returns the PKCS7 signature of the document, in base64 as the metadata service returns
+// it. The signature is of the authenticated attributes, which include the digest of signed.
+func (s *identitySigner) sign(t *testing.T, document, signed []byte) string {
+	digest := sha256.Sum256(signed)
+	contentType, _ := asn1.Marshal(oidData)
+	messageDigest, _ := asn1.Marshal(digest[:])
+	attributes, err := asn1.MarshalWithParams([]testAttribute{
+		{Type: oidContentType, Value: []asn1.RawValue{{FullBytes: contentType}}},
+		{Type: oidMessageDigest, Value: []asn1.RawValue{{FullBytes: messageDigest}}},
+	}, "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributesDigest := sha256.Sum256(attributes)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, attributesDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The attributes are implicitly tagged [0] in the signer info
+	implicit := append([]byte{0xa0}, attributes[1:]...)
+
+	sha := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	signedData := testSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha},
+		ContentInfo:      testContentInfo{ContentType: oidData, Content: explicit(t, document)},
+		SignerInfos: []testSignerInfo{{
+			Version:                   1,
+			IssuerAndSerialNumber:     testIssuerAndSerial{Issuer: asn1.RawValue{FullBytes: s.cert.RawIssuer}, SerialNumber: s.cert.SerialNumber},
+			DigestAlgorithm:           sha,
+			AuthenticatedAttributes:   asn1.RawValue{FullBytes: implicit},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSA, Parameters: asn1.NullRawValue},
+			EncryptedDigest:           signature,
+		}},
+	}
+	der, err := asn1.Marshal(testContentInfo{ContentType: oidSignedData, Content: explicit(t, signedData)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wrapBase64(der)
+}
+
+// wrapBase64 encodes the data in lines of 64 characters, like the signatures of the metadata
+// service.
+func wrapBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var lines []string
+	for len(encoded) > 64 {
+		lines = append(lines, encoded[:64])
+		encoded = encoded[64:]
+	}
+	return strings.Join(append(lines, encoded), "\n")
+}
+
+// indefinite re-encodes the outer sequence of a base64 signature with an indefinite length, as
+// the signatures of AWS are encoded.
+func indefinite(t *testing.T, signature string) string {
+	der, err := base64.StdEncoding.DecodeString(strings.Replace(signature, "\n", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outer asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &outer); err != nil {
+		t.Fatal(err)
+	}
+	ber := append([]byte{0x30, 0x80}, outer.Bytes...)
+	return wrapBase64(append(ber, 0, 0))
+}
+
+const identityDocument = `{"accountId":"123456789012","availabilityZone":"us-east-1a","imageId":"ami-0123456789abcdef0","instanceId":"i-000000000000","instanceType":"m5.large","region":"us-east-1"}`
+
+func TestVerifyIdentityDocument(t *testing.T) {
+	signer := newIdentitySigner(t, 1)
+	other := newIdentitySigner(t, 2)
+	document := []byte(identityDocument)
+	valid := signer.sign(t, document, document)
+
+	tests := []struct {
+		description string
+		signature   string
+		certs       []*x509.Certificate
+		expectError string
+	}{
+		{
+			description: "valid",
+			signature:   valid,
+			certs:       []*x509.Certificate{other.cert, signer.cert},
+		},
+		{
+			description: "indefinite lengths",
+			signature:   indefinite(t, valid),
+			certs:       []*x509.Certificate{signer.cert},
+		},
+		{
+			description: "untrusted certificate",
+			signature:   valid,
+			certs:       []*x509.Certificate{other.cert},
+			expectError: "No certificate for signer",
+		},
+		{
+			description: "signed with another key",
+			signature:   other.sign(t, document, document),
+			certs:       []*x509.Certificate{{RawIssuer: other.cert.RawIssuer, SerialNumber: other.cert.SerialNumber, PublicKeyAlgorithm: x509.RSA, PublicKey: signer.cert.PublicKey}},
+			expectError: "verification error",
+		},
+		{
+			description: "tampered document",
+			signature:   signer.sign(t, []byte(strings.Replace(identityDocument, "i-000000000000", "i-111111111111", 1)), document),
+			certs:       []*x509.Certificate{signer.cert},
+			expectError: "Message digest mismatch",
+		},
+		{
+			description: "not base64",
+			signature:   "not a signature",
+			certs:       []*x509.Certificate{signer.cert},
+			expectError: "invalid signature",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			doc, err := lifecycled.VerifyIdentityDocument([]byte(tc.signature), tc.certs)
+			if tc.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectError) {
+					t.Errorf("expected an error containing '%s' and got: %v", tc.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if doc.InstanceID != "i-000000000000" || doc.Region != "us-east-1" || doc.AccountID != "123456789012" {
+				t.Errorf("unexpected document: %+v", doc)
+			}
+		})
+	}
+}
+
+func TestVerifyInstanceIdentity(t *testing.T) {
+	signer := newIdentitySigner(t, 1)
+	signature := signer.sign(t, []byte(identityDocument), []byte(identityDocument))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI != "/latest/dynamic/instance-identity/rsa2048" {
+			http.Error(w, "404 - not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(signature))
+	}))
+	defer server.Close()
+	metadata := imds.New(imds.Options{Endpoint: server.URL})
+
+	certs := []*x509.Certificate{signer.cert}
+	doc, err := lifecycled.VerifyInstanceIdentity(context.TODO(), metadata, "i-000000000000", certs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := doc.AvailabilityZone, "us-east-1a"; got != want {
+		t.Errorf("expected availability zone %s and got %s", want, got)
+	}
+
+	// A metadata service that returns the id of another instance isn't trusted
+	if _, err := lifecycled.VerifyInstanceIdentity(context.TODO(), metadata, "i-111111111111", certs); err == nil || !strings.Contains(err.Error(), "signed for i-000000000000") {
+		t.Errorf("expected an error for the other instance and got: %v", err)
+	}
+}
+
+func TestIdentityCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	signer := newIdentitySigner(t, 1)
+	file := filepath.Join(dir, "certificates.pem")
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signer.cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bundled, err := lifecycled.IdentityCertificates("us-east-1", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(bundled) == 0 {
+		t.Fatal("expected the certificates of AWS to be bundled")
+	}
+	for _, cert := range bundled {
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok || key.N.BitLen() != 2048 {
+			t.Errorf("expected the bundled certificate %s to be an rsa-2048 certificate", cert.SerialNumber)
+		}
+		if len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != "Amazon Web Services LLC" || cert.NotAfter.Before(time.Now()) {
+			t.Errorf("expected the bundled certificate %s to be an unexpired certificate of AWS: %s until %s", cert.SerialNumber, cert.Subject, cert.NotAfter)
+		}
+	}
+	// A document isn't trusted because it is signed by a certificate with the subject of AWS
+	if _, err := lifecycled.VerifyIdentityDocument([]byte(signer.sign(t, []byte(identityDocument), []byte(identityDocument))), bundled); err == nil {
+		t.Error("expected the bundled certificates not to trust the certificate of the test")
+	}
+
+	certs, err := lifecycled.IdentityCertificates("us-east-1", file)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(certs) != len(bundled)+1 {
+		t.Errorf("expected the certificates of the file to be added to the %d that are bundled and got %d", len(bundled), len(certs))
+	}
+	if len(certs) == 0 || !certs[len(certs)-1].Equal(signer.cert) {
+		t.Errorf("expected the certificate of the file to be trusted and got %d certificates", len(certs))
+	}
+
+	// The certificates of the other partitions aren't bundled
+	if _, err := lifecycled.IdentityCertificates("us-gov-west-1", ""); err == nil {
+		t.Error("expected an error for a partition without certificates")
+	}
+	if certs, err := lifecycled.IdentityCertificates("cn-north-1", file); err != nil || len(certs) != 1 {
+		t.Errorf("expected only the certificate of the file for aws-cn and got %d: %v", len(certs), err)
+	}
+
+	empty := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(empty, []byte("no certificates"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lifecycled.IdentityCertificates("us-east-1", empty); err == nil {
+		t.Error("expected an error for a file without certificates")
+	}
+}
@@ -0,0 +1,89 @@
+package lifecycled
+
+import (
+	"context"
+	"time"
+)
+
+// The poll modes of a listener that polls adaptively (see AutoscalingOptions.PollMaxIdleGap).
+const (
+	PollModeFast = "fast"
+	PollModeIdle = "idle"
+)
+
+// minIdleGap is the first gap between the polls of the queue once it is idle, which is doubled
+// on each poll that receives no messages.
+const minIdleGap = 5 * time.Second
+
+// idlePoller stretches the gaps between the polls of the queue while no messages arrive, so that
+// a daemon that waits for months doesn't long-poll continuously. It polls at full speed for the
+// idle period after it starts and after any message, and again as soon as it is woken.
+type idlePoller struct {
+	idleAfter time.Duration
+	maxGap    time.Duration
+	wake      <-chan struct{}
+
+	lastActive time.Time
+	gap        time.Duration
+}
+
+func newIdlePoller(idleAfter, maxGap time.Duration, wake <-chan struct{}) *idlePoller {
+	return &idlePoller{idleAfter: idleAfter, maxGap: maxGap, wake: wake, lastActive: time.Now()}
+}
+
+// next returns the gap before the next poll, given whether the last poll received messages,
+// which is zero unless the queue has been idle for the idle period.
+func (p *idlePoller) next(now time.Time, received bool) time.Duration {
+	if received {
+		p.activate(now)
+	}
+	if now.Sub(p.lastActive) < p.idleAfter {
+		return 0
+	}
+	if p.gap == 0 {
+		p.gap = minIdleGap
+	} else {
+		p.gap *= 2
+	}
+	if p.gap > p.maxGap {
+		p.gap = p.maxGap
+	}
+	return p.gap
+}
+
+// activate polls at full speed for the idle period from now.
+func (p *idlePoller) activate(now time.Time) {
+	p.lastActive = now
+	p.gap = 0
+}
+
+// wait for the gap before the next poll, and returns false if the context is done first. If it
+// is woken it polls at full speed again.
+func (p *idlePoller) wait(ctx context.Context, gap time.Duration) bool {
+	timer := time.NewTimer(gap)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-p.wake:
+		p.activate(time.Now())
+	case <-ctx.Done():
+		return false
+	}
+	return true
+}
+
+// waker is implemented by listeners that can be woken to poll at full speed, e.g. once another
+// listener has received a notice.
+type waker interface {
+	wake()
+}
+
+// wakeListeners wakes the listeners that poll adaptively, since a notice (e.g. a spot interruption)
+// means that an autoscaling notice is likely to follow.
+func (d *Daemon) wakeListeners() {
+	for _, l := range d.listeners {
+		if w, ok := l.(waker); ok {
+			w.wake()
+		}
+	}
+}
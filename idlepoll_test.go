@@ -0,0 +1,113 @@
+package lifecycled_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// checkpointNotice is a notice that doesn't terminate the instance.
+type checkpointNotice struct{}
+
+func (checkpointNotice) Type() string      { return "checkpoint" }
+func (checkpointNotice) Terminating() bool { return false }
+
+func (checkpointNotice) Handle(context.Context, lifecycled.Handler, *logrus.Entry) error {
+	return nil
+}
+
+// signalListener sends a checkpoint notice once the signal is closed.
+type signalListener struct {
+	signal <-chan struct{}
+}
+
+func (signalListener) Type() string { return "signal" }
+
+func (l signalListener) Start(ctx context.Context, notices chan<- lifecycled.TerminationNotice, _ *logrus.Entry) error {
+	select {
+	case <-l.signal:
+		notices <- checkpointNotice{}
+	case <-ctx.Done():
+		return nil
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func TestAdaptivePolling(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sq := mocks.NewMockSQSClient(ctrl)
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(&sqs.ReceiveMessageOutput{}, nil)
+	sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	sn := mocks.NewMockSNSClient(ctrl)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+	sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	logger, _ := logrustest.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:     "i-000000000000",
+		SNSTopic:       "topic",
+		PollIdleAfter:  200 * time.Millisecond,
+		PollMaxIdleGap: time.Minute,
+	}, sq, sn, mocks.NewMockAutoscalingClient(ctrl), nil, logger)
+
+	signal := make(chan struct{})
+	daemon.AddListener(signalListener{signal: signal})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- daemon.Run(ctx, lifecycled.ChainHandler{})
+	}()
+
+	waitForPollMode := func(mode string) lifecycled.ListenerStatus {
+		for {
+			for _, l := range daemon.Status().Listeners {
+				if l.Type == "autoscaling" && l.PollMode == mode {
+					return l
+				}
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("timed out waiting for poll mode %q", mode)
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}
+
+	// The queue is idle once nothing has been received for the idle period
+	if l := waitForPollMode(lifecycled.PollModeIdle); !l.NextPoll.After(time.Now()) {
+		t.Errorf("expected the next poll to be in the future and got %s", l.NextPoll)
+	}
+
+	// A notice from another listener snaps it back to polling at full speed
+	close(signal)
+	waitForPollMode(lifecycled.PollModeFast)
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
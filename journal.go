@@ -0,0 +1,229 @@
+package lifecycled
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sockets that a JournalHook writes to by default.
+const (
+	JournalSocket = "/run/systemd/journal/socket"
+	SyslogSocket  = "/dev/log"
+)
+
+// syslogFacility is the daemon facility, which the priority of syslog messages is relative to.
+const syslogFacility = 3
+
+// maxJournalFieldName is the longest field name that journald accepts.
+const maxJournalFieldName = 64
+
+// NewJournalHook returns a logrus hook which writes log entries to the journald socket with the
+// native protocol, so that the fields of the entries are journal fields (e.g. instanceId is
+// INSTANCE_ID). If journald isn't running, it writes to the syslog socket instead with the
+// fields appended to the message. The sockets default to JournalSocket and SyslogSocket.
+func NewJournalHook(identifier, journalSocket, syslogSocket string) (*JournalHook, error) {
+	if journalSocket == "" {
+		journalSocket = JournalSocket
+	}
+	if syslogSocket == "" {
+		syslogSocket = SyslogSocket
+	}
+	h := &JournalHook{identifier: identifier}
+	var err error
+	if h.conn, err = dialUnixgram(journalSocket); err == nil {
+		h.socket, h.native = journalSocket, true
+		return h, nil
+	}
+	if h.conn, err = dialUnixgram(syslogSocket); err != nil {
+		return nil, fmt.Errorf("neither journald (%s) nor syslog (%s) is available: %w", journalSocket, syslogSocket, err)
+	}
+	h.socket = syslogSocket
+	return h, nil
+}
+
+// JournalHook is a logrus hook which writes log entries to journald or syslog.
+type JournalHook struct {
+	identifier string
+	socket     string
+	native     bool
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func dialUnixgram(path string) (net.Conn, error) {
+	return net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+}
+
+// Native returns true if the hook writes to journald, and false if it writes to syslog.
+func (h *JournalHook) Native() bool {
+	return h.native
+}
+
+// Socket returns the path of the socket that the hook writes to.
+func (h *JournalHook) Socket() string {
+	return h.socket
+}
+
+// Levels returns all levels, since the level of the logger decides what is logged.
+func (h *JournalHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire writes the entry with the priority of its level.
+func (h *JournalHook) Fire(entry *logrus.Entry) error {
+	return h.send(entry.Time, journalPriority(entry.Level), entry.Message, entry.Data)
+}
+
+// Write sends each line of the data as an entry, e.g. for the output of handlers. Lines are
+// not buffered across writes, so that writers that share the hook can't interleave them.
+func (h *JournalHook) Write(p []byte) (int, error) {
+	now := time.Now()
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		if s := strings.TrimRight(string(line), "\r"); s != "" {
+			if err := h.send(now, journalPriority(logrus.InfoLevel), s, logrus.Fields{"output": "handler"}); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// Close the socket.
+func (h *JournalHook) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conn.Close()
+}
+
+// send the entry, reconnecting once if the daemon has restarted since the last entry.
+func (h *JournalHook) send(t time.Time, priority int, message string, fields logrus.Fields) error {
+	var msg []byte
+	if h.native {
+		msg = formatJournal(h.identifier, priority, message, fields)
+	} else {
+		msg = formatSyslog(t, h.identifier, os.Getpid(), priority, message, fields)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.conn.Write(msg); err == nil {
+		return nil
+	}
+	conn, err := dialUnixgram(h.socket)
+	if err != nil {
+		return err
+	}
+	h.conn.Close()
+	h.conn = conn
+	_, err = h.conn.Write(msg)
+	return err
+}
+
+// journalPriority returns the syslog priority of the level.
+func journalPriority(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0 // emerg
+	case logrus.FatalLevel:
+		return 2 // crit
+	case logrus.ErrorLevel:
+		return 3 // err
+	case logrus.WarnLevel:
+		return 4 // warning
+	case logrus.InfoLevel:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// formatJournal returns the entry in the native journal protocol, where each field is a
+// NAME=value line, or the name, the length and the value for values with newlines.
+func formatJournal(identifier string, priority int, message string, fields logrus.Fields) []byte {
+	var buf bytes.Buffer
+	writeField := func(name, value string) {
+		if !strings.Contains(value, "\n") {
+			fmt.Fprintf(&buf, "%s=%s\n", name, value)
+			return
+		}
+		buf.WriteString(name + "\n")
+		binary.Write(&buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value + "\n")
+	}
+	writeField("MESSAGE", message)
+	writeField("PRIORITY", fmt.Sprint(priority))
+	writeField("SYSLOG_IDENTIFIER", identifier)
+	for _, k := range sortedKeys(fields) {
+		if name := journalFieldName(k); name != "" {
+			writeField(name, fmt.Sprint(fields[k]))
+		}
+	}
+	return buf.Bytes()
+}
+
+// journalFieldName returns the journal field for a log field, which is upper case with
+// underscores between words (e.g. instanceId is INSTANCE_ID), or empty if it would be one
+// of the fields that are set by lifecycled or journald itself.
+func journalFieldName(field string) string {
+	var b strings.Builder
+	lower := false
+	for _, r := range field {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if lower {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		case r >= 'a' && r <= 'z':
+			b.WriteRune(r - 'a' + 'A')
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+		lower = r >= 'a' && r <= 'z' || r >= '0' && r <= '9'
+	}
+	name := strings.Trim(b.String(), "_")
+	if len(name) > maxJournalFieldName {
+		name = name[:maxJournalFieldName]
+	}
+	// Names must not start with a digit, and MESSAGE and the others are set from the entry
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return ""
+	}
+	switch name {
+	case "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER":
+		return ""
+	}
+	return name
+}
+
+// formatSyslog returns the entry as a syslog message for the local socket, with the
+// fields appended to the message as key=value pairs.
+func formatSyslog(t time.Time, identifier string, pid, priority int, message string, fields logrus.Fields) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>%s %s[%d]: %s", syslogFacility*8+priority, t.Format(time.Stamp), identifier, pid, message)
+	for _, k := range sortedKeys(fields) {
+		fmt.Fprintf(&buf, " %s=%q", k, fmt.Sprint(fields[k]))
+	}
+	return buf.Bytes()
+}
+
+func sortedKeys(fields logrus.Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
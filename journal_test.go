@@ -0,0 +1,157 @@
+//go:build !windows
+// +build !windows
+
+package lifecycled_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/triarius/lifecycled"
+)
+
+// listenUnixgram returns a fake journald or syslog socket in the directory.
+func listenUnixgram(t *testing.T, dir, name string) (*net.UnixConn, string) {
+	path := filepath.Join(dir, name)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, path
+}
+
+// readDatagram returns the next datagram written to the socket.
+func readDatagram(t *testing.T, conn *net.UnixConn) []byte {
+	buf := make([]byte, 64<<10)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("expected an entry to be written to the socket: %s", err)
+	}
+	return buf[:n]
+}
+
+// parseJournalFields parses an entry in the native journal protocol.
+func parseJournalFields(t *testing.T, msg []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(msg) > 0 {
+		i := bytes.IndexAny(msg, "=\n")
+		if i < 0 {
+			t.Fatalf("unterminated journal field %q", msg)
+		}
+		name := string(msg[:i])
+		if msg[i] == '=' {
+			end := bytes.IndexByte(msg, '\n')
+			fields[name] = string(msg[i+1 : end])
+			msg = msg[end+1:]
+			continue
+		}
+		size := binary.LittleEndian.Uint64(msg[i+1 : i+9])
+		fields[name] = string(msg[i+9 : i+9+int(size)])
+		msg = msg[i+9+int(size)+1:]
+	}
+	return fields
+}
+
+func TestJournalHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	journal, path := listenUnixgram(t, dir, "journal.sock")
+	defer journal.Close()
+
+	hook, err := lifecycled.NewJournalHook("lifecycled", path, filepath.Join(dir, "missing.sock"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer hook.Close()
+	if !hook.Native() {
+		t.Fatal("expected the hook to write to journald")
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	logger.AddHook(hook)
+	logger.WithFields(logrus.Fields{
+		"instanceId":  "i-000000000000",
+		"tag.Service": "api",
+		"stacks":      "goroutine 1\ngoroutine 2",
+	}).Warn("Failed to send heartbeat")
+
+	fields := parseJournalFields(t, readDatagram(t, journal))
+	for name, want := range map[string]string{
+		"MESSAGE":           "Failed to send heartbeat",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "lifecycled",
+		"INSTANCE_ID":       "i-000000000000",
+		"TAG_SERVICE":       "api",
+		"STACKS":            "goroutine 1\ngoroutine 2",
+	} {
+		if got := fields[name]; got != want {
+			t.Errorf("expected %s to be %q and got %q", name, want, got)
+		}
+	}
+
+	fmt.Fprintln(hook, "draining")
+	fields = parseJournalFields(t, readDatagram(t, journal))
+	if fields["MESSAGE"] != "draining" || fields["OUTPUT"] != "handler" || fields["PRIORITY"] != "6" {
+		t.Errorf("expected the handler output as an entry and got %v", fields)
+	}
+}
+
+func TestJournalHookSyslog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	syslog, path := listenUnixgram(t, dir, "log.sock")
+	defer syslog.Close()
+
+	hook, err := lifecycled.NewJournalHook("lifecycled", filepath.Join(dir, "missing.sock"), path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer hook.Close()
+	if hook.Native() {
+		t.Fatal("expected the hook to fall back to syslog")
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	logger.AddHook(hook)
+	logger.WithField("instanceId", "i-000000000000").Error("Failed to complete lifecycle action")
+
+	msg := string(readDatagram(t, syslog))
+	if !strings.HasPrefix(msg, "<27>") {
+		t.Errorf("expected the priority of an error from a daemon and got %q", msg)
+	}
+	if want := fmt.Sprintf(" lifecycled[%d]: Failed to complete lifecycle action instanceId=\"i-000000000000\"", os.Getpid()); !strings.HasSuffix(msg, want) {
+		t.Errorf("expected the message to end with %q and got %q", want, msg)
+	}
+}
+
+func TestJournalHookUnavailable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := lifecycled.NewJournalHook("lifecycled", filepath.Join(dir, "journal.sock"), filepath.Join(dir, "log.sock")); err == nil {
+		t.Error("expected an error when neither journald nor syslog is available")
+	}
+}
@@ -0,0 +1,345 @@
+package lifecycled
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+)
+
+// kmsServiceID is the service id of KMS in the AWS SDK, which the endpoint resolvers are called
+// with.
+const kmsServiceID = "KMS"
+
+// KMSKey is the description of a KMS key.
+type KMSKey struct {
+	ARN string
+
+	// Manager is AWS for the keys that AWS manages for a service, e.g. alias/aws/sns, and
+	// CUSTOMER for the customer managed keys
+	Manager string
+
+	// State is Enabled for a key that can be used
+	State string
+}
+
+// KMSClient is the part of the KMS API that checks that the key of an encrypted topic can be
+// used to publish to it. There is no KMS client in the AWS SDK of lifecycled, and NewKMSClient
+// returns one that signs the requests itself.
+type KMSClient interface {
+	// DescribeKey describes the key with the id, ARN or alias. Requires kms:DescribeKey.
+	DescribeKey(ctx context.Context, keyID string) (*KMSKey, error)
+
+	// GetKeyPolicy returns the default policy of the key with the id or ARN, which can't be an
+	// alias. Requires kms:GetKeyPolicy.
+	GetKeyPolicy(ctx context.Context, keyID string) (string, error)
+}
+
+// kmsClient calls the JSON API of KMS at the endpoint, with the credentials of the AWS
+// configuration.
+type kmsClient struct {
+	cfg      aws.Config
+	endpoint string
+	region   string
+	signer   *v4.Signer
+}
+
+// NewKMSClient returns a KMS client of the AWS configuration, at the endpoint of kms in the
+// Endpoints of the config or the (FIPS) endpoint of the region.
+func NewKMSClient(cfg aws.Config, c *Config) KMSClient {
+	client := &kmsClient{cfg: cfg, region: cfg.Region, signer: v4.NewSigner()}
+	if cfg.EndpointResolverWithOptions != nil {
+		if e, err := cfg.EndpointResolverWithOptions.ResolveEndpoint(kmsServiceID, cfg.Region); err == nil {
+			client.endpoint = e.URL
+			if e.SigningRegion != "" {
+				client.region = e.SigningRegion
+			}
+		}
+	}
+	if client.endpoint == "" {
+		host, suffix := "kms", "amazonaws.com"
+		if c.FIPS {
+			host = "kms-fips"
+		}
+		if regionPartition(cfg.Region) == "aws-cn" {
+			suffix = "amazonaws.com.cn"
+		}
+		client.endpoint = fmt.Sprintf("https://%s.%s.%s", host, cfg.Region, suffix)
+	}
+	return client
+}
+
+func (c *kmsClient) DescribeKey(ctx context.Context, keyID string) (*KMSKey, error) {
+	var out struct {
+		KeyMetadata struct {
+			ARN        string `json:"Arn"`
+			KeyManager string
+			KeyState   string
+		}
+	}
+	if err := c.call(ctx, "DescribeKey", map[string]string{"KeyId": keyID}, &out); err != nil {
+		return nil, err
+	}
+	return &KMSKey{ARN: out.KeyMetadata.ARN, Manager: out.KeyMetadata.KeyManager, State: out.KeyMetadata.KeyState}, nil
+}
+
+func (c *kmsClient) GetKeyPolicy(ctx context.Context, keyID string) (string, error) {
+	var out struct{ Policy string }
+	if err := c.call(ctx, "GetKeyPolicy", map[string]string{"KeyId": keyID, "PolicyName": "default"}, &out); err != nil {
+		return "", err
+	}
+	return out.Policy, nil
+}
+
+// call sends the operation of the JSON 1.1 protocol of KMS, signed with the credentials. The
+// errors of the API are smithy.APIErrors with the code of their type, e.g. AccessDeniedException.
+func (c *kmsClient) call(ctx context.Context, operation string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+operation)
+
+	if c.cfg.Credentials == nil {
+		return fmt.Errorf("kms %s: no credentials", operation)
+	}
+	creds, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("kms %s: %w", operation, err)
+	}
+	hash := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "kms", c.region, time.Now()); err != nil {
+		return fmt.Errorf("kms %s: %w", operation, err)
+	}
+
+	httpClient := c.cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("kms %s: %w", operation, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("kms %s: %w", operation, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &e)
+		if e.Type == "" {
+			e.Type = resp.Status
+		}
+		// The type can be namespaced, e.g. com.amazonaws.kms#NotFoundException
+		if i := strings.LastIndex(e.Type, "#"); i >= 0 {
+			e.Type = e.Type[i+1:]
+		}
+		return fmt.Errorf("kms %s: %w", operation, &smithy.GenericAPIError{Code: e.Type, Message: e.Message})
+	}
+	return json.Unmarshal(data, out)
+}
+
+// topicKeyActions are the actions of the key of an encrypted topic that the publisher of the
+// lifecycle hook needs, to encrypt the messages that SNS then delivers to the queue, and
+// topicKeyPermissions are those that a key policy grants them with.
+var (
+	topicKeyActions     = []string{"kms:GenerateDataKey", "kms:Decrypt"}
+	topicKeyPermissions = []string{"kms:GenerateDataKey*", "kms:Decrypt"}
+)
+
+// keyPolicy is the part of a key policy that is checked for the actions of the publisher.
+type keyPolicy struct {
+	Statement policyList `json:"Statement"`
+}
+
+type keyPolicyStatement struct {
+	Effect    string          `json:"Effect"`
+	Principal json.RawMessage `json:"Principal"`
+	Action    policyList      `json:"Action"`
+}
+
+// policyList is an element of a policy that is a string or a list of them.
+type policyList []json.RawMessage
+
+func (l *policyList) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		*l = list
+		return nil
+	}
+	*l = policyList{json.RawMessage(data)}
+	return nil
+}
+
+// strings returns the strings of the list.
+func (l policyList) strings() []string {
+	var values []string
+	for _, v := range l {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// principals returns the principals of the statement, e.g. * or the ARNs of its AWS principals
+// and the names of its service principals.
+func (s keyPolicyStatement) principals() []string {
+	var all string
+	if json.Unmarshal(s.Principal, &all) == nil {
+		return []string{all}
+	}
+	var principals map[string]policyList
+	if json.Unmarshal(s.Principal, &principals) != nil {
+		return nil
+	}
+	var values []string
+	for _, kind := range []string{"AWS", "Service"} {
+		values = append(values, principals[kind].strings()...)
+	}
+	return values
+}
+
+// allows returns true if one of the actions of the statement matches the action, which
+// ignores the case like IAM.
+func (s keyPolicyStatement) allows(action string) bool {
+	for _, pattern := range s.Action.strings() {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(action)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// keyPolicyAllows returns true if the key policy allows a principal that the publisher is, or
+// that delegates to the IAM policies of the account of the topic, each of the actions that
+// publishing to the topic needs, and which of the principals does. The publisher is the role of
+// the lifecycle hook, which is empty if it isn't known. Denials and conditions aren't
+// evaluated.
+func keyPolicyAllows(policy, topic, publisher string) (bool, string, error) {
+	var p keyPolicy
+	if err := json.Unmarshal([]byte(policy), &p); err != nil {
+		return false, "", fmt.Errorf("failed to parse the key policy: %w", err)
+	}
+	accepted := []string{"*", "sns.amazonaws.com"}
+	if a, err := arn.Parse(topic); err == nil {
+		accepted = append(accepted, a.AccountID, fmt.Sprintf("arn:%s:iam::%s:root", a.Partition, a.AccountID))
+	}
+	if publisher != "" {
+		accepted = append(accepted, publisher)
+	}
+
+	for _, principal := range accepted {
+		allowed := map[string]bool{}
+		for _, raw := range p.Statement {
+			var s keyPolicyStatement
+			if json.Unmarshal(raw, &s) != nil || s.Effect != "Allow" || !contains(s.principals(), principal) {
+				continue
+			}
+			for _, action := range topicKeyActions {
+				if s.allows(action) {
+					allowed[action] = true
+				}
+			}
+		}
+		if len(allowed) == len(topicKeyActions) {
+			return true, principal, nil
+		}
+	}
+	return false, "", nil
+}
+
+// keyPolicyStatementExample is the statement of the key policy that allows the publisher to
+// publish to the topic, for the errors of the check.
+func keyPolicyStatementExample(publisher string) string {
+	if publisher == "" {
+		publisher = "<the role of the lifecycle hook>"
+	}
+	statement, _ := json.Marshal(map[string]interface{}{
+		"Sid":       "AllowLifecycleHookPublish",
+		"Effect":    "Allow",
+		"Principal": map[string]string{"AWS": publisher},
+		"Action":    topicKeyPermissions,
+		"Resource":  "*",
+	})
+	return string(statement)
+}
+
+// TopicEncryptionCheck is the name of the check of the key of an encrypted topic.
+const TopicEncryptionCheck = "sns-topic-encryption"
+
+// checkTopicKey checks that the KMS key of the topic, its KmsMasterKeyId attribute, can be used
+// by the publisher (see keyPolicyAllows), since SNS silently doesn't deliver the notifications
+// that it can't encrypt to the queue. The AWS managed key of SNS fails, since its policy can't
+// allow the roles of lifecycle hooks. The check is skipped if the key or its policy can't be
+// read.
+func checkTopicKey(ctx context.Context, client KMSClient, topic, keyID, publisher string) CheckResult {
+	result := func(status, format string, args ...interface{}) CheckResult {
+		return CheckResult{Name: TopicEncryptionCheck, Status: status, Detail: fmt.Sprintf(format, args...)}
+	}
+	required := fmt.Sprintf("the key policy must allow the role of the lifecycle hook %s, e.g. with the statement %s", strings.Join(topicKeyPermissions, " and "), keyPolicyStatementExample(publisher))
+	if client == nil {
+		return result(CheckSkip, "the topic is encrypted with %s, which can't be checked without a kms client: %s", keyID, required)
+	}
+
+	key, err := client.DescribeKey(ctx, keyID)
+	if err != nil {
+		if isAuthorizationError(err) {
+			return result(CheckSkip, "the topic is encrypted with %s, which can't be checked since kms:DescribeKey is denied: %s", keyID, required)
+		}
+		return result(CheckFail, "the key %s of the topic could not be described: %s", keyID, err)
+	}
+	if key.State != "" && key.State != "Enabled" {
+		return result(CheckFail, "the key %s of the topic is %s, SNS can't deliver notifications to the queue until it is enabled", key.ARN, key.State)
+	}
+	if key.Manager == "AWS" {
+		return result(CheckFail, "the topic is encrypted with the AWS managed key %s, whose policy can't allow lifecycle hooks to publish to it: encrypt it with a customer managed key whose policy allows the role of the lifecycle hook %s, e.g. with the statement %s",
+			keyID, strings.Join(topicKeyPermissions, " and "), keyPolicyStatementExample(publisher))
+	}
+
+	policy, err := client.GetKeyPolicy(ctx, key.ARN)
+	if err != nil {
+		if isAuthorizationError(err) {
+			return result(CheckSkip, "the topic is encrypted with %s, whose policy can't be checked since kms:GetKeyPolicy is denied: %s", key.ARN, required)
+		}
+		return result(CheckFail, "the policy of the key %s of the topic could not be read: %s", key.ARN, err)
+	}
+	ok, principal, err := keyPolicyAllows(policy, topic, publisher)
+	switch {
+	case err != nil:
+		return result(CheckFail, "%s of %s", err, key.ARN)
+	case !ok:
+		return result(CheckFail, "the policy of the key %s of the topic doesn't allow publishing to it, and SNS won't deliver the notifications to the queue: %s", key.ARN, required)
+	case principal != "*" && principal != publisher && !strings.HasSuffix(principal, ".amazonaws.com"):
+		// The account, whose IAM policies grant the key to its roles
+		return result(CheckPass, "the topic is encrypted with %s, whose policy delegates to the IAM policies of %s, which must allow the role of the lifecycle hook %s", key.ARN, principal, strings.Join(topicKeyPermissions, " and "))
+	default:
+		return result(CheckPass, "the topic is encrypted with %s, whose policy allows %s", key.ARN, principal)
+	}
+}
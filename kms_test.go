@@ -0,0 +1,212 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	autoscalingtypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/golang/mock/gomock"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// fakeKMS is a KMS client with one key and its policy.
+type fakeKMS struct {
+	key       lifecycled.KMSKey
+	policy    string
+	policyErr error
+}
+
+func (f *fakeKMS) DescribeKey(_ context.Context, keyID string) (*lifecycled.KMSKey, error) {
+	key := f.key
+	return &key, nil
+}
+
+func (f *fakeKMS) GetKeyPolicy(_ context.Context, keyID string) (string, error) {
+	if keyID != f.key.ARN {
+		return "", &smithy.GenericAPIError{Code: "NotFoundException", Message: "aliases are not supported"}
+	}
+	return f.policy, f.policyErr
+}
+
+// keyPolicy returns a key policy with the statements.
+func keyPolicy(statements ...string) string {
+	return `{"Version":"2012-10-17","Statement":[` + strings.Join(statements, ",") + `]}`
+}
+
+func TestSelfCheckTopicEncryption(t *testing.T) {
+	topic := "arn:aws:sns:us-east-1:123456789012:lifecycled"
+	role := "arn:aws:iam::123456789012:role/lifecycle-hook"
+	keyARN := "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	customer := lifecycled.KMSKey{ARN: keyARN, Manager: "CUSTOMER", State: "Enabled"}
+
+	tests := []struct {
+		description string
+		kms         lifecycled.KMSClient
+		expected    string
+		detail      string
+	}{
+		{
+			description: "allowed to the role of the hook",
+			kms: &fakeKMS{key: customer, policy: keyPolicy(
+				`{"Effect":"Allow","Principal":{"AWS":"` + role + `"},"Action":["kms:GenerateDataKey*","kms:Decrypt"],"Resource":"*"}`,
+			)},
+			expected: lifecycled.CheckPass,
+			detail:   "whose policy allows " + role,
+		},
+		{
+			description: "delegated to the account",
+			kms: &fakeKMS{key: customer, policy: keyPolicy(
+				`{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"kms:*","Resource":"*"}`,
+			)},
+			expected: lifecycled.CheckPass,
+			detail:   "delegates to the IAM policies",
+		},
+		{
+			description: "allowed in separate statements",
+			kms: &fakeKMS{key: customer, policy: keyPolicy(
+				`{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::123456789012:role/other","`+role+`"]},"Action":"kms:GenerateDataKey","Resource":"*"}`,
+				`{"Effect":"Allow","Principal":{"AWS":"`+role+`"},"Action":"KMS:Decrypt","Resource":"*"}`,
+			)},
+			expected: lifecycled.CheckPass,
+		},
+		{
+			description: "not allowed to decrypt",
+			kms: &fakeKMS{key: customer, policy: keyPolicy(
+				`{"Effect":"Allow","Principal":{"AWS":"`+role+`"},"Action":"kms:GenerateDataKey*","Resource":"*"}`,
+				`{"Effect":"Deny","Principal":"*","Action":"kms:*","Resource":"*"}`,
+			)},
+			expected: lifecycled.CheckFail,
+			detail:   `"Principal":{"AWS":"` + role + `"}`,
+		},
+		{
+			description: "the AWS managed key",
+			kms:         &fakeKMS{key: lifecycled.KMSKey{ARN: keyARN, Manager: "AWS", State: "Enabled"}},
+			expected:    lifecycled.CheckFail,
+			detail:      "customer managed key",
+		},
+		{
+			description: "disabled key",
+			kms:         &fakeKMS{key: lifecycled.KMSKey{ARN: keyARN, Manager: "CUSTOMER", State: "Disabled"}},
+			expected:    lifecycled.CheckFail,
+			detail:      "is Disabled",
+		},
+		{
+			description: "policy denied",
+			kms:         &fakeKMS{key: customer, policyErr: &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform: kms:GetKeyPolicy"}},
+			expected:    lifecycled.CheckSkip,
+			detail:      "kms:GetKeyPolicy is denied",
+		},
+		{
+			description: "no kms client",
+			expected:    lifecycled.CheckSkip,
+			detail:      "kms:GenerateDataKey* and kms:Decrypt",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Return(&sqs.GetQueueAttributesOutput{}, nil)
+			sn.EXPECT().GetTopicAttributes(gomock.Any(), gomock.Any()).Return(&sns.GetTopicAttributesOutput{
+				Attributes: map[string]string{"KmsMasterKeyId": "alias/lifecycled"},
+			}, nil)
+			as.EXPECT().DescribeAutoScalingInstances(gomock.Any(), gomock.Any()).Return(&autoscaling.DescribeAutoScalingInstancesOutput{
+				AutoScalingInstances: []autoscalingtypes.AutoScalingInstanceDetails{{AutoScalingGroupName: aws.String("group")}},
+			}, nil)
+			as.EXPECT().DescribeLifecycleHooks(gomock.Any(), gomock.Any()).Return(&autoscaling.DescribeLifecycleHooksOutput{
+				LifecycleHooks: []autoscalingtypes.LifecycleHook{{
+					LifecycleHookName:     aws.String("terminating"),
+					LifecycleTransition:   aws.String("autoscaling:EC2_INSTANCE_TERMINATING"),
+					NotificationTargetARN: aws.String(topic),
+					RoleARN:               aws.String(role),
+				}},
+			}, nil)
+			rejected := &smithy.GenericAPIError{Code: "ValidationError", Message: "No active Lifecycle Action found"}
+			as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any()).Return(nil, rejected)
+			as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any()).Return(nil, rejected)
+
+			queue := lifecycled.NewQueue("queue", topic, sq, sn)
+			results := lifecycled.SelfCheck(context.TODO(), queue, as, tc.kms, "i-000000000000")
+
+			r := results[len(results)-1]
+			if r.Name != lifecycled.TopicEncryptionCheck {
+				t.Fatalf("expected the last result to be %s and got %s", lifecycled.TopicEncryptionCheck, r.Name)
+			}
+			if r.Status != tc.expected {
+				t.Errorf("expected %s and got %s: %s", tc.expected, r.Status, r.Detail)
+			}
+			if !strings.Contains(r.Detail, tc.detail) {
+				t.Errorf("expected the detail to contain '%s' and got: %s", tc.detail, r.Detail)
+			}
+		})
+	}
+}
+
+func TestKMSClient(t *testing.T) {
+	keyARN := "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-east-1/kms/aws4_request") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var input map[string]string
+		_ = json.Unmarshal(body, &input)
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.DescribeKey":
+			if input["KeyId"] != "alias/lifecycled" {
+				t.Errorf("unexpected key id: %s", input["KeyId"])
+			}
+			w.Write([]byte(`{"KeyMetadata":{"Arn":"` + keyARN + `","KeyManager":"CUSTOMER","KeyState":"Enabled"}}`))
+		case "TrentService.GetKeyPolicy":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.kms#AccessDeniedException","message":"not authorized"}`))
+		default:
+			http.Error(w, "unknown operation", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		EndpointResolverWithOptions: aws.EndpointResolverWithOptionsFunc(func(service, region string, _ ...interface{}) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: server.URL, SigningRegion: region}, nil
+		}),
+	}
+	client := lifecycled.NewKMSClient(cfg, &lifecycled.Config{})
+
+	key, err := client.DescribeKey(context.TODO(), "alias/lifecycled")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if key.ARN != keyARN || key.Manager != "CUSTOMER" || key.State != "Enabled" {
+		t.Errorf("unexpected key: %+v", key)
+	}
+
+	_, err = client.GetKeyPolicy(context.TODO(), keyARN)
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "AccessDeniedException" {
+		t.Errorf("expected an AccessDeniedException and got: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package lifecycled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/pager"
+)
+
+// kubernetesCallTimeout bounds each call of the Kubernetes API.
+const kubernetesCallTimeout = 30 * time.Second
+
+// kubernetesClient makes the calls of the Kubernetes API that draining a node needs.
+type kubernetesClient struct {
+	clientset kubernetes.Interface
+}
+
+// newKubernetesClient returns a client of the cluster of the kubeconfig file, or if it is empty
+// of the files in $KUBECONFIG or ~/.kube/config, or of the service account of the pod when
+// running in one without a kubeconfig, like kubectl.
+func newKubernetesClient(kubeconfig string) (*kubernetesClient, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the configuration of the kubernetes cluster: %w", err)
+	}
+	config.Timeout = kubernetesCallTimeout
+	config.UserAgent = "lifecycled/" + Version
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the kubernetes client: %w", err)
+	}
+	return &kubernetesClient{clientset: clientset}, nil
+}
+
+// isKubernetesClientError returns true if the error is a 4xx response of the API, e.g. if the
+// request is forbidden, which is not retried.
+func isKubernetesClientError(err error) bool {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return false
+	}
+	code := status.Status().Code
+	return code >= 400 && code < 500
+}
+
+// nodeForInstance returns the name of the node whose provider id is that of the instance, e.g.
+// aws:///us-east-1a/i-0123456789abcdef0.
+func (c *kubernetesClient) nodeForInstance(ctx context.Context, instanceID string) (string, error) {
+	var node string
+	list := pager.New(func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.CoreV1().Nodes().List(ctx, options)
+	})
+	err := list.EachListItem(ctx, metav1.ListOptions{}, func(obj runtime.Object) error {
+		if n := obj.(*corev1.Node); node == "" && strings.HasSuffix(n.Spec.ProviderID, "/"+instanceID) {
+			node = n.Name
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+	if node == "" {
+		return "", fmt.Errorf("no node has the provider id of the instance %s", instanceID)
+	}
+	return node, nil
+}
+
+// cordon marks the node unschedulable.
+func (c *kubernetesClient) cordon(ctx context.Context, node string) error {
+	patch := []byte(`{"spec":{"unschedulable":true}}`)
+	if _, err := c.clientset.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to cordon node %s: %w", node, err)
+	}
+	return nil
+}
+
+// podKey returns the namespace and name of the pod.
+func podKey(pod *corev1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+// evictable returns false for the pods that draining leaves: those of DaemonSets, which would be
+// recreated on the node, the mirror pods of static pods, which can't be evicted, and the pods that
+// have finished.
+func evictable(pod *corev1.Pod) bool {
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+	return pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+// podsOnNode returns the pods that are scheduled on the node, of all the pages of the list.
+func (c *kubernetesClient) podsOnNode(ctx context.Context, node string) ([]*corev1.Pod, error) {
+	var pods []*corev1.Pod
+	list := pager.New(func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+		return c.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, options)
+	})
+	options := metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node).String()}
+	err := list.EachListItem(ctx, options, func(obj runtime.Object) error {
+		pods = append(pods, obj.(*corev1.Pod))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pods of node %s: %w", node, err)
+	}
+	return pods, nil
+}
+
+// evict the pod with the eviction API, which respects its PodDisruptionBudgets, with the grace
+// period if it is not negative. An eviction that a PodDisruptionBudget blocks fails with 429.
+func (c *kubernetesClient) evict(ctx context.Context, pod *corev1.Pod, gracePeriod time.Duration) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	}
+	if gracePeriod >= 0 {
+		seconds := int64(gracePeriod.Round(time.Second) / time.Second)
+		eviction.DeleteOptions = &metav1.DeleteOptions{GracePeriodSeconds: &seconds}
+	}
+	return c.clientset.CoreV1().Pods(pod.Namespace).EvictV1(ctx, eviction)
+}
+
+// podGone returns true once the pod has been deleted, or replaced by a pod with the same name.
+func (c *kubernetesClient) podGone(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	current, err := c.clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return current.UID != pod.UID, nil
+}
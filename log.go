@@ -0,0 +1,219 @@
+package lifecycled
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats of the lifecycled command.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogFieldNames are the stable names of the lifecycle-specific log fields in JSON logs, by the
+// name of the field in text logs.
+var LogFieldNames = map[string]string{
+	"instanceId":       "instance_id",
+	"notice":           "notice_type",
+	"lifecycleHook":    "hook",
+	"autoscalingGroup": "asg",
+	"runId":            "run_id",
+}
+
+// NewJSONFormatter returns a logrus formatter for JSON logs, which renames the lifecycle-specific
+// fields to their stable names (see LogFieldNames) and formats timestamps as RFC3339 with
+// nanoseconds in UTC.
+func NewJSONFormatter() logrus.Formatter {
+	return &jsonFormatter{JSONFormatter: logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}}
+}
+
+type jsonFormatter struct {
+	logrus.JSONFormatter
+}
+
+// Format the entry, leaving the fields of the original entry unchanged for other formatters and hooks.
+func (f *jsonFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		if name, ok := LogFieldNames[k]; ok {
+			k = name
+		}
+		data[k] = v
+	}
+	e := *entry
+	e.Data = data
+	e.Time = entry.Time.UTC()
+	return f.JSONFormatter.Format(&e)
+}
+
+// NewLogWriter returns a writer which logs each line that is written as an entry, so that
+// multi-line output (e.g. of handlers) is one event per line. Lines are not buffered across
+// writes, so that writers which share the entry can't interleave them.
+func NewLogWriter(log *logrus.Entry) io.Writer {
+	return &logWriter{log: log}
+}
+
+type logWriter struct {
+	log *logrus.Entry
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		if s := strings.TrimRight(string(line), "\r"); s != "" {
+			w.log.Info(s)
+		}
+	}
+	return len(p), nil
+}
+
+// Components of the daemon whose log level can be set separately (see Config.LogLevels).
+const (
+	LogComponentDaemon      = "daemon"
+	LogComponentQueue       = "queue"
+	LogComponentAutoscaling = "autoscaling-listener"
+	LogComponentSpot        = "spot-listener"
+	LogComponentHandler     = "handler"
+)
+
+// LogComponents are the components that have a log level.
+var LogComponents = []string{LogComponentDaemon, LogComponentQueue, LogComponentAutoscaling, LogComponentSpot, LogComponentHandler}
+
+// parseLogLevels parses the log level of each component.
+func parseLogLevels(levels map[string]string) (map[string]logrus.Level, error) {
+	parsed := make(map[string]logrus.Level, len(levels))
+	for component, level := range levels {
+		if !contains(LogComponents, component) {
+			return nil, fmt.Errorf("unknown log component %q (expected one of %s)", component, strings.Join(LogComponents, ", "))
+		}
+		l, err := logrus.ParseLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("log level of %s: %w", component, err)
+		}
+		parsed[component] = l
+	}
+	return parsed, nil
+}
+
+// componentLoggers are child loggers of a logger for the components that have their own log
+// level, which share its output, formatter and hooks. Components without a level use the logger.
+type componentLoggers struct {
+	base *logrus.Logger
+
+	mu      sync.Mutex
+	loggers map[string]*logrus.Logger
+}
+
+func newComponentLoggers(base *logrus.Logger) *componentLoggers {
+	return &componentLoggers{base: base, loggers: make(map[string]*logrus.Logger)}
+}
+
+// setLevels sets the level of each component, and resets the other components to the level of the logger.
+func (c *componentLoggers) setLevels(levels map[string]logrus.Level) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, l := range c.loggers {
+		l.SetLevel(c.base.GetLevel())
+	}
+	for component, level := range levels {
+		l, ok := c.loggers[component]
+		if !ok {
+			l = &logrus.Logger{
+				Out:          c.base.Out,
+				Formatter:    c.base.Formatter,
+				Hooks:        c.base.Hooks,
+				ReportCaller: c.base.ReportCaller,
+				ExitFunc:     c.base.ExitFunc,
+			}
+			c.loggers[component] = l
+		}
+		l.SetLevel(level)
+	}
+}
+
+// logger returns the logger for the component.
+func (c *componentLoggers) logger(component string) *logrus.Logger {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok := c.loggers[component]; ok {
+		return l
+	}
+	return c.base
+}
+
+// entry returns an entry with the fields of the parent for the logger of the component. A nil
+// componentLoggers returns the parent.
+func (c *componentLoggers) entry(component string, parent *logrus.Entry) *logrus.Entry {
+	if c == nil {
+		return parent
+	}
+	return logrus.NewEntry(c.logger(component)).WithFields(parent.Data).WithContext(parent.Context)
+}
+
+// levels returns the effective level of every component.
+func (c *componentLoggers) levels() map[string]string {
+	levels := make(map[string]string, len(LogComponents))
+	for _, component := range LogComponents {
+		levels[component] = c.logger(component).GetLevel().String()
+	}
+	return levels
+}
+
+// SetLogLevels sets the log level of each component (e.g. {"queue": "debug"}), and the others
+// log at the level of the logger of the daemon. It can be called while the daemon is running.
+func (d *Daemon) SetLogLevels(levels map[string]string) error {
+	parsed, err := parseLogLevels(levels)
+	if err != nil {
+		return err
+	}
+	d.logs.setLevels(parsed)
+	return nil
+}
+
+// LogLevels returns the effective log level of every component.
+func (d *Daemon) LogLevels() map[string]string {
+	return d.logs.levels()
+}
+
+// ComponentLogger returns the logger for the component, e.g. for logging the output of handlers.
+func (d *Daemon) ComponentLogger(component string) *logrus.Logger {
+	return d.logs.logger(component)
+}
+
+// noticeComponent returns the component that logs the handling of the notice.
+func noticeComponent(notice TerminationNotice) string {
+	switch notice.(type) {
+	case *autoscalingTerminationNotice:
+		return LogComponentAutoscaling
+	case *spotTerminationNotice:
+		return LogComponentSpot
+	default:
+		return LogComponentDaemon
+	}
+}
+
+// loggedHandler passes the log of the handler component to the handler.
+type loggedHandler struct {
+	Handler
+	logs *componentLoggers
+}
+
+// HandleNotice passes the notice to the handler, with the log of the handler component.
+func (h *loggedHandler) HandleNotice(ctx context.Context, notice *Notice) error {
+	if notice.Log != nil {
+		n := *notice
+		n.Log = h.logs.entry(LogComponentHandler, notice.Log)
+		notice = &n
+	}
+	return executeHandler(ctx, h.Handler, notice)
+}
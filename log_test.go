@@ -0,0 +1,144 @@
+package lifecycled_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestJSONFormatter(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.SetFormatter(lifecycled.NewJSONFormatter())
+
+	local := time.Date(2020, 1, 5, 18, 2, 42, 123456789, time.FixedZone("AEDT", 11*60*60))
+	logger.WithFields(logrus.Fields{
+		"instanceId":       "i-000000000000",
+		"notice":           "autoscaling",
+		"lifecycleHook":    "drain",
+		"autoscalingGroup": "group",
+		"runId":            "abcd1234",
+		"duration":         "1s",
+	}).WithTime(local).Info("Handler finished successfully")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log line and got %q: %s", out.String(), err)
+	}
+	for name, want := range map[string]string{
+		"instance_id": "i-000000000000",
+		"notice_type": "autoscaling",
+		"hook":        "drain",
+		"asg":         "group",
+		"run_id":      "abcd1234",
+		"duration":    "1s",
+		"time":        "2020-01-05T07:02:42.123456789Z",
+	} {
+		if got := entry[name]; got != want {
+			t.Errorf("expected %s to be '%s' and got '%v'", name, want, got)
+		}
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.SetFormatter(lifecycled.NewJSONFormatter())
+
+	w := lifecycled.NewLogWriter(logger.WithField("output", "handler"))
+	if _, err := w.Write([]byte("first line\nsecond line\r\n\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if got, want := len(lines), 2; got != want {
+		t.Fatalf("expected %d log lines and got %d: %q", want, got, lines)
+	}
+	for i, want := range []string{"first line", "second line"} {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if entry["msg"] != want {
+			t.Errorf("expected message '%s' and got '%v'", want, entry["msg"])
+		}
+	}
+}
+
+func TestComponentLogLevels(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessages(sq, sn, nil, []byte(aws.ToString(newSQSMessage(instanceID).Body)))
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	logger, hook := test.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: 10 * time.Millisecond,
+		LogLevels:                    map[string]string{"queue": "debug", "handler": "debug"},
+	}, sq, sn, as, nil, logger)
+
+	levels := daemon.LogLevels()
+	for component, want := range map[string]string{"queue": "debug", "handler": "debug", "daemon": "info", "autoscaling-listener": "info"} {
+		if got := levels[component]; got != want {
+			t.Errorf("expected %s log level '%s' and got '%s'", component, want, got)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	err := daemon.Run(ctx, lifecycled.NoticeHandlerFunc(func(_ context.Context, n *lifecycled.Notice) error {
+		time.Sleep(30 * time.Millisecond)
+		n.Log.Debug("Draining")
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	logged := make(map[string]bool)
+	for _, e := range hook.AllEntries() {
+		logged[e.Message] = true
+	}
+	for msg, want := range map[string]bool{
+		"Creating sqs queue": true,
+		"Draining":           true,
+		"Sending heartbeat":  false,
+		"Executing handler":  true,
+	} {
+		if logged[msg] != want {
+			t.Errorf("expected '%s' to be logged to be %t", msg, want)
+		}
+	}
+
+	if err := daemon.SetLogLevels(map[string]string{"daemon": "warn"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := daemon.LogLevels()["queue"]; got != "info" {
+		t.Errorf("expected the queue log level to be reset and got '%s'", got)
+	}
+	if err := daemon.SetLogLevels(map[string]string{"sqs": "debug"}); err == nil {
+		t.Error("expected an error for an unknown component")
+	}
+}
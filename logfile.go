@@ -0,0 +1,182 @@
+package lifecycled
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// LogFile is a file that the logs are written to, which is rotated when a write would make it
+// exceed the maximum size, keeping a number of previous files (path.1 being the newest) that
+// are optionally compressed (path.1.gz). It can also be reopened for external rotation tools.
+type LogFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	keep     int
+	compress bool
+
+	file *os.File
+	size int64
+
+	// compressing is done once the previous file has been compressed.
+	compressing sync.WaitGroup
+	compressErr error
+}
+
+// OpenLogFile opens (or creates) the log file at path for appending, which is rotated when a write
+// would make it exceed maxSize bytes (never if zero), keeping the given number of previous files.
+func OpenLogFile(path string, maxSize int64, keep int, compress bool) (*LogFile, error) {
+	l := &LogFile{path: path, maxSize: maxSize, keep: keep, compress: compress}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *LogFile) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// Write the bytes to the file, rotating it first if they would make it exceed the maximum size.
+func (l *LogFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return 0, os.ErrClosed
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate log file: %s", err)
+		}
+	}
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate the file, shifting the previous files and removing the oldest.
+func (l *LogFile) rotate() error {
+	// The previous file is renamed below, so it has to be compressed first
+	l.compressing.Wait()
+
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	if l.keep < 1 {
+		if err := os.Remove(l.path); err != nil {
+			return err
+		}
+		return l.open()
+	}
+	if err := os.Remove(l.backup(l.keep)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := l.keep - 1; i >= 1; i-- {
+		if err := os.Rename(l.backup(i), l.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	rotated := fmt.Sprintf("%s.1", l.path)
+	if err := os.Rename(l.path, rotated); err != nil {
+		return err
+	}
+	if l.compress {
+		l.compressing.Add(1)
+		go func() {
+			defer l.compressing.Done()
+			l.compressErr = compressFile(rotated, l.backup(1))
+		}()
+	}
+	return l.open()
+}
+
+// backup returns the path of the nth previous file.
+func (l *LogFile) backup(n int) string {
+	if l.compress {
+		return fmt.Sprintf("%s.%d.gz", l.path, n)
+	}
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// compressFile writes the file to dst with gzip, and removes it.
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	err = writeGzip(dst, in)
+	in.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func writeGzip(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(f)
+	if _, err := io.Copy(w, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Reopen the file at the path, e.g. on SIGHUP after an external tool such as logrotate has
+// renamed it, so that the logs are written to a new file.
+func (l *LogFile) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+		l.file = nil
+	}
+	return l.open()
+}
+
+// Close syncs the file to disk and closes it, once the previous file has been compressed. It
+// returns the error of compressing the previous file, if any.
+func (l *LogFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.compressing.Wait()
+	if l.file == nil {
+		return l.compressErr
+	}
+	err := l.file.Sync()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	if err == nil {
+		err = l.compressErr
+	}
+	return err
+}
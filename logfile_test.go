@@ -0,0 +1,123 @@
+package lifecycled_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/triarius/lifecycled"
+)
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", path, err)
+	}
+	return string(data)
+}
+
+func TestLogFileRotation(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "lifecycled")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "lifecycled.log")
+		f, err := lifecycled.OpenLogFile(path, 10, 2, compress)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+			if _, err := f.Write([]byte(line)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got, want := readFile(t, path), "fourth\n"; got != want {
+			t.Errorf("expected the log file to contain %q and got %q", want, got)
+		}
+		backups := map[string]string{path + ".1": "third\n", path + ".2": "second\n"}
+		for backup, want := range backups {
+			if compress {
+				backup += ".gz"
+			}
+			var got string
+			if compress {
+				got = readGzip(t, backup)
+			} else {
+				got = readFile(t, backup)
+			}
+			if got != want {
+				t.Errorf("expected %s to contain %q and got %q", backup, want, got)
+			}
+		}
+		files, _ := filepath.Glob(path + "*")
+		if got, want := len(files), 3; got != want {
+			t.Errorf("expected %d files with compress %t and got %v", want, compress, files)
+		}
+	}
+}
+
+func readGzip(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", path, err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", path, err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", path, err)
+	}
+	return string(data)
+}
+
+func TestLogFileReopen(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("open files can't be renamed on windows")
+	}
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "lifecycled.log")
+	f, err := lifecycled.OpenLogFile(path, 0, 0, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("before\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Rotated by an external tool, which then sends SIGHUP
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := f.Write([]byte("after\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got, want := readFile(t, path+".old"), "before\n"; got != want {
+		t.Errorf("expected the rotated file to contain %q and got %q", want, got)
+	}
+	if got, want := readFile(t, path), "after\n"; got != want {
+		t.Errorf("expected the reopened file to contain %q and got %q", want, got)
+	}
+}
@@ -0,0 +1,95 @@
+package lifecycled
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logSampleWindow is the interval between the summaries of a repeated warning.
+const logSampleWindow = time.Minute
+
+// logSampler suppresses repeats of the same warning from a loop, such as failed polls or
+// heartbeats while the API is throttling, so that they don't flood the logs of every instance.
+// The first occurrence is always logged, then the repeats are logged as a summary once a minute,
+// and any that are pending are logged before the recovery. It is not safe for concurrent use.
+type logSampler struct {
+	window  time.Duration
+	repeats map[string]*repeatedWarning
+
+	// failures is the number of warnings since the last recovery
+	failures int
+}
+
+// repeatedWarning counts the repeats of a warning since it was last logged.
+type repeatedWarning struct {
+	msg   string
+	log   *logrus.Entry
+	since time.Time
+	count int
+}
+
+func newLogSampler() *logSampler {
+	return &logSampler{window: logSampleWindow, repeats: make(map[string]*repeatedWarning)}
+}
+
+// warn logs the warning with the error, unless the same warning has already been logged in the
+// last minute, in which case it is counted in the next summary.
+func (s *logSampler) warn(log *logrus.Entry, err error, msg string) {
+	s.failures++
+	now := time.Now()
+	key := msg + "\x00" + sampleKey(err)
+	r, ok := s.repeats[key]
+	if !ok || (r.count == 0 && now.Sub(r.since) >= s.window) {
+		s.repeats[key] = &repeatedWarning{msg: msg, since: now}
+		log.WithError(err).Warn(msg)
+		return
+	}
+	r.count++
+	r.log = log.WithError(err)
+	if now.Sub(r.since) >= s.window {
+		r.summarize()
+		r.since = now
+	}
+}
+
+// recovered logs the summaries of any pending repeats, followed by the message if there have
+// been warnings since the last recovery.
+func (s *logSampler) recovered(log *logrus.Entry, msg string) {
+	if s.failures == 0 {
+		return
+	}
+	s.flush()
+	log.WithField("failures", s.failures).Info(msg)
+	s.failures = 0
+	s.repeats = make(map[string]*repeatedWarning)
+}
+
+// flush logs the summaries of any pending repeats, e.g. when the loop exits.
+func (s *logSampler) flush() {
+	for _, r := range s.repeats {
+		r.summarize()
+	}
+}
+
+// summarize logs the number of repeats since the warning was last logged, if there are any.
+func (r *repeatedWarning) summarize() {
+	if r.count == 0 {
+		return
+	}
+	r.log.WithField("repeated", r.count).Warn(fmt.Sprintf("%s (repeated %d times in the last minute)", r.msg, r.count))
+	r.count = 0
+}
+
+// sampleKey identifies the error for the purpose of comparing warnings, which is the code of AWS
+// errors since their messages include the request id.
+func sampleKey(err error) string {
+	if err == nil {
+		return ""
+	}
+	if e, ok := apiError(err); ok && e.ErrorCode() != "" {
+		return e.ErrorCode()
+	}
+	return err.Error()
+}
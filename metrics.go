@@ -0,0 +1,253 @@
+package lifecycled
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the Prometheus metrics of a Daemon, which are updated by the daemon, its listeners
+// and the notices that it handles. Metrics is a prometheus.Collector, and nothing is exported
+// until it is registered. A nil *Metrics discards all updates.
+type Metrics struct {
+	daemon *Daemon
+
+	// statsd receives the same updates, if configured
+	statsd *StatsdSink
+
+	// counters for the debug variables, which can't be read back from the Prometheus metrics
+	counters debugCounters
+
+	noticesReceived   *prometheus.CounterVec
+	handlerDuration   *prometheus.HistogramVec
+	handlerStart      *prometheus.HistogramVec
+	handlerFailures   *prometheus.CounterVec
+	heartbeatFailures prometheus.Counter
+	pollErrors        prometheus.Counter
+	parseFailures     *prometheus.CounterVec
+	awsRetries        *prometheus.CounterVec
+	clockSkew         *prometheus.CounterVec
+	rateLimitWait     *prometheus.HistogramVec
+	sinceLastPoll     *prometheus.Desc
+}
+
+// newMetrics returns the metrics for the daemon.
+func newMetrics(daemon *Daemon) *Metrics {
+	return &Metrics{
+		daemon: daemon,
+		noticesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lifecycled_notices_received_total",
+			Help: "Number of notices received, by notice type.",
+		}, []string{"notice"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "lifecycled_handler_duration_seconds",
+			Help: "Time taken to execute the handler, by notice type.",
+
+			// Handlers range from seconds to hours for long drains
+			Buckets: prometheus.ExponentialBuckets(1, 2, 15),
+		}, []string{"notice"}),
+		handlerStart: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "lifecycled_hook_to_handler_start_seconds",
+			Help: "Time from the lifecycle hook firing to the handler starting, by notice type.",
+
+			// Around the seconds that draining is expected to start within
+			Buckets: []float64{0.5, 1, 2, 5, 10, 15, 20, 30, 60, 120, 300},
+		}, []string{"notice"}),
+		handlerFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lifecycled_handler_failures_total",
+			Help: "Number of handlers that failed, by notice type and autoscaling group.",
+		}, []string{"notice", "autoscaling_group"}),
+		heartbeatFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "lifecycled_heartbeat_failures_total",
+			Help: "Number of lifecycle action heartbeats that failed.",
+		}),
+		pollErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "lifecycled_sqs_poll_errors_total",
+			Help: "Number of failed attempts to receive messages from the SQS queue.",
+		}),
+		parseFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lifecycled_parse_failures_total",
+			Help: "Number of SQS messages that could not be parsed, by the part (envelope or message).",
+		}, []string{"part"}),
+		awsRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lifecycled_aws_retries_total",
+			Help: "Number of retries of AWS API calls, by operation and whether the call was throttled, failed transiently or had its credentials rejected.",
+		}, []string{"operation", "retry"}),
+		clockSkew: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lifecycled_clock_skew_corrections_total",
+			Help: "Number of latencies that were negative because the clock of the instance is behind AWS and were reported as zero, by the measurement (delivery or hook_to_handler_start).",
+		}, []string{"measurement"}),
+		rateLimitWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "lifecycled_autoscaling_rate_limit_wait_seconds",
+			Help: "Time that autoscaling API calls waited for the rate limit, by operation.",
+
+			// From no wait up to the seconds of a burst of heartbeats in a scale-in
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+		}, []string{"operation"}),
+		sinceLastPoll: prometheus.NewDesc(
+			"lifecycled_seconds_since_last_successful_poll",
+			"Time since the listener last polled successfully, or since it started if it has not.",
+			[]string{"listener"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.noticesReceived.Describe(ch)
+	m.handlerDuration.Describe(ch)
+	m.handlerStart.Describe(ch)
+	m.handlerFailures.Describe(ch)
+	m.heartbeatFailures.Describe(ch)
+	m.pollErrors.Describe(ch)
+	m.parseFailures.Describe(ch)
+	m.awsRetries.Describe(ch)
+	m.clockSkew.Describe(ch)
+	m.rateLimitWait.Describe(ch)
+	ch <- m.sinceLastPoll
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.noticesReceived.Collect(ch)
+	m.handlerDuration.Collect(ch)
+	m.handlerStart.Collect(ch)
+	m.handlerFailures.Collect(ch)
+	m.heartbeatFailures.Collect(ch)
+	m.pollErrors.Collect(ch)
+	m.parseFailures.Collect(ch)
+	m.awsRetries.Collect(ch)
+	m.clockSkew.Collect(ch)
+	m.rateLimitWait.Collect(ch)
+
+	for _, l := range m.daemon.Status().Listeners {
+		last := l.LastPoll
+		if last.Before(l.Since) {
+			last = l.Since
+		}
+		ch <- prometheus.MustNewConstMetric(m.sinceLastPoll, prometheus.GaugeValue, time.Since(last).Seconds(), l.Type)
+	}
+}
+
+func (m *Metrics) noticeReceived(noticeType string) {
+	if m == nil {
+		return
+	}
+	m.noticesReceived.WithLabelValues(noticeType).Inc()
+	atomic.AddInt64(&m.counters.noticesReceived, 1)
+	m.statsd.count("notices_received", "notice:"+noticeType)
+}
+
+// handled records the outcome of the handler. Failures are counted by the autoscaling group
+// (if known) as well as the notice type, for alarms on failures across the instances of a group.
+func (m *Metrics) handled(noticeType, group string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.handlerDuration.WithLabelValues(noticeType).Observe(duration.Seconds())
+	result := "success"
+	if err != nil {
+		m.handlerFailures.WithLabelValues(noticeType, group).Inc()
+		atomic.AddInt64(&m.counters.handlerFailures, 1)
+		tags := []string{"notice:" + noticeType}
+		if group != "" {
+			tags = append(tags, "autoscaling_group:"+group)
+		}
+		m.statsd.count("handler_failures", tags...)
+		result = "failure"
+	}
+	m.statsd.timing("handler_duration", duration, "notice:"+noticeType, "result:"+result)
+}
+
+// handlerStarted records the latency from the lifecycle hook firing to the handler starting,
+// and whether it was corrected for the clock of the instance being behind AWS.
+func (m *Metrics) handlerStarted(noticeType string, latency time.Duration, skewCorrected bool) {
+	if m == nil {
+		return
+	}
+	m.handlerStart.WithLabelValues(noticeType).Observe(latency.Seconds())
+	tags := []string{"notice:" + noticeType}
+	if skewCorrected {
+		m.clockSkewCorrected("hook_to_handler_start")
+		tags = append(tags, "skew_corrected:true")
+	}
+	m.statsd.timing("hook_to_handler_start", latency, tags...)
+}
+
+// clockSkewCorrected records a latency of the measurement that was negative because of clock
+// skew, and was reported as zero.
+func (m *Metrics) clockSkewCorrected(measurement string) {
+	if m == nil {
+		return
+	}
+	m.clockSkew.WithLabelValues(measurement).Inc()
+	m.statsd.count("clock_skew_corrections", "measurement:"+measurement)
+}
+
+func (m *Metrics) heartbeatFailed() {
+	if m == nil {
+		return
+	}
+	m.heartbeatFailures.Inc()
+	atomic.AddInt64(&m.counters.heartbeatFailures, 1)
+	m.statsd.count("heartbeat_failures")
+}
+
+func (m *Metrics) pollFailed() {
+	if m == nil {
+		return
+	}
+	m.pollErrors.Inc()
+	atomic.AddInt64(&m.counters.pollErrors, 1)
+	m.statsd.count("sqs_poll_errors")
+}
+
+func (m *Metrics) parseFailed(part string) {
+	if m == nil {
+		return
+	}
+	m.parseFailures.WithLabelValues(part).Inc()
+	atomic.AddInt64(&m.counters.parseFailures, 1)
+	m.statsd.count("parse_failures", "part:"+part)
+}
+
+// retried records a retry of an AWS API call by the SDK (see retryPolicy).
+func (m *Metrics) retried(operation string, class retryClass) {
+	if m == nil {
+		return
+	}
+	m.awsRetries.WithLabelValues(operation, string(class)).Inc()
+	m.statsd.count("aws_retries", "operation:"+operation, "retry:"+string(class))
+}
+
+// rateLimitWaited records the time that a call of the autoscaling API waited for the rate limit
+// (see rateLimitedClient), which is zero for most calls.
+func (m *Metrics) rateLimitWaited(operation string, wait time.Duration) {
+	if m == nil {
+		return
+	}
+	m.rateLimitWait.WithLabelValues(operation).Observe(wait.Seconds())
+	m.statsd.timing("autoscaling_rate_limit_wait", wait, "operation:"+operation)
+}
+
+// heartbeatSent is only counted for the debug variables.
+func (m *Metrics) heartbeatSent() {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.counters.heartbeatsSent, 1)
+}
+
+// polled is only counted for the debug variables.
+func (m *Metrics) polled() {
+	if m == nil {
+		return
+	}
+	atomic.AddInt64(&m.counters.polls, 1)
+}
+
+// Metrics returns the Prometheus metrics of the daemon, which need to be registered to be exported.
+func (d *Daemon) Metrics() *Metrics {
+	return d.metrics
+}
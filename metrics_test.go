@@ -0,0 +1,89 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// gatherMetrics returns the value of each metric, which is the sample count for histograms.
+func gatherMetrics(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %s", err)
+	}
+	values := make(map[string]float64)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			switch {
+			case m.Counter != nil:
+				values[f.GetName()] += m.Counter.GetValue()
+			case m.Gauge != nil:
+				values[f.GetName()] += m.Gauge.GetValue()
+			case m.Histogram != nil:
+				values[f.GetName()] += float64(m.Histogram.GetSampleCount())
+			}
+		}
+	}
+	return values
+}
+
+func TestDaemonMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, errors.New("unavailable"))
+	expectQueueMessages(sq, sn, nil, []byte(aws.ToString(newSQSMessage(instanceID).Body)))
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	gomock.InOrder(
+		as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, errors.New("throttled")),
+		as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil),
+	)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: 10 * time.Millisecond,
+	}, sq, sn, as, nil, logger)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(daemon.Metrics())
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	if err := daemon.Run(ctx, sleepyHandler{err: errors.New("failed")}); err == nil {
+		t.Fatal("expected the handler to fail")
+	}
+
+	values := gatherMetrics(t, registry)
+	for name, want := range map[string]float64{
+		"lifecycled_notices_received_total":        1,
+		"lifecycled_handler_duration_seconds":      1,
+		"lifecycled_hook_to_handler_start_seconds": 1,
+		"lifecycled_handler_failures_total":        1,
+		"lifecycled_heartbeat_failures_total":      1,
+		"lifecycled_sqs_poll_errors_total":         1,
+	} {
+		if got := values[name]; got != want {
+			t.Errorf("expected %s to be %v and got %v", name, want, got)
+		}
+	}
+	if _, ok := values["lifecycled_seconds_since_last_successful_poll"]; !ok {
+		t.Error("expected the time since the last successful poll to be reported")
+	}
+}
@@ -0,0 +1,55 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/triarius/lifecycled (interfaces: CloudWatchClient)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	cloudwatch "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	gomock "github.com/golang/mock/gomock"
+	reflect "reflect"
+)
+
+// MockCloudWatchClient is a mock of CloudWatchClient interface
+type MockCloudWatchClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockCloudWatchClientMockRecorder
+}
+
+// MockCloudWatchClientMockRecorder is the mock recorder for MockCloudWatchClient
+type MockCloudWatchClientMockRecorder struct {
+	mock *MockCloudWatchClient
+}
+
+// NewMockCloudWatchClient creates a new mock instance
+func NewMockCloudWatchClient(ctrl *gomock.Controller) *MockCloudWatchClient {
+	mock := &MockCloudWatchClient{ctrl: ctrl}
+	mock.recorder = &MockCloudWatchClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCloudWatchClient) EXPECT() *MockCloudWatchClientMockRecorder {
+	return m.recorder
+}
+
+// PutMetricData mocks base method
+func (m *MockCloudWatchClient) PutMetricData(arg0 context.Context, arg1 *cloudwatch.PutMetricDataInput, arg2 ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PutMetricData", varargs...)
+	ret0, _ := ret[0].(*cloudwatch.PutMetricDataOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PutMetricData indicates an expected call of PutMetricData
+func (mr *MockCloudWatchClientMockRecorder) PutMetricData(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutMetricData", reflect.TypeOf((*MockCloudWatchClient)(nil).PutMetricData), varargs...)
+}
@@ -0,0 +1,55 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/triarius/lifecycled (interfaces: EC2Client)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	ec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	gomock "github.com/golang/mock/gomock"
+	reflect "reflect"
+)
+
+// MockEC2Client is a mock of EC2Client interface
+type MockEC2Client struct {
+	ctrl     *gomock.Controller
+	recorder *MockEC2ClientMockRecorder
+}
+
+// MockEC2ClientMockRecorder is the mock recorder for MockEC2Client
+type MockEC2ClientMockRecorder struct {
+	mock *MockEC2Client
+}
+
+// NewMockEC2Client creates a new mock instance
+func NewMockEC2Client(ctrl *gomock.Controller) *MockEC2Client {
+	mock := &MockEC2Client{ctrl: ctrl}
+	mock.recorder = &MockEC2ClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockEC2Client) EXPECT() *MockEC2ClientMockRecorder {
+	return m.recorder
+}
+
+// DescribeTags mocks base method
+func (m *MockEC2Client) DescribeTags(arg0 context.Context, arg1 *ec2.DescribeTagsInput, arg2 ...func(*ec2.Options)) (*ec2.DescribeTagsOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DescribeTags", varargs...)
+	ret0, _ := ret[0].(*ec2.DescribeTagsOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeTags indicates an expected call of DescribeTags
+func (mr *MockEC2ClientMockRecorder) DescribeTags(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeTags", reflect.TypeOf((*MockEC2Client)(nil).DescribeTags), varargs...)
+}
@@ -0,0 +1,55 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/triarius/lifecycled (interfaces: QueueEC2Client)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	ec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	gomock "github.com/golang/mock/gomock"
+	reflect "reflect"
+)
+
+// MockQueueEC2Client is a mock of QueueEC2Client interface
+type MockQueueEC2Client struct {
+	ctrl     *gomock.Controller
+	recorder *MockQueueEC2ClientMockRecorder
+}
+
+// MockQueueEC2ClientMockRecorder is the mock recorder for MockQueueEC2Client
+type MockQueueEC2ClientMockRecorder struct {
+	mock *MockQueueEC2Client
+}
+
+// NewMockQueueEC2Client creates a new mock instance
+func NewMockQueueEC2Client(ctrl *gomock.Controller) *MockQueueEC2Client {
+	mock := &MockQueueEC2Client{ctrl: ctrl}
+	mock.recorder = &MockQueueEC2ClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockQueueEC2Client) EXPECT() *MockQueueEC2ClientMockRecorder {
+	return m.recorder
+}
+
+// DescribeInstances mocks base method
+func (m *MockQueueEC2Client) DescribeInstances(arg0 context.Context, arg1 *ec2.DescribeInstancesInput, arg2 ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DescribeInstances", varargs...)
+	ret0, _ := ret[0].(*ec2.DescribeInstancesOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeInstances indicates an expected call of DescribeInstances
+func (mr *MockQueueEC2ClientMockRecorder) DescribeInstances(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeInstances", reflect.TypeOf((*MockQueueEC2Client)(nil).DescribeInstances), varargs...)
+}
@@ -0,0 +1,115 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/triarius/lifecycled (interfaces: SNSClient)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	sns "github.com/aws/aws-sdk-go-v2/service/sns"
+	gomock "github.com/golang/mock/gomock"
+	reflect "reflect"
+)
+
+// MockSNSClient is a mock of SNSClient interface
+type MockSNSClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockSNSClientMockRecorder
+}
+
+// MockSNSClientMockRecorder is the mock recorder for MockSNSClient
+type MockSNSClientMockRecorder struct {
+	mock *MockSNSClient
+}
+
+// NewMockSNSClient creates a new mock instance
+func NewMockSNSClient(ctrl *gomock.Controller) *MockSNSClient {
+	mock := &MockSNSClient{ctrl: ctrl}
+	mock.recorder = &MockSNSClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSNSClient) EXPECT() *MockSNSClientMockRecorder {
+	return m.recorder
+}
+
+// GetTopicAttributes mocks base method
+func (m *MockSNSClient) GetTopicAttributes(arg0 context.Context, arg1 *sns.GetTopicAttributesInput, arg2 ...func(*sns.Options)) (*sns.GetTopicAttributesOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetTopicAttributes", varargs...)
+	ret0, _ := ret[0].(*sns.GetTopicAttributesOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTopicAttributes indicates an expected call of GetTopicAttributes
+func (mr *MockSNSClientMockRecorder) GetTopicAttributes(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTopicAttributes", reflect.TypeOf((*MockSNSClient)(nil).GetTopicAttributes), varargs...)
+}
+
+// Publish mocks base method
+func (m *MockSNSClient) Publish(arg0 context.Context, arg1 *sns.PublishInput, arg2 ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Publish", varargs...)
+	ret0, _ := ret[0].(*sns.PublishOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Publish indicates an expected call of Publish
+func (mr *MockSNSClientMockRecorder) Publish(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Publish", reflect.TypeOf((*MockSNSClient)(nil).Publish), varargs...)
+}
+
+// Subscribe mocks base method
+func (m *MockSNSClient) Subscribe(arg0 context.Context, arg1 *sns.SubscribeInput, arg2 ...func(*sns.Options)) (*sns.SubscribeOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Subscribe", varargs...)
+	ret0, _ := ret[0].(*sns.SubscribeOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe
+func (mr *MockSNSClientMockRecorder) Subscribe(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockSNSClient)(nil).Subscribe), varargs...)
+}
+
+// Unsubscribe mocks base method
+func (m *MockSNSClient) Unsubscribe(arg0 context.Context, arg1 *sns.UnsubscribeInput, arg2 ...func(*sns.Options)) (*sns.UnsubscribeOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Unsubscribe", varargs...)
+	ret0, _ := ret[0].(*sns.UnsubscribeOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Unsubscribe indicates an expected call of Unsubscribe
+func (mr *MockSNSClientMockRecorder) Unsubscribe(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unsubscribe", reflect.TypeOf((*MockSNSClient)(nil).Unsubscribe), varargs...)
+}
@@ -0,0 +1,252 @@
+package lifecycled
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Events that notifications are sent for.
+const (
+	// NotifyReceived is sent when a notice is received, before the handler is executed.
+	NotifyReceived = "received"
+
+	// NotifyHandlerFailed is sent instead of NotifyCompleted when the handler failed.
+	NotifyHandlerFailed = "handler-failed"
+
+	// NotifyCompleted is sent once the notice has been handled, i.e. the instance has finished draining.
+	NotifyCompleted = "completed"
+
+	// NotifyPollFailing is sent when a listener has failed to poll for longer than the poll
+	// failure threshold, and NotifyPollRecovered when it polls successfully again.
+	NotifyPollFailing   = "poll-failing"
+	NotifyPollRecovered = "poll-recovered"
+)
+
+// Formats of webhook notifications.
+const (
+	NotifyFormatJSON  = "json"
+	NotifyFormatSlack = "slack"
+)
+
+const defaultNotifyTimeout = 5 * time.Second
+
+// Notification is sent to people when a notice is received and handled.
+type Notification struct {
+	Event      string `json:"event"`
+	InstanceID string `json:"instanceId"`
+	RunID      string `json:"runId,omitempty"`
+	Notice     string `json:"notice"`
+	Transition string `json:"transition,omitempty"`
+
+	// Result is the lifecycle action result (CONTINUE or ABANDON), if the action was completed.
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	HandlerDuration float64   `json:"handlerDurationSeconds,omitempty"`
+	Time            time.Time `json:"time"`
+
+	// Listener that is failing to poll, or recovered after Failures consecutive failed polls
+	// over FailingDuration, for the poll notifications.
+	Listener        string  `json:"listener,omitempty"`
+	Failures        int     `json:"failures,omitempty"`
+	FailingDuration float64 `json:"failingDurationSeconds,omitempty"`
+}
+
+// Text describes the notification for people, e.g. in a chat message.
+func (n *Notification) Text() string {
+	notice := n.Notice
+	if n.Transition != "" {
+		notice = fmt.Sprintf("%s (%s)", n.Notice, n.Transition)
+	}
+	switch n.Event {
+	case NotifyReceived:
+		return fmt.Sprintf("%s received a %s notice and is draining", n.InstanceID, notice)
+	case NotifyHandlerFailed:
+		return fmt.Sprintf("%s failed to handle a %s notice after %s: %s", n.InstanceID, notice, seconds(n.HandlerDuration), n.Error)
+	case NotifyPollFailing:
+		return fmt.Sprintf("%s %s listener has failed to poll %d times over %s and can't receive notices: %s", n.InstanceID, n.Listener, n.Failures, seconds(n.FailingDuration), n.Error)
+	case NotifyPollRecovered:
+		return fmt.Sprintf("%s %s listener recovered after failing to poll for %s", n.InstanceID, n.Listener, seconds(n.FailingDuration))
+	default:
+		text := fmt.Sprintf("%s finished draining for a %s notice in %s", n.InstanceID, notice, seconds(n.HandlerDuration))
+		if n.Result != "" {
+			text += fmt.Sprintf(", the lifecycle action was completed with %s", n.Result)
+		}
+		return text
+	}
+}
+
+func seconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(time.Millisecond).String()
+}
+
+// Notifier sends notifications.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// NewWebhookNotifier returns a notifier which posts notifications to the URL, as the JSON
+// Notification or as a Slack message (NotifyFormatSlack). A nil client uses a client with
+// a 10 second timeout.
+func NewWebhookNotifier(url, format string, client *http.Client) *WebhookNotifier {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &WebhookNotifier{url: url, format: format, client: client}
+}
+
+// WebhookNotifier posts notifications to an HTTP endpoint, such as a Slack incoming webhook.
+type WebhookNotifier struct {
+	mu     sync.Mutex
+	url    string
+	format string
+	client *http.Client
+}
+
+// setURL replaces the url of the webhook, e.g. when it was rotated (see Daemon.ReloadSecrets).
+func (p *WebhookNotifier) setURL(url string) {
+	p.mu.Lock()
+	p.url = url
+	p.mu.Unlock()
+}
+
+// slackMessage is the payload of a Slack incoming webhook.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// Notify posts the notification as a JSON request body.
+func (p *WebhookNotifier) Notify(ctx context.Context, n *Notification) error {
+	var payload interface{} = n
+	if p.format == NotifyFormatSlack {
+		payload = &slackMessage{Text: "lifecycled: " + n.Text()}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	webhook := p.url
+	p.mu.Unlock()
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return redactURL(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return redactURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response from webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// redactURL removes the url from the errors of a request, since the url of a webhook is a secret
+// such as that of a Slack incoming webhook.
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s webhook: %w", urlErr.Op, urlErr.Err)
+	}
+	return err
+}
+
+// SetNotifier configures the daemon to send notifications for the events (those for notices
+// if none are given), each within the timeout (defaults to 5s).
+func (d *Daemon) SetNotifier(n Notifier, timeout time.Duration, events ...string) {
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	if len(events) == 0 {
+		events = []string{NotifyReceived, NotifyHandlerFailed, NotifyCompleted}
+	}
+	enabled := make(map[string]bool)
+	for _, e := range events {
+		enabled[e] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifier = n
+	d.notifyTimeout = timeout
+	d.notifyEvents = enabled
+}
+
+// notify sends a notification for the event, if it is enabled. Failing to notify is logged,
+// but never changes the outcome of handling the notice.
+func (d *Daemon) notify(event string, notice TerminationNotice, runID string, handlerDuration time.Duration, handlerErr error, log *logrus.Entry) {
+	d.mu.Lock()
+	notifier, timeout, enabled := d.notifier, d.notifyTimeout, d.notifyEvents[event]
+	d.mu.Unlock()
+	if notifier == nil || !enabled {
+		return
+	}
+
+	n := &Notification{
+		Event:           event,
+		InstanceID:      d.instanceID,
+		RunID:           runID,
+		Notice:          notice.Type(),
+		HandlerDuration: handlerDuration.Seconds(),
+		Time:            time.Now(),
+	}
+	if dn, ok := notice.(DetailedNotice); ok {
+		n.Transition = dn.Transition()
+	}
+	if cr, ok := notice.(completionResulter); ok && event != NotifyReceived {
+		if result, err := cr.completionOutcome(); err == nil {
+			n.Result = result
+		}
+	}
+	if handlerErr != nil {
+		n.Error = handlerErr.Error()
+	}
+	send(notifier, timeout, n, log)
+}
+
+// notifyPoll sends a notification for a poll failure event of the listener, if it is enabled.
+func (d *Daemon) notifyPoll(event string, status ListenerStatus, failingFor time.Duration, log *logrus.Entry) {
+	d.mu.Lock()
+	notifier, timeout, enabled := d.notifier, d.notifyTimeout, d.notifyEvents[event]
+	d.mu.Unlock()
+	if notifier == nil || !enabled {
+		return
+	}
+
+	send(notifier, timeout, &Notification{
+		Event:           event,
+		InstanceID:      d.instanceID,
+		Error:           status.LastError,
+		Time:            time.Now(),
+		Listener:        status.Type,
+		Failures:        status.ConsecutiveFailures,
+		FailingDuration: failingFor.Seconds(),
+	}, log)
+}
+
+// send the notification within the timeout, logging any failure.
+func send(notifier Notifier, timeout time.Duration, n *Notification, log *logrus.Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	log = log.WithField("event", n.Event)
+	if err := notifier.Notify(ctx, n); err != nil {
+		log.WithError(err).Warn("Failed to send notification")
+		return
+	}
+	log.Debug("Sent notification")
+}
@@ -0,0 +1,118 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+// notificationServer records the bodies of the requests that it receives.
+func notificationServer(t *testing.T, status int) (*httptest.Server, func() [][]byte) {
+	var (
+		mu     sync.Mutex
+		bodies [][]byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode notification: %s", err)
+		}
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	return server, func() [][]byte {
+		mu.Lock()
+		defer mu.Unlock()
+		return bodies
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server, bodies := notificationServer(t, http.StatusOK)
+	defer server.Close()
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+	daemon.SetNotifier(lifecycled.NewWebhookNotifier(server.URL, lifecycled.NotifyFormatJSON, server.Client()), time.Second)
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, failingHandler{}); err == nil {
+		t.Fatal("expected handler to fail")
+	}
+
+	var notifications []lifecycled.Notification
+	for _, body := range bodies() {
+		var n lifecycled.Notification
+		if err := json.Unmarshal(body, &n); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if got, want := len(notifications), 2; got != want {
+		t.Fatalf("expected %d notifications and got %d", want, got)
+	}
+	for i, want := range []string{lifecycled.NotifyReceived, lifecycled.NotifyHandlerFailed} {
+		n := notifications[i]
+		if n.Event != want {
+			t.Errorf("expected notification %d to be '%s' and got '%s'", i, want, n.Event)
+		}
+		if n.InstanceID != "i-000000000000" || n.Notice != "fake" {
+			t.Errorf("unexpected notification: %+v", n)
+		}
+	}
+	if got, want := notifications[1].Error, "failed"; got != want {
+		t.Errorf("expected error '%s' and got '%s'", want, got)
+	}
+}
+
+func TestWebhookNotifierSlack(t *testing.T) {
+	server, bodies := notificationServer(t, http.StatusOK)
+	defer server.Close()
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+	daemon.SetNotifier(lifecycled.NewWebhookNotifier(server.URL, lifecycled.NotifyFormatSlack, server.Client()), time.Second, lifecycled.NotifyCompleted)
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, &countingHandler{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Only the enabled event is sent
+	if got, want := len(bodies()), 1; got != want {
+		t.Fatalf("expected %d notifications and got %d", want, got)
+	}
+	var msg struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(bodies()[0], &msg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(msg.Text, "i-000000000000 finished draining for a fake notice") {
+		t.Errorf("unexpected message text: %s", msg.Text)
+	}
+}
+
+func TestNotifyFailureDoesNotChangeOutcome(t *testing.T) {
+	server, bodies := notificationServer(t, http.StatusInternalServerError)
+	defer server.Close()
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+	daemon.SetNotifier(lifecycled.NewWebhookNotifier(server.URL, lifecycled.NotifyFormatJSON, server.Client()), time.Second)
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, &countingHandler{}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if got, want := len(bodies()), 2; got != want {
+		t.Errorf("expected %d attempts to notify and got %d", want, got)
+	}
+}
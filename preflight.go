@@ -0,0 +1,329 @@
+package lifecycled
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Statuses of preflight checks.
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+
+	// CheckSkip is a check that was not performed, because it doesn't apply to the
+	// configuration or can't be performed without side effects.
+	CheckSkip = "skip"
+)
+
+// CheckResult is the outcome of a preflight check.
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// CheckFailed returns true if any of the checks failed.
+func CheckFailed(results []CheckResult) bool {
+	for _, r := range results {
+		if r.Status == CheckFail {
+			return true
+		}
+	}
+	return false
+}
+
+// preflight runs the checks, and keeps what they discover for the checks that follow.
+type preflight struct {
+	config      *Config
+	sqs         SQSClient
+	sns         SNSClient
+	autoscaling AutoscalingClient
+	kms         KMSClient
+	metadata    *imds.Client
+
+	instanceID string
+	group      string
+	hook       string
+	role       string
+	topicKey   string
+	results    []CheckResult
+}
+
+// Preflight checks that lifecycled can run with the configuration on this instance, before
+// it is enabled: that the handlers can be executed, that the instance metadata is reachable,
+// and for the autoscaling listener that the topic exists, that a queue can be created, read and
+// deleted (with a throwaway name) and that the group of the instance has a termination hook.
+// Heartbeats and completing the lifecycle action are checked with a bogus token, as in
+// SelfCheck, and subscribing to the topic is skipped because it would have side effects. The key
+// of an encrypted topic is checked with the KMS client, which can be nil, for a policy that
+// allows the lifecycle hook to publish to the topic (see TopicEncryptionCheck).
+func Preflight(ctx context.Context, config *Config, sqsClient SQSClient, snsClient SNSClient, asgClient AutoscalingClient, kmsClient KMSClient, metadata *imds.Client) []CheckResult {
+	p := &preflight{
+		config:      config,
+		sqs:         sqsClient,
+		sns:         snsClient,
+		autoscaling: asgClient,
+		kms:         kmsClient,
+		metadata:    metadata,
+		instanceID:  config.InstanceID,
+	}
+	p.checkHandlers()
+	p.checkMetadata(ctx)
+	p.checkTopicArn()
+	p.checkTopic(ctx)
+	p.checkQueue(ctx)
+	if p.autoscalingListener("sns-subscribe") {
+		p.skip("sns-subscribe", "subscribing a queue to the topic would deliver notifications to it, it is checked when lifecycled starts")
+	}
+	p.checkGroup(ctx)
+	p.checkHook(ctx)
+	p.checkLifecycleActions(ctx)
+	p.checkTopicEncryption(ctx)
+	return p.results
+}
+
+func (p *preflight) pass(name, format string, args ...interface{}) {
+	p.results = append(p.results, CheckResult{Name: name, Status: CheckPass, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (p *preflight) fail(name, format string, args ...interface{}) {
+	p.results = append(p.results, CheckResult{Name: name, Status: CheckFail, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (p *preflight) skip(name, format string, args ...interface{}) {
+	p.results = append(p.results, CheckResult{Name: name, Status: CheckSkip, Detail: fmt.Sprintf(format, args...)})
+}
+
+// autoscalingListener returns false, after skipping the check, if the autoscaling listener
+// isn't configured.
+func (p *preflight) autoscalingListener(name string) bool {
+	if p.config.SNSTopic == "" {
+		p.skip(name, "the autoscaling listener is not configured (no sns-topic)")
+		return false
+	}
+	if p.config.NoAutoscaling {
+		p.skip(name, "the autoscaling listener is disabled (no-autoscaling)")
+		return false
+	}
+	return true
+}
+
+func (p *preflight) checkHandlers() {
+	paths := []string{}
+	if p.config.Handler != "" {
+		paths = append(paths, p.config.Handler)
+	}
+	noticeTypes := make([]string, 0, len(p.config.Handlers))
+	for noticeType := range p.config.Handlers {
+		noticeTypes = append(noticeTypes, noticeType)
+	}
+	sort.Strings(noticeTypes)
+	for _, noticeType := range noticeTypes {
+		for _, path := range p.config.Handlers[noticeType] {
+			if !contains(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		p.fail("handler", "no handler is configured")
+		return
+	}
+	for _, path := range paths {
+		if IsBuiltinHandler(path) {
+			continue
+		}
+		if err := validateHandlerFile(path); err != nil {
+			p.fail("handler", "%s", err)
+			return
+		}
+	}
+	p.pass("handler", "%s", strings.Join(paths, ", "))
+}
+
+// validateHandlerFile checks that the handler is an executable regular file.
+func validateHandlerFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return NewFileHandler(f).Validate()
+}
+
+func (p *preflight) checkMetadata(ctx context.Context) {
+	id, err := getMetadata(ctx, p.metadata, "instance-id")
+	if err != nil {
+		p.fail("imds", "the instance metadata service is not reachable")
+		return
+	}
+	if p.instanceID == "" {
+		p.instanceID = id
+	}
+	p.pass("imds", "reachable, instance %s", p.instanceID)
+}
+
+func (p *preflight) checkTopicArn() {
+	if !p.autoscalingListener("sns-topic-arn") {
+		return
+	}
+	a, err := arn.Parse(p.config.SNSTopic)
+	if err != nil {
+		p.fail("sns-topic-arn", "%s is not an arn: %s", p.config.SNSTopic, err)
+		return
+	}
+	if a.Service != "sns" || a.Region == "" || a.AccountID == "" || a.Resource == "" {
+		p.fail("sns-topic-arn", "%s is not the arn of an sns topic", p.config.SNSTopic)
+		return
+	}
+	p.pass("sns-topic-arn", "topic %s in %s", a.Resource, a.Region)
+}
+
+func (p *preflight) checkTopic(ctx context.Context) {
+	if !p.autoscalingListener("sns-topic") {
+		return
+	}
+	out, err := p.sns.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{
+		TopicArn: aws.String(p.config.SNSTopic),
+	})
+	if err != nil {
+		p.fail("sns-topic", "%s", err)
+		return
+	}
+	if out != nil {
+		p.topicKey = out.Attributes["KmsMasterKeyId"]
+	}
+	p.pass("sns-topic", "exists and is readable")
+}
+
+func (p *preflight) checkQueue(ctx context.Context) {
+	if !p.autoscalingListener("sqs-queue") {
+		return
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		p.fail("sqs-queue", "%s", err)
+		return
+	}
+	name := "lifecycled-preflight-" + hex.EncodeToString(suffix)
+	out, err := p.sqs.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String(name)})
+	if err != nil {
+		p.fail("sqs-queue", "failed to create a queue: %s", err)
+		return
+	}
+	_, err = p.sqs.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       out.QueueUrl,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	attributes := permissionResult("sqs-queue-attributes", "sqs:GetQueueAttributes", err)
+	if _, err := p.sqs.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: out.QueueUrl}); err != nil {
+		p.fail("sqs-queue", "created %s but failed to delete it: %s", name, err)
+		return
+	}
+	p.pass("sqs-queue", "created and deleted %s", name)
+	p.results = append(p.results, attributes)
+}
+
+func (p *preflight) checkGroup(ctx context.Context) {
+	if !p.autoscalingListener("autoscaling-group") {
+		return
+	}
+	if p.instanceID == "" {
+		p.skip("autoscaling-group", "the instance id is not known")
+		return
+	}
+	out, err := p.autoscaling.DescribeAutoScalingInstances(ctx, &autoscaling.DescribeAutoScalingInstancesInput{
+		InstanceIds: []string{p.instanceID},
+	})
+	if err != nil {
+		p.fail("autoscaling-group", "%s", err)
+		return
+	}
+	if len(out.AutoScalingInstances) == 0 {
+		p.fail("autoscaling-group", "%s is not in an autoscaling group", p.instanceID)
+		return
+	}
+	p.group = aws.ToString(out.AutoScalingInstances[0].AutoScalingGroupName)
+	p.pass("autoscaling-group", "%s", p.group)
+}
+
+func (p *preflight) checkHook(ctx context.Context) {
+	if !p.autoscalingListener("lifecycle-hook") {
+		return
+	}
+	if p.group == "" {
+		p.skip("lifecycle-hook", "the autoscaling group of the instance is not known")
+		return
+	}
+	out, err := p.autoscaling.DescribeLifecycleHooks(ctx, &autoscaling.DescribeLifecycleHooksInput{
+		AutoScalingGroupName: aws.String(p.group),
+	})
+	if err != nil {
+		p.fail("lifecycle-hook", "%s", err)
+		return
+	}
+	var hooks, others []string
+	for _, h := range out.LifecycleHooks {
+		if aws.ToString(h.LifecycleTransition) != terminatingTransition {
+			continue
+		}
+		if aws.ToString(h.NotificationTargetARN) == p.config.SNSTopic {
+			if len(hooks) == 0 {
+				p.role = aws.ToString(h.RoleARN)
+			}
+			hooks = append(hooks, aws.ToString(h.LifecycleHookName))
+		} else {
+			others = append(others, aws.ToString(h.LifecycleHookName))
+		}
+	}
+	switch {
+	case len(hooks) > 0:
+		p.hook = hooks[0]
+		p.pass("lifecycle-hook", "%s", strings.Join(hooks, ", "))
+	case len(others) > 0:
+		p.fail("lifecycle-hook", "the termination hooks of %s (%s) don't publish to %s", p.group, strings.Join(others, ", "), p.config.SNSTopic)
+	default:
+		p.fail("lifecycle-hook", "%s has no termination lifecycle hook", p.group)
+	}
+}
+
+func (p *preflight) checkLifecycleActions(ctx context.Context) {
+	// Both checks are skipped, or neither, since they have the same conditions
+	if heartbeat, complete := p.autoscalingListener("autoscaling-heartbeat"), p.autoscalingListener("autoscaling-complete"); !heartbeat || !complete {
+		return
+	}
+	if p.hook == "" {
+		p.skip("autoscaling-heartbeat", "the termination hook of the instance is not known")
+		p.skip("autoscaling-complete", "the termination hook of the instance is not known")
+		return
+	}
+	heartbeat, complete := lifecycleActionPermissions(ctx, p.autoscaling, p.group, p.hook)
+	p.results = append(p.results,
+		permissionResult("autoscaling-heartbeat", "autoscaling:RecordLifecycleActionHeartbeat", heartbeat),
+		permissionResult("autoscaling-complete", "autoscaling:CompleteLifecycleAction", complete),
+	)
+}
+
+func (p *preflight) checkTopicEncryption(ctx context.Context) {
+	if !p.autoscalingListener(TopicEncryptionCheck) {
+		return
+	}
+	if p.topicKey == "" {
+		p.pass(TopicEncryptionCheck, "the topic is not encrypted")
+		return
+	}
+	p.results = append(p.results, checkTopicKey(ctx, p.kms, p.config.SNSTopic, p.topicKey, p.role))
+}
@@ -0,0 +1,171 @@
+//go:build !windows
+// +build !windows
+
+package lifecycled_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	autoscalingtypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/golang/mock/gomock"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestPreflight(t *testing.T) {
+	topic := "arn:aws:sns:us-east-1:123456789012:lifecycled"
+	instanceID := "i-000000000000"
+
+	tests := []struct {
+		description string
+		topic       string
+		mode        os.FileMode
+		hookTarget  string
+		expected    map[string]string
+	}{
+		{
+			description: "passes, except for a completion that is denied",
+			topic:       topic,
+			mode:        0755,
+			hookTarget:  topic,
+			expected: map[string]string{
+				"handler":               lifecycled.CheckPass,
+				"imds":                  lifecycled.CheckPass,
+				"sns-topic-arn":         lifecycled.CheckPass,
+				"sns-topic":             lifecycled.CheckPass,
+				"sqs-queue":             lifecycled.CheckPass,
+				"sqs-queue-attributes":  lifecycled.CheckPass,
+				"sns-subscribe":         lifecycled.CheckSkip,
+				"autoscaling-group":     lifecycled.CheckPass,
+				"lifecycle-hook":        lifecycled.CheckPass,
+				"autoscaling-heartbeat": lifecycled.CheckPass,
+				"autoscaling-complete":  lifecycled.CheckFail,
+				"sns-topic-encryption":  lifecycled.CheckPass,
+			},
+		},
+		{
+			description: "fails for a handler that is not executable and a hook for another topic",
+			topic:       topic,
+			mode:        0644,
+			hookTarget:  "arn:aws:sns:us-east-1:123456789012:other",
+			expected: map[string]string{
+				"handler":               lifecycled.CheckFail,
+				"imds":                  lifecycled.CheckPass,
+				"sns-topic-arn":         lifecycled.CheckPass,
+				"sns-topic":             lifecycled.CheckPass,
+				"sqs-queue":             lifecycled.CheckPass,
+				"sqs-queue-attributes":  lifecycled.CheckPass,
+				"sns-subscribe":         lifecycled.CheckSkip,
+				"autoscaling-group":     lifecycled.CheckPass,
+				"lifecycle-hook":        lifecycled.CheckFail,
+				"autoscaling-heartbeat": lifecycled.CheckSkip,
+				"autoscaling-complete":  lifecycled.CheckSkip,
+				"sns-topic-encryption":  lifecycled.CheckPass,
+			},
+		},
+		{
+			description: "skips the autoscaling checks without a topic",
+			mode:        0755,
+			expected: map[string]string{
+				"handler":               lifecycled.CheckPass,
+				"imds":                  lifecycled.CheckPass,
+				"sns-topic-arn":         lifecycled.CheckSkip,
+				"sns-topic":             lifecycled.CheckSkip,
+				"sqs-queue":             lifecycled.CheckSkip,
+				"sns-subscribe":         lifecycled.CheckSkip,
+				"autoscaling-group":     lifecycled.CheckSkip,
+				"lifecycle-hook":        lifecycled.CheckSkip,
+				"autoscaling-heartbeat": lifecycled.CheckSkip,
+				"autoscaling-complete":  lifecycled.CheckSkip,
+				"sns-topic-encryption":  lifecycled.CheckSkip,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dir, err := ioutil.TempDir("", "lifecycled")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			f := newHandlerScript(t, dir, "exit 0\n", tc.mode)
+			f.Close()
+
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			if tc.topic != "" {
+				sn.EXPECT().GetTopicAttributes(gomock.Any(), gomock.Any()).Return(nil, nil)
+				sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, input *sqs.CreateQueueInput, _ ...interface{}) (*sqs.CreateQueueOutput, error) {
+						// The queue has a throwaway name rather than the one of the daemon
+						if !strings.HasPrefix(aws.ToString(input.QueueName), "lifecycled-preflight-") {
+							t.Errorf("unexpected queue name: %s", aws.ToString(input.QueueName))
+						}
+						return &sqs.CreateQueueOutput{QueueUrl: aws.String("https://sqs/preflight")}, nil
+					})
+				sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Return(&sqs.GetQueueAttributesOutput{}, nil)
+				sq.EXPECT().DeleteQueue(gomock.Any(), &sqs.DeleteQueueInput{QueueUrl: aws.String("https://sqs/preflight")}).Return(nil, nil)
+				as.EXPECT().DescribeAutoScalingInstances(gomock.Any(), gomock.Any()).Return(&autoscaling.DescribeAutoScalingInstancesOutput{
+					AutoScalingInstances: []autoscalingtypes.AutoScalingInstanceDetails{{AutoScalingGroupName: aws.String("group")}},
+				}, nil)
+				as.EXPECT().DescribeLifecycleHooks(gomock.Any(), gomock.Any()).Return(&autoscaling.DescribeLifecycleHooksOutput{
+					LifecycleHooks: []autoscalingtypes.LifecycleHook{{
+						LifecycleHookName:     aws.String("terminating"),
+						LifecycleTransition:   aws.String("autoscaling:EC2_INSTANCE_TERMINATING"),
+						NotificationTargetARN: aws.String(tc.hookTarget),
+					}},
+				}, nil)
+				if tc.hookTarget == topic {
+					// The lifecycle actions are checked with a token that is rejected once they are authorized
+					as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "ValidationError", Message: "No active Lifecycle Action found with token"})
+					as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized to perform: autoscaling:CompleteLifecycleAction"})
+				}
+			}
+
+			server := newMetadataStub(instanceID, "")
+			defer server.Close()
+
+			metadata := imds.New(imds.Options{
+				Endpoint: server.URL,
+			})
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+			defer cancel()
+
+			results := lifecycled.Preflight(ctx, &lifecycled.Config{
+				SNSTopic: tc.topic,
+				Handler:  f.Name(),
+			}, sq, sn, as, nil, metadata)
+
+			if got, expected := len(results), len(tc.expected); got != expected {
+				t.Fatalf("expected %d results and got %d: %+v", expected, got, results)
+			}
+			failed := false
+			for _, r := range results {
+				if expected := tc.expected[r.Name]; r.Status != expected {
+					t.Errorf("expected %s to %s and got %s: %s", r.Name, expected, r.Status, r.Detail)
+				}
+				failed = failed || r.Status == lifecycled.CheckFail
+			}
+			if got := lifecycled.CheckFailed(results); got != failed {
+				t.Errorf("expected CheckFailed to be %t", failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package lifecycled
+
+import (
+	"sort"
+	"time"
+)
+
+// Presets of the settings for the common deployments of lifecycled.
+const (
+	// PresetSpot only listens for spot interruption notices, polling the metadata service often
+	// enough to report failures well within the two minutes of warning.
+	PresetSpot = "spot"
+
+	// PresetAutoscaling only listens for autoscaling lifecycle hook notices, and sends heartbeats
+	// at an interval derived from the heartbeat timeout of the hook.
+	PresetAutoscaling = "asg"
+
+	// PresetFull listens for both, and coalesces the notices of an instance that is interrupted
+	// while its autoscaling group terminates it.
+	PresetFull = "full"
+)
+
+// presetSetting is a setting of a preset, with its key in the configuration file.
+type presetSetting struct {
+	key   string
+	apply func(c *Config)
+}
+
+var presets = map[string][]presetSetting{
+	PresetSpot: {
+		{"spot-listener", func(c *Config) { c.SpotListener = true }},
+		{"spot-listener-interval", func(c *Config) { c.SpotListenerInterval = 5 * time.Second }},
+		{"poll-failure-threshold", func(c *Config) { c.PollFailureThreshold = time.Minute }},
+	},
+	PresetAutoscaling: {
+		{"spot-listener", func(c *Config) { c.SpotListener = false }},
+		{"autoscaling-heartbeat-interval", func(c *Config) { c.AutoscalingHeartbeatInterval = 0 }},
+		{"poll-summary-interval", func(c *Config) { c.PollSummaryInterval = 5 * time.Minute }},
+		{"poll-failure-threshold", func(c *Config) { c.PollFailureThreshold = 10 * time.Minute }},
+	},
+	PresetFull: {
+		{"spot-listener", func(c *Config) { c.SpotListener = true }},
+		{"spot-listener-interval", func(c *Config) { c.SpotListenerInterval = 5 * time.Second }},
+		{"autoscaling-heartbeat-interval", func(c *Config) { c.AutoscalingHeartbeatInterval = 0 }},
+		{"poll-summary-interval", func(c *Config) { c.PollSummaryInterval = 5 * time.Minute }},
+		{"poll-failure-threshold", func(c *Config) { c.PollFailureThreshold = 2 * time.Minute }},
+		{"dedup-window", func(c *Config) { c.DedupWindow = 30 * time.Second }},
+	},
+}
+
+// Presets are the names of the presets, in the order of the listeners they enable.
+var Presets = []string{PresetSpot, PresetAutoscaling, PresetFull}
+
+// ApplyPreset sets the Preset and its settings on the configuration, except for the keep keys
+// (e.g. the settings in the configuration file), and returns the keys of the settings that
+// were applied. The autoscaling listener still needs the sns-topic (see Validate).
+func (c *Config) ApplyPreset(name string, keep []string) ([]string, error) {
+	if name == "" {
+		return nil, nil
+	}
+	settings, ok := presets[name]
+	if !ok {
+		return nil, invalid("preset", PresetAutoscaling, "must be %s, %s or %s, got %q", PresetSpot, PresetAutoscaling, PresetFull, name)
+	}
+	c.Preset = name
+	var applied []string
+	for _, s := range settings {
+		if contains(keep, s.key) {
+			continue
+		}
+		s.apply(c)
+		applied = append(applied, s.key)
+	}
+	sort.Strings(applied)
+	return applied, nil
+}
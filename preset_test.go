@@ -0,0 +1,44 @@
+package lifecycled_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/triarius/lifecycled"
+)
+
+func TestApplyPreset(t *testing.T) {
+	config := lifecycled.DefaultConfig()
+	config.DedupWindow = time.Minute
+
+	applied, err := config.ApplyPreset(lifecycled.PresetFull, []string{"dedup-window"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"autoscaling-heartbeat-interval", "poll-failure-threshold", "poll-summary-interval", "spot-listener", "spot-listener-interval"}
+	if !reflect.DeepEqual(applied, expected) {
+		t.Errorf("expected the preset to apply %v and got %v", expected, applied)
+	}
+	if got, want := config.Preset, lifecycled.PresetFull; got != want {
+		t.Errorf("expected preset %q and got %q", want, got)
+	}
+	if got, want := config.DedupWindow, time.Minute; got != want {
+		t.Errorf("expected the dedup window from the file (%s) to be kept and got %s", want, got)
+	}
+	if got, want := config.PollFailureThreshold, 2*time.Minute; got != want {
+		t.Errorf("expected poll failure threshold %s and got %s", want, got)
+	}
+
+	config = lifecycled.DefaultConfig()
+	if _, err := config.ApplyPreset(lifecycled.PresetAutoscaling, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.SpotListener {
+		t.Error("expected the asg preset to disable the spot listener")
+	}
+
+	if _, err := lifecycled.DefaultConfig().ApplyPreset("ecs", nil); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+}
@@ -0,0 +1,90 @@
+package lifecycled
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Routes of the requests to the instance metadata service (see ProxyInfo).
+const (
+	IMDSDirect = "direct"
+	IMDSProxy  = "proxy"
+)
+
+// proxyFromEnvironment returns the proxy of a request from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// (or their lowercase names). Unlike http.ProxyFromEnvironment, the environment is read when
+// the client is created rather than once per process.
+func proxyFromEnvironment() func(*http.Request) (*url.URL, error) {
+	proxy := httpproxy.FromEnvironment().ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// newIMDSHTTPClient returns the HTTP client of the instance metadata service, which dials it
+// directly unless IMDSProxy is set, since an egress proxy for the AWS APIs can't reach the
+// link-local address of the service on the instance. It is a BuildableClient so that the
+// metadata client adds its own timeouts, which fail fast off EC2.
+func newIMDSHTTPClient(c *Config) *awshttp.BuildableClient {
+	return awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+		t.Proxy = nil
+		if c.IMDSProxy {
+			t.Proxy = proxyFromEnvironment()
+		}
+	})
+}
+
+// NewIMDSClient returns the client of the instance metadata service with the AWS configuration,
+// which sends its requests directly or through the proxy as configured (see Config.IMDSProxy).
+func NewIMDSClient(cfg aws.Config, c *Config, optFns ...func(*imds.Options)) *imds.Client {
+	optFns = append([]func(*imds.Options){func(o *imds.Options) {
+		o.HTTPClient = newIMDSHTTPClient(c)
+	}}, optFns...)
+	return imds.NewFromConfig(cfg, optFns...)
+}
+
+// ProxyInfo is the effective proxy configuration of the AWS APIs and the instance metadata
+// service, with the credentials of the proxies redacted.
+type ProxyInfo struct {
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	NoProxy    string `json:"noProxy,omitempty"`
+
+	// IMDS is how the requests to the instance metadata service are sent: IMDSDirect or IMDSProxy.
+	IMDS string `json:"imds"`
+}
+
+// NewProxyInfo returns the proxy configuration of the environment, or nil if no proxy is set.
+func NewProxyInfo(c *Config) *ProxyInfo {
+	env := httpproxy.FromEnvironment()
+	if env.HTTPProxy == "" && env.HTTPSProxy == "" {
+		return nil
+	}
+	info := &ProxyInfo{
+		HTTPProxy:  redactProxy(env.HTTPProxy),
+		HTTPSProxy: redactProxy(env.HTTPSProxy),
+		NoProxy:    env.NoProxy,
+		IMDS:       IMDSDirect,
+	}
+	if c.IMDSProxy {
+		info.IMDS = IMDSProxy
+	}
+	return info
+}
+
+// redactProxy redacts the password of the proxy URL, if it has one.
+func redactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	return u.String()
+}
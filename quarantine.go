@@ -0,0 +1,94 @@
+package lifecycled
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Parts of an SQS message that fail to parse, or to be verified (see SignatureVerifier).
+const (
+	ParseFailureEnvelope  = "envelope"
+	ParseFailureMessage   = "message"
+	ParseFailureSignature = "signature"
+)
+
+// maxCapturedBody is the number of bytes of a message that fails to parse which are included
+// in the log entry. Quarantined messages are written in full.
+const maxCapturedBody = 4 << 10
+
+// quarantineFilePrefix is the prefix of the quarantined messages, which are the only files
+// in the directory that are removed to keep it within the limit.
+const quarantineFilePrefix = "lifecycled-"
+
+// capturedBody returns the body of a message that failed to parse for a log entry, with the
+// action tokens masked and truncated to maxCapturedBody.
+func capturedBody(body []byte) string {
+	body = redactActionTokens(body)
+	if len(body) <= maxCapturedBody {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", body[:maxCapturedBody], len(body)-maxCapturedBody)
+}
+
+// quarantine writes the body of a message that failed to parse to a timestamped file in the
+// directory, with the action tokens masked, and removes the oldest quarantined messages beyond
+// keep (unlimited if zero). It returns the path of the file.
+func quarantine(dir string, keep int, kind string, body []byte, now time.Time) (string, error) {
+	name := quarantineFilePrefix + now.UTC().Format("20060102T150405.000000000Z") + "-" + kind + ".json"
+	path := filepath.Join(dir, name)
+	if err := writeFileAtomic(path, redactActionTokens(body), 0600); err != nil {
+		return "", err
+	}
+	if keep <= 0 {
+		return path, nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return path, err
+	}
+	var quarantined []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasPrefix(f.Name(), quarantineFilePrefix) && strings.HasSuffix(f.Name(), ".json") {
+			quarantined = append(quarantined, f.Name())
+		}
+	}
+	// The names sort by the time that the messages were quarantined
+	sort.Strings(quarantined)
+	for len(quarantined) > keep {
+		if err := os.Remove(filepath.Join(dir, quarantined[0])); err != nil && !os.IsNotExist(err) {
+			return path, err
+		}
+		quarantined = quarantined[1:]
+	}
+	return path, nil
+}
+
+// parseFailed logs the body of a message that failed to parse with the message, quarantines it
+// if configured, and counts the failure.
+func (l *AutoscalingListener) parseFailed(kind, msg string, body []byte, err error, polls *pollSummary, log *logrus.Entry) {
+	polls.parseFailures++
+	l.options.metrics.parseFailed(kind)
+
+	log = log.WithError(err).WithFields(logrus.Fields{
+		"part": kind,
+		"body": capturedBody(body),
+		"size": len(body),
+	})
+	if dir := l.options.QuarantineDir; dir != "" {
+		path, qerr := quarantine(dir, l.options.QuarantineKeep, kind, body, time.Now())
+		if qerr != nil {
+			log.WithField("quarantineError", qerr.Error()).Warn("Failed to quarantine message")
+		} else {
+			log = log.WithField("quarantined", path)
+		}
+	}
+	log.Error(msg)
+}
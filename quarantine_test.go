@@ -0,0 +1,98 @@
+package lifecycled_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestAutoscalingListenerQuarantine(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	instanceID := "i-000000000000"
+	handled := make(chan struct{})
+	close(handled)
+
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessages(sq, sn, handled,
+		[]byte(`{"Type": "Notification", "Message": "{\"LifecycleActionToken\":\"token-0123456789\"`),
+		[]byte(`{"Type": "Notification", "Message": "{\"LifecycleActionToken\":\"token-9876543210\""}`),
+		[]byte(aws.ToString(newSQSMessage(instanceID).Body)),
+	)
+
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:     instanceID,
+		SNSTopic:       "topic",
+		QuarantineDir:  dir,
+		QuarantineKeep: 1,
+	}, sq, sn, nil, nil, logger)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(daemon.Metrics())
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	// The messages that fail to parse are skipped
+	if _, err := daemon.Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var failures []string
+	for _, e := range hook.AllEntries() {
+		if !strings.HasPrefix(e.Message, "Failed to unmarshal") {
+			continue
+		}
+		failures = append(failures, e.Data["part"].(string))
+		body := e.Data["body"].(string)
+		if strings.Contains(body, "token-") || !strings.Contains(body, "...") {
+			t.Errorf("expected the action token to be masked in the body and got %s", body)
+		}
+		if _, ok := e.Data["quarantined"]; !ok {
+			t.Error("expected the path of the quarantined message to be logged")
+		}
+	}
+	if got, want := strings.Join(failures, ","), lifecycled.ParseFailureEnvelope+","+lifecycled.ParseFailureMessage; got != want {
+		t.Errorf("expected parse failures of the %s and got %s", want, got)
+	}
+
+	// Only the newest quarantined message is kept
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0], "-message.json") {
+		t.Fatalf("expected only the newest message to be quarantined and got %v", files)
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"LifecycleActionToken":"...543210"`; got != want {
+		t.Errorf("expected the quarantined message to be '%s' and got '%s'", want, got)
+	}
+
+	if got := gatherMetrics(t, registry)["lifecycled_parse_failures_total"]; got != 2 {
+		t.Errorf("expected 2 parse failures to be counted and got %v", got)
+	}
+}
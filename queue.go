@@ -2,17 +2,19 @@ package lifecycled
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/service/sns"
-	"github.com/aws/aws-sdk-go/service/sns/snsiface"
-	"github.com/aws/aws-sdk-go/service/sqs"
-	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -37,13 +39,29 @@ const (
 `
 )
 
-// SQSClient for testing purposes
+// SQSClient is the subset of the SQS API that lifecycled uses, which *sqs.Client implements.
+//
 //go:generate mockgen -destination=mocks/mock_sqs_client.go -package=mocks github.com/triarius/lifecycled SQSClient
-type SQSClient sqsiface.SQSAPI
+type SQSClient interface {
+	CreateQueue(context.Context, *sqs.CreateQueueInput, ...func(*sqs.Options)) (*sqs.CreateQueueOutput, error)
+	GetQueueAttributes(context.Context, *sqs.GetQueueAttributesInput, ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+	ReceiveMessage(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(context.Context, *sqs.DeleteMessageInput, ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	DeleteQueue(context.Context, *sqs.DeleteQueueInput, ...func(*sqs.Options)) (*sqs.DeleteQueueOutput, error)
+	GetQueueUrl(context.Context, *sqs.GetQueueUrlInput, ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
+	SetQueueAttributes(context.Context, *sqs.SetQueueAttributesInput, ...func(*sqs.Options)) (*sqs.SetQueueAttributesOutput, error)
+	ListQueues(context.Context, *sqs.ListQueuesInput, ...func(*sqs.Options)) (*sqs.ListQueuesOutput, error)
+}
 
-// SNSClient for testing purposes
+// SNSClient is the subset of the SNS API that lifecycled uses, which *sns.Client implements.
+//
 //go:generate mockgen -destination=mocks/mock_sns_client.go -package=mocks github.com/triarius/lifecycled SNSClient
-type SNSClient snsiface.SNSAPI
+type SNSClient interface {
+	Subscribe(context.Context, *sns.SubscribeInput, ...func(*sns.Options)) (*sns.SubscribeOutput, error)
+	Unsubscribe(context.Context, *sns.UnsubscribeInput, ...func(*sns.Options)) (*sns.UnsubscribeOutput, error)
+	Publish(context.Context, *sns.PublishInput, ...func(*sns.Options)) (*sns.PublishOutput, error)
+	GetTopicAttributes(context.Context, *sns.GetTopicAttributesInput, ...func(*sns.Options)) (*sns.GetTopicAttributesOutput, error)
+}
 
 // Queue manages the SQS queue and SNS subscription.
 type Queue struct {
@@ -55,6 +73,18 @@ type Queue struct {
 
 	sqsClient SQSClient
 	snsClient SNSClient
+
+	// metrics of the daemon that the queue belongs to, if any
+	metrics *Metrics
+
+	// log of the listener that the queue belongs to, which the retries of the calls are logged to
+	log *logrus.Entry
+
+	// tags of the queue when it is created
+	tags map[string]string
+
+	// callTimeout bounds each attempt of the calls, see SetCallTimeout
+	callTimeout time.Duration
 }
 
 // NewQueue returns a new... Queue.
@@ -67,85 +97,214 @@ func NewQueue(queueName, topicArn string, sqsClient SQSClient, snsClient SNSClie
 	}
 }
 
-// Create the SQS queue.
-func (q *Queue) Create() error {
-	out, err := q.sqsClient.CreateQueue(&sqs.CreateQueueInput{
+// SetTags sets the tags that the queue is created with, which needs sqs:TagQueue. An existing
+// queue (e.g. with --no-cleanup) keeps its tags.
+func (q *Queue) SetTags(tags map[string]string) {
+	q.tags = tags
+}
+
+// SetCallTimeout bounds each attempt of the AWS API calls of the queue, with the wait time of
+// the long-polls on top, so that an attempt that hangs is retried. Zero disables the timeout.
+func (q *Queue) SetCallTimeout(timeout time.Duration) {
+	q.callTimeout = timeout
+}
+
+// immutableQueueAttributes are the attributes that can only be set when a queue is created, with
+// their values for a queue that is created by lifecycled.
+var immutableQueueAttributes = map[string]string{
+	string(types.QueueAttributeNameFifoQueue): "false",
+}
+
+// Create the SQS queue. If a queue with the same name was left with other attributes (e.g. by an
+// older version with --no-cleanup), its attributes are updated to match, which fails only if an
+// attribute that can't be changed differs.
+func (q *Queue) Create(ctx context.Context) error {
+	input := &sqs.CreateQueueInput{
 		QueueName: aws.String(q.name),
-		Attributes: map[string]*string{
-			"Policy":                        aws.String(fmt.Sprintf(queuePolicy, q.topicArn)),
-			"ReceiveMessageWaitTimeSeconds": aws.String(strconv.Itoa(longPollingWaitTimeSeconds)),
+		Attributes: map[string]string{
+			"Policy":                        fmt.Sprintf(queuePolicy, q.topicArn),
+			"ReceiveMessageWaitTimeSeconds": strconv.Itoa(longPollingWaitTimeSeconds),
 		},
+	}
+	if len(q.tags) > 0 {
+		input.Tags = q.tags
+	}
+	out, err := q.sqsClient.CreateQueue(ctx, input, sqsRetryer(newRetryer("CreateQueue", q.log, q.metrics, q.timeouts())))
+	if err != nil {
+		if !isQueueExists(err) {
+			return wrapError(ErrQueueCreate, err)
+		}
+		if err := q.updateExisting(ctx, input.Attributes); err != nil {
+			return wrapError(ErrQueueCreate, err)
+		}
+		return nil
+	}
+	q.url = aws.ToString(out.QueueUrl)
+	return nil
+}
+
+// isQueueExists returns true if a queue couldn't be created because one with the same name
+// exists with different attributes.
+func isQueueExists(err error) bool {
+	e, ok := apiError(err)
+	if !ok {
+		return false
+	}
+	switch e.ErrorCode() {
+	case "QueueAlreadyExists", "QueueNameExists", "AWS.SimpleQueueService.QueueAlreadyExists":
+		return true
+	}
+	return false
+}
+
+// updateExisting sets the attributes of the existing queue that differ from the attributes, and
+// returns an error naming the first immutable attribute that differs.
+func (q *Queue) updateExisting(ctx context.Context, attributes map[string]string) error {
+	urlOut, err := q.sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(q.name)})
+	if err != nil {
+		return fmt.Errorf("failed to get url of existing queue: %w", err)
+	}
+	url := aws.ToString(urlOut.QueueUrl)
+	out, err := q.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameAll},
+		QueueUrl:       aws.String(url),
 	})
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to get attributes of existing queue: %w", err)
 	}
-	q.url = aws.StringValue(out.QueueUrl)
+
+	for _, name := range attributeNames(immutableQueueAttributes) {
+		want := immutableQueueAttributes[name]
+		if v, ok := attributes[name]; ok {
+			want = v
+		}
+		got, ok := out.Attributes[name]
+		if !ok {
+			got = immutableQueueAttributes[name]
+		}
+		if got != want {
+			return fmt.Errorf("existing queue has %s %s, which can't be changed to %s", name, got, want)
+		}
+	}
+
+	changed := map[string]string{}
+	for name, want := range attributes {
+		if _, ok := immutableQueueAttributes[name]; ok || queueAttributeEqual(name, out.Attributes[name], want) {
+			continue
+		}
+		changed[name] = want
+	}
+	if len(changed) > 0 {
+		if _, err := q.sqsClient.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+			QueueUrl:   aws.String(url),
+			Attributes: changed,
+		}); err != nil {
+			return fmt.Errorf("failed to update attributes of existing queue: %w", err)
+		}
+		if q.log != nil {
+			q.log.WithField("attributes", attributeNames(changed)).Info("Updated attributes of existing queue")
+		}
+	}
+
+	q.url = url
+	q.arn = out.Attributes[string(types.QueueAttributeNameQueueArn)]
 	return nil
 }
 
+func attributeNames(attributes map[string]string) []string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// queueAttributeEqual returns true if the values of the attribute are the same, comparing the
+// policy as JSON since SQS doesn't return it as it was set.
+func queueAttributeEqual(name, a, b string) bool {
+	if name != string(types.QueueAttributeNamePolicy) {
+		return a == b
+	}
+	var x, y interface{}
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(x, y)
+}
+
 // GetArn for the SQS queue.
-func (q *Queue) getArn() (string, error) {
+func (q *Queue) getArn(ctx context.Context) (string, error) {
 	if q.arn == "" {
-		out, err := q.sqsClient.GetQueueAttributes(&sqs.GetQueueAttributesInput{
-			AttributeNames: aws.StringSlice([]string{"QueueArn"}),
+		out, err := q.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
 			QueueUrl:       aws.String(q.url),
 		})
 		if err != nil {
 			return "", err
 		}
-		arn, ok := out.Attributes["QueueArn"]
+		arn, ok := out.Attributes[string(types.QueueAttributeNameQueueArn)]
 		if !ok {
 			return "", errors.New("no attribute QueueArn")
 		}
-		q.arn = aws.StringValue(arn)
+		q.arn = arn
 	}
 	return q.arn, nil
 }
 
 // Subscribe the queue to an SNS topic
-func (q *Queue) Subscribe() error {
-	arn, err := q.getArn()
+func (q *Queue) Subscribe(ctx context.Context) error {
+	arn, err := q.getArn(ctx)
 	if err != nil {
-		return err
+		return wrapError(ErrSubscribe, err)
 	}
-	out, err := q.snsClient.Subscribe(&sns.SubscribeInput{
+	out, err := q.snsClient.Subscribe(ctx, &sns.SubscribeInput{
 		TopicArn: aws.String(q.topicArn),
 		Protocol: aws.String("sqs"),
 		Endpoint: aws.String(arn),
-	})
+	}, snsRetryer(newRetryer("Subscribe", q.log, q.metrics, q.timeouts())))
 	if err != nil {
-		return err
+		return wrapError(ErrSubscribe, err)
 	}
-	q.subscriptionArn = aws.StringValue(out.SubscriptionArn)
+	q.subscriptionArn = aws.ToString(out.SubscriptionArn)
 	return nil
 }
 
 // GetMessages long polls for messages from the SQS queue.
-func (q *Queue) GetMessages(ctx context.Context) ([]*sqs.Message, error) {
-	out, err := q.sqsClient.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+func (q *Queue) GetMessages(ctx context.Context) ([]types.Message, error) {
+	out, err := q.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
 		QueueUrl:            aws.String(q.url),
-		MaxNumberOfMessages: aws.Int64(1),
-		WaitTimeSeconds:     aws.Int64(longPollingWaitTimeSeconds),
-		VisibilityTimeout:   aws.Int64(0),
-	})
+		MaxNumberOfMessages: 1,
+		WaitTimeSeconds:     longPollingWaitTimeSeconds,
+		VisibilityTimeout:   0,
+		AttributeNames:      []types.QueueAttributeName{types.QueueAttributeName(types.MessageSystemAttributeNameSentTimestamp)},
+	}, sqsRetryer(newRetryer("ReceiveMessage", q.log, q.metrics, q.timeouts())))
 	if err != nil {
 		// Ignore error if the context was cancelled (i.e. we are shutting down)
-		if e, ok := err.(awserr.Error); ok && e.Code() == request.CanceledErrorCode {
+		if isCanceled(err) {
 			return nil, nil
 		}
-		return nil, err
+		q.metrics.polled()
+		q.metrics.pollFailed()
+		return nil, wrapError(ErrReceive, err)
 	}
+	q.metrics.polled()
 	return out.Messages, nil
 }
 
+// timeouts returns the timeouts of the attempts of the calls.
+func (q *Queue) timeouts() callTimeouts {
+	return callTimeouts{call: q.callTimeout}
+}
+
 // DeleteMessage from the queue.
 func (q *Queue) DeleteMessage(ctx context.Context, receiptHandle string) error {
-	_, err := q.sqsClient.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+	_, err := q.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
 		QueueUrl:      aws.String(q.url),
 		ReceiptHandle: aws.String(receiptHandle),
-	})
+	}, sqsRetryer(newRetryer("DeleteMessage", q.log, q.metrics, q.timeouts())))
 	if err != nil {
-		if e, ok := err.(awserr.Error); ok && e.Code() == request.CanceledErrorCode {
+		if isCanceled(err) {
 			return nil
 		}
 		return err
@@ -154,23 +313,28 @@ func (q *Queue) DeleteMessage(ctx context.Context, receiptHandle string) error {
 }
 
 // Unsubscribe the queue from the SNS topic.
-func (q *Queue) Unsubscribe() error {
-	_, err := q.snsClient.Unsubscribe(&sns.UnsubscribeInput{
+func (q *Queue) Unsubscribe(ctx context.Context) error {
+	_, err := q.snsClient.Unsubscribe(ctx, &sns.UnsubscribeInput{
 		SubscriptionArn: aws.String(q.subscriptionArn),
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	q.subscriptionArn = ""
+	return nil
 }
 
 // Delete the SQS queue.
-func (q *Queue) Delete() error {
-	_, err := q.sqsClient.DeleteQueue(&sqs.DeleteQueueInput{
+func (q *Queue) Delete(ctx context.Context) error {
+	_, err := q.sqsClient.DeleteQueue(ctx, &sqs.DeleteQueueInput{
 		QueueUrl: aws.String(q.url),
 	})
 	if err != nil {
 		// Ignore error if queue does not exist (which is what we want)
-		if e, ok := err.(awserr.Error); !ok || e.Code() != sqs.ErrCodeQueueDoesNotExist {
+		if !isQueueNotFound(err) {
 			return err
 		}
 	}
+	q.url, q.arn = "", ""
 	return nil
 }
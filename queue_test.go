@@ -0,0 +1,116 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/golang/mock/gomock"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestCreateExistingQueue(t *testing.T) {
+	// SQS returns the policy without the whitespace that it was set with
+	policy := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"sqs:SendMessage","Resource":"*","Condition":{"ArnEquals":{"aws:SourceArn":"topic"}}}]}`
+
+	tests := []struct {
+		description string
+		attributes  map[string]string
+		expected    map[string]string
+		expectError string
+	}{
+		{
+			description: "matching",
+			attributes: map[string]string{
+				"Policy":                        policy,
+				"ReceiveMessageWaitTimeSeconds": "20",
+			},
+		},
+		{
+			description: "mismatched mutable",
+			attributes: map[string]string{
+				"Policy":                        `{"Version":"2012-10-17","Statement":[]}`,
+				"ReceiveMessageWaitTimeSeconds": "0",
+			},
+			expected: map[string]string{
+				"ReceiveMessageWaitTimeSeconds": "20",
+			},
+		},
+		{
+			description: "mismatched immutable",
+			attributes: map[string]string{
+				"FifoQueue":                     "true",
+				"Policy":                        policy,
+				"ReceiveMessageWaitTimeSeconds": "20",
+			},
+			expectError: "FifoQueue",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			url := "https://sqs.us-east-1.amazonaws.com/123456789012/queue"
+			sq := mocks.NewMockSQSClient(ctrl)
+			sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, &sqstypes.QueueNameExists{Message: aws.String("queue exists")})
+			sq.EXPECT().GetQueueUrl(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueUrlOutput{QueueUrl: aws.String(url)}, nil)
+
+			attributes := map[string]string{"QueueArn": "arn"}
+			for k, v := range tc.attributes {
+				attributes[k] = v
+			}
+			sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{Attributes: attributes}, nil)
+
+			if len(tc.expected) > 0 {
+				sq.EXPECT().SetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+					func(_ context.Context, input *sqs.SetQueueAttributesInput, _ ...func(*sqs.Options)) (*sqs.SetQueueAttributesOutput, error) {
+						if got := aws.ToString(input.QueueUrl); got != url {
+							t.Errorf("expected the attributes of %s to be set and got %s", url, got)
+						}
+						for k, v := range tc.expected {
+							if got := input.Attributes[k]; got != v {
+								t.Errorf("expected %s to be set to %s and got %s", k, v, got)
+							}
+						}
+						return &sqs.SetQueueAttributesOutput{}, nil
+					},
+				)
+			}
+
+			queue := lifecycled.NewQueue("queue", "topic", sq, mocks.NewMockSNSClient(ctrl))
+			err := queue.Create(context.TODO())
+			if tc.expectError != "" {
+				if !errors.Is(err, lifecycled.ErrQueueCreate) {
+					t.Fatalf("expected a queue create error and got: %v", err)
+				}
+				if !strings.Contains(err.Error(), tc.expectError) {
+					t.Errorf("expected the error to name %s and got: %s", tc.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			// The messages are deleted from the existing queue
+			sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+				func(_ context.Context, input *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+					if got := aws.ToString(input.QueueUrl); got != url {
+						t.Errorf("expected the existing queue %s to be used and got %s", url, got)
+					}
+					return &sqs.DeleteMessageOutput{}, nil
+				},
+			)
+			if err := queue.DeleteMessage(context.TODO(), "handle"); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
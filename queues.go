@@ -0,0 +1,287 @@
+package lifecycled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// DefaultQueueAPIRate is the default number of API requests per second of ListQueues and
+// PruneQueues, which is well below the limits of SQS and EC2 so that sweeping an account
+// with thousands of queues isn't throttled, and doesn't throttle the daemons in the account.
+const DefaultQueueAPIRate = 20
+
+// InstanceNotFound is the instance state of queues whose instance doesn't exist (any more).
+const InstanceNotFound = "not-found"
+
+// describeInstancesBatch is the number of instance ids per DescribeInstances filter.
+const describeInstancesBatch = 200
+
+// queueNamePattern matches the names of the queues of the daemons, which are named after the instance.
+var queueNamePattern = regexp.MustCompile(`^lifecycled-(i-[0-9a-f]+)$`)
+
+// QueueInfo describes a queue that was created by lifecycled.
+type QueueInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// InstanceID and InstanceState of the instance that the queue is named after, which are empty
+	// for other queues, such as the throwaway queues of preflight checks.
+	InstanceID    string `json:"instanceId,omitempty"`
+	InstanceState string `json:"instanceState,omitempty"`
+
+	CreatedAt        time.Time `json:"createdAt"`
+	Messages         int64     `json:"messages"`
+	MessagesInFlight int64     `json:"messagesInFlight"`
+}
+
+// Age of the queue at the time.
+func (q QueueInfo) Age(now time.Time) time.Duration {
+	return now.Sub(q.CreatedAt)
+}
+
+// Running returns true if the instance of the queue is pending or running, and may be using it.
+func (q QueueInfo) Running() bool {
+	state := ec2types.InstanceStateName(q.InstanceState)
+	return state == ec2types.InstanceStateNamePending || state == ec2types.InstanceStateNameRunning
+}
+
+// QueueEC2Client describes the instances of the queues, for testing purposes.
+//
+//go:generate mockgen -destination=mocks/mock_queue_ec2_client.go -package=mocks github.com/triarius/lifecycled QueueEC2Client
+type QueueEC2Client interface {
+	DescribeInstances(context.Context, *ec2.DescribeInstancesInput, ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+}
+
+// throttle limits a sweep to a number of API requests per second.
+type throttle struct {
+	ticker *time.Ticker
+}
+
+func newThrottle(rate int) *throttle {
+	if rate <= 0 {
+		rate = DefaultQueueAPIRate
+	}
+	return &throttle{ticker: time.NewTicker(time.Second / time.Duration(rate))}
+}
+
+// wait for the next request, or returns the error of the context if it is done first.
+func (t *throttle) wait(ctx context.Context) error {
+	select {
+	case <-t.ticker.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *throttle) stop() {
+	t.ticker.Stop()
+}
+
+// ListQueues lists the queues in the account and region whose names start with lifecycled-, with
+// their age and approximate message counts, and the state of the instances that they belong to.
+// It makes at most rate (or DefaultQueueAPIRate) API requests per second. Requires
+// sqs:ListQueues, sqs:GetQueueAttributes and ec2:DescribeInstances.
+func ListQueues(ctx context.Context, sqsClient SQSClient, ec2Client QueueEC2Client, rate int) ([]QueueInfo, error) {
+	t := newThrottle(rate)
+	defer t.stop()
+
+	var urls []string
+	input := &sqs.ListQueuesInput{QueueNamePrefix: aws.String("lifecycled-"), MaxResults: aws.Int32(1000)}
+	for {
+		if err := t.wait(ctx); err != nil {
+			return nil, err
+		}
+		out, err := sqsClient.ListQueues(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list queues: %w", err)
+		}
+		urls = append(urls, out.QueueUrls...)
+		if aws.ToString(out.NextToken) == "" {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+
+	queues := make([]QueueInfo, 0, len(urls))
+	instances := make(map[string]string)
+	for _, url := range urls {
+		if err := t.wait(ctx); err != nil {
+			return nil, err
+		}
+		q, err := describeQueue(ctx, sqsClient, url)
+		if isQueueNotFound(err) {
+			// Deleted since it was listed, e.g. by its daemon
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to describe queue %s: %w", url, err)
+		}
+		if m := queueNamePattern.FindStringSubmatch(q.Name); m != nil {
+			q.InstanceID = m[1]
+			instances[q.InstanceID] = InstanceNotFound
+		}
+		queues = append(queues, q)
+	}
+
+	if err := describeInstanceStates(ctx, ec2Client, t, instances); err != nil {
+		return nil, err
+	}
+	for i := range queues {
+		if queues[i].InstanceID != "" {
+			queues[i].InstanceState = instances[queues[i].InstanceID]
+		}
+	}
+	return queues, nil
+}
+
+// describeQueue returns the queue with the url, and its attributes.
+func describeQueue(ctx context.Context, client SQSClient, url string) (QueueInfo, error) {
+	out, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(url),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameCreatedTimestamp,
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+		},
+	})
+	if err != nil {
+		return QueueInfo{}, err
+	}
+	attribute := func(name types.QueueAttributeName) int64 {
+		v, _ := strconv.ParseInt(out.Attributes[string(name)], 10, 64)
+		return v
+	}
+	return QueueInfo{
+		Name:             path.Base(url),
+		URL:              url,
+		CreatedAt:        time.Unix(attribute(types.QueueAttributeNameCreatedTimestamp), 0),
+		Messages:         attribute(types.QueueAttributeNameApproximateNumberOfMessages),
+		MessagesInFlight: attribute(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible),
+	}, nil
+}
+
+// describeInstanceStates sets the states of the instances, which are left as InstanceNotFound if
+// they don't exist. A filter is used rather than the instance ids, which fail if any don't exist.
+func describeInstanceStates(ctx context.Context, client QueueEC2Client, t *throttle, states map[string]string) error {
+	ids := make([]string, 0, len(states))
+	for id := range states {
+		ids = append(ids, id)
+	}
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > describeInstancesBatch {
+			batch = batch[:describeInstancesBatch]
+		}
+		ids = ids[len(batch):]
+
+		input := &ec2.DescribeInstancesInput{
+			Filters: []ec2types.Filter{{Name: aws.String("instance-id"), Values: batch}},
+		}
+		for {
+			if err := t.wait(ctx); err != nil {
+				return err
+			}
+			out, err := client.DescribeInstances(ctx, input)
+			if err != nil {
+				return fmt.Errorf("failed to describe instances: %w", err)
+			}
+			for _, r := range out.Reservations {
+				for _, i := range r.Instances {
+					if i.State != nil {
+						states[aws.ToString(i.InstanceId)] = string(i.State.Name)
+					}
+				}
+			}
+			if aws.ToString(out.NextToken) == "" {
+				break
+			}
+			input.NextToken = out.NextToken
+		}
+	}
+	return nil
+}
+
+// Actions of pruning a queue.
+const (
+	PruneDeleted     = "deleted"
+	PruneWouldDelete = "would-delete"
+	PruneSkipped     = "skipped"
+	PruneFailed      = "failed"
+)
+
+// PruneOptions control which queues PruneQueues deletes.
+type PruneOptions struct {
+	// OlderThan is the minimum age of the queues that are deleted.
+	OlderThan time.Duration
+
+	// DryRun reports the queues that would be deleted, without deleting them.
+	DryRun bool
+
+	// Force deletes the queues of instances that are still running, which are otherwise skipped.
+	Force bool
+
+	// Rate is the number of API requests per second (DefaultQueueAPIRate if it is not set).
+	Rate int
+}
+
+// PruneResult is what PruneQueues did with a queue, and why if it was skipped or failed.
+type PruneResult struct {
+	Queue  QueueInfo `json:"queue"`
+	Action string    `json:"action"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// PruneQueues deletes the queues (see ListQueues) that are older than the minimum age, unless their
+// instance is still running, and returns what was done with each. Failures to delete a queue are
+// reported in its result rather than stopping the others from being pruned. Requires sqs:DeleteQueue.
+func PruneQueues(ctx context.Context, client SQSClient, queues []QueueInfo, options PruneOptions) ([]PruneResult, error) {
+	t := newThrottle(options.Rate)
+	defer t.stop()
+
+	now := time.Now()
+	results := make([]PruneResult, 0, len(queues))
+	for _, q := range queues {
+		r := PruneResult{Queue: q}
+		switch {
+		case q.Age(now) < options.OlderThan:
+			r.Action, r.Reason = PruneSkipped, fmt.Sprintf("younger than %s", options.OlderThan)
+		case q.Running() && !options.Force:
+			r.Action, r.Reason = PruneSkipped, fmt.Sprintf("instance is %s", q.InstanceState)
+		case options.DryRun:
+			r.Action = PruneWouldDelete
+		default:
+			if err := t.wait(ctx); err != nil {
+				return results, err
+			}
+			_, err := client.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: aws.String(q.URL)})
+			if err != nil && !isQueueNotFound(err) {
+				r.Action, r.Reason = PruneFailed, err.Error()
+			} else {
+				r.Action = PruneDeleted
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// isQueueNotFound returns true if the error is because the queue doesn't exist.
+func isQueueNotFound(err error) bool {
+	var notExist *types.QueueDoesNotExist
+	if errors.As(err, &notExist) {
+		return true
+	}
+	e, ok := apiError(err)
+	return ok && (e.ErrorCode() == "QueueDoesNotExist" || e.ErrorCode() == "AWS.SimpleQueueService.NonExistentQueue")
+}
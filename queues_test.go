@@ -0,0 +1,163 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/golang/mock/gomock"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestListQueues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	created := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	prefix := "https://sqs.us-east-1.amazonaws.com/123456789012/"
+
+	sq := mocks.NewMockSQSClient(ctrl)
+	sq.EXPECT().ListQueues(gomock.Any(), gomock.Any()).Return(&sqs.ListQueuesOutput{
+		QueueUrls: []string{prefix + "lifecycled-i-0001", prefix + "lifecycled-i-0002"},
+		NextToken: aws.String("next"),
+	}, nil)
+	sq.EXPECT().ListQueues(gomock.Any(), gomock.Any()).Return(&sqs.ListQueuesOutput{
+		QueueUrls: []string{prefix + "lifecycled-i-0003", prefix + "lifecycled-preflight-abcdef", prefix + "lifecycled-i-0004"},
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(5).DoAndReturn(
+		func(_ context.Context, input *sqs.GetQueueAttributesInput, _ ...interface{}) (*sqs.GetQueueAttributesOutput, error) {
+			if aws.ToString(input.QueueUrl) == prefix+"lifecycled-i-0004" {
+				return nil, &sqstypes.QueueDoesNotExist{Message: aws.String("deleted")}
+			}
+			return &sqs.GetQueueAttributesOutput{Attributes: map[string]string{
+				string(sqstypes.QueueAttributeNameCreatedTimestamp):                      strconv.FormatInt(created.Unix(), 10),
+				string(sqstypes.QueueAttributeNameApproximateNumberOfMessages):           "2",
+				string(sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible): "1",
+			}}, nil
+		},
+	)
+
+	ec := mocks.NewMockQueueEC2Client(ctrl)
+	ec.EXPECT().DescribeInstances(gomock.Any(), gomock.Any()).Return(&ec2.DescribeInstancesOutput{
+		Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{
+			{InstanceId: aws.String("i-0001"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+			{InstanceId: aws.String("i-0002"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameTerminated}},
+		}}},
+	}, nil)
+
+	queues, err := lifecycled.ListQueues(context.TODO(), sq, ec, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]string{
+		"lifecycled-i-0001":           string(ec2types.InstanceStateNameRunning),
+		"lifecycled-i-0002":           string(ec2types.InstanceStateNameTerminated),
+		"lifecycled-i-0003":           lifecycled.InstanceNotFound,
+		"lifecycled-preflight-abcdef": "",
+	}
+	if got, want := len(queues), len(expected); got != want {
+		t.Fatalf("expected %d queues and got %d: %+v", want, got, queues)
+	}
+	for _, q := range queues {
+		state, ok := expected[q.Name]
+		if !ok {
+			t.Errorf("unexpected queue: %s", q.Name)
+			continue
+		}
+		if q.InstanceState != state {
+			t.Errorf("expected %s to have instance state %q and got %q", q.Name, state, q.InstanceState)
+		}
+		if !q.CreatedAt.Equal(created) {
+			t.Errorf("expected %s to be created at %s and got %s", q.Name, created, q.CreatedAt)
+		}
+		if q.Messages != 2 || q.MessagesInFlight != 1 {
+			t.Errorf("expected %s to have 2 messages and 1 in flight and got %d and %d", q.Name, q.Messages, q.MessagesInFlight)
+		}
+	}
+}
+
+func TestPruneQueues(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	queues := []lifecycled.QueueInfo{
+		{Name: "young", URL: "young", InstanceState: string(ec2types.InstanceStateNameTerminated), CreatedAt: time.Now()},
+		{Name: "running", URL: "running", InstanceState: string(ec2types.InstanceStateNameRunning), CreatedAt: old},
+		{Name: "terminated", URL: "terminated", InstanceState: string(ec2types.InstanceStateNameTerminated), CreatedAt: old},
+		{Name: "failing", URL: "failing", InstanceState: lifecycled.InstanceNotFound, CreatedAt: old},
+	}
+
+	tests := []struct {
+		description string
+		options     lifecycled.PruneOptions
+		deletes     []string
+		expected    map[string]string
+	}{
+		{
+			description: "deletes old queues of instances that are not running",
+			options:     lifecycled.PruneOptions{OlderThan: 24 * time.Hour},
+			deletes:     []string{"terminated", "failing"},
+			expected: map[string]string{
+				"young":      lifecycled.PruneSkipped,
+				"running":    lifecycled.PruneSkipped,
+				"terminated": lifecycled.PruneDeleted,
+				"failing":    lifecycled.PruneFailed,
+			},
+		},
+		{
+			description: "deletes the queues of running instances with force",
+			options:     lifecycled.PruneOptions{OlderThan: 24 * time.Hour, Force: true},
+			deletes:     []string{"running", "terminated", "failing"},
+			expected: map[string]string{
+				"young":      lifecycled.PruneSkipped,
+				"running":    lifecycled.PruneDeleted,
+				"terminated": lifecycled.PruneDeleted,
+				"failing":    lifecycled.PruneFailed,
+			},
+		},
+		{
+			description: "deletes nothing in a dry run",
+			options:     lifecycled.PruneOptions{OlderThan: 24 * time.Hour, DryRun: true},
+			expected: map[string]string{
+				"young":      lifecycled.PruneSkipped,
+				"running":    lifecycled.PruneSkipped,
+				"terminated": lifecycled.PruneWouldDelete,
+				"failing":    lifecycled.PruneWouldDelete,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			sq := mocks.NewMockSQSClient(ctrl)
+			for _, url := range tc.deletes {
+				var err error
+				if url == "failing" {
+					err = errors.New("access denied")
+				}
+				sq.EXPECT().DeleteQueue(gomock.Any(), &sqs.DeleteQueueInput{QueueUrl: aws.String(url)}).Return(&sqs.DeleteQueueOutput{}, err)
+			}
+
+			tc.options.Rate = 1000
+			results, err := lifecycled.PruneQueues(context.TODO(), sq, queues, tc.options)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, r := range results {
+				if got, want := r.Action, tc.expected[r.Queue.Name]; got != want {
+					t.Errorf("expected %s to be %s and got %s (%s)", r.Queue.Name, want, got, r.Reason)
+				}
+			}
+		})
+	}
+}
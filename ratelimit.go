@@ -0,0 +1,166 @@
+package lifecycled
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/sirupsen/logrus"
+)
+
+// rateLimiter is a token bucket that allows rate calls per second on average, and bursts of up to
+// burst calls, unlike the throttle of a sweep of the queues. Tokens are reserved in order, so
+// callers that wait are served first come first served. A nil *rateLimiter doesn't limit.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a full bucket for the rate and burst, which defaults to the calls of one
+// second.
+func newRateLimiter(rate, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = rate
+	}
+	return &rateLimiter{rate: float64(rate), burst: float64(burst), tokens: float64(burst)}
+}
+
+// advance refills the bucket for the time since it was last refilled.
+func (r *rateLimiter) advance(now time.Time) {
+	if !r.last.IsZero() && now.After(r.last) {
+		r.tokens = math.Min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	}
+	r.last = now
+}
+
+// reserve takes a token, and returns how long until it is available.
+func (r *rateLimiter) reserve(now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.advance(now)
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / r.rate * float64(time.Second))
+}
+
+// cancel returns a token that was reserved and not used.
+func (r *rateLimiter) cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = math.Min(r.burst, r.tokens+1)
+}
+
+// wait until a token is available, and return how long it waited. If the context is cancelled
+// first, the token is returned to the bucket for the other callers.
+func (r *rateLimiter) wait(ctx context.Context) (time.Duration, error) {
+	if r == nil {
+		return 0, nil
+	}
+	start := time.Now()
+	delay := r.reserve(start)
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		r.cancel()
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// rateLimitWaitKey is the context key of the wait for the rate limit of a call.
+type rateLimitWaitKey struct{}
+
+// withRateLimitWait returns a context where the calls of the rate limited client add the time
+// that they waited for the rate limit to wait, e.g. for the heartbeats to be scheduled earlier.
+func withRateLimitWait(ctx context.Context, wait *time.Duration) context.Context {
+	return context.WithValue(ctx, rateLimitWaitKey{}, wait)
+}
+
+// recordRateLimitWait adds the wait to the wait of the context, if any.
+func recordRateLimitWait(ctx context.Context, wait time.Duration) {
+	if w, ok := ctx.Value(rateLimitWaitKey{}).(*time.Duration); ok {
+		*w += wait
+	}
+}
+
+// rateLimitedClient waits for the rate limiter before each call of the autoscaling API, which
+// all the listeners and notices of the daemon share, so that many concurrent heartbeats and
+// completions don't have the account throttled. The limit applies to each call, while its
+// retries are spaced by the backoff of the SDK.
+type rateLimitedClient struct {
+	AutoscalingClient
+	limiter *rateLimiter
+	metrics *Metrics
+	logs    *componentLoggers
+	log     *logrus.Logger
+}
+
+// newRateLimitedClient returns the client limited to rate calls per second with bursts of burst.
+func newRateLimitedClient(client AutoscalingClient, rate, burst int, metrics *Metrics, logs *componentLoggers, log *logrus.Logger) *rateLimitedClient {
+	return &rateLimitedClient{
+		AutoscalingClient: client,
+		limiter:           newRateLimiter(rate, burst),
+		metrics:           metrics,
+		logs:              logs,
+		log:               log,
+	}
+}
+
+// wait for the rate limit before a call of the operation.
+func (c *rateLimitedClient) wait(ctx context.Context, operation string) error {
+	wait, err := c.limiter.wait(ctx)
+	c.metrics.rateLimitWaited(operation, wait)
+	recordRateLimitWait(ctx, wait)
+	if wait > 0 {
+		c.logs.entry(LogComponentAutoscaling, logrus.NewEntry(c.log)).WithFields(logrus.Fields{
+			"operation": operation,
+			"wait":      wait.Round(time.Millisecond).String(),
+		}).Debug("Waited for the autoscaling rate limit")
+	}
+	return err
+}
+
+// RecordLifecycleActionHeartbeat waits for the rate limit.
+func (c *rateLimitedClient) RecordLifecycleActionHeartbeat(ctx context.Context, input *autoscaling.RecordLifecycleActionHeartbeatInput, opts ...func(*autoscaling.Options)) (*autoscaling.RecordLifecycleActionHeartbeatOutput, error) {
+	if err := c.wait(ctx, "RecordLifecycleActionHeartbeat"); err != nil {
+		return nil, err
+	}
+	return c.AutoscalingClient.RecordLifecycleActionHeartbeat(ctx, input, opts...)
+}
+
+// CompleteLifecycleAction waits for the rate limit.
+func (c *rateLimitedClient) CompleteLifecycleAction(ctx context.Context, input *autoscaling.CompleteLifecycleActionInput, opts ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	if err := c.wait(ctx, "CompleteLifecycleAction"); err != nil {
+		return nil, err
+	}
+	return c.AutoscalingClient.CompleteLifecycleAction(ctx, input, opts...)
+}
+
+// DescribeAutoScalingInstances waits for the rate limit.
+func (c *rateLimitedClient) DescribeAutoScalingInstances(ctx context.Context, input *autoscaling.DescribeAutoScalingInstancesInput, opts ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+	if err := c.wait(ctx, "DescribeAutoScalingInstances"); err != nil {
+		return nil, err
+	}
+	return c.AutoscalingClient.DescribeAutoScalingInstances(ctx, input, opts...)
+}
+
+// DescribeLifecycleHooks waits for the rate limit.
+func (c *rateLimitedClient) DescribeLifecycleHooks(ctx context.Context, input *autoscaling.DescribeLifecycleHooksInput, opts ...func(*autoscaling.Options)) (*autoscaling.DescribeLifecycleHooksOutput, error) {
+	if err := c.wait(ctx, "DescribeLifecycleHooks"); err != nil {
+		return nil, err
+	}
+	return c.AutoscalingClient.DescribeLifecycleHooks(ctx, input, opts...)
+}
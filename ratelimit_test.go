@@ -0,0 +1,112 @@
+package lifecycled_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestAutoscalingRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The heartbeats are due far more often than the rate limit allows
+	var mu sync.Mutex
+	var calls []time.Time
+	record := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, time.Now())
+	}
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).DoAndReturn(
+		func(context.Context, *autoscaling.RecordLifecycleActionHeartbeatInput, ...func(*autoscaling.Options)) (*autoscaling.RecordLifecycleActionHeartbeatOutput, error) {
+			record()
+			return &autoscaling.RecordLifecycleActionHeartbeatOutput{}, nil
+		},
+	)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(context.Context, *autoscaling.CompleteLifecycleActionInput, ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+			record()
+			return &autoscaling.CompleteLifecycleActionOutput{}, nil
+		},
+	)
+
+	logger, hook := logrustest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		AutoscalingHeartbeatInterval: 5 * time.Millisecond,
+		AutoscalingRateLimit:         20,
+		AutoscalingRateBurst:         1,
+	}, nil, nil, as, nil, logger)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(daemon.Metrics())
+
+	_, err := daemon.Replay(context.TODO(), []byte(replayMessage), lifecycled.HandlerFunc(func(context.Context, ...string) error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	}), lifecycled.ReplayOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// 20 calls per second are 50ms apart once the burst is used
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) > 7 {
+		t.Errorf("expected at most 7 calls in 200ms and got %d", len(calls))
+	}
+	for i := 1; i < len(calls); i++ {
+		if gap := calls[i].Sub(calls[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("expected call %d to be at least 40ms after the previous one and got %s", i+1, gap)
+		}
+	}
+
+	var waited, late bool
+	for _, e := range hook.AllEntries() {
+		switch e.Message {
+		case "Waited for the autoscaling rate limit":
+			waited = waited || e.Level == logrus.DebugLevel
+		case "Heartbeat was sent late, it waited for the autoscaling rate limit":
+			late = late || e.Level == logrus.WarnLevel
+		}
+	}
+	if !waited {
+		t.Error("expected the wait for the rate limit to be logged at debug level")
+	}
+	if !late {
+		t.Error("expected a warning for the heartbeats that were late")
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %s", err)
+	}
+	var count uint64
+	var sum float64
+	for _, f := range families {
+		if f.GetName() != "lifecycled_autoscaling_rate_limit_wait_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			count += m.Histogram.GetSampleCount()
+			sum += m.Histogram.GetSampleSum()
+		}
+	}
+	// A heartbeat that is stopped while it waits is observed without a call
+	if count < uint64(len(calls)) {
+		t.Errorf("expected the wait of at least %d calls to be observed and got %d", len(calls), count)
+	}
+	if sum <= 0 {
+		t.Error("expected the time waited for the rate limit to be observed")
+	}
+}
@@ -0,0 +1,84 @@
+package lifecycled
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// The lifecycle action token is a capability to complete the lifecycle action, so it is
+// masked wherever a notice is logged or serialized for anything other than completing the
+// action (e.g. checkpoints, which need the token to recover the action).
+
+// maskToken returns the last 6 characters of the lifecycle action token, which is enough
+// to correlate log lines without logging a token that could be used to complete the action.
+func maskToken(token string) string {
+	if len(token) <= 6 {
+		return "..."
+	}
+	return "..." + token[len(token)-6:]
+}
+
+// redactToken replaces every occurrence of the token in data with the masked token.
+func redactToken(data []byte, token string) []byte {
+	if token == "" {
+		return data
+	}
+	return bytes.Replace(data, []byte(token), []byte(maskToken(token)), -1)
+}
+
+// actionTokenPattern matches the action token in a lifecycle hook message, including when the
+// message is escaped in an SNS envelope.
+var actionTokenPattern = regexp.MustCompile(`(LifecycleActionToken\\*"\s*:\s*\\*")([^"\\]*)`)
+
+// redactActionTokens masks the action tokens in data that is not a parsed message, such as a
+// message that failed to parse, for which the token isn't known.
+func redactActionTokens(data []byte) []byte {
+	return actionTokenPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := actionTokenPattern.FindSubmatch(m)
+		return append(append([]byte(nil), sub[1]...), maskToken(string(sub[2]))...)
+	})
+}
+
+// redactedRaw returns the original message of the notice, with the action token masked.
+func redactedRaw(notice DetailedNotice) []byte {
+	if n, ok := notice.(*autoscalingTerminationNotice); ok {
+		return redactToken(n.raw, n.message.ActionToken)
+	}
+	return notice.Raw()
+}
+
+// String describes the message, with the action token masked.
+func (m Message) String() string {
+	return fmt.Sprintf("%s for %s in %s (hook %s, token %s)", m.Transition, m.InstanceID, m.GroupName, m.HookName, maskToken(m.ActionToken))
+}
+
+// String describes the notice, with the action token masked.
+func (n *autoscalingTerminationNotice) String() string {
+	return fmt.Sprintf("%s notice: %s", n.noticeType, n.message)
+}
+
+// MarshalJSON serializes the notice for logging, with the action token masked.
+func (n *autoscalingTerminationNotice) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type        string    `json:"type"`
+		Transition  string    `json:"transition"`
+		InstanceID  string    `json:"instanceId"`
+		GroupName   string    `json:"autoscalingGroup"`
+		HookName    string    `json:"lifecycleHook"`
+		ActionToken string    `json:"actionToken"`
+		ReceivedAt  time.Time `json:"receivedAt"`
+		Message     string    `json:"message"`
+	}{
+		Type:        n.noticeType,
+		Transition:  n.message.Transition,
+		InstanceID:  n.message.InstanceID,
+		GroupName:   n.message.GroupName,
+		HookName:    n.message.HookName,
+		ActionToken: maskToken(n.message.ActionToken),
+		ReceivedAt:  n.receivedAt,
+		Message:     string(redactToken(n.raw, n.message.ActionToken)),
+	})
+}
@@ -0,0 +1,162 @@
+package lifecycled
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Sources of the region that ResolveRegion returns.
+const (
+	// RegionSourceConfig is the region of the configuration, e.g. --region.
+	RegionSourceConfig = "config"
+
+	// RegionSourceSDK is the region of the AWS SDK, e.g. AWS_REGION or the region of the profile.
+	RegionSourceSDK = "sdk"
+
+	// RegionSourceMetadata is the region of the instance, from the EC2 metadata service.
+	RegionSourceMetadata = "metadata"
+)
+
+// EndpointServices are the services whose endpoints can be overridden with Endpoints, by their
+// endpoint ids: CloudWatch is monitoring and CloudWatch Logs is logs.
+var EndpointServices = []string{"autoscaling", "ec2", "kms", "logs", "monitoring", "sns", "sqs", "sts"}
+
+// endpointIDs are the endpoint ids of the services by the service ids of the AWS SDK, which its
+// endpoint resolvers are called with.
+var endpointIDs = map[string]string{
+	autoscaling.ServiceID:    "autoscaling",
+	ec2.ServiceID:            "ec2",
+	kmsServiceID:             "kms",
+	cloudwatchlogs.ServiceID: "logs",
+	cloudwatch.ServiceID:     "monitoring",
+	sns.ServiceID:            "sns",
+	sqs.ServiceID:            "sqs",
+	sts.ServiceID:            "sts",
+}
+
+// STS endpoints of STSRegionalEndpoints.
+const (
+	// STSRegional calls STS at the endpoint of the region, which is the default, and is needed
+	// in VPCs that only reach the regional endpoint, e.g. through a VPC endpoint.
+	STSRegional = "regional"
+
+	// STSLegacy calls STS at the global endpoint of the aws partition, sts.amazonaws.com, which
+	// is signed for us-east-1. The other partitions have no global endpoint.
+	STSLegacy = "legacy"
+)
+
+// stsGlobalEndpoint is the global endpoint of STS in the aws partition.
+const stsGlobalEndpoint = "https://sts.amazonaws.com"
+
+// regionPattern matches the names of AWS regions, e.g. us-east-1 or us-gov-west-1.
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// partitions are the AWS partitions by the prefixes of the names of their regions, other than
+// the aws partition of the commercial regions.
+var partitions = []struct{ prefix, partition string }{
+	{"cn-", "aws-cn"},
+	{"us-gov-", "aws-us-gov"},
+	{"us-iso-", "aws-iso"},
+	{"us-isob-", "aws-iso-b"},
+	{"eu-isoe-", "aws-iso-e"},
+	{"us-isof-", "aws-iso-f"},
+}
+
+// regionPartition returns the partition of the region, e.g. aws-us-gov for us-gov-west-1, which
+// the ARNs of the resources in the region start with.
+func regionPartition(region string) string {
+	for _, p := range partitions {
+		if strings.HasPrefix(region, p.prefix) {
+			return p.partition
+		}
+	}
+	return "aws"
+}
+
+// isPartition returns true if the partition is one of the AWS partitions.
+func isPartition(partition string) bool {
+	if partition == "aws" {
+		return true
+	}
+	for _, p := range partitions {
+		if p.partition == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveRegion returns the region of the AWS clients and where it came from: the Region of the
+// configuration takes precedence over the region of the AWS SDK (e.g. AWS_REGION), which takes
+// precedence over the region of the instance that metadata returns (e.g. EC2Metadata.Region).
+// The error of metadata explains how to set the region, as it is the last resort.
+func ResolveRegion(c *Config, metadata func() (string, error)) (region, source string, err error) {
+	if c.Region != "" {
+		return c.Region, RegionSourceConfig, nil
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), c.loadOptions("")...)
+	if err != nil {
+		return "", "", err
+	}
+	if region := cfg.Region; region != "" {
+		return region, RegionSourceSDK, nil
+	}
+	if region, err = metadata(); err != nil {
+		return "", "", fmt.Errorf("region is not set and failed to look it up from the metadata service, set --region or AWS_REGION: %w", err)
+	}
+	return region, RegionSourceMetadata, nil
+}
+
+// loadOptions returns the options of the configurations of NewAWSConfig, with the named profile
+// of the shared configuration if AWSProfile is set, the Endpoints and the FIPS endpoints. The
+// credentials of the instance profile are sent by the metadata service (see NewIMDSClient).
+func (c *Config) loadOptions(region string) []func(*config.LoadOptions) error {
+	opts := []func(*config.LoadOptions) error{
+		config.WithEC2RoleCredentialOptions(func(o *ec2rolecreds.Options) {
+			o.Client = imds.New(imds.Options{HTTPClient: newIMDSHTTPClient(c)})
+		}),
+	}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	if c.AWSProfile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(c.AWSProfile))
+	}
+	if len(c.Endpoints) > 0 || c.STSRegionalEndpoints == STSLegacy {
+		opts = append(opts, config.WithEndpointResolverWithOptions(endpointResolver(c.Endpoints, c.STSRegionalEndpoints == STSLegacy)))
+	}
+	if c.FIPS {
+		opts = append(opts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	return opts
+}
+
+// endpointResolver resolves the endpoints of the services to the overrides, and the others
+// to the default endpoints of the AWS SDK, which are regional. Requests to the overrides are
+// signed for the region. With globalSTS, STS is resolved to its global endpoint in the aws
+// partition, unless it is overridden.
+func endpointResolver(overrides map[string]string, globalSTS bool) aws.EndpointResolverWithOptions {
+	return aws.EndpointResolverWithOptionsFunc(func(service, region string, _ ...interface{}) (aws.Endpoint, error) {
+		if url, ok := overrides[endpointIDs[service]]; ok {
+			return aws.Endpoint{URL: url, SigningRegion: region, HostnameImmutable: true}, nil
+		}
+		if globalSTS && service == sts.ServiceID && regionPartition(region) == "aws" {
+			return aws.Endpoint{URL: stsGlobalEndpoint, SigningRegion: "us-east-1", HostnameImmutable: true}, nil
+		}
+		return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+	})
+}
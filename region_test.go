@@ -0,0 +1,239 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/triarius/lifecycled"
+)
+
+func TestResolveRegion(t *testing.T) {
+	// Isolate the AWS SDK from the shared configuration of the machine running the tests
+	for key, value := range map[string]string{
+		"AWS_REGION":                  "",
+		"AWS_DEFAULT_REGION":          "",
+		"AWS_CONFIG_FILE":             os.DevNull,
+		"AWS_SHARED_CREDENTIALS_FILE": os.DevNull,
+	} {
+		if previous, ok := os.LookupEnv(key); ok {
+			defer os.Setenv(key, previous)
+		} else {
+			defer os.Unsetenv(key)
+		}
+		os.Setenv(key, value)
+	}
+
+	tests := []struct {
+		description    string
+		region         string
+		sdkRegion      string
+		metadataRegion string
+		metadataError  error
+		expectedRegion string
+		expectedSource string
+		expectError    bool
+	}{
+		{
+			description:    "configured region takes precedence",
+			region:         "eu-west-1",
+			sdkRegion:      "us-east-1",
+			metadataRegion: "us-west-2",
+			expectedRegion: "eu-west-1",
+			expectedSource: lifecycled.RegionSourceConfig,
+		},
+		{
+			description:    "sdk region takes precedence over the instance",
+			sdkRegion:      "us-east-1",
+			metadataRegion: "us-west-2",
+			expectedRegion: "us-east-1",
+			expectedSource: lifecycled.RegionSourceSDK,
+		},
+		{
+			description:    "region of the instance",
+			metadataRegion: "us-west-2",
+			expectedRegion: "us-west-2",
+			expectedSource: lifecycled.RegionSourceMetadata,
+		},
+		{
+			description:   "no region",
+			metadataError: errors.New("not on ec2"),
+			expectError:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			os.Setenv("AWS_REGION", tc.sdkRegion)
+
+			config := lifecycled.DefaultConfig()
+			config.Region = tc.region
+			region, source, err := lifecycled.ResolveRegion(config, func() (string, error) {
+				return tc.metadataRegion, tc.metadataError
+			})
+			if tc.expectError {
+				if err == nil || !strings.Contains(err.Error(), "--region") {
+					t.Errorf("expected an error explaining how to set the region and got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if region != tc.expectedRegion || source != tc.expectedSource {
+				t.Errorf("expected region %s from %s and got %s from %s", tc.expectedRegion, tc.expectedSource, region, source)
+			}
+		})
+	}
+}
+
+func TestNewAWSConfigEndpoints(t *testing.T) {
+	config := lifecycled.DefaultConfig()
+	config.Endpoints = map[string]string{"sqs": "http://localhost:4566"}
+
+	cfg, err := lifecycled.NewAWSConfig(context.TODO(), config, "us-east-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	endpoint, err := cfg.EndpointResolverWithOptions.ResolveEndpoint(sqs.ServiceID, "us-east-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := endpoint.URL, "http://localhost:4566"; got != want {
+		t.Errorf("expected sqs endpoint %s and got %s", want, got)
+	}
+	if got, want := endpoint.SigningRegion, "us-east-1"; got != want {
+		t.Errorf("expected sqs signing region %s and got %s", want, got)
+	}
+	// The other services fall back to the default endpoints
+	var notFound *aws.EndpointNotFoundError
+	if _, err := cfg.EndpointResolverWithOptions.ResolveEndpoint(sns.ServiceID, "us-east-1"); !errors.As(err, &notFound) {
+		t.Errorf("expected the default sns endpoint and got: %v", err)
+	}
+	if got := cfg.Region; got != "us-east-1" {
+		t.Errorf("expected region us-east-1 and got %s", got)
+	}
+}
+
+// hostClient fails each request, recording the host that it was sent to.
+type hostClient struct {
+	hosts []string
+}
+
+func (c *hostClient) Do(req *http.Request) (*http.Response, error) {
+	c.hosts = append(c.hosts, req.URL.Host)
+	return nil, errors.New("not sent")
+}
+
+func TestNewAWSConfigFIPS(t *testing.T) {
+	tests := []struct {
+		description string
+		region      string
+		endpoints   map[string]string
+		expected    string
+	}{
+		{
+			description: "commercial region",
+			region:      "us-east-1",
+			expected:    "sqs-fips.us-east-1.amazonaws.com",
+		},
+		{
+			description: "govcloud region",
+			region:      "us-gov-west-1",
+			expected:    "sqs.us-gov-west-1.amazonaws.com",
+		},
+		{
+			description: "overridden endpoint",
+			region:      "us-gov-west-1",
+			endpoints:   map[string]string{"sqs": "https://vpce-0123.sqs.us-gov-west-1.vpce.amazonaws.com"},
+			expected:    "vpce-0123.sqs.us-gov-west-1.vpce.amazonaws.com",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			config := lifecycled.DefaultConfig()
+			config.FIPS = true
+			config.Endpoints = tc.endpoints
+
+			cfg, err := lifecycled.NewAWSConfig(context.TODO(), config, tc.region)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			client := &hostClient{}
+			cfg.HTTPClient = client
+			cfg.Credentials = aws.AnonymousCredentials{}
+			cfg.Retryer = func() aws.Retryer { return aws.NopRetryer{} }
+
+			_, _ = sqs.NewFromConfig(cfg).GetQueueUrl(context.TODO(), &sqs.GetQueueUrlInput{QueueName: aws.String("lifecycled")})
+			if len(client.hosts) != 1 || client.hosts[0] != tc.expected {
+				t.Errorf("expected the request to be sent to %s and got %v", tc.expected, client.hosts)
+			}
+		})
+	}
+}
+
+func TestNewAWSConfigSTSEndpoints(t *testing.T) {
+	tests := []struct {
+		description string
+		region      string
+		endpoints   string
+		override    map[string]string
+		expected    string
+	}{
+		{
+			description: "regional by default",
+			region:      "us-west-2",
+			endpoints:   lifecycled.STSRegional,
+			expected:    "sts.us-west-2.amazonaws.com",
+		},
+		{
+			description: "legacy global endpoint",
+			region:      "us-west-2",
+			endpoints:   lifecycled.STSLegacy,
+			expected:    "sts.amazonaws.com",
+		},
+		{
+			description: "legacy in a partition without a global endpoint",
+			region:      "cn-north-1",
+			endpoints:   lifecycled.STSLegacy,
+			expected:    "sts.cn-north-1.amazonaws.com.cn",
+		},
+		{
+			description: "legacy with an overridden endpoint",
+			region:      "us-west-2",
+			endpoints:   lifecycled.STSLegacy,
+			override:    map[string]string{"sts": "https://vpce-0123.sts.us-west-2.vpce.amazonaws.com"},
+			expected:    "vpce-0123.sts.us-west-2.vpce.amazonaws.com",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			config := lifecycled.DefaultConfig()
+			config.STSRegionalEndpoints = tc.endpoints
+			config.Endpoints = tc.override
+
+			cfg, err := lifecycled.NewAWSConfig(context.TODO(), config, tc.region)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			client := &hostClient{}
+			cfg.HTTPClient = client
+			cfg.Credentials = aws.AnonymousCredentials{}
+			cfg.Retryer = func() aws.Retryer { return aws.NopRetryer{} }
+
+			_, _ = sts.NewFromConfig(cfg).GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+			if len(client.hosts) != 1 || client.hosts[0] != tc.expected {
+				t.Errorf("expected the request to be sent to %s and got %v", tc.expected, client.hosts)
+			}
+		})
+	}
+}
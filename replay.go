@@ -0,0 +1,108 @@
+package lifecycled
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/sirupsen/logrus"
+)
+
+// ReplayOptions control the autoscaling API calls made when replaying a notice.
+type ReplayOptions struct {
+	// SkipHeartbeats stops heartbeats being sent while the handler executes.
+	SkipHeartbeats bool
+
+	// SkipCompletion logs the result that the lifecycle action would be completed
+	// with, instead of completing it.
+	SkipCompletion bool
+}
+
+// ParseMessage parses a captured autoscaling notice, which is either the SNS envelope
+// as it is received from the queue or the lifecycle hook message that it contains.
+func ParseMessage(data []byte) (*Message, *Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse message: %s", err)
+	}
+
+	if env.Message == "" {
+		msg, err := parseLifecycleMessage(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse lifecycle hook message: %s", err)
+		}
+		if msg.ActionToken == "" {
+			return nil, nil, errors.New("message is neither an SNS envelope nor a lifecycle hook message")
+		}
+		return msg, nil, nil
+	}
+	msg, err := parseLifecycleMessage([]byte(env.Message))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse lifecycle hook message in envelope: %s", err)
+	}
+	return msg, &env, nil
+}
+
+// Replay handles a captured autoscaling notice (see ParseMessage) with the handler, as if it had
+// been received by the autoscaling listener, and returns the summary. Termination is never verified,
+// since the message is usually for another instance. The daemon needs an autoscaling client unless
+// both heartbeats and completion are skipped.
+func (d *Daemon) Replay(ctx context.Context, data []byte, handler Handler, options ReplayOptions) (*Summary, error) {
+	msg, env, err := ParseMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Transition != terminatingTransition {
+		return nil, fmt.Errorf("cannot replay a %s message, it is not a termination notice", msg.Transition)
+	}
+
+	n := &autoscalingTerminationNotice{
+		noticeType:     "autoscaling",
+		class:          NoticeTermination,
+		message:        msg,
+		autoscaling:    &replayClient{AutoscalingClient: d.autoscaling, skipCompletion: options.SkipCompletion, log: d.logger, notice: "replayed"},
+		options:        d.autoscalingOptions.withDefaults(),
+		receivedAt:     time.Now(),
+		raw:            data,
+		skipHeartbeats: options.SkipHeartbeats,
+	}
+	n.options.VerifyTermination = false
+	if env != nil {
+		n.publishedAt = env.Time
+	}
+
+	d.logger.WithFields(logrus.Fields{
+		"instanceId":     msg.InstanceID,
+		"skipHeartbeats": options.SkipHeartbeats,
+		"skipCompletion": options.SkipCompletion,
+	}).Info("Replaying termination notice")
+
+	summary, err := d.handle(ctx, n, handler)
+	summary.Results = []Result{n.Result()}
+	summary.Interrupted = ctx.Err() != nil
+	summary.Err = err
+	return summary, err
+}
+
+// replayClient skips completing the lifecycle action of a replayed or simulated notice, if configured.
+type replayClient struct {
+	AutoscalingClient
+	skipCompletion bool
+	log            *logrus.Logger
+
+	// notice describes the notice in the log entry, e.g. replayed
+	notice string
+}
+
+// CompleteLifecycleAction logs the input instead of completing the action, if completion is skipped.
+func (c *replayClient) CompleteLifecycleAction(ctx context.Context, input *autoscaling.CompleteLifecycleActionInput, opts ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	if !c.skipCompletion {
+		return c.AutoscalingClient.CompleteLifecycleAction(ctx, input, opts...)
+	}
+	c.log.WithField("result", aws.ToString(input.LifecycleActionResult)).Info("Skipping lifecycle action completion for " + c.notice + " notice")
+	return &autoscaling.CompleteLifecycleActionOutput{}, nil
+}
@@ -0,0 +1,201 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+const replayMessage = `{
+	"Time": "2016-02-26T21:09:59.517Z",
+	"AutoScalingGroupName": "group",
+	"EC2InstanceId": "i-000000000000",
+	"LifecycleActionToken": "token",
+	"LifecycleTransition": "autoscaling:EC2_INSTANCE_TERMINATING",
+	"LifecycleHookName": "hook"
+}`
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		description    string
+		data           string
+		expectEnvelope bool
+		expectError    bool
+	}{
+		{
+			description: "lifecycle hook message",
+			data:        replayMessage,
+		},
+		{
+			description:    "sns envelope",
+			data:           aws.ToString(newSQSMessage("i-000000000000").Body),
+			expectEnvelope: true,
+		},
+		{
+			description: "unrelated json",
+			data:        `{"foo": "bar"}`,
+			expectError: true,
+		},
+		{
+			description: "invalid json",
+			data:        `{`,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			msg, env, err := lifecycled.ParseMessage([]byte(tc.data))
+			if tc.expectError {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got, want := msg.InstanceID, "i-000000000000"; got != want {
+				t.Errorf("expected instance id '%s' and got '%s'", want, got)
+			}
+			if got, want := env != nil, tc.expectEnvelope; got != want {
+				t.Errorf("expected envelope to be %t and got %t", want, got)
+			}
+		})
+	}
+}
+
+func TestDaemonReplay(t *testing.T) {
+	tests := []struct {
+		description string
+		options     lifecycled.ReplayOptions
+		heartbeats  bool
+		completion  bool
+	}{
+		{
+			description: "makes the autoscaling api calls by default",
+			heartbeats:  true,
+			completion:  true,
+		},
+		{
+			description: "skips heartbeats and completion",
+			options:     lifecycled.ReplayOptions{SkipHeartbeats: true, SkipCompletion: true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var as *mocks.MockAutoscalingClient
+			if tc.heartbeats || tc.completion {
+				as = mocks.NewMockAutoscalingClient(ctrl)
+				as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+				as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+			}
+
+			logger, _ := logrus.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				AutoscalingHeartbeatInterval: 5 * time.Millisecond,
+			}, nil, nil, as, nil, logger)
+
+			var args []string
+			summary, err := daemon.Replay(context.TODO(), []byte(replayMessage), lifecycled.HandlerFunc(func(_ context.Context, a ...string) error {
+				args = a
+				time.Sleep(20 * time.Millisecond)
+				return errors.New("failed")
+			}), tc.options)
+			if err == nil {
+				t.Error("expected the handler error")
+			}
+			if got, want := len(args), 2; got != want {
+				t.Fatalf("expected handler to be executed with %d args and got %d", want, got)
+			}
+			if got, want := summary.Outcome(), lifecycled.OutcomeHandlerFailed; got != want {
+				t.Errorf("expected outcome '%s' and got '%s'", want, got)
+			}
+			if got, want := summary.CompletionResult, "CONTINUE"; got != want {
+				t.Errorf("expected completion result '%s' and got '%s'", want, got)
+			}
+			if got, want := summary.HeartbeatsSent > 0, tc.heartbeats; got != want {
+				t.Errorf("expected heartbeats sent to be %t and got %t", want, got)
+			}
+		})
+	}
+}
+
+func TestDaemonSimulate(t *testing.T) {
+	tests := []struct {
+		description string
+		transition  string
+		noticeType  string
+		expectError bool
+	}{
+		{
+			description: "termination notice",
+			transition:  "autoscaling:EC2_INSTANCE_TERMINATING",
+			noticeType:  "autoscaling",
+		},
+		{
+			description: "checkpoint notice",
+			transition:  "autoscaling:EC2_INSTANCE_LAUNCHING",
+			noticeType:  lifecycled.CheckpointNoticeType,
+		},
+		{
+			description: "ignored notice",
+			transition:  "autoscaling:EC2_INSTANCE_LAUNCHING_ERROR",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			logger, _ := logrus.NewNullLogger()
+
+			// Without clients, simulating must not make any autoscaling api calls
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				AutoscalingRules: []lifecycled.NoticeRule{
+					{Transition: "autoscaling:EC2_INSTANCE_LAUNCHING", Notice: lifecycled.NoticeCheckpoint},
+				},
+			}, nil, nil, nil, nil, logger)
+
+			var noticeType string
+			handler := func(nt string) lifecycled.Handler {
+				return lifecycled.HandlerFunc(func(context.Context, ...string) error {
+					noticeType = nt
+					return nil
+				})
+			}
+			daemon.SetHandler(lifecycled.CheckpointNoticeType, handler(lifecycled.CheckpointNoticeType))
+
+			msg := lifecycled.SimulatedMessage("i-000000000000", tc.transition)
+			summary, err := daemon.Simulate(context.TODO(), msg, handler("autoscaling"))
+			if tc.expectError {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got, want := noticeType, tc.noticeType; got != want {
+				t.Errorf("expected the %s handler and got %s", want, got)
+			}
+			if got, want := summary.Outcome(), lifecycled.OutcomeSuccess; got != want {
+				t.Errorf("expected outcome '%s' and got '%s'", want, got)
+			}
+			if got, want := summary.CompletionResult, "CONTINUE"; got != want {
+				t.Errorf("expected completion result '%s' and got '%s'", want, got)
+			}
+		})
+	}
+}
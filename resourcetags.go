@@ -0,0 +1,53 @@
+package lifecycled
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Constraints of the tags of AWS resources, which are the same for SQS queues and CloudWatch Logs groups.
+const (
+	maxResourceTags        = 50
+	maxResourceTagKey      = 128
+	maxResourceTagValue    = 256
+	reservedResourceTagKey = "aws:"
+)
+
+// resourceTagPattern matches the characters that the keys and values of tags may contain.
+var resourceTagPattern = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+
+// ValidateResourceTags checks the tags against the constraints of AWS: at most 50 tags, keys of 1
+// to 128 characters that don't start with aws:, values of up to 256 characters, and only letters,
+// numbers, spaces and _ . : / = + - @ in either.
+func ValidateResourceTags(tags map[string]string) error {
+	if len(tags) > maxResourceTags {
+		return invalid("tag", "Team=platform", "can be set at most %d times, got %d tags", maxResourceTags, len(tags))
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := tags[key]
+		switch n := utf8.RuneCountInString(key); {
+		case n == 0:
+			return invalid("tag", "Team=platform", "key is required, got %q", key+"="+value)
+		case n > maxResourceTagKey:
+			return invalid("tag", "Team=platform", "key must be at most %d characters, got %d", maxResourceTagKey, n)
+		case strings.HasPrefix(strings.ToLower(key), reservedResourceTagKey):
+			return invalid("tag", "Team=platform", "key must not start with %s, which is reserved for aws, got %q", reservedResourceTagKey, key)
+		case !resourceTagPattern.MatchString(key):
+			return invalid("tag", "Team=platform", "key must only contain letters, numbers, spaces and _ . : / = + - @, got %q", key)
+		}
+		if n := utf8.RuneCountInString(value); n > maxResourceTagValue {
+			return invalid("tag", "Team=platform", "value of %s must be at most %d characters, got %d", key, maxResourceTagValue, n)
+		}
+		if !resourceTagPattern.MatchString(value) {
+			return invalid("tag", "Team=platform", "value of %s must only contain letters, numbers, spaces and _ . : / = + - @, got %q", key, value)
+		}
+	}
+	return nil
+}
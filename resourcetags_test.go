@@ -0,0 +1,134 @@
+package lifecycled_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/golang/mock/gomock"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestValidateResourceTags(t *testing.T) {
+	many := make(map[string]string)
+	for i := 0; i < 51; i++ {
+		many[strings.Repeat("k", i+1)] = "v"
+	}
+
+	tests := []struct {
+		description string
+		tags        map[string]string
+		expected    string
+	}{
+		{
+			description: "no tags",
+		},
+		{
+			description: "tags",
+			tags:        map[string]string{"Team": "platform", "team/owner": "ops@example.com", "Name": ""},
+		},
+		{
+			description: "too many tags",
+			tags:        many,
+			expected:    "--tag can be set at most 50 times, got 51 tags (e.g. --tag Team=platform)",
+		},
+		{
+			description: "empty key",
+			tags:        map[string]string{"": "platform"},
+			expected:    `--tag key is required, got "=platform" (e.g. --tag Team=platform)`,
+		},
+		{
+			description: "long key",
+			tags:        map[string]string{strings.Repeat("k", 129): "platform"},
+			expected:    "--tag key must be at most 128 characters, got 129 (e.g. --tag Team=platform)",
+		},
+		{
+			description: "reserved key",
+			tags:        map[string]string{"AWS:Team": "platform"},
+			expected:    `--tag key must not start with aws:, which is reserved for aws, got "AWS:Team" (e.g. --tag Team=platform)`,
+		},
+		{
+			description: "key with an invalid character",
+			tags:        map[string]string{"Team!": "platform"},
+			expected:    `--tag key must only contain letters, numbers, spaces and _ . : / = + - @, got "Team!" (e.g. --tag Team=platform)`,
+		},
+		{
+			description: "long value",
+			tags:        map[string]string{"Team": strings.Repeat("v", 257)},
+			expected:    "--tag value of Team must be at most 256 characters, got 257 (e.g. --tag Team=platform)",
+		},
+		{
+			description: "value with an invalid character",
+			tags:        map[string]string{"Team": "platform;ops"},
+			expected:    `--tag value of Team must only contain letters, numbers, spaces and _ . : / = + - @, got "platform;ops" (e.g. --tag Team=platform)`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			err := lifecycled.ValidateResourceTags(tc.tags)
+			if tc.expected == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected error '%s' and got '%v'", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestQueueTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tags := map[string]string{"Team": "platform"}
+	sq := mocks.NewMockSQSClient(ctrl)
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, input *sqs.CreateQueueInput, _ ...func(*sqs.Options)) (*sqs.CreateQueueOutput, error) {
+			if got := input.Tags; !reflect.DeepEqual(got, tags) {
+				t.Errorf("expected the queue to be created with tags %v and got %v", tags, got)
+			}
+			return &sqs.CreateQueueOutput{QueueUrl: aws.String("https://sqs.us-east-1.amazonaws.com/123456789012/queue")}, nil
+		},
+	)
+
+	queue := lifecycled.NewQueue("queue", "topic", sq, mocks.NewMockSNSClient(ctrl))
+	queue.SetTags(tags)
+	if err := queue.Create(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestCloudWatchLogsHookTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tags := map[string]string{"Team": "platform"}
+	cw := mocks.NewMockCloudWatchLogsClient(ctrl)
+	cw.EXPECT().CreateLogGroup(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, input *cloudwatchlogs.CreateLogGroupInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+			if got := input.Tags; !reflect.DeepEqual(got, tags) {
+				t.Errorf("expected the group to be created with tags %v and got %v", tags, got)
+			}
+			return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+		},
+	)
+	cw.EXPECT().CreateLogStream(gomock.Any(), gomock.Any()).Times(1).Return(&cloudwatchlogs.CreateLogStreamOutput{}, nil)
+
+	hook, err := lifecycled.NewCloudWatchLogsHook(cw, "group", "i-000000000000", tags, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,334 @@
+package lifecycled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// retryClass is how a failed AWS API call is retried.
+type retryClass string
+
+const (
+	retryNever     retryClass = ""
+	retryTransient retryClass = "transient"
+	retryThrottled retryClass = "throttled"
+
+	// retryCredentials retries a call whose credentials were rejected with refreshed credentials
+	retryCredentials retryClass = "credentials"
+)
+
+// retryPolicy bounds the attempts of an AWS API call, and the delay before each retry, which
+// is the backoff doubled on each retry up to the maximum backoff, with jitter of up to half of
+// it. Throttling starts from the longer throttle backoff, so that the calls back off more from
+// an API that is limiting their rate than from one that is failing.
+type retryPolicy struct {
+	maxAttempts     int
+	backoff         time.Duration
+	throttleBackoff time.Duration
+	maxBackoff      time.Duration
+
+	// classify returns how an error is retried, which is classifyError if it is nil.
+	classify func(error) retryClass
+}
+
+// retryPolicies are the retry policies of the AWS API calls by operation, and the other calls
+// are retried by the default retryer of the SDK.
+var retryPolicies = map[string]retryPolicy{
+	// The queue is recreated with the same name when the daemon restarts, which fails for 60s
+	// after it was deleted, so the attempts back off for longer than that
+	"CreateQueue": {
+		maxAttempts:     6,
+		backoff:         time.Second,
+		throttleBackoff: 10 * time.Second,
+		maxBackoff:      30 * time.Second,
+		classify: func(err error) retryClass {
+			if e, ok := apiError(err); ok && (e.ErrorCode() == "QueueDeletedRecently" || e.ErrorCode() == "AWS.SimpleQueueService.QueueDeletedRecently") {
+				return retryThrottled
+			}
+			return classifyError(err)
+		},
+	},
+	"Subscribe": {
+		maxAttempts:     6,
+		backoff:         time.Second,
+		throttleBackoff: 5 * time.Second,
+		maxBackoff:      30 * time.Second,
+	},
+	// Failed long-polls are also followed by the delay of the consecutive failures (see
+	// AutoscalingListener.Start)
+	"ReceiveMessage": {
+		maxAttempts:     3,
+		backoff:         time.Second,
+		throttleBackoff: 5 * time.Second,
+		maxBackoff:      time.Minute,
+	},
+	"DeleteMessage": {
+		maxAttempts:     5,
+		backoff:         200 * time.Millisecond,
+		throttleBackoff: time.Second,
+		maxBackoff:      5 * time.Second,
+	},
+	// A heartbeat that fails is sent again at the next interval
+	"RecordLifecycleActionHeartbeat": {
+		maxAttempts:     3,
+		backoff:         500 * time.Millisecond,
+		throttleBackoff: 2 * time.Second,
+		maxBackoff:      5 * time.Second,
+	},
+	// Completion is bounded by the shutdown timeout rather than the attempts
+	"CompleteLifecycleAction": {
+		maxAttempts:     8,
+		backoff:         500 * time.Millisecond,
+		throttleBackoff: 2 * time.Second,
+		maxBackoff:      10 * time.Second,
+	},
+}
+
+// throttleErrorCodes are the error codes of the AWS APIs that limit the rate of the calls.
+var throttleErrorCodes = map[string]bool{
+	"Throttling":                true,
+	"ThrottlingException":       true,
+	"RequestLimitExceeded":      true,
+	"RequestThrottled":          true,
+	"RequestThrottledException": true,
+	"TooManyRequestsException":  true,
+}
+
+// classifyError retries throttling, and the errors that the SDK retries by default: 5xx
+// responses and failures to connect or send the request, but not cancellation.
+func classifyError(err error) retryClass {
+	if isThrottled(err) {
+		return retryThrottled
+	}
+	if isCredentialRejected(err) {
+		return retryCredentials
+	}
+	var timeout *attemptTimeoutError
+	if errors.As(err, &timeout) {
+		return retryTransient
+	}
+	if retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary {
+		return retryTransient
+	}
+	return retryNever
+}
+
+// isThrottled returns true if the AWS API call failed because its rate is limited.
+func isThrottled(err error) bool {
+	if e, ok := apiError(err); ok && throttleErrorCodes[e.ErrorCode()] {
+		return true
+	}
+	var e interface{ HTTPStatusCode() int }
+	return errors.As(err, &e) && e.HTTPStatusCode() == 429
+}
+
+func (p retryPolicy) classifyError(err error) retryClass {
+	if p.classify != nil {
+		return p.classify(err)
+	}
+	return classifyError(err)
+}
+
+// delay returns the delay before the retry after the attempt (from 1) failed.
+func (p retryPolicy) delay(attempt int, class retryClass) time.Duration {
+	d := p.backoff
+	if class == retryThrottled {
+		d = p.throttleBackoff
+	}
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for the delay before the retry after the attempt failed with the error, and
+// returns false if the context is done first.
+func (p retryPolicy) sleep(ctx context.Context, attempt int, err error) bool {
+	timer := time.NewTimer(p.delay(attempt, p.classifyError(err)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// policyRetryer is the retryer of an AWS API call with the policy of its operation. The SDK
+// makes the retries before the call returns, and each one is logged at debug level (if the log
+// isn't nil) and counted in the metrics and in retries. Each attempt is bounded by the timeout,
+// if it has one, so that an attempt that hangs is retried rather than blocking the caller.
+type policyRetryer struct {
+	operation string
+	policy    retryPolicy
+	log       *logrus.Entry
+	metrics   *Metrics
+	timeout   time.Duration
+
+	// credentials of the client, which are invalidated when they are rejected, if they are cached
+	credentials interface{ Invalidate() }
+
+	// retries of the call so far
+	retries int
+}
+
+// newRetryer returns the retryer of a call of the operation, which must have a retry policy,
+// with the timeout of its attempts.
+func newRetryer(operation string, log *logrus.Entry, metrics *Metrics, timeouts callTimeouts) *policyRetryer {
+	return &policyRetryer{
+		operation: operation,
+		policy:    retryPolicies[operation],
+		log:       log,
+		metrics:   metrics,
+		timeout:   timeouts.attempt(operation),
+	}
+}
+
+// IsErrorRetryable implements aws.Retryer.
+func (r *policyRetryer) IsErrorRetryable(err error) bool {
+	return r.policy.classifyError(err) != retryNever
+}
+
+// MaxAttempts implements aws.Retryer.
+func (r *policyRetryer) MaxAttempts() int {
+	return r.policy.maxAttempts
+}
+
+// RetryDelay implements aws.Retryer, and is called before each retry.
+func (r *policyRetryer) RetryDelay(attempt int, err error) (time.Duration, error) {
+	class := r.policy.classifyError(err)
+	delay := r.policy.delay(attempt, class)
+	r.retries++
+	r.metrics.retried(r.operation, class)
+	if class == retryCredentials && r.credentials != nil {
+		// The next attempt retrieves the credentials again, e.g. assuming the role
+		r.credentials.Invalidate()
+		if r.log != nil {
+			r.log.WithError(err).WithField("operation", r.operation).Warn("Refreshing aws credentials that were rejected")
+		}
+	}
+	if r.log != nil {
+		r.log.WithError(err).WithFields(logrus.Fields{
+			"operation":   r.operation,
+			"attempt":     attempt,
+			"maxAttempts": r.policy.maxAttempts,
+			"retry":       string(class),
+			"delay":       delay.String(),
+		}).Debug("Retrying aws api call")
+	}
+	return delay, nil
+}
+
+// GetRetryToken implements aws.Retryer. The attempts are bounded by the policy rather than
+// a retry quota.
+func (r *policyRetryer) GetRetryToken(context.Context, error) (func(error) error, error) {
+	return releaseToken, nil
+}
+
+// GetInitialToken implements aws.Retryer.
+func (r *policyRetryer) GetInitialToken() func(error) error {
+	return releaseToken
+}
+
+func releaseToken(error) error {
+	return nil
+}
+
+// sqsRetryer, snsRetryer and autoscalingRetryer are the options of an API call with the retryer
+// and the timeout of its attempts.
+func sqsRetryer(r *policyRetryer) func(*sqs.Options) {
+	return func(o *sqs.Options) {
+		o.Retryer = r
+		r.credentials, _ = o.Credentials.(interface{ Invalidate() })
+		o.APIOptions = append(o.APIOptions, r.addAttemptTimeout)
+	}
+}
+
+func snsRetryer(r *policyRetryer) func(*sns.Options) {
+	return func(o *sns.Options) {
+		o.Retryer = r
+		r.credentials, _ = o.Credentials.(interface{ Invalidate() })
+		o.APIOptions = append(o.APIOptions, r.addAttemptTimeout)
+	}
+}
+
+func autoscalingRetryer(r *policyRetryer) func(*autoscaling.Options) {
+	return func(o *autoscaling.Options) {
+		o.Retryer = r
+		r.credentials, _ = o.Credentials.(interface{ Invalidate() })
+		o.APIOptions = append(o.APIOptions, r.addAttemptTimeout)
+	}
+}
+
+// callTimeouts are the timeouts of the attempts of the AWS API calls (see Config.AWSCallTimeout).
+type callTimeouts struct {
+	call      time.Duration
+	heartbeat time.Duration
+}
+
+// attempt returns the timeout of an attempt of the AWS API call, or zero if it has none.
+func (t callTimeouts) attempt(operation string) time.Duration {
+	switch {
+	case t.call <= 0:
+		return 0
+	case operation == "RecordLifecycleActionHeartbeat" && t.heartbeat > 0:
+		return t.heartbeat
+	case operation == "ReceiveMessage":
+		return t.call + longPollingWaitTimeSeconds*time.Second
+	default:
+		return t.call
+	}
+}
+
+// attemptTimeoutError is returned by an attempt of an AWS API call that timed out while the
+// context of the call was still live, which is retried unlike a cancelled call.
+type attemptTimeoutError struct {
+	operation string
+	timeout   time.Duration
+}
+
+func (e *attemptTimeoutError) Error() string {
+	return fmt.Sprintf("%s attempt timed out after %s", e.operation, e.timeout)
+}
+
+// Unwrap returns context.DeadlineExceeded.
+func (e *attemptTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// addAttemptTimeout adds the timeout of the attempts to the stack of the call, after the
+// retries so that each attempt has its own deadline. The HTTP client of NewAWSConfig also
+// bounds the attempts, but the clients may have been created with another.
+func (r *policyRetryer) addAttemptTimeout(stack *middleware.Stack) error {
+	if r.timeout <= 0 {
+		return nil
+	}
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("AttemptTimeout", func(
+		ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+	) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		attemptCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+		out, metadata, err := next.HandleFinalize(attemptCtx, in)
+		if err != nil && ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+			err = &attemptTimeoutError{operation: r.operation, timeout: r.timeout}
+		}
+		return out, metadata, err
+	}), "Retry", middleware.After)
+}
@@ -0,0 +1,212 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// responseError returns the error of an AWS API call that failed with the status code.
+func responseError(status int) error {
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+		Err:      errors.New(http.StatusText(status)),
+	}}
+}
+
+func TestCreateQueueRetryPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var retryer aws.Retryer
+	sq := mocks.NewMockSQSClient(ctrl)
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, _ *sqs.CreateQueueInput, opts ...func(*sqs.Options)) (*sqs.CreateQueueOutput, error) {
+			o := sqs.Options{Retryer: retry.NewStandard()}
+			for _, opt := range opts {
+				opt(&o)
+			}
+			retryer = o.Retryer
+			return &sqs.CreateQueueOutput{QueueUrl: aws.String("url")}, nil
+		},
+	)
+
+	queue := lifecycled.NewQueue("queue", "topic", sq, nil)
+	if err := queue.Create(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if retryer.MaxAttempts() < 2 {
+		t.Fatalf("expected the call to be retried and got %d attempts", retryer.MaxAttempts())
+	}
+
+	throttled := &smithy.GenericAPIError{Code: "RequestThrottled", Message: "slow down"}
+	tests := []struct {
+		description string
+		err         error
+		expected    bool
+	}{
+		{description: "throttled", err: throttled, expected: true},
+		{description: "too many requests", err: responseError(http.StatusTooManyRequests), expected: true},
+		{description: "unavailable", err: responseError(http.StatusServiceUnavailable), expected: true},
+		{description: "deleted recently", err: &smithy.GenericAPIError{Code: "AWS.SimpleQueueService.QueueDeletedRecently"}, expected: true},
+		{description: "invalid", err: &smithy.GenericAPIError{Code: "InvalidParameterValue"}},
+		{description: "canceled", err: &aws.RequestCanceledError{Err: context.Canceled}},
+	}
+	for _, tc := range tests {
+		if got := retryer.IsErrorRetryable(tc.err); got != tc.expected {
+			t.Errorf("%s: expected retryable to be %v and got %v", tc.description, tc.expected, got)
+		}
+	}
+
+	// Throttling backs off more than failures on every retry
+	for attempt := 1; attempt < retryer.MaxAttempts(); attempt++ {
+		throttleDelay, err := retryer.RetryDelay(attempt, throttled)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		failureDelay, err := retryer.RetryDelay(attempt, responseError(http.StatusInternalServerError))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if throttleDelay <= failureDelay {
+			t.Errorf("expected attempt %d to back off more when throttled and got %s and %s", attempt, throttleDelay, failureDelay)
+		}
+	}
+}
+
+func TestRetriesMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessages(sq, sn, nil, []byte(aws.ToString(newSQSMessage(instanceID).Body)))
+
+	var heartbeats int32
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).DoAndReturn(
+		func(_ context.Context, _ *autoscaling.RecordLifecycleActionHeartbeatInput, opts ...func(*autoscaling.Options)) (*autoscaling.RecordLifecycleActionHeartbeatOutput, error) {
+			// Simulates the SDK retrying the first heartbeat once
+			if atomic.AddInt32(&heartbeats, 1) == 1 {
+				o := autoscaling.Options{Retryer: retry.NewStandard()}
+				for _, opt := range opts {
+					opt(&o)
+				}
+				_, _ = o.Retryer.RetryDelay(1, &smithy.GenericAPIError{Code: "Throttling"})
+			}
+			return &autoscaling.RecordLifecycleActionHeartbeatOutput{}, nil
+		},
+	)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: 5 * time.Millisecond,
+	}, sq, sn, as, nil, logger)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(daemon.Metrics())
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	if err := daemon.Run(ctx, sleepyHandler{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := gatherMetrics(t, registry)["lifecycled_aws_retries_total"], 1.0; got != want {
+		t.Errorf("expected %v retries and got %v", want, got)
+	}
+}
+
+func TestAttemptTimeouts(t *testing.T) {
+	// The server hangs for the first attempts of each call, or until the test is done
+	done := make(chan struct{})
+	var attempts, hangs int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= atomic.LoadInt32(&hangs) {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-done:
+			}
+			return
+		}
+		fmt.Fprint(w, "<DeleteMessageResponse><DeleteMessageResult></DeleteMessageResult></DeleteMessageResponse>")
+	}))
+	defer server.Close()
+	defer close(done)
+
+	// The HTTP client of the clients has no timeouts of its own
+	config := lifecycled.DefaultConfig()
+	config.Endpoints = map[string]string{"sqs": server.URL}
+	cfg, err := lifecycled.NewAWSConfig(context.TODO(), config, "us-east-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cfg.HTTPClient = &http.Client{}
+	cfg.Credentials = aws.AnonymousCredentials{}
+
+	tests := []struct {
+		description string
+		hangs       int32
+		expectError bool
+	}{
+		{
+			description: "hung attempt is retried",
+			hangs:       1,
+		},
+		{
+			description: "every attempt hangs",
+			hangs:       100,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			atomic.StoreInt32(&attempts, 0)
+			atomic.StoreInt32(&hangs, tc.hangs)
+
+			queue := lifecycled.NewQueue("queue", "topic", sqs.NewFromConfig(cfg), nil)
+			queue.SetCallTimeout(50 * time.Millisecond)
+
+			err := queue.DeleteMessage(context.TODO(), "handle")
+			if !tc.expectError {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if got := atomic.LoadInt32(&attempts); got != 2 {
+					t.Errorf("expected 2 attempts and got %d", got)
+				}
+				return
+			}
+			// A call whose attempts all time out fails rather than being taken for a cancellation
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected the call to time out and got: %v", err)
+			}
+			if got := atomic.LoadInt32(&attempts); got < 2 {
+				t.Errorf("expected the attempts to be retried and got %d", got)
+			}
+		})
+	}
+}
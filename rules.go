@@ -0,0 +1,122 @@
+package lifecycled
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+)
+
+// Classes of autoscaling lifecycle hook messages.
+const (
+	// NoticeTermination is a termination notice, after which the daemon stops.
+	NoticeTermination = "termination"
+
+	// NoticeCheckpoint is a pause, e.g. for an instance refresh checkpoint. The handler is executed
+	// and the lifecycle action is completed with CONTINUE, but the instance is not going away and
+	// the daemon keeps running.
+	NoticeCheckpoint = "checkpoint"
+
+	// NoticeIgnore skips the message.
+	NoticeIgnore = "ignore"
+)
+
+// CheckpointNoticeType is the type of autoscaling notices that are classified as checkpoints,
+// which can be used to configure a different handler (see Daemon.SetHandler).
+const CheckpointNoticeType = "autoscaling-checkpoint"
+
+const terminatingTransition = "autoscaling:EC2_INSTANCE_TERMINATING"
+
+// NoticeRule classifies the autoscaling lifecycle hook messages that match it. The rules are
+// evaluated in order and the first match wins, and without a match only terminating transitions
+// are termination notices and other messages are ignored.
+type NoticeRule struct {
+	// Hook is a pattern (see path.Match) for the lifecycle hook name, which matches any hook if empty.
+	Hook string `yaml:"hook,omitempty"`
+
+	// Transition is the lifecycle transition, which matches any transition if empty.
+	Transition string `yaml:"transition,omitempty"`
+
+	// Notice is NoticeTermination, NoticeCheckpoint or NoticeIgnore.
+	Notice string `yaml:"notice"`
+}
+
+func (r NoticeRule) matches(msg *Message) bool {
+	if r.Transition != "" && r.Transition != msg.Transition {
+		return false
+	}
+	if r.Hook == "" {
+		return true
+	}
+	matched, _ := path.Match(r.Hook, msg.HookName)
+	return matched
+}
+
+// validate the rule, where i is its index for error messages.
+func (r NoticeRule) validate(i int) error {
+	switch r.Notice {
+	case NoticeTermination, NoticeCheckpoint, NoticeIgnore:
+	default:
+		return fmt.Errorf("autoscaling-rules[%d]: notice must be %s, %s or %s, got %q", i, NoticeTermination, NoticeCheckpoint, NoticeIgnore, r.Notice)
+	}
+	if _, err := path.Match(r.Hook, ""); err != nil {
+		return fmt.Errorf("autoscaling-rules[%d]: invalid hook pattern %q: %s", i, r.Hook, err)
+	}
+	return nil
+}
+
+// classify the message with the first rule that matches it.
+func classify(rules []NoticeRule, msg *Message) string {
+	for _, r := range rules {
+		if r.matches(msg) {
+			return r.Notice
+		}
+	}
+	if msg.Transition == terminatingTransition {
+		return NoticeTermination
+	}
+	return NoticeIgnore
+}
+
+// event is an EventBridge event, which is the message when lifecycle actions are
+// sent to the topic by an EventBridge rule instead of by the lifecycle hook. It embeds the
+// Message, so that a lifecycle hook message is parsed in the same pass: the keys of the hook
+// message are capitalised, and match its fields rather than those of the event exactly.
+type event struct {
+	Message
+	Source    string          `json:"source"`
+	EventTime time.Time       `json:"time"`
+	Detail    json.RawMessage `json:"detail"`
+}
+
+// parseLifecycleMessage parses a lifecycle hook message, or an EventBridge event for a lifecycle action.
+func parseLifecycleMessage(data []byte) (*Message, error) {
+	var e event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if e.Source != "aws.autoscaling" || len(e.Detail) == 0 {
+		return &e.Message, nil
+	}
+
+	var msg Message
+	if err := json.Unmarshal(e.Detail, &msg); err != nil {
+		return nil, fmt.Errorf("failed to parse event detail: %s", err)
+	}
+	if msg.Time.IsZero() {
+		msg.Time = e.EventTime
+	}
+	return &msg, nil
+}
+
+// mayConcern returns false if the lifecycle message can't be for the instance, because it is
+// valid JSON that doesn't mention the instance id and isn't a test notification of the group,
+// which is cheaper to check than parsing the message. The messages that may concern the
+// instance, and those that don't parse, are parsed and checked as before.
+func mayConcern(message []byte, instanceID string) bool {
+	if bytes.Contains(message, []byte(instanceID)) || bytes.Contains(message, []byte(TestNotificationEvent)) {
+		return true
+	}
+	return !json.Valid(message)
+}
@@ -0,0 +1,226 @@
+package lifecycled_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// readPayload reads a captured SNS message from testdata.
+func readPayload(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// expectQueueMessages is like expectQueueMessage, but receives each of the messages in turn. The
+// messages after the first are only received once the previous message has been handled.
+func expectQueueMessages(sq *mocks.MockSQSClient, sn *mocks.MockSNSClient, handled <-chan struct{}, bodies ...[]byte) {
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+
+	var next int
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(len(bodies)).DoAndReturn(
+		func(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+			// The SDK returns a canceled error when the context is done
+			canceled := &aws.RequestCanceledError{Err: context.Canceled}
+			if next == len(bodies) {
+				<-ctx.Done()
+				return nil, canceled
+			}
+			if next > 0 {
+				select {
+				case <-handled:
+				case <-ctx.Done():
+					return nil, canceled
+				}
+			}
+			body := bodies[next]
+			next++
+			return &sqs.ReceiveMessageOutput{
+				Messages: []sqstypes.Message{{Body: aws.String(string(body)), ReceiptHandle: aws.String("handle")}},
+			}, nil
+		},
+	)
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(len(bodies)).Return(nil, nil)
+	sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+	sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+}
+
+func TestParseCapturedMessages(t *testing.T) {
+	tests := []struct {
+		file       string
+		transition string
+		hook       string
+		token      string
+	}{
+		{
+			file:       "hook-termination.json",
+			transition: "autoscaling:EC2_INSTANCE_TERMINATING",
+			hook:       "drain",
+			token:      "12345678-1234-1234-1234-123456789012",
+		},
+		{
+			file:       "eventbridge-termination.json",
+			transition: "autoscaling:EC2_INSTANCE_TERMINATING",
+			hook:       "drain",
+			token:      "87654321-4321-4321-4321-210987654321",
+		},
+		{
+			file:       "eventbridge-checkpoint.json",
+			transition: "autoscaling:EC2_INSTANCE_LAUNCHING",
+			hook:       "refresh-checkpoint",
+			token:      "87654321-4321-4321-4321-210987654321",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			msg, _, err := lifecycled.ParseMessage(readPayload(t, tc.file))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got, want := msg.InstanceID, "i-000000000000"; got != want {
+				t.Errorf("expected instance id '%s' and got '%s'", want, got)
+			}
+			if got, want := msg.GroupName, "group"; got != want {
+				t.Errorf("expected group '%s' and got '%s'", want, got)
+			}
+			if msg.Transition != tc.transition || msg.HookName != tc.hook || msg.ActionToken != tc.token {
+				t.Errorf("unexpected message: %+v", msg)
+			}
+			if msg.Time.IsZero() {
+				t.Error("expected the message to have a time")
+			}
+		})
+	}
+}
+
+func TestAutoscalingSkipsUnclassifiedMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Without rules, the checkpoint is not a termination notice and is skipped
+	handled := make(chan struct{})
+	close(handled)
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessages(sq, sn, handled, readPayload(t, "eventbridge-checkpoint.json"), readPayload(t, "eventbridge-termination.json"))
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: time.Minute,
+	}, sq, sn, as, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	notice, err := daemon.Start(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	n, ok := notice.(lifecycled.DetailedNotice)
+	if !ok {
+		t.Fatal("expected a detailed notice")
+	}
+	if got, want := n.Transition(), "autoscaling:EC2_INSTANCE_TERMINATING"; got != want {
+		t.Errorf("expected the termination notice and got transition '%s'", got)
+	}
+}
+
+func TestAutoscalingCheckpointNotice(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handled := make(chan struct{})
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessages(sq, sn, handled, readPayload(t, "eventbridge-checkpoint.json"), readPayload(t, "hook-termination.json"))
+
+	var mu sync.Mutex
+	completed := make(map[string]string)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(_ context.Context, input *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			completed[aws.ToString(input.LifecycleHookName)] = aws.ToString(input.LifecycleActionResult)
+			return &autoscaling.CompleteLifecycleActionOutput{}, nil
+		},
+	)
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   "i-000000000000",
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: time.Minute,
+		AutoscalingRules: []lifecycled.NoticeRule{
+			{Hook: "refresh-*", Notice: lifecycled.NoticeCheckpoint},
+		},
+	}, sq, sn, as, nil, logger)
+
+	var checkpoints, terminations []string
+	daemon.SetHandler(lifecycled.CheckpointNoticeType, lifecycled.NoticeHandlerFunc(func(_ context.Context, n *lifecycled.Notice) error {
+		defer close(handled)
+		checkpoints = append(checkpoints, n.Transition)
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	summary, err := daemon.RunWithSummary(ctx, lifecycled.NoticeHandlerFunc(func(_ context.Context, n *lifecycled.Notice) error {
+		terminations = append(terminations, n.Type)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected the daemon to stop after the termination notice")
+	}
+
+	if len(checkpoints) != 1 || checkpoints[0] != "autoscaling:EC2_INSTANCE_LAUNCHING" {
+		t.Errorf("expected the checkpoint handler to be executed once and got %v", checkpoints)
+	}
+	if len(terminations) != 1 || terminations[0] != "autoscaling" {
+		t.Errorf("expected the default handler to be executed for the termination and got %v", terminations)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := completed["refresh-checkpoint"], "CONTINUE"; got != want {
+		t.Errorf("expected the checkpoint to be completed with %s and got '%s'", want, got)
+	}
+	if got, want := summary.Notice, "autoscaling"; got != want {
+		t.Errorf("expected the summary of the termination notice and got '%s'", got)
+	}
+	if got, want := len(summary.Results), 2; got != want {
+		t.Errorf("expected %d results and got %d", want, got)
+	}
+}
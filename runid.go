@@ -0,0 +1,79 @@
+package lifecycled
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// runIDEnv is the environment variable with the run id, for file handlers.
+const runIDEnv = "LIFECYCLED_RUN_ID"
+
+// maxCorrelationIDLength bounds the correlation ids that are accepted from lifecycle hooks.
+const maxCorrelationIDLength = 64
+
+// newRunID returns a short random id, which identifies the log lines for handling a notice.
+func newRunID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
+
+// correlatedNotice is implemented by notices that may carry a correlation id from the system
+// that caused the termination, which is used as the run id instead of a random one.
+type correlatedNotice interface {
+	CorrelationID() string
+}
+
+// runIDFor returns the correlation id of the notice if it has one, or a new run id.
+func runIDFor(notice TerminationNotice) string {
+	if n, ok := notice.(correlatedNotice); ok {
+		if id := n.CorrelationID(); id != "" {
+			return id
+		}
+	}
+	return newRunID()
+}
+
+// parseCorrelationID returns the correlationId of the notification metadata of a lifecycle
+// hook, if it is a JSON object with one, e.g. {"correlationId":"deploy-1234"}. Ids that are
+// too long or have characters other than letters, digits, '.', '_' and '-' are ignored, as
+// they are used in log fields and environment variables.
+func parseCorrelationID(metadata string) string {
+	var m struct {
+		CorrelationID string `json:"correlationId"`
+	}
+	if err := json.Unmarshal([]byte(metadata), &m); err != nil {
+		return ""
+	}
+	if len(m.CorrelationID) > maxCorrelationIDLength {
+		return ""
+	}
+	for _, r := range m.CorrelationID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return ""
+		}
+	}
+	return m.CorrelationID
+}
+
+// runIDKey is the context key of the run id of the notice being handled.
+type runIDKey struct{}
+
+// withRunID returns a context for handling the notice with the run id.
+func withRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, id)
+}
+
+// runIDFrom returns the run id of the notice being handled, which is empty outside of the daemon.
+func runIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,125 @@
+package lifecycled
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// secretFile is a -file setting that is set, with the setting of the secret that is read from it.
+type secretFile struct {
+	key   string
+	path  string
+	field reflect.Value
+
+	// secretKey is the setting of the secret, e.g. notify-webhook.
+	secretKey string
+}
+
+// secretFiles returns the -file settings that are set, which are tagged with the field of their secret.
+func (c *Config) secretFiles() []secretFile {
+	var files []secretFile
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("file")
+		if name == "" || v.Field(i).String() == "" {
+			continue
+		}
+		secret, _ := v.Type().FieldByName(name)
+		files = append(files, secretFile{
+			key:       strings.Split(field.Tag.Get("yaml"), ",")[0],
+			path:      v.Field(i).String(),
+			field:     v.FieldByName(name),
+			secretKey: strings.Split(secret.Tag.Get("yaml"), ",")[0],
+		})
+	}
+	return files
+}
+
+// SecretFiles returns the files of the -file settings that are set.
+func (c *Config) SecretFiles() []string {
+	var paths []string
+	for _, f := range c.secretFiles() {
+		paths = append(paths, f.path)
+	}
+	return paths
+}
+
+// validateSecretFiles checks that the secrets that are read from files are not also set.
+func (c *Config) validateSecretFiles() error {
+	for _, f := range c.secretFiles() {
+		if f.field.Kind() == reflect.String && f.field.String() != "" {
+			return invalid(f.key, "/etc/lifecycled/"+f.secretKey, "and %s are mutually exclusive", f.secretKey)
+		}
+	}
+	return nil
+}
+
+// LoadSecretFiles sets the secrets of the -file settings (e.g. notify-webhook-file) to the
+// contents of their files with surrounding whitespace trimmed, where each line of statsd-tags-file
+// is a tag. It fails if a file can't be read or is empty, and returns the files that other users
+// can read, which should be restricted. The lifecycled command calls it on start-up, which is
+// after Validate, and again on SIGHUP to pick up rotated secrets (see Daemon.ReloadSecrets).
+func (c *Config) LoadSecretFiles() (readable []string, err error) {
+	for _, f := range c.secretFiles() {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.key, err)
+		}
+		data, err := ioutil.ReadFile(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.key, err)
+		}
+		secret := strings.TrimSpace(string(data))
+		if secret == "" {
+			return nil, fmt.Errorf("failed to read %s: %s is empty", f.key, f.path)
+		}
+
+		if f.field.Kind() == reflect.String {
+			f.field.SetString(secret)
+		} else {
+			var tags []string
+			for _, line := range strings.Split(secret, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					tags = append(tags, line)
+				}
+			}
+			f.field.Set(reflect.ValueOf(tags))
+		}
+		if worldReadable(info) {
+			readable = append(readable, f.path)
+		}
+	}
+	return readable, nil
+}
+
+// worldReadable returns true if other users can read the file. Permissions on Windows are ACLs,
+// which the mode doesn't reflect.
+func worldReadable(info os.FileInfo) bool {
+	return runtime.GOOS != "windows" && info.Mode().Perm()&0004 != 0
+}
+
+// statsdTags returns the StatsdTags followed by the StatsdSecretTags.
+func (c *Config) statsdTags() []string {
+	return append(append([]string{}, c.StatsdTags...), c.StatsdSecretTags...)
+}
+
+// ReloadSecrets replaces the token of the completion webhook, the url of the notification webhook
+// and the statsd tags with those of the config, e.g. once LoadSecretFiles has read them again,
+// so that rotated secrets are used without a restart. A webhook that was not configured when
+// the daemon was created is not added.
+func (d *Daemon) ReloadSecrets(config *Config) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p, ok := d.publisher.(*WebhookPublisher); ok {
+		p.setToken(config.CompletionWebhookToken)
+	}
+	if n, ok := d.notifier.(*WebhookNotifier); ok {
+		n.setURL(config.NotifyWebhook)
+	}
+	d.metrics.statsd.setTags(config.statsdTags())
+}
@@ -0,0 +1,185 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+func TestLoadSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]struct {
+		content string
+		mode    os.FileMode
+	}{
+		"token":       {"  token\n", 0600},
+		"webhook":     {"https://hooks.slack.com/services/secret\n", 0644},
+		"statsd-tags": {"api_key:secret\n\n  team:platform\n", 0600},
+	}
+	for name, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(f.content), f.mode); err != nil {
+			t.Fatal(err)
+		}
+		// The mode of WriteFile is masked by the umask
+		if err := os.Chmod(filepath.Join(dir, name), f.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &lifecycled.Config{
+		CompletionWebhookTokenFile: filepath.Join(dir, "token"),
+		NotifyWebhookFile:          filepath.Join(dir, "webhook"),
+		StatsdTagsFile:             filepath.Join(dir, "statsd-tags"),
+		StatsdTags:                 []string{"env:test"},
+	}
+	readable, err := config.LoadSecretFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got, want := config.CompletionWebhookToken, "token"; got != want {
+		t.Errorf("expected token %q and got %q", want, got)
+	}
+	if got, want := config.NotifyWebhook, "https://hooks.slack.com/services/secret"; got != want {
+		t.Errorf("expected webhook %q and got %q", want, got)
+	}
+	if got, want := config.StatsdSecretTags, []string{"api_key:secret", "team:platform"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected statsd tags %q and got %q", want, got)
+	}
+	var expectReadable []string
+	if runtime.GOOS != "windows" {
+		expectReadable = []string{filepath.Join(dir, "webhook")}
+	}
+	if !reflect.DeepEqual(readable, expectReadable) {
+		t.Errorf("expected readable files %q and got %q", expectReadable, readable)
+	}
+
+	// The secrets are redacted wherever the configuration is logged
+	canonical, err := lifecycled.CanonicalConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), `"token"`) {
+		t.Errorf("expected the secrets to be redacted and got %s", data)
+	}
+	redacted := config.Redacted()
+	if got, want := redacted.StatsdSecretTags, []string{"REDACTED", "REDACTED"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected redacted statsd tags %q and got %q", want, got)
+	}
+	if got, want := config.StatsdSecretTags[0], "api_key:secret"; got != want {
+		t.Errorf("expected the config to keep statsd tag %q and got %q", want, got)
+	}
+}
+
+func TestLoadSecretFilesErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "empty"), []byte(" \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		path        string
+		expectError string
+	}{
+		{
+			description: "missing file",
+			path:        filepath.Join(dir, "missing"),
+			expectError: "failed to read notify-webhook-file",
+		},
+		{
+			description: "empty file",
+			path:        filepath.Join(dir, "empty"),
+			expectError: "is empty",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			config := &lifecycled.Config{NotifyWebhookFile: tc.path}
+			_, err := config.LoadSecretFiles()
+			if err == nil || !strings.Contains(err.Error(), tc.expectError) {
+				t.Errorf("expected an error containing %q and got %v", tc.expectError, err)
+			}
+			if config.NotifyWebhook != "" {
+				t.Errorf("expected no webhook and got %q", config.NotifyWebhook)
+			}
+		})
+	}
+}
+
+func TestReloadSecrets(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		authorization string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:             "i-000000000000",
+		CompletionWebhook:      server.URL,
+		CompletionWebhookToken: "old",
+	}, nil, nil, nil, nil, logger)
+	daemon.ReloadSecrets(&lifecycled.Config{CompletionWebhookToken: "new"})
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, failingHandler{}); err == nil {
+		t.Fatal("expected handler to fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := authorization, "Bearer new"; got != want {
+		t.Errorf("expected authorization %q and got %q", want, got)
+	}
+}
+
+func TestWebhookNotifierRedactsURL(t *testing.T) {
+	// Listen and close to get a port that refuses connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	notifier := lifecycled.NewWebhookNotifier("http://"+addr+"/services/secret", lifecycled.NotifyFormatJSON, nil)
+	err = notifier.Notify(context.TODO(), &lifecycled.Notification{Event: lifecycled.NotifyReceived})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected the url to be redacted from the error and got %q", err)
+	}
+}
@@ -0,0 +1,194 @@
+package lifecycled
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/sirupsen/logrus"
+)
+
+// bogusActionToken is the lifecycle action token of the calls that check the permissions of
+// heartbeats and completion. It is never the token of a lifecycle action, and the calls don't
+// name the instance, so they are rejected once they are authorized without affecting one.
+const bogusActionToken = "00000000-0000-0000-0000-000000000000"
+
+// SelfCheck checks that the AWS permissions that the autoscaling listener needs are granted to
+// it, with cheap calls that have no side effects, rather than a missing permission being found
+// when the instance terminates. The calls that need a lifecycle action use a bogus token, so
+// when they are authorized they fail with a validation error, which passes, while a call that
+// is denied fails. It returns a result for each permission, named after it, and skips those
+// that need the group or lifecycle hook of the instance when they are not found. The key of an
+// encrypted topic is checked with the KMS client (see TopicEncryptionCheck), which can be nil.
+func SelfCheck(ctx context.Context, queue *Queue, asgClient AutoscalingClient, kmsClient KMSClient, instanceID string) []CheckResult {
+	var results []CheckResult
+	check := func(permission string, err error) bool {
+		results = append(results, permissionResult(permission, permission, err))
+		return err == nil
+	}
+	skip := func(detail string, permissions ...string) {
+		for _, permission := range permissions {
+			results = append(results, CheckResult{Name: permission, Status: CheckSkip, Detail: detail})
+		}
+	}
+
+	_, err := queue.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queue.url),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	check("sqs:GetQueueAttributes", err)
+	topic, err := queue.snsClient.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{
+		TopicArn: aws.String(queue.topicArn),
+	})
+	var keyID string
+	if check("sns:GetTopicAttributes", err) && topic != nil {
+		keyID = topic.Attributes["KmsMasterKeyId"]
+	}
+
+	role := checkLifecycleHook(ctx, asgClient, queue.topicArn, instanceID, check, skip)
+	if keyID != "" {
+		results = append(results, checkTopicKey(ctx, kmsClient, queue.topicArn, keyID, role))
+	}
+	return results
+}
+
+// checkLifecycleHook checks the permissions of the autoscaling API with check, or skips them,
+// and returns the role that the termination hook of the instance publishes to the topic with,
+// if it is found.
+func checkLifecycleHook(ctx context.Context, asgClient AutoscalingClient, topic, instanceID string, check func(string, error) bool, skip func(string, ...string)) string {
+	instances, err := asgClient.DescribeAutoScalingInstances(ctx, &autoscaling.DescribeAutoScalingInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	var group string
+	if check("autoscaling:DescribeAutoScalingInstances", err) && len(instances.AutoScalingInstances) > 0 {
+		group = aws.ToString(instances.AutoScalingInstances[0].AutoScalingGroupName)
+	}
+	if group == "" {
+		skip("the autoscaling group of the instance is not known",
+			"autoscaling:DescribeLifecycleHooks", "autoscaling:RecordLifecycleActionHeartbeat", "autoscaling:CompleteLifecycleAction")
+		return ""
+	}
+
+	hooks, err := asgClient.DescribeLifecycleHooks(ctx, &autoscaling.DescribeLifecycleHooksInput{
+		AutoScalingGroupName: aws.String(group),
+	})
+	var hook, role string
+	if check("autoscaling:DescribeLifecycleHooks", err) {
+		for _, h := range hooks.LifecycleHooks {
+			if aws.ToString(h.LifecycleTransition) == terminatingTransition && aws.ToString(h.NotificationTargetARN) == topic {
+				hook, role = aws.ToString(h.LifecycleHookName), aws.ToString(h.RoleARN)
+				break
+			}
+		}
+	}
+	if hook == "" {
+		skip("the termination hook of "+group+" for the topic is not known",
+			"autoscaling:RecordLifecycleActionHeartbeat", "autoscaling:CompleteLifecycleAction")
+		return ""
+	}
+	heartbeat, complete := lifecycleActionPermissions(ctx, asgClient, group, hook)
+	check("autoscaling:RecordLifecycleActionHeartbeat", heartbeat)
+	check("autoscaling:CompleteLifecycleAction", complete)
+	return role
+}
+
+// lifecycleActionPermissions returns the errors of a heartbeat and of completing a lifecycle
+// action of the hook with the bogus token, which are validation errors if they are authorized.
+func lifecycleActionPermissions(ctx context.Context, asgClient AutoscalingClient, group, hook string) (heartbeat, complete error) {
+	_, heartbeat = asgClient.RecordLifecycleActionHeartbeat(ctx, &autoscaling.RecordLifecycleActionHeartbeatInput{
+		AutoScalingGroupName: aws.String(group),
+		LifecycleHookName:    aws.String(hook),
+		LifecycleActionToken: aws.String(bogusActionToken),
+	})
+	_, complete = asgClient.CompleteLifecycleAction(ctx, &autoscaling.CompleteLifecycleActionInput{
+		AutoScalingGroupName:  aws.String(group),
+		LifecycleHookName:     aws.String(hook),
+		LifecycleActionToken:  aws.String(bogusActionToken),
+		LifecycleActionResult: aws.String(ResultContinue),
+	})
+	return heartbeat, complete
+}
+
+// permissionResult returns the result of the check named name of the permission for the error
+// of a call that needs it. The check passes if the call was authorized, including when it was
+// then rejected as invalid, and fails if it was denied or failed otherwise.
+func permissionResult(name, permission string, err error) CheckResult {
+	switch {
+	case err == nil:
+		return CheckResult{Name: name, Status: CheckPass, Detail: permission + " is allowed"}
+	case isAuthorizationError(err):
+		return CheckResult{Name: name, Status: CheckFail, Detail: permission + " is denied: " + err.Error()}
+	case isValidationError(err):
+		return CheckResult{Name: name, Status: CheckPass, Detail: permission + " is allowed, the call was rejected as invalid as expected"}
+	default:
+		return CheckResult{Name: name, Status: CheckFail, Detail: permission + " could not be checked: " + err.Error()}
+	}
+}
+
+// isValidationError returns true if the AWS API rejected the parameters of the call, which it
+// does after the call is authorized.
+func isValidationError(err error) bool {
+	e, ok := apiError(err)
+	return ok && e.ErrorCode() == "ValidationError"
+}
+
+// selfCheckResults are the results of the self-checks of the autoscaling listeners, see Healthy.
+type selfCheckResults struct {
+	mu      sync.Mutex
+	topics  []string
+	results map[string][]CheckResult
+}
+
+// set records the results of the listener of the topic, replacing those of the checks with the
+// same names, and logs each of them, denied permissions as errors.
+func (s *selfCheckResults) set(log *logrus.Entry, topic string, results []CheckResult) {
+	for _, r := range results {
+		entry := log.WithField("permission", r.Name).WithField("status", r.Status)
+		if r.Status == CheckFail {
+			entry.Error(r.Detail)
+		} else {
+			entry.Info(r.Detail)
+		}
+	}
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.results == nil {
+		s.results = make(map[string][]CheckResult)
+	}
+	if _, ok := s.results[topic]; !ok {
+		s.topics = append(s.topics, topic)
+	}
+	for _, r := range results {
+		i := 0
+		for i < len(s.results[topic]) && s.results[topic][i].Name != r.Name {
+			i++
+		}
+		if i == len(s.results[topic]) {
+			s.results[topic] = append(s.results[topic], r)
+		} else {
+			s.results[topic][i] = r
+		}
+	}
+}
+
+// get returns the results of the self-checks, in the order of the topics of their listeners,
+// or nil if none has run.
+func (s *selfCheckResults) get() []CheckResult {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var results []CheckResult
+	for _, topic := range s.topics {
+		results = append(results, s.results[topic]...)
+	}
+	return results
+}
@@ -0,0 +1,233 @@
+package lifecycled_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	autoscalingtypes "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/golang/mock/gomock"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// expectCreateQueue expects the queue to be created with the url "url".
+func expectCreateQueue(sq *mocks.MockSQSClient) {
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+}
+
+// expectSelfCheck expects the calls of the self-check, once the queue is created, which find
+// the group and hook of the instance, and returns the errors of the heartbeat and completion.
+func expectSelfCheck(sq *mocks.MockSQSClient, sn *mocks.MockSNSClient, as *mocks.MockAutoscalingClient, topic string, heartbeat, complete error) {
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *sqs.GetQueueAttributesInput, _ ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+			if aws.ToString(input.QueueUrl) != "url" {
+				return nil, &smithy.GenericAPIError{Code: "UnexpectedInput"}
+			}
+			return &sqs.GetQueueAttributesOutput{}, nil
+		},
+	)
+	sn.EXPECT().GetTopicAttributes(gomock.Any(), gomock.Any()).Return(&sns.GetTopicAttributesOutput{}, nil)
+	as.EXPECT().DescribeAutoScalingInstances(gomock.Any(), gomock.Any()).Return(&autoscaling.DescribeAutoScalingInstancesOutput{
+		AutoScalingInstances: []autoscalingtypes.AutoScalingInstanceDetails{{AutoScalingGroupName: aws.String("group")}},
+	}, nil)
+	as.EXPECT().DescribeLifecycleHooks(gomock.Any(), gomock.Any()).Return(&autoscaling.DescribeLifecycleHooksOutput{
+		LifecycleHooks: []autoscalingtypes.LifecycleHook{{
+			LifecycleHookName:     aws.String("terminating"),
+			LifecycleTransition:   aws.String("autoscaling:EC2_INSTANCE_TERMINATING"),
+			NotificationTargetARN: aws.String(topic),
+		}},
+	}, nil)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *autoscaling.RecordLifecycleActionHeartbeatInput, _ ...func(*autoscaling.Options)) (*autoscaling.RecordLifecycleActionHeartbeatOutput, error) {
+			// The instance is never named, so that an active lifecycle action can't be matched
+			if input.InstanceId != nil || aws.ToString(input.LifecycleHookName) != "terminating" {
+				return nil, &smithy.GenericAPIError{Code: "UnexpectedInput"}
+			}
+			return nil, heartbeat
+		},
+	)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *autoscaling.CompleteLifecycleActionInput, _ ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+			if input.InstanceId != nil {
+				return nil, &smithy.GenericAPIError{Code: "UnexpectedInput"}
+			}
+			return nil, complete
+		},
+	)
+}
+
+func TestSelfCheck(t *testing.T) {
+	topic := "arn:aws:sns:us-east-1:123456789012:lifecycled"
+	rejected := &smithy.GenericAPIError{Code: "ValidationError", Message: "No active Lifecycle Action found with token 00000000-0000-0000-0000-000000000000"}
+	denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "User is not authorized to perform: autoscaling:RecordLifecycleActionHeartbeat"}
+
+	tests := []struct {
+		description string
+		heartbeat   error
+		complete    error
+		expected    string
+	}{
+		{
+			description: "rejected as invalid",
+			heartbeat:   rejected,
+			complete:    rejected,
+			expected:    "pass,pass,pass,pass,pass,pass",
+		},
+		{
+			description: "heartbeat denied",
+			heartbeat:   denied,
+			complete:    rejected,
+			expected:    "pass,pass,pass,pass,fail,pass",
+		},
+		{
+			description: "completion failed otherwise",
+			heartbeat:   nil,
+			complete:    &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"},
+			expected:    "pass,pass,pass,pass,pass,fail",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			as := mocks.NewMockAutoscalingClient(ctrl)
+			expectCreateQueue(sq)
+			expectSelfCheck(sq, sn, as, topic, tc.heartbeat, tc.complete)
+
+			queue := lifecycled.NewQueue("queue", topic, sq, sn)
+			if err := queue.Create(context.TODO()); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			results := lifecycled.SelfCheck(context.TODO(), queue, as, nil, "i-000000000000")
+
+			var names, statuses []string
+			for _, r := range results {
+				names = append(names, r.Name)
+				statuses = append(statuses, r.Status)
+			}
+			if got, want := strings.Join(names, ","), "sqs:GetQueueAttributes,sns:GetTopicAttributes,autoscaling:DescribeAutoScalingInstances,autoscaling:DescribeLifecycleHooks,autoscaling:RecordLifecycleActionHeartbeat,autoscaling:CompleteLifecycleAction"; got != want {
+				t.Errorf("expected the permissions %s and got %s", want, got)
+			}
+			if got := strings.Join(statuses, ","); got != tc.expected {
+				t.Errorf("expected %s and got %s: %+v", tc.expected, got, results)
+			}
+		})
+	}
+}
+
+func TestSelfCheckWithoutGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "AWS.SimpleQueueService.AccessDenied"})
+	sn.EXPECT().GetTopicAttributes(gomock.Any(), gomock.Any()).Return(&sns.GetTopicAttributesOutput{}, nil)
+	as.EXPECT().DescribeAutoScalingInstances(gomock.Any(), gomock.Any()).Return(&autoscaling.DescribeAutoScalingInstancesOutput{}, nil)
+
+	queue := lifecycled.NewQueue("queue", "topic", sq, sn)
+	results := lifecycled.SelfCheck(context.TODO(), queue, as, nil, "i-000000000000")
+
+	expected := map[string]string{
+		"sqs:GetQueueAttributes":                     lifecycled.CheckFail,
+		"sns:GetTopicAttributes":                     lifecycled.CheckPass,
+		"autoscaling:DescribeAutoScalingInstances":   lifecycled.CheckPass,
+		"autoscaling:DescribeLifecycleHooks":         lifecycled.CheckSkip,
+		"autoscaling:RecordLifecycleActionHeartbeat": lifecycled.CheckSkip,
+		"autoscaling:CompleteLifecycleAction":        lifecycled.CheckSkip,
+	}
+	if got, want := len(results), len(expected); got != want {
+		t.Fatalf("expected %d results and got %d: %+v", want, got, results)
+	}
+	for _, r := range results {
+		if want := expected[r.Name]; r.Status != want {
+			t.Errorf("expected %s to %s and got %s: %s", r.Name, want, r.Status, r.Detail)
+		}
+	}
+}
+
+func TestDaemonSelfCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	topic := "arn:aws:sns:us-east-1:123456789012:lifecycled"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	expectCreateQueue(sq)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+		func(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	)
+	sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
+	sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, nil)
+
+	// The permission to complete the lifecycle action is missing
+	rejected := &smithy.GenericAPIError{Code: "ValidationError", Message: "No active Lifecycle Action found with token"}
+	expectSelfCheck(sq, sn, as, topic, rejected, &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized"})
+
+	logger, hook := logrustest.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID: "i-000000000000",
+		SNSTopic:   topic,
+		SelfCheck:  true,
+	}, sq, sn, as, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := daemon.Start(ctx)
+		done <- err
+	}()
+
+	for len(daemon.Status().SelfCheck) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the self-check")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if err := daemon.Healthy(time.Hour); err == nil || !strings.Contains(err.Error(), "autoscaling:CompleteLifecycleAction") {
+		t.Errorf("expected the daemon to be unhealthy for the denied permission and got: %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var logged int
+	for _, e := range hook.AllEntries() {
+		if e.Data["permission"] == "autoscaling:CompleteLifecycleAction" && e.Data["status"] == lifecycled.CheckFail {
+			logged++
+		}
+	}
+	if logged != 1 {
+		t.Errorf("expected the denied permission to be logged once and got %d", logged)
+	}
+}
@@ -0,0 +1,58 @@
+package lifecycled
+
+import (
+	"context"
+	"sync"
+)
+
+// Shutdown policies for the lifecycle action of a notice that is in flight when the daemon shuts down.
+const (
+	// ShutdownContinue completes the lifecycle action with CONTINUE, so the termination proceeds.
+	ShutdownContinue = "continue"
+
+	// ShutdownAbandon completes the lifecycle action with ABANDON.
+	ShutdownAbandon = "abandon"
+
+	// ShutdownLeave doesn't complete the lifecycle action, so the hook's default result applies when it times out.
+	ShutdownLeave = "leave"
+)
+
+type shutdownKey struct{}
+
+// shutdown records why a daemon context was cancelled.
+type shutdown struct {
+	mu     sync.Mutex
+	reason string
+}
+
+// WithShutdown returns a context for running the daemon, and a function which cancels it with
+// the reason for shutting down (e.g. the signal that was received). The reason is logged
+// when the shutdown policy is applied to notices that are in flight.
+func WithShutdown(parent context.Context) (context.Context, func(reason string)) {
+	s := &shutdown{}
+	ctx, cancel := context.WithCancel(context.WithValue(parent, shutdownKey{}, s))
+	return ctx, func(reason string) {
+		s.mu.Lock()
+		if s.reason == "" {
+			s.reason = reason
+		}
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+// shutdownReason returns the reason that the context was cancelled, which is the
+// context error if it was not cancelled by the function returned by WithShutdown.
+func shutdownReason(ctx context.Context) string {
+	if s, ok := ctx.Value(shutdownKey{}).(*shutdown); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.reason != "" {
+			return s.reason
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err.Error()
+	}
+	return ""
+}
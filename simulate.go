@@ -0,0 +1,83 @@
+package lifecycled
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// simulatedName is the group and lifecycle hook name of simulated messages.
+const simulatedName = "lifecycled-simulate"
+
+// SimulatedMessage returns a synthetic lifecycle hook message for the instance and transition,
+// with a random action token, which can be changed before it is simulated.
+func SimulatedMessage(instanceID, transition string) *Message {
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	return &Message{
+		Time:        time.Now().UTC(),
+		GroupName:   simulatedName,
+		InstanceID:  instanceID,
+		ActionToken: hex.EncodeToString(token),
+		Transition:  transition,
+		HookName:    simulatedName,
+	}
+}
+
+// Simulate handles the message with the handler as it would be if it were received by the
+// autoscaling listener, with the same environment, arguments, timeouts and signals, and returns
+// the summary. The message is classified by the autoscaling rules, and it is an error if it would
+// be ignored. Nothing is sent to the autoscaling API: termination is not verified, heartbeats
+// are not sent and the result that the lifecycle action would be completed with is logged, so
+// the daemon doesn't need any clients.
+func (d *Daemon) Simulate(ctx context.Context, msg *Message, handler Handler) (*Summary, error) {
+	class := classify(d.autoscalingOptions.Rules, msg)
+	if class == NoticeIgnore {
+		return nil, fmt.Errorf("cannot simulate a %s message for hook %s, it would be ignored", msg.Transition, msg.HookName)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(Envelope{Type: "Notification", Subject: "Auto Scaling: Lifecycle action simulated by lifecycled", Time: msg.Time, Message: string(data)})
+	if err != nil {
+		return nil, err
+	}
+
+	noticeType := "autoscaling"
+	if class == NoticeCheckpoint {
+		noticeType = CheckpointNoticeType
+	}
+	now := time.Now()
+	n := &autoscalingTerminationNotice{
+		noticeType:     noticeType,
+		class:          class,
+		message:        msg,
+		autoscaling:    &replayClient{skipCompletion: true, log: d.logger, notice: "simulated"},
+		options:        d.autoscalingOptions.withDefaults(),
+		receivedAt:     now,
+		publishedAt:    now,
+		sentAt:         now,
+		raw:            raw,
+		skipHeartbeats: true,
+	}
+	n.options.VerifyTermination = false
+
+	d.logger.WithFields(logrus.Fields{
+		"instanceId":    msg.InstanceID,
+		"transition":    msg.Transition,
+		"lifecycleHook": msg.HookName,
+		"notice":        noticeType,
+	}).Info("Simulating autoscaling notice")
+
+	summary, err := d.handle(ctx, n, handler)
+	summary.Results = []Result{n.Result()}
+	summary.Interrupted = ctx.Err() != nil
+	summary.Err = err
+	return summary, err
+}
@@ -0,0 +1,192 @@
+package lifecycled
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snsCertHost matches the hosts that SNS serves its signing certificates from, in each partition.
+var snsCertHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// maxSigningCerts is the number of signing certificates that are cached, which SNS rotates rarely.
+const maxSigningCerts = 16
+
+// maxSigningCertSize bounds the size of a signing certificate that is fetched.
+const maxSigningCertSize = 64 << 10
+
+// errCertUnavailable is wrapped by the errors of fetching a signing certificate that may succeed
+// when retried, e.g. a failure to connect or a 5xx response, rather than an invalid certificate.
+var errCertUnavailable = errors.New("signing certificate unavailable")
+
+// SignatureVerifier verifies the signatures of SNS messages, so that a message that was sent to
+// the queue by anything other than the topic (e.g. a principal with sqs:SendMessage) isn't
+// trusted. The signing certificates are fetched over HTTPS from SNS and cached.
+type SignatureVerifier struct {
+	// Client fetches the signing certificates.
+	Client *http.Client
+
+	// CertHost matches the hosts of the signing certificates that are trusted, which are those
+	// of SNS (see NewSignatureVerifier).
+	CertHost *regexp.Regexp
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// NewSignatureVerifier returns a verifier that fetches the signing certificates with the client
+// from the hosts of SNS.
+func NewSignatureVerifier(client *http.Client) *SignatureVerifier {
+	return &SignatureVerifier{Client: client, CertHost: snsCertHost}
+}
+
+// Verify returns an error unless the envelope is signed by SNS and was published to the topic.
+// Messages that are delivered raw have no envelope to verify, so are rejected.
+func (v *SignatureVerifier) Verify(ctx context.Context, env *Envelope, topic string) error {
+	if env.Signature == "" {
+		return errors.New("message is not signed, raw message delivery can't be verified")
+	}
+	if topic != "" && env.TopicArn != topic {
+		return fmt.Errorf("message was published to topic %q rather than %q", env.TopicArn, topic)
+	}
+	var hash crypto.Hash
+	switch env.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported signature version %q", env.SignatureVersion)
+	}
+	signing, err := env.signingString()
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+
+	cert, err := v.cert(ctx, env.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("signing certificate doesn't have an rsa key")
+	}
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(signing))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(signing))
+		digest = sum[:]
+	}
+	if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	return nil
+}
+
+// signingString returns the string that SNS signs for the type of the message, which is the
+// names and values of its fields in order, each followed by a newline.
+func (e *Envelope) signingString() (string, error) {
+	var fields [][2]string
+	switch e.Type {
+	case "Notification":
+		fields = [][2]string{{"Message", e.Message}, {"MessageId", e.MessageID}}
+		if e.Subject != "" {
+			fields = append(fields, [2]string{"Subject", e.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", e.Timestamp}, [2]string{"TopicArn", e.TopicArn}, [2]string{"Type", e.Type})
+	case "SubscriptionConfirmation", "UnsubscribeConfirmation":
+		fields = [][2]string{
+			{"Message", e.Message},
+			{"MessageId", e.MessageID},
+			{"SubscribeURL", e.SubscribeURL},
+			{"Timestamp", e.Timestamp},
+			{"Token", e.Token},
+			{"TopicArn", e.TopicArn},
+			{"Type", e.Type},
+		}
+	default:
+		return "", fmt.Errorf("unsupported message type %q", e.Type)
+	}
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(f[0] + "\n" + f[1] + "\n")
+	}
+	return b.String(), nil
+}
+
+// cert returns the signing certificate at the URL, which must be an https URL of a trusted
+// host, from the cache or fetched.
+func (v *SignatureVerifier) cert(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	u, err := url.Parse(certURL)
+	if err != nil || u.Scheme != "https" || !v.CertHost.MatchString(u.Hostname()) || !strings.HasSuffix(u.Path, ".pem") {
+		return nil, fmt.Errorf("signing certificate url %q is not a certificate of sns", certURL)
+	}
+
+	v.mu.Lock()
+	cert, ok := v.certs[certURL]
+	v.mu.Unlock()
+	if ok && time.Now().Before(cert.NotAfter) {
+		return cert, nil
+	}
+
+	if cert, err = v.fetch(ctx, certURL); err != nil {
+		return nil, err
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, fmt.Errorf("signing certificate %s is not valid at %s", certURL, now.UTC().Format(time.RFC3339))
+	}
+	v.mu.Lock()
+	if v.certs == nil || len(v.certs) >= maxSigningCerts {
+		v.certs = map[string]*x509.Certificate{}
+	}
+	v.certs[certURL] = cert
+	v.mu.Unlock()
+	return cert, nil
+}
+
+func (v *SignatureVerifier) fetch(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	req, err := http.NewRequest(http.MethodGet, certURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCertUnavailable, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSigningCertSize))
+	switch {
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("%w: %s returned %s", errCertUnavailable, certURL, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("failed to fetch signing certificate %s: %s", certURL, resp.Status)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", errCertUnavailable, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("signing certificate %s is not a pem certificate", certURL)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
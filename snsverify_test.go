@@ -0,0 +1,328 @@
+package lifecycled_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// signingServer serves a self-signed signing certificate at /cert.pem, and fails with a 500 for
+// /unavailable.pem.
+type signingServer struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	fetches int32
+}
+
+func newSigningServer(t *testing.T) *signingServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	s := &signingServer{key: key}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cert.pem":
+			atomic.AddInt32(&s.fetches, 1)
+			w.Write(cert)
+		case "/unavailable.pem":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return s
+}
+
+// verifier returns a verifier that trusts the certificates of the server.
+func (s *signingServer) verifier() *lifecycled.SignatureVerifier {
+	v := lifecycled.NewSignatureVerifier(s.Client())
+	v.CertHost = regexp.MustCompile(`^127\.0\.0\.1$`)
+	return v
+}
+
+// sign signs the notification with the version of the signature.
+func (s *signingServer) sign(t *testing.T, env *lifecycled.Envelope, version string) {
+	env.SignatureVersion = version
+	env.SigningCertURL = s.URL + "/cert.pem"
+	signing := "Message\n" + env.Message + "\nMessageId\n" + env.MessageID + "\n"
+	if env.Subject != "" {
+		signing += "Subject\n" + env.Subject + "\n"
+	}
+	signing += "Timestamp\n" + env.Timestamp + "\nTopicArn\n" + env.TopicArn + "\nType\n" + env.Type + "\n"
+
+	hash, digest := crypto.SHA256, sha256.Sum256([]byte(signing))
+	sum := digest[:]
+	if version == "1" {
+		digest := sha1.Sum([]byte(signing))
+		hash, sum = crypto.SHA1, digest[:]
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, hash, sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Signature = base64.StdEncoding.EncodeToString(signature)
+}
+
+// newNotification returns a notification of the topic with the lifecycle hook message.
+func newNotification(topic, message string) *lifecycled.Envelope {
+	return &lifecycled.Envelope{
+		Type:      "Notification",
+		MessageID: "3f7c2a10-5b4e-4c8e-9a1d-0123456789ab",
+		TopicArn:  topic,
+		Subject:   "Auto Scaling: Lifecycle action 'TERMINATING' for instance i-000000000000",
+		Message:   message,
+		Timestamp: "2024-01-02T15:04:05.000Z",
+	}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	server := newSigningServer(t)
+	defer server.Close()
+
+	topic := "arn:aws:sns:us-east-1:123456789012:lifecycled"
+	tests := []struct {
+		description string
+		modify      func(*lifecycled.Envelope)
+		expectError string
+	}{
+		{
+			description: "signature version 1",
+			modify:      func(e *lifecycled.Envelope) { server.sign(t, e, "1") },
+		},
+		{
+			description: "signature version 2",
+			modify:      func(e *lifecycled.Envelope) { server.sign(t, e, "2") },
+		},
+		{
+			description: "without a subject",
+			modify: func(e *lifecycled.Envelope) {
+				e.Subject = ""
+				server.sign(t, e, "2")
+			},
+		},
+		{
+			description: "tampered message",
+			modify: func(e *lifecycled.Envelope) {
+				server.sign(t, e, "2")
+				e.Message = `{"EC2InstanceId":"i-111111111111"}`
+			},
+			expectError: "invalid signature",
+		},
+		{
+			description: "another topic",
+			modify: func(e *lifecycled.Envelope) {
+				e.TopicArn = "arn:aws:sns:us-east-1:210987654321:attacker"
+				server.sign(t, e, "2")
+			},
+			expectError: "rather than",
+		},
+		{
+			description: "unsigned",
+			modify:      func(e *lifecycled.Envelope) {},
+			expectError: "not signed",
+		},
+		{
+			description: "untrusted certificate host",
+			modify: func(e *lifecycled.Envelope) {
+				server.sign(t, e, "2")
+				e.SigningCertURL = "https://sns.us-east-1.amazonaws.com.example.com/cert.pem"
+			},
+			expectError: "not a certificate of sns",
+		},
+		{
+			description: "certificate over http",
+			modify: func(e *lifecycled.Envelope) {
+				server.sign(t, e, "2")
+				e.SigningCertURL = strings.Replace(e.SigningCertURL, "https://", "http://", 1)
+			},
+			expectError: "not a certificate of sns",
+		},
+		{
+			description: "unknown signature version",
+			modify: func(e *lifecycled.Envelope) {
+				server.sign(t, e, "2")
+				e.SignatureVersion = "3"
+			},
+			expectError: "unsupported signature version",
+		},
+	}
+
+	verifier := server.verifier()
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			env := newNotification(topic, `{"EC2InstanceId":"i-000000000000"}`)
+			tc.modify(env)
+
+			err := verifier.Verify(context.TODO(), env, topic)
+			if tc.expectError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.expectError) {
+				t.Errorf("expected an error containing '%s' and got: %v", tc.expectError, err)
+			}
+		})
+	}
+
+	// The certificate is fetched once and cached
+	if got := atomic.LoadInt32(&server.fetches); got != 1 {
+		t.Errorf("expected the certificate to be fetched once and got %d", got)
+	}
+}
+
+func TestAutoscalingListenerSignatures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := newSigningServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	instanceID := "i-000000000000"
+	topic := "arn:aws:sns:us-east-1:123456789012:lifecycled"
+	message := `{"AutoScalingGroupName":"group","EC2InstanceId":"i-000000000000","LifecycleActionToken":"token","LifecycleTransition":"autoscaling:EC2_INSTANCE_TERMINATING","LifecycleHookName":"hook"}`
+
+	body := func(env *lifecycled.Envelope) *string {
+		data, err := json.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return aws.String(string(data))
+	}
+	valid := newNotification(topic, message)
+	server.sign(t, valid, "2")
+	forged := newNotification(topic, message)
+	forged.SignatureVersion, forged.SigningCertURL, forged.Signature = "2", server.URL+"/cert.pem", base64.StdEncoding.EncodeToString([]byte("forged"))
+	unavailable := newNotification(topic, message)
+	server.sign(t, unavailable, "2")
+	unavailable.SigningCertURL = server.URL + "/unavailable.pem"
+
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("subscription"),
+	}, nil)
+	var received int32
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).DoAndReturn(
+		func(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+			if atomic.AddInt32(&received, 1) > 1 {
+				<-ctx.Done()
+				return nil, &aws.RequestCanceledError{Err: context.Canceled}
+			}
+			return &sqs.ReceiveMessageOutput{Messages: []sqstypes.Message{
+				{Body: body(forged), ReceiptHandle: aws.String("forged")},
+				{Body: body(unavailable), ReceiptHandle: aws.String("unavailable")},
+				{Body: body(valid), ReceiptHandle: aws.String("valid")},
+			}}, nil
+		},
+	)
+	// The message whose certificate is unavailable is left in the queue
+	var deleted []string
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(_ context.Context, input *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+			deleted = append(deleted, aws.ToString(input.ReceiptHandle))
+			return &sqs.DeleteMessageOutput{}, nil
+		},
+	)
+
+	queue := lifecycled.NewQueue("queue", topic, sq, sn)
+	listener := lifecycled.NewAutoscalingListener(instanceID, queue, nil, lifecycled.AutoscalingOptions{
+		QuarantineDir:     dir,
+		SignatureVerifier: server.verifier(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	logger, hook := logrus.NewNullLogger()
+	notices := make(chan lifecycled.TerminationNotice, 1)
+	done := make(chan error)
+	go func() {
+		done <- listener.Start(ctx, notices, logger.WithField("listener", "autoscaling"))
+	}()
+
+	// Only the message with a valid signature is trusted
+	select {
+	case <-notices:
+	case <-ctx.Done():
+		t.Fatal("expected a notice for the signed message")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got, want := strings.Join(deleted, ","), "forged,valid"; got != want {
+		t.Errorf("expected messages %s to be deleted and got %s", want, got)
+	}
+	var rejected int
+	for _, e := range hook.AllEntries() {
+		if e.Message == "Rejected message with an invalid signature" && e.Data["part"] == lifecycled.ParseFailureSignature {
+			rejected++
+		}
+	}
+	if rejected != 1 {
+		t.Errorf("expected the forged message to be rejected and got %d rejections", rejected)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*-signature.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected the forged message to be quarantined and got %v", files)
+	}
+}
@@ -3,16 +3,16 @@ package lifecycled
 import (
 	"context"
 	"errors"
-	"strings"
+	"fmt"
+	"io/ioutil"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/sirupsen/logrus"
 )
 
 // NewSpotListener ...
-func NewSpotListener(instanceID string, metadata *ec2metadata.EC2Metadata, interval time.Duration) *SpotListener {
+func NewSpotListener(instanceID string, metadata *imds.Client, interval time.Duration) *SpotListener {
 	return &SpotListener{
 		listenerType: "spot",
 		instanceID:   instanceID,
@@ -25,8 +25,13 @@ func NewSpotListener(instanceID string, metadata *ec2metadata.EC2Metadata, inter
 type SpotListener struct {
 	listenerType string
 	instanceID   string
-	metadata     *ec2metadata.EC2Metadata
+	metadata     *imds.Client
 	interval     time.Duration
+	status       *listenerStatus
+}
+
+func (l *SpotListener) setStatus(s *listenerStatus) {
+	l.status = s
 }
 
 // Type returns a string describing the listener type.
@@ -36,13 +41,18 @@ func (l *SpotListener) Type() string {
 
 // Start the spot termination notice listener.
 func (l *SpotListener) Start(ctx context.Context, notices chan<- TerminationNotice, log *logrus.Entry) error {
-	if !l.metadata.Available() {
-		return errors.New("ec2 metadata is not available")
+	if _, err := getMetadata(ctx, l.metadata, "instance-id"); err != nil {
+		return fmt.Errorf("ec2 metadata is not available: %w", err)
 	}
 
+	l.status.setState(ListenerRunning)
+
 	ticker := time.NewTicker(l.interval)
 	defer ticker.Stop()
 
+	samples := newLogSampler()
+	defer samples.flush()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -50,16 +60,25 @@ func (l *SpotListener) Start(ctx context.Context, notices chan<- TerminationNoti
 		case <-ticker.C:
 			log.Debug("Polling ec2 metadata for spot termination notices")
 
-			out, err := l.metadata.GetMetadata("spot/termination-time")
+			out, err := getMetadata(ctx, l.metadata, "spot/termination-time")
 			if err != nil {
-				if e, ok := err.(awserr.Error); ok && strings.Contains(e.OrigErr().Error(), "404") {
+				// Ignore error if the context was cancelled (i.e. we are shutting down)
+				if isCanceled(err) && ctx.Err() != nil {
+					return nil
+				}
+				if isNotFound(err) {
 					// Metadata returns 404 when there is no termination notice available
+					samples.recovered(log, "Recovered from failing to get spot termination")
+					l.status.polled(nil)
 					continue
 				} else {
-					log.WithError(err).Warn("Failed to get spot termination")
+					samples.warn(log, err, "Failed to get spot termination")
+					l.status.polled(err)
 					continue
 				}
 			}
+			samples.recovered(log, "Recovered from failing to get spot termination")
+			l.status.polled(nil)
 			if out == "" {
 				log.Error("Empty response from metadata")
 				continue
@@ -69,12 +88,22 @@ func (l *SpotListener) Start(ctx context.Context, notices chan<- TerminationNoti
 				log.WithError(err).Error("Failed to parse termination time")
 				continue
 			}
-			notices <- &spotTerminationNotice{
+			notice := &spotTerminationNotice{
 				noticeType:      l.Type(),
 				instanceID:      l.instanceID,
 				transition:      "ec2:SPOT_INSTANCE_TERMINATION",
 				terminationTime: t,
+				receivedAt:      time.Now(),
+				raw:             []byte(out),
 			}
+			select {
+			case notices <- notice:
+			case <-ctx.Done():
+				return nil
+			}
+
+			// There is only ever one termination notice for a spot instance
+			<-ctx.Done()
 			return nil
 		}
 	}
@@ -85,12 +114,54 @@ type spotTerminationNotice struct {
 	instanceID      string
 	transition      string
 	terminationTime time.Time
+	receivedAt      time.Time
+	raw             []byte
 }
 
 func (n *spotTerminationNotice) Type() string {
 	return n.noticeType
 }
 
-func (n *spotTerminationNotice) Handle(ctx context.Context, handler Handler, _ *logrus.Entry) error {
-	return handler.Execute(ctx, n.transition, n.instanceID, n.terminationTime.Format(time.RFC3339))
+func (n *spotTerminationNotice) InstanceID() string {
+	return n.instanceID
+}
+
+func (n *spotTerminationNotice) Transition() string {
+	return n.transition
+}
+
+func (n *spotTerminationNotice) ReceivedAt() time.Time {
+	return n.receivedAt
+}
+
+func (n *spotTerminationNotice) Raw() []byte {
+	return n.raw
+}
+
+func (n *spotTerminationNotice) Handle(ctx context.Context, handler Handler, log *logrus.Entry) error {
+	return executeHandler(ctx, handler, &Notice{
+		Type:            n.noticeType,
+		Transition:      n.transition,
+		InstanceID:      n.instanceID,
+		Args:            []string{n.transition, n.instanceID, n.terminationTime.Format(time.RFC3339)},
+		TerminationTime: n.terminationTime,
+		Log:             log,
+	})
+}
+
+// getMetadata returns the instance metadata at the path, e.g. instance-id.
+func getMetadata(ctx context.Context, metadata *imds.Client, path string) (string, error) {
+	if metadata == nil {
+		return "", errors.New("ec2 metadata client is not configured")
+	}
+	out, err := metadata.GetMetadata(ctx, &imds.GetMetadataInput{Path: path})
+	if err != nil {
+		return "", err
+	}
+	defer out.Content.Close()
+	data, err := ioutil.ReadAll(out.Content)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
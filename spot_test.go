@@ -0,0 +1,228 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+func TestSpotNoticeDetails(t *testing.T) {
+	instanceID := "i-000000000000"
+	terminationTime := "2006-01-02T15:04:05+02:00"
+
+	server := newMetadataStub(instanceID, terminationTime)
+	defer server.Close()
+
+	metadata := imds.New(imds.Options{Endpoint: server.URL})
+
+	logger, _ := logrus.NewNullLogger()
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:           instanceID,
+		SpotListener:         true,
+		SpotListenerInterval: 1 * time.Millisecond,
+	}, nil, nil, nil, metadata, logger)
+
+	before := time.Now()
+	notice, err := daemon.Start(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	n, ok := notice.(lifecycled.DetailedNotice)
+	if !ok {
+		t.Fatalf("expected a detailed notice and got %T", notice)
+	}
+	if got, want := n.InstanceID(), instanceID; got != want {
+		t.Errorf("expected instance id '%s' and got '%s'", want, got)
+	}
+	if got, want := n.Transition(), "ec2:SPOT_INSTANCE_TERMINATION"; got != want {
+		t.Errorf("expected transition '%s' and got '%s'", want, got)
+	}
+	if got, want := string(n.Raw()), terminationTime; got != want {
+		t.Errorf("expected raw message '%s' and got '%s'", want, got)
+	}
+	if n.ReceivedAt().Before(before) {
+		t.Errorf("expected notice to be received after %s and got %s", before, n.ReceivedAt())
+	}
+}
+
+func TestSpotListenerPollFailure(t *testing.T) {
+	instanceID := "i-000000000000"
+
+	var failing int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.RequestURI == "/latest/meta-data/instance-id":
+			w.Write([]byte(instanceID))
+		case atomic.LoadInt32(&failing) == 1:
+			http.Error(w, "500 - internal server error", http.StatusInternalServerError)
+		default:
+			http.Error(w, "404 - not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	metadata := imds.New(imds.Options{
+		Endpoint: server.URL,
+		Retryer:  aws.NopRetryer{},
+	})
+	notifications, bodies := notificationServer(t, http.StatusOK)
+	defer notifications.Close()
+
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:           instanceID,
+		SpotListener:         true,
+		SpotListenerInterval: time.Millisecond,
+		PollFailureThreshold: 20 * time.Millisecond,
+	}, nil, nil, nil, metadata, logger)
+	daemon.SetNotifier(lifecycled.NewWebhookNotifier(notifications.URL, lifecycled.NotifyFormatJSON, notifications.Client()), time.Second,
+		lifecycled.NotifyPollFailing, lifecycled.NotifyPollRecovered)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	stopped := make(chan struct{})
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		daemon.Start(ctx)
+	}()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(3 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+	waitFor("the listener to alert", func() bool { return len(bodies()) == 1 })
+	if err := daemon.Healthy(time.Hour); err == nil {
+		t.Error("expected the daemon to be unhealthy while the listener is failing to poll")
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	waitFor("the listener to recover", func() bool { return len(bodies()) == 2 })
+	if err := daemon.Healthy(time.Hour); err != nil {
+		t.Errorf("expected the daemon to be healthy once the listener recovered and got: %s", err)
+	}
+
+	for i, want := range []string{lifecycled.NotifyPollFailing, lifecycled.NotifyPollRecovered} {
+		var n lifecycled.Notification
+		if err := json.Unmarshal(bodies()[i], &n); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n.Event != want || n.Listener != "spot" || n.Failures < 1 {
+			t.Errorf("expected a %s notification for the spot listener and got %+v", want, n)
+		}
+	}
+
+	var alerts, recoveries int
+	for _, e := range hook.AllEntries() {
+		switch e.Message {
+		case "Listener has failed to poll for longer than the threshold and can't receive notices":
+			alerts++
+		case "Listener recovered after failing to poll":
+			recoveries++
+		}
+	}
+	if alerts != 1 || recoveries != 1 {
+		t.Errorf("expected one alert and one recovery to be logged and got %d and %d", alerts, recoveries)
+	}
+}
+
+func TestSpotListenerLogSampling(t *testing.T) {
+	instanceID := "i-000000000000"
+
+	var failing int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.RequestURI == "/latest/meta-data/instance-id":
+			w.Write([]byte(instanceID))
+		case atomic.LoadInt32(&failing) == 1:
+			http.Error(w, "500 - internal server error", http.StatusInternalServerError)
+		default:
+			http.Error(w, "404 - not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	metadata := imds.New(imds.Options{
+		Endpoint: server.URL,
+		Retryer:  aws.NopRetryer{},
+	})
+
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:           instanceID,
+		SpotListener:         true,
+		SpotListenerInterval: time.Millisecond,
+	}, nil, nil, nil, metadata, logger)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	stopped := make(chan struct{})
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		daemon.Start(ctx)
+	}()
+
+	consecutiveFailures := func() int {
+		for _, l := range daemon.Status().Listeners {
+			return l.ConsecutiveFailures
+		}
+		return 0
+	}
+	for deadline := time.Now().Add(3 * time.Second); consecutiveFailures() < 5; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the listener to fail")
+		}
+	}
+	atomic.StoreInt32(&failing, 0)
+	for deadline := time.Now().Add(3 * time.Second); consecutiveFailures() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the listener to recover")
+		}
+	}
+	cancel()
+	<-stopped
+
+	var failures, summaries, recoveries int
+	for _, e := range hook.AllEntries() {
+		switch {
+		case e.Message == "Failed to get spot termination":
+			failures++
+		case strings.HasPrefix(e.Message, "Failed to get spot termination (repeated "):
+			summaries++
+			if e.Data["repeated"].(int) < 4 {
+				t.Errorf("expected the summary to count the repeats and got %v", e.Data["repeated"])
+			}
+		case e.Message == "Recovered from failing to get spot termination":
+			recoveries++
+			if recoveries == 1 && summaries == 0 {
+				t.Error("expected the summary to be logged before the recovery")
+			}
+		}
+	}
+	if failures != 1 || summaries != 1 || recoveries != 1 {
+		t.Errorf("expected the first failure, a summary and the recovery to be logged and got %d, %d and %d", failures, summaries, recoveries)
+	}
+}
@@ -0,0 +1,118 @@
+package lifecycled
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// StartupInfo describes what the daemon is running with, for the start-up log entry and the
+// state file, so that it can be told from the logs of a run without access to the instance.
+type StartupInfo struct {
+	Version    string   `json:"version"`
+	Commit     string   `json:"commit,omitempty"`
+	BuildDate  string   `json:"buildDate,omitempty"`
+	InstanceID string   `json:"instanceId"`
+	Region     string   `json:"region,omitempty"`
+	Listeners  []string `json:"listeners"`
+
+	// DisabledListeners are the types of the listeners that are disabled (see Config.DisabledListeners).
+	DisabledListeners []string `json:"disabledListeners,omitempty"`
+
+	// Tags are added to the AWS resources that the daemon creates (see Config.Tags).
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Config is the effective configuration, keyed by the names in the configuration file,
+	// with secrets redacted and settings that are not configured omitted (see CanonicalConfig).
+	Config map[string]interface{} `json:"config"`
+
+	// Proxy is the proxy configuration of the environment, if a proxy is set.
+	Proxy *ProxyInfo `json:"proxy,omitempty"`
+
+	// Sources are where each setting came from (e.g. flag, env, file or default), if known.
+	Sources map[string]string `json:"sources,omitempty"`
+
+	// Credentials is where the credentials of the AWS clients came from, if they could be
+	// retrieved (see CredentialSource).
+	Credentials string `json:"credentials,omitempty"`
+}
+
+// NewStartupInfo returns the start-up information of a daemon with the configuration and build,
+// once the instance ID has been resolved.
+func NewStartupInfo(cfg *Config, build BuildInfo, region string) (StartupInfo, error) {
+	info := StartupInfo{
+		Version:    build.Version,
+		Commit:     build.Commit,
+		BuildDate:  build.BuildDate,
+		InstanceID: cfg.InstanceID,
+		Region:     region,
+		Listeners:  cfg.Listeners(),
+		Proxy:      NewProxyInfo(cfg),
+	}
+	if disabled := cfg.DisabledListeners(); len(disabled) > 0 {
+		info.DisabledListeners = disabled
+	}
+	if len(cfg.Tags) > 0 {
+		info.Tags = cfg.Tags
+	}
+	config, err := CanonicalConfig(cfg)
+	if err != nil {
+		return StartupInfo{}, err
+	}
+	info.Config = config
+	return info, nil
+}
+
+// Listeners returns the types of the listeners that are enabled by the configuration. The
+// autoscaling listener is enabled by the SNSTopic unless NoAutoscaling is set.
+func (c *Config) Listeners() []string {
+	listeners := []string{}
+	if c.SpotListener {
+		listeners = append(listeners, "spot")
+	}
+	if c.autoscalingListener() {
+		listeners = append(listeners, "autoscaling")
+	}
+	return listeners
+}
+
+// DisabledListeners returns the types of the listeners that are disabled by the configuration.
+func (c *Config) DisabledListeners() []string {
+	disabled := []string{}
+	for _, listener := range NoticeTypes {
+		if !contains(c.Listeners(), listener) {
+			disabled = append(disabled, listener)
+		}
+	}
+	return disabled
+}
+
+// autoscalingListener returns true if the autoscaling listener is enabled.
+func (c *Config) autoscalingListener() bool {
+	return c.SNSTopic != "" && !c.NoAutoscaling
+}
+
+// Fields returns the information as the fields of a log entry.
+func (i StartupInfo) Fields() logrus.Fields {
+	fields := logrus.Fields{
+		"version":    i.Version,
+		"commit":     i.Commit,
+		"buildDate":  i.BuildDate,
+		"instanceId": i.InstanceID,
+		"region":     i.Region,
+		"listeners":  i.Listeners,
+		"config":     i.Config,
+		"sources":    i.Sources,
+	}
+	if len(i.DisabledListeners) > 0 {
+		fields["disabledListeners"] = i.DisabledListeners
+	}
+	if len(i.Tags) > 0 {
+		fields["tags"] = i.Tags
+	}
+	if i.Proxy != nil {
+		fields["proxy"] = i.Proxy
+	}
+	if i.Credentials != "" {
+		fields["credentials"] = i.Credentials
+	}
+	return fields
+}
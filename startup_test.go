@@ -0,0 +1,51 @@
+package lifecycled_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/triarius/lifecycled"
+)
+
+func TestNewStartupInfo(t *testing.T) {
+	cfg := lifecycled.DefaultConfig()
+	cfg.InstanceID = "i-000000000000"
+	cfg.SNSTopic = "arn:aws:sns:us-east-1:000000000000:lifecycle"
+	cfg.SpotListenerInterval = 10 * time.Second
+	cfg.NotifyWebhook = "https://hooks.example.com/secret"
+	cfg.CompletionWebhookToken = "token"
+
+	info, err := lifecycled.NewStartupInfo(cfg, lifecycled.BuildInfo{Version: "v1.0.0", Commit: "abc123"}, "us-east-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := info.Listeners, []string{"spot", "autoscaling"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected listeners %v and got %v", want, got)
+	}
+	if info.InstanceID != "i-000000000000" {
+		t.Errorf("expected the instance id and got '%s'", info.InstanceID)
+	}
+
+	for key, want := range map[string]interface{}{
+		"sns-topic":                cfg.SNSTopic,
+		"spot-listener":            true,
+		"spot-listener-interval":   "10s",
+		"handler-concurrency":      json.Number("1"),
+		"notify-webhook":           "REDACTED",
+		"completion-webhook-token": "REDACTED",
+	} {
+		if got := info.Config[key]; got != want {
+			t.Errorf("expected %s to be %v and got %v", key, want, got)
+		}
+	}
+	if _, ok := info.Config["completion-webhook"]; ok {
+		t.Error("expected settings that are not configured to be omitted")
+	}
+
+	// The configuration itself is not redacted
+	if cfg.NotifyWebhook != "https://hooks.example.com/secret" {
+		t.Errorf("expected the configuration to be unchanged and got '%s'", cfg.NotifyWebhook)
+	}
+}
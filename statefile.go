@@ -0,0 +1,114 @@
+package lifecycled
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// State is the content of the state file.
+type State struct {
+	Status
+	PID       int       `json:"pid"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Stopped is true once the daemon has shut down cleanly, and the state is final.
+	Stopped bool `json:"stopped"`
+
+	// Startup is what the daemon was started with, if it was set with StateFile.SetStartup.
+	Startup *StartupInfo `json:"startup,omitempty"`
+}
+
+// StateFile writes the status of a Daemon to a JSON file, so that it can be monitored
+// without an HTTP port. The file is updated on every state transition and at an interval,
+// which means that a stale modification time indicates that lifecycled has crashed.
+type StateFile struct {
+	path     string
+	daemon   *Daemon
+	interval time.Duration
+	startup  *StartupInfo
+}
+
+// NewStateFile returns a StateFile which writes the daemon status to path
+// on every change, and otherwise at the given interval.
+func NewStateFile(path string, daemon *Daemon, interval time.Duration) *StateFile {
+	return &StateFile{path: path, daemon: daemon, interval: interval}
+}
+
+// SetStartup includes the start-up information in the state. It must be called before Run.
+func (f *StateFile) SetStartup(info StartupInfo) {
+	f.startup = &info
+}
+
+// Run updates the state file until the context is cancelled, and then writes the final state.
+func (f *StateFile) Run(ctx context.Context, log *logrus.Entry) {
+	log = log.WithField("path", f.path)
+	write := func(stopped bool) {
+		if err := f.Write(stopped); err != nil {
+			log.WithError(err).Warn("Failed to write state file")
+		}
+	}
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	write(false)
+	for {
+		select {
+		case <-ctx.Done():
+			write(true)
+			return
+		case <-f.daemon.changed:
+			write(false)
+		case <-ticker.C:
+			write(false)
+		}
+	}
+}
+
+// Write the current state to the file, atomically.
+func (f *StateFile) Write(stopped bool) error {
+	data, err := json.MarshalIndent(State{
+		Status:    f.daemon.Status(),
+		PID:       os.Getpid(),
+		UpdatedAt: time.Now(),
+		Stopped:   stopped,
+		Startup:   f.startup,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(f.path, append(data, '\n'), 0644)
+}
+
+// writeFileAtomic writes the data to a temporary file which is renamed over
+// the file, so that readers never see a partial write.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
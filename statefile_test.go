@@ -0,0 +1,120 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+func readState(t *testing.T, path string) lifecycled.State {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read state file: %s", err)
+	}
+	var state lifecycled.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("failed to parse state file: %s", err)
+	}
+	return state
+}
+
+func TestStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000"}, nil, nil, nil, nil, logger)
+
+	path := filepath.Join(dir, "state.json")
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lifecycled.NewStateFile(path, daemon, time.Hour).Run(ctx, logger.WithField("test", t.Name()))
+	}()
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, failingHandler{}); err == nil {
+		t.Fatal("expected handler to fail")
+	}
+
+	// The state file is updated when the status changes
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			if readState(t, path).NoticesHandled == 1 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected state file to be updated after handling a notice")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	state := readState(t, path)
+	if got, want := state.PID, os.Getpid(); got != want {
+		t.Errorf("expected pid %d and got %d", want, got)
+	}
+	if got, want := state.InstanceID, "i-000000000000"; got != want {
+		t.Errorf("expected instance id '%s' and got '%s'", want, got)
+	}
+	if got, want := state.LastError, "failed"; got != want {
+		t.Errorf("expected last error '%s' and got '%s'", want, got)
+	}
+	if !state.Stopped {
+		t.Error("expected the final state to be stopped")
+	}
+
+	// Only the state file should remain, temporary files are renamed over it
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected only the state file and got %d files", len(files))
+	}
+}
+
+func TestStateFileStartup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger, _ := logrus.NewNullLogger()
+	cfg := &lifecycled.Config{InstanceID: "i-000000000000", SpotListener: true}
+	daemon := lifecycled.NewDaemon(cfg, nil, nil, nil, nil, logger)
+
+	startup, err := lifecycled.NewStartupInfo(cfg, lifecycled.BuildInfo{Version: "v1.0.0", Commit: "abc123"}, "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "state.json")
+	stateFile := lifecycled.NewStateFile(path, daemon, time.Hour)
+	stateFile.SetStartup(startup)
+	if err := stateFile.Write(false); err != nil {
+		t.Fatal(err)
+	}
+
+	state := readState(t, path)
+	if state.Startup == nil {
+		t.Fatal("expected the start-up information in the state file")
+	}
+	if state.Startup.Version != "v1.0.0" || state.Startup.Commit != "abc123" || state.Startup.Region != "us-east-1" {
+		t.Errorf("expected the version, commit and region and got %+v", state.Startup)
+	}
+}
@@ -0,0 +1,74 @@
+package lifecycled
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdPrefix is the prefix of the names of the metrics sent to statsd.
+const statsdPrefix = "lifecycled."
+
+// NewStatsdSink returns a sink which sends metrics to the statsd agent at the UDP address,
+// with the DogStatsD tags (e.g. env:production) on every metric.
+func NewStatsdSink(addr string, tags []string) (*StatsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdSink{conn: conn, tags: tags}, nil
+}
+
+// StatsdSink sends metrics to a statsd agent in the DogStatsD format. Sending is fire and
+// forget, so metrics are lost if the agent is not running. A nil *StatsdSink discards metrics.
+type StatsdSink struct {
+	conn net.Conn
+
+	mu   sync.Mutex
+	tags []string
+}
+
+// setTags replaces the tags that are added to every metric (see Daemon.ReloadSecrets).
+func (s *StatsdSink) setTags(tags []string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.tags = tags
+	s.mu.Unlock()
+}
+
+// count increments the counter.
+func (s *StatsdSink) count(name string, tags ...string) {
+	s.send(name, "1|c", tags)
+}
+
+// timing records the duration in milliseconds.
+func (s *StatsdSink) timing(name string, d time.Duration, tags ...string) {
+	s.send(name, fmt.Sprintf("%d|ms", d.Milliseconds()), tags)
+}
+
+func (s *StatsdSink) send(name, value string, tags []string) {
+	if s == nil {
+		return
+	}
+	line := statsdPrefix + name + ":" + value
+	s.mu.Lock()
+	all := append(append([]string{}, s.tags...), tags...)
+	s.mu.Unlock()
+	if len(all) > 0 {
+		line += "|#" + strings.Join(all, ",")
+	}
+	// The agent may not be listening, and metrics are never worth failing for
+	_, _ = s.conn.Write([]byte(line))
+}
+
+// Close the connection to the agent.
+func (s *StatsdSink) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
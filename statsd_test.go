@@ -0,0 +1,92 @@
+package lifecycled_test
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+)
+
+func TestStatsdMetrics(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:    "i-000000000000",
+		StatsdAddress: agent.LocalAddr().String(),
+		StatsdTags:    []string{"env:test"},
+	}, nil, nil, nil, nil, logger)
+
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, failingHandler{}); err == nil {
+		t.Fatal("expected the handler to fail")
+	}
+
+	var lines []string
+	buf := make([]byte, 1024)
+	for len(lines) < 2 {
+		agent.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := agent.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("expected %d metrics and got %q: %s", 2, lines, err)
+		}
+		// The duration varies, so only the name and tags are compared
+		line := string(buf[:n])
+		if strings.HasPrefix(line, "lifecycled.handler_duration:") {
+			line = "lifecycled.handler_duration" + line[strings.Index(line, "|"):]
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	expected := []string{
+		"lifecycled.handler_duration|ms|#env:test,notice:fake,result:failure",
+		"lifecycled.handler_failures:1|c|#env:test,notice:fake",
+	}
+	for i, want := range expected {
+		if lines[i] != want {
+			t.Errorf("expected metric '%s' and got '%s'", want, lines[i])
+		}
+	}
+}
+
+func TestStatsdAgentAbsent(t *testing.T) {
+	// Nothing listens on the port once it's closed, which must not fail the handler
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := agent.LocalAddr().String()
+	agent.Close()
+
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000", StatsdAddress: addr}, nil, nil, nil, nil, logger)
+	for i := 0; i < 3; i++ {
+		if err := daemon.Handle(context.TODO(), fakeNotice{}, &countingHandler{}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+}
+
+func TestStatsdInvalidAddress(t *testing.T) {
+	logger, hook := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{InstanceID: "i-000000000000", StatsdAddress: "localhost"}, nil, nil, nil, nil, logger)
+	if err := daemon.Handle(context.TODO(), fakeNotice{}, &countingHandler{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var warned bool
+	for _, e := range hook.AllEntries() {
+		warned = warned || strings.Contains(e.Message, "Failed to configure statsd")
+	}
+	if !warned {
+		t.Error("expected the invalid statsd address to be logged")
+	}
+}
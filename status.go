@@ -0,0 +1,400 @@
+package lifecycled
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ListenerState describes what a listener is currently doing.
+type ListenerState string
+
+// Listener states reported in the daemon status.
+const (
+	ListenerStarting ListenerState = "starting"
+	ListenerRunning  ListenerState = "running"
+	ListenerStopped  ListenerState = "stopped"
+	ListenerFailed   ListenerState = "failed"
+)
+
+// Status is a point in time snapshot of the daemon state.
+type Status struct {
+	Build          BuildInfo         `json:"build"`
+	InstanceID     string            `json:"instanceId"`
+	StartedAt      time.Time         `json:"startedAt"`
+	Listeners      []ListenerStatus  `json:"listeners"`
+	NoticesHandled int               `json:"noticesHandled"`
+	Handling       []HandlerActivity `json:"handling,omitempty"`
+	LastError      string            `json:"lastError,omitempty"`
+
+	// CredentialsError describes the AWS API calls that have failed repeatedly for their
+	// credentials, e.g. because the session of the assumed role expired and can't be renewed.
+	CredentialsError string `json:"credentialsError,omitempty"`
+
+	// SelfCheck are the results of checking the AWS permissions of the autoscaling listener when
+	// it started, if it was enabled (see AutoscalingOptions.SelfCheck).
+	SelfCheck []CheckResult `json:"selfCheck,omitempty"`
+
+	// DisabledListeners are the types of the listeners that are disabled by the configuration.
+	DisabledListeners []string `json:"disabledListeners,omitempty"`
+}
+
+// ListenerStatus describes the state of a single listener.
+type ListenerStatus struct {
+	Type      string        `json:"type"`
+	State     ListenerState `json:"state"`
+	Since     time.Time     `json:"since"`
+	LastPoll  time.Time     `json:"lastPoll"`
+	LastError string        `json:"lastError,omitempty"`
+
+	// QueueURL of the SQS queue that the autoscaling listener polls, and Topic that it is
+	// subscribed to.
+	QueueURL string `json:"queueUrl,omitempty"`
+	Topic    string `json:"topic,omitempty"`
+
+	// Degraded is set while the listener of one of several topics has failed, and is restarted
+	// in the background while the daemon continues with the listeners of the other topics.
+	Degraded bool `json:"degraded,omitempty"`
+
+	// LastTest is the last test message that the listener received (see SendTestMessage).
+	LastTest *TestReceipt `json:"lastTest,omitempty"`
+
+	// ConsecutiveFailures is the number of polls that failed since the last successful poll,
+	// and Alerting is set once polls have failed for longer than the poll failure threshold.
+	ConsecutiveFailures int       `json:"consecutiveFailures,omitempty"`
+	FailingSince        time.Time `json:"failingSince,omitempty"`
+	Alerting            bool      `json:"alerting,omitempty"`
+
+	// PollMode is fast or idle for a listener that polls adaptively (see
+	// AutoscalingOptions.PollMaxIdleGap), and NextPoll is when it polls next while idle.
+	PollMode string    `json:"pollMode,omitempty"`
+	NextPoll time.Time `json:"nextPoll,omitempty"`
+}
+
+// TestReceipt describes a test message that was received.
+type TestReceipt struct {
+	ID         string    `json:"id"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// HandlerActivity describes a notice that is currently being handled.
+type HandlerActivity struct {
+	Notice    string    `json:"notice"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// PID of the file handler that is running, if any.
+	PID int `json:"pid,omitempty"`
+
+	notice           TerminationNotice
+	processStartedAt time.Time
+}
+
+// listenerStatus is the mutable state behind a ListenerStatus. A nil
+// listenerStatus is valid and discards all updates, so that listeners
+// can be used without a Daemon.
+type listenerStatus struct {
+	mu       sync.Mutex
+	status   ListenerStatus
+	onChange func()
+
+	// onPollFailure is called with the status when polls have failed for failureThreshold, and
+	// with the status before recovering (recovered is true) when a poll then succeeds.
+	failureThreshold time.Duration
+	onPollFailure    func(status ListenerStatus, recovered bool)
+}
+
+func newListenerStatus(listenerType string) *listenerStatus {
+	return &listenerStatus{status: ListenerStatus{
+		Type:  listenerType,
+		State: ListenerStopped,
+		Since: time.Now(),
+	}}
+}
+
+func (s *listenerStatus) setState(state ListenerState) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status.State = state
+	s.status.Since = time.Now()
+	if state == ListenerRunning {
+		s.status.Degraded = false
+	}
+	s.mu.Unlock()
+
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// setQueueURL records the URL of the queue that the listener polls.
+func (s *listenerStatus) setQueueURL(url string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status.QueueURL = url
+	s.mu.Unlock()
+}
+
+// setTopic records the topic that the queue of the listener subscribes to.
+func (s *listenerStatus) setTopic(topic string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status.Topic = topic
+	s.mu.Unlock()
+}
+
+// setDegraded records that the listener failed, while the listeners of the other topics run.
+func (s *listenerStatus) setDegraded() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status.Degraded = true
+	s.mu.Unlock()
+
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// setPollMode records the poll mode of the listener, which changes the status when the mode does.
+func (s *listenerStatus) setPollMode(mode string, next time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	changed := s.status.PollMode != mode
+	s.status.PollMode = mode
+	s.status.NextPoll = next
+	s.mu.Unlock()
+
+	if changed && s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// testReceived records a test message, which changes the status so that it can be observed.
+func (s *listenerStatus) testReceived(id string, at time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status.LastTest = &TestReceipt{ID: id, ReceivedAt: at}
+	s.mu.Unlock()
+
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// polled records the outcome of a poll (SQS receive or IMDS probe), and the streak of
+// consecutive failures since the last successful poll.
+func (s *listenerStatus) polled(err error) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	s.mu.Lock()
+	var alert, recovered bool
+	if err != nil {
+		s.status.LastError = err.Error()
+		s.status.ConsecutiveFailures++
+		if s.status.FailingSince.IsZero() {
+			s.status.FailingSince = now
+		}
+		lastSuccess := s.status.LastPoll
+		if lastSuccess.IsZero() {
+			lastSuccess = s.status.FailingSince
+		}
+		if !s.status.Alerting && s.failureThreshold > 0 && now.Sub(lastSuccess) >= s.failureThreshold {
+			s.status.Alerting = true
+			alert = true
+		}
+	}
+	status := s.status
+	if err == nil {
+		recovered = s.status.Alerting
+		s.status.LastPoll = now
+		s.status.LastError = ""
+		s.status.ConsecutiveFailures = 0
+		s.status.FailingSince = time.Time{}
+		s.status.Alerting = false
+	}
+	s.mu.Unlock()
+
+	if (alert || recovered) && s.onPollFailure != nil {
+		s.onPollFailure(status, recovered)
+	}
+}
+
+func (s *listenerStatus) snapshot() ListenerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// statusReporter is implemented by listeners that report their own
+// readiness and poll results. Listeners that don't are considered
+// running as soon as they are started.
+type statusReporter interface {
+	setStatus(*listenerStatus)
+}
+
+// Ready returns a channel that is closed once all listeners are running,
+// e.g. when the SQS queue exists and is subscribed to the SNS topic.
+func (d *Daemon) Ready() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ready == nil {
+		d.ready = make(chan struct{})
+	}
+	return d.ready
+}
+
+func (d *Daemon) listenerStateChanged() {
+	d.notifyChanged()
+	for _, s := range d.statuses {
+		if s.snapshot().State != ListenerRunning {
+			return
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ready == nil {
+		d.ready = make(chan struct{})
+	}
+	select {
+	case <-d.ready:
+	default:
+		close(d.ready)
+	}
+}
+
+// pollFailureChanged reports that the listener has failed to poll for longer than the poll
+// failure threshold, or that it recovered.
+func (d *Daemon) pollFailureChanged(status ListenerStatus, recovered bool) {
+	log := d.logs.entry(status.Type+"-listener", d.baseLog()).WithFields(logrus.Fields{
+		"listener":            status.Type,
+		"consecutiveFailures": status.ConsecutiveFailures,
+		"failingSince":        status.FailingSince.Format(time.RFC3339),
+	})
+	lastSuccess := status.LastPoll
+	if lastSuccess.IsZero() {
+		lastSuccess = status.FailingSince
+	}
+	failingFor := time.Since(lastSuccess).Round(time.Second)
+	if recovered {
+		log.WithField("after", failingFor.String()).Info("Listener recovered after failing to poll")
+		d.notifyPoll(NotifyPollRecovered, status, failingFor, log)
+		return
+	}
+	log.WithError(errors.New(status.LastError)).WithField("failingFor", failingFor.String()).Error("Listener has failed to poll for longer than the threshold and can't receive notices")
+	d.recordError(errors.New(status.LastError))
+	d.notifyChanged()
+	d.notifyPoll(NotifyPollFailing, status, failingFor, log)
+}
+
+// notifyChanged signals that the daemon status has changed, without
+// blocking if a previous change has not been observed yet.
+func (d *Daemon) notifyChanged() {
+	select {
+	case d.changed <- struct{}{}:
+	default:
+	}
+}
+
+// recordError as the last error reported in the daemon status.
+func (d *Daemon) recordError(err error) {
+	d.mu.Lock()
+	d.lastError = err.Error()
+	d.mu.Unlock()
+}
+
+// Status returns a snapshot of the daemon state.
+func (d *Daemon) Status() Status {
+	d.mu.Lock()
+	status := Status{
+		Build:          Build(),
+		InstanceID:     d.instanceID,
+		StartedAt:      d.startedAt,
+		NoticesHandled: d.noticesHandled,
+		LastError:      d.lastError,
+	}
+	if len(d.disabledListeners) > 0 {
+		status.DisabledListeners = append([]string(nil), d.disabledListeners...)
+	}
+	for _, a := range d.handling {
+		status.Handling = append(status.Handling, *a)
+	}
+	d.mu.Unlock()
+	if err := d.credentials.err(); err != nil {
+		status.CredentialsError = err.Error()
+	}
+	status.SelfCheck = d.selfCheck.get()
+
+	for _, s := range d.statuses {
+		status.Listeners = append(status.Listeners, s.snapshot())
+	}
+	return status
+}
+
+// Healthy returns an error describing why the daemon is unhealthy, or nil if
+// all listeners are running and have polled successfully within the threshold, and none
+// have crossed the poll failure threshold.
+// A daemon that is handling a notice is healthy, as the listeners are expected to have
+// stopped at that point, unless the AWS API calls such as heartbeats keep failing for their
+// credentials. A daemon whose self-check found a permission denied is unhealthy. A degraded
+// listener of one of several topics is left out, since the daemon continues without it.
+func (d *Daemon) Healthy(threshold time.Duration) error {
+	status := d.Status()
+	if status.CredentialsError != "" {
+		return errors.New(status.CredentialsError)
+	}
+	if len(status.Handling) > 0 {
+		return nil
+	}
+	for _, r := range status.SelfCheck {
+		if r.Status == CheckFail {
+			return fmt.Errorf("self-check of %s failed: %s", r.Name, r.Detail)
+		}
+	}
+	if len(status.Listeners) == 0 {
+		return errors.New("no listeners configured")
+	}
+	for _, l := range status.Listeners {
+		// The daemon continues with the listeners of the other topics
+		if l.Degraded {
+			continue
+		}
+		if l.State != ListenerRunning {
+			return fmt.Errorf("%s listener is %s", l.Type, l.State)
+		}
+		if l.Alerting {
+			return fmt.Errorf("%s listener has failed %d consecutive polls since %s: %s", l.Type, l.ConsecutiveFailures, l.FailingSince.Format(time.RFC3339), l.LastError)
+		}
+		last := l.LastPoll
+		if last.Before(l.Since) {
+			last = l.Since
+		}
+		// An idle listener is not due to poll until the next poll
+		due := last
+		if l.NextPoll.After(due) {
+			due = l.NextPoll
+		}
+		if time.Since(due) > threshold {
+			if l.LastError != "" {
+				return fmt.Errorf("%s listener has not polled successfully since %s: %s", l.Type, last.Format(time.RFC3339), l.LastError)
+			}
+			return fmt.Errorf("%s listener has not polled successfully since %s", l.Type, last.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package lifecycled
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Outcomes of running the daemon, from the most to the least severe (see also ExitCodes).
+const (
+	OutcomePanic            = "panic"
+	OutcomeListenerFailed   = "listener-failed"
+	OutcomeInterrupted      = "interrupted"
+	OutcomeCompletionFailed = "completion-failed"
+	OutcomeHandlerFailed    = "handler-failed"
+	OutcomeStopped          = "stopped"
+	OutcomeSuccess          = "success"
+)
+
+// Summary describes how the daemon handled the termination notice, and is returned by RunWithSummary.
+type Summary struct {
+	// Notice is the type of notice that was handled, which is empty if the daemon
+	// stopped before receiving one.
+	Notice     string
+	Transition string
+
+	HandlerDuration time.Duration
+	TotalDuration   time.Duration
+	HandlerError    error
+
+	HeartbeatsSent   int
+	HeartbeatsFailed int
+
+	// CompletionResult is the result that the lifecycle action was completed with, if
+	// completion was attempted, and CompletionError is set if the attempt failed.
+	CompletionResult   string
+	CompletionError    error
+	CompletionDuration time.Duration
+	CompletionRetries  int
+
+	// Timeline of the notice, from it being published to the lifecycle action being completed.
+	Timeline []TimelineEvent
+
+	// Results of every notice that the daemon handled, including notices that were
+	// coalesced with the first one, in the order that they finished.
+	Results []Result
+
+	// Interrupted is true if the daemon context was cancelled before Run returned.
+	Interrupted bool
+
+	// Err is the error returned by Run.
+	Err error
+}
+
+// Outcome of running the daemon, which is the most severe of the failures in the summary. A daemon
+// that was interrupted before it received a notice was stopped, rather than interrupted.
+func (s *Summary) Outcome() string {
+	switch {
+	case s.panicked():
+		return OutcomePanic
+	case errors.Is(s.Err, ErrListenerFailed):
+		return OutcomeListenerFailed
+	case s.Interrupted && s.Notice == "" && s.HandlerError == nil && len(s.Results) == 0:
+		return OutcomeStopped
+	case s.Interrupted:
+		return OutcomeInterrupted
+	case s.CompletionError != nil:
+		return OutcomeCompletionFailed
+	case s.HandlerError != nil:
+		return OutcomeHandlerFailed
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// Total of the results of every notice that the daemon handled.
+func (s *Summary) Total() Result {
+	var total Result
+	for _, r := range s.Results {
+		total.HandlerDuration += r.HandlerDuration
+		total.HeartbeatsSent += r.HeartbeatsSent
+		total.HeartbeatsFailed += r.HeartbeatsFailed
+		total.CompletionDuration += r.CompletionDuration
+		total.CompletionRetries += r.CompletionRetries
+	}
+	return total
+}
+
+// Result describes how a notice was handled, and is collected by the notice during Handle.
+type Result struct {
+	Notice          string
+	HandlerDuration time.Duration
+
+	HeartbeatsSent   int
+	HeartbeatsFailed int
+
+	// CompletionResult is empty if completion of the lifecycle action was not attempted.
+	CompletionResult   string
+	CompletionError    error
+	CompletionDuration time.Duration
+
+	// CompletionRetries is the number of times that completing the lifecycle action was retried.
+	CompletionRetries int
+}
+
+// resulter is implemented by notices that collect a Result, which is complete once Handle returns.
+type resulter interface {
+	Result() Result
+}
+
+// resultOf the notice, which only has the handler duration for notices that don't collect a Result.
+func resultOf(notice TerminationNotice, handlerDuration time.Duration) Result {
+	if n, ok := notice.(resulter); ok {
+		return n.Result()
+	}
+	return Result{Notice: notice.Type(), HandlerDuration: handlerDuration}
+}
+
+// summarize the outcome of handling the notice.
+func summarize(notice TerminationNotice, handlerDuration, totalDuration time.Duration, err error) *Summary {
+	s := &Summary{
+		Notice:          notice.Type(),
+		HandlerDuration: handlerDuration,
+		TotalDuration:   totalDuration,
+		HandlerError:    err,
+	}
+	if n, ok := notice.(DetailedNotice); ok {
+		s.Transition = n.Transition()
+	}
+	if n, ok := notice.(resulter); ok {
+		r := n.Result()
+		s.HeartbeatsSent, s.HeartbeatsFailed = r.HeartbeatsSent, r.HeartbeatsFailed
+		s.CompletionResult, s.CompletionError = r.CompletionResult, r.CompletionError
+		s.CompletionDuration, s.CompletionRetries = r.CompletionDuration, r.CompletionRetries
+	}
+	return s
+}
+
+// RunWithSummary is like Run, but also returns a summary of how the notice was handled.
+func (d *Daemon) RunWithSummary(ctx context.Context, handler Handler) (*Summary, error) {
+	summary, err := d.run(ctx, handler)
+	if summary == nil {
+		summary = &Summary{}
+	}
+	d.mu.Lock()
+	summary.Results = d.results
+	d.mu.Unlock()
+	summary.Interrupted = ctx.Err() != nil
+	summary.Err = err
+	return summary, err
+}
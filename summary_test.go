@@ -0,0 +1,215 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestRunWithSummary(t *testing.T) {
+	tests := []struct {
+		description     string
+		handlerErr      error
+		completeErr     error
+		expectedOutcome string
+		expectedResult  string
+		expectedExit    int
+	}{
+		{
+			description:     "handler succeeds",
+			expectedOutcome: lifecycled.OutcomeSuccess,
+			expectedResult:  "CONTINUE",
+		},
+		{
+			description:     "handler fails",
+			handlerErr:      errors.New("drain failed"),
+			expectedOutcome: lifecycled.OutcomeHandlerFailed,
+			expectedResult:  "CONTINUE",
+			expectedExit:    lifecycled.ExitHandlerFailed,
+		},
+		{
+			description:     "completion fails",
+			completeErr:     errors.New("throttled"),
+			expectedOutcome: lifecycled.OutcomeCompletionFailed,
+			expectedResult:  "CONTINUE",
+			expectedExit:    lifecycled.ExitCompletionFailed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			instanceID := "i-000000000000"
+			sq := mocks.NewMockSQSClient(ctrl)
+			sn := mocks.NewMockSNSClient(ctrl)
+			as := mocks.NewMockAutoscalingClient(ctrl)
+
+			sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+				QueueUrl: aws.String("url"),
+			}, nil)
+			sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+				Attributes: map[string]string{"QueueArn": "arn"},
+			}, nil)
+			sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.ReceiveMessageOutput{
+				Messages: []sqstypes.Message{newSQSMessage(instanceID)},
+			}, nil)
+			sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return(&sqs.ReceiveMessageOutput{}, nil)
+			sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+			sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+			sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+				SubscriptionArn: aws.String("arn"),
+			}, nil)
+			sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+			as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+			as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+				func(_ context.Context, _ *autoscaling.CompleteLifecycleActionInput, opts ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+					// Simulates the SDK retrying the request twice
+					o := autoscaling.Options{Retryer: retry.NewStandard()}
+					for _, opt := range opts {
+						opt(&o)
+					}
+					for attempt := 1; attempt <= 2; attempt++ {
+						_, _ = o.Retryer.RetryDelay(attempt, errors.New("throttled"))
+					}
+					return &autoscaling.CompleteLifecycleActionOutput{}, tc.completeErr
+				},
+			)
+
+			logger, _ := logrus.NewNullLogger()
+			daemon := lifecycled.NewDaemon(&lifecycled.Config{
+				InstanceID:                   instanceID,
+				SNSTopic:                     "topic",
+				AutoscalingHeartbeatInterval: 5 * time.Millisecond,
+			}, sq, sn, as, nil, logger)
+
+			ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+			defer cancel()
+
+			summary, err := daemon.RunWithSummary(ctx, lifecycled.HandlerFunc(func(context.Context, ...string) error {
+				time.Sleep(20 * time.Millisecond)
+				return tc.handlerErr
+			}))
+			if !errors.Is(err, tc.handlerErr) {
+				t.Errorf("expected error '%v' and got '%v'", tc.handlerErr, err)
+			}
+			if got, want := errors.Is(err, lifecycled.ErrHandlerFailed), tc.handlerErr != nil; got != want {
+				t.Errorf("expected error to match ErrHandlerFailed to be %t", want)
+			}
+			if got, want := summary.Outcome(), tc.expectedOutcome; got != want {
+				t.Errorf("expected outcome '%s' and got '%s'", want, got)
+			}
+			if got, want := summary.ExitCode(), tc.expectedExit; got != want {
+				t.Errorf("expected exit code %d and got %d", want, got)
+			}
+			if got, want := summary.Notice, "autoscaling"; got != want {
+				t.Errorf("expected notice '%s' and got '%s'", want, got)
+			}
+			if got, want := summary.CompletionResult, tc.expectedResult; got != want {
+				t.Errorf("expected completion result '%s' and got '%s'", want, got)
+			}
+			if tc.completeErr != nil && !errors.Is(summary.CompletionError, lifecycled.ErrCompleteLifecycle) {
+				t.Errorf("expected completion error to match ErrCompleteLifecycle and got '%v'", summary.CompletionError)
+			}
+			if summary.HeartbeatsSent < 1 {
+				t.Error("expected heartbeats to be counted")
+			}
+			if summary.HandlerDuration < 20*time.Millisecond || summary.TotalDuration < summary.HandlerDuration {
+				t.Errorf("unexpected durations: handler %s, total %s", summary.HandlerDuration, summary.TotalDuration)
+			}
+			if got, want := summary.CompletionRetries, 2; got != want {
+				t.Errorf("expected %d completion retries and got %d", want, got)
+			}
+			if len(summary.Results) != 1 {
+				t.Fatalf("expected a result for the notice and got %d", len(summary.Results))
+			}
+			result := summary.Results[0]
+			if result.HeartbeatsSent != summary.HeartbeatsSent || result.CompletionResult != tc.expectedResult {
+				t.Errorf("expected the result to match the summary and got %+v", result)
+			}
+			if result.HandlerDuration < 20*time.Millisecond {
+				t.Errorf("expected the notice to record the handler duration and got %s", result.HandlerDuration)
+			}
+		})
+	}
+}
+
+func TestSummaryTotal(t *testing.T) {
+	summary := lifecycled.Summary{Results: []lifecycled.Result{
+		{Notice: "autoscaling", HeartbeatsSent: 3, HeartbeatsFailed: 1, CompletionDuration: time.Second, CompletionRetries: 2},
+		{Notice: "autoscaling", HeartbeatsSent: 2, CompletionDuration: time.Second},
+		{Notice: "spot", HandlerDuration: time.Minute},
+	}}
+
+	total := summary.Total()
+	expected := lifecycled.Result{
+		HandlerDuration:    time.Minute,
+		HeartbeatsSent:     5,
+		HeartbeatsFailed:   1,
+		CompletionDuration: 2 * time.Second,
+		CompletionRetries:  2,
+	}
+	if total != expected {
+		t.Errorf("expected total %+v and got %+v", expected, total)
+	}
+}
+
+func TestSummaryOutcome(t *testing.T) {
+	tests := []struct {
+		description string
+		summary     lifecycled.Summary
+		expected    string
+	}{
+		{
+			description: "listener failure is the most severe",
+			summary: lifecycled.Summary{
+				Interrupted: true,
+				Err:         &lifecycled.ListenerError{Type: "spot", Err: errors.New("failed")},
+			},
+			expected: lifecycled.OutcomeListenerFailed,
+		},
+		{
+			description: "interrupted while handling",
+			summary: lifecycled.Summary{
+				Interrupted:  true,
+				HandlerError: context.Canceled,
+			},
+			expected: lifecycled.OutcomeInterrupted,
+		},
+		{
+			description: "interrupted before a notice",
+			summary:     lifecycled.Summary{Interrupted: true},
+			expected:    lifecycled.OutcomeStopped,
+		},
+		{
+			description: "completion failure is more severe than handler failure",
+			summary: lifecycled.Summary{
+				HandlerError:    errors.New("failed"),
+				CompletionError: errors.New("failed"),
+			},
+			expected: lifecycled.OutcomeCompletionFailed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			if got, want := tc.summary.Outcome(), tc.expected; got != want {
+				t.Errorf("expected outcome '%s' and got '%s'", want, got)
+			}
+		})
+	}
+}
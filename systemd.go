@@ -0,0 +1,90 @@
+package lifecycled
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SystemdNotifier sends service notifications (see sd_notify(3)) to systemd.
+// All methods are no-ops when NOTIFY_SOCKET is unset.
+type SystemdNotifier struct {
+	socket string
+}
+
+// NewSystemdNotifier returns a notifier for the socket in NOTIFY_SOCKET.
+func NewSystemdNotifier() *SystemdNotifier {
+	return &SystemdNotifier{socket: os.Getenv("NOTIFY_SOCKET")}
+}
+
+// Enabled returns true if the process was started by systemd with a notify socket.
+func (n *SystemdNotifier) Enabled() bool {
+	return n.socket != ""
+}
+
+// Notify sends a newline separated list of assignments, e.g. "READY=1".
+func (n *SystemdNotifier) Notify(state string) error {
+	if !n.Enabled() {
+		return nil
+	}
+	addr := &net.UnixAddr{Name: n.socket, Net: "unixgram"}
+	if addr.Name[0] == '@' {
+		// Abstract namespace socket
+		addr.Name = "\x00" + addr.Name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WatchdogInterval returns the interval at which systemd expects watchdog pings,
+// which is half of WATCHDOG_USEC, or zero if the watchdog is not enabled for this process.
+func (n *SystemdNotifier) WatchdogInterval() time.Duration {
+	if !n.Enabled() {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// Watchdog sends WATCHDOG=1 pings for as long as healthy returns nil,
+// so that systemd restarts the service if the listeners are wedged.
+func (n *SystemdNotifier) Watchdog(ctx context.Context, healthy func() error, log *logrus.Entry) {
+	interval := n.WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := healthy(); err != nil {
+				log.WithError(err).Warn("Skipping systemd watchdog ping, daemon is unhealthy")
+				continue
+			}
+			if err := n.Notify("WATCHDOG=1"); err != nil {
+				log.WithError(err).Warn("Failed to send systemd watchdog ping")
+			}
+		}
+	}
+}
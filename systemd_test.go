@@ -0,0 +1,101 @@
+package lifecycled_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/triarius/lifecycled"
+)
+
+func TestSystemdNotifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lifecycled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", socket)
+	os.Setenv("WATCHDOG_USEC", "2000000")
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	defer os.Unsetenv("WATCHDOG_USEC")
+
+	notifier := lifecycled.NewSystemdNotifier()
+	if err := notifier.Notify("READY=1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	buf := make([]byte, 64)
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read notification: %s", err)
+	}
+	if got, want := string(buf[:n]), "READY=1"; got != want {
+		t.Errorf("expected '%s' and got '%s'", want, got)
+	}
+
+	if got, want := notifier.WatchdogInterval(), time.Second; got != want {
+		t.Errorf("expected watchdog interval %s and got %s", want, got)
+	}
+}
+
+func TestSystemdNotifierDisabled(t *testing.T) {
+	os.Unsetenv("NOTIFY_SOCKET")
+
+	notifier := lifecycled.NewSystemdNotifier()
+	if err := notifier.Notify("READY=1"); err != nil {
+		t.Errorf("expected no-op and got error: %s", err)
+	}
+	if got := notifier.WatchdogInterval(); got != 0 {
+		t.Errorf("expected watchdog to be disabled and got interval %s", got)
+	}
+}
+
+func TestSystemdUnit(t *testing.T) {
+	cfg := lifecycled.DefaultConfig()
+	cfg.HealthThreshold = 2 * time.Minute
+	cfg.HandlerGracePeriod = 30 * time.Second
+	cfg.ShutdownTimeout = 15 * time.Second
+
+	unit := lifecycled.SystemdUnit(cfg, []string{"/usr/bin/lifecycled", "--config", "/etc/lifecycled/config.yaml", "--", "/usr/local/bin/drain", "--reason", "100% $done"})
+	for _, line := range []string{
+		`ExecStart=/usr/bin/lifecycled --config /etc/lifecycled/config.yaml -- /usr/local/bin/drain --reason "100%% $$done"`,
+		"Type=notify",
+		"RestartPreventExitStatus=1",
+		"WatchdogSec=240s",
+		"KillMode=mixed",
+		"TimeoutStopSec=75s",
+	} {
+		if !strings.Contains(unit, "\n"+line+"\n") {
+			t.Errorf("expected the unit to contain %s and got:\n%s", line, unit)
+		}
+	}
+}
+
+func TestSystemdDropIn(t *testing.T) {
+	dropIn := lifecycled.SystemdDropIn(map[string]string{
+		"LIFECYCLED_TAG":       "Name=web server,Team=platform",
+		"LIFECYCLED_SNS_TOPIC": "arn:aws:sns:us-east-1:123456789012:lifecycled",
+	})
+	expected := `[Service]
+Environment=LIFECYCLED_SNS_TOPIC=arn:aws:sns:us-east-1:123456789012:lifecycled
+Environment="LIFECYCLED_TAG=Name=web server,Team=platform"
+`
+	if dropIn != expected {
+		t.Errorf("expected drop-in:\n%s\ngot:\n%s", expected, dropIn)
+	}
+}
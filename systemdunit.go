@@ -0,0 +1,89 @@
+package lifecycled
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// systemdStopMargin is added to the time that the daemon needs to stop for the TimeoutStopSec
+// of SystemdUnit, e.g. to send the last batch of logs.
+const systemdStopMargin = 30 * time.Second
+
+// systemdUnit is the unit of SystemdUnit, with the command line, the exit code that prevents a
+// restart, WatchdogSec and TimeoutStopSec.
+const systemdUnit = `[Unit]
+Description=Autoscale Lifecycle Daemon
+Documentation=https://github.com/triarius/lifecycled
+Requires=network-online.target
+After=network-online.target
+
+[Service]
+Type=notify
+ExecStart=%s
+Restart=on-failure
+RestartSec=30s
+RestartForceExitStatus=SIGPIPE
+RestartPreventExitStatus=%d
+WatchdogSec=%s
+KillMode=mixed
+TimeoutStopSec=%s
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// SystemdUnit returns a systemd service unit that executes the command (e.g. /usr/bin/lifecycled
+// --config /etc/lifecycled.yaml) for the configuration. The daemon notifies systemd when its
+// listeners are ready, so the unit is Type=notify. It only pings the watchdog at half of
+// WatchdogSec while it is healthy, so WatchdogSec is twice the HealthThreshold to restart a daemon
+// that has been unhealthy for at least that long. KillMode=mixed leaves stopping the handlers to
+// the daemon, and TimeoutStopSec allows for the HandlerGracePeriod and the ShutdownTimeout.
+func SystemdUnit(c *Config, command []string) string {
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = systemdQuote(arg, true)
+	}
+	stop := c.HandlerGracePeriod + c.ShutdownTimeout + systemdStopMargin
+
+	return fmt.Sprintf(systemdUnit, strings.Join(args, " "), ExitInvalidConfig,
+		systemdTimespan(2*c.HealthThreshold), systemdTimespan(stop))
+}
+
+// SystemdDropIn returns a drop-in for the unit of SystemdUnit that sets the environment variables,
+// e.g. LIFECYCLED_SNS_TOPIC, in the order of their names.
+func SystemdDropIn(env map[string]string) string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Service]\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(name+"="+env[name], false))
+	}
+	return b.String()
+}
+
+// systemdQuote quotes a word of a unit file if needed, escaping the specifiers (e.g. %i) and, for
+// the command lines of exec, the environment variable substitutions (e.g. $HOME).
+func systemdQuote(s string, exec bool) string {
+	s = strings.Replace(s, "%", "%%", -1)
+	if exec {
+		s = strings.Replace(s, "$", "$$", -1)
+	}
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+// systemdTimespan formats the duration as a systemd time span in seconds, e.g. 2min is 120s,
+// rounded up since a time span can't be fractional.
+func systemdTimespan(d time.Duration) string {
+	return fmt.Sprintf("%ds", (d+time.Second-1)/time.Second)
+}
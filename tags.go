@@ -0,0 +1,128 @@
+package lifecycled
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/sirupsen/logrus"
+)
+
+// EC2Client for testing purposes
+//
+//go:generate mockgen -destination=mocks/mock_ec2_client.go -package=mocks github.com/triarius/lifecycled EC2Client
+type EC2Client interface {
+	DescribeTags(context.Context, *ec2.DescribeTagsInput, ...func(*ec2.Options)) (*ec2.DescribeTagsOutput, error)
+}
+
+// tagEnvPrefix is the prefix of the environment variables with the instance tags.
+const tagEnvPrefix = "LIFECYCLED_TAG_"
+
+// groupNameTag is the tag that EC2 Auto Scaling adds to the instances of a group.
+const groupNameTag = "aws:autoscaling:groupName"
+
+// DescribeInstanceTags returns the values of the named tags of the instance, which requires
+// ec2:DescribeTags. Tags that the instance doesn't have are omitted.
+func DescribeInstanceTags(ctx context.Context, client EC2Client, instanceID string, names []string) (map[string]string, error) {
+	input := &ec2.DescribeTagsInput{
+		Filters: []types.Filter{
+			{Name: aws.String("resource-id"), Values: []string{instanceID}},
+			{Name: aws.String("key"), Values: names},
+		},
+	}
+	tags := make(map[string]string)
+	for {
+		out, err := client.DescribeTags(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range out.Tags {
+			tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+		}
+		if aws.ToString(out.NextToken) == "" {
+			return tags, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// LookupGroupName returns the autoscaling group of the instance from its aws:autoscaling:groupName
+// tag, which requires ec2:DescribeTags, or failing that from the instance metadata if it includes
+// tags. The name is empty if the instance isn't in a group.
+func LookupGroupName(ctx context.Context, client EC2Client, metadata *imds.Client, instanceID string) (string, error) {
+	tags, err := DescribeInstanceTags(ctx, client, instanceID, []string{groupNameTag})
+	if err == nil {
+		return tags[groupNameTag], nil
+	}
+	if metadata == nil {
+		return "", err
+	}
+	name, merr := getMetadata(ctx, metadata, "tags/instance/"+groupNameTag)
+	if merr != nil {
+		return "", fmt.Errorf("%s, and the tag is not in the instance metadata: %s", err, merr)
+	}
+	return name, nil
+}
+
+// SetInstanceTags adds the tags as fields (e.g. tag.Service) to the log entries of the daemon,
+// and exports them to file handlers as environment variables (e.g. LIFECYCLED_TAG_SERVICE).
+func (d *Daemon) SetInstanceTags(tags map[string]string) {
+	fields := make(logrus.Fields, len(tags))
+	env := make([]string, 0, len(tags))
+	for name, value := range tags {
+		fields["tag."+name] = value
+		env = append(env, tagEnvName(name)+"="+value)
+	}
+	sort.Strings(env)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tagFields = fields
+	d.tagEnv = env
+}
+
+// tagEnvName returns the name of the environment variable for the tag, where characters
+// that are not valid in the name are replaced with underscores.
+func tagEnvName(tag string) string {
+	return tagEnvPrefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, tag)
+}
+
+// baseLog returns the entry that the log entries of the daemon are derived from.
+func (d *Daemon) baseLog() *logrus.Entry {
+	d.mu.Lock()
+	fields := d.tagFields
+	d.mu.Unlock()
+	return d.logs.logger(LogComponentDaemon).WithField("instanceId", d.instanceID).WithFields(fields)
+}
+
+// handlerEnvKey is the context key of the environment variables for file handlers.
+type handlerEnvKey struct{}
+
+// withHandlerEnv returns a context where file handlers are executed with the additional
+// environment variables.
+func withHandlerEnv(ctx context.Context, env []string) context.Context {
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, handlerEnvKey{}, env)
+}
+
+// handlerEnv returns the additional environment variables for file handlers.
+func handlerEnv(ctx context.Context) []string {
+	env, _ := ctx.Value(handlerEnvKey{}).([]string)
+	return env
+}
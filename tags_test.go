@@ -0,0 +1,119 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/golang/mock/gomock"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestDescribeInstanceTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := mocks.NewMockEC2Client(ctrl)
+	pages := []*ec2.DescribeTagsOutput{
+		{
+			Tags:      []ec2types.TagDescription{{Key: aws.String("Service"), Value: aws.String("api")}},
+			NextToken: aws.String("next"),
+		},
+		{
+			Tags: []ec2types.TagDescription{{Key: aws.String("Team"), Value: aws.String("platform")}},
+		},
+	}
+	var calls int
+	client.EXPECT().DescribeTags(gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(_ context.Context, input *ec2.DescribeTagsInput, _ ...func(*ec2.Options)) (*ec2.DescribeTagsOutput, error) {
+			filters := make(map[string][]string)
+			for _, f := range input.Filters {
+				filters[aws.ToString(f.Name)] = f.Values
+			}
+			if got := filters["resource-id"]; len(got) != 1 || got[0] != "i-000000000000" {
+				t.Errorf("expected a filter for the instance and got %v", got)
+			}
+			if got := filters["key"]; len(got) != 3 {
+				t.Errorf("expected a filter for the tag names and got %v", got)
+			}
+			if calls > 0 && aws.ToString(input.NextToken) != "next" {
+				t.Errorf("expected the next token")
+			}
+			calls++
+			return pages[calls-1], nil
+		},
+	)
+
+	tags, err := lifecycled.DescribeInstanceTags(context.TODO(), client, "i-000000000000", []string{"Service", "Team", "Missing"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tags) != 2 || tags["Service"] != "api" || tags["Team"] != "platform" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
+func TestDescribeInstanceTagsError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := mocks.NewMockEC2Client(ctrl)
+	client.EXPECT().DescribeTags(gomock.Any(), gomock.Any()).Return(nil, errors.New("unauthorized"))
+
+	if _, err := lifecycled.DescribeInstanceTags(context.TODO(), client, "i-000000000000", []string{"Service"}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestLookupGroupName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI == "/latest/meta-data/tags/instance/aws:autoscaling:groupName" {
+			w.Write([]byte("metadata-group"))
+			return
+		}
+		http.Error(w, "404 - not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+	metadata := imds.New(imds.Options{
+		Endpoint: server.URL,
+	})
+
+	tests := []struct {
+		description string
+		tags        []ec2types.TagDescription
+		err         error
+		expected    string
+	}{
+		{
+			description: "tag",
+			tags:        []ec2types.TagDescription{{Key: aws.String("aws:autoscaling:groupName"), Value: aws.String("group")}},
+			expected:    "group",
+		},
+		{description: "not in a group"},
+		{description: "metadata fallback", err: errors.New("UnauthorizedOperation"), expected: "metadata-group"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := mocks.NewMockEC2Client(ctrl)
+			client.EXPECT().DescribeTags(gomock.Any(), gomock.Any()).Times(1).Return(&ec2.DescribeTagsOutput{Tags: tc.tags}, tc.err)
+
+			group, err := lifecycled.LookupGroupName(context.TODO(), client, metadata, "i-000000000000")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if group != tc.expected {
+				t.Errorf("expected group '%s' and got '%s'", tc.expected, group)
+			}
+		})
+	}
+}
@@ -172,6 +172,7 @@ data "aws_iam_policy_document" "permissions" {
     actions = [
       "autoscaling:RecordLifecycleActionHeartbeat",
       "autoscaling:CompleteLifecycleAction",
+      "autoscaling:DescribeLifecycleHooks",
     ]
 
     resources = ["*"]
@@ -0,0 +1,121 @@
+package lifecycled
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// TestNotificationEvent is the event of the test notifications that autoscaling publishes to the
+// topic of a lifecycle hook or notification configuration when it is created.
+const TestNotificationEvent = "autoscaling:TEST_NOTIFICATION"
+
+// Kinds of the test messages of NewTestMessage.
+const (
+	// TestTermination is a synthetic termination of the instance with the Test marker set.
+	TestTermination = "termination"
+
+	// TestNotification has the shape of the test notifications of autoscaling.
+	TestNotification = "test-notification"
+)
+
+// testName is the group and lifecycle hook name of test messages.
+const testName = "lifecycled-test"
+
+// TestMessage is a message that is published to the topic to check that a daemon receives it,
+// which the daemon records in its status (see ListenerStatus.LastTest) without handling it.
+type TestMessage struct {
+	// ID of the message, which is its RequestId.
+	ID   string
+	Kind string
+	Body []byte
+}
+
+// NewTestMessage returns a test message of the kind for the instance, with a random id. Test
+// terminations need the instance id, while test notifications are received by every daemon
+// subscribed to the topic unless it is set.
+func NewTestMessage(kind, instanceID string) (*TestMessage, error) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	m := &TestMessage{ID: hex.EncodeToString(id), Kind: kind}
+
+	var body interface{}
+	switch kind {
+	case TestTermination:
+		if instanceID == "" {
+			return nil, invalid("instance-id", "i-0123456789abcdef0", "is required for a test %s", kind)
+		}
+		msg := SimulatedMessage(instanceID, "autoscaling:EC2_INSTANCE_TERMINATING")
+		msg.GroupName, msg.HookName = testName, testName
+		msg.RequestID, msg.Test = m.ID, true
+		body = msg
+	case TestNotification:
+		body = struct {
+			Service    string    `json:"Service"`
+			Event      string    `json:"Event"`
+			RequestID  string    `json:"RequestId"`
+			GroupName  string    `json:"AutoScalingGroupName"`
+			InstanceID string    `json:"EC2InstanceId,omitempty"`
+			Time       time.Time `json:"Time"`
+		}{"AWS Auto Scaling", TestNotificationEvent, m.ID, testName, instanceID, time.Now().UTC()}
+	default:
+		return nil, invalid("kind", TestTermination, "must be %s or %s, got %q", TestTermination, TestNotification, kind)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	m.Body = data
+	return m, nil
+}
+
+// SendTestMessage publishes the test message to the topic. Requires sns:Publish.
+func SendTestMessage(ctx context.Context, client SNSClient, topic string, m *TestMessage) error {
+	if !isTopicARN(topic) {
+		return invalid("sns-topic", "arn:aws:sns:us-east-1:123456789012:lifecycled", "must be the arn of an sns topic, got %q", topic)
+	}
+	_, err := client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(topic),
+		Subject:  aws.String("Auto Scaling: test message sent by lifecycled"),
+		Message:  aws.String(string(m.Body)),
+	})
+	return err
+}
+
+// WaitForTestMessage polls the status of a daemon (e.g. from its status endpoint or state file)
+// at the interval until a listener has received the test message with the id, and returns when
+// it was received. Failures to get the status are retried, since the daemon may be restarting,
+// and the last of them is returned with the error of the context if it is done first.
+func WaitForTestMessage(ctx context.Context, status func() (Status, error), id string, interval time.Duration) (time.Time, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		s, err := status()
+		if err == nil {
+			for _, l := range s.Listeners {
+				if l.LastTest != nil && l.LastTest.ID == id {
+					return l.LastTest.ReceivedAt, nil
+				}
+			}
+		}
+		lastErr = err
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if lastErr != nil {
+				return time.Time{}, fmt.Errorf("%w, last failed to get the status: %s", ctx.Err(), lastErr)
+			}
+			return time.Time{}, ctx.Err()
+		}
+	}
+}
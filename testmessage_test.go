@@ -0,0 +1,189 @@
+package lifecycled_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+func TestNewTestMessage(t *testing.T) {
+	for _, kind := range []string{lifecycled.TestTermination, lifecycled.TestNotification} {
+		t.Run(kind, func(t *testing.T) {
+			m, err := lifecycled.NewTestMessage(kind, "i-0123456789abcdef0")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var msg lifecycled.Message
+			if err := json.Unmarshal(m.Body, &msg); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !msg.IsTest() {
+				t.Error("expected a test message")
+			}
+			if msg.RequestID != m.ID || m.ID == "" {
+				t.Errorf("expected request id %q and got %q", m.ID, msg.RequestID)
+			}
+			if msg.InstanceID != "i-0123456789abcdef0" {
+				t.Errorf("expected the instance id and got %q", msg.InstanceID)
+			}
+		})
+	}
+
+	if _, err := lifecycled.NewTestMessage(lifecycled.TestTermination, ""); err == nil {
+		t.Error("expected an error for a test termination without an instance id")
+	}
+	if _, err := lifecycled.NewTestMessage(lifecycled.TestNotification, ""); err != nil {
+		t.Errorf("unexpected error for a test notification without an instance id: %s", err)
+	}
+	if _, err := lifecycled.NewTestMessage("reboot", "i-0123456789abcdef0"); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+}
+
+func TestSendTestMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	topic := "arn:aws:sns:us-east-1:123456789012:lifecycled"
+	m, err := lifecycled.NewTestMessage(lifecycled.TestTermination, "i-0123456789abcdef0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	sn := mocks.NewMockSNSClient(ctrl)
+	sn.EXPECT().Publish(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(_ context.Context, input *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+			if got := aws.ToString(input.TopicArn); got != topic {
+				t.Errorf("expected topic %s and got %s", topic, got)
+			}
+			if got := aws.ToString(input.Message); got != string(m.Body) {
+				t.Errorf("expected the test message and got %s", got)
+			}
+			return &sns.PublishOutput{}, nil
+		},
+	)
+
+	if err := lifecycled.SendTestMessage(context.TODO(), sn, topic, m); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := lifecycled.SendTestMessage(context.TODO(), sn, "lifecycled", m); err == nil {
+		t.Error("expected an error for a topic that isn't an arn")
+	}
+}
+
+func TestWaitForTestMessage(t *testing.T) {
+	receivedAt := time.Now()
+	statuses := []lifecycled.Status{
+		{},
+		{Listeners: []lifecycled.ListenerStatus{{Type: "autoscaling", LastTest: &lifecycled.TestReceipt{ID: "previous"}}}},
+		{Listeners: []lifecycled.ListenerStatus{{Type: "autoscaling", LastTest: &lifecycled.TestReceipt{ID: "id", ReceivedAt: receivedAt}}}},
+	}
+	var calls int
+	status := func() (lifecycled.Status, error) {
+		calls++
+		if calls == 1 {
+			return lifecycled.Status{}, errors.New("connection refused")
+		}
+		return statuses[calls-2], nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	got, err := lifecycled.WaitForTestMessage(ctx, status, "id", time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !got.Equal(receivedAt) {
+		t.Errorf("expected the test message to be received at %s and got %s", receivedAt, got)
+	}
+
+	ctx, cancel = context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	_, err = lifecycled.WaitForTestMessage(ctx, func() (lifecycled.Status, error) {
+		return lifecycled.Status{}, errors.New("connection refused")
+	}, "id", time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded and got: %v", err)
+	}
+}
+
+func TestAutoscalingTestMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	m, err := lifecycled.NewTestMessage(lifecycled.TestTermination, instanceID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	body, err := json.Marshal(&lifecycled.Envelope{Type: "Notification", Time: time.Now(), Message: string(m.Body)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+
+	// The autoscaling client has no expectations, so any call for the test message fails the test
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	gomock.InOrder(
+		sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.ReceiveMessageOutput{
+			Messages: []sqstypes.Message{{Body: aws.String(string(body)), ReceiptHandle: aws.String("test")}},
+		}, nil),
+		sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(&sqs.ReceiveMessageOutput{
+			Messages: []sqstypes.Message{newSQSMessage(instanceID)},
+		}, nil),
+	)
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(2).Return(nil, nil)
+	sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+	sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	logger, _ := logrus.NewNullLogger()
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID: instanceID,
+		SNSTopic:   "topic",
+	}, sq, sn, as, nil, logger)
+
+	notice, err := daemon.Start(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if notice == nil {
+		t.Fatal("expected the notice after the test message to be returned")
+	}
+
+	var receipt *lifecycled.TestReceipt
+	for _, l := range daemon.Status().Listeners {
+		if l.LastTest != nil {
+			receipt = l.LastTest
+		}
+	}
+	if receipt == nil || receipt.ID != m.ID {
+		t.Errorf("expected the test message %s to be recorded in the status and got %+v", m.ID, receipt)
+	}
+}
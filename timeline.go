@@ -0,0 +1,125 @@
+package lifecycled
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTimelineHeartbeats is the number of heartbeats in the timeline of a notice, after which
+// the heartbeats are counted by a single event, so that long handlers have bounded timelines.
+const maxTimelineHeartbeats = 10
+
+// Events in the timeline of a notice.
+const (
+	TimelinePublished          = "published"
+	TimelineQueued             = "queued"
+	TimelineReceived           = "received"
+	TimelineHandlerStarted     = "handler started"
+	TimelineHandlerFinished    = "handler finished"
+	TimelineHeartbeat          = "heartbeat"
+	TimelineHeartbeatFailed    = "heartbeat failed"
+	TimelineHeartbeatsOmitted  = "heartbeats omitted"
+	TimelineCompletionStarted  = "completion started"
+	TimelineCompletionFinished = "completion finished"
+)
+
+// TimelineEvent is something that happened to a notice, from it being published to the
+// lifecycle action being completed.
+type TimelineEvent struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// timeline collects the events of a notice. It is safe for concurrent use, and the methods
+// do nothing on a nil timeline.
+type timeline struct {
+	mu         sync.Mutex
+	events     []TimelineEvent
+	heartbeats int
+	omitted    int
+
+	// omittedAt is the index of the event counting the omitted heartbeats
+	omittedAt int
+}
+
+func newTimeline() *timeline {
+	return &timeline{}
+}
+
+// add an event to the timeline, unless the time is unknown.
+func (t *timeline) add(at time.Time, event, detail string) {
+	if t == nil || at.IsZero() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, TimelineEvent{Time: at, Event: event, Detail: detail})
+}
+
+// heartbeat adds a heartbeat event, or counts it in the omitted heartbeats once the timeline
+// has maxTimelineHeartbeats of them.
+func (t *timeline) heartbeat(at time.Time, event, detail string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.heartbeats < maxTimelineHeartbeats {
+		t.heartbeats++
+		t.events = append(t.events, TimelineEvent{Time: at, Event: event, Detail: detail})
+		return
+	}
+	if t.omitted == 0 {
+		t.omittedAt = len(t.events)
+		t.events = append(t.events, TimelineEvent{Event: TimelineHeartbeatsOmitted})
+	}
+	t.omitted++
+	t.events[t.omittedAt].Time = at
+	t.events[t.omittedAt].Detail = fmt.Sprintf("…and %d more", t.omitted)
+}
+
+// Events returns a copy of the events in the order that they happened.
+func (t *timeline) Events() []TimelineEvent {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	events := append([]TimelineEvent(nil), t.events...)
+	t.mu.Unlock()
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// formatTimeline returns the events on a single line, with the time of each event relative to
+// the first, e.g. "+0s published, +120ms received, +130ms handler started".
+func formatTimeline(events []TimelineEvent) string {
+	parts := make([]string, 0, len(events))
+	for _, e := range events {
+		part := fmt.Sprintf("+%s %s", e.Time.Sub(events[0].Time).Round(time.Millisecond), e.Event)
+		if e.Detail != "" {
+			part += " (" + e.Detail + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// timelineKey is the context key of the timeline of the notice being handled.
+type timelineKey struct{}
+
+// withTimeline returns a context where handlers and notices add events to the timeline.
+func withTimeline(ctx context.Context, t *timeline) context.Context {
+	return context.WithValue(ctx, timelineKey{}, t)
+}
+
+// timelineFrom returns the timeline of the notice being handled, which is nil outside of
+// the daemon.
+func timelineFrom(ctx context.Context) *timeline {
+	t, _ := ctx.Value(timelineKey{}).(*timeline)
+	return t
+}
@@ -1,22 +1,25 @@
 package main
 
 import (
-	"os"
+	"context"
+	"errors"
 	"flag"
 	"log"
+	"os"
 	"regexp"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/ec2metadata"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/sns"
-	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
 )
 
 func main() {
@@ -26,18 +29,20 @@ func main() {
 	region := os.Getenv("AWS_REGION")
 	if region == "" {
 		log.Println("Looking up region from metadata service")
-		sess, err := session.NewSession()
-		if err != nil {
-			log.Fatalf("Failed to create new aws session: %s", err)
-		}
-		region, err = ec2metadata.New(sess).Region()
+		out, err := imds.New(imds.Options{}).GetRegion(context.Background(), &imds.GetRegionInput{})
 		if err != nil {
 			log.Fatalf("Failed to look up region: %s", err)
 		}
+		region = out.Region
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		log.Fatalf("Failed to load the aws configuration: %s", err)
 	}
 
 	for {
-		count, err := deleteInactiveSubscriptions(session.Must(session.NewSession(&aws.Config{ Region: aws.String(region), })))
+		count, err := deleteInactiveSubscriptions(cfg)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -51,7 +56,7 @@ func main() {
 	}
 
 	for {
-		count, err := deleteInactiveQueues(session.Must(session.NewSession(&aws.Config{ Region: aws.String(region), })), *parallel)
+		count, err := deleteInactiveQueues(cfg, *parallel)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -67,8 +72,8 @@ func main() {
 	log.Printf("Done! Sorry for the inconvenience!")
 }
 
-func deleteInactiveQueues(sess *session.Session, parallel int) (uint64, error) {
-	queues, err := listInactiveQueues(sess)
+func deleteInactiveQueues(cfg aws.Config, parallel int) (uint64, error) {
+	queues, err := listInactiveQueues(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -84,10 +89,11 @@ func deleteInactiveQueues(sess *session.Session, parallel int) (uint64, error) {
 			for queue := range queuesCh {
 				atomic.AddUint64(&count, 1)
 				log.Printf("Deleting %s (%d of %d)", queue, count, total)
-				err = deleteQueue(sess, queue)
+				err = deleteQueue(cfg, queue)
 				wg.Done()
-				if awsErr, ok := err.(awserr.Error); ok {
-					if awsErr.Code() == `AWS.SimpleQueueService.NonExistentQueue` {
+				var apiErr smithy.APIError
+				if errors.As(err, &apiErr) {
+					if apiErr.ErrorCode() == `AWS.SimpleQueueService.NonExistentQueue` {
 						continue
 					}
 				}
@@ -117,37 +123,37 @@ func deleteInactiveQueues(sess *session.Session, parallel int) (uint64, error) {
 	return count, nil
 }
 
-func listInstances(sess *session.Session) ([]string, error) {
+func listInstances(cfg aws.Config) ([]string, error) {
 	var instances []string
 
 	// Only grab instances that are running or just started
 	params := &ec2.DescribeInstancesInput{
-		Filters: []*ec2.Filter{
+		Filters: []ec2types.Filter{
 			{
 				Name:   aws.String(`instance-state-name`),
-				Values: aws.StringSlice([]string{"running", "pending"}),
+				Values: []string{"running", "pending"},
 			},
 		},
 	}
 
-	err := ec2.New(sess).DescribeInstancesPages(params,
-		func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
-			for _, reservation := range page.Reservations {
-				for _, instance := range reservation.Instances {
-					instances = append(instances, *instance.InstanceId)
-				}
+	pages := ec2.NewDescribeInstancesPaginator(ec2.NewFromConfig(cfg), params)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				instances = append(instances, *instance.InstanceId)
 			}
-			return lastPage
-		})
-	if err != nil {
-		return nil, err
+		}
 	}
 
 	return instances, nil
 }
 
-func listQueues(sess *session.Session) ([]string, error) {
-	resp, err := sqs.New(sess).ListQueues(&sqs.ListQueuesInput{
+func listQueues(cfg aws.Config) ([]string, error) {
+	resp, err := sqs.NewFromConfig(cfg).ListQueues(context.Background(), &sqs.ListQueuesInput{
 		QueueNamePrefix: aws.String(`lifecycled-`),
 	})
 	if err != nil {
@@ -156,16 +162,16 @@ func listQueues(sess *session.Session) ([]string, error) {
 
 	var queues = make([]string, len(resp.QueueUrls))
 	for idx, queue := range resp.QueueUrls {
-		queues[idx] = *queue
+		queues[idx] = queue
 	}
 
 	return queues, nil
 }
 
-var queueRegex = regexp.MustCompile(`^https://sqs\.(.+?)\.amazonaws.com/(.+?)/lifecycled-(i-.+)$`)
+var queueRegex = regexp.MustCompile(`^https://sqs\.(.+?)\.amazonaws\.com(?:\.cn)?/(.+?)/lifecycled-(i-.+)$`)
 
-func listInactiveQueues(sess *session.Session) ([]string, error) {
-	instances, err := listInstances(sess)
+func listInactiveQueues(cfg aws.Config) ([]string, error) {
+	instances, err := listInstances(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -178,7 +184,7 @@ func listInactiveQueues(sess *session.Session) ([]string, error) {
 		instancesMap[instance] = struct{}{}
 	}
 
-	queues, err := listQueues(sess)
+	queues, err := listQueues(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -203,20 +209,21 @@ func listInactiveQueues(sess *session.Session) ([]string, error) {
 
 }
 
-func deleteQueue(sess *session.Session, queueUrl string) error {
-	_, err := sqs.New(sess).DeleteQueue(&sqs.DeleteQueueInput{
+func deleteQueue(cfg aws.Config, queueUrl string) error {
+	_, err := sqs.NewFromConfig(cfg).DeleteQueue(context.Background(), &sqs.DeleteQueueInput{
 		QueueUrl: aws.String(queueUrl),
 	})
 	return err
 }
 
-func topicExists(sess *session.Session, snsTopic string) (bool, error) {
-	_, err := sns.New(sess).GetTopicAttributes(&sns.GetTopicAttributesInput{
+func topicExists(cfg aws.Config, snsTopic string) (bool, error) {
+	_, err := sns.NewFromConfig(cfg).GetTopicAttributes(context.Background(), &sns.GetTopicAttributesInput{
 		TopicArn: aws.String(snsTopic),
 	})
 	if err != nil {
-		if awsErr, ok := err.(awserr.Error); ok {
-			if awsErr.Code() == `NotFound` {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			if apiErr.ErrorCode() == `NotFound` {
 				return false, nil
 			}
 		}
@@ -226,43 +233,41 @@ func topicExists(sess *session.Session, snsTopic string) (bool, error) {
 	return true, nil
 }
 
-func listInactiveSubscriptions(sess *session.Session) ([]string, error) {
+func listInactiveSubscriptions(cfg aws.Config) ([]string, error) {
 	var subs []string
 	var topics = make(map[string]bool, 0)
 	var count int
 
-	err := sns.New(sess).ListSubscriptionsPages(&sns.ListSubscriptionsInput{},
-		func(page *sns.ListSubscriptionsOutput, lastPage bool) bool {
-			count = count + len(page.Subscriptions)
-			for _, s := range page.Subscriptions {
-				if !strings.Contains(*s.Endpoint, "lifecycled-i") {
-					continue
-				}
-				if exists, ok := topics[*s.TopicArn]; ok {
-					if !exists {
-						subs = append(subs, *s.SubscriptionArn)
-					}
-					continue
-				}
-				if exists, _ := topicExists(sess, *s.TopicArn); exists {
-					topics[*s.TopicArn] = true
-				} else {
-					topics[*s.TopicArn] = false
-					subs = append(subs, *s.SubscriptionArn)
-				}
-			}
-			return lastPage
-		})
+	// Only the first page is listed, the subscriptions are listed again once they are deleted
+	page, err := sns.NewFromConfig(cfg).ListSubscriptions(context.Background(), &sns.ListSubscriptionsInput{})
 	if err != nil {
 		return nil, err
 	}
+	count = count + len(page.Subscriptions)
+	for _, s := range page.Subscriptions {
+		if !strings.Contains(*s.Endpoint, "lifecycled-i") {
+			continue
+		}
+		if exists, ok := topics[*s.TopicArn]; ok {
+			if !exists {
+				subs = append(subs, *s.SubscriptionArn)
+			}
+			continue
+		}
+		if exists, _ := topicExists(cfg, *s.TopicArn); exists {
+			topics[*s.TopicArn] = true
+		} else {
+			topics[*s.TopicArn] = false
+			subs = append(subs, *s.SubscriptionArn)
+		}
+	}
 
 	log.Printf("Found %d sns subscriptions in total", count)
 	return subs, nil
 }
 
-func deleteInactiveSubscriptions(sess *session.Session) (int, error) {
-	subs, err := listInactiveSubscriptions(sess)
+func deleteInactiveSubscriptions(cfg aws.Config) (int, error) {
+	subs, err := listInactiveSubscriptions(cfg)
 	if err != nil {
 		return 0, err
 	}
@@ -270,7 +275,7 @@ func deleteInactiveSubscriptions(sess *session.Session) (int, error) {
 	var deleted int
 	for idx, s := range subs {
 		log.Printf("Deleting sns subscription %s (%d of %d)", s, idx+1, len(subs))
-		_, err := sns.New(sess).Unsubscribe(&sns.UnsubscribeInput{
+		_, err := sns.NewFromConfig(cfg).Unsubscribe(context.Background(), &sns.UnsubscribeInput{
 			SubscriptionArn: aws.String(s),
 		})
 		if err != nil {
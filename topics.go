@@ -0,0 +1,67 @@
+package lifecycled
+
+import (
+	"sync"
+	"time"
+)
+
+// addSecondaryTopics adds the autoscaling listeners of the secondary topics, with the clients of
+// their regions, which share the lifecycle action tokens that they have received with the
+// listener of the topic so that a message that is mirrored to each topic is handled once. A
+// topic whose region has no clients is logged and left out.
+func (d *Daemon) addSecondaryTopics(config *Config, regions map[string]RegionClients) {
+	if len(config.SecondarySNSTopics) == 0 {
+		return
+	}
+	tokens := &actionTokens{}
+	d.autoscalingOptions.tokens = tokens
+	for _, l := range d.listeners {
+		if a, ok := l.(*AutoscalingListener); ok {
+			a.options.tokens = tokens
+		}
+	}
+	for _, topic := range config.SecondarySNSTopics {
+		clients, ok := regions[topicRegion(topic)]
+		if !ok {
+			d.logger.WithField("topic", topic).Warn("No aws clients for the region of the secondary topic, it is not subscribed to")
+			continue
+		}
+		d.addAutoscalingListener(config, topic, clients.SQS, clients.SNS, clients.KMS)
+	}
+}
+
+// actionTokenTTL is how long the token of a lifecycle action is remembered, which is as long as
+// the autoscaling API allows the action to last.
+const actionTokenTTL = 48 * time.Hour
+
+// actionTokens are the lifecycle action tokens of the messages received by the listeners of
+// several topics. A nil *actionTokens doesn't deduplicate the messages.
+type actionTokens struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// first returns true the first time that a message of the lifecycle action with the token is
+// received, and false for the copies of it from the other topics. Messages without a token are
+// always first.
+func (t *actionTokens) first(token string) bool {
+	if t == nil || token == "" {
+		return true
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen == nil {
+		t.seen = make(map[string]time.Time)
+	}
+	for k, at := range t.seen {
+		if now.Sub(at) > actionTokenTTL {
+			delete(t.seen, k)
+		}
+	}
+	if _, ok := t.seen[token]; ok {
+		return false
+	}
+	t.seen[token] = now
+	return true
+}
@@ -0,0 +1,214 @@
+package lifecycled_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+)
+
+// expectTopicQueue expects the queue of a topic to be created, subscribed and cleaned up, and
+// its messages are received with receive.
+func expectTopicQueue(sq *mocks.MockSQSClient, sn *mocks.MockSNSClient, receive func(context.Context) (*sqs.ReceiveMessageOutput, error)) {
+	sq.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.CreateQueueOutput{
+		QueueUrl: aws.String("url"),
+	}, nil)
+	sq.EXPECT().GetQueueAttributes(gomock.Any(), gomock.Any()).Times(1).Return(&sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"QueueArn": "arn"},
+	}, nil)
+	sn.EXPECT().Subscribe(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sns.SubscribeOutput{
+		SubscriptionArn: aws.String("arn"),
+	}, nil)
+	sq.EXPECT().ReceiveMessage(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+		func(ctx context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+			return receive(ctx)
+		},
+	)
+	sq.EXPECT().DeleteQueue(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+	sn.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+}
+
+// blockingReceive blocks until the poll is cancelled.
+func blockingReceive(ctx context.Context) (*sqs.ReceiveMessageOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSecondaryTopics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq, sn := mocks.NewMockSQSClient(ctrl), mocks.NewMockSNSClient(ctrl)
+	secondarySQS, secondarySNS := mocks.NewMockSQSClient(ctrl), mocks.NewMockSNSClient(ctrl)
+	as := mocks.NewMockAutoscalingClient(ctrl)
+
+	// The message is mirrored to both topics, and the copy of the primary topic arrives last
+	var once, deleted sync.Once
+	delivered := make(chan struct{})
+	expectTopicQueue(secondarySQS, secondarySNS, func(ctx context.Context) (*sqs.ReceiveMessageOutput, error) {
+		var out *sqs.ReceiveMessageOutput
+		once.Do(func() { out = &sqs.ReceiveMessageOutput{Messages: []sqstypes.Message{newSQSMessage(instanceID)}} })
+		if out != nil {
+			return out, nil
+		}
+		return blockingReceive(ctx)
+	})
+	secondarySQS.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(context.Context, *sqs.DeleteMessageInput, ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+			deleted.Do(func() { close(delivered) })
+			return &sqs.DeleteMessageOutput{}, nil
+		},
+	)
+	var primary sync.Once
+	expectTopicQueue(sq, sn, func(ctx context.Context) (*sqs.ReceiveMessageOutput, error) {
+		select {
+		case <-delivered:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		var out *sqs.ReceiveMessageOutput
+		primary.Do(func() { out = &sqs.ReceiveMessageOutput{Messages: []sqstypes.Message{newSQSMessage(instanceID)}} })
+		if out != nil {
+			return out, nil
+		}
+		return blockingReceive(ctx)
+	})
+	sq.EXPECT().DeleteMessage(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(&sqs.DeleteMessageOutput{}, nil)
+
+	// The lifecycle action is completed once, in the region of the instance
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	logger, hook := logrustest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	daemon := lifecycled.NewWithClients(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "arn:aws:sns:us-east-1:123456789012:lifecycled",
+		SecondarySNSTopics:           []string{"arn:aws:sns:us-west-2:123456789012:lifecycled"},
+		AutoscalingHeartbeatInterval: time.Minute,
+	}, &lifecycled.Clients{
+		SQS:         sq,
+		SNS:         sn,
+		Autoscaling: as,
+		Regions: map[string]lifecycled.RegionClients{
+			"us-west-2": {SQS: secondarySQS, SNS: secondarySNS},
+		},
+	}, logger)
+
+	skipped := func() bool {
+		for _, e := range hook.AllEntries() {
+			if e.Message == "Skipping autoscaling message, it was received from another topic" {
+				return e.Data["topic"] == "arn:aws:sns:us-east-1:123456789012:lifecycled"
+			}
+		}
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+
+	// The notice is handled once both copies have been received
+	var handled int
+	err := daemon.Run(ctx, lifecycled.HandlerFunc(func(ctx context.Context, _ ...string) error {
+		handled++
+		for !skipped() {
+			select {
+			case <-ctx.Done():
+				return errors.New("timed out waiting for the copy of the message to be skipped")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if handled != 1 {
+		t.Errorf("expected the notice to be handled once and got %d", handled)
+	}
+}
+
+func TestSecondaryTopicDegraded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sq, sn := mocks.NewMockSQSClient(ctrl), mocks.NewMockSNSClient(ctrl)
+	secondarySQS, secondarySNS := mocks.NewMockSQSClient(ctrl), mocks.NewMockSNSClient(ctrl)
+	expectTopicQueue(sq, sn, blockingReceive)
+
+	// The queue of the secondary topic can't be created, e.g. while its region is unavailable
+	secondarySQS.EXPECT().CreateQueue(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, errors.New("region unavailable"))
+
+	logger, _ := logrustest.NewNullLogger()
+	daemon := lifecycled.NewWithClients(&lifecycled.Config{
+		InstanceID:         "i-000000000000",
+		SNSTopic:           "arn:aws:sns:us-east-1:123456789012:lifecycled",
+		SecondarySNSTopics: []string{"arn:aws:sns:us-west-2:123456789012:lifecycled"},
+	}, &lifecycled.Clients{
+		SQS: sq,
+		SNS: sn,
+		Regions: map[string]lifecycled.RegionClients{
+			"us-west-2": {SQS: secondarySQS, SNS: secondarySNS},
+		},
+	}, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := daemon.Start(ctx)
+		done <- err
+	}()
+
+	// The daemon keeps running on the primary topic
+	degraded := func() *lifecycled.ListenerStatus {
+		var running bool
+		var failed *lifecycled.ListenerStatus
+		for _, l := range daemon.Status().Listeners {
+			l := l
+			switch {
+			case l.Degraded:
+				failed = &l
+			case l.State == lifecycled.ListenerRunning:
+				running = true
+			}
+		}
+		if !running {
+			return nil
+		}
+		return failed
+	}
+	var status *lifecycled.ListenerStatus
+	for status == nil {
+		select {
+		case err := <-done:
+			t.Fatalf("expected the daemon to keep running and got: %v", err)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the listener to be degraded")
+		case <-time.After(10 * time.Millisecond):
+		}
+		status = degraded()
+	}
+	if got, want := status.Topic, "arn:aws:sns:us-west-2:123456789012:lifecycled"; got != want {
+		t.Errorf("expected the listener of topic %s to be degraded and got %s", want, got)
+	}
+	if err := daemon.Healthy(time.Hour); err != nil {
+		t.Errorf("expected the degraded daemon to be healthy and got: %s", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,81 @@
+package lifecycled
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans created by lifecycled.
+const tracerName = "github.com/triarius/lifecycled"
+
+// tracerFor returns the tracer of the provider, which does nothing if the provider is nil.
+func tracerFor(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = trace.NewNoopTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// noticeAttributes describe the notice on its span.
+func noticeAttributes(notice TerminationNotice) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("lifecycled.notice_type", notice.Type())}
+	if n, ok := notice.(DetailedNotice); ok {
+		attrs = append(attrs,
+			attribute.String("lifecycled.instance_id", n.InstanceID()),
+			attribute.String("lifecycled.transition", n.Transition()),
+		)
+	}
+	if n, ok := notice.(groupNamer); ok {
+		attrs = append(attrs, attribute.String("lifecycled.asg", n.groupName()))
+	}
+	return attrs
+}
+
+// endSpan ends the span, recording the error if there is one.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedHandler executes the handler in a child span of the notice.
+type tracedHandler struct {
+	Handler
+	tracer trace.Tracer
+}
+
+// Execute the handler.
+func (h *tracedHandler) Execute(ctx context.Context, args ...string) (err error) {
+	ctx, span := h.tracer.Start(ctx, "lifecycled.handler")
+	defer func() { endSpan(span, err) }()
+	return h.Handler.Execute(ctx, args...)
+}
+
+// HandleNotice passes the notice to the handler.
+func (h *tracedHandler) HandleNotice(ctx context.Context, notice *Notice) (err error) {
+	ctx, span := h.tracer.Start(ctx, "lifecycled.handler")
+	defer func() { endSpan(span, err) }()
+	return executeHandler(ctx, h.Handler, notice)
+}
+
+// traceEnv returns the W3C trace context of the span in the context as environment variables
+// (TRACEPARENT and TRACESTATE), so that the work of a handler can join the trace.
+func traceEnv(ctx context.Context) []string {
+	carrier := propagation.HeaderCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	var env []string
+	if v := carrier.Get("traceparent"); v != "" {
+		env = append(env, "TRACEPARENT="+v)
+	}
+	if v := carrier.Get("tracestate"); v != "" {
+		env = append(env, "TRACESTATE="+v)
+	}
+	return env
+}
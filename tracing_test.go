@@ -0,0 +1,67 @@
+package lifecycled_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/golang/mock/gomock"
+	logrus "github.com/sirupsen/logrus/hooks/test"
+	"github.com/triarius/lifecycled"
+	"github.com/triarius/lifecycled/mocks"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAutoscalingNoticeTrace(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instanceID := "i-000000000000"
+	sq := mocks.NewMockSQSClient(ctrl)
+	sn := mocks.NewMockSNSClient(ctrl)
+	expectQueueMessages(sq, sn, nil, []byte(aws.ToString(newSQSMessage(instanceID).Body)))
+
+	as := mocks.NewMockAutoscalingClient(ctrl)
+	as.EXPECT().RecordLifecycleActionHeartbeat(gomock.Any(), gomock.Any(), gomock.Any()).MinTimes(1).Return(nil, nil)
+	as.EXPECT().CompleteLifecycleAction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, nil)
+
+	recorder := tracetest.NewSpanRecorder()
+	logger, _ := logrus.NewNullLogger()
+	daemon := lifecycled.NewDaemon(&lifecycled.Config{
+		InstanceID:                   instanceID,
+		SNSTopic:                     "topic",
+		AutoscalingHeartbeatInterval: 10 * time.Millisecond,
+		TracerProvider:               sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	}, sq, sn, as, nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	if err := daemon.Run(ctx, sleepyHandler{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	root, ok := spans["lifecycled.notice"]
+	if !ok {
+		t.Fatalf("expected a span for the notice and got %v", spans)
+	}
+	for _, name := range []string{"lifecycled.handler", "lifecycled.heartbeat", "autoscaling.CompleteLifecycleAction"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Errorf("expected a %s span", name)
+			continue
+		}
+		if got, want := s.Parent().SpanID(), root.SpanContext().SpanID(); got != want {
+			t.Errorf("expected the %s span to be a child of the notice span", name)
+		}
+	}
+	if root.EndTime().Before(spans["autoscaling.CompleteLifecycleAction"].EndTime()) {
+		t.Error("expected the notice span to end after the lifecycle action was completed")
+	}
+}
@@ -0,0 +1,54 @@
+package lifecycled
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+)
+
+// The build of lifecycled, which is set when it is built with e.g.
+// -ldflags "-X github.com/triarius/lifecycled.Version=v1.0.0".
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// BuildInfo describes the build of lifecycled.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+}
+
+// Build returns the build of lifecycled.
+func Build() BuildInfo {
+	return BuildInfo{Version: Version, Commit: Commit, BuildDate: BuildDate}
+}
+
+// String returns the version, followed by the commit and build date if they are known,
+// e.g. "v1.0.0 (commit 0b73e50, built 2024-01-02T15:04:05Z)".
+func (b BuildInfo) String() string {
+	var details []string
+	if b.Commit != "" {
+		commit := b.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		details = append(details, "commit "+commit)
+	}
+	if b.BuildDate != "" {
+		details = append(details, "built "+b.BuildDate)
+	}
+	if len(details) == 0 {
+		return b.Version
+	}
+	return b.Version + " (" + strings.Join(details, ", ") + ")"
+}
+
+// AddUserAgent adds lifecycled and its version to the User-Agent of the AWS API calls
+// made with the configuration, so that the builds in use can be audited with CloudTrail.
+func AddUserAgent(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, awsmiddleware.AddUserAgentKeyValue("lifecycled", Version))
+}
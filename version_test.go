@@ -0,0 +1,61 @@
+package lifecycled_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/triarius/lifecycled"
+)
+
+func TestBuildInfoString(t *testing.T) {
+	tests := []struct {
+		build    lifecycled.BuildInfo
+		expected string
+	}{
+		{
+			build:    lifecycled.BuildInfo{Version: "dev"},
+			expected: "dev",
+		},
+		{
+			build:    lifecycled.BuildInfo{Version: "v1.0.0", Commit: "0b73e50c0ffee", BuildDate: "2024-01-02T15:04:05Z"},
+			expected: "v1.0.0 (commit 0b73e50, built 2024-01-02T15:04:05Z)",
+		},
+	}
+
+	for _, tc := range tests {
+		if got := tc.build.String(); got != tc.expected {
+			t.Errorf("expected '%s' and got '%s'", tc.expected, got)
+		}
+	}
+}
+
+func TestAddUserAgent(t *testing.T) {
+	var ua string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+		fmt.Fprint(w, "<ListQueuesResponse><ListQueuesResult></ListQueuesResult></ListQueuesResponse>")
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+		EndpointResolverWithOptions: aws.EndpointResolverWithOptionsFunc(func(_, _ string, _ ...interface{}) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: server.URL}, nil
+		}),
+	}
+	lifecycled.AddUserAgent(&cfg)
+
+	if _, err := sqs.NewFromConfig(cfg).ListQueues(context.TODO(), &sqs.ListQueuesInput{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(ua, "lifecycled/"+lifecycled.Version) {
+		t.Errorf("expected the user agent to include lifecycled and got '%s'", ua)
+	}
+}